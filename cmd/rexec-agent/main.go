@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"os/user"
 	"os/signal"
 	"path/filepath"
 	"runtime"
@@ -81,6 +83,7 @@ type Agent struct {
 	mu         sync.Mutex
 	running    bool
 	reconnects int
+	execs      map[string]context.CancelFunc // Running API execs, by ID
 }
 
 var configPath string
@@ -1642,11 +1645,21 @@ func (a *Agent) handleConnection() {
 			a.sendMessage("pong", nil)
 
 		case "exec":
-			var execCmd struct {
-				Command string `json:"command"`
+			var req execRequest
+			if err := json.Unmarshal(msg.Data, &req); err == nil {
+				go a.execCommand(req)
 			}
-			if err := json.Unmarshal(msg.Data, &execCmd); err == nil {
-				go a.execCommand(execCmd.Command)
+
+		case "exec_cancel":
+			var cancelData struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(msg.Data, &cancelData); err == nil {
+				a.mu.Lock()
+				if cancel := a.execs[cancelData.ID]; cancel != nil {
+					cancel()
+				}
+				a.mu.Unlock()
 			}
 		}
 	}
@@ -1805,17 +1818,185 @@ func (a *Agent) stopShell() {
 	a.mainCmd = nil
 }
 
-func (a *Agent) execCommand(command string) {
-	cmd := exec.Command(a.config.Shell, "-c", command)
-	output, err := cmd.CombinedOutput()
+// Exec limits, matching the server's
+const (
+	defaultExecTimeout = 60 * time.Second
+	maxExecOutputBytes = 4 * 1024 * 1024
+)
 
-	result := map[string]interface{}{
-		"command": command,
-		"output":  string(output),
-		"success": err == nil,
+// execRequest is a one-shot command from the server. Argv runs as is;
+// Command runs with the agent's shell. Requests without an ID come from
+// terminal clients and only get the legacy result fields.
+type execRequest struct {
+	ID      string            `json:"id"`
+	Argv    []string          `json:"argv"`
+	Command string            `json:"command"`
+	Env     map[string]string `json:"env"`
+	Cwd     string            `json:"cwd"`
+	Stdin   string            `json:"stdin"`
+	Timeout int               `json:"timeout"` // Seconds
+	User    string            `json:"user"`
+	Stream  bool              `json:"stream"` // Send output as exec_output messages
+}
+
+// execStreamWriter sends one output stream of an exec as it's produced
+type execStreamWriter struct {
+	agent  *Agent
+	id     string
+	stream string
+}
+
+func (w *execStreamWriter) Write(p []byte) (int, error) {
+	if err := w.agent.sendMessage("exec_output", map[string]interface{}{
+		"id":     w.id,
+		"stream": w.stream,
+		"data":   p,
+	}); err != nil {
+		return 0, err
 	}
+	return len(p), nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
 
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// execCredential resolves a user, uid, user:group or uid:gid to run as
+func execCredential(spec string) (*syscall.Credential, error) {
+	name, group, hasGroup := strings.Cut(spec, ":")
+	u, err := user.Lookup(name)
 	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %q", name)
+		}
+	}
+	gid := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return nil, fmt.Errorf("unknown group %q", group)
+			}
+		}
+		gid = g.Gid
+	}
+	uidVal, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric uid", name)
+	}
+	gidVal, err := strconv.ParseUint(gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("group of %q has no numeric gid", spec)
+	}
+	return &syscall.Credential{Uid: uint32(uidVal), Gid: uint32(gidVal)}, nil
+}
+
+func (a *Agent) execCommand(req execRequest) {
+	timeout := time.Duration(req.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if req.ID != "" {
+		a.mu.Lock()
+		if a.execs == nil {
+			a.execs = make(map[string]context.CancelFunc)
+		}
+		a.execs[req.ID] = cancel
+		a.mu.Unlock()
+		defer func() {
+			a.mu.Lock()
+			delete(a.execs, req.ID)
+			a.mu.Unlock()
+		}()
+	}
+
+	var cmd *exec.Cmd
+	if len(req.Argv) > 0 {
+		cmd = exec.CommandContext(ctx, req.Argv[0], req.Argv[1:]...)
+	} else {
+		shell := a.config.Shell
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		cmd = exec.CommandContext(ctx, shell, "-c", req.Command)
+	}
+	cmd.Dir = req.Cwd
+	cmd.Env = os.Environ()
+	for key, value := range req.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	if req.Stdin != "" {
+		cmd.Stdin = strings.NewReader(req.Stdin)
+	}
+	// Run in its own process group so a timeout kills what it started too
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+
+	result := map[string]interface{}{
+		"id":      req.ID,
+		"command": req.Command,
+	}
+	if req.User != "" {
+		cred, err := execCredential(req.User)
+		if err != nil {
+			result["success"] = false
+			result["error"] = err.Error()
+			a.sendMessage("exec_result", result)
+			return
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+
+	stdout := &cappedBuffer{max: maxExecOutputBytes}
+	stderr := &cappedBuffer{max: maxExecOutputBytes}
+	if req.Stream {
+		cmd.Stdout = &execStreamWriter{agent: a, id: req.ID, stream: "stdout"}
+		cmd.Stderr = &execStreamWriter{agent: a, id: req.ID, stream: "stderr"}
+	} else {
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+		// Report signals the way shells do
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			exitCode = 128 + int(status.Signal())
+		}
+	}
+	result["exit_code"] = exitCode
+	result["stdout"] = stdout.buf.String()
+	result["stderr"] = stderr.buf.String()
+	result["duration_ms"] = time.Since(start).Milliseconds()
+	result["timed_out"] = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	result["truncated"] = stdout.truncated || stderr.truncated
+	// Terminal clients only read these
+	result["output"] = stdout.buf.String() + stderr.buf.String()
+	result["success"] = err == nil
+	if err != nil && cmd.ProcessState == nil {
 		result["error"] = err.Error()
 	}
 
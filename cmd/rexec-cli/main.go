@@ -77,6 +77,84 @@ type Snippet struct {
 	Username    string `json:"username,omitempty"`
 }
 
+type Template struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	OrgID       string `json:"org_id"`
+	SourceRepo  string `json:"source_repo"`
+	IsOwner     bool   `json:"is_owner"`
+	Spec        struct {
+		Image string `json:"image"`
+		Role  string `json:"role"`
+	} `json:"spec"`
+}
+
+type ImageBuild struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	SourceRepo  string `json:"source_repo"`
+	SizeBytes   int64  `json:"size_bytes"`
+	CachedSteps int    `json:"cached_steps"`
+}
+
+type RegistryCredential struct {
+	ID       string `json:"id"`
+	Registry string `json:"registry"`
+	Kind     string `json:"kind"`
+	Username string `json:"username"`
+	TokenURL string `json:"token_url"`
+}
+
+type Process struct {
+	PID           int       `json:"pid"`
+	User          string    `json:"user"`
+	State         string    `json:"state"`
+	Command       string    `json:"command"`
+	CPUPercent    float64   `json:"cpu_percent"`
+	MemoryBytes   int64     `json:"memory_bytes"`
+	MemoryPercent float64   `json:"memory_percent"`
+	Service       string    `json:"service"`
+	Children      []Process `json:"children"`
+}
+
+type Service struct {
+	Name          string `json:"name"`
+	Command       string `json:"command"`
+	RestartPolicy string `json:"restart_policy"`
+	Enabled       bool   `json:"enabled"`
+	Status        string `json:"status"`
+	PID           int    `json:"pid"`
+	Restarts      int    `json:"restarts"`
+	ExitCode      *int   `json:"exit_code"`
+	LastError     string `json:"last_error"`
+	LogPath       string `json:"log_path"`
+}
+
+type PTYSession struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Shell     string `json:"shell"`
+	Cwd       string `json:"cwd"`
+	Cols      int    `json:"cols"`
+	Rows      int    `json:"rows"`
+	Clients   int    `json:"clients"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ResourceClass struct {
+	Name               string `json:"name"`
+	Description        string `json:"description"`
+	CPUMillicores      int64  `json:"cpu_millicores"`
+	MemoryMB           int64  `json:"memory_mb"`
+	DiskMB             int64  `json:"disk_mb"`
+	BurstCPUMillicores int64  `json:"burst_cpu_millicores"`
+	Allowed            bool   `json:"allowed"`
+}
+
 type AgentConfig struct {
 	Name        string `json:"name"`
 	Host        string `json:"host"`
@@ -118,12 +196,38 @@ func main() {
 		handleStart(args)
 	case "stop":
 		handleStop(args)
+	case "pause":
+		handlePause(args)
+	case "unpause", "resume":
+		handleUnpause(args)
 	case "rm", "delete":
 		handleDelete(args)
 	case "snippets":
 		handleSnippets(args)
+	case "templates":
+		handleTemplates(args)
+	case "classes":
+		handleClasses()
+	case "images":
+		handleImages(args)
+	case "registries":
+		handleRegistries(args)
+	case "ps":
+		handlePs(args)
+	case "kill":
+		handleKill(args)
+	case "services":
+		handleServices(args)
+	case "sessions":
+		handleSessions(args)
+	case "metrics":
+		handleMetrics(args)
+	case "incidents":
+		handleIncidents(args)
 	case "run":
 		handleRun(args)
+	case "exec":
+		handleExec(args)
 	case "agent":
 		handleAgent(args)
 	case "dashboard", "ui":
@@ -161,15 +265,40 @@ func showHelp() {
   %sTerminals:%s
     ls, list           List all terminals
     create             Create a new terminal
+    classes            List resource classes (sizes for --class)
     connect, ssh       Connect to a terminal (interactive shell)
     start <id>         Start a stopped terminal
     stop <id>          Stop a running terminal
+    pause <id>         Freeze a running terminal (memory is kept)
+    unpause <id>       Resume a paused terminal
     rm, delete <id>    Delete a terminal
+    ps <id>            List processes in a terminal
+    kill <id> <pid>    Send a signal to a process
+    services <id>      List/manage supervised services (dev servers...)
+    sessions <id>      List/manage named shells (tabs) in a terminal
+    metrics <id>       Show a terminal's resource usage history
+    incidents <id>     Show OOM kills, crashes and limit alerts
+    exec <id> -- <cmd> Run a command and exit with its status
 
   %sSnippets & Macros:%s
     snippets           List/manage snippets
     run <snippet>      Run a snippet on a terminal
 
+  %sTemplates:%s
+    templates          List environment templates (rexec.yaml)
+    templates add      Add a template from a file or git repo
+    templates rm <id>  Delete a template
+
+  %sImages:%s
+    images             List images built from your Dockerfiles
+    images build       Build an image from a Dockerfile or git repo
+    images rm <id>     Delete a built image
+
+  %sRegistries:%s
+    registries         List private registry credentials
+    registries add     Save credentials for a registry
+    registries rm <id> Delete registry credentials
+
   %sAgent Mode:%s
     agent register     Register this machine as a rexec terminal
     agent start        Start the agent (connect to rexec)
@@ -186,8 +315,21 @@ func showHelp() {
 %sEXAMPLES:%s
   rexec login
   rexec create --name mydev --image ubuntu:22.04 --role devops
+  rexec templates add --repo https://github.com/acme/api
+  rexec create --template api
+  rexec create --name build --class large
+  rexec images build go-toolchain --file Dockerfile
+  rexec create --image build:go-toolchain
+  rexec registries add --kind ghcr --username octocat --secret-stdin
   rexec ls
   rexec connect abc123
+  rexec connect abc123 --new
+  rexec sessions abc123
+  rexec services add abc123 web --cmd "npm run dev"
+  rexec services logs abc123 web -f
+  rexec metrics abc123 --since 24h --step 1h
+  rexec incidents abc123
+  rexec exec abc123 --cwd /app -- go test ./...
   rexec run "docker-install" --terminal abc123
   rexec agent register --name "my-server"
   rexec dashboard
@@ -211,6 +353,9 @@ func showHelp() {
 		Blue, Reset,
 		Blue, Reset,
 		Blue, Reset,
+		Blue, Reset,
+		Blue, Reset,
+		Blue, Reset,
 		Yellow, Reset,
 		Yellow, Reset,
 		DefaultHost)
@@ -859,12 +1004,15 @@ func handleList(args []string) {
 func handleCreate(args []string) {
 	checkAuth()
 
-	// Parse flags
+	// Parse flags. With --template, anything not given on the command line
+	// comes from the template instead of these defaults.
 	name := ""
-	image := "ubuntu"
-	role := "default"
-	memory := "512m"
-	cpu := "0.5"
+	image := ""
+	role := ""
+	memory := ""
+	cpu := ""
+	class := ""
+	template := ""
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -893,6 +1041,35 @@ func handleCreate(args []string) {
 				cpu = args[i+1]
 				i++
 			}
+		case "--class", "-s":
+			if i+1 < len(args) {
+				class = args[i+1]
+				i++
+			}
+		case "--template", "-t":
+			if i+1 < len(args) {
+				template = args[i+1]
+				i++
+			}
+		}
+	}
+
+	if class != "" && (memory != "" || cpu != "") {
+		fmt.Printf("%s--class can't be combined with --memory or --cpu%s\n", Red, Reset)
+		os.Exit(1)
+	}
+	if template == "" {
+		if image == "" {
+			image = "ubuntu"
+		}
+		if role == "" {
+			role = "default"
+		}
+		if memory == "" && class == "" {
+			memory = "512m"
+		}
+		if cpu == "" && class == "" {
+			cpu = "0.5"
 		}
 	}
 
@@ -905,7 +1082,8 @@ func handleCreate(args []string) {
 	// Support custom images when a full docker reference is provided.
 	imageArg := strings.ToLower(strings.TrimSpace(image))
 	customImage := ""
-	if imageArg != "custom" && (strings.Contains(imageArg, "/") || strings.Contains(imageArg, ":")) {
+	// Images built with "rexec images build" are referenced as build:<name>.
+	if imageArg != "custom" && !strings.HasPrefix(imageArg, "build:") && (strings.Contains(imageArg, "/") || strings.Contains(imageArg, ":")) {
 		customImage = imageArg
 		imageArg = "custom"
 	}
@@ -922,9 +1100,16 @@ func handleCreate(args []string) {
 	}
 
 	body := map[string]interface{}{
-		"name":  name,
-		"image": imageArg,
-		"role":  role,
+		"name": name,
+	}
+	if imageArg != "" {
+		body["image"] = imageArg
+	}
+	if role != "" {
+		body["role"] = role
+	}
+	if template != "" {
+		body["template"] = template
 	}
 	if customImage != "" {
 		body["custom_image"] = customImage
@@ -935,6 +1120,9 @@ func handleCreate(args []string) {
 	if cpuShares > 0 {
 		body["cpu_shares"] = cpuShares
 	}
+	if class != "" {
+		body["resource_class"] = class
+	}
 
 	resp, err := apiRequest("POST", "/api/containers", body)
 	if err != nil {
@@ -978,8 +1166,9 @@ func handleCreate(args []string) {
 func handleConnect(args []string) {
 	cfg := checkAuth()
 
+	usage := "Usage: rexec connect <terminal-id> [--session <session-id> | --new]"
 	if len(args) == 0 {
-		fmt.Printf("%sUsage: rexec connect <terminal-id>%s\n", Red, Reset)
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
 		os.Exit(1)
 	}
 
@@ -990,7 +1179,39 @@ func handleConnect(args []string) {
 	}
 	isAgentSession := strings.HasPrefix(terminalID, "agent:")
 
+	sessionID := ""
+	newSession := false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--session", "-s":
+			if i+1 < len(args) {
+				sessionID = args[i+1]
+				i++
+			}
+		case "--new":
+			newSession = true
+		}
+	}
+	if (sessionID != "" || newSession) && isAgentSession {
+		fmt.Printf("%sError: named sessions are not supported on agent terminals%s\n", Red, Reset)
+		os.Exit(1)
+	}
+	if newSession {
+		// Open a second shell next to the terminal's own instead of sharing it
+		cols, rows, _ := term.GetSize(int(os.Stdout.Fd()))
+		session, err := createPTYSession(cfg, terminalID, map[string]interface{}{"cols": cols, "rows": rows})
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+			os.Exit(1)
+		}
+		sessionID = session.ID
+		fmt.Printf("%sStarted session %s%s\n", Dim, sessionID, Reset)
+	}
+
 	wsURL := buildTerminalWSURL(cfg, terminalID)
+	if sessionID != "" {
+		wsURL += "&session=" + url.QueryEscape(sessionID)
+	}
 
 	fmt.Printf("%sConnecting to terminal %s...%s\n", Dim, terminalID, Reset)
 	fmt.Printf("%sTip: press Ctrl+] or double Ctrl+C to disconnect.%s\n", Dim, Reset)
@@ -1180,6 +1401,58 @@ func handleStop(args []string) {
 	}
 }
 
+func handlePause(args []string) {
+	checkAuth()
+
+	if len(args) == 0 {
+		fmt.Printf("%sUsage: rexec pause <terminal-id>%s\n", Red, Reset)
+		os.Exit(1)
+	}
+
+	resp, err := apiRequest("POST", "/api/containers/"+args[0]+"/pause", nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 200 {
+		fmt.Printf("%s✓ Terminal paused%s\n", Green, Reset)
+	} else {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		fmt.Printf("%sError: %s%s\n", Red, errResp.Error, Reset)
+	}
+}
+
+func handleUnpause(args []string) {
+	checkAuth()
+
+	if len(args) == 0 {
+		fmt.Printf("%sUsage: rexec unpause <terminal-id>%s\n", Red, Reset)
+		os.Exit(1)
+	}
+
+	resp, err := apiRequest("POST", "/api/containers/"+args[0]+"/unpause", nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 200 {
+		fmt.Printf("%s✓ Terminal resumed%s\n", Green, Reset)
+	} else {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		fmt.Printf("%sError: %s%s\n", Red, errResp.Error, Reset)
+	}
+}
+
 func handleDelete(args []string) {
 	checkAuth()
 
@@ -1266,127 +1539,1401 @@ func handleSnippets(args []string) {
 	fmt.Println()
 }
 
-func handleRun(args []string) {
+func handleClasses() {
 	cfg := checkAuth()
 
-	if len(args) == 0 {
-		fmt.Printf("%sUsage: rexec run <snippet-name> --terminal <id>%s\n", Red, Reset)
+	resp, err := apiRequestWithConfig(cfg, "GET", "/api/resource-classes", nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
 		os.Exit(1)
 	}
+	defer resp.Body.Close()
 
-	snippetName := args[0]
-	terminalID := ""
-
-	for i := 1; i < len(args); i++ {
-		if (args[i] == "--terminal" || args[i] == "-t") && i+1 < len(args) {
-			terminalID = args[i+1]
-			break
-		}
+	var result struct {
+		Classes []ResourceClass `json:"classes"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&result) != nil {
+		fmt.Printf("%sError: failed to list resource classes (%d)%s\n", Red, resp.StatusCode, Reset)
+		os.Exit(1)
 	}
 
-	if terminalID == "" {
-		// List terminals and ask user to select
-		containers, err := fetchContainers(cfg)
-		if err != nil {
-			fmt.Printf("%sError: %v%s\n", Red, err, Reset)
-			os.Exit(1)
-		}
+	fmt.Printf("\n%s%sResource Classes%s\n", Bold, Cyan, Reset)
+	fmt.Printf("─────────────────────────────────────────────────────────\n")
 
-		if len(containers) == 0 {
-			fmt.Printf("%sNo terminals available. Create one first.%s\n", Red, Reset)
-			os.Exit(1)
+	for _, rc := range result.Classes {
+		availability := Green + "available" + Reset
+		if !rc.Allowed {
+			availability = Dim + "upgrade required" + Reset
 		}
-
-		fmt.Printf("\n%sSelect terminal:%s\n", Bold, Reset)
-		for i, c := range containers {
-			fmt.Printf("  %d. %s (%s)\n", i+1, c.Name, c.ID[:12])
+		fmt.Printf("  %s%s%s [%s]\n", Bold, rc.Name, Reset, availability)
+		if rc.Description != "" {
+			fmt.Printf("    %s\n", rc.Description)
 		}
-		fmt.Print("\nEnter number: ")
-
-		reader := bufio.NewReader(os.Stdin)
-		input, _ := reader.ReadString('\n')
-		idx, err := strconv.Atoi(strings.TrimSpace(input))
-		if err != nil || idx < 1 || idx > len(containers) {
-			fmt.Printf("%sInvalid selection%s\n", Red, Reset)
-			os.Exit(1)
+		sizes := fmt.Sprintf("%.1f vCPU, %d MB memory, %d GB disk", float64(rc.CPUMillicores)/1000, rc.MemoryMB, rc.DiskMB/1024)
+		if rc.BurstCPUMillicores > rc.CPUMillicores {
+			sizes += fmt.Sprintf(", bursts to %.1f vCPU", float64(rc.BurstCPUMillicores)/1000)
 		}
+		fmt.Printf("    %s%s%s\n", Dim, sizes, Reset)
+	}
+	fmt.Printf("\nCreate a terminal: %srexec create --class <name>%s\n\n", Cyan, Reset)
+}
 
-		terminalID = containers[idx-1].ID
+func handleTemplates(args []string) {
+	cfg := checkAuth()
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "add", "create":
+			handleTemplateAdd(cfg, args[1:])
+			return
+		case "rm", "delete":
+			if len(args) < 2 {
+				fmt.Printf("%sUsage: rexec templates rm <id>%s\n", Red, Reset)
+				os.Exit(1)
+			}
+			resp, err := apiRequestWithConfig(cfg, "DELETE", "/api/templates/"+url.PathEscape(args[1]), nil)
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+				os.Exit(1)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("%sError: %s%s\n", Red, strings.TrimSpace(string(body)), Reset)
+				os.Exit(1)
+			}
+			fmt.Printf("%s✓ Template deleted%s\n", Green, Reset)
+			return
+		}
 	}
 
-	// Find snippet
-	snippets, err := fetchSnippets(cfg, "/api/snippets")
+	resp, err := apiRequestWithConfig(cfg, "GET", "/api/templates", nil)
 	if err != nil {
 		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
 		os.Exit(1)
 	}
+	defer resp.Body.Close()
 
-	var snippet *Snippet
-	for i := range snippets {
-		if snippets[i].Name == snippetName || snippets[i].ID == snippetName {
-			snippet = &snippets[i]
-			break
+	var result struct {
+		Templates []Template `json:"templates"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&result) != nil {
+		fmt.Printf("%sError: failed to list templates (%d)%s\n", Red, resp.StatusCode, Reset)
+		os.Exit(1)
+	}
+
+	if len(result.Templates) == 0 {
+		fmt.Printf("\n%sNo templates found.%s\n", Dim, Reset)
+		fmt.Printf("Add one: %srexec templates add --file rexec.yaml%s\n\n", Cyan, Reset)
+		return
+	}
+
+	fmt.Printf("\n%s%sEnvironment Templates%s\n", Bold, Cyan, Reset)
+	fmt.Printf("─────────────────────────────────────────────────────────\n")
+
+	for _, t := range result.Templates {
+		visibility := Dim + "private" + Reset
+		if t.OrgID != "" {
+			visibility = Green + "org" + Reset
+		}
+		fmt.Printf("  %s%s%s [%s] %s%s%s\n", Bold, t.Name, Reset, visibility, Dim, t.ID, Reset)
+		if t.Description != "" {
+			fmt.Printf("    %s\n", t.Description)
+		}
+		fmt.Printf("    %simage: %s  role: %s%s\n", Dim, t.Spec.Image, t.Spec.Role, Reset)
+		if t.SourceRepo != "" {
+			fmt.Printf("    %sfrom: %s%s\n", Dim, t.SourceRepo, Reset)
 		}
 	}
+	fmt.Printf("\nCreate a terminal: %srexec create --template <name>%s\n\n", Cyan, Reset)
+}
 
-	if snippet == nil {
-		// Check marketplace
-		marketplace, err := fetchSnippets(cfg, "/api/marketplace/snippets")
-		if err == nil {
-			for i := range marketplace {
-				if marketplace[i].Name == snippetName || marketplace[i].ID == snippetName {
-					snippet = &marketplace[i]
-					break
-				}
+func handleTemplateAdd(cfg *Config, args []string) {
+	file := ""
+	body := map[string]interface{}{}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--file", "-f":
+			if i+1 < len(args) {
+				file = args[i+1]
+				i++
+			}
+		case "--repo":
+			if i+1 < len(args) {
+				body["repo_url"] = args[i+1]
+				i++
+			}
+		case "--ref":
+			if i+1 < len(args) {
+				body["ref"] = args[i+1]
+				i++
 			}
+		case "--path":
+			if i+1 < len(args) {
+				body["path"] = args[i+1]
+				i++
+			}
+		case "--org":
+			body["share_with_org"] = true
 		}
 	}
 
-	if snippet == nil {
-		fmt.Printf("%sSnippet not found: %s%s\n", Red, snippetName, Reset)
-		os.Exit(1)
+	if file == "" && body["repo_url"] == nil {
+		// Default to a rexec.yaml in the current directory
+		file = "rexec.yaml"
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+			fmt.Printf("Usage: rexec templates add [--file rexec.yaml | --repo <https-url> [--ref <branch>] [--path <file>]] [--org]\n")
+			os.Exit(1)
+		}
+		body["content"] = string(data)
 	}
 
-	fmt.Printf("%sRunning snippet '%s' on terminal %s...%s\n", Dim, snippet.Name, terminalID[:12], Reset)
-	cmdToRun := snippetCommand(*snippet)
-	fmt.Printf("%s$ %s%s\n\n", Dim, cmdToRun, Reset)
-
-	// Connect and run command
-	wsURL := buildTerminalWSURL(cfg, terminalID)
-
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	resp, err := apiRequestWithConfig(cfg, "POST", "/api/templates", body)
 	if err != nil {
-		fmt.Printf("%sError connecting: %v%s\n", Red, err, Reset)
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
 		os.Exit(1)
 	}
-	defer conn.Close()
+	defer resp.Body.Close()
 
-	// Send command
-	if cmdToRun == "" {
-		fmt.Printf("%sSnippet has no content to run%s\n", Red, Reset)
+	if resp.StatusCode != http.StatusCreated {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+			msg = errResp.Error
+		}
+		fmt.Printf("%sError: %s%s\n", Red, msg, Reset)
 		os.Exit(1)
 	}
-	conn.WriteMessage(websocket.BinaryMessage, []byte(cmdToRun+"\n"))
 
-	// Read output for a few seconds
-	done := make(chan bool)
-	go func() {
-		for {
-			_, message, err := conn.ReadMessage()
+	var t Template
+	json.NewDecoder(resp.Body).Decode(&t)
+	fmt.Printf("\n%s✓ Template %s saved%s\n", Green, t.Name, Reset)
+	fmt.Printf("\nCreate a terminal with: %srexec create --template %s%s\n\n", Cyan, t.Name, Reset)
+}
+
+func handleImages(args []string) {
+	cfg := checkAuth()
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "build":
+			handleImageBuild(cfg, args[1:])
+			return
+		case "rm", "delete":
+			if len(args) < 2 {
+				fmt.Printf("%sUsage: rexec images rm <id>%s\n", Red, Reset)
+				os.Exit(1)
+			}
+			resp, err := apiRequestWithConfig(cfg, "DELETE", "/api/images/builds/"+url.PathEscape(args[1]), nil)
 			if err != nil {
-				break
+				fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+				os.Exit(1)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("%sError: %s%s\n", Red, strings.TrimSpace(string(body)), Reset)
+				os.Exit(1)
 			}
-			fmt.Print(string(message))
+			fmt.Printf("%s✓ Image deleted%s\n", Green, Reset)
+			return
 		}
-		done <- true
-	}()
+	}
 
-	select {
-	case <-done:
-	case <-time.After(10 * time.Second):
+	resp, err := apiRequestWithConfig(cfg, "GET", "/api/images/builds", nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Builds []ImageBuild `json:"builds"`
+		Limit  int64        `json:"limit"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&result) != nil {
+		fmt.Printf("%sError: failed to list images (%d)%s\n", Red, resp.StatusCode, Reset)
+		os.Exit(1)
+	}
+
+	if len(result.Builds) == 0 {
+		fmt.Printf("\n%sNo images built yet.%s\n", Dim, Reset)
+		fmt.Printf("Build one: %srexec images build <name> --file Dockerfile%s\n\n", Cyan, Reset)
+		return
 	}
 
-	fmt.Printf("\n%s✓ Command sent%s\n", Green, Reset)
+	fmt.Printf("\n%s%sImages%s (%d/%d)\n", Bold, Cyan, Reset, len(result.Builds), result.Limit)
+	fmt.Printf("─────────────────────────────────────────────────────────\n")
+
+	for _, b := range result.Builds {
+		status := Green + b.Status + Reset
+		switch b.Status {
+		case "building":
+			status = Yellow + b.Status + Reset
+		case "error":
+			status = Red + b.Status + Reset
+		}
+		fmt.Printf("  %s%s%s [%s] %s%s%s\n", Bold, b.Image, Reset, status, Dim, b.ID, Reset)
+		if b.Status == "ready" {
+			fmt.Printf("    %s%d MB, %d cached steps%s\n", Dim, b.SizeBytes/(1024*1024), b.CachedSteps, Reset)
+		}
+		if b.Error != "" {
+			fmt.Printf("    %s%s%s\n", Red, b.Error, Reset)
+		}
+		if b.SourceRepo != "" {
+			fmt.Printf("    %sfrom: %s%s\n", Dim, b.SourceRepo, Reset)
+		}
+	}
+	fmt.Printf("\nCreate a terminal: %srexec create --image build:<name>%s\n\n", Cyan, Reset)
+}
+
+func handleImageBuild(cfg *Config, args []string) {
+	usage := "Usage: rexec images build <name> [--file Dockerfile | --repo <https-url> [--ref <branch>] [--path <dir>] [--dockerfile <file>]] [--no-cache]"
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
+		os.Exit(1)
+	}
+
+	file := ""
+	body := map[string]interface{}{"name": args[0]}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--file", "-f":
+			if i+1 < len(args) {
+				file = args[i+1]
+				i++
+			}
+		case "--repo":
+			if i+1 < len(args) {
+				body["repo_url"] = args[i+1]
+				i++
+			}
+		case "--ref":
+			if i+1 < len(args) {
+				body["ref"] = args[i+1]
+				i++
+			}
+		case "--path":
+			if i+1 < len(args) {
+				body["path"] = args[i+1]
+				i++
+			}
+		case "--dockerfile":
+			if i+1 < len(args) {
+				body["dockerfile_path"] = args[i+1]
+				i++
+			}
+		case "--no-cache":
+			body["no_cache"] = true
+		}
+	}
+
+	if file == "" && body["repo_url"] == nil {
+		file = "Dockerfile"
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+			fmt.Println(usage)
+			os.Exit(1)
+		}
+		body["dockerfile"] = string(data)
+	}
+
+	// Builds can take many minutes, so this request has no client timeout
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequest("POST", cfg.Host+"/api/images/builds/stream", bytes.NewReader(data))
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+			msg = errResp.Error
+		}
+		fmt.Printf("%sError: %s%s\n", Red, msg, Reset)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\n%sBuilding %s...%s\n", Cyan, args[0], Reset)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event struct {
+			Stage    string `json:"stage"`
+			Message  string `json:"message"`
+			Detail   string `json:"detail"`
+			Error    string `json:"error"`
+			Complete bool   `json:"complete"`
+		}
+		if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event) != nil {
+			continue
+		}
+		switch {
+		case event.Error != "":
+			fmt.Printf("\n%s✗ Build failed: %s%s\n\n", Red, event.Error, Reset)
+			os.Exit(1)
+		case event.Complete:
+			fmt.Printf("\n%s✓ Image %s ready%s\n", Green, event.Detail, Reset)
+			fmt.Printf("\nCreate a terminal with: %srexec create --image %s%s\n\n", Cyan, event.Detail, Reset)
+			return
+		case event.Detail != "" && event.Message == "Building image":
+			fmt.Printf("%s%s%s\n", Dim, event.Detail, Reset)
+		case event.Message != "":
+			fmt.Printf("%s\n", event.Message)
+		}
+	}
+	fmt.Printf("%sError: build stream ended unexpectedly%s\n", Red, Reset)
+	os.Exit(1)
+}
+
+func handleRegistries(args []string) {
+	cfg := checkAuth()
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "add":
+			handleRegistryAdd(cfg, args[1:])
+			return
+		case "rm", "delete":
+			if len(args) < 2 {
+				fmt.Printf("%sUsage: rexec registries rm <id>%s\n", Red, Reset)
+				os.Exit(1)
+			}
+			resp, err := apiRequestWithConfig(cfg, "DELETE", "/api/registries/"+url.PathEscape(args[1]), nil)
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+				os.Exit(1)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("%sError: %s%s\n", Red, strings.TrimSpace(string(body)), Reset)
+				os.Exit(1)
+			}
+			fmt.Printf("%s✓ Registry credentials deleted%s\n", Green, Reset)
+			return
+		}
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "GET", "/api/registries", nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Registries []RegistryCredential `json:"registries"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&result) != nil {
+		fmt.Printf("%sError: failed to list registries (%d)%s\n", Red, resp.StatusCode, Reset)
+		os.Exit(1)
+	}
+
+	if len(result.Registries) == 0 {
+		fmt.Printf("\n%sNo registry credentials saved.%s\n", Dim, Reset)
+		fmt.Printf("Add some: %srexec registries add --registry <host> --username <user> --secret-stdin%s\n\n", Cyan, Reset)
+		return
+	}
+
+	fmt.Printf("\n%s%sRegistries%s\n", Bold, Cyan, Reset)
+	fmt.Printf("─────────────────────────────────────────────────────────\n")
+	for _, r := range result.Registries {
+		fmt.Printf("  %s%s%s [%s] %s%s%s\n", Bold, r.Registry, Reset, r.Kind, Dim, r.ID, Reset)
+		if r.Username != "" {
+			fmt.Printf("    %suser: %s%s\n", Dim, r.Username, Reset)
+		}
+		if r.TokenURL != "" {
+			fmt.Printf("    %stoken endpoint: %s%s\n", Dim, r.TokenURL, Reset)
+		}
+	}
+	fmt.Println()
+}
+
+func handleRegistryAdd(cfg *Config, args []string) {
+	usage := "Usage: rexec registries add [--registry <host>] [--kind basic|ghcr|token] [--username <user>] [--secret <secret> | --secret-stdin] [--token-url <https-url>]"
+
+	body := map[string]interface{}{"kind": "basic"}
+	secretStdin := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--registry":
+			if i+1 < len(args) {
+				body["registry"] = args[i+1]
+				i++
+			}
+		case "--kind":
+			if i+1 < len(args) {
+				body["kind"] = args[i+1]
+				i++
+			}
+		case "--username", "-u":
+			if i+1 < len(args) {
+				body["username"] = args[i+1]
+				i++
+			}
+		case "--secret", "-p":
+			if i+1 < len(args) {
+				body["secret"] = args[i+1]
+				i++
+			}
+		case "--secret-stdin":
+			secretStdin = true
+		case "--token-url":
+			if i+1 < len(args) {
+				body["token_url"] = args[i+1]
+				i++
+			}
+		}
+	}
+
+	// Like docker login, prefer reading the secret from stdin over the command line
+	if secretStdin || body["secret"] == nil {
+		if !secretStdin && term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Print("Secret: ")
+			data, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+				os.Exit(1)
+			}
+			body["secret"] = string(data)
+		} else {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+				os.Exit(1)
+			}
+			body["secret"] = strings.TrimRight(string(data), "\r\n")
+		}
+	}
+	if body["secret"] == "" {
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
+		os.Exit(1)
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "POST", "/api/registries", body)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+			msg = errResp.Error
+		}
+		fmt.Printf("%sError: %s%s\n", Red, msg, Reset)
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+
+	var r RegistryCredential
+	json.NewDecoder(resp.Body).Decode(&r)
+	fmt.Printf("\n%s✓ Credentials for %s saved%s\n", Green, r.Registry, Reset)
+	fmt.Printf("Custom images from %s are now pulled with them.\n\n", r.Registry)
+}
+
+// apiError extracts the error message from a failed API response
+func apiError(resp *http.Response) string {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+		return errResp.Error
+	}
+	if msg := strings.TrimSpace(string(data)); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("request failed (%d)", resp.StatusCode)
+}
+
+func handlePs(args []string) {
+	cfg := checkAuth()
+
+	if len(args) == 0 {
+		fmt.Printf("%sUsage: rexec ps <terminal-id>%s\n", Red, Reset)
+		os.Exit(1)
+	}
+	terminalID, err := resolveTerminalID(cfg, args[0])
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "GET", "/api/containers/"+terminalID+"/processes", nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Processes []Process `json:"processes"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	fmt.Printf("\n%s%7s  %-10s %5s  %6s  %5s  %s%s\n", Bold, "PID", "USER", "STAT", "CPU%", "MEM%", "COMMAND", Reset)
+	var printTree func(procs []Process, depth int)
+	printTree = func(procs []Process, depth int) {
+		for _, p := range procs {
+			command := strings.Repeat("  ", depth) + p.Command
+			if p.Service != "" {
+				command += fmt.Sprintf(" %s[service: %s]%s", Cyan, p.Service, Reset)
+			}
+			fmt.Printf("%7d  %-10s %5s  %6.1f  %5.1f  %s\n", p.PID, p.User, p.State, p.CPUPercent, p.MemoryPercent, command)
+			printTree(p.Children, depth+1)
+		}
+	}
+	printTree(result.Processes, 0)
+	fmt.Println()
+}
+
+func handleKill(args []string) {
+	cfg := checkAuth()
+
+	usage := "Usage: rexec kill <terminal-id> <pid> [--signal TERM] [--tree]"
+	if len(args) < 2 {
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
+		os.Exit(1)
+	}
+	terminalID, err := resolveTerminalID(cfg, args[0])
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+
+	body := map[string]interface{}{}
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "--signal", "-s":
+			if i+1 < len(args) {
+				body["signal"] = args[i+1]
+				i++
+			}
+		case "--tree":
+			body["tree"] = true
+		}
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "POST", "/api/containers/"+terminalID+"/processes/"+url.PathEscape(args[1])+"/signal", body)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Signal string `json:"signal"`
+		PIDs   []int  `json:"pids"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	fmt.Printf("%s✓ Sent SIG%s to %d process(es)%s\n", Green, result.Signal, len(result.PIDs), Reset)
+}
+
+func handleMetrics(args []string) {
+	cfg := checkAuth()
+
+	if len(args) == 0 {
+		fmt.Printf("%sUsage: rexec metrics <terminal-id> [--since 1h] [--step 5m]%s\n", Red, Reset)
+		os.Exit(1)
+	}
+	terminalID, err := resolveTerminalID(cfg, args[0])
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+
+	query := url.Values{"from": {"-1h"}}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--since":
+			if i+1 < len(args) {
+				query.Set("from", "-"+strings.TrimPrefix(args[i+1], "-"))
+				i++
+			}
+		case "--step":
+			if i+1 < len(args) {
+				query.Set("step", args[i+1])
+				i++
+			}
+		}
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "GET", "/api/containers/"+terminalID+"/metrics?"+query.Encode(), nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Step   int64 `json:"step"`
+		Points []struct {
+			Time        time.Time `json:"t"`
+			CPUPercent  float64   `json:"cpu_percent"`
+			CPUMax      float64   `json:"cpu_max"`
+			Memory      int64     `json:"memory"`
+			MemoryMax   int64     `json:"memory_max"`
+			MemoryLimit int64     `json:"memory_limit"`
+			NetRxRate   *float64  `json:"net_rx_rate"`
+			NetTxRate   *float64  `json:"net_tx_rate"`
+		} `json:"points"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	if len(result.Points) == 0 {
+		fmt.Printf("\n%sNo metrics recorded in this range.%s\n\n", Dim, Reset)
+		return
+	}
+
+	fmt.Printf("\n%sResource usage%s %s(every %s)%s\n\n", Bold, Reset, Dim, time.Duration(result.Step)*time.Second, Reset)
+	fmt.Printf("%s%-16s  %7s  %7s  %9s  %9s  %9s  %10s  %10s%s\n", Bold, "TIME", "CPU%", "PEAK", "MEMORY", "PEAK", "LIMIT", "NET IN/s", "NET OUT/s", Reset)
+	rate := func(r *float64) string {
+		if r == nil {
+			return "-"
+		}
+		return formatBytes(int64(*r))
+	}
+	for _, p := range result.Points {
+		fmt.Printf("%-16s  %7.1f  %7.1f  %9s  %9s  %9s  %10s  %10s\n",
+			p.Time.Local().Format("Jan 02 15:04"), p.CPUPercent, p.CPUMax,
+			formatBytes(p.Memory), formatBytes(p.MemoryMax), formatBytes(p.MemoryLimit),
+			rate(p.NetRxRate), rate(p.NetTxRate))
+	}
+	fmt.Println()
+}
+
+func handleIncidents(args []string) {
+	cfg := checkAuth()
+
+	if len(args) == 0 {
+		fmt.Printf("%sUsage: rexec incidents <terminal-id> [--limit 50]%s\n", Red, Reset)
+		os.Exit(1)
+	}
+	terminalID, err := resolveTerminalID(cfg, args[0])
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+
+	query := url.Values{}
+	for i := 1; i < len(args); i++ {
+		if args[i] == "--limit" && i+1 < len(args) {
+			query.Set("limit", args[i+1])
+			i++
+		}
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "GET", "/api/containers/"+terminalID+"/incidents?"+query.Encode(), nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Incidents []struct {
+			Kind        string    `json:"kind"`
+			Message     string    `json:"message"`
+			Action      string    `json:"action"`
+			ActionError string    `json:"action_error"`
+			CreatedAt   time.Time `json:"created_at"`
+		} `json:"incidents"`
+		Policy struct {
+			AutoRestart    bool `json:"auto_restart"`
+			AutoGrowMemory bool `json:"auto_grow_memory"`
+		} `json:"policy"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	onOff := func(on bool) string {
+		if on {
+			return Green + "on" + Reset
+		}
+		return Dim + "off" + Reset
+	}
+	fmt.Printf("\n%sIncidents%s  auto-restart: %s  auto-grow memory: %s\n\n", Bold, Reset,
+		onOff(result.Policy.AutoRestart), onOff(result.Policy.AutoGrowMemory))
+	if len(result.Incidents) == 0 {
+		fmt.Printf("%sNo incidents recorded.%s\n\n", Dim, Reset)
+		return
+	}
+
+	fmt.Printf("%s%-16s  %-15s  %-12s  %s%s\n", Bold, "TIME", "KIND", "ACTION", "MESSAGE", Reset)
+	for _, inc := range result.Incidents {
+		fmt.Printf("%-16s  %s%-15s%s  %-12s  %s\n", inc.CreatedAt.Local().Format("Jan 02 15:04"),
+			Yellow, inc.Kind, Reset, inc.Action, inc.Message)
+		if inc.ActionError != "" {
+			fmt.Printf("%-16s  %-15s  %s%s%s\n", "", "", Dim, inc.ActionError, Reset)
+		}
+	}
+	fmt.Println()
+}
+
+// formatBytes formats a byte count as B, KB, MB or GB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, suffix := float64(n)/unit, "KB"
+	for _, next := range []string{"MB", "GB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
+
+func handleServices(args []string) {
+	cfg := checkAuth()
+
+	usage := "Usage: rexec services [add|rm|start|stop|restart|logs] <terminal-id> [name]"
+	action := "list"
+	if len(args) > 0 {
+		switch args[0] {
+		case "add", "rm", "delete", "start", "stop", "restart", "logs":
+			action = args[0]
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 || (action != "list" && len(args) < 2) {
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
+		os.Exit(1)
+	}
+	terminalID, err := resolveTerminalID(cfg, args[0])
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	base := "/api/containers/" + terminalID + "/services"
+
+	switch action {
+	case "add":
+		handleServiceAdd(cfg, base, args[1], args[2:])
+		return
+	case "logs":
+		handleServiceLogs(cfg, base+"/"+url.PathEscape(args[1])+"/logs", args[2:])
+		return
+	case "rm", "delete", "start", "stop", "restart":
+		method, endpoint := "POST", base+"/"+url.PathEscape(args[1])+"/"+action
+		if action == "rm" || action == "delete" {
+			method, endpoint = "DELETE", base+"/"+url.PathEscape(args[1])
+		}
+		resp, err := apiRequestWithConfig(cfg, method, endpoint, nil)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+			os.Exit(1)
+		}
+		fmt.Printf("%s✓ Service %s: %s%s\n", Green, args[1], action, Reset)
+		return
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "GET", base, nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Services []Service `json:"services"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if len(result.Services) == 0 {
+		fmt.Printf("\n%sNo services in this terminal.%s\n", Dim, Reset)
+		fmt.Printf("Add one: %srexec services add %s <name> --cmd \"npm run dev\"%s\n\n", Cyan, args[0], Reset)
+		return
+	}
+
+	fmt.Printf("\n%s%sServices%s\n", Bold, Cyan, Reset)
+	fmt.Printf("─────────────────────────────────────────────────────────\n")
+	for _, svc := range result.Services {
+		status := Yellow + svc.Status + Reset
+		switch svc.Status {
+		case "running":
+			status = Green + svc.Status + Reset
+		case "failed":
+			status = Red + svc.Status + Reset
+		}
+		fmt.Printf("  %s%s%s [%s] %s%s%s\n", Bold, svc.Name, Reset, status, Dim, svc.Command, Reset)
+		details := fmt.Sprintf("restart: %s, restarts: %d", svc.RestartPolicy, svc.Restarts)
+		if svc.PID > 0 {
+			details += fmt.Sprintf(", pid: %d", svc.PID)
+		}
+		if svc.ExitCode != nil {
+			details += fmt.Sprintf(", last exit: %d", *svc.ExitCode)
+		}
+		fmt.Printf("    %s%s%s\n", Dim, details, Reset)
+		if svc.LastError != "" {
+			fmt.Printf("    %s%s%s\n", Red, svc.LastError, Reset)
+		}
+	}
+	fmt.Println()
+}
+
+func handleSessions(args []string) {
+	cfg := checkAuth()
+
+	usage := "Usage: rexec sessions [new|rm] <terminal-id> [session-id]"
+	action := "list"
+	if len(args) > 0 {
+		switch args[0] {
+		case "new", "add", "rm", "delete", "kill":
+			action = args[0]
+			args = args[1:]
+		}
+	}
+	isRemove := action == "rm" || action == "delete" || action == "kill"
+	if len(args) == 0 || (isRemove && len(args) < 2) {
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
+		os.Exit(1)
+	}
+	terminalID, err := resolveTerminalID(cfg, args[0])
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	base := "/api/containers/" + terminalID + "/sessions"
+
+	switch {
+	case action == "new" || action == "add":
+		handleSessionNew(cfg, terminalID, args[0], args[1:])
+		return
+	case isRemove:
+		resp, err := apiRequestWithConfig(cfg, "DELETE", base+"/"+url.PathEscape(args[1]), nil)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+			os.Exit(1)
+		}
+		fmt.Printf("%s✓ Session %s ended%s\n", Green, args[1], Reset)
+		return
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "GET", base, nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Sessions []PTYSession `json:"sessions"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if len(result.Sessions) == 0 {
+		fmt.Printf("\n%sNo named sessions in this terminal.%s\n", Dim, Reset)
+		fmt.Printf("Open one: %srexec connect %s --new%s\n\n", Cyan, args[0], Reset)
+		return
+	}
+
+	fmt.Printf("\n%s%-16s  %-16s %-12s %-9s %7s  %s%s\n", Bold, "ID", "NAME", "SHELL", "SIZE", "CLIENTS", "CWD", Reset)
+	for _, s := range result.Sessions {
+		name := s.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Printf("%-16s  %-16s %-12s %-9s %7d  %s\n", s.ID, name, s.Shell, fmt.Sprintf("%dx%d", s.Cols, s.Rows), s.Clients, s.Cwd)
+	}
+	fmt.Printf("\n%sAttach with: rexec connect %s --session <id>%s\n\n", Dim, args[0], Reset)
+}
+
+func handleSessionNew(cfg *Config, terminalID, shortID string, args []string) {
+	body := map[string]interface{}{}
+	env := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--name", "-n":
+			if i+1 < len(args) {
+				body["name"] = args[i+1]
+				i++
+			}
+		case "--shell":
+			if i+1 < len(args) {
+				body["shell"] = args[i+1]
+				i++
+			}
+		case "--cwd", "-w":
+			if i+1 < len(args) {
+				body["cwd"] = args[i+1]
+				i++
+			}
+		case "--env", "-e":
+			if i+1 < len(args) {
+				key, value, _ := strings.Cut(args[i+1], "=")
+				env[key] = value
+				i++
+			}
+		}
+	}
+	if len(env) > 0 {
+		body["env"] = env
+	}
+
+	session, err := createPTYSession(cfg, terminalID, body)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	fmt.Printf("\n%s✓ Session %s started%s\n", Green, session.ID, Reset)
+	fmt.Printf("Attach with: %srexec connect %s --session %s%s\n\n", Cyan, shortID, session.ID, Reset)
+}
+
+// createPTYSession starts a named shell in a terminal
+func createPTYSession(cfg *Config, terminalID string, body map[string]interface{}) (*PTYSession, error) {
+	resp, err := apiRequestWithConfig(cfg, "POST", "/api/containers/"+terminalID+"/sessions", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("%s", apiError(resp))
+	}
+
+	var session PTYSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func handleServiceAdd(cfg *Config, base, name string, args []string) {
+	usage := "Usage: rexec services add <terminal-id> <name> --cmd <command> [--workdir <dir>] [--env KEY=VALUE]... [--restart always|on-failure|never]"
+
+	body := map[string]interface{}{"name": name}
+	env := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--cmd", "-c":
+			if i+1 < len(args) {
+				body["command"] = args[i+1]
+				i++
+			}
+		case "--workdir", "-w":
+			if i+1 < len(args) {
+				body["workdir"] = args[i+1]
+				i++
+			}
+		case "--env", "-e":
+			if i+1 < len(args) {
+				key, value, _ := strings.Cut(args[i+1], "=")
+				env[key] = value
+				i++
+			}
+		case "--restart":
+			if i+1 < len(args) {
+				body["restart_policy"] = args[i+1]
+				i++
+			}
+		}
+	}
+	if body["command"] == nil {
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
+		os.Exit(1)
+	}
+	if len(env) > 0 {
+		body["env"] = env
+	}
+
+	resp, err := apiRequestWithConfig(cfg, "POST", base, body)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		os.Exit(1)
+	}
+
+	var svc Service
+	json.NewDecoder(resp.Body).Decode(&svc)
+	fmt.Printf("\n%s✓ Service %s added%s\n", Green, svc.Name, Reset)
+	fmt.Printf("Output is written to %s%s%s\n\n", Cyan, svc.LogPath, Reset)
+}
+
+func handleServiceLogs(cfg *Config, endpoint string, args []string) {
+	query := url.Values{}
+	follow := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--follow", "-f":
+			follow = true
+			query.Set("follow", "true")
+		case "--tail", "-n":
+			if i+1 < len(args) {
+				query.Set("tail", args[i+1])
+				i++
+			}
+		}
+	}
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	if !follow {
+		resp, err := apiRequestWithConfig(cfg, "GET", endpoint, nil)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+			os.Exit(1)
+		}
+		var result struct {
+			Lines []string `json:"lines"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		for _, line := range result.Lines {
+			fmt.Println(line)
+		}
+		return
+	}
+
+	// Following lasts until interrupted, so this request has no client timeout
+	req, err := http.NewRequest("GET", cfg.Host+endpoint, nil)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		os.Exit(1)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event struct {
+			Line string `json:"line"`
+		}
+		if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event) == nil {
+			fmt.Println(event.Line)
+		}
+	}
+}
+
+func handleRun(args []string) {
+	cfg := checkAuth()
+
+	if len(args) == 0 {
+		fmt.Printf("%sUsage: rexec run <snippet-name> --terminal <id>%s\n", Red, Reset)
+		os.Exit(1)
+	}
+
+	snippetName := args[0]
+	terminalID := ""
+
+	for i := 1; i < len(args); i++ {
+		if (args[i] == "--terminal" || args[i] == "-t") && i+1 < len(args) {
+			terminalID = args[i+1]
+			break
+		}
+	}
+
+	if terminalID == "" {
+		// List terminals and ask user to select
+		containers, err := fetchContainers(cfg)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+			os.Exit(1)
+		}
+
+		if len(containers) == 0 {
+			fmt.Printf("%sNo terminals available. Create one first.%s\n", Red, Reset)
+			os.Exit(1)
+		}
+
+		fmt.Printf("\n%sSelect terminal:%s\n", Bold, Reset)
+		for i, c := range containers {
+			fmt.Printf("  %d. %s (%s)\n", i+1, c.Name, c.ID[:12])
+		}
+		fmt.Print("\nEnter number: ")
+
+		reader := bufio.NewReader(os.Stdin)
+		input, _ := reader.ReadString('\n')
+		idx, err := strconv.Atoi(strings.TrimSpace(input))
+		if err != nil || idx < 1 || idx > len(containers) {
+			fmt.Printf("%sInvalid selection%s\n", Red, Reset)
+			os.Exit(1)
+		}
+
+		terminalID = containers[idx-1].ID
+	}
+
+	// Find snippet
+	snippets, err := fetchSnippets(cfg, "/api/snippets")
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+
+	var snippet *Snippet
+	for i := range snippets {
+		if snippets[i].Name == snippetName || snippets[i].ID == snippetName {
+			snippet = &snippets[i]
+			break
+		}
+	}
+
+	if snippet == nil {
+		// Check marketplace
+		marketplace, err := fetchSnippets(cfg, "/api/marketplace/snippets")
+		if err == nil {
+			for i := range marketplace {
+				if marketplace[i].Name == snippetName || marketplace[i].ID == snippetName {
+					snippet = &marketplace[i]
+					break
+				}
+			}
+		}
+	}
+
+	if snippet == nil {
+		fmt.Printf("%sSnippet not found: %s%s\n", Red, snippetName, Reset)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%sRunning snippet '%s' on terminal %s...%s\n", Dim, snippet.Name, terminalID[:12], Reset)
+	cmdToRun := snippetCommand(*snippet)
+	fmt.Printf("%s$ %s%s\n\n", Dim, cmdToRun, Reset)
+
+	if cmdToRun == "" {
+		fmt.Printf("%sSnippet has no content to run%s\n", Red, Reset)
+		os.Exit(1)
+	}
+	os.Exit(runExec(cfg, terminalID, map[string]interface{}{"script": cmdToRun}))
+}
+
+func handleExec(args []string) {
+	cfg := checkAuth()
+
+	usage := "Usage: rexec exec <terminal-id> [--env KEY=value] [--cwd <dir>] [--user <user>] [--timeout <secs>] -- <command> [args...]"
+	if len(args) < 2 {
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
+		os.Exit(1)
+	}
+	terminalID, err := resolveTerminalID(cfg, args[0])
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		os.Exit(1)
+	}
+
+	body := map[string]interface{}{}
+	env := map[string]string{}
+	var command []string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--env", "-e":
+			if i+1 < len(args) {
+				key, value, _ := strings.Cut(args[i+1], "=")
+				env[key] = value
+				i++
+			}
+		case "--cwd", "-w":
+			if i+1 < len(args) {
+				body["cwd"] = args[i+1]
+				i++
+			}
+		case "--user", "-u":
+			if i+1 < len(args) {
+				body["user"] = args[i+1]
+				i++
+			}
+		case "--timeout":
+			if i+1 < len(args) {
+				timeout, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					fmt.Printf("%sInvalid timeout: %s%s\n", Red, args[i+1], Reset)
+					os.Exit(1)
+				}
+				body["timeout"] = timeout
+				i++
+			}
+		case "--":
+			command = args[i+1:]
+			i = len(args)
+		default:
+			command = args[i:]
+			i = len(args)
+		}
+	}
+	if len(command) == 0 {
+		fmt.Printf("%s%s%s\n", Red, usage, Reset)
+		os.Exit(1)
+	}
+	// A single argument is a shell command line, so pipes and && work
+	if len(command) == 1 {
+		body["script"] = command[0]
+	} else {
+		body["command"] = command
+	}
+	if len(env) > 0 {
+		body["env"] = env
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		stdin, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Printf("%sError reading stdin: %v%s\n", Red, err, Reset)
+			os.Exit(1)
+		}
+		if len(stdin) > 0 {
+			body["stdin"] = string(stdin)
+		}
+	}
+
+	os.Exit(runExec(cfg, terminalID, body))
+}
+
+// runExec runs a one-shot command, streaming its stdout and stderr to ours,
+// and returns its exit code
+func runExec(cfg *Config, terminalID string, body map[string]interface{}) int {
+	data, _ := json.Marshal(body)
+	// Commands may run for up to an hour, so this request has no client timeout
+	req, err := http.NewRequest("POST", cfg.Host+"/api/containers/"+terminalID+"/exec", bytes.NewReader(data))
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		return 1
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", Red, err, Reset)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("%sError: %s%s\n", Red, apiError(resp), Reset)
+		return 1
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event struct {
+			Type     string `json:"type"`
+			Data     string `json:"data"`
+			ExitCode int    `json:"exit_code"`
+			TimedOut bool   `json:"timed_out"`
+			Error    string `json:"error"`
+		}
+		if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event) != nil {
+			continue
+		}
+		switch event.Type {
+		case "stdout":
+			os.Stdout.WriteString(event.Data)
+		case "stderr":
+			os.Stderr.WriteString(event.Data)
+		case "exit":
+			if event.TimedOut {
+				fmt.Fprintf(os.Stderr, "%sCommand timed out%s\n", Yellow, Reset)
+			}
+			return event.ExitCode
+		case "error":
+			fmt.Fprintf(os.Stderr, "%sError: %s%s\n", Red, event.Error, Reset)
+			return 1
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%sConnection lost before the command finished%s\n", Red, Reset)
+	return 1
 }
 
 func handleAgent(args []string) {
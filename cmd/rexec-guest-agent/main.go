@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,6 +13,9 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -191,6 +197,9 @@ type ExecParams struct {
 	Command []string          `json:"command"`
 	Timeout int               `json:"timeout,omitempty"`
 	Env     map[string]string `json:"env,omitempty"`
+	Cwd     string            `json:"cwd,omitempty"`
+	Stdin   string            `json:"stdin,omitempty"`
+	User    string            `json:"user,omitempty"`
 }
 
 // ExecResult matches client structure
@@ -199,8 +208,12 @@ type ExecResult struct {
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
 	Duration int64  `json:"duration_ms"`
+	TimedOut bool   `json:"timed_out,omitempty"`
 }
 
+// defaultExecTimeout applies to commands that don't set a timeout
+const defaultExecTimeout = 60 * time.Second
+
 // handleExec executes a command
 func (s *GuestAgentServer) handleExec(params json.RawMessage) *ExecResult {
 	var p ExecParams
@@ -218,10 +231,24 @@ func (s *GuestAgentServer) handleExec(params json.RawMessage) *ExecResult {
 		}
 	}
 
+	timeout := time.Duration(p.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
 	start := time.Now()
 
-	// Create command
-	cmd := exec.Command(p.Command[0], p.Command[1:]...)
+	// Create command in its own process group, so a timeout kills what it
+	// started too
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+	cmd.Dir = p.Cwd
 
 	// Set environment variables
 	if len(p.Env) > 0 {
@@ -231,24 +258,68 @@ func (s *GuestAgentServer) handleExec(params json.RawMessage) *ExecResult {
 		}
 		cmd.Env = env
 	}
+	if p.Stdin != "" {
+		cmd.Stdin = strings.NewReader(p.Stdin)
+	}
+	if p.User != "" {
+		cred, err := execCredential(p.User)
+		if err != nil {
+			return &ExecResult{ExitCode: -1, Stderr: err.Error()}
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
 
 	// Capture output
-	stdout, err := cmd.Output()
-	stderr := ""
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			stderr = string(exitErr.Stderr)
-		}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil && cmd.ProcessState == nil {
+		return &ExecResult{ExitCode: -1, Stderr: err.Error()}
 	}
 
-	duration := time.Since(start).Milliseconds()
+	exitCode := cmd.ProcessState.ExitCode()
+	// Report signals the way shells do
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exitCode = 128 + int(status.Signal())
+	}
 
 	return &ExecResult{
-		ExitCode: cmd.ProcessState.ExitCode(),
-		Stdout:   string(stdout),
-		Stderr:   stderr,
-		Duration: duration,
+		ExitCode: exitCode,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start).Milliseconds(),
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+}
+
+// execCredential resolves a user, uid, user:group or uid:gid to run as
+func execCredential(spec string) (*syscall.Credential, error) {
+	name, group, hasGroup := strings.Cut(spec, ":")
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %q", name)
+		}
+	}
+	gid := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return nil, fmt.Errorf("unknown group %q", group)
+			}
+		}
+		gid = g.Gid
+	}
+	uidVal, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric uid", name)
+	}
+	gidVal, err := strconv.ParseUint(gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("group of %q has no numeric gid", spec)
 	}
+	return &syscall.Credential{Uid: uint32(uidVal), Gid: uint32(gidVal)}, nil
 }
 
 // CopyParams matches client structure
@@ -31,6 +31,7 @@ import (
 	"github.com/rexec/rexec/internal/container"
 	"github.com/rexec/rexec/internal/crypto"
 	"github.com/rexec/rexec/internal/firecracker"
+	"github.com/rexec/rexec/internal/models"
 	"github.com/rexec/rexec/internal/providers"
 	"github.com/rexec/rexec/internal/pubsub"
 	sshgateway "github.com/rexec/rexec/internal/ssh/gateway"
@@ -411,24 +412,59 @@ func runServer() {
 		log.Println("✅ Firecracker provider registered")
 	}
 
-	// Log Docker connection type
-	dockerHost := os.Getenv("DOCKER_HOST")
-	if dockerHost != "" {
-		log.Printf("✅ Connected to Docker (remote: %s)", dockerHost)
+	// Log container engine connection type
+	if rt := containerManager.RuntimeInfo(); rt.Host != "" {
+		log.Printf("✅ Connected to %s (%s)", rt.Engine, rt.Host)
 	} else {
-		log.Println("✅ Connected to Docker (local socket)")
+		log.Printf("✅ Connected to %s (local socket)", rt.Engine)
 	}
 
 	// Load existing containers from Docker
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Egress policies and bandwidth limits (EGRESS_POLICIES, NETWORK_SHAPING)
+	egressConfig, err := container.EgressConfigFromEnv()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	containerManager.SetEgressConfig(egressConfig)
+	if err := containerManager.LoadEgressPolicies(ctx, store); err != nil {
+		log.Printf("⚠️  Warning: Failed to load egress policies: %v", err)
+	}
+
+	// Custom images from private registries are pulled with the user's stored credentials
+	containerManager.SetRegistryAuth(container.NewRegistryAuth(store))
+
+	// Docker hosts registered as nodes. Terminals are placed across them and
+	// every container call goes to the owning node; the leader drains nodes.
+	nodesLock := store.NewLeaderLock("nodes")
+	defer nodesLock.Release()
+	nodeMonitor := container.NewNodeMonitor(containerManager, store, nodesLock, 30*time.Second)
+	if err := nodeMonitor.Load(ctx); err != nil {
+		log.Printf("⚠️  Warning: Failed to load nodes: %v", err)
+	}
+
+	// Claimed warm pool containers keep their owner's labels in the database
+	if err := containerManager.LoadPoolClaims(ctx, store); err != nil {
+		log.Printf("⚠️  Warning: Failed to load warm pool claims: %v", err)
+	}
+
 	if err := containerManager.LoadExistingContainers(ctx); err != nil {
 		log.Printf("⚠️  Warning: Failed to load existing containers: %v", err)
 	} else {
 		containers := containerManager.ListContainers()
 		log.Printf("✅ Loaded %d existing containers from Docker", len(containers))
 	}
+	go func() {
+		// Pull the network helper ahead of the first create
+		if egressConfig.Shaping || len(egressConfig.TierPolicies) > 0 {
+			if err := containerManager.PullCustomImage(context.Background(), "", egressConfig.HelperImage); err != nil {
+				log.Printf("⚠️  Warning: Failed to pull network helper image: %v", err)
+			}
+		}
+		containerManager.ReapplyNetworkPolicies(context.Background())
+	}()
 
 	// Start cleanup service for idle containers
 	cleanupConfig := container.DefaultCleanupConfig()
@@ -436,24 +472,107 @@ func runServer() {
 		cleanupConfig = container.DevelopmentCleanupConfig()
 	}
 
+	cleanupConfig = container.CleanupConfigFromEnv(cleanupConfig)
+
+	// Started once the container handler can record the statuses it changes
+	var cleanupService *container.CleanupService
 	if cleanupConfig.Enabled {
-		cleanupService := container.NewCleanupService(
+		cleanupService = container.NewCleanupService(
 			containerManager,
 			cleanupConfig.IdleTimeout,
 			cleanupConfig.CheckInterval,
 		)
-		cleanupService.Start()
-		defer cleanupService.Stop()
+		cleanupService.SetIdlePolicy(cleanupConfig.PauseAfter, cleanupConfig.IdleAction)
 	}
 
-	// Start reconciler service to sync DB state with Docker
+	// Reconciler keeps DB state in sync with Docker from its event stream,
+	// with a periodic full resync as a fallback
 	reconcilerService := container.NewReconcilerService(
 		containerManager,
 		store,
-		1*time.Minute, // Check every minute
+		5*time.Minute,
+	)
+
+	// Per-terminal start/stop schedules and expiry; only the instance holding
+	// the leader lock acts on them
+	schedulerLock := store.NewLeaderLock("scheduler")
+	defer schedulerLock.Release()
+	schedulerService := container.NewSchedulerService(
+		containerManager,
+		store,
+		schedulerLock,
+		1*time.Minute,
+	)
+
+	// Services declared in terminals (dev servers and the like) are kept
+	// running by the leader; followers adopt them on failover
+	servicesLock := store.NewLeaderLock("services")
+	defer servicesLock.Release()
+	serviceSupervisor := container.NewServiceSupervisor(
+		containerManager,
+		store,
+		servicesLock,
+		10*time.Second,
+	)
+
+	// OOM kills, crashes, failing health checks and usage near a limit are
+	// recorded as incidents and acted on by each terminal's incident policy
+	incidentsLock := store.NewLeaderLock("incidents")
+	defer incidentsLock.Release()
+	incidentWatcher := container.NewIncidentWatcher(
+		containerManager,
+		store,
+		incidentsLock,
+		15*time.Second,
 	)
-	reconcilerService.Start()
-	defer reconcilerService.Stop()
+
+	// Resource usage history of running terminals, sampled by the leader
+	metricsLock := store.NewLeaderLock("metrics")
+	defer metricsLock.Release()
+	metricsCollector := container.NewMetricsCollector(
+		containerManager,
+		store,
+		metricsLock,
+		models.MetricsSampleInterval,
+	)
+	metricsCollector.SetSampleHook(incidentWatcher.Observe)
+	metricsCollector.Start()
+	defer metricsCollector.Stop()
+
+	// Shared volumes that grow past their size are remounted read-only
+	volumesLock := store.NewLeaderLock("volumes")
+	defer volumesLock.Release()
+	volumeQuotaService := container.NewVolumeQuotaService(
+		containerManager,
+		store,
+		volumesLock,
+		2*time.Minute,
+	)
+
+	// CPU burst credits for resource classes that allow bursting (CPU_BURST=off disables)
+	var burstService *container.BurstService
+	if os.Getenv("CPU_BURST") != "off" {
+		burstLock := store.NewLeaderLock("cpu-burst")
+		defer burstLock.Release()
+		burstService = container.NewBurstService(containerManager, burstLock, 15*time.Second)
+		burstService.Start()
+		defer burstService.Stop()
+	}
+
+	// Start the warm pool (WARM_POOL, e.g. "ubuntu:standard=3,alpine=2").
+	// With no pool configured, members left by a previous run are removed.
+	var warmPool *container.WarmPool
+	warmPoolConfig, err := container.WarmPoolConfigFromEnv()
+	if err != nil {
+		log.Printf("⚠️  Invalid warm pool config: %v (warm pool disabled)", err)
+		warmPoolConfig.Entries = nil
+	}
+	pool := container.NewWarmPool(containerManager, store, warmPoolConfig)
+	pool.Start()
+	if len(warmPoolConfig.Entries) > 0 {
+		warmPool = pool
+		defer warmPool.Stop()
+	}
 
 	// Initialize billing service
 	var billingService *billing.Service
@@ -494,7 +613,36 @@ func runServer() {
 	containerHandler := handlers.NewContainerHandler(containerManager, store, adminEventsHub)
 	containerEventsHub := handlers.NewContainerEventsHub(containerManager, store)
 	containerHandler.SetEventsHub(containerEventsHub)
+	if warmPool != nil {
+		containerHandler.SetWarmPool(warmPool)
+	}
+	containerHandler.SetBurstService(burstService)
 	terminalHandler := handlers.NewTerminalHandler(containerManager, store, adminEventsHub)
+	terminalHandler.SetEventsHub(containerEventsHub)
+	if cleanupService != nil {
+		cleanupService.SetStatusHook(containerHandler.IdleStatusChanged)
+		cleanupService.Start()
+		defer cleanupService.Stop()
+	}
+	reconcilerService.SetChangeHook(containerHandler.ReconcileChanged)
+	reconcilerService.Start()
+	defer reconcilerService.Stop()
+	schedulerService.SetChangeHook(containerHandler.ScheduleChanged)
+	schedulerService.Start()
+	defer schedulerService.Stop()
+	serviceSupervisor.SetChangeHook(containerHandler.ServiceChanged)
+	containerHandler.SetServiceSupervisor(serviceSupervisor)
+	serviceSupervisor.Start()
+	defer serviceSupervisor.Stop()
+	incidentWatcher.SetIncidentHook(containerHandler.IncidentRaised)
+	incidentWatcher.Start()
+	defer incidentWatcher.Stop()
+	volumeQuotaService.SetOverLimitHook(containerHandler.VolumeOverLimit)
+	volumeQuotaService.Start()
+	defer volumeQuotaService.Stop()
+	nodeMonitor.SetMigrateHook(containerHandler.NodeMigrated)
+	nodeMonitor.Start()
+	defer nodeMonitor.Stop()
 	terminalHandler.SetProviderRegistry(providerRegistry) // Enable VM terminal support
 	fileHandler := handlers.NewFileHandler(containerManager, store)
 	sshHandler := handlers.NewSSHHandler(store, containerManager)
@@ -513,6 +661,13 @@ func runServer() {
 	// Initialize snippet handler
 	snippetHandler := handlers.NewSnippetHandler(store)
 
+	// Initialize environment template handler
+	templateHandler := handlers.NewTemplateHandler(store)
+	roleHandler := handlers.NewRoleHandler(store)
+	resourceClassHandler := handlers.NewResourceClassHandler(store)
+	nodeHandler := handlers.NewNodeHandler(store, containerManager, nodeMonitor)
+	registryHandler := handlers.NewRegistryHandler(store)
+
 	// Initialize tutorial handler
 	tutorialHandler := handlers.NewTutorialHandler(store)
 
@@ -682,132 +837,255 @@ func runServer() {
 	api.Use(apiLimiter.Middleware())
 	{
 		// Container management - stricter rate limiting for mutations
-		api.GET("/containers", containerHandler.List)
-		api.POST("/containers", containerLimiter.Middleware(), containerHandler.Create)
-		api.POST("/containers/stream", containerLimiter.Middleware(), containerHandler.CreateWithProgress)
-		api.GET("/containers/:id", containerHandler.Get)
-		api.PATCH("/containers/:id/settings", containerHandler.UpdateSettings)
-		api.DELETE("/containers/:id", containerHandler.Delete)
-		api.POST("/containers/:id/start", containerHandler.Start)
-		api.POST("/containers/:id/stop", containerHandler.Stop)
-
-		// Shell setup
-		api.GET("/containers/:id/shell/status", containerHandler.GetShellStatus)
-		api.POST("/containers/:id/shell/setup", containerHandler.SetupShell)
+		containers := api.Group("/containers")
+		containers.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
+		{
+			containers.GET("", containerHandler.List)
+			containers.POST("", containerLimiter.Middleware(), containerHandler.Create)
+			containers.POST("/stream", containerLimiter.Middleware(), containerHandler.CreateWithProgress)
+			containers.GET("/:id", containerHandler.Get)
+			containers.PATCH("/:id/settings", containerHandler.UpdateSettings)
+			containers.DELETE("/:id", containerHandler.Delete)
+			containers.POST("/:id/start", containerHandler.Start)
+			containers.POST("/:id/stop", containerHandler.Stop)
+			containers.POST("/:id/pause", containerHandler.Pause)
+			containers.POST("/:id/unpause", containerHandler.Unpause)
+
+			// Shell setup
+			containers.GET("/:id/shell/status", containerHandler.GetShellStatus)
+			containers.POST("/:id/shell/setup", containerHandler.SetupShell)
+
+			// Workspace snapshots and forks
+			containers.POST("/:id/snapshots", containerHandler.CreateSnapshot)
+			containers.GET("/:id/snapshots", containerHandler.ListContainerSnapshots)
+			containers.POST("/:id/fork", containerLimiter.Middleware(), containerHandler.Fork)
+
+			// Shared volumes (attaching or detaching recreates the terminal)
+			containers.POST("/:id/volumes", containerHandler.AttachVolume)
+			containers.DELETE("/:id/volumes/:volume_id", containerHandler.DetachVolume)
+
+			// Resource usage history and incidents
+			containers.GET("/:id/metrics", containerHandler.GetMetrics)
+			containers.GET("/:id/incidents", containerHandler.ListIncidents)
+
+			// Processes and supervised services inside a terminal
+			containers.GET("/:id/processes", containerHandler.ListProcesses)
+			containers.POST("/:id/processes/:pid/signal", containerHandler.SignalProcess)
+			containers.GET("/:id/services", containerHandler.ListServices)
+			containers.POST("/:id/services", containerHandler.CreateService)
+			containers.PATCH("/:id/services/:name", containerHandler.UpdateService)
+			containers.DELETE("/:id/services/:name", containerHandler.DeleteService)
+			containers.POST("/:id/services/:name/start", containerHandler.StartService)
+			containers.POST("/:id/services/:name/stop", containerHandler.StopService)
+			containers.POST("/:id/services/:name/restart", containerHandler.RestartService)
+			containers.GET("/:id/services/:name/logs", containerHandler.ServiceLogs)
+
+			// Named shell sessions (tabs) inside a terminal
+			containers.GET("/:id/sessions", containerHandler.ListPTYSessions)
+			containers.POST("/:id/sessions", containerHandler.CreatePTYSession)
+			containers.DELETE("/:id/sessions/:sessionId", containerHandler.DeletePTYSession)
+
+			// One-shot commands without a PTY
+			containers.POST("/:id/exec", containerHandler.Exec)
+
+			// WebSocket for real-time container events
+			containers.GET("/events", containerEventsHub.HandleWebSocket)
+		}
 
-		// File operations
-		api.POST("/containers/:id/files", fileHandler.Upload)
-		api.GET("/containers/:id/files", fileHandler.Download)
-		api.GET("/containers/:id/files/list", fileHandler.List)
-		api.DELETE("/containers/:id/files", fileHandler.Delete)
-		api.POST("/containers/:id/files/mkdir", fileHandler.Mkdir)
-
-		// Available images
-		api.GET("/images", containerHandler.ListImages)
-
-		// Available roles/environments
-		api.GET("/roles", containerHandler.ListRoles)
-
-		// Stats endpoint
-		api.GET("/stats", containerHandler.Stats)
-
-		// User profile
-		api.GET("/profile", authHandler.GetProfile)
-		api.PUT("/profile", authHandler.UpdateProfile)
-
-		// Security (server-enforced screen lock)
-		api.GET("/security", securityHandler.GetScreenLock)
-		api.PATCH("/security", securityHandler.UpdateSettings)
-		api.POST("/security/passcode", securityHandler.SetPasscode)
-		api.DELETE("/security/passcode", securityHandler.RemovePasscode)
-		api.POST("/security/lock", securityHandler.Lock)
-		api.POST("/security/unlock", securityHandler.Unlock)
-		api.POST("/security/single-session", securityHandler.SetSingleSessionMode)
-
-		// Terminal MFA lock (requires MFA to be enabled)
-		api.GET("/security/terminal/:id/mfa-status", securityHandler.GetTerminalMFAStatus)
-		api.POST("/security/terminal/:id/mfa-lock", securityHandler.LockTerminalWithMFA)
-		api.POST("/security/terminal/:id/mfa-unlock", securityHandler.UnlockTerminalWithMFA)
-		api.POST("/security/terminal/:id/mfa-verify", securityHandler.VerifyTerminalMFAAccess)
-
-		// Auth sessions
-		sessions := api.Group("/sessions")
+		// Snapshot management (restore into a new terminal via POST /containers with snapshot_id)
+		snapshots := api.Group("/snapshots")
+		snapshots.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
 		{
-			sessions.GET("", sessionsHandler.List)
-			sessions.DELETE("/:id", sessionsHandler.Revoke)
-			sessions.POST("/revoke-others", sessionsHandler.RevokeOthers)
+			snapshots.GET("", containerHandler.ListSnapshots)
+			snapshots.GET("/:id", containerHandler.GetSnapshot)
+			snapshots.DELETE("/:id", containerHandler.DeleteSnapshot)
+			snapshots.POST("/:id/restore", containerHandler.RestoreSnapshot)
 		}
 
-		// MFA
-		mfa := api.Group("/mfa")
+		// Custom images built from a Dockerfile (create terminals with image "build:<name>")
+		imageBuilds := api.Group("/images/builds")
+		imageBuilds.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
 		{
-			mfa.GET("/setup", authHandler.SetupMFA)
-			mfa.POST("/verify", authHandler.VerifyMFA)
-			mfa.POST("/disable", authHandler.DisableMFA)
-			mfa.POST("/validate", authHandler.ValidateMFA)
-			mfa.POST("/complete-login", authHandler.CompleteMFALogin)
-			mfa.GET("/backup-codes/count", authHandler.GetBackupCodesCount)
-			mfa.POST("/backup-codes/regenerate", authHandler.RegenerateBackupCodes)
+			imageBuilds.GET("", containerHandler.ListImageBuilds)
+			imageBuilds.POST("", containerHandler.BuildImage)
+			imageBuilds.POST("/stream", containerHandler.BuildImageWithProgress)
+			imageBuilds.GET("/:id", containerHandler.GetImageBuild)
+			imageBuilds.DELETE("/:id", containerHandler.DeleteImageBuild)
 		}
 
-		// Audit Logs
-		api.GET("/audit-logs", authHandler.GetAuditLogs)
+		// Shared volume management
+		volumes := api.Group("/volumes")
+		volumes.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
+		{
+			volumes.GET("", containerHandler.ListVolumes)
+			volumes.POST("", containerHandler.CreateVolume)
+			volumes.GET("/:id", containerHandler.GetVolume)
+			volumes.PATCH("/:id", containerHandler.UpdateVolume)
+			volumes.DELETE("/:id", containerHandler.DeleteVolume)
+		}
 
-		// SSH key management
-		ssh := api.Group("/ssh")
+		// Environment templates (rexec.yaml)
+		templates := api.Group("/templates")
+		templates.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
 		{
-			ssh.GET("/keys", sshHandler.ListSSHKeys)
-			ssh.POST("/keys", sshHandler.AddSSHKey)
-			ssh.DELETE("/keys/:id", sshHandler.DeleteSSHKey)
-			ssh.GET("/connect/:containerId", sshHandler.GetSSHConnectionInfo)
-			ssh.POST("/sync/:containerId", sshHandler.SyncSSHKeys)
-			ssh.GET("/status/:containerId", sshHandler.CheckSSHStatus)
-			ssh.POST("/install/:containerId", sshHandler.InstallSSH)
-
-			// Remote Hosts (Jump Hosts)
-			ssh.GET("/hosts", sshHandler.ListRemoteHosts)
-			ssh.POST("/hosts", sshHandler.AddRemoteHost)
-			ssh.DELETE("/hosts/:id", sshHandler.DeleteRemoteHost)
+			templates.GET("", templateHandler.ListTemplates)
+			templates.POST("", templateHandler.CreateTemplate)
+			templates.GET("/:id", templateHandler.GetTemplate)
+			templates.PUT("/:id", templateHandler.UpdateTemplate)
+			templates.DELETE("/:id", templateHandler.DeleteTemplate)
 		}
 
-		// Port Forwarding
-		portforward := api.Group("/containers/:id/port-forwards")
+		// Custom roles (built-in and custom roles are listed together at GET /roles)
+		customRoles := api.Group("/roles/custom")
+		customRoles.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
 		{
-			portforward.POST("", portForwardHandler.CreatePortForward)
-			portforward.GET("", portForwardHandler.ListPortForwards)
-			portforward.DELETE("/:forwardId", portForwardHandler.DeletePortForward)
+			customRoles.GET("", roleHandler.ListCustomRoles)
+			customRoles.POST("", roleHandler.CreateCustomRole)
+			customRoles.GET("/:id", roleHandler.GetCustomRole)
+			customRoles.PUT("/:id", roleHandler.UpdateCustomRole)
+			customRoles.DELETE("/:id", roleHandler.DeleteCustomRole)
 		}
 
-		// Snippets & Macros
-		snippets := api.Group("/snippets")
+		// File operations
+		files := api.Group("/containers/:id/files")
+		files.Use(middleware.RequireScopeByMethod(store, models.ScopeFilesRead, models.ScopeFilesWrite))
 		{
-			snippets.GET("", snippetHandler.ListSnippets)
-			snippets.POST("", snippetHandler.CreateSnippet)
-			snippets.PUT("/:id", snippetHandler.UpdateSnippet)
-			snippets.DELETE("/:id", snippetHandler.DeleteSnippet)
-			snippets.POST("/:id/use", snippetHandler.UseSnippet)
+			files.POST("", fileHandler.Upload)
+			files.GET("", fileHandler.Download)
+			files.GET("/list", fileHandler.List)
+			files.DELETE("", fileHandler.Delete)
+			files.POST("/mkdir", fileHandler.Mkdir)
 		}
 
-		// API Tokens for CLI/API authentication
-		tokens := api.Group("/tokens")
+		// Catalog and usage stats
+		catalog := api.Group("")
+		catalog.Use(middleware.RequireScope(store, models.ScopeContainersRead))
 		{
-			tokens.GET("", tokenHandler.ListTokens)
-			tokens.POST("", tokenHandler.CreateToken)
-			tokens.DELETE("/:id", tokenHandler.RevokeToken)
-			tokens.DELETE("/:id/permanent", tokenHandler.DeleteToken)
+			// Available images
+			catalog.GET("/images", containerHandler.ListImages)
+
+			// Available roles/environments
+			catalog.GET("/roles", containerHandler.ListRoles)
+
+			// Resource classes terminals can be sized with
+			catalog.GET("/resource-classes", resourceClassHandler.List)
+
+			// Stats endpoint
+			catalog.GET("/stats", containerHandler.Stats)
+
+			// Provider endpoints
+			catalog.GET("/providers", vmHandler.ListProviders)
 		}
 
-		// Token validation endpoint (for CLI)
-		api.GET("/tokens/validate", tokenHandler.ValidateToken)
+		// Account settings: profile, security, sessions, MFA, SSH keys, snippets, tokens, billing
+		account := api.Group("")
+		account.Use(middleware.RequireScopeByMethod(store, models.ScopeAccountRead, models.ScopeAccountWrite))
+		{
+			// User profile
+			account.GET("/profile", authHandler.GetProfile)
+			account.PUT("/profile", authHandler.UpdateProfile)
+
+			// Security (server-enforced screen lock)
+			account.GET("/security", securityHandler.GetScreenLock)
+			account.PATCH("/security", securityHandler.UpdateSettings)
+			account.POST("/security/passcode", securityHandler.SetPasscode)
+			account.DELETE("/security/passcode", securityHandler.RemovePasscode)
+			account.POST("/security/lock", securityHandler.Lock)
+			account.POST("/security/unlock", securityHandler.Unlock)
+			account.POST("/security/single-session", securityHandler.SetSingleSessionMode)
+
+			// Terminal MFA lock (requires MFA to be enabled)
+			account.GET("/security/terminal/:id/mfa-status", securityHandler.GetTerminalMFAStatus)
+			account.POST("/security/terminal/:id/mfa-lock", securityHandler.LockTerminalWithMFA)
+			account.POST("/security/terminal/:id/mfa-unlock", securityHandler.UnlockTerminalWithMFA)
+			account.POST("/security/terminal/:id/mfa-verify", securityHandler.VerifyTerminalMFAAccess)
+
+			// Auth sessions
+			sessions := account.Group("/sessions")
+			{
+				sessions.GET("", sessionsHandler.List)
+				sessions.DELETE("/:id", sessionsHandler.Revoke)
+				sessions.POST("/revoke-others", sessionsHandler.RevokeOthers)
+			}
+
+			// MFA
+			mfa := account.Group("/mfa")
+			{
+				mfa.GET("/setup", authHandler.SetupMFA)
+				mfa.POST("/verify", authHandler.VerifyMFA)
+				mfa.POST("/disable", authHandler.DisableMFA)
+				mfa.POST("/validate", authHandler.ValidateMFA)
+				mfa.POST("/complete-login", authHandler.CompleteMFALogin)
+				mfa.GET("/backup-codes/count", authHandler.GetBackupCodesCount)
+				mfa.POST("/backup-codes/regenerate", authHandler.RegenerateBackupCodes)
+			}
+
+			// Audit Logs
+			account.GET("/audit-logs", authHandler.GetAuditLogs)
 
-		// Public snippets marketplace (authenticated users can see who owns)
-		api.GET("/snippets/marketplace", snippetHandler.ListPublicSnippets)
+			// SSH key management
+			ssh := account.Group("/ssh")
+			{
+				ssh.GET("/keys", sshHandler.ListSSHKeys)
+				ssh.POST("/keys", sshHandler.AddSSHKey)
+				ssh.DELETE("/keys/:id", sshHandler.DeleteSSHKey)
+				ssh.GET("/connect/:containerId", sshHandler.GetSSHConnectionInfo)
+				ssh.POST("/sync/:containerId", sshHandler.SyncSSHKeys)
+				ssh.GET("/status/:containerId", sshHandler.CheckSSHStatus)
+				ssh.POST("/install/:containerId", sshHandler.InstallSSH)
+
+				// Remote Hosts (Jump Hosts)
+				ssh.GET("/hosts", sshHandler.ListRemoteHosts)
+				ssh.POST("/hosts", sshHandler.AddRemoteHost)
+				ssh.DELETE("/hosts/:id", sshHandler.DeleteRemoteHost)
+			}
 
-		// WebSocket for real-time container events
-		api.GET("/containers/events", containerEventsHub.HandleWebSocket)
+			// Private registry credentials for custom images
+			registries := account.Group("/registries")
+			{
+				registries.GET("", registryHandler.ListRegistryCredentials)
+				registries.POST("", registryHandler.SaveRegistryCredential)
+				registries.DELETE("/:id", registryHandler.DeleteRegistryCredential)
+			}
+
+			// Snippets & Macros
+			snippets := account.Group("/snippets")
+			{
+				snippets.GET("", snippetHandler.ListSnippets)
+				snippets.POST("", snippetHandler.CreateSnippet)
+				snippets.PUT("/:id", snippetHandler.UpdateSnippet)
+				snippets.DELETE("/:id", snippetHandler.DeleteSnippet)
+				snippets.POST("/:id/use", snippetHandler.UseSnippet)
+			}
+
+			// API Tokens for CLI/API authentication
+			tokens := account.Group("/tokens")
+			{
+				tokens.GET("", tokenHandler.ListTokens)
+				tokens.POST("", tokenHandler.CreateToken)
+				tokens.DELETE("/:id", tokenHandler.RevokeToken)
+				tokens.DELETE("/:id/permanent", tokenHandler.DeleteToken)
+			}
+
+			// Public snippets marketplace (authenticated users can see who owns)
+			account.GET("/snippets/marketplace", snippetHandler.ListPublicSnippets)
+		}
+
+		// Port Forwarding
+		portforward := api.Group("/containers/:id/port-forwards")
+		portforward.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
+		{
+			portforward.POST("", portForwardHandler.CreatePortForward)
+			portforward.GET("", portForwardHandler.ListPortForwards)
+			portforward.DELETE("/:forwardId", portForwardHandler.DeletePortForward)
+		}
+
+		// Token validation endpoint (for CLI). Any valid token may call it.
+		api.GET("/tokens/validate", tokenHandler.ValidateToken)
 
 		// Collaboration endpoints
 		collab := api.Group("/collab")
+		collab.Use(middleware.RequireScope(store, models.ScopeTerminalConnect))
 		{
 			collab.POST("/start", collabHandler.StartSession)
 			collab.GET("/join/:code", collabHandler.JoinSession)
@@ -823,6 +1101,7 @@ func runServer() {
 
 		// Recording endpoints
 		recordings := api.Group("/recordings")
+		recordings.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
 		{
 			recordings.GET("", recordingHandler.GetRecordings)
 			recordings.POST("/start", recordingHandler.StartRecording)
@@ -836,6 +1115,7 @@ func runServer() {
 
 		// Billing endpoints
 		billing := api.Group("/billing")
+		billing.Use(middleware.RequireScopeByMethod(store, models.ScopeAccountRead, models.ScopeAccountWrite))
 		{
 			billing.GET("/plans", billingHandler.GetPlans)
 			billing.GET("/subscription", billingHandler.GetSubscription)
@@ -850,17 +1130,20 @@ func runServer() {
 
 		// Agent endpoints
 		agents := api.Group("/agents")
+		agents.Use(middleware.RequireScopeByMethod(store, models.ScopeAgentsRead, models.ScopeAgentsWrite))
 		{
 			agents.POST("/register", agentHandler.RegisterAgent)
 			agents.GET("", agentHandler.ListAgents)
 			agents.GET("/:id", agentHandler.GetAgent)
 			agents.GET("/:id/status", agentHandler.GetAgentStatus)
+			agents.GET("/:id/metrics", agentHandler.GetAgentMetrics)
 			agents.PATCH("/:id", agentHandler.UpdateAgent)
 			agents.DELETE("/:id", agentHandler.DeleteAgent)
 		}
 
 		// VM/Terminal endpoints (unified provider API)
 		vms := api.Group("/vms")
+		vms.Use(middleware.RequireScopeByMethod(store, models.ScopeContainersRead, models.ScopeContainersWrite))
 		{
 			vms.GET("", vmHandler.List)
 			vms.POST("", containerLimiter.Middleware(), vmHandler.Create)
@@ -870,15 +1153,13 @@ func runServer() {
 			vms.POST("/:id/stop", vmHandler.Stop)
 		}
 
-		// Provider endpoints
-		api.GET("/providers", vmHandler.ListProviders)
-
 		// Admin routes
 		admin := api.Group("/admin")
-		admin.Use(middleware.AdminOnly(store))
+		admin.Use(middleware.RequireScope(store, models.ScopeAdmin), middleware.AdminOnly(store))
 		{
 			admin.GET("/users", adminHandler.ListUsers)
 			admin.DELETE("/users/:id", adminHandler.DeleteUser)
+			admin.PUT("/users/:id/org", adminHandler.SetUserOrg)
 
 			admin.GET("/containers", adminHandler.ListContainers)
 			admin.DELETE("/containers/:id", adminHandler.DeleteContainer)
@@ -887,7 +1168,19 @@ func runServer() {
 			admin.GET("/agents", adminHandler.ListAgents)
 
 			// Debug/runtime info (admin-only)
-			admin.GET("/runtime", handlers.GetRuntimeStats)
+			admin.GET("/runtime", handlers.RuntimeStatsHandler(containerManager, warmPool))
+
+			// Resource class catalog (admin-only)
+			admin.GET("/resource-classes", resourceClassHandler.AdminList)
+			admin.PUT("/resource-classes/:name", resourceClassHandler.Save)
+			admin.DELETE("/resource-classes/:name", resourceClassHandler.Delete)
+
+			// Docker hosts terminals are placed on (admin-only)
+			admin.GET("/nodes", nodeHandler.List)
+			admin.POST("/nodes", nodeHandler.Register)
+			admin.PATCH("/nodes/:id", nodeHandler.Update)
+			admin.POST("/nodes/:id/drain", nodeHandler.Drain)
+			admin.DELETE("/nodes/:id", nodeHandler.Delete)
 
 			// Tutorial management (admin-only)
 			tutorials := admin.Group("/tutorials")
@@ -901,8 +1194,12 @@ func runServer() {
 		}
 
 		// Public tutorials endpoint (authenticated users)
-		api.GET("/tutorials", tutorialHandler.ListPublicTutorials)
-		api.GET("/tutorials/:id", tutorialHandler.GetTutorial)
+		publicTutorials := api.Group("/tutorials")
+		publicTutorials.Use(middleware.RequireScope(store, models.ScopeAccountRead))
+		{
+			publicTutorials.GET("", tutorialHandler.ListPublicTutorials)
+			publicTutorials.GET("/:id", tutorialHandler.GetTutorial)
+		}
 	}
 
 	// Stripe webhook (public, verified by signature)
@@ -911,13 +1208,16 @@ func runServer() {
 	}
 
 	// WebSocket terminal endpoint - with rate limiting
-	router.GET("/ws/terminal/:containerId", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), terminalHandler.HandleWebSocket)
+	router.GET("/ws/terminal/:containerId", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), middleware.RequireScope(store, models.ScopeTerminalConnect), terminalHandler.HandleWebSocket)
+
+	// WebSocket for one-shot commands with streamed stdin
+	router.GET("/ws/exec/:id", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), middleware.RequireScope(store, models.ScopeContainersWrite), containerHandler.HandleExecWebSocket)
 
 	// WebSocket collaboration endpoint
-	router.GET("/ws/collab/:code", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), collabHandler.HandleCollabWebSocket)
+	router.GET("/ws/collab/:code", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), middleware.RequireScope(store, models.ScopeTerminalConnect), collabHandler.HandleCollabWebSocket)
 
 	// WebSocket for Port Forwarding
-	router.GET("/ws/port-forward/:forwardId", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), portForwardHandler.HandlePortForwardWebSocket)
+	router.GET("/ws/port-forward/:forwardId", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), middleware.RequireScope(store, models.ScopeTerminalConnect), portForwardHandler.HandlePortForwardWebSocket)
 
 	// HTTP Proxy for Port Forwarding (public access via UUID path)
 	// Supports all HTTP methods for full web app proxying
@@ -928,7 +1228,7 @@ func runServer() {
 	}
 
 	// WebSocket for Admin Events (NEW)
-	router.GET("/ws/admin/events", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), middleware.AdminOnly(store), adminEventsHub.HandleWebSocket)
+	router.GET("/ws/admin/events", wsLimiter.Middleware(), middleware.AuthMiddleware(store, mfaService, jwtSecret), middleware.RequireScope(store, models.ScopeAdmin), middleware.AdminOnly(store), adminEventsHub.HandleWebSocket)
 
 	// WebSocket for Agent connections
 	router.GET("/ws/agent/:id", wsLimiter.Middleware(), agentHandler.HandleAgentWebSocket)
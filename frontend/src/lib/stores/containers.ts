@@ -1,5 +1,6 @@
 import { writable, derived, get } from "svelte/store";
 import { token } from "./auth";
+import { toast } from "./toast";
 import { createRexecWebSocket } from "../utils/ws";
 import { trackEvent } from "$lib/analytics";
 
@@ -8,6 +9,20 @@ export interface ContainerResources {
   memory_mb: number;
   cpu_shares: number;
   disk_mb: number;
+  resource_class?: string;
+}
+
+export interface ResourceClass {
+  name: string;
+  description?: string;
+  cpu_millicores: number;
+  memory_mb: number;
+  disk_mb: number;
+  pids_limit: number;
+  network_mb: number;
+  burst_cpu_millicores?: number;
+  burst_credits?: number;
+  allowed: boolean;
 }
 
 export interface PortForward {
@@ -266,7 +281,12 @@ function createContainersStore() {
       onProgress?: (event: ProgressEvent) => void,
       onComplete?: (container: Container) => void,
       onError?: (error: string) => void,
-      resources?: { memory_mb?: number; cpu_shares?: number; disk_mb?: number },
+      resources?: {
+        memory_mb?: number;
+        cpu_shares?: number;
+        disk_mb?: number;
+        resource_class?: string;
+      },
       shellOptions?: { use_tmux?: boolean },
     ) {
       const authToken = getToken();
@@ -439,7 +459,12 @@ function createContainersStore() {
       role?: string,
       onProgress?: (event: ProgressEvent) => void,
       onError?: (error: string) => void,
-      resources?: { memory_mb?: number; cpu_shares?: number; disk_mb?: number },
+      resources?: {
+        memory_mb?: number;
+        cpu_shares?: number;
+        disk_mb?: number;
+        resource_class?: string;
+      },
       shellOptions?: { use_tmux?: boolean },
       cleanup?: () => void,
     ) {
@@ -466,6 +491,9 @@ function createContainersStore() {
       if (resources?.disk_mb) {
         body.disk_mb = resources.disk_mb;
       }
+      if (resources?.resource_class) {
+        body.resource_class = resources.resource_class;
+      }
       if (shellOptions) {
         body.shell = {
           use_tmux: shellOptions.use_tmux,
@@ -1117,6 +1145,8 @@ function handleContainerEvent(event: {
 
     case "started":
     case "stopped":
+    case "paused":
+    case "unpaused":
     case "updated":
       // Container status changed - update in place without recreating array if possible
       containers.update((state) => {
@@ -1131,7 +1161,9 @@ function handleContainerEvent(event: {
         // Check if anything actually changed
         if (
           existing.status === newStatus &&
-          existing.name === (containerData.name || existing.name)
+          existing.name === (containerData.name || existing.name) &&
+          existing.id === (containerData.id || existing.id) &&
+          !containerData.resources
         ) {
           return state; // No change
         }
@@ -1142,13 +1174,28 @@ function handleContainerEvent(event: {
           ...existing,
           ...containerData,
           status: newStatus,
-          resources: containerData.resources || existing.resources,
+          resources: containerData.resources
+            ? { ...existing.resources, ...containerData.resources }
+            : existing.resources,
         };
 
         return { ...state, containers: updatedContainers };
       });
       break;
 
+    case "incident": {
+      // A terminal ran out of a resource, crashed or failed its health check
+      const affected = get(containers).containers.find((c) =>
+        matchesContainer(c, {
+          id: containerData.docker_id,
+          db_id: containerData.container_id,
+        }),
+      );
+      const name = affected?.name || "Terminal";
+      toast.warning(`${name}: ${containerData.message}`, { duration: 10000 });
+      break;
+    }
+
     case "deleted":
       // Container deleted
       containers.update((state) => ({
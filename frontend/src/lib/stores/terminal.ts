@@ -108,6 +108,34 @@ const OUTPUT_FLUSH_INTERVAL = 8; // ~120fps for smooth output
 const OUTPUT_IMMEDIATE_THRESHOLD = 256; // Immediately write small outputs
 const OUTPUT_MAX_BUFFER = 32 * 1024; // 32KB max buffer before force flush
 
+// Resume tokens let a dropped WebSocket pick up a terminal where it left off:
+// the server keeps the shell running briefly and replays the output after
+// the last offset we saw. Keyed by session or split pane ID.
+const resumeTokens = new Map<string, { token: string; offset: number }>();
+
+// Append the resume token for a session or pane to its WebSocket URL
+function withResume(wsUrl: string, id: string): string {
+  const resume = resumeTokens.get(id);
+  if (!resume) return wsUrl;
+  return `${wsUrl}&resume=${encodeURIComponent(resume.token)}&offset=${resume.offset}`;
+}
+
+// Record resume tokens and output offsets from a server message
+function trackResume(id: string, msg: { type: string; data?: string; offset?: number }) {
+  if (msg.type === "resume_token" && msg.data) {
+    resumeTokens.set(id, { token: msg.data, offset: msg.offset || 0 });
+  } else if (msg.type === "output" && msg.offset) {
+    const resume = resumeTokens.get(id);
+    if (resume) resume.offset = msg.offset;
+  }
+}
+
+// Raw (binary) output has no offset field; its position is its byte count
+function trackRawOutput(id: string, size: number) {
+  const resume = resumeTokens.get(id);
+  if (resume) resume.offset += size;
+}
+
 const REXEC_BANNER =
   "\x1b[38;5;46m\r\n" +
   "  ██████╗ ███████╗██╗  ██╗███████╗ ██████╗\r\n" +
@@ -798,7 +826,9 @@ function createTerminalStore() {
       } else {
         wsUrl = `${getWsUrl()}/ws/terminal/${encodeURIComponent(session.containerId)}?id=${encodeURIComponent(sessionId)}`;
       }
-      const ws = createRexecWebSocket(wsUrl, authToken);
+      // A resumed session replays what we missed, so it needs no redraw
+      let resuming = resumeTokens.has(sessionId);
+      const ws = createRexecWebSocket(withResume(wsUrl, sessionId), authToken);
 
       updateSession(sessionId, (s) => ({ ...s, ws, status: "connecting" }));
 
@@ -874,7 +904,9 @@ function createTerminalStore() {
             }),
           );
 
-          if (isReconnect) {
+          if (isReconnect && resuming) {
+            // Output is replayed by the server once the session is resumed
+          } else if (isReconnect) {
             // On reconnect, don't clear/reset - just send Ctrl+L to refresh the display
             // This preserves TUI apps like opencode that are running in tmux
             terminal.writeln("\r\n\x1b[32m› Reconnected\x1b[0m\r\n");
@@ -1027,13 +1059,30 @@ function createTerminalStore() {
       ws.onmessage = async (event) => {
         // Handle Blob data from WebSocket (common with agent connections)
         let eventData = event.data;
+        const rawSize = eventData instanceof Blob ? eventData.size : 0;
         if (eventData instanceof Blob) {
           eventData = await eventData.text();
         }
 
         try {
           const msg = JSON.parse(eventData);
-          if (msg.type === "output") {
+          trackResume(sessionId, msg);
+          if (msg.type === "resume_token") {
+            if (resuming) {
+              // The old session expired and this is a fresh one; refresh
+              // the display as a plain reconnect would
+              resuming = false;
+              getCurrentSession()?.terminal?.writeln(
+                "\r\n\x1b[32m› Reconnected\x1b[0m\r\n",
+              );
+              ws.send(JSON.stringify({ type: "input", data: "\x0c" }));
+            }
+            return;
+          } else if (msg.type === "resumed") {
+            resuming = false;
+            updateSession(sessionId, (s) => ({ ...s, status: "connected" }));
+            return;
+          } else if (msg.type === "output") {
             const data = msg.data as string;
 
             // Check for explicit status updates from backend script
@@ -1257,6 +1306,7 @@ function createTerminalStore() {
           }
         } catch {
           // Raw data fallback - also buffer this
+          trackRawOutput(sessionId, rawSize || new TextEncoder().encode(eventData).length);
           outputBuffer += eventData;
           if (outputBuffer.length >= OUTPUT_MAX_BUFFER) {
             if (flushTimeout) clearTimeout(flushTimeout);
@@ -1486,10 +1536,11 @@ function createTerminalStore() {
       const state = getState();
       const session = state.sessions.get(sessionId);
 
-      // Close existing WebSocket if any
+      // Close existing WebSocket if any; a manual reconnect starts afresh
       if (session?.ws) {
         session.ws.close();
       }
+      resumeTokens.delete(sessionId);
 
       updateSession(sessionId, (s) => ({
         ...s,
@@ -1624,6 +1675,7 @@ function createTerminalStore() {
 
       // Cleanup
       if (session.ws) session.ws.close();
+      resumeTokens.delete(sessionId);
       if (session.pingInterval) clearInterval(session.pingInterval);
       if (session.reconnectTimer) clearTimeout(session.reconnectTimer);
       if (session.resizeObserver) session.resizeObserver.disconnect();
@@ -2473,7 +2525,8 @@ function createTerminalStore() {
       } else {
         wsUrl = `${getWsUrl()}/ws/terminal/${encodeURIComponent(session.containerId)}?id=${encodeURIComponent(paneId)}&newSession=true`;
       }
-      const ws = createRexecWebSocket(wsUrl, authToken);
+      const resuming = resumeTokens.has(paneId);
+      const ws = createRexecWebSocket(withResume(wsUrl, paneId), authToken);
 
       ws.onopen = () => {
         // Set to connected immediately - shell setup happens in background
@@ -2500,7 +2553,9 @@ function createTerminalStore() {
         );
 
         // Show connected message in split pane
-        pane.terminal.writeln("\x1b[32m› Split session connected\x1b[0m\r\n");
+        if (!resuming) {
+          pane.terminal.writeln("\x1b[32m› Split session connected\x1b[0m\r\n");
+        }
       };
 
       // Output buffer for batching writes - optimized like main terminal
@@ -2585,12 +2640,14 @@ function createTerminalStore() {
       ws.onmessage = async (event) => {
         // Handle Blob data from WebSocket (common with agent connections)
         let eventData = event.data;
+        const rawSize = eventData instanceof Blob ? eventData.size : 0;
         if (eventData instanceof Blob) {
           eventData = await eventData.text();
         }
 
         try {
           const msg = JSON.parse(eventData);
+          trackResume(paneId, msg);
           if (msg.type === "output") {
             const data = msg.data as string;
 
@@ -2629,6 +2686,7 @@ function createTerminalStore() {
             });
           }
         } catch {
+          trackRawOutput(paneId, rawSize || new TextEncoder().encode(eventData).length);
           outputBuffer += eventData;
           if (outputBuffer.length >= OUTPUT_MAX_BUFFER) {
             if (flushTimeout) clearTimeout(flushTimeout);
@@ -2778,6 +2836,7 @@ function createTerminalStore() {
       // Cleanup pane resources
       if (pane.reconnectTimer) clearTimeout(pane.reconnectTimer);
       if (pane.ws) pane.ws.close();
+      resumeTokens.delete(paneId);
       if (pane.resizeObserver) pane.resizeObserver.disconnect();
       if (pane.webglAddon) pane.webglAddon.dispose();
       if (pane.terminal) pane.terminal.dispose();
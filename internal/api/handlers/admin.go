@@ -101,6 +101,41 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "User deleted successfully"})
 }
 
+// SetUserOrg assigns a user to an org so they can share environment templates.
+// An empty org_id removes the user from their org.
+func (h *AdminHandler) SetUserOrg(c *gin.Context) {
+	userID := c.Param("id")
+
+	var req struct {
+		OrgID string `json:"org_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if len(req.OrgID) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org_id must be at most 64 characters"})
+		return
+	}
+
+	user, err := h.store.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.store.SetUserOrgID(c.Request.Context(), userID, req.OrgID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update org"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "org_id": req.OrgID})
+}
+
 // DeleteContainer deletes a container by ID.
 func (h *AdminHandler) DeleteContainer(c *gin.Context) {
 	containerID := c.Param("id")
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -71,6 +72,7 @@ type AgentHandler struct {
 	remoteSessions   map[string]*AgentSession // Sessions connected to remote agents
 	remoteSessionsMu sync.RWMutex
 	collabHandler    *CollabHandler // For checking collab access to agent terminals
+	resumable        *resumeRegistry
 }
 
 type AgentConnection struct {
@@ -97,6 +99,10 @@ type AgentConnection struct {
 	// System info from agent
 	SystemInfo map[string]interface{} `json:"system_info,omitempty"`
 	Stats      map[string]interface{} `json:"stats,omitempty"`
+	metricsAt  time.Time              // when Stats were last recorded as a metrics sample
+	// One-shot commands waiting for their exec_result, by exec ID
+	execs   map[string]*agentExec
+	execsMu sync.Mutex
 }
 
 type AgentSession struct {
@@ -114,6 +120,12 @@ type AgentSession struct {
 	NewSession bool
 	UserConn   *websocket.Conn
 	CreatedAt  time.Time
+
+	// Output is buffered while detached from a dropped client
+	mu       sync.Mutex
+	output   *scrollback
+	resume   *resumeState
+	detached bool
 }
 
 // NewAgentHandler creates a new agent handler.
@@ -123,6 +135,7 @@ func NewAgentHandler(store *storage.PostgresStore, jwtSecret []byte) *AgentHandl
 		store:          store,
 		agents:         make(map[string]*AgentConnection),
 		remoteSessions: make(map[string]*AgentSession),
+		resumable:      newResumeRegistry(resumeWindow),
 		jwtSecret:      jwtSecret,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
@@ -376,10 +389,7 @@ func (h *AgentHandler) handleTerminalProxyMessage(msg pubsub.Message) {
 			// Backwards compatibility: "broadcast" sends to all sessions for this agent.
 			if proxyMsg.SessionID == "broadcast" || proxyMsg.SessionID == "" {
 				if proxyMsg.Type == "output" {
-					session.UserConn.WriteJSON(map[string]interface{}{
-						"type": "output",
-						"data": string(proxyMsg.Data),
-					})
+					session.sendOutput(proxyMsg.Data)
 				}
 				continue
 			}
@@ -387,10 +397,7 @@ func (h *AgentHandler) handleTerminalProxyMessage(msg pubsub.Message) {
 			// Otherwise route by agent shell session ID ("main", "split-...").
 			if session.AgentSessionID == proxyMsg.SessionID {
 				if proxyMsg.Type == "output" {
-					session.UserConn.WriteJSON(map[string]interface{}{
-						"type": "output",
-						"data": string(proxyMsg.Data),
-					})
+					session.sendOutput(proxyMsg.Data)
 				}
 			}
 		}
@@ -696,7 +703,12 @@ func (h *AgentHandler) HandleAgentWebSocket(c *gin.Context) {
 		agentID, tokenType, c.ClientIP())
 
 	// Verify token and get user
-	userID, err := h.verifyToken(token)
+	userID, err := h.verifyToken(token, models.ScopeAgentsWrite)
+	if errors.Is(err, errTokenMissingScope) {
+		log.Printf("[Agent WS] Token for agent %s is missing scope %s", agentID, models.ScopeAgentsWrite)
+		h.denyMissingScope(c, userID, models.ScopeAgentsWrite)
+		return
+	}
 	if err != nil {
 		log.Printf("[Agent WS] Token verification failed for agent %s (type=%s): %v", agentID, tokenType, err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
@@ -801,6 +813,7 @@ func (h *AgentHandler) HandleAgentWebSocket(c *gin.Context) {
 		delete(h.agents, agentID)
 		h.agentsMu.Unlock()
 		conn.Close()
+		agentConn.failExecs()
 		log.Printf("Agent disconnected: %s (%s)", agent.Name, agentID)
 
 		// Unregister agent location from Redis
@@ -879,25 +892,20 @@ func (h *AgentHandler) HandleAgentWebSocket(c *gin.Context) {
 				Data      []byte `json:"data"`
 			}
 			if err := json.Unmarshal(msg.Data, &outputData); err == nil {
-				outputMsg := map[string]interface{}{
-					"type": "output",
-					"data": string(outputData.Data),
-				}
-
 				// 1. Route output to local sessions subscribed to this agent shell session.
 				agentConn.sessionsMu.RLock()
 				matched := false
 				if outputData.SessionID == "" || outputData.SessionID == "broadcast" {
 					for _, session := range agentConn.sessions {
 						if session != nil && session.UserConn != nil {
-							session.UserConn.WriteJSON(outputMsg)
+							session.sendOutput(outputData.Data)
 						}
 					}
 					matched = true
 				} else {
 					for _, session := range agentConn.sessions {
 						if session != nil && session.UserConn != nil && session.AgentSessionID == outputData.SessionID {
-							session.UserConn.WriteJSON(outputMsg)
+							session.sendOutput(outputData.Data)
 							matched = true
 						}
 					}
@@ -907,7 +915,7 @@ func (h *AgentHandler) HandleAgentWebSocket(c *gin.Context) {
 				if !matched && outputData.SessionID != "" && !strings.HasPrefix(outputData.SessionID, "split-") {
 					for _, session := range agentConn.sessions {
 						if session != nil && session.UserConn != nil && session.AgentSessionID == "main" {
-							session.UserConn.WriteJSON(outputMsg)
+							session.sendOutput(outputData.Data)
 						}
 					}
 				}
@@ -929,15 +937,29 @@ func (h *AgentHandler) HandleAgentWebSocket(c *gin.Context) {
 			// Forward status to sessions
 			agentConn.sessionsMu.RLock()
 			for _, session := range agentConn.sessions {
-				session.UserConn.WriteJSON(msg)
+				session.send(msg)
 			}
 			agentConn.sessionsMu.RUnlock()
 
+		case "exec_output":
+			var output struct {
+				ID     string `json:"id"`
+				Stream string `json:"stream"`
+				Data   []byte `json:"data"`
+			}
+			if err := json.Unmarshal(msg.Data, &output); err == nil {
+				agentConn.execOutput(output.ID, output.Stream, output.Data)
+			}
+
 		case "exec_result":
-			// Forward to sessions
+			// Results of API execs go to their caller, others to sessions
+			var result agentExecResult
+			if err := json.Unmarshal(msg.Data, &result); err == nil && agentConn.finishExec(result) {
+				continue
+			}
 			agentConn.sessionsMu.RLock()
 			for _, session := range agentConn.sessions {
-				session.UserConn.WriteJSON(msg)
+				session.send(msg)
 			}
 			agentConn.sessionsMu.RUnlock()
 
@@ -959,10 +981,11 @@ func (h *AgentHandler) HandleAgentWebSocket(c *gin.Context) {
 			var stats map[string]interface{}
 			if err := json.Unmarshal(msg.Data, &stats); err == nil {
 				agentConn.Stats = stats
+				h.recordAgentStats(agentConn, stats)
 				// Forward stats to all connected user sessions
 				agentConn.sessionsMu.RLock()
 				for _, session := range agentConn.sessions {
-					session.UserConn.WriteJSON(map[string]interface{}{
+					session.send(map[string]interface{}{
 						"type": "stats",
 						"data": stats,
 					})
@@ -991,7 +1014,11 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 	}
 
 	// Verify token and get user
-	userID, err := h.verifyToken(token)
+	userID, err := h.verifyToken(token, models.ScopeTerminalConnect)
+	if errors.Is(err, errTokenMissingScope) {
+		h.denyMissingScope(c, userID, models.ScopeTerminalConnect)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 		return
@@ -1105,6 +1132,13 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 		return
 	}
 
+	// A client coming back after a dropped connection takes over its
+	// detached session; the original handler keeps running it
+	if token, offset := resumeRequest(c); token != "" && h.resumable.claim(token, userID, "agent:"+agentID, conn, offset) {
+		log.Printf("[Agent] Resumed session %s on agent %s from offset %d", connectionID, agentID, offset)
+		return
+	}
+
 	session := &AgentSession{
 		ID:             connectionID,
 		UserID:         userID,
@@ -1113,7 +1147,9 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 		NewSession:     newSession,
 		UserConn:       conn,
 		CreatedAt:      time.Now(),
+		output:         newScrollback(scrollbackSize),
 	}
+	session.resume = h.resumable.register(userID, "agent:"+agentID, conn, session.attach)
 
 	// === LOCAL AGENT HANDLING ===
 	if isLocal {
@@ -1123,13 +1159,15 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 		previous = agentConn.sessions[connectionID]
 		agentConn.sessions[connectionID] = session
 		agentConn.sessionsMu.Unlock()
-		if previous != nil && previous.UserConn != nil {
-			previous.UserConn.Close()
+		if previous != nil {
+			h.resumable.drop(previous.resume)
+			previous.currentConn().Close()
 		}
+		session.sendResumeToken()
 
 		// Send initial stats if available
 		if agentConn.Stats != nil {
-			conn.WriteJSON(map[string]interface{}{
+			session.send(map[string]interface{}{
 				"type": "stats",
 				"data": agentConn.Stats,
 			})
@@ -1165,6 +1203,7 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 			noLocalSessions := len(agentConn.sessions) == 0
 			noRemoteSessions := len(agentConn.remoteSessionRefs) == 0
 			agentConn.sessionsMu.Unlock()
+			h.resumable.drop(session.resume)
 			conn.Close()
 
 			// For split panes, stop the specific session when nobody is subscribed anymore.
@@ -1189,6 +1228,10 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 		for {
 			messageType, message, err := conn.ReadMessage()
 			if err != nil {
+				if h.awaitResume(session, conn, err) {
+					conn = session.currentConn()
+					continue
+				}
 				break
 			}
 
@@ -1256,6 +1299,7 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 	// === REMOTE AGENT HANDLING ===
 	if isRemote {
 		if h.pubsubHub == nil {
+			h.resumable.drop(session.resume)
 			conn.Close()
 			return
 		}
@@ -1276,9 +1320,11 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 	registered:
 		h.remoteSessions[connectionID] = session
 		h.remoteSessionsMu.Unlock()
-		if previous != nil && previous.UserConn != nil {
-			previous.UserConn.Close()
+		if previous != nil {
+			h.resumable.drop(previous.resume)
+			previous.currentConn().Close()
 		}
+		session.sendResumeToken()
 
 		if shouldStart {
 			h.pubsubHub.ProxyTerminalData(agentID, agentSessionID, "start_session", nil, 0, 0, newSession)
@@ -1299,6 +1345,7 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 			}
 			shouldStop = !hasAny
 			h.remoteSessionsMu.Unlock()
+			h.resumable.drop(session.resume)
 			conn.Close()
 
 			if shouldStop {
@@ -1310,6 +1357,10 @@ func (h *AgentHandler) HandleUserWebSocket(c *gin.Context) {
 		for {
 			messageType, message, err := conn.ReadMessage()
 			if err != nil {
+				if h.awaitResume(session, conn, err) {
+					conn = session.currentConn()
+					continue
+				}
 				break
 			}
 
@@ -1795,30 +1846,72 @@ func (h *AgentHandler) countDistinctAgentTerminalsForUser(userID string) int {
 	return len(agentIDs)
 }
 
-// verifyToken parses and validates a JWT token or API token, returning the user ID
-func (h *AgentHandler) verifyToken(tokenString string) (string, error) {
+// errTokenMissingScope is returned by verifyToken for a valid API token that
+// lacks the scope the endpoint requires.
+var errTokenMissingScope = errors.New("API token is missing required scope")
+
+// denyMissingScope rejects a WebSocket upgrade whose API token lacks scope and
+// records the attempt in the audit log.
+func (h *AgentHandler) denyMissingScope(c *gin.Context, userID, scope string) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	details := fmt.Sprintf("%s %s requires scope %q", c.Request.Method, c.FullPath(), scope)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		h.store.CreateAuditLog(ctx, &models.AuditLog{
+			ID:        uuid.New().String(),
+			UserID:    &userID,
+			Action:    "api_token_scope_denied",
+			IPAddress: ip,
+			UserAgent: userAgent,
+			Details:   details,
+			CreatedAt: time.Now(),
+		})
+	}()
+	c.JSON(http.StatusForbidden, gin.H{"error": errTokenMissingScope.Error(), "required_scope": scope})
+}
+
+// verifyToken parses and validates a JWT token or API token, returning the user ID.
+// API tokens must additionally carry the required scope.
+func (h *AgentHandler) verifyToken(tokenString, scope string) (string, error) {
 	// Check if this is an API token (starts with rexec_)
 	if strings.HasPrefix(tokenString, "rexec_") {
+		var cached struct {
+			UserID string   `json:"user_id"`
+			Scopes []string `json:"scopes"`
+		}
+
 		// Try cache first
 		cacheKey := "rexec:cache:token:" + tokenString
 		if h.pubsubHub != nil {
-			if userID, err := h.pubsubHub.GetCache(cacheKey); err == nil && userID != "" {
-				return userID, nil
+			if val, err := h.pubsubHub.GetCache(cacheKey); err == nil && val != "" {
+				_ = json.Unmarshal([]byte(val), &cached)
 			}
 		}
 
-		apiToken, err := h.store.ValidateAPIToken(context.Background(), tokenString)
-		if err != nil {
-			return "", fmt.Errorf("invalid API token: %w", err)
+		if cached.UserID == "" {
+			apiToken, err := h.store.ValidateAPIToken(context.Background(), tokenString)
+			if err != nil {
+				return "", fmt.Errorf("invalid API token: %w", err)
+			}
+			cached.UserID = apiToken.UserID
+			cached.Scopes = apiToken.Scopes
+
+			// Cache result
+			if h.pubsubHub != nil {
+				if data, err := json.Marshal(cached); err == nil {
+					// Cache for 5 minutes
+					_ = h.pubsubHub.SetCache(cacheKey, string(data), 5*time.Minute)
+				}
+			}
 		}
 
-		// Cache result
-		if h.pubsubHub != nil {
-			// Cache for 5 minutes
-			_ = h.pubsubHub.SetCache(cacheKey, apiToken.UserID, 5*time.Minute)
+		if !models.HasScope(cached.Scopes, scope) {
+			return cached.UserID, errTokenMissingScope
 		}
 
-		return apiToken.UserID, nil
+		return cached.UserID, nil
 	}
 
 	// Otherwise, treat as JWT token
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rexec/rexec/internal/container"
+)
+
+var errAgentNotConnected = errors.New("agent is not connected")
+
+// agentExecGrace is how long past its timeout a command's result may take to
+// arrive from an agent
+const agentExecGrace = 10 * time.Second
+
+// agentExecMessage is the exec message sent to agents. Argv runs as is;
+// Command runs with the agent's shell, as it always has.
+type agentExecMessage struct {
+	ID      string            `json:"id"`
+	Argv    []string          `json:"argv,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Cwd     string            `json:"cwd,omitempty"`
+	Stdin   string            `json:"stdin,omitempty"`
+	Timeout int               `json:"timeout"` // Seconds
+	User    string            `json:"user,omitempty"`
+	Stream  bool              `json:"stream,omitempty"` // Send output as exec_output messages
+}
+
+// agentExecResult is an agent's exec_result. Error is set when the command
+// couldn't be started.
+type agentExecResult struct {
+	ID         string `json:"id"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMs int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out"`
+	Truncated  bool   `json:"truncated"`
+	Error      string `json:"error"`
+}
+
+// agentExec is a command waiting for its result from an agent
+type agentExec struct {
+	streams container.ExecStreams
+	result  chan agentExecResult
+}
+
+// execOutput copies streamed output to the command it belongs to
+func (a *AgentConnection) execOutput(id, stream string, data []byte) {
+	a.execsMu.Lock()
+	defer a.execsMu.Unlock()
+	pending := a.execs[id]
+	if pending == nil {
+		return
+	}
+	switch {
+	case stream == "stdout" && pending.streams.Stdout != nil:
+		pending.streams.Stdout.Write(data)
+	case stream == "stderr" && pending.streams.Stderr != nil:
+		pending.streams.Stderr.Write(data)
+	}
+}
+
+// finishExec delivers a result to its command, reporting whether one was
+// waiting for it
+func (a *AgentConnection) finishExec(result agentExecResult) bool {
+	if result.ID == "" {
+		return false
+	}
+	a.execsMu.Lock()
+	defer a.execsMu.Unlock()
+	pending := a.execs[result.ID]
+	if pending == nil {
+		return false
+	}
+	delete(a.execs, result.ID)
+	pending.result <- result
+	return true
+}
+
+// failExecs ends every waiting command when the agent disconnects
+func (a *AgentConnection) failExecs() {
+	a.execsMu.Lock()
+	defer a.execsMu.Unlock()
+	for id, pending := range a.execs {
+		pending.result <- agentExecResult{ID: id, Error: "agent disconnected"}
+		delete(a.execs, id)
+	}
+}
+
+// Exec runs a one-shot command on an agent connected to this server. With
+// stdout or stderr writers the agent streams output to them; without, it
+// comes back in the result. Agents get stdin in one piece, so a stdin reader
+// is read to the end first.
+func (h *AgentHandler) Exec(ctx context.Context, agentID string, req container.ExecRequest, streams container.ExecStreams) (*container.ExecResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	h.agentsMu.RLock()
+	agentConn := h.agents[agentID]
+	h.agentsMu.RUnlock()
+	if agentConn == nil {
+		return nil, errAgentNotConnected
+	}
+
+	if streams.Stdin != nil {
+		stdin, err := io.ReadAll(io.LimitReader(streams.Stdin, container.MaxExecStdinBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		if len(stdin) > container.MaxExecStdinBytes {
+			return nil, fmt.Errorf("stdin must be at most %d bytes", container.MaxExecStdinBytes)
+		}
+		req.Stdin = string(stdin)
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	timeout := req.TimeoutDuration()
+	msg := agentExecMessage{
+		ID:      id,
+		Argv:    req.Command,
+		Command: req.Script,
+		Env:     req.Env,
+		Cwd:     req.Cwd,
+		Stdin:   req.Stdin,
+		Timeout: int(timeout.Seconds()),
+		User:    req.User,
+		Stream:  streams.Stdout != nil || streams.Stderr != nil,
+	}
+
+	pending := &agentExec{streams: streams, result: make(chan agentExecResult, 1)}
+	agentConn.execsMu.Lock()
+	if agentConn.execs == nil {
+		agentConn.execs = make(map[string]*agentExec)
+	}
+	agentConn.execs[id] = pending
+	agentConn.execsMu.Unlock()
+	// Once Exec returns, late output has nowhere to go
+	defer func() {
+		agentConn.execsMu.Lock()
+		delete(agentConn.execs, id)
+		agentConn.execsMu.Unlock()
+	}()
+
+	if err := agentConn.conn.WriteJSON(map[string]interface{}{"type": "exec", "data": msg}); err != nil {
+		return nil, errAgentNotConnected
+	}
+
+	timer := time.NewTimer(timeout + agentExecGrace)
+	defer timer.Stop()
+	select {
+	case result := <-pending.result:
+		if result.Error != "" {
+			return nil, errors.New(result.Error)
+		}
+		return &container.ExecResult{
+			ExitCode:   result.ExitCode,
+			Stdout:     result.Stdout,
+			Stderr:     result.Stderr,
+			DurationMs: result.DurationMs,
+			TimedOut:   result.TimedOut,
+			Truncated:  result.Truncated,
+		}, nil
+	case <-ctx.Done():
+		agentConn.conn.WriteJSON(map[string]interface{}{"type": "exec_cancel", "data": map[string]string{"id": id}})
+		return nil, fmt.Errorf("exec cancelled: %w", ctx.Err())
+	case <-timer.C:
+		// Agents from before API execs never answer with the exec's ID
+		return nil, errors.New("agent did not report the command's result; it may need updating")
+	}
+}
@@ -74,6 +74,9 @@ type ContainerHandler struct {
 	eventsHub      *ContainerEventsHub
 	adminEventsHub *admin_events.AdminEventsHub
 	agentHandler   *AgentHandler // Reference to get online agents
+	warmPool       *container.WarmPool
+	burst          *container.BurstService
+	services       *container.ServiceSupervisor
 }
 
 // NewContainerHandler creates a new container handler
@@ -85,6 +88,27 @@ func NewContainerHandler(manager *container.Manager, store *storage.PostgresStor
 	}
 }
 
+// SetWarmPool lets creates claim pre-warmed containers
+func (h *ContainerHandler) SetWarmPool(pool *container.WarmPool) {
+	h.warmPool = pool
+}
+
+// SetBurstService lets Get report terminals' CPU burst credits
+func (h *ContainerHandler) SetBurstService(burst *container.BurstService) {
+	h.burst = burst
+}
+
+// claimFromPool claims a pre-warmed container for cfg. Pool members have had
+// the default shell setup and their role installed, so requests with custom
+// shell settings or a template always get a fresh container. So do requests
+// with shared volumes, which can only be mounted at creation.
+func (h *ContainerHandler) claimFromPool(ctx context.Context, cfg container.ContainerConfig, shellCfg container.ShellSetupConfig, tmpl *models.EnvTemplate) (*container.ContainerInfo, bool) {
+	if h.warmPool == nil || tmpl != nil || shellCfg != container.DefaultShellSetupConfig() || len(cfg.Volumes) > 0 {
+		return nil, false
+	}
+	return h.warmPool.Claim(ctx, cfg)
+}
+
 // SetEventsHub sets the events hub for real-time notifications
 func (h *ContainerHandler) SetEventsHub(hub *ContainerEventsHub) {
 	h.eventsHub = hub
@@ -382,8 +406,53 @@ func (h *ContainerHandler) Create(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
+	// Environment template: fills in whatever the request leaves unset
+	tmpl, err := h.resolveTemplate(ctx, userID, &req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == errTemplateNotFound {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Restoring a snapshot: its committed image replaces the requested one
+	var snapshot *storage.SnapshotRecord
+	if req.SnapshotID != "" {
+		snap, err := h.store.GetSnapshotByID(ctx, req.SnapshotID)
+		if err != nil || snap == nil || snap.UserID != userID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
+			return
+		}
+		if snap.Status != "ready" {
+			c.JSON(http.StatusConflict, gin.H{"error": "snapshot is not ready", "status": snap.Status})
+			return
+		}
+		snapshot = snap
+		if req.Role == "" {
+			req.Role = snap.Role
+		}
+	}
+
+	if err := h.resolveRole(ctx, userID, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role: " + req.Role})
+		return
+	}
+
 	// Handle custom image validation
-	if req.Image == "custom" {
+	if snapshot != nil {
+		req.Image = "custom"
+		req.CustomImage = snapshot.ImageTag
+	} else if buildName, ok := models.BuildImageName(req.Image); ok {
+		tag, status, err := h.resolveBuildImage(ctx, userID, buildName)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		req.Image = "custom"
+		req.CustomImage = tag
+	} else if req.Image == "custom" {
 		if req.CustomImage == "" {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "custom_image is required when image is 'custom'",
@@ -452,42 +521,30 @@ func (h *ContainerHandler) Create(c *gin.Context) {
 		}
 	}
 
+	volumeMounts, status, err := h.resolveVolumeMounts(ctx, userID, req.Volumes, nil)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	var class *models.ResourceClass
+	if req.ResourceClass != "" {
+		class, status, err = lookupResourceClass(ctx, h.store, req.ResourceClass, tier, subscriptionActive)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Determine the image name for storage
 	imageName := req.Image
 	if req.Image == "custom" {
 		imageName = "custom:" + req.CustomImage
 	}
 
-	// Calculate resource limits first (with trial customization)
-	// We pass subscription status to determine if we should allow full customization or restrict
-	// Currently ValidateTrialResources uses tier. We rely on tier logic.
-	// If subscription is active, tier logic for "free" might need to change or be handled via limits directly?
-	// Actually ValidateTrialResources uses TierLimits internally.
-	// But TierLimits relies on tier string.
-	// We might need to handle this discrepancy.
-	// However, let's assume ValidateTrialResources works based on the tier string passed.
-	limits := models.ValidateTrialResources(&req, tier)
-
-	// Override limits if we have specific subscription logic not covered by tier string
-	userLimits := models.GetUserResourceLimits(tier, subscriptionActive)
-	// Apply these limits if they are stricter or different from defaults
-	// Actually, CreateContainerRequest has customization.
-	// If the user has active subscription, they get Pro limits (4GB/4CPU).
-	// If not, they get Free limits (2GB/2CPU).
-	// ValidateTrialResources clamps based on GetTrialResourceLimits (4GB/4CPU/16GB).
-	// This might be too generous for non-subscribers who should be capped at 2GB.
-
-	if !subscriptionActive && (tier == "free" || tier == "trial") {
-		// Enforce stricter limits for non-subscribers
-		if limits.MemoryMB > userLimits.MemoryMB {
-			limits.MemoryMB = userLimits.MemoryMB
-		}
-		if limits.CPUShares > userLimits.CPUShares {
-			limits.CPUShares = userLimits.CPUShares
-		}
-		if limits.DiskMB > userLimits.DiskMB {
-			limits.DiskMB = userLimits.DiskMB
-		}
+	limits := resourceLimits(&req, tier, subscriptionActive)
+	if class != nil {
+		limits = class.Limits()
 	}
 
 	// Store a pending record in database first (async creation)
@@ -511,6 +568,16 @@ func (h *ContainerHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create container record: " + err.Error()})
 		return
 	}
+	if err := h.recordVolumeAttachments(ctx, record.ID, volumeMounts); err != nil {
+		h.store.DeleteContainer(ctx, record.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to attach volumes"})
+		return
+	}
+	if class != nil {
+		if err := h.store.UpdateContainerResourceClass(ctx, record.ID, class.Name); err != nil {
+			log.Printf("[Container] Failed to record resource class for %s: %v", record.ID, err)
+		}
+	}
 
 	// Broadcast container created event to admin hub
 	if h.adminEventsHub != nil {
@@ -537,27 +604,28 @@ func (h *ContainerHandler) Create(c *gin.Context) {
 		},
 	}
 
-	// Mark guest containers with special label for cleanup
-	if isGuest || tier == "guest" {
-		cfg.Labels["rexec.tier"] = "guest"
-		cfg.Labels["rexec.guest"] = "true"
-		// Use token expiration if available (more accurate), otherwise calculate from now
-		if tokenExp, exists := c.Get("tokenExp"); exists {
-			expiresAt := time.Unix(tokenExp.(int64), 0)
-			cfg.Labels["rexec.expires_at"] = expiresAt.Format(time.RFC3339)
-		} else {
-			cfg.Labels["rexec.expires_at"] = time.Now().Add(GuestMaxContainerDuration).Format(time.RFC3339)
-		}
-	} else if (tier == "free" || tier == "trial") && !subscriptionActive {
-		// Enforce 50-hour session limit for free users without active subscription
-		expiresAt := time.Now().Add(models.AuthenticatedSessionDuration)
-		cfg.Labels["rexec.expires_at"] = expiresAt.Format(time.RFC3339)
+	applySessionLabels(c, cfg.Labels, tier, isGuest, subscriptionActive)
+
+	if snapshot != nil {
+		cfg.SnapshotArchive = snapshot.ArchivePath
+		cfg.Labels["rexec.snapshot_id"] = snapshot.ID
+	}
+	cfg.Volumes = toVolumeMounts(volumeMounts)
+
+	if tmpl != nil {
+		cfg.Env = container.TemplateEnv(tmpl)
+		cfg.Labels["rexec.template"] = tmpl.Name
 	}
 
 	// Apply resource limits to container config (use validated request values)
 	cfg.MemoryLimit = limits.MemoryMB * 1024 * 1024 // Convert MB to bytes
 	cfg.CPULimit = limits.CPUShares                 // Already in millicores (500 = 0.5 CPU)
 	cfg.DiskQuota = limits.DiskMB * 1024 * 1024     // Convert MB to bytes
+	cfg.NetworkMB = models.GetUserResourceLimits(cfg.Labels["rexec.tier"], subscriptionActive).NetworkMB
+	if class != nil {
+		cfg.NetworkMB = class.NetworkMB
+		cfg.ResourceClass = class
+	}
 
 	// Determine shell configuration - use request or defaults based on role
 	shellCfg := container.DefaultShellSetupConfig()
@@ -599,9 +667,18 @@ func (h *ContainerHandler) Create(c *gin.Context) {
 	go func() {
 		createContainerSem <- struct{}{}
 		defer func() { <-createContainerSem }()
-		h.createContainerAsync(record.ID, cfg, req.Image, req.CustomImage, req.Role, shellCfg, isGuest || tier == "guest")
+		h.createContainerAsync(record.ID, cfg, req.Image, req.CustomImage, req.Role, shellCfg, tmpl, isGuest || tier == "guest")
 	}()
 
+	resources := gin.H{
+		"memory_mb":  limits.MemoryMB,
+		"cpu_shares": limits.CPUShares,
+		"disk_mb":    limits.DiskMB,
+	}
+	if class != nil {
+		resources["resource_class"] = class.Name
+	}
+
 	// Return immediately with "creating" status
 	response := gin.H{
 		"id":         record.ID, // Use DB ID as the primary ID until Docker ID is available
@@ -614,11 +691,14 @@ func (h *ContainerHandler) Create(c *gin.Context) {
 		"created_at": record.CreatedAt,
 		"async":      true,
 		"message":    "Container is being created. This may take a moment if the image needs to be pulled.",
-		"resources": gin.H{
-			"memory_mb":  limits.MemoryMB,
-			"cpu_shares": limits.CPUShares,
-			"disk_mb":    limits.DiskMB,
-		},
+		"resources":  resources,
+	}
+
+	if tmpl != nil {
+		response["template"] = tmpl.Name
+	}
+	if len(volumeMounts) > 0 {
+		response["volumes"] = volumeMounts
 	}
 
 	// Add guest session info
@@ -644,7 +724,7 @@ func (h *ContainerHandler) Create(c *gin.Context) {
 }
 
 // createContainerAsync handles the actual container creation in the background
-func (h *ContainerHandler) createContainerAsync(recordID string, cfg container.ContainerConfig, imageType string, customImage string, role string, shellCfg container.ShellSetupConfig, isGuest bool) {
+func (h *ContainerHandler) createContainerAsync(recordID string, cfg container.ContainerConfig, imageType string, customImage string, role string, shellCfg container.ShellSetupConfig, tmpl *models.EnvTemplate, isGuest bool) {
 	ctx := context.Background()
 	userID := cfg.UserID
 
@@ -660,69 +740,78 @@ func (h *ContainerHandler) createContainerAsync(recordID string, cfg container.C
 		}
 	}
 
-	// Send pulling progress
-	sendProgress("pulling", "Pulling image...", 15)
-
-	// Pull image if needed
-	var pullErr error
-	if imageType == "custom" {
-		pullErr = h.manager.PullCustomImage(ctx, customImage)
+	// Claim a pre-warmed container if the pool has one; otherwise pull and create
+	info, fromPool := h.claimFromPool(ctx, cfg, shellCfg, tmpl)
+	if fromPool {
+		sendProgress("creating", "Claimed a pre-warmed terminal", 35)
+		// The pool member keeps its own home volume
+		h.store.UpdateContainerVolumeName(ctx, recordID, info.VolumeName)
 	} else {
-		pullErr = h.manager.PullImage(ctx, imageType)
-	}
+		// Send pulling progress
+		sendProgress("pulling", "Pulling image...", 15)
 
-	if pullErr != nil {
-		// Sanitize error to hide Docker host details from users
-		sanitizedErr := container.SanitizeError(pullErr)
-		// Update record with error status (store full error for debugging)
-		h.store.UpdateContainerStatus(ctx, recordID, "error")
-		h.store.UpdateContainerError(ctx, recordID, "failed to pull image: "+pullErr.Error())
-		// Notify via WebSocket with sanitized error
-		if h.eventsHub != nil {
-			h.eventsHub.NotifyContainerProgress(userID, gin.H{
-				"id":       recordID,
-				"stage":    "error",
-				"message":  "Failed to pull image",
-				"progress": 0,
-				"error":    sanitizedErr,
-				"complete": true,
-			})
-			h.eventsHub.NotifyContainerUpdated(userID, gin.H{
-				"id":     recordID,
-				"status": "error",
-				"error":  sanitizedErr,
-			})
+		// Pull image if needed
+		var pullErr error
+		if imageType == "custom" {
+			pullErr = h.manager.PullCustomImage(ctx, userID, customImage)
+		} else {
+			pullErr = h.manager.PullImage(ctx, imageType)
 		}
-		return
-	}
 
-	// Send creating progress
-	sendProgress("creating", "Creating container...", 35)
+		if pullErr != nil {
+			// Sanitize error to hide Docker host details from users
+			sanitizedErr := container.SanitizeError(pullErr)
+			// Update record with error status (store full error for debugging)
+			h.store.UpdateContainerStatus(ctx, recordID, "error")
+			h.store.UpdateContainerError(ctx, recordID, "failed to pull image: "+pullErr.Error())
+			// Notify via WebSocket with sanitized error
+			if h.eventsHub != nil {
+				h.eventsHub.NotifyContainerProgress(userID, gin.H{
+					"id":       recordID,
+					"stage":    "error",
+					"message":  "Failed to pull image",
+					"progress": 0,
+					"error":    sanitizedErr,
+					"complete": true,
+				})
+				h.eventsHub.NotifyContainerUpdated(userID, gin.H{
+					"id":     recordID,
+					"status": "error",
+					"error":  sanitizedErr,
+				})
+			}
+			return
+		}
 
-	// Create the container
-	info, err := h.manager.CreateContainer(ctx, cfg)
-	if err != nil {
-		// Sanitize error to hide Docker host details from users
-		sanitizedErr := container.SanitizeError(err)
-		h.store.UpdateContainerStatus(ctx, recordID, "error")
-		h.store.UpdateContainerError(ctx, recordID, "failed to create container: "+err.Error())
-		// Notify via WebSocket with sanitized error
-		if h.eventsHub != nil {
-			h.eventsHub.NotifyContainerProgress(userID, gin.H{
-				"id":       recordID,
-				"stage":    "error",
-				"message":  "Failed to create container",
-				"progress": 0,
-				"error":    sanitizedErr,
-				"complete": true,
-			})
-			h.eventsHub.NotifyContainerUpdated(userID, gin.H{
-				"id":     recordID,
-				"status": "error",
-				"error":  sanitizedErr,
-			})
+		// Send creating progress
+		sendProgress("creating", "Creating container...", 35)
+
+		// Create the container
+		var err error
+		info, err = h.manager.CreateContainer(ctx, cfg)
+		if err != nil {
+			// Sanitize error to hide Docker host details from users
+			sanitizedErr := container.SanitizeError(err)
+			h.store.UpdateContainerStatus(ctx, recordID, "error")
+			h.store.UpdateContainerError(ctx, recordID, "failed to create container: "+err.Error())
+			// Notify via WebSocket with sanitized error
+			if h.eventsHub != nil {
+				h.eventsHub.NotifyContainerProgress(userID, gin.H{
+					"id":       recordID,
+					"stage":    "error",
+					"message":  "Failed to create container",
+					"progress": 0,
+					"error":    sanitizedErr,
+					"complete": true,
+				})
+				h.eventsHub.NotifyContainerUpdated(userID, gin.H{
+					"id":     recordID,
+					"status": "error",
+					"error":  sanitizedErr,
+				})
+			}
+			return
 		}
-		return
 	}
 
 	// IMMEDIATELY send container_id to frontend so terminal can connect while we do DB updates
@@ -838,14 +927,18 @@ func (h *ContainerHandler) createContainerAsync(recordID string, cfg container.C
 		})
 	}
 
+	// Forks are snapshots too, taken just before they're created
+	fromSnapshot := cfg.Labels["rexec.snapshot_id"] != "" || cfg.Labels[container.ForkedFromLabel] != ""
+
 	// Run shell setup, role setup, and metadata caching asynchronously
 	// This dramatically improves perceived startup latency
 	go func(containerID, dbID, userID string, shellCfg container.ShellSetupConfig, role, imageType string) {
 		bgCtx := context.Background()
 
-		// "barebone" role: skip ALL setup for fastest possible startup
-		if role == "barebone" {
-			log.Printf("[Container] Barebone role: skipping all setup for %s", containerID[:12])
+		// "barebone" role: skip ALL setup for fastest possible startup, unless a
+		// template asks for packages. Snapshots, forks and pool members already carry their setup.
+		if (role == "barebone" && tmpl == nil) || fromSnapshot || fromPool {
+			log.Printf("[Container] Skipping setup for %s (role=%s, snapshot=%v, pool=%v)", containerID[:12], role, fromSnapshot, fromPool)
 			// Just detect shell and update status
 			cacheCtx, cacheCancel := context.WithTimeout(bgCtx, 10*time.Second)
 			shellPath, hasTmux := container.DetectShellAndTmux(cacheCtx, h.manager.GetClient(), containerID)
@@ -888,7 +981,7 @@ func (h *ContainerHandler) createContainerAsync(recordID string, cfg container.C
 		if role != "" {
 			log.Printf("[Container] Starting async role setup for %s (%s)", containerID[:12], role)
 			roleCtx, roleCancel := context.WithTimeout(bgCtx, 5*time.Minute)
-			roleResult, roleErr := container.SetupRole(roleCtx, h.manager.GetClient(), containerID, role)
+			roleResult, roleErr := h.setupRole(roleCtx, containerID, role, nil)
 			roleCancel()
 
 			if roleErr != nil {
@@ -900,6 +993,23 @@ func (h *ContainerHandler) createContainerAsync(recordID string, cfg container.C
 			}
 		}
 
+		// 2b. Apply the environment template: packages, dotfiles, startup commands, ports
+		if tmpl != nil {
+			log.Printf("[Container] Starting async template setup for %s (%s)", containerID[:12], tmpl.Name)
+			tmplCtx, tmplCancel := context.WithTimeout(bgCtx, 2*container.RoleSetupTimeout)
+			tmplResult, tmplErr := container.SetupTemplate(tmplCtx, h.manager.GetClient(), containerID, tmpl)
+			tmplCancel()
+
+			if tmplErr != nil {
+				log.Printf("[Container] Async template setup error for %s (%s): %v", containerID[:12], tmpl.Name, tmplErr)
+			} else if !tmplResult.Success {
+				log.Printf("[Container] Async template setup incomplete for %s (%s): %s", containerID[:12], tmpl.Name, tmplResult.Message)
+			} else {
+				log.Printf("[Container] Async template setup complete for %s (%s)", containerID[:12], tmpl.Name)
+			}
+			h.openTemplatePorts(bgCtx, userID, dbID, tmpl)
+		}
+
 		// 3. Detect and cache shell/tmux metadata (after setup so we detect new shell/tmux)
 		cacheCtx, cacheCancel := context.WithTimeout(bgCtx, 30*time.Second)
 		defer cacheCancel()
@@ -1002,6 +1112,23 @@ func (h *ContainerHandler) Get(c *gin.Context) {
 		diskMB = limits.DiskMB
 	}
 
+	schedule, err := h.store.GetContainerSchedule(ctx, found.ID)
+	if err != nil {
+		log.Printf("[Container] Failed to load schedule for %s: %v", found.ID, err)
+	}
+	volumes, err := h.store.GetContainerVolumeMounts(ctx, found.ID)
+	if err != nil {
+		log.Printf("[Container] Failed to load volumes for %s: %v", found.ID, err)
+	}
+	resources := gin.H{
+		"memory_mb":  memoryMB,
+		"cpu_shares": cpuShares,
+		"disk_mb":    diskMB,
+	}
+	if class, err := h.store.GetContainerResourceClass(ctx, found.ID); err == nil && class != "" {
+		resources["resource_class"] = class
+	}
+
 	// If Docker ID is empty, container is still being created
 	if found.DockerID == "" {
 		c.JSON(http.StatusOK, gin.H{
@@ -1014,11 +1141,9 @@ func (h *ContainerHandler) Get(c *gin.Context) {
 			"created_at":   found.CreatedAt,
 			"last_used_at": found.LastUsedAt,
 			"mfa_locked":   found.MFALocked,
-			"resources": gin.H{
-				"memory_mb":  memoryMB,
-				"cpu_shares": cpuShares,
-				"disk_mb":    diskMB,
-			},
+			"schedule":     schedule,
+			"volumes":      volumes,
+			"resources":    resources,
 		})
 		return
 	}
@@ -1036,16 +1161,14 @@ func (h *ContainerHandler) Get(c *gin.Context) {
 			"created_at":   found.CreatedAt,
 			"last_used_at": found.LastUsedAt,
 			"mfa_locked":   found.MFALocked,
-			"resources": gin.H{
-				"memory_mb":  memoryMB,
-				"cpu_shares": cpuShares,
-				"disk_mb":    diskMB,
-			},
+			"schedule":     schedule,
+			"volumes":      volumes,
+			"resources":    resources,
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"id":           info.ID,
 		"db_id":        found.ID,
 		"user_id":      info.UserID,
@@ -1057,12 +1180,17 @@ func (h *ContainerHandler) Get(c *gin.Context) {
 		"ip_address":   info.IPAddress,
 		"idle_seconds": time.Since(info.LastUsedAt).Seconds(),
 		"mfa_locked":   found.MFALocked,
-		"resources": gin.H{
-			"memory_mb":  memoryMB,
-			"cpu_shares": cpuShares,
-			"disk_mb":    diskMB,
-		},
-	})
+		"schedule":     schedule,
+		"volumes":      volumes,
+		"resources":    resources,
+	}
+	if burst, ok := h.burst.Status(info.ID); ok {
+		response["burst"] = burst
+	}
+	if policy, err := h.store.GetContainerIncidentPolicy(ctx, found.ID); err == nil && policy != nil {
+		response["incident_policy"] = policy
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // Delete soft-deletes a container (stops it but doesn't remove)
@@ -1165,6 +1293,11 @@ func (h *ContainerHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	// A fork's image is only used by the fork
+	if err := h.manager.ReleaseForkImage(ctx, h.store, found.Image); err != nil {
+		log.Printf("Warning: failed to remove fork image of %s: %v", found.ID, err)
+	}
+
 	// Notify AdminEventsHub that container was deleted
 	if h.adminEventsHub != nil {
 		// Send the found record (before it's fully gone) as payload
@@ -1255,6 +1388,9 @@ func (h *ContainerHandler) Start(c *gin.Context) {
 			MemoryMB:      int64(found.MemoryMB),
 			CPUMillicores: int64(found.CPUShares),
 			DiskMB:        int64(found.DiskMB),
+			VolumeName:    found.VolumeName,
+			Volumes:       h.containerVolumeMounts(ctx, found.ID),
+			Class:         containerResourceClass(ctx, h.store, found.ID),
 			// UseTmux will be nil here since container doesn't exist in Docker
 			// It will use the default (no tmux) unless explicitly set
 		}
@@ -1450,10 +1586,17 @@ func (h *ContainerHandler) UpdateSettings(c *gin.Context) {
 	}
 
 	var req struct {
-		Name      string `json:"name"`
-		MemoryMB  int64  `json:"memory_mb"`
-		CPUShares int64  `json:"cpu_shares"`
-		DiskMB    int64  `json:"disk_mb"`
+		Name      string               `json:"name"`
+		MemoryMB  int64                `json:"memory_mb"`
+		CPUShares int64                `json:"cpu_shares"`
+		DiskMB    int64                `json:"disk_mb"`
+		Schedule  *scheduleRequest     `json:"schedule"`
+		Egress    *models.EgressPolicy `json:"egress"`
+		// IncidentPolicy replaces what happens when the terminal crashes or
+		// runs out of memory; an empty policy turns automatic actions off
+		IncidentPolicy *models.IncidentPolicy `json:"incident_policy"`
+		// ResourceClass resizes the terminal to a class instead of the values above
+		ResourceClass string `json:"resource_class"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -1463,43 +1606,72 @@ func (h *ContainerHandler) UpdateSettings(c *gin.Context) {
 	log.Printf("[UpdateSettings] Received request: name=%s, memory_mb=%d, cpu_shares=%d, disk_mb=%d",
 		req.Name, req.MemoryMB, req.CPUShares, req.DiskMB)
 
+	var schedule *models.ContainerSchedule
+	if req.Schedule != nil {
+		var err error
+		if schedule, err = req.Schedule.resolve(time.Now()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule: " + err.Error()})
+			return
+		}
+	}
+	if req.Egress != nil {
+		if err := req.Egress.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid egress policy: " + err.Error()})
+			return
+		}
+	}
+	// A request with only a schedule, egress or incident policy leaves the name and resources alone
+	policyOnly := (req.Schedule != nil || req.Egress != nil || req.IncidentPolicy != nil) && req.Name == "" && req.MemoryMB == 0 && req.CPUShares == 0 && req.DiskMB == 0 && req.ResourceClass == ""
+
 	// Validate name
-	if req.Name == "" {
+	if req.Name == "" && !policyOnly {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
 		return
 	}
 
-	// Get user resource limits based on tier and subscription
-	limits := models.GetUserResourceLimits(tier, subscriptionActive)
+	ctx := c.Request.Context()
 
-	// Enforce max limits
-	if req.MemoryMB > limits.MemoryMB {
-		req.MemoryMB = limits.MemoryMB
-	}
-	if req.CPUShares > limits.CPUShares {
-		req.CPUShares = limits.CPUShares
-	}
-	if req.DiskMB > limits.DiskMB {
-		req.DiskMB = limits.DiskMB
-	}
+	var class *models.ResourceClass
+	if req.ResourceClass != "" && !policyOnly {
+		var status int
+		var err error
+		class, status, err = lookupResourceClass(ctx, h.store, req.ResourceClass, tier, subscriptionActive)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		req.MemoryMB, req.CPUShares, req.DiskMB = class.MemoryMB, class.CPUMillicores, class.DiskMB
+	} else {
+		// Get user resource limits based on tier and subscription
+		limits := models.GetUserResourceLimits(tier, subscriptionActive)
 
-	// Enforce minimum values
-	trialLimits := models.GetTrialResourceLimits()
-	if req.MemoryMB < trialLimits.MinMemoryMB {
-		req.MemoryMB = trialLimits.MinMemoryMB
-	}
-	if req.CPUShares < trialLimits.MinCPUShares {
-		req.CPUShares = trialLimits.MinCPUShares
-	}
-	if req.DiskMB < trialLimits.MinDiskMB {
-		req.DiskMB = trialLimits.MinDiskMB
+		// Enforce max limits
+		if req.MemoryMB > limits.MemoryMB {
+			req.MemoryMB = limits.MemoryMB
+		}
+		if req.CPUShares > limits.CPUShares {
+			req.CPUShares = limits.CPUShares
+		}
+		if req.DiskMB > limits.DiskMB {
+			req.DiskMB = limits.DiskMB
+		}
+
+		// Enforce minimum values
+		trialLimits := models.GetTrialResourceLimits()
+		if req.MemoryMB < trialLimits.MinMemoryMB {
+			req.MemoryMB = trialLimits.MinMemoryMB
+		}
+		if req.CPUShares < trialLimits.MinCPUShares {
+			req.CPUShares = trialLimits.MinCPUShares
+		}
+		if req.DiskMB < trialLimits.MinDiskMB {
+			req.DiskMB = trialLimits.MinDiskMB
+		}
 	}
 
 	log.Printf("[UpdateSettings] After validation: memory_mb=%d, cpu_shares=%d, disk_mb=%d",
 		req.MemoryMB, req.CPUShares, req.DiskMB)
 
-	ctx := c.Request.Context()
-
 	// Find container by ID (could be docker_id or db_id)
 	containers, err := h.store.GetContainersByUserID(ctx, userID)
 	if err != nil {
@@ -1520,6 +1692,53 @@ func (h *ContainerHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	if schedule != nil {
+		if err := h.store.UpdateContainerSchedule(ctx, found.ID, schedule); err != nil {
+			log.Printf("[UpdateSettings] Failed to update schedule for container %s: %v", found.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update schedule"})
+			return
+		}
+	}
+	if req.Egress != nil {
+		if !h.updateEgressPolicy(c, found, req.Egress) {
+			return
+		}
+	}
+	if req.IncidentPolicy != nil {
+		if err := h.store.UpdateContainerIncidentPolicy(ctx, found.ID, req.IncidentPolicy); err != nil {
+			log.Printf("[UpdateSettings] Failed to update incident policy for container %s: %v", found.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update incident policy"})
+			return
+		}
+	}
+	if class == nil && !policyOnly {
+		// Keep the class when only the name changed; other sizes make the terminal custom
+		if current := containerResourceClass(ctx, h.store, found.ID); current != nil &&
+			current.MemoryMB == req.MemoryMB && current.CPUMillicores == req.CPUShares && current.DiskMB == req.DiskMB {
+			class = current
+		}
+	}
+	if policyOnly {
+		if schedule.IsEmpty() {
+			schedule = nil
+		}
+		incidentPolicy, _ := h.store.GetContainerIncidentPolicy(ctx, found.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "settings updated",
+			"restarted": false,
+			"container": gin.H{
+				"id":              found.DockerID,
+				"db_id":           found.ID,
+				"name":            found.Name,
+				"status":          found.Status,
+				"schedule":        schedule,
+				"egress":          h.manager.EgressPolicy(found.DockerID),
+				"incident_policy": incidentPolicy,
+			},
+		})
+		return
+	}
+
 	// Track if container was restarted (for frontend auto-reconnect)
 	containerRestarted := false
 	newDockerID := found.DockerID
@@ -1565,7 +1784,10 @@ func (h *ContainerHandler) UpdateSettings(c *gin.Context) {
 			MemoryMB:      req.MemoryMB,
 			CPUMillicores: req.CPUShares,
 			DiskMB:        req.DiskMB,
+			VolumeName:    found.VolumeName,
 			UseTmux:       useTmux, // Preserve tmux preference from old container labels
+			Volumes:       h.containerVolumeMounts(ctx, found.ID),
+			Class:         class,
 		}
 
 		newInfo, err := h.manager.RecreateContainer(ctx, recreateCfg)
@@ -1601,7 +1823,7 @@ func (h *ContainerHandler) UpdateSettings(c *gin.Context) {
 				container.SetupEnhancedShell(setupCtx, h.manager.GetClient(), newDockerID)
 
 				// Install tools
-				container.SetupRole(setupCtx, h.manager.GetClient(), newDockerID, containerRole)
+				h.setupRole(setupCtx, newDockerID, containerRole, nil)
 
 				// Now set to running
 				h.manager.UpdateContainerStatus(newDockerID, "running")
@@ -1643,6 +1865,14 @@ func (h *ContainerHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	className := ""
+	if class != nil {
+		className = class.Name
+	}
+	if err := h.store.UpdateContainerResourceClass(ctx, found.ID, className); err != nil {
+		log.Printf("[UpdateSettings] Failed to update resource class for container %s: %v", found.ID, err)
+	}
+
 	log.Printf("[UpdateSettings] Successfully updated container %s settings in database", found.ID)
 
 	// Notify AdminEventsHub that container was updated
@@ -1667,9 +1897,10 @@ func (h *ContainerHandler) UpdateSettings(c *gin.Context) {
 			"restarted": containerRestarted,
 			"role":      found.Role,
 			"resources": gin.H{
-				"memory_mb":  req.MemoryMB,
-				"cpu_shares": req.CPUShares,
-				"disk_mb":    req.DiskMB,
+				"memory_mb":      req.MemoryMB,
+				"cpu_shares":     req.CPUShares,
+				"disk_mb":        req.DiskMB,
+				"resource_class": className,
 			},
 		})
 	}
@@ -1685,9 +1916,10 @@ func (h *ContainerHandler) UpdateSettings(c *gin.Context) {
 			"status": "running",
 			"role":   found.Role,
 			"resources": gin.H{
-				"memory_mb":  req.MemoryMB,
-				"cpu_shares": req.CPUShares,
-				"disk_mb":    req.DiskMB,
+				"memory_mb":      req.MemoryMB,
+				"cpu_shares":     req.CPUShares,
+				"disk_mb":        req.DiskMB,
+				"resource_class": className,
 			},
 		},
 	})
@@ -1771,8 +2003,38 @@ func (h *ContainerHandler) CreateWithProgress(c *gin.Context) {
 
 	// Note: Container limits now unified for all trial users (5 containers)
 
+	tmpl, err := h.resolveTemplate(ctx, userID, &req)
+	if err != nil {
+		sendEvent(container.ProgressEvent{
+			Stage:    "validating",
+			Error:    err.Error(),
+			Complete: true,
+		})
+		return
+	}
+	if err := h.resolveRole(ctx, userID, &req); err != nil {
+		sendEvent(container.ProgressEvent{
+			Stage:    "validating",
+			Error:    "unknown role: " + req.Role,
+			Complete: true,
+		})
+		return
+	}
+
 	// Handle custom image validation
-	if req.Image == "custom" {
+	if buildName, ok := models.BuildImageName(req.Image); ok {
+		tag, _, err := h.resolveBuildImage(ctx, userID, buildName)
+		if err != nil {
+			sendEvent(container.ProgressEvent{
+				Stage:    "validating",
+				Error:    err.Error(),
+				Complete: true,
+			})
+			return
+		}
+		req.Image = "custom"
+		req.CustomImage = tag
+	} else if req.Image == "custom" {
 		if req.CustomImage == "" {
 			sendEvent(container.ProgressEvent{
 				Stage:    "validating",
@@ -1848,6 +2110,29 @@ func (h *ContainerHandler) CreateWithProgress(c *gin.Context) {
 		}
 	}
 
+	volumeMounts, _, err := h.resolveVolumeMounts(ctx, userID, req.Volumes, nil)
+	if err != nil {
+		sendEvent(container.ProgressEvent{
+			Stage:    "validating",
+			Error:    err.Error(),
+			Complete: true,
+		})
+		return
+	}
+
+	var class *models.ResourceClass
+	if req.ResourceClass != "" {
+		class, _, err = lookupResourceClass(ctx, h.store, req.ResourceClass, tier, subscriptionActive)
+		if err != nil {
+			sendEvent(container.ProgressEvent{
+				Stage:    "validating",
+				Error:    err.Error(),
+				Complete: true,
+			})
+			return
+		}
+	}
+
 	sendEvent(container.ProgressEvent{
 		Stage:    "validating",
 		Message:  "Validation complete",
@@ -1873,7 +2158,7 @@ func (h *ContainerHandler) CreateWithProgress(c *gin.Context) {
 		go func() {
 			var err error
 			if isCustom {
-				err = h.manager.PullCustomImageWithProgress(ctx, req.CustomImage, progressCh)
+				err = h.manager.PullCustomImageWithProgress(ctx, userID, req.CustomImage, progressCh)
 			} else {
 				err = h.manager.PullImageWithProgress(ctx, req.Image, progressCh)
 			}
@@ -1915,6 +2200,7 @@ func (h *ContainerHandler) CreateWithProgress(c *gin.Context) {
 		ContainerName: containerName,
 		ImageType:     req.Image,
 		CustomImage:   req.CustomImage,
+		Role:          req.Role,
 		Labels: map[string]string{
 			"rexec.tier":     tier,
 			"rexec.user_id":  userID,
@@ -1922,52 +2208,74 @@ func (h *ContainerHandler) CreateWithProgress(c *gin.Context) {
 		},
 	}
 
-	if isGuest || tier == "guest" {
-		cfg.Labels["rexec.tier"] = "guest"
-		cfg.Labels["rexec.guest"] = "true"
-		// Use token expiration if available (more accurate), otherwise calculate from now
-		if tokenExp, exists := c.Get("tokenExp"); exists {
-			expiresAt := time.Unix(tokenExp.(int64), 0)
-			cfg.Labels["rexec.expires_at"] = expiresAt.Format(time.RFC3339)
-		} else {
-			cfg.Labels["rexec.expires_at"] = time.Now().Add(GuestMaxContainerDuration).Format(time.RFC3339)
-		}
-	} else if (tier == "free" || tier == "trial") && !subscriptionActive {
-		// Enforce 50-hour session limit for free users without active subscription
-		expiresAt := time.Now().Add(models.AuthenticatedSessionDuration)
-		cfg.Labels["rexec.expires_at"] = expiresAt.Format(time.RFC3339)
+	applySessionLabels(c, cfg.Labels, tier, isGuest, subscriptionActive)
+
+	if tmpl != nil {
+		cfg.Env = container.TemplateEnv(tmpl)
+		cfg.Labels["rexec.template"] = tmpl.Name
 	}
+	cfg.Volumes = toVolumeMounts(volumeMounts)
 
-	limits := models.ValidateTrialResources(&req, tier)
+	limits := resourceLimits(&req, tier, subscriptionActive)
+	if class != nil {
+		limits = class.Limits()
+	}
 
-	// Override limits if we have specific subscription logic not covered by tier string
-	userLimits := models.GetUserResourceLimits(tier, subscriptionActive)
+	cfg.MemoryLimit = limits.MemoryMB * 1024 * 1024
+	cfg.CPULimit = limits.CPUShares             // Already in millicores
+	cfg.DiskQuota = limits.DiskMB * 1024 * 1024 // Convert MB to bytes
+	cfg.NetworkMB = models.GetUserResourceLimits(cfg.Labels["rexec.tier"], subscriptionActive).NetworkMB
+	if class != nil {
+		cfg.NetworkMB = class.NetworkMB
+		cfg.ResourceClass = class
+	}
 
-	if !subscriptionActive && (tier == "free" || tier == "trial") {
-		// Enforce stricter limits for non-subscribers
-		if limits.MemoryMB > userLimits.MemoryMB {
-			limits.MemoryMB = userLimits.MemoryMB
+	// Determine shell configuration - use request or defaults based on role
+	shellCfg := container.DefaultShellSetupConfig()
+	if req.Shell != nil {
+		if req.Shell.Enhanced != nil {
+			shellCfg.Enhanced = *req.Shell.Enhanced
 		}
-		if limits.CPUShares > userLimits.CPUShares {
-			limits.CPUShares = userLimits.CPUShares
+		if req.Shell.Theme != "" {
+			shellCfg.Theme = req.Shell.Theme
 		}
-		if limits.DiskMB > userLimits.DiskMB {
-			limits.DiskMB = userLimits.DiskMB
+		if req.Shell.Autosuggestions != nil {
+			shellCfg.Autosuggestions = *req.Shell.Autosuggestions
+		}
+		if req.Shell.SyntaxHighlight != nil {
+			shellCfg.SyntaxHighlight = *req.Shell.SyntaxHighlight
+		}
+		if req.Shell.HistorySearch != nil {
+			shellCfg.HistorySearch = *req.Shell.HistorySearch
+		}
+		if req.Shell.GitAliases != nil {
+			shellCfg.GitAliases = *req.Shell.GitAliases
+		}
+		if req.Shell.SystemStats != nil {
+			shellCfg.SystemStats = *req.Shell.SystemStats
 		}
 	}
 
-	cfg.MemoryLimit = limits.MemoryMB * 1024 * 1024
-	cfg.CPULimit = limits.CPUShares             // Already in millicores
-	cfg.DiskQuota = limits.DiskMB * 1024 * 1024 // Convert MB to bytes
-
-	info, err := h.manager.CreateContainer(ctx, cfg)
-	if err != nil {
+	// Claim a pre-warmed container if the pool has one; its shell and role are already set up
+	info, fromPool := h.claimFromPool(ctx, cfg, shellCfg, tmpl)
+	if fromPool {
 		sendEvent(container.ProgressEvent{
 			Stage:    "creating",
-			Error:    "Failed to create container: " + err.Error(),
-			Complete: true,
+			Message:  "Claimed a pre-warmed terminal",
+			Progress: 75,
+			Detail:   containerName,
 		})
-		return
+	} else {
+		var err error
+		info, err = h.manager.CreateContainer(ctx, cfg)
+		if err != nil {
+			sendEvent(container.ProgressEvent{
+				Stage:    "creating",
+				Error:    "Failed to create container: " + err.Error(),
+				Complete: true,
+			})
+			return
+		}
 	}
 
 	sendEvent(container.ProgressEvent{
@@ -1998,7 +2306,7 @@ func (h *ContainerHandler) CreateWithProgress(c *gin.Context) {
 		Image:      storedImageName,
 		Status:     info.Status,
 		DockerID:   info.ID,
-		VolumeName: "rexec-" + userID + "-" + containerName,
+		VolumeName: info.VolumeName,
 		MemoryMB:   limits.MemoryMB,
 		CPUShares:  limits.CPUShares,
 		DiskMB:     limits.DiskMB,
@@ -2014,6 +2322,15 @@ func (h *ContainerHandler) CreateWithProgress(c *gin.Context) {
 			Progress: 90,
 			Detail:   "Container is usable but may not persist after restart",
 		})
+	} else {
+		if err := h.recordVolumeAttachments(ctx, record.ID, volumeMounts); err != nil {
+			log.Printf("[Volumes] Failed to record volumes for container %s: %v", record.ID, err)
+		}
+		if class != nil {
+			if err := h.store.UpdateContainerResourceClass(ctx, record.ID, class.Name); err != nil {
+				log.Printf("[Container] Failed to record resource class for %s: %v", record.ID, err)
+			}
+		}
 	}
 
 	sendEvent(container.ProgressEvent{
@@ -2022,116 +2339,143 @@ func (h *ContainerHandler) CreateWithProgress(c *gin.Context) {
 		Progress: 90,
 	})
 
-	// Determine shell configuration - use request or defaults based on role
-	shellCfg := container.DefaultShellSetupConfig()
-	if req.Shell != nil {
-		if req.Shell.Enhanced != nil {
-			shellCfg.Enhanced = *req.Shell.Enhanced
-		}
-		if req.Shell.Theme != "" {
-			shellCfg.Theme = req.Shell.Theme
-		}
-		if req.Shell.Autosuggestions != nil {
-			shellCfg.Autosuggestions = *req.Shell.Autosuggestions
-		}
-		if req.Shell.SyntaxHighlight != nil {
-			shellCfg.SyntaxHighlight = *req.Shell.SyntaxHighlight
-		}
-		if req.Shell.HistorySearch != nil {
-			shellCfg.HistorySearch = *req.Shell.HistorySearch
-		}
-		if req.Shell.GitAliases != nil {
-			shellCfg.GitAliases = *req.Shell.GitAliases
-		}
-		if req.Shell.SystemStats != nil {
-			shellCfg.SystemStats = *req.Shell.SystemStats
-		}
-	}
-
-	// Stage 5: Configuring shell (install oh-my-zsh if enhanced)
-	if shellCfg.Enhanced {
-		sendEvent(container.ProgressEvent{
-			Stage:    "configuring",
-			Message:  "Setting up enhanced shell environment...",
-			Progress: 92,
-			Detail:   "Installing zsh and oh-my-zsh",
-		})
-	} else {
-		sendEvent(container.ProgressEvent{
-			Stage:    "configuring",
-			Message:  "Configuring minimal shell...",
-			Progress: 92,
-			Detail:   "Skipping enhanced shell features",
-		})
-	}
-
-	// Run shell setup with config - don't block container creation if it fails
-	shellResult, shellErr := container.SetupShellWithConfig(ctx, h.manager.GetClient(), info.ID, shellCfg)
-	if shellErr != nil {
-		// Log error but continue - shell setup is optional
+	// Stages 5 and 6 already ran when the pool member was warmed
+	if fromPool {
 		sendEvent(container.ProgressEvent{
 			Stage:    "configuring",
-			Message:  "Shell setup skipped (will use default shell)",
-			Progress: 95,
-			Detail:   shellErr.Error(),
-		})
-	} else if !shellResult.Success {
-		sendEvent(container.ProgressEvent{
-			Stage:    "configuring",
-			Message:  "Shell setup incomplete (will use default shell)",
-			Progress: 95,
-			Detail:   shellResult.Message,
+			Message:  "Shell and role ready",
+			Progress: 98,
+			Detail:   "Set up ahead of time by the warm pool",
 		})
 	} else {
+		// Stage 5: Configuring shell (install oh-my-zsh if enhanced)
 		if shellCfg.Enhanced {
 			sendEvent(container.ProgressEvent{
 				Stage:    "configuring",
-				Message:  "Enhanced shell configured successfully",
-				Progress: 95,
-				Detail:   "zsh with oh-my-zsh ready",
+				Message:  "Setting up enhanced shell environment...",
+				Progress: 92,
+				Detail:   "Installing zsh and oh-my-zsh",
 			})
 		} else {
 			sendEvent(container.ProgressEvent{
 				Stage:    "configuring",
-				Message:  "Shell ready",
+				Message:  "Configuring minimal shell...",
+				Progress: 92,
+				Detail:   "Skipping enhanced shell features",
+			})
+		}
+
+		// Run shell setup with config - don't block container creation if it fails
+		shellResult, shellErr := container.SetupShellWithConfig(ctx, h.manager.GetClient(), info.ID, shellCfg)
+		if shellErr != nil {
+			// Log error but continue - shell setup is optional
+			sendEvent(container.ProgressEvent{
+				Stage:    "configuring",
+				Message:  "Shell setup skipped (will use default shell)",
+				Progress: 95,
+				Detail:   shellErr.Error(),
+			})
+		} else if !shellResult.Success {
+			sendEvent(container.ProgressEvent{
+				Stage:    "configuring",
+				Message:  "Shell setup incomplete (will use default shell)",
 				Progress: 95,
-				Detail:   "Minimal shell mode",
+				Detail:   shellResult.Message,
 			})
+		} else {
+			if shellCfg.Enhanced {
+				sendEvent(container.ProgressEvent{
+					Stage:    "configuring",
+					Message:  "Enhanced shell configured successfully",
+					Progress: 95,
+					Detail:   "zsh with oh-my-zsh ready",
+				})
+			} else {
+				sendEvent(container.ProgressEvent{
+					Stage:    "configuring",
+					Message:  "Shell ready",
+					Progress: 95,
+					Detail:   "Minimal shell mode",
+				})
+			}
+		}
+
+		// Stage 6: Setup Role (run for ALL roles including standard to get AI tools)
+		if req.Role != "" {
+			sendEvent(container.ProgressEvent{
+				Stage:    "configuring",
+				Message:  fmt.Sprintf("Setting up %s environment...", req.Role),
+				Progress: 96,
+				Detail:   "Installing role-specific tools",
+			})
+
+			roleProgressCh := make(chan container.ProgressEvent, 10)
+			var roleResult *container.SetupShellResponse
+			var roleErr error
+			go func() {
+				roleResult, roleErr = h.setupRole(ctx, info.ID, req.Role, roleProgressCh)
+				close(roleProgressCh)
+			}()
+			for event := range roleProgressCh {
+				sendEvent(event)
+			}
+			if roleErr != nil {
+				sendEvent(container.ProgressEvent{
+					Stage:    "configuring",
+					Message:  fmt.Sprintf("Role setup failed: %v", roleErr),
+					Progress: 97,
+					Detail:   roleErr.Error(),
+				})
+			} else if !roleResult.Success {
+				sendEvent(container.ProgressEvent{
+					Stage:    "configuring",
+					Message:  fmt.Sprintf("Role setup incomplete: %s", roleResult.Message),
+					Progress: 97,
+					Detail:   roleResult.Output,
+				})
+			} else {
+				sendEvent(container.ProgressEvent{
+					Stage:    "configuring",
+					Message:  fmt.Sprintf("Role %s configured successfully", req.Role),
+					Progress: 98,
+					Detail:   "Tools installed",
+				})
+			}
 		}
 	}
 
-	// Stage 6: Setup Role (run for ALL roles including standard to get AI tools)
-	if req.Role != "" {
+	// Stage 6b: Apply environment template
+	if tmpl != nil {
 		sendEvent(container.ProgressEvent{
 			Stage:    "configuring",
-			Message:  fmt.Sprintf("Setting up %s environment...", req.Role),
-			Progress: 96,
-			Detail:   "Installing role-specific tools",
+			Message:  fmt.Sprintf("Applying template %s...", tmpl.Name),
+			Progress: 98,
+			Detail:   "Installing packages, dotfiles and running startup commands",
 		})
 
-		roleResult, roleErr := container.SetupRole(ctx, h.manager.GetClient(), info.ID, req.Role)
-		if roleErr != nil {
+		tmplResult, tmplErr := container.SetupTemplate(ctx, h.manager.GetClient(), info.ID, tmpl)
+		if tmplErr != nil {
 			sendEvent(container.ProgressEvent{
 				Stage:    "configuring",
-				Message:  fmt.Sprintf("Role setup failed: %v", roleErr),
-				Progress: 97,
-				Detail:   roleErr.Error(),
+				Message:  fmt.Sprintf("Template setup failed: %v", tmplErr),
+				Progress: 99,
+				Detail:   tmplErr.Error(),
 			})
-		} else if !roleResult.Success {
+		} else if !tmplResult.Success {
 			sendEvent(container.ProgressEvent{
 				Stage:    "configuring",
-				Message:  fmt.Sprintf("Role setup incomplete: %s", roleResult.Message),
-				Progress: 97,
-				Detail:   roleResult.Output,
+				Message:  fmt.Sprintf("Template setup incomplete: %s", tmplResult.Message),
+				Progress: 99,
+				Detail:   tmplResult.Output,
 			})
 		} else {
 			sendEvent(container.ProgressEvent{
 				Stage:    "configuring",
-				Message:  fmt.Sprintf("Role %s configured successfully", req.Role),
-				Progress: 98,
-				Detail:   "Tools installed",
+				Message:  fmt.Sprintf("Template %s applied", tmpl.Name),
+				Progress: 99,
 			})
 		}
+		h.openTemplatePorts(ctx, userID, record.ID, tmpl)
 	}
 
 	// Stage 6: Ready
@@ -2311,17 +2655,33 @@ func (h *ContainerHandler) ListImages(c *gin.Context) {
 	} else {
 		images = container.GetPopularImages()
 	}
+	builds := h.buildImageMetadata(c.Request.Context(), c.GetString("userID"))
+	images = append(images, builds...)
+	if builds == nil {
+		builds = []container.ImageMetadata{}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"images":     images,
 		"categories": container.GetImagesByCategory(),
 		"popular":    container.GetPopularImages(),
+		"builds":     builds,
 	})
 }
 
-// ListRoles returns available roles/environments with their tools
+// ListRoles returns available roles/environments with their tools,
+// followed by the caller's custom roles and global ones
 func (h *ContainerHandler) ListRoles(c *gin.Context) {
 	roles := container.AvailableRoles()
+	if userID := c.GetString("userID"); userID != "" && h.store != nil {
+		custom, err := h.store.GetCustomRolesForUser(c.Request.Context(), userID)
+		if err != nil {
+			log.Printf("[Container] Failed to load custom roles for %s: %v", userID, err)
+		}
+		for _, r := range custom {
+			roles = append(roles, container.CustomRoleInfo(r))
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"roles": roles,
 	})
@@ -2341,6 +2701,49 @@ func (h *ContainerHandler) Stats(c *gin.Context) {
 
 // Helper functions
 
+// resourceLimits returns the sizes a new terminal gets from the requested
+// custom values, clamped to what the user's tier and subscription allow
+func resourceLimits(req *models.CreateContainerRequest, tier string, subscriptionActive bool) models.ResourceLimits {
+	// ValidateTrialResources clamps based on GetTrialResourceLimits (4GB/4CPU/16GB),
+	// which is too generous for non-subscribers
+	limits := models.ValidateTrialResources(req, tier)
+
+	userLimits := models.GetUserResourceLimits(tier, subscriptionActive)
+	if !subscriptionActive && (tier == "free" || tier == "trial") {
+		// Enforce stricter limits for non-subscribers
+		if limits.MemoryMB > userLimits.MemoryMB {
+			limits.MemoryMB = userLimits.MemoryMB
+		}
+		if limits.CPUShares > userLimits.CPUShares {
+			limits.CPUShares = userLimits.CPUShares
+		}
+		if limits.DiskMB > userLimits.DiskMB {
+			limits.DiskMB = userLimits.DiskMB
+		}
+	}
+	return limits
+}
+
+// applySessionLabels marks guest terminals for cleanup and sets when
+// terminals of users without a subscription expire
+func applySessionLabels(c *gin.Context, labels map[string]string, tier string, isGuest, subscriptionActive bool) {
+	if isGuest || tier == "guest" {
+		labels["rexec.tier"] = "guest"
+		labels["rexec.guest"] = "true"
+		// Use token expiration if available (more accurate), otherwise calculate from now
+		if tokenExp, exists := c.Get("tokenExp"); exists {
+			expiresAt := time.Unix(tokenExp.(int64), 0)
+			labels["rexec.expires_at"] = expiresAt.Format(time.RFC3339)
+		} else {
+			labels["rexec.expires_at"] = time.Now().Add(GuestMaxContainerDuration).Format(time.RFC3339)
+		}
+	} else if (tier == "free" || tier == "trial") && !subscriptionActive {
+		// Enforce 50-hour session limit for free users without active subscription
+		expiresAt := time.Now().Add(models.AuthenticatedSessionDuration)
+		labels["rexec.expires_at"] = expiresAt.Format(time.RFC3339)
+	}
+}
+
 // isValidContainerName validates container name format
 func isValidContainerName(name string) bool {
 	if len(name) == 0 || len(name) > 64 {
@@ -2363,6 +2766,11 @@ func isValidDockerImage(image string) bool {
 	if len(image) == 0 || len(image) > 256 {
 		return false
 	}
+	// Snapshot and built images are only reachable through snapshot_id and
+	// "build:<name>", which check ownership
+	if container.IsSnapshotImage(image) || container.IsBuildImage(image) {
+		return false
+	}
 	// Basic validation - must contain at least one character and optionally a tag
 	// Format: [registry/]image[:tag]
 	parts := strings.Split(image, ":")
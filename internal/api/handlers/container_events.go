@@ -20,7 +20,7 @@ import (
 
 // ContainerEvent represents a container state change event
 type ContainerEvent struct {
-	Type      string      `json:"type"`      // "created", "started", "stopped", "deleted", "updated"
+	Type      string      `json:"type"`      // "created", "started", "stopped", "paused", "unpaused", "deleted", "updated"
 	Container interface{} `json:"container"` // Container data
 	Timestamp time.Time   `json:"timestamp"`
 }
@@ -494,6 +494,24 @@ func (h *ContainerEventsHub) NotifyContainerStopped(userID string, containerData
 	})
 }
 
+// NotifyContainerPaused notifies a user that a container was paused
+func (h *ContainerEventsHub) NotifyContainerPaused(userID string, containerData interface{}) {
+	h.BroadcastToUser(userID, ContainerEvent{
+		Type:      "paused",
+		Container: containerData,
+		Timestamp: time.Now(),
+	})
+}
+
+// NotifyContainerUnpaused notifies a user that a paused container resumed
+func (h *ContainerEventsHub) NotifyContainerUnpaused(userID string, containerData interface{}) {
+	h.BroadcastToUser(userID, ContainerEvent{
+		Type:      "unpaused",
+		Container: containerData,
+		Timestamp: time.Now(),
+	})
+}
+
 // NotifyContainerProgress notifies a user of container creation progress
 func (h *ContainerEventsHub) NotifyContainerProgress(userID string, progressData interface{}) {
 	h.BroadcastToUser(userID, ContainerEvent{
@@ -503,6 +521,53 @@ func (h *ContainerEventsHub) NotifyContainerProgress(userID string, progressData
 	})
 }
 
+// NotifySnapshotUpdated notifies a user that a snapshot changed state
+func (h *ContainerEventsHub) NotifySnapshotUpdated(userID string, snapshotData interface{}) {
+	h.BroadcastToUser(userID, ContainerEvent{
+		Type:      "snapshot",
+		Container: snapshotData,
+		Timestamp: time.Now(),
+	})
+}
+
+// NotifyImageBuildProgress relays a line of image build output to a user
+func (h *ContainerEventsHub) NotifyImageBuildProgress(userID string, progressData interface{}) {
+	h.BroadcastToUser(userID, ContainerEvent{
+		Type:      "image_build_progress",
+		Container: progressData,
+		Timestamp: time.Now(),
+	})
+}
+
+// NotifyImageBuildUpdated notifies a user that an image build finished
+func (h *ContainerEventsHub) NotifyImageBuildUpdated(userID string, buildData interface{}) {
+	h.BroadcastToUser(userID, ContainerEvent{
+		Type:      "image_build",
+		Container: buildData,
+		Timestamp: time.Now(),
+	})
+}
+
+// NotifyServiceUpdated notifies a user that a terminal service started,
+// exited, was restarted or changed
+func (h *ContainerEventsHub) NotifyServiceUpdated(userID string, serviceData interface{}) {
+	h.BroadcastToUser(userID, ContainerEvent{
+		Type:      "service",
+		Container: serviceData,
+		Timestamp: time.Now(),
+	})
+}
+
+// NotifyIncident notifies a user that a terminal ran out of a resource,
+// crashed or failed its health check
+func (h *ContainerEventsHub) NotifyIncident(userID string, incidentData interface{}) {
+	h.BroadcastToUser(userID, ContainerEvent{
+		Type:      "incident",
+		Container: incidentData,
+		Timestamp: time.Now(),
+	})
+}
+
 // NotifyAgentConnected notifies a user that an agent connected
 func (h *ContainerEventsHub) NotifyAgentConnected(userID string, agentData interface{}) {
 	h.BroadcastToUser(userID, ContainerEvent{
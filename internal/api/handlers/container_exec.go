@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rexec/rexec/internal/container"
+)
+
+// execRunner runs a one-shot command in a container or on an agent. With no
+// stdout or stderr writer the output comes back in the result instead.
+type execRunner func(ctx context.Context, req container.ExecRequest, streams container.ExecStreams) (*container.ExecResult, error)
+
+// execMessage is one message of a streamed exec. stdout and stderr carry
+// output on separate channels; exit or error always comes last.
+type execMessage struct {
+	Type       string `json:"type"` // stdout, stderr, exit or error
+	Data       string `json:"data,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// execStart is the first message on an exec WebSocket. With StdinStream the
+// command's stdin is fed by stdin messages until stdin_close.
+type execStart struct {
+	container.ExecRequest
+	StdinStream bool `json:"stdin_stream,omitempty"`
+}
+
+// execExitMessage reports how a streamed command ended
+func execExitMessage(result *container.ExecResult) execMessage {
+	code := result.ExitCode
+	return execMessage{Type: "exit", ExitCode: &code, DurationMs: result.DurationMs, TimedOut: result.TimedOut}
+}
+
+// execChannel writes one output channel of a command as execMessages. The
+// channels of a command share mu, so their messages never interleave.
+type execChannel struct {
+	mu   *sync.Mutex
+	name string
+	send func(execMessage) error
+}
+
+func (w *execChannel) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.send(execMessage{Type: w.name, Data: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// execChannels returns stdout and stderr writers sending through send
+func execChannels(send func(execMessage) error) (io.Writer, io.Writer) {
+	mu := &sync.Mutex{}
+	return &execChannel{mu: mu, name: "stdout", send: send}, &execChannel{mu: mu, name: "stderr", send: send}
+}
+
+// execError writes the response for a failed exec
+func execError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errAgentNotConnected):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+	}
+}
+
+// execTarget finds where :id runs commands: the caller's running container or
+// their agent. It writes the error response itself.
+func (h *ContainerHandler) execTarget(c *gin.Context) (execRunner, bool) {
+	id := c.Param("id")
+	if agentID, ok := strings.CutPrefix(id, "agent:"); ok {
+		if h.agentHandler == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "agent handler not configured"})
+			return nil, false
+		}
+		agent, err := h.store.GetAgent(c.Request.Context(), agentID)
+		if err != nil || agent == nil || agent.UserID != c.GetString("userID") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+			return nil, false
+		}
+		return func(ctx context.Context, req container.ExecRequest, streams container.ExecStreams) (*container.ExecResult, error) {
+			return h.agentHandler.Exec(ctx, agentID, req, streams)
+		}, true
+	}
+
+	found, ok := h.runningContainer(c)
+	if !ok {
+		return nil, false
+	}
+	return func(ctx context.Context, req container.ExecRequest, streams container.ExecStreams) (*container.ExecResult, error) {
+		if streams.Stdout == nil && streams.Stderr == nil {
+			return h.manager.Exec(ctx, found.DockerID, req)
+		}
+		return h.manager.ExecStream(ctx, found.DockerID, req, streams)
+	}, true
+}
+
+// Exec runs a one-shot command without a PTY and returns its stdout, stderr
+// and exit code. With ?stream=sse or Accept: text/event-stream the output is
+// streamed as it's produced instead, one execMessage per event.
+// POST /api/containers/:id/exec
+func (h *ContainerHandler) Exec(c *gin.Context) {
+	var req container.ExecRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	run, ok := h.execTarget(c)
+	if !ok {
+		return
+	}
+
+	if c.Query("stream") != "sse" && !strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		result, err := run(c.Request.Context(), req, container.ExecStreams{})
+		if err != nil {
+			execError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Writer.WriteHeader(200)
+	c.Writer.Write([]byte(": stream connected\n\n"))
+	c.Writer.Flush()
+
+	send := func(msg execMessage) error {
+		data, _ := json.Marshal(msg)
+		if _, err := c.Writer.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	stdout, stderr := execChannels(send)
+	result, err := run(c.Request.Context(), req, container.ExecStreams{Stdout: stdout, Stderr: stderr})
+	if err != nil {
+		send(execMessage{Type: "error", Error: container.SanitizeError(err)})
+		return
+	}
+	send(execExitMessage(result))
+}
+
+// HandleExecWebSocket runs a one-shot command over a WebSocket. The client
+// sends an execStart, then stdin and stdin_close messages if it asked to
+// stream stdin; the server sends stdout and stderr messages and finally exit
+// or error. Closing the socket kills the command.
+// GET /ws/exec/:id
+func (h *ContainerHandler) HandleExecWebSocket(c *gin.Context) {
+	run, ok := h.execTarget(c)
+	if !ok {
+		return
+	}
+
+	responseHeader := http.Header{}
+	if strings.Contains(c.GetHeader("Sec-WebSocket-Protocol"), terminalProtocolV1) {
+		responseHeader.Set("Sec-WebSocket-Protocol", terminalProtocolV1)
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, responseHeader)
+	if err != nil {
+		log.Printf("[Exec] WebSocket upgrade failed for %s: %v", c.Param("id"), err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(2 * container.MaxExecStdinBytes)
+
+	send := func(msg execMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(msg)
+	}
+
+	var start execStart
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	if err := conn.ReadJSON(&start); err != nil {
+		send(execMessage{Type: "error", Error: "invalid request: " + err.Error()})
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	req := start.ExecRequest
+	if err := req.Validate(); err != nil {
+		send(execMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	streams := container.ExecStreams{}
+	streams.Stdout, streams.Stderr = execChannels(send)
+
+	var stdinWriter *io.PipeWriter
+	if start.StdinStream {
+		var stdinReader *io.PipeReader
+		stdinReader, stdinWriter = io.Pipe()
+		// Unblocks stdin messages the command never read
+		defer stdinReader.Close()
+		streams.Stdin = stdinReader
+	}
+	go func() {
+		// The client going away kills the command
+		defer cancel()
+		for {
+			var msg execMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				if stdinWriter != nil {
+					stdinWriter.CloseWithError(err)
+				}
+				return
+			}
+			if stdinWriter == nil {
+				continue
+			}
+			switch msg.Type {
+			case "stdin":
+				stdinWriter.Write([]byte(msg.Data))
+			case "stdin_close":
+				stdinWriter.Close()
+			}
+		}
+	}()
+
+	result, err := run(ctx, req, streams)
+	if err != nil {
+		send(execMessage{Type: "error", Error: container.SanitizeError(err)})
+	} else {
+		send(execExitMessage(result))
+	}
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
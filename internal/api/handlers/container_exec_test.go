@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rexec/rexec/internal/container"
+)
+
+func TestExecChannels(t *testing.T) {
+	var sent []execMessage
+	stdout, stderr := execChannels(func(msg execMessage) error {
+		sent = append(sent, msg)
+		return nil
+	})
+	stdout.Write([]byte("built\n"))
+	stderr.Write([]byte("warning\n"))
+
+	if len(sent) != 2 || sent[0].Type != "stdout" || sent[0].Data != "built\n" || sent[1].Type != "stderr" || sent[1].Data != "warning\n" {
+		t.Errorf("sent = %+v, want stdout then stderr on their own channels", sent)
+	}
+
+	exit := execExitMessage(&container.ExecResult{ExitCode: 2, DurationMs: 30, TimedOut: true})
+	if exit.Type != "exit" || exit.ExitCode == nil || *exit.ExitCode != 2 || exit.DurationMs != 30 || !exit.TimedOut {
+		t.Errorf("execExitMessage() = %+v, want exit 2 after 30ms, timed out", exit)
+	}
+}
+
+func TestAgentConnection_Execs(t *testing.T) {
+	var stdout bytes.Buffer
+	pending := &agentExec{streams: container.ExecStreams{Stdout: &stdout}, result: make(chan agentExecResult, 1)}
+	agentConn := &AgentConnection{execs: map[string]*agentExec{"abc": pending}}
+
+	agentConn.execOutput("abc", "stdout", []byte("hello"))
+	agentConn.execOutput("abc", "stderr", []byte("dropped without a writer"))
+	agentConn.execOutput("other", "stdout", []byte("not ours"))
+	if stdout.String() != "hello" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "hello")
+	}
+
+	if agentConn.finishExec(agentExecResult{}) {
+		t.Error("finishExec() took a result without an ID")
+	}
+	if !agentConn.finishExec(agentExecResult{ID: "abc", ExitCode: 1}) {
+		t.Fatal("finishExec() didn't deliver a waited-for result")
+	}
+	if result := <-pending.result; result.ExitCode != 1 {
+		t.Errorf("result = %+v, want exit 1", result)
+	}
+	if agentConn.finishExec(agentExecResult{ID: "abc"}) {
+		t.Error("finishExec() delivered a second result")
+	}
+
+	pending = &agentExec{result: make(chan agentExecResult, 1)}
+	agentConn.execs["def"] = pending
+	agentConn.failExecs()
+	if result := <-pending.result; result.Error == "" || len(agentConn.execs) != 0 {
+		t.Errorf("failExecs() = %+v with %d left, want an error for every exec", result, len(agentConn.execs))
+	}
+}
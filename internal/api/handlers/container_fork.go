@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// ForkContainerRequest represents a request to fork a container
+type ForkContainerRequest struct {
+	Name          string `json:"name"`           // Optional - defaults to the source's name + "-fork"
+	ResourceClass string `json:"resource_class"` // Optional - defaults to the source's class
+}
+
+// Fork creates a new terminal from the current state of an existing one: its
+// root filesystem, home directory, role and settings. Collaborators with
+// control of a shared terminal can fork it too, and own the fork. The copy is
+// taken in the background; progress is reported like a create.
+// POST /api/containers/:id/fork
+func (h *ContainerHandler) Fork(c *gin.Context) {
+	userID := c.GetString("userID")
+	tier := c.GetString("tier")
+	isGuest := c.GetBool("guest")
+	subscriptionActive := c.GetBool("subscription_active")
+
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req ForkContainerRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+
+	source, shared, status, err := h.forkSource(ctx, userID, c.Param("id"))
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if source.DockerID == "" || !h.manager.DockerContainerExists(ctx, source.DockerID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "container is not available for forking"})
+		return
+	}
+
+	// Check container limit - use database count to include orphaned containers
+	existingContainers, err := h.store.GetContainersByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check container limit"})
+		return
+	}
+	limit := container.UserContainerLimit(tier)
+	if len(existingContainers) >= limit {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "container limit reached",
+			"current": len(existingContainers),
+			"limit":   limit,
+			"tier":    tier,
+			"message": "Upgrade your plan to create more containers",
+		})
+		return
+	}
+
+	taken := make(map[string]bool, len(existingContainers))
+	for _, record := range existingContainers {
+		taken[record.Name] = true
+	}
+	containerName := strings.TrimSpace(req.Name)
+	if containerName == "" {
+		containerName = forkName(source.Name, taken)
+	}
+	if !isValidContainerName(containerName) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid container name: must be 1-64 characters, alphanumeric and hyphens only",
+		})
+		return
+	}
+	if taken[containerName] {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "container with this name already exists",
+			"name":  containerName,
+		})
+		return
+	}
+
+	// The fork keeps the source's class if the caller's plan allows it
+	var class *models.ResourceClass
+	if req.ResourceClass != "" {
+		class, status, err = lookupResourceClass(ctx, h.store, req.ResourceClass, tier, subscriptionActive)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	} else if class = containerResourceClass(ctx, h.store, source.ID); class != nil && !class.AllowsTier(models.ClassTier(tier, subscriptionActive)) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("resource class %q is not available on your plan; pick another resource_class", class.Name),
+		})
+		return
+	}
+
+	limits := resourceLimits(&models.CreateContainerRequest{
+		MemoryMB:  source.MemoryMB,
+		CPUShares: source.CPUShares,
+		DiskMB:    source.DiskMB,
+	}, tier, subscriptionActive)
+	if class != nil {
+		limits = class.Limits()
+	}
+
+	// Shared volumes are mounted, not copied, so only the owner's fork gets them
+	var volumeMounts []*storage.VolumeMountRecord
+	if !shared {
+		if volumeMounts, err = h.store.GetContainerVolumeMounts(ctx, source.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch volumes"})
+			return
+		}
+	}
+	egress := h.manager.EgressPolicy(source.DockerID)
+	incidentPolicy, err := h.store.GetContainerIncidentPolicy(ctx, source.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch incident policy"})
+		return
+	}
+
+	recordID := uuid.New().String()
+	imageTag := container.ForkImageTag(recordID)
+	record := &storage.ContainerRecord{
+		ID:         recordID,
+		UserID:     userID,
+		Name:       containerName,
+		Image:      "custom:" + imageTag,
+		Role:       source.Role,
+		Status:     "creating",
+		VolumeName: "rexec-" + userID + "-" + containerName,
+		MemoryMB:   limits.MemoryMB,
+		CPUShares:  limits.CPUShares,
+		DiskMB:     limits.DiskMB,
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+	}
+	if err := h.store.CreateContainer(ctx, record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create container record: " + err.Error()})
+		return
+	}
+	if err := h.recordVolumeAttachments(ctx, record.ID, volumeMounts); err != nil {
+		h.store.DeleteContainer(ctx, record.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to attach volumes"})
+		return
+	}
+	if class != nil {
+		if err := h.store.UpdateContainerResourceClass(ctx, record.ID, class.Name); err != nil {
+			log.Printf("[Container] Failed to record resource class for %s: %v", record.ID, err)
+		}
+	}
+	if egress != nil {
+		if err := h.store.UpdateContainerEgressPolicy(ctx, record.ID, egress); err != nil {
+			log.Printf("[Container] Failed to copy egress policy to fork %s: %v", record.ID, err)
+		}
+	}
+	if incidentPolicy != nil {
+		if err := h.store.UpdateContainerIncidentPolicy(ctx, record.ID, incidentPolicy); err != nil {
+			log.Printf("[Container] Failed to copy incident policy to fork %s: %v", record.ID, err)
+		}
+	}
+	if source.MFALocked {
+		if err := h.store.SetContainerMFALock(ctx, record.ID, true); err != nil {
+			log.Printf("[Container] Failed to lock fork %s: %v", record.ID, err)
+		}
+	}
+
+	if h.adminEventsHub != nil {
+		h.adminEventsHub.Broadcast("container_created", record)
+	}
+
+	useTmux := "false"
+	if info, ok := h.manager.GetContainer(source.DockerID); ok && info.Labels["rexec.use_tmux"] == "true" {
+		useTmux = "true"
+	}
+	cfg := container.ContainerConfig{
+		UserID:        userID,
+		ContainerName: containerName,
+		ImageType:     "custom",
+		CustomImage:   imageTag,
+		Role:          source.Role,
+		Labels: map[string]string{
+			"rexec.tier":              tier,
+			"rexec.user_id":           userID,
+			"rexec.role":              source.Role,
+			"rexec.use_tmux":          useTmux,
+			container.ForkedFromLabel: source.ID,
+		},
+		Egress: egress,
+	}
+	applySessionLabels(c, cfg.Labels, tier, isGuest, subscriptionActive)
+	cfg.Volumes = toVolumeMounts(volumeMounts)
+	cfg.MemoryLimit = limits.MemoryMB * 1024 * 1024
+	cfg.CPULimit = limits.CPUShares
+	cfg.DiskQuota = limits.DiskMB * 1024 * 1024
+	cfg.NetworkMB = models.GetUserResourceLimits(cfg.Labels["rexec.tier"], subscriptionActive).NetworkMB
+	if class != nil {
+		cfg.NetworkMB = class.NetworkMB
+		cfg.ResourceClass = class
+	}
+
+	if h.eventsHub != nil {
+		h.eventsHub.NotifyContainerProgress(userID, gin.H{
+			"id":       record.ID,
+			"stage":    "validating",
+			"message":  "Validation complete",
+			"progress": 10,
+		})
+	}
+
+	go func() {
+		createContainerSem <- struct{}{}
+		defer func() { <-createContainerSem }()
+		h.forkContainerAsync(record.ID, source.DockerID, cfg, isGuest || tier == "guest")
+	}()
+
+	resources := gin.H{
+		"memory_mb":  limits.MemoryMB,
+		"cpu_shares": limits.CPUShares,
+		"disk_mb":    limits.DiskMB,
+	}
+	if class != nil {
+		resources["resource_class"] = class.Name
+	}
+	response := gin.H{
+		"id":          record.ID,
+		"db_id":       record.ID,
+		"user_id":     userID,
+		"name":        containerName,
+		"image":       record.Image,
+		"role":        record.Role,
+		"status":      "creating",
+		"created_at":  record.CreatedAt,
+		"async":       true,
+		"forked_from": source.ID,
+		"message":     "Terminal is being forked. This may take a moment for large home directories.",
+		"resources":   resources,
+	}
+	if len(volumeMounts) > 0 {
+		response["volumes"] = volumeMounts
+	}
+	if expiresAt, ok := cfg.Labels["rexec.expires_at"]; ok {
+		response["expires_at"] = expiresAt
+	}
+
+	c.JSON(http.StatusAccepted, response)
+}
+
+// forkContainerAsync captures the source terminal and creates the fork from it
+func (h *ContainerHandler) forkContainerAsync(recordID, sourceDockerID string, cfg container.ContainerConfig, isGuest bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	userID := cfg.UserID
+
+	if h.eventsHub != nil {
+		h.eventsHub.NotifyContainerProgress(userID, gin.H{
+			"id":       recordID,
+			"stage":    "copying",
+			"message":  "Copying terminal...",
+			"progress": 12,
+		})
+	}
+
+	info, err := h.manager.ForkContainer(ctx, sourceDockerID, userID, recordID)
+	if err != nil {
+		log.Printf("[Container] Failed to fork %s: %v", sourceDockerID, err)
+		sanitizedErr := container.SanitizeError(err)
+		h.store.UpdateContainerStatus(ctx, recordID, "error")
+		h.store.UpdateContainerError(ctx, recordID, "failed to copy terminal: "+err.Error())
+		if h.eventsHub != nil {
+			h.eventsHub.NotifyContainerProgress(userID, gin.H{
+				"id":       recordID,
+				"stage":    "error",
+				"message":  "Failed to copy terminal",
+				"progress": 0,
+				"error":    sanitizedErr,
+				"complete": true,
+			})
+			h.eventsHub.NotifyContainerUpdated(userID, gin.H{
+				"id":     recordID,
+				"status": "error",
+				"error":  sanitizedErr,
+			})
+		}
+		return
+	}
+
+	// The archive is only needed until it's restored into the fork's home volume
+	cfg.SnapshotArchive = info.ArchivePath
+	h.createContainerAsync(recordID, cfg, "custom", info.ImageTag, cfg.Role, container.DefaultShellSetupConfig(), nil, isGuest)
+	if err := h.manager.DeleteSnapshot(ctx, "", info.ArchivePath); err != nil {
+		log.Printf("[Container] Failed to remove fork archive for %s: %v", recordID, err)
+	}
+
+	// Nothing runs from the image if the create failed
+	if record, err := h.store.GetContainerByID(ctx, recordID); err == nil && record != nil && record.Status == "error" {
+		if err := h.manager.DeleteSnapshot(ctx, info.ImageTag, ""); err != nil {
+			log.Printf("[Container] Failed to remove fork image %s: %v", info.ImageTag, err)
+		}
+	}
+}
+
+// forkSource finds the terminal to fork: one of the user's own, or one shared
+// with them in a collab session that gives them control. It reports whether
+// the terminal is shared, and on error the status to respond with.
+func (h *ContainerHandler) forkSource(ctx context.Context, userID, id string) (*storage.ContainerRecord, bool, int, error) {
+	if strings.HasPrefix(id, "agent:") {
+		return nil, false, http.StatusBadRequest, fmt.Errorf("agent terminals can't be forked")
+	}
+
+	found, err := h.findUserContainer(ctx, userID, id)
+	if err != nil {
+		return nil, false, http.StatusInternalServerError, fmt.Errorf("failed to verify container ownership")
+	}
+	if found != nil {
+		return found, false, http.StatusOK, nil
+	}
+
+	sessions, err := h.store.GetActiveCollabSessionsForParticipant(ctx, userID)
+	if err != nil {
+		return nil, false, http.StatusInternalServerError, fmt.Errorf("failed to fetch shared terminals")
+	}
+	for _, session := range sessions {
+		if strings.HasPrefix(session.ContainerID, "agent:") || time.Now().After(session.ExpiresAt) {
+			continue
+		}
+		info, ok := h.manager.GetContainer(session.ContainerID)
+		if !ok || info.UserID != session.OwnerID {
+			continue
+		}
+		record, err := h.store.GetContainerByDockerID(ctx, info.ID)
+		if err != nil || record == nil || record.UserID != session.OwnerID || (record.DockerID != id && record.ID != id) {
+			continue
+		}
+		if session.Mode != "control" {
+			return nil, true, http.StatusForbidden, fmt.Errorf("forking a shared terminal needs control access")
+		}
+		if record.MFALocked {
+			return nil, true, http.StatusForbidden, fmt.Errorf("this terminal is locked by its owner")
+		}
+		return record, true, http.StatusOK, nil
+	}
+	return nil, false, http.StatusNotFound, fmt.Errorf("container not found")
+}
+
+// forkName picks an unused name for a fork: the source's name with "-fork",
+// numbered if that's taken
+func forkName(source string, taken map[string]bool) string {
+	const maxLen = 64
+	for i := 1; ; i++ {
+		suffix := "-fork"
+		if i > 1 {
+			suffix += fmt.Sprint(i)
+		}
+		base := source
+		if len(base)+len(suffix) > maxLen {
+			base = strings.TrimRight(base[:maxLen-len(suffix)], "-")
+		}
+		if name := base + suffix; !taken[name] {
+			return name
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForkName(t *testing.T) {
+	long := strings.Repeat("a", 62)
+	tests := []struct {
+		name   string
+		source string
+		taken  []string
+		want   string
+	}{
+		{"First fork", "web", nil, "web-fork"},
+		{"Numbered when taken", "web", []string{"web-fork", "web-fork2"}, "web-fork3"},
+		{"Fork of a fork", "web-fork", []string{"web-fork"}, "web-fork-fork"},
+		{"Trimmed to fit", long, nil, strings.Repeat("a", 59) + "-fork"},
+		{"Trailing hyphen dropped", strings.Repeat("a", 58) + "-b", nil, strings.Repeat("a", 58) + "-fork"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taken := make(map[string]bool)
+			for _, name := range tt.taken {
+				taken[name] = true
+			}
+			got := forkName(tt.source, taken)
+			if got != tt.want {
+				t.Errorf("forkName(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+			if !isValidContainerName(got) {
+				t.Errorf("forkName(%q) = %q, not a valid container name", tt.source, got)
+			}
+		})
+	}
+}
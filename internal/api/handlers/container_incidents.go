@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// Incident listings return 50 incidents unless ?limit= asks for up to 500
+const (
+	defaultIncidentLimit = 50
+	maxIncidentLimit     = 500
+)
+
+// IncidentRaised tells a terminal's owner about an incident, and that the
+// terminal stopped, started again or got more memory because of it. The
+// incident watcher has already updated the database.
+func (h *ContainerHandler) IncidentRaised(incident *models.ContainerIncident, status string) {
+	if h.adminEventsHub != nil && (status != "" || incident.Action == models.IncidentActionGrewMemory) {
+		if updated, err := h.store.GetContainerByID(context.Background(), incident.ContainerID); err == nil && updated != nil {
+			h.adminEventsHub.Broadcast("container_updated", updated)
+		}
+	}
+	if h.eventsHub == nil {
+		return
+	}
+	h.eventsHub.NotifyIncident(incident.UserID, incident)
+
+	data := gin.H{
+		"id":       incident.DockerID,
+		"db_id":    incident.ContainerID,
+		"incident": incident.ID,
+	}
+	switch {
+	case status == "stopped":
+		data["status"] = status
+		h.eventsHub.NotifyContainerStopped(incident.UserID, data)
+	case status == "running":
+		data["status"] = status
+		h.eventsHub.NotifyContainerStarted(incident.UserID, data)
+	case incident.Action == models.IncidentActionGrewMemory:
+		data["resources"] = gin.H{"memory_mb": incident.Details["memory_mb"]}
+		h.eventsHub.NotifyContainerUpdated(incident.UserID, data)
+	}
+}
+
+// ListIncidents returns a container's most recent incidents, newest first
+// GET /api/containers/:id/incidents?limit=
+func (h *ContainerHandler) ListIncidents(c *gin.Context) {
+	ctx := c.Request.Context()
+	found, err := h.store.GetContainerByUserAndDockerID(ctx, c.GetString("userID"), c.Param("id"))
+	if err != nil || found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+
+	limit := defaultIncidentLimit
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		limit = min(limit, maxIncidentLimit)
+	}
+
+	incidents, err := h.store.GetContainerIncidents(ctx, found.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+	policy, err := h.store.GetContainerIncidentPolicy(ctx, found.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+	if policy == nil {
+		policy = &models.IncidentPolicy{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"incidents": incidents,
+		"policy":    policy,
+	})
+}
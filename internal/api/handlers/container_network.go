@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// updateEgressPolicy saves a container's own egress policy and applies it to
+// the running container. An open policy with no deny rules clears it, leaving
+// only the tier's policy. On failure it writes the response and returns false.
+func (h *ContainerHandler) updateEgressPolicy(c *gin.Context, found *storage.ContainerRecord, policy *models.EgressPolicy) bool {
+	ctx := c.Request.Context()
+	if policy.IsOpen() {
+		policy = nil
+	}
+
+	if err := h.store.UpdateContainerEgressPolicy(ctx, found.ID, policy); err != nil {
+		log.Printf("[UpdateSettings] Failed to update egress policy for container %s: %v", found.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update egress policy"})
+		return false
+	}
+	if found.DockerID == "" {
+		return true
+	}
+
+	if err := h.manager.SetEgressPolicy(ctx, found.DockerID, policy); err != nil {
+		// The stricter policy isn't in force, so don't leave the container running
+		log.Printf("[UpdateSettings] %v; stopping container %s", err, found.DockerID[:12])
+		if stopErr := h.manager.StopContainer(ctx, found.DockerID); stopErr == nil {
+			h.containerStatusChanged(ctx, found, "stopped")
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "egress policy saved but could not be applied; the container was stopped"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// Pause freezes a running container; processes and memory are kept
+// POST /api/containers/:id/pause
+func (h *ContainerHandler) Pause(c *gin.Context) {
+	h.setPaused(c, true)
+}
+
+// Unpause resumes a paused container
+// POST /api/containers/:id/unpause
+func (h *ContainerHandler) Unpause(c *gin.Context) {
+	h.setPaused(c, false)
+}
+
+func (h *ContainerHandler) setPaused(c *gin.Context, pause bool) {
+	userID := c.GetString("userID")
+	dockerID := c.Param("id")
+	ctx := c.Request.Context()
+
+	found, err := h.store.GetContainerByUserAndDockerID(ctx, userID, dockerID)
+	if err != nil || found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+
+	status := "running"
+	if pause {
+		if found.Status != "running" {
+			c.JSON(http.StatusConflict, gin.H{"error": "only running containers can be paused", "status": found.Status})
+			return
+		}
+		status = "paused"
+		err = h.manager.PauseContainer(ctx, dockerID)
+	} else {
+		if found.Status != "paused" {
+			c.JSON(http.StatusConflict, gin.H{"error": "container is not paused", "status": found.Status})
+			return
+		}
+		err = h.manager.UnpauseContainer(ctx, dockerID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+
+	h.containerStatusChanged(ctx, found, status)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "container " + status,
+		"id":      dockerID,
+		"name":    found.Name,
+		"status":  status,
+	})
+}
+
+// IdleStatusChanged records a pause or stop made by the idle cleanup service
+// and tells the owner's clients about it
+func (h *ContainerHandler) IdleStatusChanged(info *container.ContainerInfo, status string) {
+	ctx := context.Background()
+	record, err := h.store.GetContainerByDockerID(ctx, info.ID)
+	if err != nil || record == nil {
+		return
+	}
+	h.containerStatusChanged(ctx, record, status)
+}
+
+// containerStatusChanged saves a container's new status and broadcasts it
+// to the owner and the admin dashboard
+func (h *ContainerHandler) containerStatusChanged(ctx context.Context, record *storage.ContainerRecord, status string) {
+	if err := h.store.UpdateContainerStatus(ctx, record.ID, status); err != nil {
+		log.Printf("[Container] Failed to update status of %s to %s: %v", record.ID, status, err)
+	}
+	h.broadcastStatus(ctx, record, status)
+}
+
+// ReconcileChanged tells a terminal's owner and the admin dashboard that the
+// reconciler brought its status in line with Docker, or deleted it because
+// its container is gone. The reconciler has already updated the database.
+func (h *ContainerHandler) ReconcileChanged(record *storage.ContainerRecord, status string) {
+	if status == "deleted" {
+		if h.adminEventsHub != nil {
+			h.adminEventsHub.Broadcast("container_deleted", record)
+		}
+		if h.eventsHub != nil {
+			h.eventsHub.NotifyContainerDeleted(record.UserID, record.DockerID, record.ID)
+		}
+		return
+	}
+	h.broadcastStatus(context.Background(), record, status)
+}
+
+// broadcastStatus sends a container's new status to the owner and the admin
+// dashboard
+func (h *ContainerHandler) broadcastStatus(ctx context.Context, record *storage.ContainerRecord, status string) {
+	if h.adminEventsHub != nil {
+		if updated, err := h.store.GetContainerByID(ctx, record.ID); err == nil && updated != nil {
+			h.adminEventsHub.Broadcast("container_updated", updated)
+		}
+	}
+
+	if h.eventsHub == nil {
+		return
+	}
+	data := gin.H{
+		"id":     record.DockerID,
+		"db_id":  record.ID,
+		"name":   record.Name,
+		"status": status,
+	}
+	switch status {
+	case "paused":
+		h.eventsHub.NotifyContainerPaused(record.UserID, data)
+	case "stopped":
+		h.eventsHub.NotifyContainerStopped(record.UserID, data)
+	case "running":
+		h.eventsHub.NotifyContainerUnpaused(record.UserID, data)
+	default:
+		h.eventsHub.NotifyContainerUpdated(record.UserID, data)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// Schedules can't expire further out than this
+const maxScheduleTTL = 365 * 24 * time.Hour
+
+// scheduleRequest is the "schedule" field of PATCH /api/containers/:id/settings.
+// TTL is a duration from now ("72h") and is an alternative to expires_at.
+// An empty object clears the schedule.
+type scheduleRequest struct {
+	models.ContainerSchedule
+	TTL string `json:"ttl,omitempty"`
+}
+
+// resolve validates the request and turns a TTL into an expiry time
+func (r *scheduleRequest) resolve(now time.Time) (*models.ContainerSchedule, error) {
+	schedule := r.ContainerSchedule
+
+	if r.TTL != "" {
+		if schedule.ExpiresAt != nil {
+			return nil, fmt.Errorf("set either ttl or expires_at, not both")
+		}
+		ttl, err := time.ParseDuration(r.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("ttl must be a positive duration such as 72h")
+		}
+		expiresAt := now.Add(ttl)
+		schedule.ExpiresAt = &expiresAt
+	}
+	if schedule.ExpiresAt != nil {
+		if !schedule.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("expires_at must be in the future")
+		}
+		if schedule.ExpiresAt.Sub(now) > maxScheduleTTL {
+			return nil, fmt.Errorf("expires_at can be at most %v away", maxScheduleTTL)
+		}
+	}
+
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// ScheduleChanged tells a container's owner and the admin dashboard that the
+// scheduler started, stopped or deleted it. The scheduler has already
+// updated the database.
+func (h *ContainerHandler) ScheduleChanged(record *storage.ContainerRecord, status string) {
+	ctx := context.Background()
+
+	if status == "deleted" {
+		if h.adminEventsHub != nil {
+			h.adminEventsHub.Broadcast("container_deleted", record)
+		}
+		if h.eventsHub != nil {
+			h.eventsHub.NotifyContainerDeleted(record.UserID, record.DockerID, record.ID)
+		}
+		return
+	}
+
+	if h.adminEventsHub != nil {
+		if updated, err := h.store.GetContainerByID(ctx, record.ID); err == nil && updated != nil {
+			h.adminEventsHub.Broadcast("container_updated", updated)
+		}
+	}
+	if h.eventsHub == nil {
+		return
+	}
+	data := gin.H{
+		"id":        record.DockerID,
+		"db_id":     record.ID,
+		"name":      record.Name,
+		"status":    status,
+		"scheduled": true,
+	}
+	if status == "running" {
+		h.eventsHub.NotifyContainerStarted(record.UserID, data)
+	} else {
+		h.eventsHub.NotifyContainerStopped(record.UserID, data)
+	}
+}
@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// Service log requests return at most this many lines
+const maxServiceLogLines = 5000
+
+// SetServiceSupervisor lets service changes take effect without waiting for
+// the supervisor's next check
+func (h *ContainerHandler) SetServiceSupervisor(supervisor *container.ServiceSupervisor) {
+	h.services = supervisor
+}
+
+// serviceResponse is a service as returned by the API and the events hub
+type serviceResponse struct {
+	*models.ContainerService
+	DockerID string `json:"docker_id"`
+	LogPath  string `json:"log_path"`
+}
+
+func newServiceResponse(svc *models.ContainerService) serviceResponse {
+	return serviceResponse{ContainerService: svc, DockerID: svc.DockerID, LogPath: container.ServiceLogPath(svc.Name)}
+}
+
+// ServiceChanged tells a service's owner that its state changed
+func (h *ContainerHandler) ServiceChanged(svc *models.ContainerService) {
+	if h.eventsHub != nil {
+		h.eventsHub.NotifyServiceUpdated(svc.UserID, newServiceResponse(svc))
+	}
+}
+
+// runningContainer finds the caller's container and checks it's running. It
+// writes the error response itself.
+func (h *ContainerHandler) runningContainer(c *gin.Context) (*storage.ContainerRecord, bool) {
+	found, err := h.store.GetContainerByUserAndDockerID(c.Request.Context(), c.GetString("userID"), c.Param("id"))
+	if err != nil || found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return nil, false
+	}
+	if found.Status != "running" {
+		c.JSON(http.StatusConflict, gin.H{"error": "container is not running", "status": found.Status})
+		return nil, false
+	}
+	return found, true
+}
+
+// ListProcesses lists the processes in a container as a tree, or as a flat
+// list sorted by PID with ?flat=true. The root process of each supervised
+// service is labelled with its name.
+// GET /api/containers/:id/processes
+func (h *ContainerHandler) ListProcesses(c *gin.Context) {
+	found, ok := h.runningContainer(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	procs, err := h.manager.ListProcesses(ctx, found.DockerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+
+	if services, err := h.store.GetContainerServices(ctx, found.ID); err == nil {
+		byPID := make(map[int]string, len(services))
+		for _, svc := range services {
+			if svc.PID > 0 {
+				byPID[svc.PID] = svc.Name
+			}
+		}
+		for _, p := range procs {
+			p.Service = byPID[p.PID]
+		}
+	}
+
+	count := len(procs)
+	if c.Query("flat") != "true" {
+		procs = container.ProcessTree(procs)
+	}
+	if procs == nil {
+		procs = []*container.Process{}
+	}
+	c.JSON(http.StatusOK, gin.H{"processes": procs, "count": count})
+}
+
+// SignalProcessRequest sends a signal to a process, and optionally to every
+// process it started
+type SignalProcessRequest struct {
+	Signal string `json:"signal"` // Default TERM
+	Tree   bool   `json:"tree"`
+}
+
+// SignalProcess sends a signal to a process in a container
+// POST /api/containers/:id/processes/:pid/signal
+func (h *ContainerHandler) SignalProcess(c *gin.Context) {
+	found, ok := h.runningContainer(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil || pid <= 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pid"})
+		return
+	}
+	var req SignalProcessRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	signal, err := container.NormalizeSignal(req.Signal)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	procs, err := h.manager.ListProcesses(ctx, found.DockerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+	pids := container.DescendantPIDs(procs, pid)
+	if len(pids) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "process not found"})
+		return
+	}
+	if !req.Tree {
+		pids = pids[:1]
+	}
+
+	if err := h.manager.SignalProcesses(ctx, found.DockerID, pids, signal); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "signal sent", "signal": signal, "pids": pids})
+}
+
+// ListServices lists a container's services with their current state
+// GET /api/containers/:id/services
+func (h *ContainerHandler) ListServices(c *gin.Context) {
+	ctx := c.Request.Context()
+	found, err := h.store.GetContainerByUserAndDockerID(ctx, c.GetString("userID"), c.Param("id"))
+	if err != nil || found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+
+	services, err := h.store.GetContainerServices(ctx, found.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch services"})
+		return
+	}
+	result := make([]serviceResponse, 0, len(services))
+	for _, svc := range services {
+		result = append(result, newServiceResponse(svc))
+	}
+	c.JSON(http.StatusOK, gin.H{"services": result, "limit": models.MaxServicesPerContainer})
+}
+
+// ServiceRequest declares a service. On update, omitted fields are kept.
+type ServiceRequest struct {
+	Name          string             `json:"name"`
+	Command       *string            `json:"command"`
+	WorkDir       *string            `json:"workdir"`
+	Env           *map[string]string `json:"env"`
+	RestartPolicy *string            `json:"restart_policy"`
+}
+
+// apply copies the fields set in the request onto svc
+func (r *ServiceRequest) apply(svc *models.ContainerService) {
+	if r.Command != nil {
+		svc.Command = *r.Command
+	}
+	if r.WorkDir != nil {
+		svc.WorkDir = *r.WorkDir
+	}
+	if r.Env != nil {
+		svc.Env = *r.Env
+	}
+	if r.RestartPolicy != nil {
+		svc.RestartPolicy = *r.RestartPolicy
+	}
+}
+
+// CreateService declares a service and starts it
+// POST /api/containers/:id/services
+func (h *ContainerHandler) CreateService(c *gin.Context) {
+	found, ok := h.runningContainer(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	var req ServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	svc := &models.ContainerService{
+		ID:          uuid.New().String(),
+		ContainerID: found.ID,
+		DockerID:    found.DockerID,
+		UserID:      found.UserID,
+		Name:        req.Name,
+		Enabled:     true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ServiceState: models.ServiceState{
+			Status: models.ServiceStatusStarting,
+		},
+	}
+	req.apply(svc)
+	if err := svc.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.store.GetContainerServices(ctx, found.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch services"})
+		return
+	}
+	if len(existing) >= models.MaxServicesPerContainer {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("a terminal can have at most %d services", models.MaxServicesPerContainer)})
+		return
+	}
+	for _, other := range existing {
+		if other.Name == svc.Name {
+			c.JSON(http.StatusConflict, gin.H{"error": "a service with this name already exists"})
+			return
+		}
+	}
+
+	if err := h.store.CreateContainerService(ctx, svc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save service"})
+		return
+	}
+	h.kickServices()
+	h.ServiceChanged(svc)
+
+	c.JSON(http.StatusCreated, newServiceResponse(svc))
+}
+
+// findService finds one of the caller's services by container and name. It
+// writes the error response itself.
+func (h *ContainerHandler) findService(c *gin.Context) (*models.ContainerService, bool) {
+	ctx := c.Request.Context()
+	found, err := h.store.GetContainerByUserAndDockerID(ctx, c.GetString("userID"), c.Param("id"))
+	if err != nil || found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return nil, false
+	}
+	services, err := h.store.GetContainerServices(ctx, found.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch services"})
+		return nil, false
+	}
+	for _, svc := range services {
+		if svc.Name == c.Param("name") {
+			return svc, true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "service not found"})
+	return nil, false
+}
+
+// UpdateService changes a service's definition and restarts it if it's enabled
+// PATCH /api/containers/:id/services/:name
+func (h *ContainerHandler) UpdateService(c *gin.Context) {
+	svc, ok := h.findService(c)
+	if !ok {
+		return
+	}
+
+	var req ServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != "" && req.Name != svc.Name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "services can't be renamed"})
+		return
+	}
+	req.apply(svc)
+	if err := svc.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.restartService(c, svc, svc.Enabled)
+}
+
+// StartService enables a stopped service
+// POST /api/containers/:id/services/:name/start
+func (h *ContainerHandler) StartService(c *gin.Context) {
+	svc, ok := h.findService(c)
+	if !ok {
+		return
+	}
+	if svc.Enabled && svc.Status != models.ServiceStatusExited && svc.Status != models.ServiceStatusFailed {
+		c.JSON(http.StatusOK, newServiceResponse(svc))
+		return
+	}
+	h.restartService(c, svc, true)
+}
+
+// RestartService stops a service's processes and starts it again
+// POST /api/containers/:id/services/:name/restart
+func (h *ContainerHandler) RestartService(c *gin.Context) {
+	svc, ok := h.findService(c)
+	if !ok {
+		return
+	}
+	h.restartService(c, svc, true)
+}
+
+// restartService saves svc as a new generation, so the supervisor starts it
+// afresh rather than treating its exit as a crash, then stops what's running
+func (h *ContainerHandler) restartService(c *gin.Context, svc *models.ContainerService, enabled bool) {
+	ctx := c.Request.Context()
+
+	svc.Enabled = enabled
+	svc.Generation++
+	svc.UpdatedAt = time.Now()
+	if err := h.store.UpdateContainerService(ctx, svc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save service"})
+		return
+	}
+
+	if err := h.manager.StopServiceProcess(ctx, svc); err != nil {
+		log.Printf("[Services] Failed to stop %s in %s: %v", svc.Name, svc.DockerID, err)
+	}
+	if enabled {
+		svc.ServiceState = models.ServiceState{Status: models.ServiceStatusStarting}
+	} else {
+		svc.ServiceState = models.ServiceState{Status: models.ServiceStatusStopped, Restarts: svc.Restarts, ExitCode: svc.ExitCode}
+	}
+	if err := h.store.UpdateContainerServiceState(ctx, svc.ID, svc.ServiceState); err != nil {
+		log.Printf("[Services] Failed to save state of %s: %v", svc.Name, err)
+	}
+	h.kickServices()
+	h.ServiceChanged(svc)
+
+	c.JSON(http.StatusOK, newServiceResponse(svc))
+}
+
+// StopService stops a service and keeps it from being restarted until it's started again
+// POST /api/containers/:id/services/:name/stop
+func (h *ContainerHandler) StopService(c *gin.Context) {
+	svc, ok := h.findService(c)
+	if !ok {
+		return
+	}
+	h.restartService(c, svc, false)
+}
+
+// DeleteService stops a service and forgets it. Its log is kept.
+// DELETE /api/containers/:id/services/:name
+func (h *ContainerHandler) DeleteService(c *gin.Context) {
+	svc, ok := h.findService(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	// Deleted first, so the supervisor doesn't restart it
+	if err := h.store.DeleteContainerService(ctx, svc.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete service"})
+		return
+	}
+	if err := h.manager.StopServiceProcess(ctx, svc); err != nil {
+		log.Printf("[Services] Failed to stop %s in %s: %v", svc.Name, svc.DockerID, err)
+	}
+	svc.ServiceState = models.ServiceState{Status: models.ServiceStatusStopped}
+	h.ServiceChanged(svc)
+
+	c.JSON(http.StatusOK, gin.H{"message": "service deleted", "name": svc.Name})
+}
+
+// ServiceLogs returns the end of a service's log, or with ?follow=true
+// streams it as Server-Sent Events ({"line": "..."}) until the client leaves.
+// ?tail sets how many lines to start from (default 200).
+// GET /api/containers/:id/services/:name/logs
+func (h *ContainerHandler) ServiceLogs(c *gin.Context) {
+	svc, ok := h.findService(c)
+	if !ok {
+		return
+	}
+	if svc.DockerID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "container is not running"})
+		return
+	}
+
+	tail := 200
+	if v := c.Query("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tail must be a non-negative number"})
+			return
+		}
+		tail = min(n, maxServiceLogLines)
+	}
+	logPath := container.ServiceLogPath(svc.Name)
+
+	if c.Query("follow") != "true" {
+		output, err := h.manager.ExecOutput(c.Request.Context(), svc.DockerID,
+			[]string{"/bin/sh", "-c", `[ ! -f "$1" ] || tail -n "$2" "$1"`, "rexec-logs", logPath, strconv.Itoa(tail)})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+			return
+		}
+		lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+		if output == "" {
+			lines = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{"name": svc.Name, "lines": lines})
+		return
+	}
+
+	h.followServiceLogs(c, svc.DockerID, logPath, tail)
+}
+
+// followServiceLogs streams a log with tail -F. The tail process reports its
+// PID first so it can be stopped when the client disconnects.
+func (h *ContainerHandler) followServiceLogs(c *gin.Context, dockerID, logPath string, tail int) {
+	ctx := c.Request.Context()
+	client := h.manager.GetClient()
+
+	execResp, err := client.ContainerExecCreate(ctx, dockerID, dockerContainer.ExecOptions{
+		Cmd:          []string{"/bin/sh", "-c", `echo "$$"; exec tail -n "$2" -F "$1" 2>/dev/null`, "rexec-logs", logPath, strconv.Itoa(tail)},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+	attachResp, err := client.ContainerExecAttach(ctx, execResp.ID, dockerContainer.ExecAttachOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+	defer attachResp.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Writer.WriteHeader(200)
+	c.Writer.Write([]byte(": stream connected\n\n"))
+	c.Writer.Flush()
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, attachResp.Reader)
+		pw.CloseWithError(err)
+	}()
+
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var tailPID int
+	if scanner.Scan() {
+		tailPID, _ = strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	}
+	stop := context.AfterFunc(ctx, func() {
+		attachResp.Close()
+		if tailPID > 1 {
+			stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			h.manager.SignalProcesses(stopCtx, dockerID, []int{tailPID}, "TERM")
+		}
+	})
+	defer stop()
+
+	for scanner.Scan() {
+		data, _ := json.Marshal(gin.H{"line": scanner.Text()})
+		c.Writer.Write([]byte("data: " + string(data) + "\n\n"))
+		c.Writer.Flush()
+	}
+}
+
+func (h *ContainerHandler) kickServices() {
+	if h.services != nil {
+		h.services.Kick()
+	}
+}
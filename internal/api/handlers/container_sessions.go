@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/container"
+)
+
+// CreatePTYSessionRequest starts a named shell in a terminal
+type CreatePTYSessionRequest struct {
+	Name  string            `json:"name"`
+	Shell string            `json:"shell"` // Default: the terminal's detected shell
+	Cwd   string            `json:"cwd"`
+	Env   map[string]string `json:"env"`
+	Cols  int               `json:"cols"`
+	Rows  int               `json:"rows"`
+}
+
+// ptySessionError writes the response for a named session error
+func ptySessionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, container.ErrTmuxUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, container.ErrPTYSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+	}
+}
+
+// ListPTYSessions lists the named shells running in a terminal
+// GET /api/containers/:id/sessions
+func (h *ContainerHandler) ListPTYSessions(c *gin.Context) {
+	found, ok := h.runningContainer(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.manager.ListPTYSessions(c.Request.Context(), found.DockerID)
+	if err != nil {
+		ptySessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions, "count": len(sessions)})
+}
+
+// CreatePTYSession starts a named shell that clients attach to with
+// ?session=<id> on the terminal WebSocket
+// POST /api/containers/:id/sessions
+func (h *ContainerHandler) CreatePTYSession(c *gin.Context) {
+	found, ok := h.runningContainer(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	var req CreatePTYSessionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	cfg := container.PTYSessionConfig{
+		Name:  req.Name,
+		Shell: req.Shell,
+		Cwd:   req.Cwd,
+		Env:   req.Env,
+		Cols:  req.Cols,
+		Rows:  req.Rows,
+	}
+	if cfg.Shell == "" {
+		if shell, _, setupDone, err := h.store.GetContainerShellMetadata(ctx, found.ID); err == nil && setupDone && shell != "" {
+			cfg.Shell = shell
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.manager.ListPTYSessions(ctx, found.DockerID)
+	if err != nil {
+		ptySessionError(c, err)
+		return
+	}
+	if len(existing) >= container.MaxPTYSessions {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "session limit reached for this terminal",
+			"limit": container.MaxPTYSessions,
+		})
+		return
+	}
+
+	session, err := h.manager.CreatePTYSession(ctx, found.DockerID, cfg)
+	if err != nil {
+		ptySessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, session)
+}
+
+// DeletePTYSession ends a named shell and everything running in it
+// DELETE /api/containers/:id/sessions/:sessionId
+func (h *ContainerHandler) DeletePTYSession(c *gin.Context) {
+	found, ok := h.runningContainer(c)
+	if !ok {
+		return
+	}
+
+	if err := h.manager.KillPTYSession(c.Request.Context(), found.DockerID, c.Param("sessionId")); err != nil {
+		ptySessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session ended"})
+}
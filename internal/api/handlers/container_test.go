@@ -83,6 +83,10 @@ func TestIsValidDockerImage(t *testing.T) {
 		{"Invalid char", "ubuntu!", false},
 		{"Too many colons", "ubuntu:latest:extra", false},
 		{"Empty name", ":latest", false},
+		{"Snapshot image", "rexec-snapshots:0b7c9c1e-4f6a-4c1f-9a52-7d1e2f3a4b5c", false},
+		{"Qualified snapshot image", "docker.io/library/rexec-snapshots:0b7c9c1e", false},
+		{"Qualified build image", "docker.io/rexec-builds/user-1:go", false},
+		{"Built image", "rexec-builds/user-1:go-toolchain", false},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// imageBuildTimeout bounds cloning plus building one image
+const imageBuildTimeout = 30 * time.Minute
+
+// imageBuildLogLines is how much build output is kept with a build record
+const imageBuildLogLines = 200
+
+// imageBuildSem bounds concurrent image builds; builds are far heavier than creates
+var imageBuildSem = make(chan struct{}, 2)
+
+// ImageBuildResponse is a build record plus the image reference to create terminals with
+type ImageBuildResponse struct {
+	*storage.ImageBuildRecord
+	Image string `json:"image"` // e.g. "build:go-toolchain"
+	Log   string `json:"log,omitempty"`
+}
+
+func newImageBuildResponse(b *storage.ImageBuildRecord, withLog bool) ImageBuildResponse {
+	resp := ImageBuildResponse{ImageBuildRecord: b, Image: models.BuildImagePrefix + b.Name}
+	if withLog {
+		resp.Log = b.Log
+	}
+	return resp
+}
+
+// BuildImage starts building an image from a Dockerfile or git repository.
+// The build runs in the background; output is reported over the events WebSocket.
+// POST /api/images/builds
+func (h *ContainerHandler) BuildImage(c *gin.Context) {
+	build, req, ok := h.prepareImageBuild(c)
+	if !ok {
+		return
+	}
+
+	tier, subscriptionActive := c.GetString("tier"), c.GetBool("subscription_active")
+	go func() {
+		h.runImageBuild(build, req, tier, subscriptionActive, func(event container.ProgressEvent) {
+			if h.eventsHub != nil {
+				h.eventsHub.NotifyImageBuildProgress(build.UserID, gin.H{
+					"build_id": build.ID,
+					"name":     build.Name,
+					"event":    event,
+				})
+			}
+		})
+		if h.eventsHub != nil {
+			h.eventsHub.NotifyImageBuildUpdated(build.UserID, newImageBuildResponse(build, false))
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, newImageBuildResponse(build, false))
+}
+
+// BuildImageWithProgress builds an image, streaming the build output as
+// Server-Sent Events in the same format as container creation
+// POST /api/images/builds/stream
+func (h *ContainerHandler) BuildImageWithProgress(c *gin.Context) {
+	build, req, ok := h.prepareImageBuild(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Writer.WriteHeader(200)
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	sendEvent := func(event container.ProgressEvent) {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		data, _ := json.Marshal(event)
+		padding := ": padding " + strings.Repeat(".", 256) + "\n"
+		c.Writer.Write([]byte(padding))
+		c.Writer.Write([]byte("data: " + string(data) + "\n\n"))
+		c.Writer.Flush()
+	}
+
+	c.Writer.Write([]byte(": stream connected\n\n"))
+	c.Writer.Flush()
+
+	// The build isn't tied to the request, so it still finishes if the client disconnects
+	h.runImageBuild(build, req, c.GetString("tier"), c.GetBool("subscription_active"), sendEvent)
+
+	if h.eventsHub != nil {
+		h.eventsHub.NotifyImageBuildUpdated(build.UserID, newImageBuildResponse(build, false))
+	}
+	if build.Status != "ready" {
+		sendEvent(container.ProgressEvent{
+			Stage:    "building",
+			Error:    build.Error,
+			Complete: true,
+		})
+		return
+	}
+	sendEvent(container.ProgressEvent{
+		Stage:    "ready",
+		Message:  "Image ready",
+		Progress: 100,
+		Detail:   models.BuildImagePrefix + build.Name,
+		Complete: true,
+	})
+}
+
+// prepareImageBuild validates a build request against the caller's quota and
+// records the build. It writes the error response itself.
+func (h *ContainerHandler) prepareImageBuild(c *gin.Context) (*storage.ImageBuildRecord, *models.ImageBuildRequest, bool) {
+	userID := c.GetString("userID")
+	tier := c.GetString("tier")
+	subscriptionActive := c.GetBool("subscription_active")
+
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, nil, false
+	}
+
+	var req models.ImageBuildRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	ctx := c.Request.Context()
+	existing, err := h.store.GetImageBuildByName(ctx, userID, req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch image builds"})
+		return nil, nil, false
+	}
+	if existing != nil && existing.Status == "building" {
+		c.JSON(http.StatusConflict, gin.H{"error": "image is already being built", "id": existing.ID})
+		return nil, nil, false
+	}
+
+	// Enforce per-tier image quota; rebuilding an image doesn't take a new slot
+	limits := models.GetUserResourceLimits(tier, subscriptionActive)
+	if existing == nil || existing.Status == "error" {
+		count, err := h.store.CountImageBuildsByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check image limit"})
+			return nil, nil, false
+		}
+		if count >= limits.MaxImages {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "image limit reached",
+				"current": count,
+				"limit":   limits.MaxImages,
+				"tier":    tier,
+				"message": "Delete an existing image or upgrade your plan to build more images",
+			})
+			return nil, nil, false
+		}
+	}
+
+	build := &storage.ImageBuildRecord{
+		ID:             uuid.New().String(),
+		UserID:         userID,
+		Name:           req.Name,
+		ImageTag:       container.BuildImageTag(userID, req.Name),
+		Dockerfile:     req.Dockerfile,
+		SourceRepo:     req.RepoURL,
+		SourceRef:      req.Ref,
+		SourcePath:     req.Path,
+		DockerfilePath: req.DockerfilePath,
+		Status:         "building",
+		CreatedAt:      time.Now(),
+	}
+	if err := h.store.SaveImageBuild(ctx, build); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create image build record"})
+		return nil, nil, false
+	}
+	return build, &req, true
+}
+
+// runImageBuild clones and builds an image, records the result on build and
+// in the store, and passes the build output to onProgress
+func (h *ContainerHandler) runImageBuild(build *storage.ImageBuildRecord, req *models.ImageBuildRequest, tier string, subscriptionActive bool, onProgress func(container.ProgressEvent)) {
+	ctx, cancel := context.WithTimeout(context.Background(), imageBuildTimeout)
+	defer cancel()
+
+	var logLines []string
+	progressCh := make(chan container.ProgressEvent, 100)
+	relayed := make(chan struct{})
+	go func() {
+		defer close(relayed)
+		for event := range progressCh {
+			if event.Detail != "" {
+				logLines = append(logLines, event.Detail)
+				if len(logLines) > imageBuildLogLines {
+					logLines = logLines[len(logLines)-imageBuildLogLines:]
+				}
+			}
+			onProgress(event)
+		}
+	}()
+
+	result, err := h.buildImage(ctx, build, req, tier, subscriptionActive, progressCh)
+	close(progressCh)
+	<-relayed
+	buildLog := strings.Join(logLines, "\n")
+
+	if err != nil {
+		log.Printf("[ImageBuild] Failed to build %s: %v", build.ImageTag, err)
+		build.Status = "error"
+		build.Error = container.SanitizeError(err)
+		h.store.MarkImageBuildFailed(ctx, build.ID, build.Error, buildLog)
+		return
+	}
+
+	build.Status = "ready"
+	build.SizeBytes = result.SizeBytes
+	build.CachedSteps = result.CachedSteps
+	if err := h.store.MarkImageBuildReady(ctx, build.ID, result.SizeBytes, result.CachedSteps, buildLog); err != nil {
+		log.Printf("[ImageBuild] Failed to record build %s: %v", build.ID, err)
+	}
+	log.Printf("[ImageBuild] Built %s (%d bytes, %d/%d steps cached)", build.ImageTag, result.SizeBytes, result.CachedSteps, result.Steps)
+}
+
+// buildImage waits for a build slot, checks out the repository if there is
+// one and runs the build
+func (h *ContainerHandler) buildImage(ctx context.Context, build *storage.ImageBuildRecord, req *models.ImageBuildRequest, tier string, subscriptionActive bool, progressCh chan<- container.ProgressEvent) (*container.BuildResult, error) {
+	select {
+	case imageBuildSem <- struct{}{}:
+	default:
+		progressCh <- container.ProgressEvent{Stage: "building", Message: "Waiting for a build slot..."}
+		select {
+		case imageBuildSem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, errors.New("timed out waiting for a build slot")
+		}
+	}
+	defer func() { <-imageBuildSem }()
+
+	limits := models.GetUserResourceLimits(tier, subscriptionActive)
+	cfg := container.BuildConfig{
+		BuildID:        build.ID,
+		UserID:         build.UserID,
+		Tier:           tier,
+		Tag:            build.ImageTag,
+		Dockerfile:     req.Dockerfile,
+		DockerfilePath: req.DockerfilePath,
+		NoCache:        req.NoCache,
+		MemoryMB:       limits.MemoryMB,
+		CPUMillicores:  limits.CPUShares,
+		MaxSizeBytes:   limits.ImageSizeMB * 1024 * 1024,
+	}
+
+	if req.RepoURL != "" {
+		progressCh <- container.ProgressEvent{Stage: "building", Message: "Cloning repository...", Detail: req.RepoURL}
+		root, cleanup, err := cloneGitRepo(ctx, req.RepoURL, req.Ref)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+
+		contextDir := root
+		if req.Path != "" {
+			if contextDir, err = resolveRepoPath(root, req.Path); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.DockerfilePath == "" {
+			cfg.DockerfilePath = "Dockerfile"
+		}
+		if req.Dockerfile == "" {
+			if _, err := resolveRepoPath(contextDir, cfg.DockerfilePath); err != nil {
+				return nil, err
+			}
+		}
+		cfg.ContextDir = contextDir
+		cfg.DockerfilePath = filepath.ToSlash(filepath.Clean(cfg.DockerfilePath))
+	}
+
+	return h.manager.BuildImage(ctx, cfg, progressCh)
+}
+
+// ListImageBuilds returns the caller's image builds along with quota usage
+// GET /api/images/builds
+func (h *ContainerHandler) ListImageBuilds(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	builds, err := h.store.GetImageBuildsByUserID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch image builds"})
+		return
+	}
+	response := make([]ImageBuildResponse, 0, len(builds))
+	for _, b := range builds {
+		response = append(response, newImageBuildResponse(b, false))
+	}
+
+	limits := models.GetUserResourceLimits(c.GetString("tier"), c.GetBool("subscription_active"))
+	c.JSON(http.StatusOK, gin.H{
+		"builds":        response,
+		"limit":         limits.MaxImages,
+		"image_size_mb": limits.ImageSizeMB,
+	})
+}
+
+// GetImageBuild returns a build with the tail of its output
+// GET /api/images/builds/:id
+func (h *ContainerHandler) GetImageBuild(c *gin.Context) {
+	build, ok := h.findImageBuild(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newImageBuildResponse(build, true))
+}
+
+// DeleteImageBuild removes a built image. Terminals created from it keep running.
+// DELETE /api/images/builds/:id
+func (h *ContainerHandler) DeleteImageBuild(c *gin.Context) {
+	build, ok := h.findImageBuild(c)
+	if !ok {
+		return
+	}
+	if build.Status == "building" {
+		c.JSON(http.StatusConflict, gin.H{"error": "image is still being built"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if build.Status == "ready" {
+		if err := h.manager.DeleteBuildImage(ctx, build.ImageTag); err != nil {
+			log.Printf("[ImageBuild] Failed to remove image %s: %v", build.ImageTag, err)
+		}
+	}
+	if err := h.store.DeleteImageBuild(ctx, build.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete image build"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "image deleted"})
+}
+
+// findImageBuild looks up the caller's build from the :id param
+func (h *ContainerHandler) findImageBuild(c *gin.Context) (*storage.ImageBuildRecord, bool) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	build, err := h.store.GetImageBuildByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch image build"})
+		return nil, false
+	}
+	if build == nil || build.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image build not found"})
+		return nil, false
+	}
+	return build, true
+}
+
+// resolveBuildImage returns the tag of the caller's built image name, with
+// the HTTP status to fail with otherwise
+func (h *ContainerHandler) resolveBuildImage(ctx context.Context, userID, name string) (string, int, error) {
+	build, err := h.store.GetImageBuildByName(ctx, userID, name)
+	if err != nil {
+		return "", http.StatusInternalServerError, errors.New("failed to fetch image build")
+	}
+	if build == nil {
+		return "", http.StatusNotFound, fmt.Errorf("image build %q not found", name)
+	}
+	if build.Status != "ready" {
+		return "", http.StatusConflict, fmt.Errorf("image build %q is not ready (%s)", name, build.Status)
+	}
+	return build.ImageTag, http.StatusOK, nil
+}
+
+// buildImageMetadata lists the caller's ready builds for the image picker
+func (h *ContainerHandler) buildImageMetadata(ctx context.Context, userID string) []container.ImageMetadata {
+	if userID == "" || h.store == nil {
+		return nil
+	}
+	builds, err := h.store.GetImageBuildsByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("[ImageBuild] Failed to load builds for %s: %v", userID, err)
+		return nil
+	}
+	var images []container.ImageMetadata
+	for _, b := range builds {
+		if b.Status != "ready" {
+			continue
+		}
+		source := "Dockerfile"
+		if b.SourceRepo != "" {
+			source = b.SourceRepo
+		}
+		images = append(images, container.ImageMetadata{
+			Name:        models.BuildImagePrefix + b.Name,
+			DisplayName: b.Name,
+			Description: "Built from " + source,
+			Category:    "builds",
+			Tags:        []string{"custom"},
+		})
+	}
+	return images
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// defaultMetricsRange is how far back a metrics query without from reaches
+const defaultMetricsRange = time.Hour
+
+// GetMetrics returns a container's resource usage history
+// GET /api/containers/:id/metrics?from=&to=&step=
+func (h *ContainerHandler) GetMetrics(c *gin.Context) {
+	found, err := h.store.GetContainerByUserAndDockerID(c.Request.Context(), c.GetString("userID"), c.Param("id"))
+	if err != nil || found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+	writeMetrics(c, h.store, models.MetricsSourceContainer, found.ID)
+}
+
+// GetAgentMetrics returns the resource usage history of an agent's host
+// GET /api/agents/:id/metrics?from=&to=&step=
+func (h *AgentHandler) GetAgentMetrics(c *gin.Context) {
+	agent, err := h.store.GetAgent(c.Request.Context(), c.Param("id"))
+	if err != nil || agent == nil || agent.UserID != c.GetString("userID") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	writeMetrics(c, h.store, models.MetricsSourceAgent, agent.ID)
+}
+
+// recordAgentStats stores an agent's stats report as a metrics sample, at
+// most once per sample interval
+func (h *AgentHandler) recordAgentStats(agentConn *AgentConnection, stats map[string]interface{}) {
+	now := time.Now()
+	if now.Sub(agentConn.metricsAt) < models.MetricsSampleInterval {
+		return
+	}
+	agentConn.metricsAt = now
+
+	number := func(key string) float64 {
+		v, _ := stats[key].(float64)
+		return v
+	}
+	sample := models.MetricSample{
+		Time:        now,
+		CPUPercent:  number("cpu_percent"),
+		Memory:      int64(number("memory")),
+		MemoryLimit: int64(number("memory_limit")),
+		DiskUsage:   int64(number("disk_usage")),
+		DiskLimit:   int64(number("disk_limit")),
+	}
+	if err := h.store.RecordAgentMetrics(context.Background(), agentConn.ID, sample); err != nil {
+		log.Printf("Failed to record metrics for agent %s: %v", agentConn.ID, err)
+	}
+}
+
+// writeMetrics answers a metrics query for a source
+func writeMetrics(c *gin.Context, store *storage.PostgresStore, sourceType, sourceID string) {
+	now := time.Now()
+	from, to, step, err := parseMetricsQuery(c, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tier, step, err := models.PlanMetricsQuery(from, to, step, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Start on a step boundary so the first point covers a whole step
+	stepSeconds := int64(step.Seconds())
+	from = time.Unix(from.Unix()/stepSeconds*stepSeconds, 0).UTC()
+
+	points, err := store.GetMetrics(c.Request.Context(), sourceType, sourceID, tier, from, to, step)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load metrics"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":       from,
+		"to":         to.UTC(),
+		"step":       stepSeconds,
+		"resolution": int64(tier.Step().Seconds()),
+		"points":     points,
+	})
+}
+
+// parseMetricsQuery reads ?from=&to=&step=. Times are RFC 3339, Unix
+// seconds or a negative duration from now such as "-24h"; to defaults to now
+// and from to an hour before it. step is a duration ("5m") or seconds, and
+// is left zero when not given.
+func parseMetricsQuery(c *gin.Context, now time.Time) (from, to time.Time, step time.Duration, err error) {
+	to = now
+	if v := c.Query("to"); v != "" {
+		if to, err = parseMetricsTime(v, now); err != nil {
+			return from, to, 0, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	from = to.Add(-defaultMetricsRange)
+	if v := c.Query("from"); v != "" {
+		if from, err = parseMetricsTime(v, now); err != nil {
+			return from, to, 0, fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if v := c.Query("step"); v != "" {
+		if seconds, convErr := strconv.ParseInt(v, 10, 64); convErr == nil {
+			step = time.Duration(seconds) * time.Second
+		} else if step, err = time.ParseDuration(v); err != nil {
+			return from, to, 0, fmt.Errorf("invalid step: use a duration such as 5m or a number of seconds")
+		}
+		if step <= 0 {
+			return from, to, 0, fmt.Errorf("invalid step: must be positive")
+		}
+	}
+	return from, to, step, nil
+}
+
+func parseMetricsTime(value string, now time.Time) (time.Time, error) {
+	if strings.HasPrefix(value, "-") {
+		if d, err := time.ParseDuration(value[1:]); err == nil {
+			return now.Add(-d), nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use RFC 3339, Unix seconds or a duration ago such as -24h")
+	}
+	return t, nil
+}
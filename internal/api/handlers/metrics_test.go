@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseMetricsQuery(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantStep time.Duration
+		wantErr  bool
+	}{
+		{"Defaults", "", now.Add(-time.Hour), now, 0, false},
+		{"Relative from", "?from=-24h&step=5m", now.Add(-24 * time.Hour), now, 5 * time.Minute, false},
+		{"Absolute range", "?from=2026-03-09T00:00:00Z&to=1773057600&step=600", time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 9, 12, 0, 0, 0, time.UTC), 10 * time.Minute, false},
+		{"From defaults to an hour before to", "?to=-2h", now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), 0, false},
+		{"Bad from", "?from=yesterday", time.Time{}, time.Time{}, 0, true},
+		{"Bad step", "?step=often", time.Time{}, time.Time{}, 0, true},
+		{"Zero step", "?step=0", time.Time{}, time.Time{}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/containers/abc/metrics"+tt.query, nil)
+
+			from, to, step, err := parseMetricsQuery(c, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMetricsQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) || step != tt.wantStep {
+				t.Errorf("parseMetricsQuery() = %v, %v, %v; want %v, %v, %v", from, to, step, tt.wantFrom, tt.wantTo, tt.wantStep)
+			}
+		})
+	}
+}
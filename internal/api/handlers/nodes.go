@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// NodeHandler manages the Docker hosts terminals are placed on
+type NodeHandler struct {
+	store   *storage.PostgresStore
+	pool    *container.NodePool
+	monitor *container.NodeMonitor
+}
+
+// NewNodeHandler creates a new NodeHandler
+func NewNodeHandler(store *storage.PostgresStore, manager *container.Manager, monitor *container.NodeMonitor) *NodeHandler {
+	return &NodeHandler{store: store, pool: manager.NodePool(), monitor: monitor}
+}
+
+// RegisterNodeRequest adds a node
+type RegisterNodeRequest struct {
+	ID            string            `json:"id" binding:"required"`
+	Host          string            `json:"host" binding:"required"`
+	CertPath      string            `json:"cert_path"`
+	Labels        map[string]string `json:"labels"`
+	CPUMillicores int64             `json:"cpu_millicores"`
+	MemoryMB      int64             `json:"memory_mb"`
+}
+
+// UpdateNodeRequest changes a node; omitted fields are left alone
+type UpdateNodeRequest struct {
+	Host          *string            `json:"host"`
+	CertPath      *string            `json:"cert_path"`
+	Labels        *map[string]string `json:"labels"`
+	CPUMillicores *int64             `json:"cpu_millicores"`
+	MemoryMB      *int64             `json:"memory_mb"`
+	Status        *string            `json:"status"` // active, cordoned or draining
+}
+
+// List returns every node with its health and allocation
+// GET /api/admin/nodes
+func (h *NodeHandler) List(c *gin.Context) {
+	if err := h.monitor.Refresh(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch nodes"})
+		return
+	}
+	nodes := h.pool.Nodes()
+	c.JSON(http.StatusOK, gin.H{"nodes": nodes, "count": len(nodes)})
+}
+
+// Register adds a node. It takes new terminals once it passes a health check.
+// POST /api/admin/nodes
+func (h *NodeHandler) Register(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req RegisterNodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	node := &models.Node{
+		ID:            req.ID,
+		Host:          req.Host,
+		CertPath:      req.CertPath,
+		Labels:        req.Labels,
+		CPUMillicores: req.CPUMillicores,
+		MemoryMB:      req.MemoryMB,
+		Status:        models.NodeActive,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if node.Labels == nil {
+		node.Labels = map[string]string{}
+	}
+	if err := node.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.store.GetNode(ctx, node.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch node"})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "a node with this id already exists"})
+		return
+	}
+	if err := h.store.SaveNode(ctx, node); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save node"})
+		return
+	}
+	h.respond(c, http.StatusCreated, node)
+}
+
+// Update changes a node's endpoint, labels, capacity or status. Cordoned
+// nodes keep their terminals but take no new ones; draining nodes also have
+// their stopped terminals moved off.
+// PATCH /api/admin/nodes/:id
+func (h *NodeHandler) Update(c *gin.Context) {
+	var req UpdateNodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	node, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+
+	if req.Host != nil {
+		node.Host = *req.Host
+	}
+	if req.CertPath != nil {
+		node.CertPath = *req.CertPath
+	}
+	if req.Labels != nil {
+		node.Labels = *req.Labels
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+	}
+	if req.CPUMillicores != nil {
+		node.CPUMillicores = *req.CPUMillicores
+	}
+	if req.MemoryMB != nil {
+		node.MemoryMB = *req.MemoryMB
+	}
+	if req.Status != nil {
+		node.Status = *req.Status
+	}
+	h.save(c, node)
+}
+
+// Drain stops new terminals going to a node and moves its stopped
+// terminals, with their volumes, to other nodes. Running terminals are
+// moved once they stop.
+// POST /api/admin/nodes/:id/drain
+func (h *NodeHandler) Drain(c *gin.Context) {
+	node, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	node.Status = models.NodeDraining
+	h.save(c, node)
+}
+
+// Delete unregisters a node. Nodes still holding terminals must be drained
+// first; ?force=true removes a node that can't be reached.
+// DELETE /api/admin/nodes/:id
+func (h *NodeHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	node, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	if node.ID == models.DefaultNodeID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the default node can't be removed"})
+		return
+	}
+	if status, ok := h.pool.Node(node.ID); ok && (status.Health.Containers > 0 || (!status.Health.Healthy && c.Query("force") != "true")) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "node still has terminals or can't be reached; drain it first",
+			"containers": status.Health.Containers,
+		})
+		return
+	}
+	if err := h.store.DeleteNode(ctx, node.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete node"})
+		return
+	}
+	if err := h.monitor.Refresh(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "node removed"})
+}
+
+// lookup loads the node named in the path, writing the error response if it can't
+func (h *NodeHandler) lookup(c *gin.Context) (*models.Node, bool) {
+	node, err := h.store.GetNode(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch node"})
+		return nil, false
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		return nil, false
+	}
+	return node, true
+}
+
+// save validates and stores a changed node
+func (h *NodeHandler) save(c *gin.Context, node *models.Node) {
+	node.UpdatedAt = time.Now()
+	if err := node.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.store.SaveNode(c.Request.Context(), node); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save node"})
+		return
+	}
+	h.respond(c, http.StatusOK, node)
+}
+
+// respond reconnects the pool to pick up a saved node and returns its status
+func (h *NodeHandler) respond(c *gin.Context, status int, node *models.Node) {
+	if err := h.monitor.Refresh(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if current, ok := h.pool.Node(node.ID); ok {
+		c.JSON(status, current)
+		return
+	}
+	// Saved, but the pool couldn't open a client for it
+	c.JSON(status, container.NodeStatus{Node: *node, Health: container.NodeHealth{Error: "failed to connect"}})
+}
+
+// NodeMigrated tells a terminal's owner it was moved to another node and
+// now has a new container ID
+func (h *ContainerHandler) NodeMigrated(record *storage.ContainerRecord, oldDockerID, nodeID string) {
+	if h.adminEventsHub != nil {
+		h.adminEventsHub.Broadcast("container_updated", record)
+	}
+	if h.eventsHub != nil {
+		h.eventsHub.NotifyContainerUpdated(record.UserID, gin.H{
+			"id":     record.DockerID,
+			"db_id":  record.ID,
+			"old_id": oldDockerID,
+			"node":   nodeID,
+		})
+	}
+}
@@ -311,6 +311,7 @@ func (h *PortForwardHandler) HandlePortForwardWebSocket(c *gin.Context) {
 
 	// Verify container status
 	containerRecord, err := h.store.GetContainerByID(c.Request.Context(), pf.ContainerID)
+	h.resumeTarget(c.Request.Context(), containerRecord)
 	if err != nil || containerRecord == nil || containerRecord.Status != string(models.StatusRunning) {
 		c.JSON(http.StatusBadRequest, models.APIError{Code: http.StatusBadRequest, Message: "target container not running"})
 		return
@@ -483,6 +484,23 @@ func getHTTPBaseURL(r *http.Request) string {
 	return fmt.Sprintf("%s://%s", scheme, r.Host)
 }
 
+// resumeTarget unpauses a forward's container if the idle policy paused it,
+// and counts the traffic as activity so it isn't paused again mid-use
+func (h *PortForwardHandler) resumeTarget(ctx context.Context, record *storage.ContainerRecord) {
+	if record == nil || record.DockerID == "" {
+		return
+	}
+	if record.Status == string(models.StatusPaused) {
+		if err := h.containerManager.UnpauseContainer(ctx, record.DockerID); err != nil {
+			log.Printf("Failed to resume paused container %s for port forward: %v", record.ID, err)
+			return
+		}
+		h.store.UpdateContainerStatus(ctx, record.ID, string(models.StatusRunning))
+		record.Status = string(models.StatusRunning)
+	}
+	h.containerManager.TouchContainer(record.DockerID)
+}
+
 // HandleHTTPProxy handles HTTP requests to proxied container ports
 // GET/POST/etc /p/:forwardId/*path
 func (h *PortForwardHandler) HandleHTTPProxy(c *gin.Context) {
@@ -501,6 +519,7 @@ func (h *PortForwardHandler) HandleHTTPProxy(c *gin.Context) {
 
 	// Verify container status
 	containerRecord, err := h.store.GetContainerByID(c.Request.Context(), pf.ContainerID)
+	h.resumeTarget(c.Request.Context(), containerRecord)
 	if err != nil || containerRecord == nil || containerRecord.Status != string(models.StatusRunning) {
 		h.renderPortForwardError(c, "Container Not Running", "The container associated with this port forward is not currently running. Please start the container and try again.", pf.ContainerPort)
 		return
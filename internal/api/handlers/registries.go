@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// RegistryHandler manages the credentials custom images are pulled with
+type RegistryHandler struct {
+	store *storage.PostgresStore
+}
+
+// NewRegistryHandler creates a new RegistryHandler
+func NewRegistryHandler(store *storage.PostgresStore) *RegistryHandler {
+	return &RegistryHandler{store: store}
+}
+
+// SaveRegistryCredentialRequest adds or replaces the credential for a registry
+type SaveRegistryCredentialRequest struct {
+	Registry string `json:"registry"` // Host; defaults to ghcr.io for ghcr credentials
+	Kind     string `json:"kind" binding:"required"`
+	Username string `json:"username"`
+	Secret   string `json:"secret" binding:"required"`
+	TokenURL string `json:"token_url"`
+}
+
+// ListRegistryCredentials returns the caller's registry credentials, without secrets
+// GET /api/registries
+func (h *RegistryHandler) ListRegistryCredentials(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	creds, err := h.store.GetRegistryCredentialsByUserID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch registry credentials"})
+		return
+	}
+	if creds == nil {
+		creds = []*models.RegistryCredential{}
+	}
+	c.JSON(http.StatusOK, gin.H{"registries": creds})
+}
+
+// SaveRegistryCredential stores a credential. A user has one credential per
+// registry, so saving one for a known registry replaces it.
+// POST /api/registries
+func (h *RegistryHandler) SaveRegistryCredential(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req SaveRegistryCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	cred := &models.RegistryCredential{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Registry:  req.Registry,
+		Kind:      req.Kind,
+		Username:  req.Username,
+		Secret:    req.Secret,
+		TokenURL:  req.TokenURL,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := cred.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := cred.ID
+	if err := h.store.SaveRegistryCredential(c.Request.Context(), cred); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save registry credential"})
+		return
+	}
+
+	status := http.StatusCreated
+	if cred.ID != id {
+		status = http.StatusOK
+	}
+	c.JSON(status, cred)
+}
+
+// DeleteRegistryCredential removes a credential. Images already pulled with
+// it stay cached, but the registry is asked again before they're reused.
+// DELETE /api/registries/:id
+func (h *RegistryHandler) DeleteRegistryCredential(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	cred, err := h.store.GetRegistryCredentialByID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch registry credential"})
+		return
+	}
+	if cred == nil || cred.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "registry credential not found"})
+		return
+	}
+
+	if err := h.store.DeleteRegistryCredential(ctx, cred.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete registry credential"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "registry credential deleted", "registry": cred.Registry})
+}
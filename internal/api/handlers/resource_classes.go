@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// ResourceClassHandler serves the resource class catalog
+type ResourceClassHandler struct {
+	store *storage.PostgresStore
+}
+
+// NewResourceClassHandler creates a new ResourceClassHandler
+func NewResourceClassHandler(store *storage.PostgresStore) *ResourceClassHandler {
+	return &ResourceClassHandler{store: store}
+}
+
+// ResourceClassResponse is a class plus whether the caller's tier may use it
+type ResourceClassResponse struct {
+	*models.ResourceClass
+	Allowed bool `json:"allowed"`
+}
+
+// SaveResourceClassRequest creates or replaces a resource class
+type SaveResourceClassRequest struct {
+	Description        string            `json:"description"`
+	CPUMillicores      int64             `json:"cpu_millicores" binding:"required"`
+	MemoryMB           int64             `json:"memory_mb" binding:"required"`
+	DiskMB             int64             `json:"disk_mb" binding:"required"`
+	PidsLimit          int64             `json:"pids_limit"` // default: 512
+	NetworkMB          int64             `json:"network_mb"`
+	BurstCPUMillicores int64             `json:"burst_cpu_millicores"`
+	BurstCredits       int64             `json:"burst_credits"`
+	Tiers              []string          `json:"tiers" binding:"required"`
+	NodeSelector       map[string]string `json:"node_selector"`
+}
+
+// List returns every class, marking the ones the caller can pick
+// GET /api/resource-classes
+func (h *ResourceClassHandler) List(c *gin.Context) {
+	classes, err := h.store.GetResourceClasses(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch resource classes"})
+		return
+	}
+
+	tier := models.ClassTier(c.GetString("tier"), c.GetBool("subscription_active"))
+	response := make([]ResourceClassResponse, 0, len(classes))
+	for _, rc := range classes {
+		response = append(response, ResourceClassResponse{ResourceClass: rc, Allowed: rc.AllowsTier(tier)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"classes": response,
+		"tier":    tier,
+		"count":   len(response),
+	})
+}
+
+// AdminList returns the whole catalog
+// GET /api/admin/resource-classes
+func (h *ResourceClassHandler) AdminList(c *gin.Context) {
+	classes, err := h.store.GetResourceClasses(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch resource classes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"classes": classes, "count": len(classes)})
+}
+
+// Save creates or replaces a class. Running terminals keep their sizes
+// until they're recreated.
+// PUT /api/admin/resource-classes/:name
+func (h *ResourceClassHandler) Save(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req SaveResourceClassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.store.GetResourceClass(ctx, c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch resource class"})
+		return
+	}
+
+	now := time.Now()
+	rc := &models.ResourceClass{
+		Name:               c.Param("name"),
+		Description:        req.Description,
+		CPUMillicores:      req.CPUMillicores,
+		MemoryMB:           req.MemoryMB,
+		DiskMB:             req.DiskMB,
+		PidsLimit:          req.PidsLimit,
+		NetworkMB:          req.NetworkMB,
+		BurstCPUMillicores: req.BurstCPUMillicores,
+		BurstCredits:       req.BurstCredits,
+		Tiers:              req.Tiers,
+		NodeSelector:       req.NodeSelector,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	if rc.PidsLimit == 0 {
+		rc.PidsLimit = models.DefaultPidsLimit
+	}
+	if existing != nil {
+		rc.CreatedAt = existing.CreatedAt
+	}
+	if err := rc.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.SaveResourceClass(ctx, rc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save resource class"})
+		return
+	}
+
+	status := http.StatusOK
+	if existing == nil {
+		status = http.StatusCreated
+	}
+	c.JSON(status, rc)
+}
+
+// Delete removes a class. Terminals created with it keep their sizes.
+// DELETE /api/admin/resource-classes/:name
+func (h *ResourceClassHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	existing, err := h.store.GetResourceClass(ctx, c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch resource class"})
+		return
+	}
+	if existing == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "resource class not found"})
+		return
+	}
+
+	if err := h.store.DeleteResourceClass(ctx, existing.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete resource class"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "resource class deleted", "name": existing.Name})
+}
+
+// lookupResourceClass returns the named class if the user's tier may use it,
+// with the HTTP status to fail with otherwise
+func lookupResourceClass(ctx context.Context, store *storage.PostgresStore, name, tier string, subscriptionActive bool) (*models.ResourceClass, int, error) {
+	rc, err := store.GetResourceClass(ctx, name)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to fetch resource class")
+	}
+	if rc == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("unknown resource class %q", name)
+	}
+	if !rc.AllowsTier(models.ClassTier(tier, subscriptionActive)) {
+		return nil, http.StatusForbidden, fmt.Errorf("resource class %q is not available on your plan", name)
+	}
+	return rc, http.StatusOK, nil
+}
+
+// containerResourceClass returns the class a container was created with, or
+// nil if it has custom sizes or its class has since been deleted
+func containerResourceClass(ctx context.Context, store *storage.PostgresStore, containerID string) *models.ResourceClass {
+	name, err := store.GetContainerResourceClass(ctx, containerID)
+	if err != nil || name == "" {
+		return nil
+	}
+	rc, err := store.GetResourceClass(ctx, name)
+	if err != nil {
+		return nil
+	}
+	return rc
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+var errRoleNotFound = errors.New("role not found")
+
+// RoleHandler manages user-defined roles
+type RoleHandler struct {
+	store *storage.PostgresStore
+}
+
+// NewRoleHandler creates a new RoleHandler
+func NewRoleHandler(store *storage.PostgresStore) *RoleHandler {
+	return &RoleHandler{store: store}
+}
+
+// SaveRoleRequest creates or replaces a custom role
+type SaveRoleRequest struct {
+	Name        string              `json:"name" binding:"required"`
+	Description string              `json:"description"`
+	Icon        string              `json:"icon"`
+	BaseRole    string              `json:"base_role"`    // Built-in role to install first
+	Packages    map[string][]string `json:"packages"`     // Keyed by distro family: all, debian, alpine, fedora, arch, suse
+	PostInstall []string            `json:"post_install"` // Run as root after packages
+	Verify      []string            `json:"verify"`       // Must all succeed for setup to pass
+	Global      bool                `json:"global"`       // Offer to every user (admins only)
+}
+
+// CustomRoleResponse is a custom role plus whether the caller may edit it
+type CustomRoleResponse struct {
+	*models.CustomRole
+	CanEdit bool `json:"can_edit"`
+}
+
+// ListCustomRoles lists the caller's roles and all global roles
+// GET /api/roles/custom
+func (h *RoleHandler) ListCustomRoles(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	roles, err := h.store.GetCustomRolesForUser(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch roles"})
+		return
+	}
+
+	isAdmin := h.isAdmin(ctx, userID)
+	response := make([]CustomRoleResponse, 0, len(roles))
+	for _, r := range roles {
+		response = append(response, CustomRoleResponse{CustomRole: r, CanEdit: canEditRole(r, userID, isAdmin)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles": response,
+		"count": len(response),
+	})
+}
+
+// GetCustomRole returns one custom role by ID or name
+// GET /api/roles/custom/:id
+func (h *RoleHandler) GetCustomRole(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	role, err := lookupCustomRole(ctx, h.store, userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CustomRoleResponse{CustomRole: role, CanEdit: canEditRole(role, userID, h.isAdmin(ctx, userID))})
+}
+
+// CreateCustomRole stores a new custom role
+// POST /api/roles/custom
+func (h *RoleHandler) CreateCustomRole(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	var req SaveRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Global && !h.isAdmin(ctx, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can create global roles"})
+		return
+	}
+
+	now := time.Now()
+	role := &models.CustomRole{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		CreatedAt: now,
+	}
+	if err := fillCustomRole(role, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.CreateCustomRole(ctx, role); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "a role with this name already exists", "name": role.Name})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save role"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CustomRoleResponse{CustomRole: role, CanEdit: true})
+}
+
+// UpdateCustomRole replaces a custom role. Owners can edit their roles and
+// admins can edit global ones.
+// PUT /api/roles/custom/:id
+func (h *RoleHandler) UpdateCustomRole(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	isAdmin := h.isAdmin(ctx, userID)
+	role, err := h.store.GetCustomRoleByID(ctx, c.Param("id"))
+	if err != nil || role == nil || !canEditRole(role, userID, isAdmin) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+
+	var req SaveRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Global && !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can create global roles"})
+		return
+	}
+
+	if err := fillCustomRole(role, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.UpdateCustomRole(ctx, role); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "a role with this name already exists", "name": role.Name})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CustomRoleResponse{CustomRole: role, CanEdit: true})
+}
+
+// DeleteCustomRole removes a custom role. Terminals already using it keep
+// their installed tools.
+// DELETE /api/roles/custom/:id
+func (h *RoleHandler) DeleteCustomRole(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	role, err := h.store.GetCustomRoleByID(ctx, c.Param("id"))
+	if err != nil || role == nil || !canEditRole(role, userID, h.isAdmin(ctx, userID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+
+	if err := h.store.DeleteCustomRole(ctx, role.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role deleted"})
+}
+
+func (h *RoleHandler) isAdmin(ctx context.Context, userID string) bool {
+	user, err := h.store.GetUserByID(ctx, userID)
+	return err == nil && user != nil && user.IsAdmin
+}
+
+// canEditRole allows owners to edit their roles and admins to edit global ones
+func canEditRole(role *models.CustomRole, userID string, isAdmin bool) bool {
+	return role.UserID == userID || (role.Global && isAdmin)
+}
+
+// fillCustomRole validates a save request and copies it onto role
+func fillCustomRole(role *models.CustomRole, req *SaveRoleRequest) error {
+	if container.IsBuiltinRole(req.Name) {
+		return fmt.Errorf("%s is a built-in role name", req.Name)
+	}
+	if req.BaseRole != "" && !container.IsBuiltinRole(req.BaseRole) {
+		return fmt.Errorf("base_role must be a built-in role, got %q", req.BaseRole)
+	}
+
+	role.Name = req.Name
+	role.Description = req.Description
+	role.Icon = req.Icon
+	role.BaseRole = req.BaseRole
+	role.Packages = req.Packages
+	role.PostInstall = req.PostInstall
+	role.Verify = req.Verify
+	role.Global = req.Global
+	role.UpdatedAt = time.Now()
+	return role.Validate()
+}
+
+// lookupCustomRole finds a custom role the user may use by ID or by name
+func lookupCustomRole(ctx context.Context, store *storage.PostgresStore, userID, idOrName string) (*models.CustomRole, error) {
+	if r, err := store.GetCustomRoleByID(ctx, idOrName); err == nil && r != nil {
+		if r.UserID == userID || r.Global {
+			return r, nil
+		}
+	}
+
+	r, err := store.GetCustomRoleByName(ctx, userID, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errRoleNotFound
+	}
+	return r, nil
+}
+
+// resolveRole checks the role in a create request. Custom roles may be
+// named by ID or name; req.Role is rewritten to the ID so the container
+// record keeps pointing at the role if it's renamed.
+func (h *ContainerHandler) resolveRole(ctx context.Context, userID string, req *models.CreateContainerRequest) error {
+	if req.Role == "" || container.IsBuiltinRole(req.Role) {
+		return nil
+	}
+	role, err := lookupCustomRole(ctx, h.store, userID, req.Role)
+	if err != nil {
+		return errRoleNotFound
+	}
+	req.Role = role.ID
+	return nil
+}
+
+// setupRole installs a built-in or custom role. progressCh may be nil; it is
+// only used by custom roles, which report each phase.
+func (h *ContainerHandler) setupRole(ctx context.Context, containerID, roleID string, progressCh chan<- container.ProgressEvent) (*container.SetupShellResponse, error) {
+	if container.IsBuiltinRole(roleID) {
+		return container.SetupRole(ctx, h.manager.GetClient(), containerID, roleID)
+	}
+	role, err := h.store.GetCustomRoleByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("%w: %s", errRoleNotFound, roleID)
+	}
+	return container.SetupCustomRole(ctx, h.manager.GetClient(), containerID, role, progressCh)
+}
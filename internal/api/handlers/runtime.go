@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/container"
 )
 
 var processStartTime = time.Now()
@@ -14,6 +15,25 @@ var processStartTime = time.Now()
 // GetRuntimeStats returns basic Go runtime memory/goroutine stats for debugging.
 // This should only be exposed to admins.
 func GetRuntimeStats(c *gin.Context) {
+	c.JSON(http.StatusOK, runtimeStats())
+}
+
+// RuntimeStatsHandler is GetRuntimeStats plus the container engine's
+// capabilities and warm pool health, if a pool is running
+func RuntimeStatsHandler(manager *container.Manager, pool *container.WarmPool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats := runtimeStats()
+		if manager != nil {
+			stats["container_runtime"] = manager.RuntimeInfo()
+		}
+		if pool != nil {
+			stats["warm_pool"] = pool.Health()
+		}
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+func runtimeStats() gin.H {
 	var ms runtime.MemStats
 	runtime.ReadMemStats(&ms)
 
@@ -22,7 +42,7 @@ func GetRuntimeStats(c *gin.Context) {
 		lastGC = time.Unix(0, int64(ms.LastGC)).UTC().Format(time.RFC3339Nano)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	return gin.H{
 		"time":       time.Now().UTC().Format(time.RFC3339Nano),
 		"uptime_sec": time.Since(processStartTime).Seconds(),
 		"go": gin.H{
@@ -54,5 +74,5 @@ func GetRuntimeStats(c *gin.Context) {
 			"gomemlimit": os.Getenv("GOMEMLIMIT"),
 			"godebug":    os.Getenv("GODEBUG"),
 		},
-	})
+	}
 }
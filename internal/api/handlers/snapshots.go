@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// snapshotTimeout bounds how long committing or restoring a snapshot may take
+const snapshotTimeout = 15 * time.Minute
+
+// CreateSnapshotRequest represents a request to snapshot a container
+type CreateSnapshotRequest struct {
+	Name string `json:"name"` // Optional - defaults to container name + timestamp
+}
+
+// RestoreSnapshotRequest represents a request to restore a snapshot into an existing container
+type RestoreSnapshotRequest struct {
+	ContainerID string `json:"container_id" binding:"required"` // Docker ID or DB ID of the target terminal
+}
+
+// findUserContainer looks up a user's container by Docker ID or DB ID
+func (h *ContainerHandler) findUserContainer(ctx context.Context, userID, id string) (*storage.ContainerRecord, error) {
+	records, err := h.store.GetContainersByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.DockerID == id || record.ID == id {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateSnapshot commits a container and its home volume to a new snapshot.
+// The snapshot is taken in the background; progress is reported over the events WebSocket.
+func (h *ContainerHandler) CreateSnapshot(c *gin.Context) {
+	userID := c.GetString("userID")
+	tier := c.GetString("tier")
+	subscriptionActive := c.GetBool("subscription_active")
+
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateSnapshotRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+
+	found, err := h.findUserContainer(ctx, userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify container ownership"})
+		return
+	}
+	if found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+	if found.DockerID == "" || !h.manager.DockerContainerExists(ctx, found.DockerID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "container is not available for snapshots"})
+		return
+	}
+
+	// Enforce per-tier snapshot quota
+	limits := models.GetUserResourceLimits(tier, subscriptionActive)
+	count, err := h.store.CountSnapshotsByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check snapshot limit"})
+		return
+	}
+	if count >= limits.MaxSnapshots {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "snapshot limit reached",
+			"current": count,
+			"limit":   limits.MaxSnapshots,
+			"tier":    tier,
+			"message": "Delete an existing snapshot or upgrade your plan to keep more snapshots",
+		})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = found.Name + "-" + time.Now().Format("20060102-150405")
+	}
+	if len(name) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "snapshot name is too long"})
+		return
+	}
+
+	snap := &storage.SnapshotRecord{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		ContainerID: found.ID,
+		Name:        name,
+		SourceImage: found.Image,
+		Role:        found.Role,
+		Status:      "creating",
+		CreatedAt:   time.Now(),
+	}
+	if err := h.store.CreateSnapshot(ctx, snap); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create snapshot record"})
+		return
+	}
+
+	go h.createSnapshotAsync(snap, found.DockerID)
+
+	c.JSON(http.StatusAccepted, snap)
+}
+
+// createSnapshotAsync commits the container and records the result
+func (h *ContainerHandler) createSnapshotAsync(snap *storage.SnapshotRecord, dockerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	info, err := h.manager.CreateSnapshot(ctx, dockerID, snap.UserID, snap.ID)
+	if err != nil {
+		log.Printf("[Snapshot] Failed to snapshot %s: %v", dockerID, err)
+		h.store.MarkSnapshotFailed(ctx, snap.ID, err.Error())
+		snap.Status = "error"
+		snap.Error = container.SanitizeError(err)
+	} else {
+		h.store.MarkSnapshotReady(ctx, snap.ID, info.ImageTag, info.ArchivePath, info.SizeBytes)
+		snap.Status = "ready"
+		snap.SizeBytes = info.SizeBytes
+	}
+
+	if h.eventsHub != nil {
+		h.eventsHub.NotifySnapshotUpdated(snap.UserID, snap)
+	}
+}
+
+// ListContainerSnapshots returns the snapshots taken from a container
+func (h *ContainerHandler) ListContainerSnapshots(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	found, err := h.findUserContainer(ctx, userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify container ownership"})
+		return
+	}
+	if found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+
+	snapshots, err := h.store.GetSnapshotsByContainerID(ctx, userID, found.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch snapshots"})
+		return
+	}
+	if snapshots == nil {
+		snapshots = []*storage.SnapshotRecord{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"snapshots": snapshots})
+}
+
+// ListSnapshots returns all snapshots owned by the user along with quota usage
+func (h *ContainerHandler) ListSnapshots(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	snapshots, err := h.store.GetSnapshotsByUserID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch snapshots"})
+		return
+	}
+	if snapshots == nil {
+		snapshots = []*storage.SnapshotRecord{}
+	}
+
+	limits := models.GetUserResourceLimits(c.GetString("tier"), c.GetBool("subscription_active"))
+	c.JSON(http.StatusOK, gin.H{
+		"snapshots": snapshots,
+		"limit":     limits.MaxSnapshots,
+	})
+}
+
+// GetSnapshot returns a single snapshot
+func (h *ContainerHandler) GetSnapshot(c *gin.Context) {
+	snap, ok := h.userSnapshot(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, snap)
+}
+
+// DeleteSnapshot removes a snapshot and its image and archive. Snapshots
+// that terminals were created or restored from can't be deleted until those
+// terminals are gone, since they're recreated from the snapshot image.
+func (h *ContainerHandler) DeleteSnapshot(c *gin.Context) {
+	snap, ok := h.userSnapshot(c)
+	if !ok {
+		return
+	}
+	if snap.Status == "creating" {
+		c.JSON(http.StatusConflict, gin.H{"error": "snapshot is still being created"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if snap.ImageTag != "" {
+		inUse, err := h.store.CountContainersByImage(ctx, "custom:"+snap.ImageTag)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check snapshot usage"})
+			return
+		}
+		if inUse > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "snapshot is in use",
+				"terminals": inUse,
+				"message":   "Delete the terminals created or restored from this snapshot first",
+			})
+			return
+		}
+	}
+
+	if err := h.manager.DeleteSnapshot(ctx, snap.ImageTag, snap.ArchivePath); err != nil {
+		if errors.Is(err, container.ErrSnapshotInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": "snapshot is in use"})
+			return
+		}
+		log.Printf("[Snapshot] Failed to remove artifacts for %s: %v", snap.ID, err)
+	}
+	if err := h.store.DeleteSnapshot(ctx, snap.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete snapshot"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "snapshot deleted", "id": snap.ID})
+}
+
+// RestoreSnapshot rolls an existing container back to a snapshot.
+// The container is recreated from the snapshot image and its home volume is
+// replaced with the snapshot archive. To restore into a new terminal, create
+// a container with snapshot_id instead.
+func (h *ContainerHandler) RestoreSnapshot(c *gin.Context) {
+	userID := c.GetString("userID")
+	tier := c.GetString("tier")
+
+	snap, ok := h.userSnapshot(c)
+	if !ok {
+		return
+	}
+	if snap.Status != "ready" {
+		c.JSON(http.StatusConflict, gin.H{"error": "snapshot is not ready", "status": snap.Status})
+		return
+	}
+
+	var req RestoreSnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "container_id is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	found, err := h.findUserContainer(ctx, userID, req.ContainerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify container ownership"})
+		return
+	}
+	if found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+
+	// The old container is only removed once its replacement is running; the
+	// home volume is shared and overwritten by the restore
+	image := "custom:" + snap.ImageTag
+	newInfo, err := h.manager.ReplaceContainer(ctx, container.RecreateContainerConfig{
+		UserID:          userID,
+		ContainerName:   found.Name,
+		Image:           image,
+		Role:            snap.Role,
+		OldDockerID:     found.DockerID,
+		Tier:            tier,
+		MemoryMB:        found.MemoryMB,
+		CPUMillicores:   found.CPUShares,
+		DiskMB:          found.DiskMB,
+		VolumeName:      found.VolumeName,
+		SnapshotArchive: snap.ArchivePath,
+		Volumes:         h.containerVolumeMounts(ctx, found.ID),
+		Class:           containerResourceClass(ctx, h.store, found.ID),
+	})
+	if err != nil {
+		log.Printf("[Snapshot] Failed to restore %s into %s: %v", snap.ID, found.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   container.SanitizeError(err),
+			"message": "Snapshot could not be restored; the terminal was kept",
+		})
+		return
+	}
+
+	h.manager.UpdateContainerStatus(newInfo.ID, "running")
+	h.store.UpdateContainerDockerID(ctx, found.ID, newInfo.ID)
+	h.store.UpdateContainerImage(ctx, found.ID, image)
+	h.store.UpdateContainerStatus(ctx, found.ID, "running")
+
+	if h.eventsHub != nil {
+		h.eventsHub.NotifyContainerUpdated(userID, gin.H{
+			"id":          newInfo.ID,
+			"old_id":      found.DockerID,
+			"db_id":       found.ID,
+			"name":        found.Name,
+			"image":       image,
+			"status":      "running",
+			"snapshot_id": snap.ID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "snapshot restored",
+		"id":          newInfo.ID,
+		"old_id":      found.DockerID,
+		"db_id":       found.ID,
+		"name":        found.Name,
+		"image":       image,
+		"status":      "running",
+		"snapshot_id": snap.ID,
+	})
+}
+
+// userSnapshot loads the snapshot named by the :id param and checks ownership.
+// It writes the error response and returns false if the snapshot is not accessible.
+func (h *ContainerHandler) userSnapshot(c *gin.Context) (*storage.SnapshotRecord, bool) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	snap, err := h.store.GetSnapshotByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch snapshot"})
+		return nil, false
+	}
+	if snap == nil || snap.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
+		return nil, false
+	}
+	return snap, true
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// templateFetchTimeout bounds cloning a repository to read its rexec.yaml
+const templateFetchTimeout = 60 * time.Second
+
+// maxGitCloneBytes caps a checkout on disk, history included; clones that
+// grow past it are killed
+const maxGitCloneBytes = 512 * 1024 * 1024
+
+var errTemplateNotFound = errors.New("template not found")
+
+// TemplateHandler manages rexec.yaml environment templates
+type TemplateHandler struct {
+	store *storage.PostgresStore
+}
+
+// NewTemplateHandler creates a new TemplateHandler
+func NewTemplateHandler(store *storage.PostgresStore) *TemplateHandler {
+	return &TemplateHandler{store: store}
+}
+
+// SaveTemplateRequest creates or replaces a template, either from inline
+// YAML or from a rexec.yaml in a git repository.
+type SaveTemplateRequest struct {
+	Content      string `json:"content"`        // Raw rexec.yaml
+	RepoURL      string `json:"repo_url"`       // https git URL to import from instead of content
+	Ref          string `json:"ref"`            // Optional branch or tag
+	Path         string `json:"path"`           // Optional path to the file inside the repo (default rexec.yaml)
+	ShareWithOrg *bool  `json:"share_with_org"` // Share with the caller's org
+}
+
+// TemplateResponse is a stored template together with its parsed spec
+type TemplateResponse struct {
+	*storage.TemplateRecord
+	Spec    *models.EnvTemplate `json:"spec,omitempty"`
+	IsOwner bool                `json:"is_owner"`
+}
+
+// ListTemplates lists the caller's templates and those shared with their org
+// GET /api/templates
+func (h *TemplateHandler) ListTemplates(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	orgID, err := h.store.GetUserOrgID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch templates"})
+		return
+	}
+
+	templates, err := h.store.GetTemplatesForUser(ctx, userID, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch templates"})
+		return
+	}
+
+	response := make([]TemplateResponse, 0, len(templates))
+	for _, t := range templates {
+		response = append(response, templateResponse(t, userID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": response,
+		"count":     len(response),
+	})
+}
+
+// GetTemplate returns one template by ID
+// GET /api/templates/:id
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	tmpl, err := lookupTemplate(c.Request.Context(), h.store, userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, templateResponse(tmpl, userID))
+}
+
+// CreateTemplate stores a new template
+// POST /api/templates
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	var req SaveTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record := &storage.TemplateRecord{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	spec, status, err := h.fillTemplate(ctx, record, &req)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.CreateTemplate(ctx, record); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "a template with this name already exists", "name": spec.Name})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save template"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, TemplateResponse{TemplateRecord: record, Spec: spec, IsOwner: true})
+}
+
+// UpdateTemplate replaces a template's content. Sending only repo_url with an
+// imported template re-reads its rexec.yaml from the repository.
+// PUT /api/templates/:id
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	record, err := h.store.GetTemplateByID(ctx, c.Param("id"))
+	if err != nil || record == nil || record.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+
+	var req SaveTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ShareWithOrg == nil {
+		shared := record.OrgID != ""
+		req.ShareWithOrg = &shared
+	}
+
+	spec, status, err := h.fillTemplate(ctx, record, &req)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.UpdateTemplate(ctx, record); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "a template with this name already exists", "name": spec.Name})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TemplateResponse{TemplateRecord: record, Spec: spec, IsOwner: true})
+}
+
+// DeleteTemplate removes a template owned by the caller
+// DELETE /api/templates/:id
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	record, err := h.store.GetTemplateByID(ctx, c.Param("id"))
+	if err != nil || record == nil || record.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+
+	if err := h.store.DeleteTemplate(ctx, record.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "template deleted"})
+}
+
+// fillTemplate resolves the YAML for a save request, validates it and copies
+// it onto record. It returns the HTTP status to use on error.
+func (h *TemplateHandler) fillTemplate(ctx context.Context, record *storage.TemplateRecord, req *SaveTemplateRequest) (*models.EnvTemplate, int, error) {
+	content := req.Content
+	switch {
+	case content != "" && req.RepoURL != "":
+		return nil, http.StatusBadRequest, errors.New("send either content or repo_url, not both")
+	case req.RepoURL != "":
+		data, err := fetchTemplateFromGit(ctx, req.RepoURL, req.Ref, req.Path)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		content = string(data)
+		record.SourceRepo, record.SourceRef, record.SourcePath = req.RepoURL, req.Ref, req.Path
+	case content != "":
+		record.SourceRepo, record.SourceRef, record.SourcePath = "", "", ""
+	default:
+		return nil, http.StatusBadRequest, errors.New("content or repo_url is required")
+	}
+
+	spec, err := models.ParseEnvTemplate([]byte(content))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	record.OrgID = ""
+	if req.ShareWithOrg != nil && *req.ShareWithOrg {
+		orgID, err := h.store.GetUserOrgID(ctx, record.UserID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("failed to look up org")
+		}
+		if orgID == "" {
+			return nil, http.StatusBadRequest, errors.New("you are not a member of an org")
+		}
+		record.OrgID = orgID
+	}
+
+	record.Name = spec.Name
+	record.Description = spec.Description
+	record.Content = content
+	record.UpdatedAt = time.Now()
+	return spec, 0, nil
+}
+
+func templateResponse(t *storage.TemplateRecord, userID string) TemplateResponse {
+	resp := TemplateResponse{TemplateRecord: t, IsOwner: t.UserID == userID}
+	if spec, err := models.ParseEnvTemplate([]byte(t.Content)); err == nil {
+		resp.Spec = spec
+	}
+	return resp
+}
+
+// lookupTemplate finds a template the user may use by ID or by name
+func lookupTemplate(ctx context.Context, store *storage.PostgresStore, userID, idOrName string) (*storage.TemplateRecord, error) {
+	orgID, err := store.GetUserOrgID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if t, err := store.GetTemplateByID(ctx, idOrName); err == nil && t != nil {
+		if t.UserID == userID || (orgID != "" && t.OrgID == orgID) {
+			return t, nil
+		}
+	}
+
+	t, err := store.GetTemplateByName(ctx, userID, orgID, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errTemplateNotFound
+	}
+	return t, nil
+}
+
+// applyTemplate fills in the parts of a create request the caller left unset
+func applyTemplate(req *models.CreateContainerRequest, tmpl *models.EnvTemplate) {
+	if req.Image == "" {
+		req.Image, req.CustomImage = container.ResolveTemplateImage(tmpl.Image)
+	}
+	if req.Role == "" {
+		req.Role = tmpl.Role
+	}
+	if req.MemoryMB == 0 {
+		req.MemoryMB = tmpl.Resources.MemoryMB
+	}
+	if req.CPUShares == 0 {
+		req.CPUShares = tmpl.Resources.CPUShares
+	}
+	if req.DiskMB == 0 {
+		req.DiskMB = tmpl.Resources.DiskMB
+	}
+}
+
+// resolveTemplate loads the template named in a create request and applies it
+func (h *ContainerHandler) resolveTemplate(ctx context.Context, userID string, req *models.CreateContainerRequest) (*models.EnvTemplate, error) {
+	if req.Template == "" {
+		return nil, nil
+	}
+	if req.SnapshotID != "" {
+		return nil, errors.New("template and snapshot_id cannot be combined")
+	}
+
+	record, err := lookupTemplate(ctx, h.store, userID, req.Template)
+	if err != nil {
+		return nil, errTemplateNotFound
+	}
+	tmpl, err := models.ParseEnvTemplate([]byte(record.Content))
+	if err != nil {
+		return nil, fmt.Errorf("template %s is invalid: %w", record.Name, err)
+	}
+
+	applyTemplate(req, tmpl)
+	return tmpl, nil
+}
+
+// openTemplatePorts records a port forward for every port the template lists,
+// making each reachable through the HTTP proxy as soon as the terminal is up.
+func (h *ContainerHandler) openTemplatePorts(ctx context.Context, userID, dbID string, tmpl *models.EnvTemplate) {
+	for _, p := range tmpl.Ports {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("port-%d", p.Port)
+		}
+		pf := &models.PortForward{
+			ID:            uuid.New().String(),
+			UserID:        userID,
+			ContainerID:   dbID,
+			Name:          name,
+			ContainerPort: p.Port,
+			LocalPort:     p.Port,
+			Protocol:      "tcp",
+			IsActive:      true,
+			CreatedAt:     time.Now(),
+		}
+		if err := h.store.CreatePortForward(ctx, pf); err != nil {
+			log.Printf("[Template] Failed to open port %d for %s: %v", p.Port, dbID, err)
+		}
+	}
+}
+
+// fetchTemplateFromGit shallow-clones repoURL and reads the template file from it
+func fetchTemplateFromGit(ctx context.Context, repoURL, ref, path string) ([]byte, error) {
+	if path == "" {
+		path = models.TemplateFileName
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, templateFetchTimeout)
+	defer cancel()
+
+	root, cleanup, err := cloneGitRepo(ctx, repoURL, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	file, err := resolveRepoPath(root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in repository", path)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, models.MaxTemplateBytes+1))
+	if err != nil {
+		return nil, errors.New("failed to read template")
+	}
+	return data, nil
+}
+
+// cloneGitRepo shallow-clones a public https repository into a temporary
+// directory and returns its resolved path. The caller must call cleanup.
+// The host must resolve to public addresses only, and git is pinned to them
+// with redirects off, so a repo URL can't be used to reach internal services.
+func cloneGitRepo(ctx context.Context, repoURL, ref string) (root string, cleanup func(), err error) {
+	if err := models.ValidateGitURL(repoURL); err != nil {
+		return "", nil, fmt.Errorf("repo_url %v", err)
+	}
+	if ref != "" && (strings.HasPrefix(ref, "-") || strings.ContainsAny(ref, " \t\n")) {
+		return "", nil, errors.New("invalid ref")
+	}
+	u, _ := url.Parse(repoURL)
+	ips, err := models.ResolvePublicHost(ctx, u.Hostname())
+	if err != nil {
+		return "", nil, fmt.Errorf("repo_url %v", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	pinned := make([]string, len(ips))
+	for i, ip := range ips {
+		pinned[i] = ip.String()
+		if ip.To4() == nil {
+			pinned[i] = "[" + pinned[i] + "]"
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "rexec-git-")
+	if err != nil {
+		return "", nil, errors.New("failed to prepare checkout")
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	args := []string{
+		"-c", "http.curloptResolve=" + u.Hostname() + ":" + port + ":" + strings.Join(pinned, ","),
+		"-c", "http.followRedirects=false",
+		"-c", "protocol.allow=never",
+		"-c", "protocol.https.allow=always",
+		"clone", "--depth", "1", "--single-branch", "--no-tags",
+	}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", repoURL, dir)
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=/bin/true")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return "", nil, errors.New("failed to clone repository")
+	}
+
+	// Watch the checkout grow and kill git once it's over the limit
+	done := make(chan struct{})
+	oversized := make(chan bool, 1)
+	go func() {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				oversized <- false
+				return
+			case <-ticker.C:
+				if dirSize(dir) > maxGitCloneBytes {
+					cmd.Process.Kill()
+					oversized <- true
+					return
+				}
+			}
+		}
+	}()
+	err = cmd.Wait()
+	close(done)
+	if <-oversized || dirSize(dir) > maxGitCloneBytes {
+		cleanup()
+		return "", nil, fmt.Errorf("repository is over the %d MB limit", maxGitCloneBytes/(1024*1024))
+	}
+	if err != nil {
+		cleanup()
+		log.Printf("[Git] git clone %s failed: %v: %s", repoURL, err, truncateOutput(out.String(), 500))
+		return "", nil, errors.New("failed to clone repository (is it public and does the ref exist?)")
+	}
+
+	root, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		cleanup()
+		return "", nil, errors.New("failed to read repository")
+	}
+	return root, cleanup, nil
+}
+
+// dirSize adds up the size of the files under dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// resolveRepoPath resolves path inside a checkout. Symlinks are followed so
+// a link inside the repo can't point at files on the server.
+func resolveRepoPath(root, path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+path)))
+	if err != nil {
+		return "", fmt.Errorf("%s not found in repository", path)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s not found in repository", path)
+	}
+	return resolved, nil
+}
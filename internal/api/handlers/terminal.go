@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -65,6 +66,8 @@ type TerminalHandler struct {
 	recordingHandler *RecordingHandler
 	collabHandler    *CollabHandler
 	adminEventsHub   *admin_events.AdminEventsHub
+	eventsHub        *ContainerEventsHub
+	resumable        *resumeRegistry
 
 	// Caches to speed up reconnection
 	shellCache map[string]string // containerID -> shell path
@@ -102,6 +105,18 @@ type TerminalSession struct {
 	ForceNewSession bool   // If true, create new tmux session instead of resuming main
 	IsOwner         bool   // Container owner (vs collab participant)
 	TmuxSessionName string // Set when tmux is used ("main", "user-...", "split-...")
+	PTYSessionID    string // Named session to attach to instead of the terminal's own
+
+	// Resumable sessions buffer output while detached from a dropped client
+	output   *scrollback
+	resume   *resumeState
+	detached bool
+
+	// rexec.v2 clients acknowledge output; the PTY isn't read while a full
+	// flowWindow is unacknowledged
+	v2       bool
+	acked    uint64
+	flowWake chan struct{}
 }
 
 // TerminalMessage represents messages between client and server
@@ -110,6 +125,17 @@ type TerminalMessage struct {
 	Data string `json:"data,omitempty"`
 	Cols uint   `json:"cols,omitempty"`
 	Rows uint   `json:"rows,omitempty"`
+	// Offset is the scrollback position just past an output message, or the
+	// position a resume token or replay starts from
+	Offset uint64 `json:"offset,omitempty"`
+
+	// Shell lifecycle events: "exit", "restart", "command_start" and
+	// "command_end"
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Signal     string `json:"signal,omitempty"`
+	Cwd        string `json:"cwd,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Restarts   int    `json:"restarts,omitempty"`
 }
 
 // NewTerminalHandler creates a new terminal handler
@@ -122,6 +148,7 @@ func NewTerminalHandler(cm *mgr.Manager, store *storage.PostgresStore, adminEven
 		adminEventsHub:   adminEventsHub, // Assign the hub
 		shellCache:       make(map[string]string),
 		tmuxCache:        make(map[string]bool),
+		resumable:        newResumeRegistry(resumeWindow),
 	}
 
 	// Start keepalive goroutine
@@ -135,6 +162,11 @@ func (h *TerminalHandler) SetRecordingHandler(rh *RecordingHandler) {
 	h.recordingHandler = rh
 }
 
+// SetEventsHub sets the events hub used to announce containers resumed on connect
+func (h *TerminalHandler) SetEventsHub(hub *ContainerEventsHub) {
+	h.eventsHub = hub
+}
+
 // SetCollabHandler sets the collab handler to check for shared session access
 func (h *TerminalHandler) SetCollabHandler(ch *CollabHandler) {
 	h.collabHandler = ch
@@ -527,6 +559,32 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 			return
 		}
 
+		// Containers paused by the idle policy resume transparently on reconnect
+		if dockerContainer.State.Paused {
+			if err := h.containerManager.UnpauseContainer(reqCtx, dockerID); err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"error": "failed to resume paused container: " + mgr.SanitizeError(err),
+					"code":  "docker_error",
+				})
+				return
+			}
+			log.Printf("[Terminal] Resumed paused container %s on connect", dockerID[:12])
+			if dbContainer != nil {
+				h.store.UpdateContainerStatus(reqCtx, dbContainer.ID, "running")
+				if containerStatus == "paused" {
+					containerStatus = "running"
+				}
+				if h.eventsHub != nil {
+					h.eventsHub.NotifyContainerUnpaused(dbContainer.UserID, gin.H{
+						"id":     dockerID,
+						"db_id":  dbContainer.ID,
+						"name":   dbContainer.Name,
+						"status": "running",
+					})
+				}
+			}
+		}
+
 		// Docker is source of truth for running state
 		isRunning = dockerContainer.State.Running
 		// If DB says "configuring" but Docker says running, container is actually ready
@@ -577,13 +635,32 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	// ?session=<id> attaches to a named session from POST /containers/:id/sessions
+	ptySessionID := c.Query("session")
+	if ptySessionID != "" {
+		if !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can attach to named sessions"})
+			return
+		}
+		if _, err := h.containerManager.GetPTYSession(reqCtx, dockerID, ptySessionID); err != nil {
+			switch {
+			case errors.Is(err, mgr.ErrPTYSessionNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, mgr.ErrTmuxUnavailable):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": mgr.SanitizeError(err)})
+			}
+			return
+		}
+	}
+
 	// Upgrade to WebSocket with subprotocol support
-	// Client sends: Sec-WebSocket-Protocol: rexec.v1, rexec.token.<token>
+	// Client sends: Sec-WebSocket-Protocol: rexec.v2, rexec.v1, rexec.token.<token>
 	// Server should respond with the accepted protocol version
 	responseHeader := http.Header{}
-	requestedProtocols := c.GetHeader("Sec-WebSocket-Protocol")
-	if strings.Contains(requestedProtocols, "rexec.v1") {
-		responseHeader.Set("Sec-WebSocket-Protocol", "rexec.v1")
+	if protocol := negotiateTerminalProtocol(c.GetHeader("Sec-WebSocket-Protocol")); protocol != "" {
+		responseHeader.Set("Sec-WebSocket-Protocol", protocol)
 	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, responseHeader)
 	if err != nil {
@@ -599,8 +676,12 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 		return nil
 	})
 	// Enable compression if client supports it
-	conn.EnableWriteCompression(true)
-	conn.SetCompressionLevel(6) // Balance between speed and compression
+	if isProtocolV2(conn) {
+		configureProtocolV2(conn)
+	} else {
+		conn.EnableWriteCompression(true)
+		conn.SetCompressionLevel(6) // Balance between speed and compression
+	}
 
 	// Touch container to update last used time
 	h.containerManager.TouchContainer(dockerID)
@@ -616,7 +697,7 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 	// If collab user joining:
 	// - View mode: Use shared session (mirrored view, input blocked on frontend)
 	// - Control mode: Get their own independent terminal session (own tmux session)
-	if isCollabUser {
+	if isCollabUser && ptySessionID == "" {
 		// Control mode: Each user gets their own independent terminal session
 		if collabMode == "control" {
 			log.Printf("[Terminal] Control mode collab user %s getting independent session for %s", userID, dockerID[:12])
@@ -641,7 +722,7 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 
 					// 1. Force owner to reconnect (which will join the shared session we are about to create)
 					// We send a specific close message or just close it.
-					ownerSession.Conn.WriteJSON(TerminalMessage{
+					ownerSession.SendMessage(TerminalMessage{
 						Type: "reconnect",
 						Data: "Upgrading to shared session...",
 					})
@@ -669,14 +750,14 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 
 	// Owner connecting - check if there's an active collab that needs shared session
 	// Only use shared sessions for VIEW mode, not control mode
-	if hasSharedSession && !sharedSession.closed && collabMode == "view" {
+	if hasSharedSession && !sharedSession.closed && collabMode == "view" && ptySessionID == "" {
 		// Join existing shared session
 		h.joinSharedSession(sharedSession, conn, userID.(string), isOwner)
 		return
 	}
 
 	// Check if owner is starting while there's an active VIEW mode collab session
-	if h.hasActiveCollabSession(dockerID) && collabMode == "view" {
+	if h.hasActiveCollabSession(dockerID) && collabMode == "view" && ptySessionID == "" {
 		// Create shared session for view-mode collab
 		sharedSession = h.getOrCreateSharedSession(dockerID, userID.(string), imageType)
 		h.joinSharedSession(sharedSession, conn, userID.(string), isOwner)
@@ -691,6 +772,12 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 		connectionID = "default"
 	}
 
+	// A client coming back after a dropped connection takes over its
+	// detached session; the original handler keeps running it
+	if h.resumeTerminal(c, userID.(string), dockerID, conn) {
+		return
+	}
+
 	// Check if this is a new session request (for split panes)
 	// newSession=true means create a fresh tmux session instead of resuming main
 	forceNewSession := c.Query("newSession") == "true"
@@ -708,7 +795,10 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 		Done:            make(chan struct{}),
 		ForceNewSession: forceNewSession,
 		IsOwner:         isOwner,
+		PTYSessionID:    ptySessionID,
+		v2:              isProtocolV2(conn),
 	}
+	h.makeResumable(session, false)
 
 	// Register session with unique key to allow multiplexing
 	sessionKey := dockerID + ":" + userID.(string) + ":" + connectionID
@@ -748,6 +838,7 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 			delete(h.sessions, sessionKey)
 		}
 		h.mu.Unlock()
+		h.resumable.drop(session.resume)
 
 		// Broadcast session deleted event to admin hub
 		if h.adminEventsHub != nil && session.DBSessionID != "" {
@@ -779,6 +870,7 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 		Type: "connected",
 		Data: "Terminal session established",
 	})
+	session.sendResumeToken()
 	log.Printf("[Terminal] Sent 'connected' message for session %s (user %s), status=%s", session.ContainerID[:12], userID, containerStatus)
 
 	// Refresh container status from DB and update manager cache if stale (multi-replica support)
@@ -915,6 +1007,17 @@ func (h *TerminalHandler) runTerminalSessionWithRestart(session *TerminalSession
 			restartCount = 0
 		}
 
+		// A named session's shell belongs to the session, so when it exits
+		// (or the session is deleted) the connection ends with it
+		if shellExited && session.PTYSessionID != "" {
+			session.SendMessage(TerminalMessage{
+				Type: "output",
+				Data: "\r\n\x1b[33m[Session ended]\x1b[0m\r\n",
+			})
+			session.Close()
+			return
+		}
+
 		// If shell exited normally (user typed 'exit'), restart it
 		// For macOS, add a delay to let the VM stabilize
 		if shellExited && restartCount < maxRestarts {
@@ -928,6 +1031,11 @@ func (h *TerminalHandler) runTerminalSessionWithRestart(session *TerminalSession
 				time.Sleep(5 * time.Second) // Give macOS VM more time to stabilize after CPU throttling
 			}
 
+			session.SendMessage(TerminalMessage{
+				Type:     "restart",
+				Restarts: restartCount,
+			})
+
 			session.SendMessage(TerminalMessage{
 				Type: "output",
 				Data: "\r\n\x1b[33m[Starting new session...]\x1b[0m\r\n\r\n",
@@ -989,7 +1097,24 @@ func (h *TerminalHandler) runTerminalSession(session *TerminalSession, imageType
 	// For standard Linux containers, attach to tmux session for persistence
 	// This allows users to reconnect and see output that happened while disconnected
 	var execConfig container.ExecOptions
-	if isMacOS {
+	if session.PTYSessionID != "" {
+		// Named sessions already run their own shell; just attach to it
+		session.TmuxSessionName = session.PTYSessionID
+		log.Printf("[Terminal] Attaching to named session '%s' in %s", session.PTYSessionID, session.ContainerID[:12])
+		execConfig = container.ExecOptions{
+			AttachStdin:  true,
+			AttachStdout: true,
+			AttachStderr: true,
+			Tty:          true,
+			Cmd:          []string{"tmux", "attach-session", "-t", "=" + session.PTYSessionID},
+			Env: []string{
+				"TERM=xterm-256color",
+				"COLORTERM=truecolor",
+				"LANG=C.UTF-8",
+				"LC_ALL=C.UTF-8",
+			},
+		}
+	} else if isMacOS {
 		// macOS containers don't use tmux (yet)
 		// Use /bin/bash directly for macOS - no detection needed
 		shell := "/bin/bash"
@@ -1284,6 +1409,9 @@ func (h *TerminalHandler) runTerminalSession(session *TerminalSession, imageType
 		// Large buffer for efficient reads
 		buf := make([]byte, ptyBufferSize)
 
+		// Shells with integration mark commands in their output
+		var commands commandTracker
+
 		// Track consecutive EOFs for macOS stability
 		consecutiveEOFs := 0
 		maxConsecutiveEOFs := 1
@@ -1298,6 +1426,10 @@ func (h *TerminalHandler) runTerminalSession(session *TerminalSession, imageType
 			case <-ctx.Done():
 				return
 			default:
+				// A slow rexec.v2 client stalls the PTY rather than the
+				// server queueing output for it
+				session.awaitWindow(ctx.Done())
+
 				// No read deadline - blocking read is most efficient for PTY
 				attachResp.Conn.SetReadDeadline(time.Time{})
 
@@ -1328,27 +1460,15 @@ func (h *TerminalHandler) runTerminalSession(session *TerminalSession, imageType
 				consecutiveEOFs = 0
 
 				if n > 0 {
-					// Fast path: check if already valid UTF-8 (common case)
-					outputData := string(buf[:n])
-					if !isValidUTF8Fast(buf[:n]) {
-						outputData = sanitizeUTF8(buf[:n])
-					}
-					// Filter mouse tracking sequences
-					outputData = filterMouseTracking(outputData)
-
-					// Set write deadline to prevent slow clients from blocking
-					session.Conn.SetWriteDeadline(time.Now().Add(wsWriteDeadline))
-
-					if err := session.SendMessage(TerminalMessage{
-						Type: "output",
-						Data: outputData,
-					}); err != nil {
-						// WebSocket closed or write timeout
+					events := commands.scan(buf[:n], time.Now())
+					if err := session.sendOutputWithEvents(buf[:n], events); err != nil && session.resume == nil {
+						// WebSocket closed or write timeout. Resumable sessions
+						// keep buffering until the client comes back.
 						return
 					}
 
-					if h.recordingHandler != nil {
-						h.recordingHandler.AddEvent(session.ContainerID, "o", outputData, 0, 0)
+					if h.recordingHandler != nil && h.recordingHandler.IsRecording(session.ContainerID) {
+						h.recordingHandler.AddEvent(session.ContainerID, "o", terminalText(buf[:n]), 0, 0)
 					}
 				}
 			}
@@ -1365,17 +1485,41 @@ func (h *TerminalHandler) runTerminalSession(session *TerminalSession, imageType
 			case <-ctx.Done():
 				return
 			default:
-				_, message, err := session.Conn.ReadMessage()
+				conn := session.currentConn()
+				messageType, message, err := conn.ReadMessage()
 				if err != nil {
 					if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 						log.Printf("WebSocket error: %v", err)
 					}
+					if ctx.Err() == nil && h.awaitResume(session, conn, err, ctx.Done()) {
+						continue
+					}
 					cancel()
 					return
 				}
 
 				var msg TerminalMessage
-				if err := json.Unmarshal(message, &msg); err != nil {
+				if messageType == websocket.BinaryMessage && session.usesV2() {
+					frame, err := decodeFrame(message)
+					if err != nil {
+						continue
+					}
+					switch frame.Type {
+					case frameData:
+						msg = TerminalMessage{Type: "input", Data: string(frame.Payload)}
+					case frameResize:
+						cols, rows := frame.size()
+						msg = TerminalMessage{Type: "resize", Cols: cols, Rows: rows}
+					case framePing:
+						session.sendPong(frame.Payload)
+						continue
+					case frameAck:
+						session.ack(frame.offset())
+						continue
+					default:
+						continue
+					}
+				} else if err := json.Unmarshal(message, &msg); err != nil {
 					// Treat as raw input for backward compatibility
 					attachResp.Conn.Write(message)
 					h.containerManager.TouchContainer(session.ContainerID)
@@ -1438,6 +1582,9 @@ func (h *TerminalHandler) runTerminalSession(session *TerminalSession, imageType
 		return false
 	case <-shellExitChan:
 		// Shell exited normally, can restart
+		if inspect, err := client.ContainerExecInspect(context.Background(), execResp.ID); err == nil {
+			session.sendExitStatus(inspect.ExitCode)
+		}
 		return true
 	case err := <-errChan:
 		if err != nil {
@@ -1669,6 +1816,22 @@ func (s *TerminalSession) SendMessage(msg TerminalMessage) error {
 	if s.closed {
 		return nil
 	}
+	if msg.Type == "output" && s.output != nil {
+		msg.Offset = s.output.Write([]byte(msg.Data))
+	}
+	if s.detached {
+		return nil
+	}
+	if s.v2 {
+		switch msg.Type {
+		case "output":
+			return writeFrame(s.Conn, frameData, []byte(msg.Data))
+		case "ping":
+			return writeFrame(s.Conn, framePing, nil)
+		case "pong":
+			return writeFrame(s.Conn, framePong, nil)
+		}
+	}
 
 	s.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 	return s.Conn.WriteJSON(msg)
@@ -1697,6 +1860,7 @@ func (s *TerminalSession) CloseWithCode(code int, reason string) {
 		return
 	}
 	s.closed = true
+	s.wakeFlow()
 
 	// Signal done
 	select {
@@ -1944,14 +2108,34 @@ func (h *TerminalHandler) joinSharedSession(session *SharedTerminalSession, conn
 		conn.Close()
 	}()
 
+	v2 := isProtocolV2(conn)
 	for {
-		_, message, err := conn.ReadMessage()
+		messageType, message, err := conn.ReadMessage()
 		if err != nil {
 			return
 		}
 
 		var msg TerminalMessage
-		if err := json.Unmarshal(message, &msg); err != nil {
+		if messageType == websocket.BinaryMessage && v2 {
+			// Shared sessions take rexec.v2 input and resizes; there is no
+			// flow control since output is broadcast to every participant
+			frame, err := decodeFrame(message)
+			if err != nil {
+				continue
+			}
+			switch frame.Type {
+			case frameData:
+				msg = TerminalMessage{Type: "input", Data: string(frame.Payload)}
+			case frameResize:
+				cols, rows := frame.size()
+				msg = TerminalMessage{Type: "resize", Cols: cols, Rows: rows}
+			case framePing:
+				writeFrame(conn, framePong, frame.Payload)
+				continue
+			default:
+				continue
+			}
+		} else if err := json.Unmarshal(message, &msg); err != nil {
 			continue
 		}
 
@@ -2093,6 +2277,10 @@ func (s *SharedTerminalSession) broadcastOutput(data []byte) {
 	}
 
 	for _, conn := range s.Connections {
+		if isProtocolV2(conn) {
+			writeFrame(conn, frameData, data)
+			continue
+		}
 		conn.WriteJSON(msg)
 	}
 }
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPendingOSC caps how much of an unterminated OSC sequence is carried
+// over to the next chunk of output
+const maxPendingOSC = 4096
+
+var (
+	oscStart = []byte("\x1b]")
+
+	// exitSignals names the signals a shell exit code above 128 can report
+	exitSignals = map[int]string{
+		1: "HUP", 2: "INT", 3: "QUIT", 4: "ILL", 6: "ABRT", 8: "FPE",
+		9: "KILL", 11: "SEGV", 13: "PIPE", 14: "ALRM", 15: "TERM",
+	}
+)
+
+// exitSignal returns the signal that killed a shell exiting with code, or
+// "" when it exited on its own
+func exitSignal(code int) string {
+	if code <= 128 {
+		return ""
+	}
+	if name, ok := exitSignals[code-128]; ok {
+		return name
+	}
+	return strconv.Itoa(code - 128)
+}
+
+// exitMessage is the exit event for a shell that exited with code
+func exitMessage(code int) TerminalMessage {
+	return TerminalMessage{Type: "exit", ExitCode: &code, Signal: exitSignal(code)}
+}
+
+// commandEvent is a command lifecycle event found in PTY output. Pos is
+// where in the scanned chunk the mark ended, so output before it is sent
+// first.
+type commandEvent struct {
+	Pos int
+	Msg TerminalMessage
+}
+
+// commandTracker follows the OSC 133 command marks and OSC 7 working
+// directory reports shells with integration print, turning them into
+// command_start and command_end events. It is not safe for concurrent use.
+type commandTracker struct {
+	pending []byte // unterminated OSC sequence from the previous chunk
+	cwd     string
+	running bool
+	started time.Time
+}
+
+// scan looks for marks in a chunk of output. Sequences split across chunks
+// are completed from the next one.
+func (t *commandTracker) scan(data []byte, now time.Time) []commandEvent {
+	if len(t.pending) == 0 && bytes.Index(data, oscStart) < 0 && (len(data) == 0 || data[len(data)-1] != 0x1b) {
+		return nil
+	}
+
+	buf := data
+	carried := len(t.pending)
+	if carried > 0 {
+		buf = append(t.pending, data...)
+		t.pending = nil
+	}
+
+	var events []commandEvent
+	for i := 0; i < len(buf); {
+		j := bytes.Index(buf[i:], oscStart)
+		if j < 0 {
+			if buf[len(buf)-1] == 0x1b {
+				t.pending = []byte{0x1b}
+			}
+			break
+		}
+		start := i + j
+		body, end, ok := oscBody(buf[start+len(oscStart):])
+		if !ok {
+			if len(buf)-start <= maxPendingOSC {
+				t.pending = append([]byte(nil), buf[start:]...)
+			}
+			break
+		}
+		i = start + len(oscStart) + end
+
+		if msg, ok := t.handle(string(body), now); ok {
+			pos := i - carried
+			if pos < 0 {
+				pos = 0
+			}
+			events = append(events, commandEvent{Pos: pos, Msg: msg})
+		}
+	}
+	return events
+}
+
+// oscBody returns the body of an OSC sequence and where it ends, just past
+// its BEL or ST terminator. ok is false while the terminator hasn't arrived.
+func oscBody(data []byte) (body []byte, end int, ok bool) {
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case 0x07:
+			return data[:i], i + 1, true
+		case 0x1b:
+			if i+1 == len(data) {
+				return nil, 0, false
+			}
+			if data[i+1] == '\\' {
+				return data[:i], i + 2, true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// handle applies one OSC sequence, returning the event it produces if any
+func (t *commandTracker) handle(body string, now time.Time) (TerminalMessage, bool) {
+	switch {
+	case strings.HasPrefix(body, "7;"):
+		if u, err := url.Parse(body[2:]); err == nil && u.Path != "" {
+			t.cwd = u.Path
+		}
+	case body == "133;C" || strings.HasPrefix(body, "133;C;"):
+		if !t.running {
+			t.running = true
+			t.started = now
+			return TerminalMessage{Type: "command_start", Cwd: t.cwd}, true
+		}
+	case body == "133;D" || strings.HasPrefix(body, "133;D;"):
+		// Shells mark the end of the previous command before every prompt,
+		// including the first, so only ends of started commands count
+		if t.running {
+			t.running = false
+			msg := TerminalMessage{
+				Type:       "command_end",
+				Cwd:        t.cwd,
+				DurationMs: now.Sub(t.started).Milliseconds(),
+			}
+			if code, err := strconv.Atoi(strings.TrimPrefix(body, "133;D;")); err == nil {
+				msg.ExitCode = &code
+			}
+			return msg, true
+		}
+	}
+	return TerminalMessage{}, false
+}
+
+// sendOutputWithEvents sends a chunk of PTY output with the command events
+// marked in it, each right after the output that precedes it
+func (s *TerminalSession) sendOutputWithEvents(data []byte, events []commandEvent) error {
+	sent := 0
+	for _, ev := range events {
+		if ev.Pos > sent {
+			if err := s.SendOutput(data[sent:ev.Pos]); err != nil {
+				return err
+			}
+			sent = ev.Pos
+		}
+		s.SendMessage(ev.Msg)
+	}
+	if sent < len(data) {
+		return s.SendOutput(data[sent:])
+	}
+	return nil
+}
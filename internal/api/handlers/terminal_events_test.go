@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExitSignal(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{0, ""},
+		{1, ""},
+		{128, ""},
+		{130, "INT"},
+		{137, "KILL"},
+		{143, "TERM"},
+		{162, "34"},
+	}
+
+	for _, tt := range tests {
+		if got := exitSignal(tt.code); got != tt.want {
+			t.Errorf("exitSignal(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCommandTracker_Scan(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	var tracker commandTracker
+
+	// The first prompt ends no command
+	if events := tracker.scan([]byte("\x1b]7;file://box/home/user\x07\x1b]133;D;0\x07$ "), start); len(events) != 0 {
+		t.Fatalf("scan() on first prompt = %+v, want no events", events)
+	}
+	if events := tracker.scan([]byte("plain output"), start); events != nil {
+		t.Fatalf("scan() without marks = %+v, want nil", events)
+	}
+
+	chunk := []byte("make\r\n\x1b]133;C\x07building...\r\n")
+	events := tracker.scan(chunk, start)
+	if len(events) != 1 || events[0].Msg.Type != "command_start" || events[0].Msg.Cwd != "/home/user" {
+		t.Fatalf("scan() = %+v, want one command_start in /home/user", events)
+	}
+	if got := string(chunk[:events[0].Pos]); got != "make\r\n\x1b]133;C\x07" {
+		t.Errorf("command_start at %q, want just after the mark", got)
+	}
+
+	// The end mark arrives split across two chunks, terminated by ST
+	if events := tracker.scan([]byte("done\r\n\x1b]7;file://box/srv\x1b\\\x1b]133;"), start.Add(time.Second)); len(events) != 0 {
+		t.Fatalf("scan() on partial mark = %+v, want no events", events)
+	}
+	events = tracker.scan([]byte("D;2\x1b\\$ "), start.Add(1500*time.Millisecond))
+	if len(events) != 1 {
+		t.Fatalf("scan() = %+v, want one command_end", events)
+	}
+	end := events[0]
+	if end.Msg.Type != "command_end" || end.Msg.ExitCode == nil || *end.Msg.ExitCode != 2 ||
+		end.Msg.Cwd != "/srv" || end.Msg.DurationMs != 1500 || end.Pos != 5 {
+		t.Errorf("command_end = %+v at %d, want exit 2 in /srv after 1500ms at 5", end.Msg, end.Pos)
+	}
+}
+
+func TestOSCBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		body   string
+		end    int
+		wantOK bool
+	}{
+		{"BEL", "133;C\x07rest", "133;C", 6, true},
+		{"ST", "133;D;1\x1b\\rest", "133;D;1", 9, true},
+		{"Unterminated", "133;D;1", "", 0, false},
+		{"Split ST", "133;D\x1b", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, end, ok := oscBody([]byte(tt.data))
+			if string(body) != tt.body || end != tt.end || ok != tt.wantOK {
+				t.Errorf("oscBody(%q) = %q, %d, %v, want %q, %d, %v", tt.data, body, end, ok, tt.body, tt.end, tt.wantOK)
+			}
+		})
+	}
+}
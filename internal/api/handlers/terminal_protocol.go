@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Terminal WebSocket subprotocols. rexec.v1 sends everything as JSON
+// TerminalMessages. rexec.v2 sends PTY I/O and its control messages as
+// binary frames: one type byte followed by the payload. Other messages
+// (stats, container_status, resume_token...) stay JSON text frames.
+const (
+	terminalProtocolV1 = "rexec.v1"
+	terminalProtocolV2 = "rexec.v2"
+)
+
+// rexec.v2 frame types
+const (
+	// frameData carries raw PTY output (server to client) or input (client
+	// to server)
+	frameData byte = 0x00
+	// frameResize carries cols and rows as big-endian uint16s
+	frameResize byte = 0x01
+	// framePing and framePong carry an opaque payload the pong echoes
+	framePing byte = 0x02
+	framePong byte = 0x03
+	// frameAck carries the big-endian uint64 output offset the client has
+	// processed
+	frameAck byte = 0x04
+	// frameExit carries the shell's exit code as a big-endian int32,
+	// followed by the name of the signal that killed it, if any
+	frameExit byte = 0x05
+)
+
+const (
+	// flowWindow is how much output a rexec.v2 client may leave
+	// unacknowledged before the server stops reading from the PTY
+	flowWindow = 1024 * 1024
+	// compressMinSize is the smallest rexec.v2 frame that is compressed
+	// when the client negotiated permessage-deflate. Keystroke echoes and
+	// prompts aren't worth the CPU.
+	compressMinSize = 4 * 1024
+)
+
+var errBadFrame = errors.New("malformed terminal frame")
+
+// negotiateTerminalProtocol picks the subprotocol to answer a
+// Sec-WebSocket-Protocol header with, preferring rexec.v2. It returns ""
+// for clients that offer neither.
+func negotiateTerminalProtocol(requested string) string {
+	selected := ""
+	for _, p := range strings.Split(requested, ",") {
+		switch strings.TrimSpace(p) {
+		case terminalProtocolV2:
+			return terminalProtocolV2
+		case terminalProtocolV1:
+			selected = terminalProtocolV1
+		}
+	}
+	return selected
+}
+
+// isProtocolV2 reports whether conn negotiated rexec.v2
+func isProtocolV2(conn *websocket.Conn) bool {
+	return conn.Subprotocol() == terminalProtocolV2
+}
+
+// terminalFrame is a decoded rexec.v2 binary frame
+type terminalFrame struct {
+	Type    byte
+	Payload []byte
+}
+
+// decodeFrame splits a binary message into its type and payload
+func decodeFrame(message []byte) (terminalFrame, error) {
+	if len(message) == 0 {
+		return terminalFrame{}, errBadFrame
+	}
+	f := terminalFrame{Type: message[0], Payload: message[1:]}
+	switch f.Type {
+	case frameResize:
+		if len(f.Payload) != 4 {
+			return terminalFrame{}, errBadFrame
+		}
+	case frameAck:
+		if len(f.Payload) != 8 {
+			return terminalFrame{}, errBadFrame
+		}
+	}
+	return f, nil
+}
+
+// size returns the cols and rows of a resize frame
+func (f terminalFrame) size() (uint, uint) {
+	return uint(binary.BigEndian.Uint16(f.Payload)), uint(binary.BigEndian.Uint16(f.Payload[2:]))
+}
+
+// offset returns the offset of an ack frame
+func (f terminalFrame) offset() uint64 {
+	return binary.BigEndian.Uint64(f.Payload)
+}
+
+// writeFrame sends a rexec.v2 frame. Large frames are compressed when the
+// client negotiated permessage-deflate; small ones never are.
+func writeFrame(conn *websocket.Conn, frameType byte, payload []byte) error {
+	conn.EnableWriteCompression(len(payload)+1 >= compressMinSize)
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	w, err := conn.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{frameType}); err != nil {
+		w.Close()
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// exitPayload encodes an exit code for a frameExit frame
+func exitPayload(code int) []byte {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(int32(code)))
+	return append(payload, exitSignal(code)...)
+}
+
+// configureProtocolV2 sets up a rexec.v2 connection, which compresses
+// per frame at the fastest level instead of every message
+func configureProtocolV2(conn *websocket.Conn) {
+	conn.EnableWriteCompression(false)
+	conn.SetCompressionLevel(flate.BestSpeed)
+}
+
+// terminalText prepares PTY output for a rexec.v1 JSON message, which must
+// be valid UTF-8 and is shown without mouse tracking reports
+func terminalText(data []byte) string {
+	text := string(data)
+	if !isValidUTF8Fast(data) {
+		text = sanitizeUTF8(data)
+	}
+	return filterMouseTracking(text)
+}
+
+// SendOutput forwards PTY output to the client: a data frame on rexec.v2,
+// or a sanitized JSON output message on rexec.v1
+func (s *TerminalSession) SendOutput(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	if !s.v2 {
+		msg := TerminalMessage{Type: "output", Data: terminalText(data)}
+		if s.output != nil {
+			msg.Offset = s.output.Write([]byte(msg.Data))
+		}
+		if s.detached {
+			return nil
+		}
+		s.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return s.Conn.WriteJSON(msg)
+	}
+
+	if s.output != nil {
+		s.output.Write(data)
+	}
+	if s.detached {
+		return nil
+	}
+	return writeFrame(s.Conn, frameData, data)
+}
+
+// sendExitStatus tells the client how the shell exited: an exit frame on
+// rexec.v2, an exit event on rexec.v1
+func (s *TerminalSession) sendExitStatus(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.detached {
+		return
+	}
+	if s.v2 {
+		writeFrame(s.Conn, frameExit, exitPayload(code))
+		return
+	}
+	s.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	s.Conn.WriteJSON(exitMessage(code))
+}
+
+// sendPong answers a rexec.v2 ping frame
+func (s *TerminalSession) sendPong(payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.detached {
+		return
+	}
+	writeFrame(s.Conn, framePong, payload)
+}
+
+// usesV2 reports whether the attached client speaks rexec.v2
+func (s *TerminalSession) usesV2() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.v2
+}
+
+// ack records the output a rexec.v2 client has processed and wakes a
+// reader waiting for window
+func (s *TerminalSession) ack(offset uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.output != nil && offset > s.output.Offset() {
+		offset = s.output.Offset()
+	}
+	if offset > s.acked {
+		s.acked = offset
+	}
+	s.wakeFlow()
+}
+
+// awaitWindow blocks while a rexec.v2 client has a full window of output
+// unacknowledged, so a slow client stalls the PTY instead of the server
+// buffering for it. Detached sessions and v1 clients never wait.
+func (s *TerminalSession) awaitWindow(done <-chan struct{}) {
+	for {
+		s.mu.Lock()
+		if s.closed || s.detached || !s.v2 || s.output == nil || s.output.Offset()-s.acked < flowWindow {
+			s.mu.Unlock()
+			return
+		}
+		if s.flowWake == nil {
+			s.flowWake = make(chan struct{})
+		}
+		wake := s.flowWake
+		s.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-done:
+			return
+		case <-s.Done:
+			return
+		}
+	}
+}
+
+// wakeFlow releases readers blocked in awaitWindow. Callers hold s.mu.
+func (s *TerminalSession) wakeFlow() {
+	if s.flowWake != nil {
+		close(s.flowWake)
+		s.flowWake = nil
+	}
+}
+
+// replayFrames is replayOutput for rexec.v2 clients
+func replayFrames(conn *websocket.Conn, output *scrollback, token string, offset uint64) {
+	data, start := output.Since(offset)
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	conn.WriteJSON(TerminalMessage{Type: "resumed", Data: token, Offset: start})
+	if len(data) > 0 {
+		writeFrame(conn, frameData, data)
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNegotiateTerminalProtocol(t *testing.T) {
+	tests := []struct {
+		requested string
+		want      string
+	}{
+		{"", ""},
+		{"rexec.v1", "rexec.v1"},
+		{"rexec.v1, rexec.token.abc", "rexec.v1"},
+		{"rexec.v1, rexec.v2, rexec.token.abc", "rexec.v2"},
+		{"rexec.v2", "rexec.v2"},
+		{"rexec.token.rexec.v2x", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateTerminalProtocol(tt.requested); got != tt.want {
+			t.Errorf("negotiateTerminalProtocol(%q) = %q, want %q", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+		wantErr bool
+	}{
+		{"Empty", nil, true},
+		{"Data", []byte{frameData, 'l', 's', '\n'}, false},
+		{"Empty data", []byte{frameData}, false},
+		{"Resize", []byte{frameResize, 0, 120, 0, 40}, false},
+		{"Short resize", []byte{frameResize, 0, 120}, true},
+		{"Ack", []byte{frameAck, 0, 0, 0, 0, 0, 0, 1, 0}, false},
+		{"Short ack", []byte{frameAck, 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeFrame(tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeFrame() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	resize, _ := decodeFrame([]byte{frameResize, 1, 44, 0, 50})
+	if cols, rows := resize.size(); cols != 300 || rows != 50 {
+		t.Errorf("size() = %d, %d, want 300, 50", cols, rows)
+	}
+	ack, _ := decodeFrame([]byte{frameAck, 0, 0, 0, 0, 0, 0, 1, 0})
+	if got := ack.offset(); got != 256 {
+		t.Errorf("offset() = %d, want 256", got)
+	}
+}
+
+func TestTerminalSession_AwaitWindow(t *testing.T) {
+	session := &TerminalSession{
+		Done:   make(chan struct{}),
+		v2:     true,
+		output: newScrollback(1024),
+	}
+	session.output.Write(make([]byte, flowWindow))
+
+	released := make(chan struct{})
+	go func() {
+		session.awaitWindow(nil)
+		close(released)
+	}()
+
+	select {
+	case <-released:
+		t.Fatal("awaitWindow() returned with a full window unacknowledged")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	session.ack(1)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("awaitWindow() still blocked after an ack")
+	}
+
+	// Acks past the output sent are clamped
+	session.ack(flowWindow * 2)
+	if session.acked != flowWindow {
+		t.Errorf("acked = %d, want %d", session.acked, flowWindow)
+	}
+
+	// v1 clients never wait
+	session.v2 = false
+	session.acked = 0
+	session.awaitWindow(nil)
+}
+
+func TestWriteFrame(t *testing.T) {
+	received := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, http.Header{"Sec-WebSocket-Protocol": {terminalProtocolV2}})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		configureProtocolV2(conn)
+		writeFrame(conn, frameData, []byte("hello"))
+		writeFrame(conn, frameData, bytes.Repeat([]byte("x"), compressMinSize))
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{terminalProtocolV2}, EnableCompression: true}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	if !isProtocolV2(conn) {
+		t.Fatalf("negotiated %q, want %q", conn.Subprotocol(), terminalProtocolV2)
+	}
+
+	for i := 0; i < 2; i++ {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+		if messageType != websocket.BinaryMessage {
+			t.Fatalf("message type = %d, want binary", messageType)
+		}
+		received <- message
+	}
+
+	frame, _ := decodeFrame(<-received)
+	if frame.Type != frameData || string(frame.Payload) != "hello" {
+		t.Errorf("first frame = %d %q, want data %q", frame.Type, frame.Payload, "hello")
+	}
+	frame, _ = decodeFrame(<-received)
+	if frame.Type != frameData || len(frame.Payload) != compressMinSize {
+		t.Errorf("second frame = %d with %d bytes, want data with %d", frame.Type, len(frame.Payload), compressMinSize)
+	}
+}
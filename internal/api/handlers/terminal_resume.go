@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// scrollbackSize is how much recent output each terminal session keeps
+	// for replay after a reconnect
+	scrollbackSize = 256 * 1024
+	// resumeWindow is how long a terminal's shell stays alive after its
+	// WebSocket drops, waiting for the client to come back
+	resumeWindow = 2 * time.Minute
+)
+
+// scrollback is a fixed-size ring buffer of terminal output. Offsets count
+// bytes from the start of the session's output, so clients can ask for
+// everything after the last offset they saw. It is not safe for concurrent
+// use; callers hold the session lock.
+type scrollback struct {
+	buf []byte
+	end uint64 // offset just past the newest byte
+}
+
+func newScrollback(size int) *scrollback {
+	return &scrollback{buf: make([]byte, size)}
+}
+
+// Write appends data and returns the offset just past it
+func (b *scrollback) Write(data []byte) uint64 {
+	size := len(b.buf)
+	if len(data) > size {
+		b.end += uint64(len(data) - size)
+		data = data[len(data)-size:]
+	}
+	pos := int(b.end % uint64(size))
+	n := copy(b.buf[pos:], data)
+	copy(b.buf, data[n:])
+	b.end += uint64(len(data))
+	return b.end
+}
+
+// Offset returns the offset just past the newest byte
+func (b *scrollback) Offset() uint64 {
+	return b.end
+}
+
+// Since returns the output after offset and the offset it starts at. When
+// part of that output has already been overwritten, the returned start is
+// later than offset.
+func (b *scrollback) Since(offset uint64) ([]byte, uint64) {
+	size := uint64(len(b.buf))
+	start := uint64(0)
+	if b.end > size {
+		start = b.end - size
+	}
+	if offset < start {
+		offset = start
+	}
+	if offset >= b.end {
+		return nil, b.end
+	}
+
+	out := make([]byte, b.end-offset)
+	pos := offset % size
+	n := copy(out, b.buf[pos:])
+	copy(out[n:], b.buf)
+	return out, offset
+}
+
+// textSince is Since for JSON output, which must start on a rune boundary
+func (b *scrollback) textSince(offset uint64) (string, uint64) {
+	data, start := b.Since(offset)
+	for len(data) > 0 && !utf8.RuneStart(data[0]) {
+		data = data[1:]
+		start++
+	}
+	return string(data), start
+}
+
+// resumeState tracks the client of a resumable terminal session. A session
+// whose WebSocket drops keeps running for the resume window; a client
+// presenting the session's token within it takes over where it left off.
+type resumeState struct {
+	token      string
+	userID     string
+	terminalID string
+	window     time.Duration
+	// attach hands the session to a reconnecting client and replays the
+	// output after offset. It runs before waiters are released.
+	attach func(conn *websocket.Conn, offset uint64)
+
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	attached bool
+	ended    bool
+	deadline time.Time
+	resumed  chan struct{}
+	stop     chan struct{}
+}
+
+// awaitResume is called when reading from conn fails. It returns true once
+// another client has taken the session over, and false when the window
+// passes, done closes or the session is ended.
+func (s *resumeState) awaitResume(conn *websocket.Conn, done <-chan struct{}) bool {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return false
+	}
+	if s.conn != conn {
+		// Already taken over while the old connection was still open
+		s.mu.Unlock()
+		return true
+	}
+	if s.attached {
+		s.attached = false
+		s.deadline = time.Now().Add(s.window)
+	}
+	resumed, deadline := s.resumed, s.deadline
+	s.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-resumed:
+		return true
+	case <-s.stop:
+		return false
+	case <-done:
+		return false
+	case <-timer.C:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.conn != conn {
+			return true
+		}
+		s.end()
+		return false
+	}
+}
+
+// end stops the session from being resumed. Callers hold s.mu.
+func (s *resumeState) end() {
+	if !s.ended {
+		s.ended = true
+		close(s.stop)
+	}
+}
+
+// resumeRegistry maps resume tokens to their sessions
+type resumeRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*resumeState
+	window   time.Duration
+}
+
+func newResumeRegistry(window time.Duration) *resumeRegistry {
+	return &resumeRegistry{
+		sessions: make(map[string]*resumeState),
+		window:   window,
+	}
+}
+
+// register makes a session resumable by the user that opened it
+func (r *resumeRegistry) register(userID, terminalID string, conn *websocket.Conn, attach func(*websocket.Conn, uint64)) *resumeState {
+	tokenBytes := make([]byte, 24)
+	rand.Read(tokenBytes)
+
+	s := &resumeState{
+		token:      hex.EncodeToString(tokenBytes),
+		userID:     userID,
+		terminalID: terminalID,
+		window:     r.window,
+		attach:     attach,
+		conn:       conn,
+		attached:   true,
+		resumed:    make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.sessions[s.token] = s
+	r.mu.Unlock()
+	return s
+}
+
+// drop ends a session and forgets its token
+func (r *resumeRegistry) drop(s *resumeState) {
+	if s == nil {
+		return
+	}
+	r.mu.Lock()
+	delete(r.sessions, s.token)
+	r.mu.Unlock()
+
+	s.mu.Lock()
+	s.end()
+	s.mu.Unlock()
+}
+
+// has reports whether token belongs to a resumable session of userID's on
+// terminalID
+func (r *resumeRegistry) has(token, userID, terminalID string) bool {
+	r.mu.Lock()
+	s, ok := r.sessions[token]
+	r.mu.Unlock()
+	if !ok || s.userID != userID || s.terminalID != terminalID {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.ended
+}
+
+// claim hands the session behind token to conn. It fails for unknown or
+// ended sessions and for tokens issued to a different user or terminal.
+func (r *resumeRegistry) claim(token, userID, terminalID string, conn *websocket.Conn, offset uint64) bool {
+	r.mu.Lock()
+	s, ok := r.sessions[token]
+	r.mu.Unlock()
+	if !ok || s.userID != userID || s.terminalID != terminalID {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return false
+	}
+	s.attach(conn, offset)
+	s.conn = conn
+	s.attached = true
+	close(s.resumed)
+	s.resumed = make(chan struct{})
+	return true
+}
+
+// resumeRequest returns the resume token and offset a reconnecting client
+// passed, if any
+func resumeRequest(c *gin.Context) (string, uint64) {
+	offset, _ := strconv.ParseUint(c.Query("offset"), 10, 64)
+	return c.Query("resume"), offset
+}
+
+// isResumableDrop reports whether a read error should keep the session
+// around for a reconnect. Clients ending a session close cleanly.
+func isResumableDrop(err error) bool {
+	return !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived)
+}
+
+// replayOutput tells a resumed client where its replay starts and sends it
+// the output after offset
+func replayOutput(conn *websocket.Conn, output *scrollback, token string, offset uint64, binary bool) {
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if binary {
+		data, start := output.Since(offset)
+		conn.WriteJSON(TerminalMessage{Type: "resumed", Data: token, Offset: start})
+		if len(data) > 0 {
+			conn.WriteMessage(websocket.BinaryMessage, data)
+		}
+		return
+	}
+
+	data, start := output.textSince(offset)
+	conn.WriteJSON(TerminalMessage{Type: "resumed", Data: token, Offset: start})
+	if data != "" {
+		conn.WriteJSON(TerminalMessage{Type: "output", Data: data, Offset: output.Offset()})
+	}
+}
+
+// makeResumable gives a session a scrollback buffer and a resume token.
+// VM terminals send raw output as binary messages, so binary selects how
+// the buffer is replayed.
+func (h *TerminalHandler) makeResumable(session *TerminalSession, binary bool) {
+	session.output = newScrollback(scrollbackSize)
+	session.resume = h.resumable.register(session.UserID, session.ContainerID, session.Conn, func(conn *websocket.Conn, offset uint64) {
+		session.attach(conn, offset, binary)
+	})
+}
+
+// resumeTerminal hands a dropped session to conn if the client passed a
+// valid resume token for terminalID
+func (h *TerminalHandler) resumeTerminal(c *gin.Context, userID, terminalID string, conn *websocket.Conn) bool {
+	token, offset := resumeRequest(c)
+	if token == "" || !h.resumable.claim(token, userID, terminalID, conn, offset) {
+		return false
+	}
+	log.Printf("[Terminal] Resumed session for %s (user %s) from offset %d", terminalID, userID, offset)
+	return true
+}
+
+// awaitResume keeps a session whose WebSocket failed alive until a client
+// resumes it. It returns false when the session should end instead.
+func (h *TerminalHandler) awaitResume(session *TerminalSession, conn *websocket.Conn, err error, done <-chan struct{}) bool {
+	if session.resume == nil || !isResumableDrop(err) {
+		return false
+	}
+	session.detach(conn)
+	if session.resume.awaitResume(conn, done) {
+		return true
+	}
+	log.Printf("[Terminal] Session for %s (user %s) was not resumed", session.ContainerID, session.UserID)
+	return false
+}
+
+// currentConn returns the WebSocket the session is attached to
+func (s *TerminalSession) currentConn() *websocket.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Conn
+}
+
+// detach stops writing to conn after it failed. Output is only buffered
+// until a client resumes the session.
+func (s *TerminalSession) detach(conn *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Conn == conn {
+		s.detached = true
+		s.wakeFlow()
+		conn.Close()
+	}
+}
+
+// attach moves the session to conn and replays the output after offset
+func (s *TerminalSession) attach(conn *websocket.Conn, offset uint64, binary bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Conn != conn {
+		s.Conn.Close()
+	}
+	s.Conn = conn
+	s.detached = false
+	if s.closed {
+		conn.Close()
+		return
+	}
+
+	// The new client may speak another protocol, and the old one's
+	// acknowledgements no longer apply
+	s.v2 = isProtocolV2(conn)
+	s.acked = s.output.Offset()
+	s.wakeFlow()
+	if s.v2 {
+		replayFrames(conn, s.output, s.resume.token, offset)
+		return
+	}
+	replayOutput(conn, s.output, s.resume.token, offset, binary)
+}
+
+// sendResumeToken tells the client how to resume the session after a drop
+func (s *TerminalSession) sendResumeToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.detached {
+		return
+	}
+	s.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	s.Conn.WriteJSON(TerminalMessage{Type: "resume_token", Data: s.resume.token, Offset: s.output.Offset()})
+}
+
+// awaitResume keeps an agent session whose WebSocket failed subscribed to
+// its shell until a client resumes it
+func (h *AgentHandler) awaitResume(session *AgentSession, conn *websocket.Conn, err error) bool {
+	if session.resume == nil || !isResumableDrop(err) {
+		return false
+	}
+	session.detach(conn)
+	if session.resume.awaitResume(conn, nil) {
+		return true
+	}
+	log.Printf("[Agent] Session %s on agent %s was not resumed", session.ID, session.AgentID)
+	return false
+}
+
+// currentConn returns the WebSocket the session is attached to
+func (s *AgentSession) currentConn() *websocket.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.UserConn
+}
+
+// detach stops writing to conn after it failed
+func (s *AgentSession) detach(conn *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.UserConn == conn {
+		s.detached = true
+		conn.Close()
+	}
+}
+
+// attach moves the session to conn and replays the output after offset
+func (s *AgentSession) attach(conn *websocket.Conn, offset uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.UserConn != conn {
+		s.UserConn.Close()
+	}
+	s.UserConn = conn
+	s.detached = false
+	replayOutput(conn, s.output, s.resume.token, offset, false)
+}
+
+// send writes v to the session's client unless it is detached
+func (s *AgentSession) send(v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.detached || s.UserConn == nil {
+		return
+	}
+	s.UserConn.WriteJSON(v)
+}
+
+// sendOutput buffers shell output and forwards it to the client
+func (s *AgentSession) sendOutput(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := TerminalMessage{Type: "output", Data: string(data)}
+	if s.output != nil {
+		msg.Offset = s.output.Write(data)
+	}
+	if s.detached || s.UserConn == nil {
+		return
+	}
+	s.UserConn.WriteJSON(msg)
+}
+
+// sendResumeToken tells the client how to resume the session after a drop
+func (s *AgentSession) sendResumeToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.detached {
+		return
+	}
+	s.UserConn.WriteJSON(TerminalMessage{Type: "resume_token", Data: s.resume.token, Offset: s.output.Offset()})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestScrollback_Since(t *testing.T) {
+	tests := []struct {
+		name      string
+		writes    []string
+		offset    uint64
+		want      string
+		wantStart uint64
+	}{
+		{"Everything", []string{"abc", "de"}, 0, "abcde", 0},
+		{"After offset", []string{"abc", "de"}, 3, "de", 3},
+		{"Up to date", []string{"hello"}, 5, "", 5},
+		{"Offset past end", []string{"hello"}, 9, "", 5},
+		{"Wraps around", []string{"abcdef", "ghij"}, 4, "efghij", 4},
+		{"Overwritten output skipped", []string{"abcdef", "ghij"}, 0, "cdefghij", 2},
+		{"Write larger than buffer", []string{"abcdefghijkl"}, 0, "efghijkl", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newScrollback(8)
+			for _, w := range tt.writes {
+				b.Write([]byte(w))
+			}
+			got, start := b.Since(tt.offset)
+			if string(got) != tt.want || start != tt.wantStart {
+				t.Errorf("Since(%d) = %q, %d, want %q, %d", tt.offset, got, start, tt.want, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestScrollback_TextSinceRuneBoundary(t *testing.T) {
+	b := newScrollback(8)
+	b.Write([]byte("abcdefgé"))
+	if got, start := b.textSince(0); got != "bcdefgé" || start != 1 {
+		t.Errorf("textSince(0) = %q, %d, want %q, 1", got, start, "bcdefgé")
+	}
+
+	// The oldest byte left is the second half of é
+	b.Write([]byte("1234567"))
+	if got, start := b.textSince(0); got != "1234567" || start != 9 {
+		t.Errorf("textSince(0) = %q, %d, want %q, 9", got, start, "1234567")
+	}
+}
+
+func TestResumeRegistry_Claim(t *testing.T) {
+	r := newResumeRegistry(time.Minute)
+	first := &websocket.Conn{}
+	var attached *websocket.Conn
+	var attachedAt uint64
+	s := r.register("user-1", "container-1", first, func(conn *websocket.Conn, offset uint64) {
+		attached, attachedAt = conn, offset
+	})
+
+	tests := []struct {
+		name       string
+		token      string
+		userID     string
+		terminalID string
+		want       bool
+	}{
+		{"Unknown token", "nope", "user-1", "container-1", false},
+		{"Other user", s.token, "user-2", "container-1", false},
+		{"Other terminal", s.token, "user-1", "container-2", false},
+		{"Owner", s.token, "user-1", "container-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &websocket.Conn{}
+			got := r.claim(tt.token, tt.userID, tt.terminalID, conn, 42)
+			if got != tt.want {
+				t.Fatalf("claim() = %v, want %v", got, tt.want)
+			}
+			if got && (attached != conn || attachedAt != 42) {
+				t.Error("claim() should attach the new connection at the requested offset")
+			}
+		})
+	}
+
+	r.drop(s)
+	if r.claim(s.token, "user-1", "container-1", &websocket.Conn{}, 0) {
+		t.Error("claim() should fail once the session is dropped")
+	}
+}
+
+func TestResumeState_AwaitResume(t *testing.T) {
+	t.Run("Resumed", func(t *testing.T) {
+		r := newResumeRegistry(time.Minute)
+		conn := &websocket.Conn{}
+		s := r.register("user-1", "container-1", conn, func(*websocket.Conn, uint64) {})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			r.claim(s.token, "user-1", "container-1", &websocket.Conn{}, 0)
+		}()
+		if !s.awaitResume(conn, nil) {
+			t.Error("awaitResume() = false, want true after a claim")
+		}
+	})
+
+	t.Run("Already taken over", func(t *testing.T) {
+		r := newResumeRegistry(time.Minute)
+		conn := &websocket.Conn{}
+		s := r.register("user-1", "container-1", conn, func(*websocket.Conn, uint64) {})
+		r.claim(s.token, "user-1", "container-1", &websocket.Conn{}, 0)
+
+		if !s.awaitResume(conn, nil) {
+			t.Error("awaitResume() on a replaced connection = false, want true")
+		}
+	})
+
+	t.Run("Window expires", func(t *testing.T) {
+		r := newResumeRegistry(10 * time.Millisecond)
+		conn := &websocket.Conn{}
+		s := r.register("user-1", "container-1", conn, func(*websocket.Conn, uint64) {})
+
+		if s.awaitResume(conn, nil) {
+			t.Error("awaitResume() = true, want false after the window")
+		}
+		if r.claim(s.token, "user-1", "container-1", &websocket.Conn{}, 0) {
+			t.Error("claim() should fail after the window")
+		}
+	})
+
+	t.Run("Dropped", func(t *testing.T) {
+		r := newResumeRegistry(time.Minute)
+		conn := &websocket.Conn{}
+		s := r.register("user-1", "container-1", conn, func(*websocket.Conn, uint64) {})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			r.drop(s)
+		}()
+		if s.awaitResume(conn, nil) {
+			t.Error("awaitResume() = true, want false once dropped")
+		}
+	})
+}
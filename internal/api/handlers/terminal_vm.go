@@ -49,6 +49,21 @@ func (h *TerminalHandler) handleVMWebSocket(c *gin.Context, terminalID, userID s
 		return
 	}
 
+	// A client coming back after a dropped connection takes over its
+	// detached session instead of opening a second console
+	if token, _ := resumeRequest(c); token != "" && h.resumable.has(token, userID, terminalID) {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Printf("[Terminal] WebSocket upgrade failed for VM %s: %v", vmID, err)
+			return
+		}
+		if !h.resumeTerminal(c, userID, terminalID, conn) {
+			conn.WriteJSON(TerminalMessage{Type: "error", Data: "Session can no longer be resumed"})
+			conn.Close()
+		}
+		return
+	}
+
 	// Get terminal size from query params
 	cols := uint16(80)
 	rows := uint16(24)
@@ -78,7 +93,6 @@ func (h *TerminalHandler) handleVMWebSocket(c *gin.Context, terminalID, userID s
 		log.Printf("[Terminal] WebSocket upgrade failed for VM %s: %v", vmID, err)
 		return
 	}
-	defer conn.Close()
 
 	log.Printf("[Terminal] WebSocket connected for VM %s (user: %s)", vmID, userID)
 
@@ -94,9 +108,12 @@ func (h *TerminalHandler) handleVMWebSocket(c *gin.Context, terminalID, userID s
 		IsOwner:     true,
 	}
 
+	h.makeResumable(session, true)
+
 	h.mu.Lock()
 	h.sessions[terminalID] = session
 	h.mu.Unlock()
+	session.sendResumeToken()
 
 	// Handle terminal I/O
 	go h.handleVMOutput(session, termConn.Reader)
@@ -104,8 +121,12 @@ func (h *TerminalHandler) handleVMWebSocket(c *gin.Context, terminalID, userID s
 
 	// Cleanup
 	h.mu.Lock()
-	delete(h.sessions, terminalID)
+	if current, ok := h.sessions[terminalID]; ok && current == session {
+		delete(h.sessions, terminalID)
+	}
 	h.mu.Unlock()
+	h.resumable.drop(session.resume)
+	session.Close()
 }
 
 // handleVMOutput forwards output from VM to WebSocket
@@ -119,11 +140,11 @@ func (h *TerminalHandler) handleVMOutput(session *TerminalSession, reader io.Rea
 			n, err := reader.Read(buf)
 			if n > 0 {
 				session.mu.Lock()
-				if !session.closed {
+				session.output.Write(buf[:n])
+				if !session.closed && !session.detached {
 					if err := session.Conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+						// Keep buffering; the input side notices the drop
 						log.Printf("[Terminal] Failed to write VM output: %v", err)
-						session.mu.Unlock()
-						return
 					}
 				}
 				session.mu.Unlock()
@@ -145,11 +166,15 @@ func (h *TerminalHandler) handleVMInput(session *TerminalSession, writer io.Writ
 		case <-session.Done:
 			return
 		default:
-			messageType, data, err := session.Conn.ReadMessage()
+			conn := session.currentConn()
+			messageType, data, err := conn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					log.Printf("[Terminal] VM WebSocket error: %v", err)
 				}
+				if h.awaitResume(session, conn, err, session.Done) {
+					continue
+				}
 				return
 			}
 
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rexec/rexec/internal/models"
 	"github.com/rexec/rexec/internal/storage"
 )
 
@@ -50,7 +51,25 @@ func (h *TokenHandler) CreateToken(c *gin.Context) {
 	// Default scopes
 	scopes := req.Scopes
 	if len(scopes) == 0 {
-		scopes = []string{"read", "write"}
+		scopes = models.DefaultTokenScopes
+	}
+
+	for _, scope := range scopes {
+		if !models.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope: " + scope})
+			return
+		}
+	}
+
+	// A token can't mint another token with more access than it has itself
+	if c.GetBool("api_token") {
+		granted := c.GetStringSlice("api_token_scopes")
+		for _, scope := range scopes {
+			if !models.HasScope(granted, scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "cannot grant scope not held by the current token: " + scope})
+				return
+			}
+		}
 	}
 
 	token, plainToken, err := h.store.GenerateAPIToken(c.Request.Context(), userID, req.Name, scopes, expiresAt)
@@ -0,0 +1,642 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/container"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// CreateVolumeRequest represents a request to create a shared volume
+type CreateVolumeRequest struct {
+	Name   string `json:"name" binding:"required"`
+	SizeMB int64  `json:"size_mb"` // Optional - defaults to models.DefaultVolumeSizeMB
+}
+
+// UpdateVolumeRequest renames or resizes a shared volume
+type UpdateVolumeRequest struct {
+	Name   *string `json:"name"`
+	SizeMB *int64  `json:"size_mb"`
+}
+
+// ListVolumes returns the user's shared volumes and their quota
+func (h *ContainerHandler) ListVolumes(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	volumes, err := h.store.GetVolumesByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch volumes"})
+		return
+	}
+	h.fillVolumeUsage(ctx, volumes...)
+
+	limits := models.GetUserResourceLimits(c.GetString("tier"), c.GetBool("subscription_active"))
+	c.JSON(http.StatusOK, gin.H{
+		"volumes":         volumes,
+		"count":           len(volumes),
+		"limit":           limits.MaxVolumes,
+		"storage_mb":      limits.VolumeStorageMB,
+		"used_storage_mb": totalVolumeMB(volumes, ""),
+	})
+}
+
+// CreateVolume creates an empty shared volume
+func (h *ContainerHandler) CreateVolume(c *gin.Context) {
+	userID := c.GetString("userID")
+	tier := c.GetString("tier")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateVolumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if !isValidContainerName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid volume name: must be 1-64 characters, alphanumeric and hyphens only"})
+		return
+	}
+	sizeMB := req.SizeMB
+	if sizeMB == 0 {
+		sizeMB = models.DefaultVolumeSizeMB
+	}
+	if sizeMB < models.MinVolumeSizeMB {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("size_mb must be at least %d", models.MinVolumeSizeMB)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	volumes, err := h.store.GetVolumesByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check volume limit"})
+		return
+	}
+	for _, vol := range volumes {
+		if vol.Name == name {
+			c.JSON(http.StatusConflict, gin.H{"error": "volume with this name already exists", "name": name})
+			return
+		}
+	}
+
+	// Enforce per-tier volume quotas
+	limits := models.GetUserResourceLimits(tier, c.GetBool("subscription_active"))
+	if int64(len(volumes)) >= limits.MaxVolumes {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "volume limit reached",
+			"current": len(volumes),
+			"limit":   limits.MaxVolumes,
+			"tier":    tier,
+			"message": "Delete an existing volume or upgrade your plan to create more volumes",
+		})
+		return
+	}
+	if used := totalVolumeMB(volumes, ""); used+sizeMB > limits.VolumeStorageMB {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":     "volume storage limit reached",
+			"used_mb":   used,
+			"limit_mb":  limits.VolumeStorageMB,
+			"available": limits.VolumeStorageMB - used,
+			"tier":      tier,
+			"message":   "Use a smaller size, shrink or delete another volume, or upgrade your plan",
+		})
+		return
+	}
+
+	vol := &storage.VolumeRecord{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Name:        name,
+		SizeMB:      sizeMB,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		Attachments: []*storage.VolumeAttachment{},
+	}
+	vol.DockerVolume, err = h.manager.CreateSharedVolume(ctx, userID, vol.ID)
+	if err != nil {
+		log.Printf("[Volumes] Failed to create volume %s for user %s: %v", name, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+	if err := h.store.CreateVolume(ctx, vol); err != nil {
+		h.manager.RemoveSharedVolume(ctx, vol.DockerVolume)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create volume record"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, vol)
+}
+
+// GetVolume returns a shared volume and the terminals it's attached to
+func (h *ContainerHandler) GetVolume(c *gin.Context) {
+	vol, ok := h.userVolume(c)
+	if !ok {
+		return
+	}
+	h.fillVolumeUsage(c.Request.Context(), vol)
+	c.JSON(http.StatusOK, vol)
+}
+
+// UpdateVolume renames or resizes a shared volume. Sizes are held by the
+// volume quota service rather than the volume driver, so resizing takes
+// effect without remounting.
+func (h *ContainerHandler) UpdateVolume(c *gin.Context) {
+	vol, ok := h.userVolume(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateVolumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	name, sizeMB := vol.Name, vol.SizeMB
+
+	if req.Name != nil && strings.TrimSpace(*req.Name) != vol.Name {
+		name = strings.TrimSpace(*req.Name)
+		if !isValidContainerName(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid volume name: must be 1-64 characters, alphanumeric and hyphens only"})
+			return
+		}
+		existing, err := h.store.GetVolume(ctx, vol.UserID, name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check volume name"})
+			return
+		}
+		if existing != nil && existing.ID != vol.ID {
+			c.JSON(http.StatusConflict, gin.H{"error": "volume with this name already exists", "name": name})
+			return
+		}
+	}
+
+	if req.SizeMB != nil && *req.SizeMB != vol.SizeMB {
+		sizeMB = *req.SizeMB
+		if sizeMB < models.MinVolumeSizeMB {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("size_mb must be at least %d", models.MinVolumeSizeMB)})
+			return
+		}
+
+		// Can't shrink below what's already stored
+		h.fillVolumeUsage(ctx, vol)
+		if vol.UsedBytes != nil && *vol.UsedBytes > sizeMB*1024*1024 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "volume holds more data than the requested size",
+				"used_bytes": *vol.UsedBytes,
+			})
+			return
+		}
+
+		if sizeMB > vol.SizeMB {
+			volumes, err := h.store.GetVolumesByUserID(ctx, vol.UserID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check volume limit"})
+				return
+			}
+			limits := models.GetUserResourceLimits(c.GetString("tier"), c.GetBool("subscription_active"))
+			if used := totalVolumeMB(volumes, vol.ID); used+sizeMB > limits.VolumeStorageMB {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":     "volume storage limit reached",
+					"used_mb":   used,
+					"limit_mb":  limits.VolumeStorageMB,
+					"available": limits.VolumeStorageMB - used,
+				})
+				return
+			}
+		}
+	}
+
+	if err := h.store.UpdateVolume(ctx, vol.ID, name, sizeMB); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update volume"})
+		return
+	}
+	vol.Name, vol.SizeMB, vol.UpdatedAt = name, sizeMB, time.Now()
+
+	c.JSON(http.StatusOK, vol)
+}
+
+// DeleteVolume deletes a shared volume and its data. It must be detached
+// from every terminal first.
+func (h *ContainerHandler) DeleteVolume(c *gin.Context) {
+	vol, ok := h.userVolume(c)
+	if !ok {
+		return
+	}
+	if len(vol.Attachments) > 0 {
+		names := make([]string, 0, len(vol.Attachments))
+		for _, att := range vol.Attachments {
+			names = append(names, att.ContainerName)
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "volume is attached to terminals",
+			"containers": names,
+			"message":    "Detach the volume from every terminal before deleting it",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.manager.RemoveSharedVolume(ctx, vol.DockerVolume); err != nil {
+		log.Printf("[Volumes] Failed to remove volume %s: %v", vol.DockerVolume, err)
+		c.JSON(http.StatusConflict, gin.H{"error": "volume is still in use"})
+		return
+	}
+	if err := h.store.DeleteVolume(ctx, vol.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete volume record"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "volume deleted", "id": vol.ID})
+}
+
+// AttachVolume mounts a shared volume into an existing terminal. Docker
+// can't add mounts to a container, so the terminal is recreated; its home
+// volume and other mounts are kept.
+func (h *ContainerHandler) AttachVolume(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.VolumeMountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "volume_id and path are required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	found, err := h.findUserContainer(ctx, userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify container ownership"})
+		return
+	}
+	if found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+	if found.DockerID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "container is still being created"})
+		return
+	}
+
+	existing, err := h.store.GetContainerVolumeMounts(ctx, found.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch container volumes"})
+		return
+	}
+	added, status, err := h.resolveVolumeMounts(ctx, userID, []models.VolumeMountRequest{req}, existing)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.recordVolumeAttachments(ctx, found.ID, added); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to attach volume"})
+		return
+	}
+
+	mounts := append(existing, added...)
+	newDockerID, err := h.remountContainer(ctx, found, c.GetString("tier"), mounts)
+	if err != nil {
+		log.Printf("[Volumes] Failed to attach volume %s to %s: %v", added[0].VolumeName, found.Name, err)
+		h.store.DetachVolume(ctx, added[0].VolumeID, found.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "volume attached",
+		"id":      newDockerID,
+		"old_id":  found.DockerID,
+		"db_id":   found.ID,
+		"volumes": mounts,
+	})
+}
+
+// DetachVolume unmounts a shared volume from a terminal, which recreates it.
+// The volume's data is kept.
+func (h *ContainerHandler) DetachVolume(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	found, err := h.findUserContainer(ctx, userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify container ownership"})
+		return
+	}
+	if found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+		return
+	}
+
+	existing, err := h.store.GetContainerVolumeMounts(ctx, found.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch container volumes"})
+		return
+	}
+	volumeID := c.Param("volume_id")
+	var detached *storage.VolumeMountRecord
+	mounts := make([]*storage.VolumeMountRecord, 0, len(existing))
+	for _, m := range existing {
+		if m.VolumeID == volumeID || m.VolumeName == volumeID {
+			detached = m
+			continue
+		}
+		mounts = append(mounts, m)
+	}
+	if detached == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "volume is not attached to this container"})
+		return
+	}
+
+	newDockerID := found.DockerID
+	if found.DockerID != "" {
+		newDockerID, err = h.remountContainer(ctx, found, c.GetString("tier"), mounts)
+		if err != nil {
+			log.Printf("[Volumes] Failed to detach volume %s from %s: %v", detached.VolumeName, found.Name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": container.SanitizeError(err)})
+			return
+		}
+	}
+	if err := h.store.DetachVolume(ctx, detached.VolumeID, found.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to detach volume"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "volume detached",
+		"id":      newDockerID,
+		"old_id":  found.DockerID,
+		"db_id":   found.ID,
+		"volumes": mounts,
+	})
+}
+
+// userVolume loads the volume named by the :id param, by ID or name.
+// It writes the error response and returns false if there's no such volume.
+func (h *ContainerHandler) userVolume(c *gin.Context) (*storage.VolumeRecord, bool) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	vol, err := h.store.GetVolume(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch volume"})
+		return nil, false
+	}
+	if vol == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "volume not found"})
+		return nil, false
+	}
+	return vol, true
+}
+
+// resolveVolumeMounts checks requested mounts against the user's volumes and
+// the terminal's existing mounts. On failure it returns the HTTP status to
+// respond with.
+func (h *ContainerHandler) resolveVolumeMounts(ctx context.Context, userID string, reqs []models.VolumeMountRequest, existing []*storage.VolumeMountRecord) ([]*storage.VolumeMountRecord, int, error) {
+	if len(reqs) == 0 {
+		return nil, 0, nil
+	}
+	if len(existing)+len(reqs) > models.MaxVolumeMounts {
+		return nil, http.StatusBadRequest, fmt.Errorf("a terminal can have at most %d shared volumes", models.MaxVolumeMounts)
+	}
+
+	paths := make(map[string]bool)
+	attached := make(map[string]bool)
+	for _, m := range existing {
+		paths[m.Path] = true
+		attached[m.VolumeID] = true
+	}
+
+	var usage map[string]int64
+	mounts := make([]*storage.VolumeMountRecord, 0, len(reqs))
+	for _, req := range reqs {
+		path, err := models.CleanMountPath(req.Path)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if paths[path] {
+			return nil, http.StatusConflict, fmt.Errorf("another volume is already mounted at %s", path)
+		}
+
+		vol, err := h.store.GetVolume(ctx, userID, req.VolumeID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to fetch volume")
+		}
+		if vol == nil {
+			return nil, http.StatusNotFound, fmt.Errorf("volume %s not found", req.VolumeID)
+		}
+		if attached[vol.ID] {
+			return nil, http.StatusConflict, fmt.Errorf("volume %s is already attached to this terminal", vol.Name)
+		}
+
+		// A volume over its size can still be read, but not written to
+		if !req.ReadOnly {
+			if usage == nil {
+				if usage, err = h.manager.SharedVolumeUsage(ctx); err != nil {
+					log.Printf("[Volumes] %v", err)
+					usage = map[string]int64{}
+				}
+			}
+			if used, ok := usage[vol.DockerVolume]; ok && used > vol.SizeMB*1024*1024 {
+				return nil, http.StatusForbidden, fmt.Errorf("volume %s is over its %d MB size; resize it or attach it read-only", vol.Name, vol.SizeMB)
+			}
+		}
+
+		paths[path] = true
+		attached[vol.ID] = true
+		mounts = append(mounts, &storage.VolumeMountRecord{
+			VolumeID:     vol.ID,
+			VolumeName:   vol.Name,
+			DockerVolume: vol.DockerVolume,
+			Path:         path,
+			ReadOnly:     req.ReadOnly,
+		})
+	}
+	return mounts, 0, nil
+}
+
+// recordVolumeAttachments saves a terminal's new mounts, undoing them all if one fails
+func (h *ContainerHandler) recordVolumeAttachments(ctx context.Context, containerID string, mounts []*storage.VolumeMountRecord) error {
+	for i, m := range mounts {
+		err := h.store.AttachVolume(ctx, &storage.VolumeAttachment{
+			VolumeID:    m.VolumeID,
+			ContainerID: containerID,
+			Path:        m.Path,
+			ReadOnly:    m.ReadOnly,
+			CreatedAt:   time.Now(),
+		})
+		if err != nil {
+			for _, done := range mounts[:i] {
+				h.store.DetachVolume(ctx, done.VolumeID, containerID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// containerVolumeMounts returns the shared volumes to mount when a terminal is recreated
+func (h *ContainerHandler) containerVolumeMounts(ctx context.Context, containerID string) []container.VolumeMount {
+	mounts, err := h.store.GetContainerVolumeMounts(ctx, containerID)
+	if err != nil {
+		log.Printf("[Volumes] Failed to load volumes for container %s: %v", containerID, err)
+		return nil
+	}
+	return toVolumeMounts(mounts)
+}
+
+func toVolumeMounts(mounts []*storage.VolumeMountRecord) []container.VolumeMount {
+	if len(mounts) == 0 {
+		return nil
+	}
+	volumes := make([]container.VolumeMount, 0, len(mounts))
+	for _, m := range mounts {
+		volumes = append(volumes, container.VolumeMount{Name: m.DockerVolume, Target: m.Path, ReadOnly: m.ReadOnly})
+	}
+	return volumes
+}
+
+// remountContainer recreates a terminal with a new set of shared volumes and
+// returns its new Docker ID. A terminal that wasn't running is stopped again.
+func (h *ContainerHandler) remountContainer(ctx context.Context, found *storage.ContainerRecord, tier string, mounts []*storage.VolumeMountRecord) (string, error) {
+	var useTmux *bool
+	wasRunning := false
+	if info, ok := h.manager.GetContainer(found.DockerID); ok && info != nil {
+		if val, exists := info.Labels["rexec.use_tmux"]; exists {
+			tmuxEnabled := val == "true"
+			useTmux = &tmuxEnabled
+		}
+		wasRunning = info.Status == "running"
+	}
+
+	if err := h.manager.StopContainer(ctx, found.DockerID); err != nil {
+		log.Printf("[Volumes] Warning: failed to stop container %s: %v", found.DockerID, err)
+	}
+	if err := h.manager.RemoveContainer(ctx, found.DockerID); err != nil {
+		log.Printf("[Volumes] Warning: failed to remove container %s: %v", found.DockerID, err)
+	}
+
+	newInfo, err := h.manager.RecreateContainer(ctx, container.RecreateContainerConfig{
+		UserID:        found.UserID,
+		ContainerName: found.Name,
+		Image:         found.Image,
+		Role:          found.Role,
+		OldDockerID:   found.DockerID,
+		Tier:          tier,
+		MemoryMB:      found.MemoryMB,
+		CPUMillicores: found.CPUShares,
+		DiskMB:        found.DiskMB,
+		UseTmux:       useTmux,
+		VolumeName:    found.VolumeName,
+		Volumes:       toVolumeMounts(mounts),
+		Class:         containerResourceClass(ctx, h.store, found.ID),
+	})
+	if err != nil {
+		h.store.UpdateContainerStatus(ctx, found.ID, "error")
+		return "", err
+	}
+
+	status := "running"
+	if !wasRunning {
+		if err := h.manager.StopContainer(ctx, newInfo.ID); err == nil {
+			status = "stopped"
+		}
+	}
+	h.manager.UpdateContainerStatus(newInfo.ID, status)
+	h.store.UpdateContainerDockerID(ctx, found.ID, newInfo.ID)
+	h.store.UpdateContainerStatus(ctx, found.ID, status)
+
+	if h.eventsHub != nil {
+		h.eventsHub.NotifyContainerUpdated(found.UserID, gin.H{
+			"id":     newInfo.ID,
+			"old_id": found.DockerID,
+			"db_id":  found.ID,
+			"name":   found.Name,
+			"status": status,
+		})
+	}
+	return newInfo.ID, nil
+}
+
+// VolumeOverLimit remounts a shared volume read-only in a terminal once the
+// volume quota service finds it over its size
+func (h *ContainerHandler) VolumeOverLimit(att *storage.WritableVolumeAttachment) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	found, err := h.store.GetContainerByID(ctx, att.ContainerID)
+	if err != nil || found == nil {
+		log.Printf("[Volumes] Failed to load terminal %s to remount %s: %v", att.ContainerID, att.VolumeName, err)
+		return
+	}
+	if err := h.store.SetVolumeAttachmentReadOnly(ctx, att.VolumeID, att.ContainerID); err != nil {
+		log.Printf("[Volumes] Failed to make %s read-only in %s: %v", att.VolumeName, found.Name, err)
+		return
+	}
+	mounts, err := h.store.GetContainerVolumeMounts(ctx, found.ID)
+	if err != nil {
+		log.Printf("[Volumes] Failed to load volumes for %s: %v", found.Name, err)
+		return
+	}
+
+	var tier string
+	if info, ok := h.manager.GetContainer(found.DockerID); ok && info != nil {
+		tier = info.Labels["rexec.tier"]
+	}
+	if _, err := h.remountContainer(ctx, found, tier, mounts); err != nil {
+		log.Printf("[Volumes] Failed to remount %s read-only in %s: %v", att.VolumeName, found.Name, err)
+	}
+}
+
+// fillVolumeUsage sets UsedBytes on volumes Docker knows the size of
+func (h *ContainerHandler) fillVolumeUsage(ctx context.Context, volumes ...*storage.VolumeRecord) {
+	if len(volumes) == 0 {
+		return
+	}
+	usage, err := h.manager.SharedVolumeUsage(ctx)
+	if err != nil {
+		log.Printf("[Volumes] %v", err)
+		return
+	}
+	for _, vol := range volumes {
+		if used, ok := usage[vol.DockerVolume]; ok {
+			vol.UsedBytes = &used
+		}
+	}
+}
+
+// totalVolumeMB adds up the sizes of a user's volumes, leaving out skipID
+func totalVolumeMB(volumes []*storage.VolumeRecord, skipID string) int64 {
+	var total int64
+	for _, vol := range volumes {
+		if vol.ID != skipID {
+			total += vol.SizeMB
+		}
+	}
+	return total
+}
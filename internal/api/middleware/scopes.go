@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// RequireScope rejects API token requests whose token was not granted scope.
+// JWT sessions act with the full permissions of the user and pass through.
+// Must run after AuthMiddleware.
+func RequireScope(store *storage.PostgresStore, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkScope(c, store, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScopeByMethod requires readScope for safe methods (GET, HEAD,
+// OPTIONS) and writeScope for everything else.
+func RequireScopeByMethod(store *storage.PostgresStore, readScope, writeScope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := writeScope
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			scope = readScope
+		}
+		if !checkScope(c, store, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkScope aborts the request with 403 and records an audit entry if the
+// API token in the context lacks scope.
+func checkScope(c *gin.Context, store *storage.PostgresStore, scope string) bool {
+	if !c.GetBool("api_token") {
+		return true
+	}
+
+	granted := c.GetStringSlice("api_token_scopes")
+	if models.HasScope(granted, scope) {
+		return true
+	}
+
+	userID := c.GetString("userID")
+	method := c.Request.Method
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	// Don't block on audit log - fire and forget
+	go func() {
+		auditCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		store.CreateAuditLog(auditCtx, &models.AuditLog{
+			ID:        uuid.New().String(),
+			UserID:    &userID,
+			Action:    "api_token_scope_denied",
+			IPAddress: ip,
+			UserAgent: userAgent,
+			Details:   fmt.Sprintf("%s %s requires scope %q (token scopes: %v)", method, path, scope, granted),
+			CreatedAt: time.Now(),
+		})
+	}()
+
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":          "API token is missing required scope",
+		"required_scope": scope,
+	})
+	return false
+}
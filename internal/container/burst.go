@@ -0,0 +1,302 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// Labels recording a terminal's resource class and CPU burst allowance
+const (
+	ResourceClassLabel = "rexec.resource_class"
+	PidsLimitLabel     = "rexec.pids_limit"
+	BurstCPULabel      = "rexec.burst_cpu"     // CPU ceiling in millicores while spending credits
+	BurstCreditsLabel  = "rexec.burst_credits" // most credit the terminal can bank, in CPU-seconds
+)
+
+// cpuPeriod is the CFS period UpdateContainerResources sets, in microseconds
+const cpuPeriod = 100000
+
+// minBurstCredits is the balance needed to start bursting, so a terminal
+// with an almost empty balance isn't raised and lowered every check
+const minBurstCredits = 5.0
+
+func resourceClassLabels(rc *models.ResourceClass) map[string]string {
+	if rc == nil {
+		return nil
+	}
+	labels := map[string]string{
+		ResourceClassLabel: rc.Name,
+		PidsLimitLabel:     strconv.FormatInt(rc.PidsLimit, 10),
+	}
+	if rc.CanBurst() {
+		labels[BurstCPULabel] = strconv.FormatInt(rc.BurstCPUMillicores, 10)
+		labels[BurstCreditsLabel] = strconv.FormatInt(rc.BurstCredits, 10)
+	}
+	if len(rc.NodeSelector) > 0 {
+		labels[NodeSelectorLabel] = models.FormatNodeSelector(rc.NodeSelector)
+	}
+	return labels
+}
+
+// pidsLimit returns the process limit for a terminal of the given class
+func pidsLimit(rc *models.ResourceClass) int64 {
+	if rc != nil && rc.PidsLimit > 0 {
+		return rc.PidsLimit
+	}
+	return models.DefaultPidsLimit
+}
+
+// BurstStatus is a terminal's CPU burst credit balance
+type BurstStatus struct {
+	Credits     float64 `json:"credits"` // CPU-seconds above baseline left to spend
+	MaxCredits  float64 `json:"max_credits"`
+	BaselineCPU int64   `json:"baseline_cpu_millicores"`
+	BurstCPU    int64   `json:"burst_cpu_millicores"`
+	Bursting    bool    `json:"bursting"`
+}
+
+// burstAccount tracks one terminal's credits between samples
+type burstAccount struct {
+	baseline   int64 // millicores
+	ceiling    int64 // millicores while bursting
+	maxCredits float64
+	credits    float64
+	bursting   bool
+
+	lastUsage  uint64 // cumulative CPU time in nanoseconds
+	lastSample time.Time
+}
+
+// update accounts for the CPU used since the last sample: time below the
+// baseline earns credits and time above it spends them. It returns true if
+// the terminal should start or stop bursting.
+func (a *burstAccount) update(usage uint64, now time.Time) bool {
+	if a.lastSample.IsZero() || usage < a.lastUsage {
+		a.lastUsage, a.lastSample = usage, now
+		return false
+	}
+	elapsed := now.Sub(a.lastSample).Seconds()
+	if elapsed <= 0 {
+		return false
+	}
+	used := float64(usage-a.lastUsage) / 1e6 / elapsed // millicores
+	a.lastUsage, a.lastSample = usage, now
+
+	a.credits += (float64(a.baseline) - used) / 1000 * elapsed
+	if a.credits > a.maxCredits {
+		a.credits = a.maxCredits
+	}
+	if a.credits < 0 {
+		a.credits = 0
+	}
+
+	switch {
+	case !a.bursting && a.credits >= minBurstCredits && used >= float64(a.baseline)*0.9:
+		// Running flat out at the baseline quota: let it burst
+		a.bursting = true
+		return true
+	case a.bursting && a.credits == 0:
+		a.bursting = false
+		return true
+	}
+	return false
+}
+
+// BurstService lets terminals whose resource class allows it run above their
+// baseline CPU by raising their CFS quota while they have credits. Credits
+// are kept in memory, so a restart of the API refills them.
+type BurstService struct {
+	manager  *Manager
+	leader   LeaderElector
+	interval time.Duration
+	stopChan chan struct{}
+
+	mu       sync.Mutex
+	accounts map[string]*burstAccount // dockerID -> account
+}
+
+// NewBurstService creates a burst service. With a leader elector, only the
+// instance holding the lock changes quotas.
+func NewBurstService(manager *Manager, leader LeaderElector, interval time.Duration) *BurstService {
+	return &BurstService{
+		manager:  manager,
+		leader:   leader,
+		interval: interval,
+		stopChan: make(chan struct{}),
+		accounts: make(map[string]*burstAccount),
+	}
+}
+
+// Start begins sampling terminals. It does nothing if the runtime can't
+// limit CPU or report stats.
+func (s *BurstService) Start() {
+	caps := s.manager.Capabilities()
+	if !caps.CPULimit || !caps.Stats {
+		log.Printf("⚡ CPU burst disabled: the container runtime can't limit CPU or report stats")
+		return
+	}
+	go s.run()
+	log.Printf("⚡ CPU burst service started (check interval: %v)", s.interval)
+}
+
+// Stop stops the burst service
+func (s *BurstService) Stop() {
+	close(s.stopChan)
+}
+
+func (s *BurstService) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.tick()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// Status returns a terminal's credit balance, if it can burst
+func (s *BurstService) Status(dockerID string) (*BurstStatus, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.accounts[dockerID]
+	if !ok {
+		return nil, false
+	}
+	return &BurstStatus{
+		Credits:     a.credits,
+		MaxCredits:  a.maxCredits,
+		BaselineCPU: a.baseline,
+		BurstCPU:    a.ceiling,
+		Bursting:    a.bursting,
+	}, true
+}
+
+func (s *BurstService) tick() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+
+	if s.leader != nil && !s.leader.IsLeader(ctx) {
+		// Whoever holds the lock keeps the accounts
+		s.mu.Lock()
+		s.accounts = make(map[string]*burstAccount)
+		s.mu.Unlock()
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, info := range s.manager.ListContainers() {
+		a, isNew := s.account(info)
+		if a == nil {
+			continue
+		}
+		if isNew {
+			// A quota left raised by a previous run is lowered once the new balance runs out
+			if inspect, err := s.manager.client.ContainerInspect(ctx, info.ID); err == nil && inspect.ContainerJSONBase != nil && inspect.HostConfig != nil {
+				s.mu.Lock()
+				a.bursting = inspect.HostConfig.CPUQuota*1000/cpuPeriod > a.baseline
+				s.mu.Unlock()
+			}
+		}
+		seen[info.ID] = true
+		if info.Status != "running" {
+			// Stopped and paused time neither earns nor spends
+			s.mu.Lock()
+			a.lastSample = time.Time{}
+			s.mu.Unlock()
+			continue
+		}
+
+		usage, err := s.cpuUsage(ctx, info.ID)
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		changed := a.update(usage, time.Now())
+		bursting, credits := a.bursting, a.credits
+		s.mu.Unlock()
+		if !changed {
+			continue
+		}
+
+		target := a.baseline
+		if bursting {
+			target = a.ceiling
+		}
+		// Memory is left alone, since the incident watcher may have grown it
+		if err := s.manager.UpdateContainerResources(ctx, info.ID, 0, target); err != nil {
+			log.Printf("⚡ Burst: failed to set CPU of %s to %d millicores: %v", info.ContainerName, target, err)
+			s.mu.Lock()
+			a.bursting = !bursting
+			s.mu.Unlock()
+			continue
+		}
+		if bursting {
+			log.Printf("⚡ Burst: %s bursting to %d millicores (%.0f credits)", info.ContainerName, target, credits)
+		} else {
+			log.Printf("⚡ Burst: %s out of credits, back to %d millicores", info.ContainerName, target)
+		}
+	}
+
+	s.mu.Lock()
+	for id := range s.accounts {
+		if !seen[id] {
+			delete(s.accounts, id)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// account returns the terminal's credit account, opening one with a full
+// balance the first time it's seen. It returns nil if the terminal can't burst.
+func (s *BurstService) account(info *ContainerInfo) (*burstAccount, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.accounts[info.ID]; ok {
+		return a, false
+	}
+
+	ceiling, _ := strconv.ParseInt(info.Labels[BurstCPULabel], 10, 64)
+	maxCredits, _ := strconv.ParseInt(info.Labels[BurstCreditsLabel], 10, 64)
+	baseline, _ := strconv.ParseInt(info.Labels["rexec.cpu_limit"], 10, 64)
+	if baseline <= 0 || ceiling <= baseline || maxCredits <= 0 {
+		return nil, false
+	}
+
+	a := &burstAccount{
+		baseline:   baseline,
+		ceiling:    ceiling,
+		maxCredits: float64(maxCredits),
+		credits:    float64(maxCredits),
+	}
+	s.accounts[info.ID] = a
+	return a, true
+}
+
+// cpuUsage returns the container's cumulative CPU time in nanoseconds
+func (s *BurstService) cpuUsage(ctx context.Context, dockerID string) (uint64, error) {
+	resp, err := s.manager.client.ContainerStatsOneShot(ctx, dockerID)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return 0, err
+	}
+	return stats.CPUStats.CPUUsage.TotalUsage, nil
+}
@@ -0,0 +1,127 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/rexec/rexec/internal/models"
+)
+
+func TestBurstAccount_Update(t *testing.T) {
+	a := &burstAccount{baseline: 500, ceiling: 1000, maxCredits: 100, credits: 100}
+	start := time.Now()
+	var usage uint64
+
+	// step runs the terminal at millicores for seconds
+	step := func(millicores, seconds int64) bool {
+		usage += uint64(millicores * seconds * 1e6)
+		start = start.Add(time.Duration(seconds) * time.Second)
+		return a.update(usage, start)
+	}
+
+	if a.update(usage, start) {
+		t.Fatal("first sample should only set the baseline")
+	}
+	if !step(500, 10) || !a.bursting || a.credits != 100 {
+		t.Fatalf("busy at baseline: bursting %v, credits %v; want bursting with 100 credits", a.bursting, a.credits)
+	}
+	if step(1000, 100) || a.credits != 50 {
+		t.Fatalf("bursting 100s: credits %v, want 50", a.credits)
+	}
+	if !step(1000, 200) || a.bursting || a.credits != 0 {
+		t.Fatalf("out of credits: bursting %v, credits %v", a.bursting, a.credits)
+	}
+	if step(0, 20) || a.bursting || a.credits != 10 {
+		t.Fatalf("idle 20s: bursting %v, credits %v; want idle with 10 credits", a.bursting, a.credits)
+	}
+	step(0, 10000)
+	if a.credits != 100 {
+		t.Errorf("credits = %v, want capped at 100", a.credits)
+	}
+	if a.update(0, start.Add(time.Second)) {
+		t.Error("a counter reset should only set the baseline")
+	}
+}
+
+func TestResourceClassLabels(t *testing.T) {
+	if labels := resourceClassLabels(nil); labels != nil {
+		t.Errorf("resourceClassLabels(nil) = %v, want nil", labels)
+	}
+
+	rc := &models.ResourceClass{Name: "small", CPUMillicores: 500, PidsLimit: 256, BurstCPUMillicores: 1000, BurstCredits: 1800}
+	labels := resourceClassLabels(rc)
+	if labels[ResourceClassLabel] != "small" || labels[PidsLimitLabel] != "256" ||
+		labels[BurstCPULabel] != "1000" || labels[BurstCreditsLabel] != "1800" {
+		t.Errorf("resourceClassLabels() = %v", labels)
+	}
+
+	rc.BurstCPUMillicores, rc.BurstCredits = 0, 0
+	if _, ok := resourceClassLabels(rc)[BurstCPULabel]; ok {
+		t.Error("a class without bursting shouldn't get burst labels")
+	}
+	if got := pidsLimit(nil); got != models.DefaultPidsLimit {
+		t.Errorf("pidsLimit(nil) = %d, want %d", got, models.DefaultPidsLimit)
+	}
+}
+
+func TestBurstService_Tick(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := newPauseTestManager(mockClient)
+	burstID := "burst-container-0001"
+	plainID := "plain-container-0001"
+	manager.containers[burstID] = &ContainerInfo{ID: burstID, Status: "running", Labels: map[string]string{
+		"rexec.cpu_limit":    "500",
+		"rexec.memory_limit": "536870912",
+		BurstCPULabel:        "1000",
+		BurstCreditsLabel:    "100",
+	}}
+	manager.containers[plainID] = &ContainerInfo{ID: plainID, Status: "running", Labels: map[string]string{
+		"rexec.cpu_limit": "500",
+	}}
+
+	// Each sample reports another full CPU-second, more than the baseline allows
+	var usage uint64
+	mockClient.ContainerStatsOneShotFunc = func(ctx context.Context, containerID string) (container.StatsResponseReader, error) {
+		usage += 1e9
+		var stats container.StatsResponse
+		stats.CPUStats.CPUUsage.TotalUsage = usage
+		body, _ := json.Marshal(stats)
+		return container.StatsResponseReader{Body: io.NopCloser(strings.NewReader(string(body)))}, nil
+	}
+	var updates []container.UpdateConfig
+	mockClient.ContainerUpdateFunc = func(ctx context.Context, containerID string, cfg container.UpdateConfig) (container.UpdateResponse, error) {
+		if containerID != burstID {
+			t.Errorf("updated %s, want only %s", containerID, burstID)
+		}
+		updates = append(updates, cfg)
+		return container.UpdateResponse{}, nil
+	}
+
+	s := NewBurstService(manager, nil, time.Minute)
+	s.tick()
+	time.Sleep(10 * time.Millisecond)
+	s.tick()
+
+	if len(updates) != 1 || updates[0].CPUQuota != 100000 || updates[0].Memory != 0 {
+		t.Fatalf("updates = %+v, want one raising the quota to 1 CPU and leaving memory alone", updates)
+	}
+	status, ok := s.Status(burstID)
+	if !ok || !status.Bursting || status.BurstCPU != 1000 {
+		t.Errorf("Status() = %+v, %v; want bursting to 1000", status, ok)
+	}
+	if _, ok := s.Status(plainID); ok {
+		t.Error("a terminal without a burst allowance shouldn't have an account")
+	}
+
+	// Accounts of removed terminals are dropped
+	delete(manager.containers, burstID)
+	s.tick()
+	if _, ok := s.Status(burstID); ok {
+		t.Error("account of a removed terminal should be dropped")
+	}
+}
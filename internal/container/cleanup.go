@@ -3,6 +3,7 @@ package container
 import (
 	"context"
 	"log"
+	"os"
 	"time"
 )
 
@@ -11,11 +12,16 @@ const (
 	GuestMaxSessionDuration = 2 * time.Hour
 )
 
-// CleanupService handles automatic cleanup of idle containers
+// CleanupService handles automatic cleanup of idle containers. Idle guest
+// containers are paused after pauseAfter and stopped (or checkpointed) after
+// idleTimeout.
 type CleanupService struct {
 	manager       *Manager
 	idleTimeout   time.Duration
+	pauseAfter    time.Duration // 0 disables pausing
+	idleAction    string        // IdleActionStop or IdleActionCheckpoint
 	checkInterval time.Duration
+	onStatus      func(info *ContainerInfo, status string)
 	stopChan      chan struct{}
 }
 
@@ -24,15 +30,49 @@ func NewCleanupService(manager *Manager, idleTimeout, checkInterval time.Duratio
 	return &CleanupService{
 		manager:       manager,
 		idleTimeout:   idleTimeout,
+		idleAction:    IdleActionStop,
 		checkInterval: checkInterval,
 		stopChan:      make(chan struct{}),
 	}
 }
 
+// SetIdlePolicy sets when idle containers are paused and what happens once
+// they reach the idle timeout
+func (s *CleanupService) SetIdlePolicy(pauseAfter time.Duration, idleAction string) {
+	s.pauseAfter = pauseAfter
+	if idleAction == IdleActionCheckpoint {
+		s.idleAction = IdleActionCheckpoint
+	} else {
+		s.idleAction = IdleActionStop
+	}
+}
+
+// SetStatusHook is called after the service pauses or stops a container,
+// with the new status ("paused" or "stopped")
+func (s *CleanupService) SetStatusHook(fn func(info *ContainerInfo, status string)) {
+	s.onStatus = fn
+}
+
+func (s *CleanupService) notify(info *ContainerInfo, status string) {
+	if s.onStatus != nil {
+		s.onStatus(info, status)
+	}
+}
+
 // Start begins the cleanup service
 func (s *CleanupService) Start() {
+	caps := s.manager.Capabilities()
+	if s.pauseAfter > 0 && !caps.Pause {
+		log.Printf("⚠️  Container runtime can't pause containers; idle containers will only be stopped")
+		s.pauseAfter = 0
+	}
+	if s.idleAction == IdleActionCheckpoint && !caps.Checkpoint {
+		log.Printf("⚠️  Container runtime can't checkpoint containers; idle containers will be stopped")
+		s.idleAction = IdleActionStop
+	}
+
 	go s.run()
-	log.Printf("🧹 Cleanup service started (idle timeout: %v, check interval: %v)", s.idleTimeout, s.checkInterval)
+	log.Printf("🧹 Cleanup service started (pause after: %v, idle timeout: %v, idle action: %s, check interval: %v)", s.pauseAfter, s.idleTimeout, s.idleAction, s.checkInterval)
 }
 
 // Stop stops the cleanup service
@@ -62,6 +102,11 @@ func (s *CleanupService) cleanupIdleContainers() {
 	// First, cleanup expired guest containers (hard 50-hour session limit)
 	s.cleanupExpiredGuestContainers()
 
+	// Freeze guest containers idle for a while; they resume on reconnect
+	if s.pauseAfter > 0 && s.pauseAfter < s.idleTimeout {
+		s.pauseIdleContainers()
+	}
+
 	// Then cleanup idle guest containers (idle timeout only applies to guests)
 	idleContainers := s.manager.GetIdleContainers(s.idleTimeout)
 
@@ -81,11 +126,46 @@ func (s *CleanupService) cleanupIdleContainers() {
 			time.Since(container.LastUsedAt).Round(time.Second),
 		)
 
+		if s.idleAction == IdleActionCheckpoint {
+			err := s.manager.CheckpointContainer(ctx, container.ID)
+			if err == nil {
+				log.Printf("✅ Checkpointed idle container: %s", container.ID[:12])
+				s.notify(container, "stopped")
+				continue
+			}
+			log.Printf("⚠️  Failed to checkpoint idle container %s, stopping instead: %v", container.ID[:12], err)
+		}
+
 		if err := s.manager.StopContainer(ctx, container.ID); err != nil {
 			log.Printf("⚠️  Failed to stop idle container %s: %v", container.ID[:12], err)
 		} else {
 			log.Printf("✅ Stopped idle container: %s", container.ID[:12])
+			s.notify(container, "stopped")
+		}
+	}
+}
+
+// pauseIdleContainers pauses running guest containers idle for longer than pauseAfter
+func (s *CleanupService) pauseIdleContainers() {
+	toPause := s.manager.GetContainersToPause(s.pauseAfter)
+	if len(toPause) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, container := range toPause {
+		if err := s.manager.PauseContainer(ctx, container.ID); err != nil {
+			log.Printf("⚠️  Failed to pause idle container %s: %v", container.ID[:12], err)
+			continue
 		}
+		log.Printf("⏸️  Paused idle container: %s (user: %s, last used: %v ago)",
+			container.ID[:12],
+			container.UserID,
+			time.Since(container.LastUsedAt).Round(time.Second),
+		)
+		s.notify(container, "paused")
 	}
 }
 
@@ -130,6 +210,12 @@ type CleanupConfig struct {
 	// Note: This only applies to guest containers - authenticated users have no idle timeout
 	IdleTimeout time.Duration
 
+	// PauseAfter is how long a guest container can be idle before being paused (0 disables)
+	PauseAfter time.Duration
+
+	// IdleAction is what happens at IdleTimeout: IdleActionStop or IdleActionCheckpoint
+	IdleAction string
+
 	// CheckInterval is how often to check for idle/expired containers
 	CheckInterval time.Duration
 
@@ -140,7 +226,9 @@ type CleanupConfig struct {
 // DefaultCleanupConfig returns sensible defaults for cleanup
 func DefaultCleanupConfig() CleanupConfig {
 	return CleanupConfig{
-		IdleTimeout:   50 * time.Hour,  // Stop guest containers idle for 50 hours
+		IdleTimeout:   50 * time.Hour,   // Stop guest containers idle for 50 hours
+		PauseAfter:    30 * time.Minute, // Pause them after 30 minutes
+		IdleAction:    IdleActionStop,
 		CheckInterval: 5 * time.Minute, // Check every 5 minutes
 		Enabled:       true,
 	}
@@ -150,11 +238,33 @@ func DefaultCleanupConfig() CleanupConfig {
 func DevelopmentCleanupConfig() CleanupConfig {
 	return CleanupConfig{
 		IdleTimeout:   30 * time.Minute, // Shorter timeout for dev
-		CheckInterval: 1 * time.Minute,  // More frequent checks
+		PauseAfter:    10 * time.Minute,
+		IdleAction:    IdleActionStop,
+		CheckInterval: 1 * time.Minute, // More frequent checks
 		Enabled:       true,
 	}
 }
 
+// CleanupConfigFromEnv overrides cfg with IDLE_PAUSE_AFTER (a duration, "0"
+// disables pausing) and IDLE_ACTION ("stop" or "checkpoint")
+func CleanupConfigFromEnv(cfg CleanupConfig) CleanupConfig {
+	if v := os.Getenv("IDLE_PAUSE_AFTER"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			cfg.PauseAfter = d
+		} else {
+			log.Printf("⚠️  Ignoring invalid IDLE_PAUSE_AFTER %q", v)
+		}
+	}
+	if v := os.Getenv("IDLE_ACTION"); v != "" {
+		if v == IdleActionStop || v == IdleActionCheckpoint {
+			cfg.IdleAction = v
+		} else {
+			log.Printf("⚠️  Ignoring invalid IDLE_ACTION %q", v)
+		}
+	}
+	return cfg
+}
+
 // GetIdleTime returns how long a container has been idle
 func (m *Manager) GetIdleTime(dockerID string) time.Duration {
 	m.mu.RLock()
@@ -176,6 +286,11 @@ func (m *Manager) GetExpiredGuestContainers() []*ContainerInfo {
 	now := time.Now()
 
 	for _, info := range m.containers {
+		// Warm pool members are briefly tracked while being created
+		if isUnclaimedPoolMember(info.Labels) {
+			continue
+		}
+
 		// Check if this is a guest container
 		isGuest := false
 		var expiresAt time.Time
@@ -0,0 +1,208 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// packageManagers are tried in order; the first one found in the image is used
+var packageManagers = []struct {
+	bin     string
+	family  string
+	prepare string
+	install string
+}{
+	{"apt-get", models.RoleFamilyDebian, "mkdir -p /var/lib/apt/lists/partial /var/cache/apt/archives/partial 2>/dev/null\n    export DEBIAN_FRONTEND=noninteractive", "apt-get update -qq && apt-get install -y -qq"},
+	{"apk", models.RoleFamilyAlpine, "", "apk add --no-cache"},
+	{"dnf", models.RoleFamilyFedora, "", "dnf install -y -q"},
+	{"yum", models.RoleFamilyFedora, "", "yum install -y -q"},
+	{"pacman", models.RoleFamilyArch, "", "pacman -Sy --noconfirm --needed"},
+	{"zypper", models.RoleFamilySuse, "", "zypper -n install"},
+}
+
+// IsBuiltinRole reports whether id is one of the hardcoded roles
+func IsBuiltinRole(id string) bool {
+	for _, r := range AvailableRoles() {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CustomRoleInfo describes a custom role in the same shape as the built-in
+// catalog. Packages lists every family's packages once.
+func CustomRoleInfo(role *models.CustomRole) RoleInfo {
+	info := RoleInfo{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		Icon:        role.Icon,
+		Packages:    []string{},
+		Custom:      true,
+	}
+	seen := make(map[string]bool)
+	for _, family := range models.RoleFamilies {
+		for _, p := range role.Packages[family] {
+			if !seen[p] {
+				seen[p] = true
+				info.Packages = append(info.Packages, p)
+			}
+		}
+	}
+	return info
+}
+
+// SetupCustomRole sets up a user-defined role: its base role first, then its
+// packages, post-install scripts and verification commands. Each phase is
+// reported on progressCh, which may be nil.
+func SetupCustomRole(ctx context.Context, cli client.CommonAPIClient, containerID string, role *models.CustomRole, progressCh chan<- ProgressEvent) (*SetupShellResponse, error) {
+	type phase struct {
+		message string
+		what    string
+		script  string
+	}
+
+	var phases []phase
+	if script := generateCustomRolePackageScript(role); script != "" {
+		phases = append(phases, phase{"Installing role packages...", "Role packages", script})
+	}
+	phases = append(phases, phase{"Running post-install scripts...", "Role post-install", generateCustomRolePostInstallScript(role)})
+	if script := generateCustomRoleVerifyScript(role); script != "" {
+		phases = append(phases, phase{"Verifying role tools...", "Role verification", script})
+	}
+
+	total := len(phases)
+	if role.BaseRole != "" {
+		total++
+	}
+
+	var output strings.Builder
+	step := 0
+	report := func(message, detail string) {
+		if progressCh != nil {
+			progressCh <- ProgressEvent{
+				Stage:    "configuring",
+				Message:  message,
+				Progress: 96 + 2*float64(step)/float64(total),
+				Detail:   detail,
+			}
+		}
+		step++
+	}
+
+	if role.BaseRole != "" {
+		report(fmt.Sprintf("Installing base role %s...", role.BaseRole), role.Name)
+		result, err := SetupRole(ctx, cli, containerID, role.BaseRole)
+		if err != nil {
+			return nil, err
+		}
+		output.WriteString(result.Output)
+		if !result.Success {
+			result.Output = output.String()
+			return result, nil
+		}
+	}
+
+	for _, p := range phases {
+		report(p.message, role.Name)
+		result, err := runSetupScript(ctx, cli, containerID, "", p.script, p.what, role.Name)
+		if err != nil {
+			return nil, err
+		}
+		output.WriteString(result.Output)
+		if !result.Success {
+			result.Output = output.String()
+			return result, nil
+		}
+	}
+
+	return &SetupShellResponse{
+		Success: true,
+		Message: fmt.Sprintf("Role setup complete for %s", role.Name),
+		Output:  output.String(),
+	}, nil
+}
+
+// generateCustomRolePackageScript installs the packages listed for the
+// image's distro family plus those listed for all families.
+func generateCustomRolePackageScript(role *models.CustomRole) string {
+	empty := true
+	for _, pkgs := range role.Packages {
+		if len(pkgs) > 0 {
+			empty = false
+			break
+		}
+	}
+	if empty {
+		return ""
+	}
+	return installPackagesScript(fmt.Sprintf("Installing packages for role: %s...", role.Name), role.PackagesFor)
+}
+
+// generateCustomRolePostInstallScript runs post-install scripts in order,
+// stopping at the first failure, and records the role in /etc/rexec/role.
+func generateCustomRolePostInstallScript(role *models.CustomRole) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset +e\n")
+	for i, script := range role.PostInstall {
+		fmt.Fprintf(&b, "echo \"[[REXEC_STATUS]]Running post-install script %d/%d...\"\n", i+1, len(role.PostInstall))
+		fmt.Fprintf(&b, "sh -c %s || { echo \"post-install script %d failed\"; exit 1; }\n", shellQuote(script), i+1)
+	}
+	fmt.Fprintf(&b, "mkdir -p /etc/rexec && echo %s > /etc/rexec/role\n", shellQuote(role.Name))
+	return b.String()
+}
+
+// generateCustomRoleVerifyScript runs every verification command and fails
+// if any of them does. Tools installed into ~/.local/bin are on PATH.
+func generateCustomRoleVerifyScript(role *models.CustomRole) string {
+	if len(role.Verify) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset +e\nexport PATH=\"/home/user/.local/bin:/root/.local/bin:/usr/local/bin:$PATH\"\nfailed=0\n")
+	for _, cmd := range role.Verify {
+		quoted := shellQuote(cmd)
+		fmt.Fprintf(&b, "if sh -c %s >/dev/null 2>&1; then\n    echo \"  ✓ \"%s\nelse\n    echo \"  ✗ \"%s\n    failed=1\nfi\n", quoted, quoted, quoted)
+	}
+	b.WriteString("exit $failed\n")
+	return b.String()
+}
+
+// installPackagesScript builds a script that installs packagesFor(family)
+// with whichever package manager the image has.
+func installPackagesScript(status string, packagesFor func(family string) []string) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset +e\n")
+	fmt.Fprintf(&b, "echo \"[[REXEC_STATUS]]%s\"\n", status)
+
+	for i, pm := range packageManagers {
+		keyword := "elif"
+		if i == 0 {
+			keyword = "if"
+		}
+		fmt.Fprintf(&b, "%s command -v %s >/dev/null 2>&1; then\n", keyword, pm.bin)
+
+		pkgs := packagesFor(pm.family)
+		if len(pkgs) == 0 {
+			fmt.Fprintf(&b, "    echo \"No packages listed for %s\"\n", pm.family)
+			continue
+		}
+		quoted := make([]string, len(pkgs))
+		for j, p := range pkgs {
+			quoted[j] = shellQuote(p)
+		}
+		if pm.prepare != "" {
+			fmt.Fprintf(&b, "    %s\n", pm.prepare)
+		}
+		fmt.Fprintf(&b, "    %s %s\n", pm.install, strings.Join(quoted, " "))
+	}
+
+	b.WriteString("else\n    echo \"No supported package manager found\"\n    exit 1\nfi\n")
+	return b.String()
+}
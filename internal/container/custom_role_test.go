@@ -0,0 +1,155 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/rexec/rexec/internal/models"
+)
+
+func TestInstallPackagesScript(t *testing.T) {
+	role := &models.CustomRole{
+		Name: "company-standard",
+		Packages: map[string][]string{
+			models.RoleFamilyAll:    {"jq"},
+			models.RoleFamilyDebian: {"build-essential"},
+			models.RoleFamilyAlpine: {"build-base"},
+		},
+	}
+
+	script := generateCustomRolePackageScript(role)
+	wantContains := []string{
+		"Installing packages for role: company-standard...",
+		"apt-get install -y -qq 'jq' 'build-essential'",
+		"apk add --no-cache 'jq' 'build-base'",
+		"dnf install -y -q 'jq'",
+		"pacman -Sy --noconfirm --needed 'jq'",
+		"No supported package manager found",
+	}
+	for _, want := range wantContains {
+		if !strings.Contains(script, want) {
+			t.Errorf("package script missing %q:\n%s", want, script)
+		}
+	}
+
+	if got := generateCustomRolePackageScript(&models.CustomRole{Name: "empty"}); got != "" {
+		t.Errorf("expected no package script for a role without packages, got:\n%s", got)
+	}
+}
+
+func TestGenerateCustomRoleScripts(t *testing.T) {
+	role := &models.CustomRole{
+		Name:        "company-standard",
+		PostInstall: []string{"curl -fsSL https://example.com/install.sh | sh", "echo 'done'"},
+		Verify:      []string{"acme --version"},
+	}
+
+	post := generateCustomRolePostInstallScript(role)
+	for _, want := range []string{
+		"sh -c 'curl -fsSL https://example.com/install.sh | sh' || { echo \"post-install script 1 failed\"; exit 1; }",
+		`sh -c 'echo '\''done'\''' || { echo "post-install script 2 failed"; exit 1; }`,
+		"echo 'company-standard' > /etc/rexec/role",
+	} {
+		if !strings.Contains(post, want) {
+			t.Errorf("post-install script missing %q:\n%s", want, post)
+		}
+	}
+
+	verify := generateCustomRoleVerifyScript(role)
+	for _, want := range []string{"if sh -c 'acme --version' >/dev/null 2>&1; then", "failed=1", "exit $failed"} {
+		if !strings.Contains(verify, want) {
+			t.Errorf("verify script missing %q:\n%s", want, verify)
+		}
+	}
+	if got := generateCustomRoleVerifyScript(&models.CustomRole{Name: "none"}); got != "" {
+		t.Errorf("expected no verify script without verification commands, got:\n%s", got)
+	}
+}
+
+func TestCustomRoleInfo(t *testing.T) {
+	info := CustomRoleInfo(&models.CustomRole{
+		ID:   "role-1",
+		Name: "company-standard",
+		Packages: map[string][]string{
+			models.RoleFamilyAll:    {"git", "jq"},
+			models.RoleFamilyDebian: {"git", "build-essential"},
+		},
+	})
+
+	if info.ID != "role-1" || !info.Custom {
+		t.Errorf("CustomRoleInfo() = %+v", info)
+	}
+	if got := strings.Join(info.Packages, ","); got != "git,jq,build-essential" {
+		t.Errorf("Packages = %s, want git,jq,build-essential", got)
+	}
+}
+
+func TestIsBuiltinRole(t *testing.T) {
+	if !IsBuiltinRole("standard") || !IsBuiltinRole("barebone") {
+		t.Error("expected built-in roles to be recognised")
+	}
+	if IsBuiltinRole("company-standard") {
+		t.Error("custom role name reported as built-in")
+	}
+}
+
+func TestSetupCustomRole_StopsOnFailedVerification(t *testing.T) {
+	var scripts []string
+	execs := 0
+	mockClient := &MockDockerClient{
+		ContainerInspectFunc: func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{Running: true}},
+			}, nil
+		},
+		ContainerExecCreateFunc: func(ctx context.Context, id string, config container.ExecOptions) (types.IDResponse, error) {
+			scripts = append(scripts, config.Cmd[2])
+			execs++
+			return types.IDResponse{ID: "exec-" + string(rune('0'+execs))}, nil
+		},
+		ContainerExecInspectFunc: func(ctx context.Context, execID string) (container.ExecInspect, error) {
+			exitCode := 0
+			if strings.Contains(scripts[len(scripts)-1], "acme --version") {
+				exitCode = 1
+			}
+			return container.ExecInspect{ExecID: execID, ExitCode: exitCode}, nil
+		},
+	}
+
+	role := &models.CustomRole{
+		Name:     "company-standard",
+		Packages: map[string][]string{models.RoleFamilyAll: {"jq"}},
+		Verify:   []string{"acme --version"},
+	}
+
+	progressCh := make(chan ProgressEvent, 10)
+	result, err := SetupCustomRole(context.Background(), mockClient, "container-1", role, progressCh)
+	close(progressCh)
+	if err != nil {
+		t.Fatalf("SetupCustomRole() error = %v", err)
+	}
+	if result.Success {
+		t.Error("expected setup to fail when verification fails")
+	}
+	if !strings.Contains(result.Message, "Role verification failed") {
+		t.Errorf("Message = %q", result.Message)
+	}
+	if len(scripts) != 3 {
+		t.Errorf("ran %d scripts, want packages, post-install and verification", len(scripts))
+	}
+
+	var messages []string
+	for event := range progressCh {
+		if event.Stage != "configuring" || event.Progress < 96 || event.Progress >= 98 {
+			t.Errorf("unexpected progress event %+v", event)
+		}
+		messages = append(messages, event.Message)
+	}
+	want := "Installing role packages...,Running post-install scripts...,Verifying role tools..."
+	if got := strings.Join(messages, ","); got != want {
+		t.Errorf("progress messages = %s, want %s", got, want)
+	}
+}
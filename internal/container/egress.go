@@ -0,0 +1,410 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// DefaultNetworkHelperImage provides iptables and tc for the network helper
+const DefaultNetworkHelperImage = "nicolaka/netshoot:latest"
+
+// NetworkMBLabel records a container's bandwidth limit in MB/s
+const NetworkMBLabel = "rexec.network_mb"
+
+// egressChain holds a container's egress rules, inside its own network namespace
+const egressChain = "REXEC-EGRESS"
+
+// shapingFailedExit is the helper's exit code when only bandwidth shaping failed
+const shapingFailedExit = 3
+
+// EgressConfig is the host-wide network policy configuration
+type EgressConfig struct {
+	// TierPolicies maps a tier ("guest", "free", ...) to its egress policy;
+	// "default" applies to tiers without their own entry
+	TierPolicies map[string]models.EgressPolicy
+	HelperImage  string
+	// Shaping enforces each container's NetworkMB with tc
+	Shaping bool
+}
+
+// EgressConfigFromEnv reads EGRESS_POLICIES (JSON keyed by tier, e.g.
+// {"guest":{"mode":"none"},"default":{"deny":["10.0.0.0/8"]}}),
+// NETWORK_HELPER_IMAGE and NETWORK_SHAPING ("off" disables shaping).
+func EgressConfigFromEnv() (EgressConfig, error) {
+	cfg := EgressConfig{
+		HelperImage: DefaultNetworkHelperImage,
+		Shaping:     os.Getenv("NETWORK_SHAPING") != "off",
+	}
+	if v := os.Getenv("NETWORK_HELPER_IMAGE"); v != "" {
+		cfg.HelperImage = v
+	}
+	if v := os.Getenv("EGRESS_POLICIES"); v != "" {
+		if err := json.Unmarshal([]byte(v), &cfg.TierPolicies); err != nil {
+			return cfg, fmt.Errorf("invalid EGRESS_POLICIES: %w", err)
+		}
+		for tier, policy := range cfg.TierPolicies {
+			if err := policy.Validate(); err != nil {
+				return cfg, fmt.Errorf("invalid EGRESS_POLICIES for %s: %w", tier, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func networkLabels(networkMB int64) map[string]string {
+	if networkMB <= 0 {
+		return nil
+	}
+	return map[string]string{NetworkMBLabel: strconv.FormatInt(networkMB, 10)}
+}
+
+// EgressPolicyStore loads per-terminal egress policies
+type EgressPolicyStore interface {
+	GetEgressPolicies(ctx context.Context) (map[string]*models.EgressPolicy, error)
+}
+
+// SetEgressConfig sets the host-wide network policy configuration
+func (m *Manager) SetEgressConfig(cfg EgressConfig) {
+	m.mu.Lock()
+	m.egress = cfg
+	m.mu.Unlock()
+}
+
+// LoadEgressPolicies loads per-terminal egress policies, keyed by Docker ID.
+// Call it before LoadExistingContainers.
+func (m *Manager) LoadEgressPolicies(ctx context.Context, store EgressPolicyStore) error {
+	policies, err := store.GetEgressPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.egressPolicies = policies
+	m.mu.Unlock()
+	return nil
+}
+
+// EgressPolicy returns a container's own egress policy, or nil if it uses its tier's
+func (m *Manager) EgressPolicy(dockerID string) *models.EgressPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.egressPolicies[dockerID]
+}
+
+// SetEgressPolicy changes a container's own egress policy and applies it
+// right away if the container is running. A nil policy reverts to the tier's.
+func (m *Manager) SetEgressPolicy(ctx context.Context, dockerID string, policy *models.EgressPolicy) error {
+	m.trackEgressPolicy(dockerID, policy)
+
+	m.mu.RLock()
+	info, ok := m.containers[dockerID]
+	running := ok && (info.Status == "running" || info.Status == "paused")
+	var labels map[string]string
+	if ok {
+		labels = info.Labels
+	}
+	m.mu.RUnlock()
+
+	if !running {
+		return nil
+	}
+	// Rules may already be in place, so apply even an open policy to clear them
+	return m.applyNetworkPolicy(ctx, dockerID, labels, true)
+}
+
+// trackEgressPolicy records a container's own egress policy; nil removes it
+func (m *Manager) trackEgressPolicy(dockerID string, policy *models.EgressPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if policy == nil {
+		delete(m.egressPolicies, dockerID)
+		return
+	}
+	if m.egressPolicies == nil {
+		m.egressPolicies = make(map[string]*models.EgressPolicy)
+	}
+	m.egressPolicies[dockerID] = policy
+}
+
+// effectiveEgress combines the container's tier policy with its own
+func (m *Manager) effectiveEgress(dockerID string, labels map[string]string) models.EgressPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tierEgressLocked(labels["rexec.tier"]).Restrict(m.egressPolicies[dockerID])
+}
+
+// tierEgressLocked returns a tier's egress policy. m.mu must be held.
+func (m *Manager) tierEgressLocked(tier string) models.EgressPolicy {
+	tierPolicy, ok := m.egress.TierPolicies[tier]
+	if !ok {
+		tierPolicy = m.egress.TierPolicies["default"]
+	}
+	return tierPolicy
+}
+
+// buildNetworkMode returns the network a tier's image builds run on. Build
+// steps are short-lived containers the network helper can't reach, so any
+// restriction in the tier's policy means no network at all.
+func (m *Manager) buildNetworkMode(tier string) string {
+	m.mu.RLock()
+	policy := m.tierEgressLocked(tier)
+	m.mu.RUnlock()
+	if !policy.IsOpen() {
+		return "none"
+	}
+	return IsolatedNetworkName
+}
+
+// applyNetworkPolicy installs a container's egress rules and bandwidth limit
+// from inside its network namespace. Rules are lost whenever the container
+// stops, so this runs on every create and start. It only returns an error
+// if a restrictive policy couldn't be applied; callers must then not let
+// the container run. Shaping failures are logged.
+func (m *Manager) applyNetworkPolicy(ctx context.Context, dockerID string, labels map[string]string, force bool) error {
+	// Starts Docker makes on its own are applied by the reconciler too; don't
+	// let two helpers flush and fill the chain at once
+	lock := m.networkLock(dockerID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	policy := m.effectiveEgress(dockerID, labels)
+
+	m.mu.RLock()
+	cfg := m.egress
+	m.mu.RUnlock()
+
+	var rateMbit int64
+	if cfg.Shaping {
+		if mb, err := strconv.ParseInt(labels[NetworkMBLabel], 10, 64); err == nil && mb > 0 {
+			rateMbit = mb * 8
+		}
+	}
+
+	if policy.IsOpen() && rateMbit == 0 && !force {
+		return nil
+	}
+
+	if !policy.IsOpen() && !m.Capabilities().EgressPolicy {
+		return fmt.Errorf("egress policies are not supported with the %s runtime", m.RuntimeInfo().OCIRuntime)
+	}
+
+	script := buildEgressScript(policy, m.resolveEgressTargets(ctx, policy.Allow), m.resolveEgressTargets(ctx, policy.Deny), rateMbit)
+	exitCode, err := m.runNetworkHelper(ctx, dockerID, cfg.HelperImage, script)
+	switch {
+	case err != nil:
+	case exitCode == shapingFailedExit:
+		log.Printf("[Network] Bandwidth shaping failed for %s", dockerID[:12])
+		return nil
+	case exitCode != 0:
+		err = fmt.Errorf("network helper exited with code %d", exitCode)
+	default:
+		return nil
+	}
+
+	if policy.IsOpen() {
+		log.Printf("[Network] Failed to apply network limits to %s: %v", dockerID[:12], err)
+		return nil
+	}
+	return fmt.Errorf("failed to apply egress policy: %w", err)
+}
+
+// networkLock returns the lock serializing network policy changes to a container
+func (m *Manager) networkLock(dockerID string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.networkLocks == nil {
+		m.networkLocks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := m.networkLocks[dockerID]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.networkLocks[dockerID] = lock
+	}
+	return lock
+}
+
+// resolveEgressTargets turns IPs, CIDRs and domains into CIDRs. Domains
+// that don't resolve are skipped.
+func (m *Manager) resolveEgressTargets(ctx context.Context, entries []string) []string {
+	lookup := m.lookupIP
+	if lookup == nil {
+		lookup = func(ctx context.Context, host string) ([]net.IP, error) {
+			return net.DefaultResolver.LookupIP(ctx, "ip", host)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var cidrs []string
+	add := func(cidr string) {
+		if !seen[cidr] {
+			seen[cidr] = true
+			cidrs = append(cidrs, cidr)
+		}
+	}
+
+	for _, entry := range entries {
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			add(n.String())
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			add(hostCIDR(ip))
+			continue
+		}
+		ips, err := lookup(ctx, entry)
+		if err != nil {
+			log.Printf("[Network] Could not resolve egress rule %s: %v", entry, err)
+			continue
+		}
+		for _, ip := range ips {
+			add(hostCIDR(ip))
+		}
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
+
+func hostCIDR(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
+// buildEgressScript builds the shell script the network helper runs. Rules
+// live in their own chain so re-applying a policy replaces the old one.
+// Loopback (including Docker's embedded DNS) and replies to inbound
+// connections are always allowed.
+func buildEgressScript(policy models.EgressPolicy, allow, deny []string, rateMbit int64) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+
+	for _, family := range []struct {
+		cmd string
+		v6  bool
+	}{{"iptables", false}, {"ip6tables", true}} {
+		t := family.cmd
+		if family.v6 {
+			// IPv6 is best effort; the isolated network is IPv4 only
+			b.WriteString("if command -v ip6tables >/dev/null 2>&1; then\nset +e\n")
+		}
+		fmt.Fprintf(&b, "%s -N %s 2>/dev/null || %s -F %s\n", t, egressChain, t, egressChain)
+		fmt.Fprintf(&b, "%s -C OUTPUT -j %s 2>/dev/null || %s -I OUTPUT 1 -j %s\n", t, egressChain, t, egressChain)
+		fmt.Fprintf(&b, "%s -A %s -o lo -j RETURN\n", t, egressChain)
+		fmt.Fprintf(&b, "%s -A %s -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN\n", t, egressChain)
+		for _, cidr := range deny {
+			if strings.Contains(cidr, ":") == family.v6 {
+				fmt.Fprintf(&b, "%s -A %s -d %s -j REJECT\n", t, egressChain, cidr)
+			}
+		}
+		switch policy.EffectiveMode() {
+		case models.EgressAllowlist:
+			for _, cidr := range allow {
+				if strings.Contains(cidr, ":") == family.v6 {
+					fmt.Fprintf(&b, "%s -A %s -d %s -j RETURN\n", t, egressChain, cidr)
+				}
+			}
+			fmt.Fprintf(&b, "%s -A %s -j REJECT\n", t, egressChain)
+		case models.EgressNone:
+			fmt.Fprintf(&b, "%s -A %s -j REJECT\n", t, egressChain)
+		}
+		if family.v6 {
+			b.WriteString("set -e\nfi\n")
+		}
+	}
+
+	if rateMbit > 0 {
+		// Egress through a token bucket, ingress through a policer
+		fmt.Fprintf(&b, "tc qdisc replace dev eth0 root tbf rate %dmbit burst 256kbit latency 100ms || exit %d\n", rateMbit, shapingFailedExit)
+		b.WriteString("tc qdisc del dev eth0 ingress 2>/dev/null || true\n")
+		fmt.Fprintf(&b, "tc qdisc add dev eth0 handle ffff: ingress || exit %d\n", shapingFailedExit)
+		fmt.Fprintf(&b, "tc filter add dev eth0 parent ffff: protocol all u32 match u32 0 0 police rate %dmbit burst 256k drop flowid :1 || exit %d\n", rateMbit, shapingFailedExit)
+	}
+	return b.String()
+}
+
+// runNetworkHelper runs script in a short-lived container that shares the
+// target's network namespace. Only the helper gets NET_ADMIN; the terminal
+// itself can't change its rules.
+func (m *Manager) runNetworkHelper(ctx context.Context, dockerID, helperImage, script string) (int64, error) {
+	if err := m.PullCustomImage(ctx, "", helperImage); err != nil {
+		return 0, fmt.Errorf("failed to pull network helper image: %w", err)
+	}
+
+	resp, err := m.client.ContainerCreate(ctx,
+		&container.Config{
+			Image:      helperImage,
+			Entrypoint: []string{"/bin/sh", "-c", script},
+			Labels:     map[string]string{"rexec.helper": "network"},
+		},
+		&container.HostConfig{
+			NetworkMode: container.NetworkMode("container:" + dockerID),
+			CapDrop:     []string{"ALL"},
+			CapAdd:      []string{"NET_ADMIN", "NET_RAW"},
+		},
+		nil, nil, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create network helper: %w", err)
+	}
+	defer m.client.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+
+	if err := m.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return 0, fmt.Errorf("failed to start network helper: %w", err)
+	}
+
+	statusCh, errCh := m.client.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case status := <-statusCh:
+		return status.StatusCode, nil
+	case err := <-errCh:
+		return 0, err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// reapplyNetworkPolicy applies a terminal's network policy again after its
+// container started. The rules live in the container's network namespace and
+// are gone after Docker restarts it under its restart policy. A container
+// whose restrictive policy can't be applied is stopped.
+func (m *Manager) reapplyNetworkPolicy(ctx context.Context, dockerID string) {
+	m.mu.RLock()
+	info, ok := m.containers[dockerID]
+	var labels map[string]string
+	if ok {
+		labels = info.Labels
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return
+	}
+	if err := m.applyNetworkPolicy(ctx, dockerID, labels, false); err != nil {
+		log.Printf("[Network] %v; stopping %s", err, dockerID[:min(12, len(dockerID))])
+		_ = m.StopContainer(ctx, dockerID)
+	}
+}
+
+// ReapplyNetworkPolicies re-applies network policies to every running
+// container, e.g. after an API restart while the Docker daemon restarted
+// containers on its own.
+func (m *Manager) ReapplyNetworkPolicies(ctx context.Context) {
+	for _, info := range m.ListContainers() {
+		if info.Status != "running" {
+			continue
+		}
+		if err := m.applyNetworkPolicy(ctx, info.ID, info.Labels, false); err != nil {
+			log.Printf("[Network] %v; stopping %s", err, info.ID[:12])
+			_ = m.StopContainer(ctx, info.ID)
+		}
+	}
+}
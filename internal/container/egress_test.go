@@ -0,0 +1,224 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/rexec/rexec/internal/models"
+)
+
+func TestEgressConfigFromEnv(t *testing.T) {
+	t.Setenv("EGRESS_POLICIES", `{"guest":{"mode":"none"},"default":{"deny":["10.0.0.0/8"]}}`)
+	t.Setenv("NETWORK_SHAPING", "off")
+
+	cfg, err := EgressConfigFromEnv()
+	if err != nil {
+		t.Fatalf("EgressConfigFromEnv() error = %v", err)
+	}
+	if cfg.Shaping || cfg.HelperImage != DefaultNetworkHelperImage {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	if cfg.TierPolicies["guest"].Mode != models.EgressNone || len(cfg.TierPolicies["default"].Deny) != 1 {
+		t.Errorf("TierPolicies = %+v", cfg.TierPolicies)
+	}
+
+	t.Setenv("EGRESS_POLICIES", `{"guest":{"mode":"closed"}}`)
+	if _, err := EgressConfigFromEnv(); err == nil {
+		t.Error("expected error for invalid policy")
+	}
+}
+
+func TestBuildEgressScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   models.EgressPolicy
+		allow    []string
+		deny     []string
+		rate     int64
+		want     []string
+		dontWant []string
+	}{
+		{
+			name: "Open with deny",
+			deny: []string{"10.0.0.0/8"},
+			want: []string{
+				"iptables -A REXEC-EGRESS -o lo -j RETURN",
+				"iptables -A REXEC-EGRESS -d 10.0.0.0/8 -j REJECT",
+			},
+			dontWant: []string{"iptables -A REXEC-EGRESS -j REJECT", "tc qdisc"},
+		},
+		{
+			name:   "Allowlist",
+			policy: models.EgressPolicy{Mode: models.EgressAllowlist},
+			allow:  []string{"140.82.112.3/32", "2606:50c0::/32"},
+			want: []string{
+				"iptables -A REXEC-EGRESS -d 140.82.112.3/32 -j RETURN",
+				"ip6tables -A REXEC-EGRESS -d 2606:50c0::/32 -j RETURN",
+				"iptables -A REXEC-EGRESS -j REJECT",
+			},
+			dontWant: []string{"iptables -A REXEC-EGRESS -d 2606:50c0::/32"},
+		},
+		{
+			name:   "No internet with shaping",
+			policy: models.EgressPolicy{Mode: models.EgressNone},
+			rate:   80,
+			want: []string{
+				"iptables -A REXEC-EGRESS -j REJECT",
+				"tc qdisc replace dev eth0 root tbf rate 80mbit",
+				"police rate 80mbit",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := buildEgressScript(tt.policy, tt.allow, tt.deny, tt.rate)
+			for _, w := range tt.want {
+				if !strings.Contains(script, w) {
+					t.Errorf("script missing %q:\n%s", w, script)
+				}
+			}
+			for _, w := range tt.dontWant {
+				if strings.Contains(script, w) {
+					t.Errorf("script should not contain %q:\n%s", w, script)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_ResolveEgressTargets(t *testing.T) {
+	manager := &Manager{
+		lookupIP: func(ctx context.Context, host string) ([]net.IP, error) {
+			if host == "github.com" {
+				return []net.IP{net.ParseIP("140.82.112.3"), net.ParseIP("140.82.112.3")}, nil
+			}
+			return nil, errors.New("no such host")
+		},
+	}
+
+	got := manager.resolveEgressTargets(context.Background(), []string{"github.com", "10.1.2.3/8", "1.1.1.1", "nowhere.invalid"})
+	want := []string{"1.1.1.1/32", "10.0.0.0/8", "140.82.112.3/32"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("resolveEgressTargets() = %v, want %v", got, want)
+	}
+}
+
+func TestManager_ApplyNetworkPolicy(t *testing.T) {
+	id := "egress-container-01"
+	guestLabels := map[string]string{"rexec.tier": "guest", NetworkMBLabel: "5"}
+
+	newManager := func(mockClient *MockDockerClient, cfg EgressConfig) *Manager {
+		m := &Manager{
+			client:     mockClient,
+			containers: make(map[string]*ContainerInfo),
+			userIndex:  make(map[string][]string),
+		}
+		m.SetEgressConfig(cfg)
+		return m
+	}
+
+	t.Run("Nothing to apply", func(t *testing.T) {
+		mockClient := &MockDockerClient{}
+		helpers := 0
+		mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+			helpers++
+			return container.CreateResponse{ID: "helper"}, nil
+		}
+		m := newManager(mockClient, EgressConfig{})
+		if err := m.applyNetworkPolicy(context.Background(), id, guestLabels, false); err != nil || helpers != 0 {
+			t.Errorf("err = %v, helpers = %d", err, helpers)
+		}
+	})
+
+	t.Run("Helper joins the namespace", func(t *testing.T) {
+		mockClient := &MockDockerClient{}
+		var hostCfg *container.HostConfig
+		var script string
+		mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+			hostCfg = hostConfig
+			script = config.Entrypoint[2]
+			return container.CreateResponse{ID: "helper"}, nil
+		}
+		m := newManager(mockClient, EgressConfig{
+			TierPolicies: map[string]models.EgressPolicy{"guest": {Mode: models.EgressNone}},
+			Shaping:      true,
+		})
+		if err := m.applyNetworkPolicy(context.Background(), id, guestLabels, false); err != nil {
+			t.Fatalf("applyNetworkPolicy() error = %v", err)
+		}
+		if hostCfg == nil || string(hostCfg.NetworkMode) != "container:"+id || len(hostCfg.CapAdd) == 0 || hostCfg.CapAdd[0] != "NET_ADMIN" {
+			t.Errorf("helper host config = %+v", hostCfg)
+		}
+		if !strings.Contains(script, "iptables -A REXEC-EGRESS -j REJECT") || !strings.Contains(script, "rate 40mbit") {
+			t.Errorf("script = %s", script)
+		}
+	})
+
+	t.Run("Restrictive policy fails closed", func(t *testing.T) {
+		mockClient := &MockDockerClient{}
+		mockClient.ContainerWaitFunc = func(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+			statusCh := make(chan container.WaitResponse, 1)
+			statusCh <- container.WaitResponse{StatusCode: 1}
+			return statusCh, make(chan error)
+		}
+		m := newManager(mockClient, EgressConfig{})
+		m.trackEgressPolicy(id, &models.EgressPolicy{Mode: models.EgressNone})
+		if err := m.applyNetworkPolicy(context.Background(), id, guestLabels, false); err == nil {
+			t.Error("expected an error when the policy can't be applied")
+		}
+	})
+
+	t.Run("Shaping failure is not fatal", func(t *testing.T) {
+		mockClient := &MockDockerClient{}
+		mockClient.ContainerWaitFunc = func(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+			statusCh := make(chan container.WaitResponse, 1)
+			statusCh <- container.WaitResponse{StatusCode: shapingFailedExit}
+			return statusCh, make(chan error)
+		}
+		m := newManager(mockClient, EgressConfig{
+			TierPolicies: map[string]models.EgressPolicy{"guest": {Mode: models.EgressNone}},
+			Shaping:      true,
+		})
+		if err := m.applyNetworkPolicy(context.Background(), id, guestLabels, false); err != nil {
+			t.Errorf("applyNetworkPolicy() error = %v", err)
+		}
+	})
+}
+
+func TestManager_StartContainer_EgressFailureStops(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+	}
+	id := "egress-container-02"
+	manager.containers[id] = &ContainerInfo{ID: id, Status: "stopped", Labels: map[string]string{"rexec.tier": "free"}}
+	manager.trackEgressPolicy(id, &models.EgressPolicy{Mode: models.EgressNone})
+
+	mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+		return container.CreateResponse{}, errors.New("helper image missing")
+	}
+	stopped := false
+	mockClient.ContainerStopFunc = func(ctx context.Context, containerID string, options container.StopOptions) error {
+		stopped = containerID == id
+		return nil
+	}
+
+	if err := manager.StartContainer(context.Background(), id); err == nil {
+		t.Fatal("StartContainer() should fail when the egress policy can't be applied")
+	}
+	if !stopped {
+		t.Error("container should be stopped again")
+	}
+	if manager.containers[id].Status != "stopped" {
+		t.Errorf("status = %q, want stopped", manager.containers[id].Status)
+	}
+}
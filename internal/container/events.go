@@ -0,0 +1,63 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// eventResubscribeDelay is how long to wait before resubscribing after the
+// Docker event stream breaks
+const eventResubscribeDelay = 5 * time.Second
+
+// watchEvents calls handle for each event with one of the given actions on a
+// Rexec-managed container until ctx is cancelled. When the stream breaks it
+// resubscribes from the last event seen and then calls resubscribed, if set,
+// since the daemon only replays a limited backlog.
+func (m *Manager) watchEvents(ctx context.Context, actions []events.Action, handle func(events.Message), resubscribed func()) {
+	args := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("label", "rexec.managed=true"),
+	)
+	for _, action := range actions {
+		args.Add("event", string(action))
+	}
+	opts := events.ListOptions{Filters: args}
+	since := time.Now()
+
+	for first := true; ; first = false {
+		opts.Since = fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+		msgs, errs := m.client.Events(ctx, opts)
+		if !first && resubscribed != nil {
+			resubscribed()
+		}
+	stream:
+		for {
+			select {
+			case msg := <-msgs:
+				if msg.TimeNano > 0 {
+					since = time.Unix(0, msg.TimeNano+1)
+				}
+				handle(msg)
+			case err := <-errs:
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("[Container] Docker event stream ended, resubscribing: %v", err)
+				break stream
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-time.After(eventResubscribeDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	// DefaultExecTimeout applies to commands that don't set a timeout
+	DefaultExecTimeout = 60 * time.Second
+	// MaxExecTimeout is the longest a command may run
+	MaxExecTimeout = time.Hour
+	// MaxExecStdinBytes caps the stdin sent with a command
+	MaxExecStdinBytes = 1024 * 1024
+
+	// execMarkerEnv is set on every command run by Exec, so a timed-out
+	// command and its children can be found and killed
+	execMarkerEnv = "REXEC_EXEC_ID"
+)
+
+// execKillScript kills every process carrying exec marker $1 in its
+// environment. Docker can't kill an exec, and the command may have started
+// children of its own.
+const execKillScript = `for d in /proc/[0-9]*; do
+	tr '\000' '\n' < "$d/environ" 2>/dev/null | grep -qx "` + execMarkerEnv + `=$1" && kill -s KILL "${d#/proc/}" 2>/dev/null
+done
+exit 0`
+
+var execUserRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+
+// ExecRequest describes a one-shot command. Command is run as is; Script is
+// run with /bin/sh -c. Exactly one of them is set.
+type ExecRequest struct {
+	Command []string          `json:"command,omitempty"`
+	Script  string            `json:"script,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Cwd     string            `json:"cwd,omitempty"`
+	Stdin   string            `json:"stdin,omitempty"`
+	Timeout int               `json:"timeout,omitempty"` // Seconds, DefaultExecTimeout when 0
+	User    string            `json:"user,omitempty"`    // user, uid or user:group
+}
+
+// ExecResult is how a one-shot command ended
+type ExecResult struct {
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMs int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"` // Output past maxExecOutputBytes was dropped
+}
+
+// ExecStreams connects a command run with ExecStream. Nil readers and
+// writers are treated as empty input and discarded output.
+type ExecStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Validate checks a request
+func (req *ExecRequest) Validate() error {
+	if (len(req.Command) == 0) == (req.Script == "") {
+		return fmt.Errorf("either command or script is required")
+	}
+	if len(req.Command) > 0 && req.Command[0] == "" {
+		return fmt.Errorf("command must start with the program to run")
+	}
+	if req.Cwd != "" && !path.IsAbs(req.Cwd) {
+		return fmt.Errorf("cwd must be an absolute path")
+	}
+	for key := range req.Env {
+		if !envKeyRe.MatchString(key) {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+		if key == execMarkerEnv {
+			return fmt.Errorf("%s is reserved", key)
+		}
+	}
+	if len(req.Stdin) > MaxExecStdinBytes {
+		return fmt.Errorf("stdin must be at most %d bytes", MaxExecStdinBytes)
+	}
+	if req.Timeout < 0 || time.Duration(req.Timeout)*time.Second > MaxExecTimeout {
+		return fmt.Errorf("timeout must be between 0 and %d seconds", int(MaxExecTimeout.Seconds()))
+	}
+	if req.User != "" && !execUserRe.MatchString(req.User) {
+		return fmt.Errorf("invalid user %q", req.User)
+	}
+	return nil
+}
+
+// Argv returns the command line the request runs
+func (req *ExecRequest) Argv() []string {
+	if req.Script != "" {
+		return []string{"/bin/sh", "-c", req.Script}
+	}
+	return req.Command
+}
+
+// TimeoutDuration returns how long the command may run
+func (req *ExecRequest) TimeoutDuration() time.Duration {
+	if req.Timeout == 0 {
+		return DefaultExecTimeout
+	}
+	return time.Duration(req.Timeout) * time.Second
+}
+
+// envList returns the request's environment as sorted KEY=value pairs
+func (req *ExecRequest) envList() []string {
+	env := make([]string, 0, len(req.Env))
+	for key, value := range req.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// Exec runs a one-shot command in a container and returns its output, each
+// stream capped at maxExecOutputBytes. A non-zero exit code is not an error.
+func (m *Manager) Exec(ctx context.Context, dockerID string, req ExecRequest) (*ExecResult, error) {
+	stdout := &cappedBuffer{max: maxExecOutputBytes}
+	stderr := &cappedBuffer{max: maxExecOutputBytes}
+	result, err := m.ExecStream(ctx, dockerID, req, ExecStreams{Stdout: stdout, Stderr: stderr})
+	if err != nil {
+		return nil, err
+	}
+	result.Stdout = stdout.buf.String()
+	result.Stderr = stderr.buf.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+	return result, nil
+}
+
+// ExecStream runs a one-shot command in a container, copying its output to
+// streams as it's produced. The returned result has no output. Commands are
+// killed when they time out or ctx is cancelled; a timeout is reported in the
+// result, a cancellation as an error.
+func (m *Manager) ExecStream(ctx context.Context, dockerID string, req ExecRequest, streams ExecStreams) (*ExecResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	markerBytes := make([]byte, 8)
+	if _, err := rand.Read(markerBytes); err != nil {
+		return nil, err
+	}
+	marker := hex.EncodeToString(markerBytes)
+
+	stdin := streams.Stdin
+	if stdin == nil && req.Stdin != "" {
+		stdin = strings.NewReader(req.Stdin)
+	}
+	stdout, stderr := streams.Stdout, streams.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, req.TimeoutDuration())
+	defer cancel()
+	start := time.Now()
+
+	execResp, err := m.client.ContainerExecCreate(execCtx, dockerID, container.ExecOptions{
+		Cmd:          req.Argv(),
+		Env:          append(req.envList(), execMarkerEnv+"="+marker),
+		WorkingDir:   req.Cwd,
+		User:         req.User,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	// Use ContainerExecAttach for Podman compatibility (attach implicitly starts)
+	attachResp, err := m.client.ContainerExecAttach(execCtx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach/start exec: %w", err)
+	}
+	defer attachResp.Close()
+
+	if stdin != nil {
+		go func() {
+			io.Copy(attachResp.Conn, stdin)
+			attachResp.CloseWrite()
+		}()
+	}
+
+	// Kill the command once it runs out of time or its caller goes away,
+	// which ends its output
+	finished := make(chan struct{})
+	killed := make(chan error, 1)
+	go func() {
+		select {
+		case <-finished:
+			killed <- nil
+			return
+		case <-execCtx.Done():
+		}
+		killCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		m.execAndWait(killCtx, dockerID, []string{"/bin/sh", "-c", execKillScript, "rexec-exec", marker})
+		attachResp.Close()
+		killed <- execCtx.Err()
+	}()
+
+	_, copyErr := stdcopy.StdCopy(stdout, stderr, attachResp.Reader)
+	close(finished)
+	killErr := <-killed
+
+	result := &ExecResult{DurationMs: time.Since(start).Milliseconds()}
+	switch {
+	case errors.Is(killErr, context.Canceled):
+		return nil, fmt.Errorf("exec cancelled: %w", killErr)
+	case killErr != nil:
+		result.TimedOut = true
+	case copyErr != nil:
+		return nil, fmt.Errorf("failed to read exec output: %w", copyErr)
+	}
+
+	inspectCtx, cancelInspect := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelInspect()
+	inspect, err := m.client.ContainerExecInspect(inspectCtx, execResp.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	result.ExitCode = inspect.ExitCode
+	if inspect.Running {
+		// The kill didn't land, so there's no exit code yet
+		result.ExitCode = -1
+	}
+	return result, nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest,
+// so a chatty command is still read to the end
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
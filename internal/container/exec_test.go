@@ -0,0 +1,188 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestExecRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ExecRequest
+		wantErr bool
+	}{
+		{"Command", ExecRequest{Command: []string{"go", "test", "./..."}}, false},
+		{"Script", ExecRequest{Script: "make && make test", Cwd: "/src", User: "1000:1000", Timeout: 600}, false},
+		{"Neither", ExecRequest{}, true},
+		{"Both", ExecRequest{Command: []string{"ls"}, Script: "ls"}, true},
+		{"Empty program", ExecRequest{Command: []string{""}}, true},
+		{"Relative cwd", ExecRequest{Script: "ls", Cwd: "src"}, true},
+		{"Bad env name", ExecRequest{Script: "ls", Env: map[string]string{"A-B": "1"}}, true},
+		{"Reserved env", ExecRequest{Script: "ls", Env: map[string]string{execMarkerEnv: "x"}}, true},
+		{"Negative timeout", ExecRequest{Script: "ls", Timeout: -1}, true},
+		{"Long timeout", ExecRequest{Script: "ls", Timeout: 3601}, true},
+		{"Bad user", ExecRequest{Script: "ls", User: "root; rm"}, true},
+		{"Large stdin", ExecRequest{Script: "cat", Stdin: strings.Repeat("x", MaxExecStdinBytes+1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// execOutput frames stdout and stderr the way Docker does for a non-TTY exec
+func execOutput(stdout, stderr string) *bytes.Buffer {
+	var buf bytes.Buffer
+	stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(stdout))
+	stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(stderr))
+	return &buf
+}
+
+func TestManager_Exec(t *testing.T) {
+	var created container.ExecOptions
+	mockClient := &MockDockerClient{
+		ContainerExecCreateFunc: func(ctx context.Context, id string, config container.ExecOptions) (types.IDResponse, error) {
+			created = config
+			return types.IDResponse{ID: "exec-1"}, nil
+		},
+		ContainerExecAttachFunc: func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+			client, server := net.Pipe()
+			server.Close()
+			return types.HijackedResponse{Conn: client, Reader: bufio.NewReader(execOutput("ok\n", "warning\n"))}, nil
+		},
+		ContainerExecInspectFunc: func(ctx context.Context, execID string) (container.ExecInspect, error) {
+			return container.ExecInspect{ExecID: execID, ExitCode: 3}, nil
+		},
+	}
+	m := &Manager{client: mockClient}
+
+	result, err := m.Exec(context.Background(), "abc", ExecRequest{
+		Script: "make test",
+		Env:    map[string]string{"B": "2", "A": "1"},
+		Cwd:    "/src",
+		User:   "dev",
+	})
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if result.ExitCode != 3 || result.Stdout != "ok\n" || result.Stderr != "warning\n" || result.TimedOut || result.Truncated {
+		t.Errorf("Exec() = %+v, want exit 3 with separate stdout and stderr", result)
+	}
+
+	if !reflect.DeepEqual(created.Cmd, []string{"/bin/sh", "-c", "make test"}) {
+		t.Errorf("Cmd = %q, want the script run with sh -c", created.Cmd)
+	}
+	if len(created.Env) != 3 || created.Env[0] != "A=1" || created.Env[1] != "B=2" || !strings.HasPrefix(created.Env[2], execMarkerEnv+"=") {
+		t.Errorf("Env = %q, want sorted variables then the exec marker", created.Env)
+	}
+	if created.WorkingDir != "/src" || created.User != "dev" || created.AttachStdin {
+		t.Errorf("ExecOptions = %+v, want cwd /src, user dev and no stdin", created)
+	}
+}
+
+func TestManager_ExecStream_Stdin(t *testing.T) {
+	mockClient := &MockDockerClient{
+		ContainerExecAttachFunc: func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+			client, server := net.Pipe()
+			// Echo stdin back on stdout, like cat
+			go func() {
+				defer server.Close()
+				input := make([]byte, len("hello"))
+				io.ReadFull(server, input)
+				stdcopy.NewStdWriter(server, stdcopy.Stdout).Write(input)
+			}()
+			return types.HijackedResponse{Conn: client, Reader: bufio.NewReader(client)}, nil
+		},
+	}
+	m := &Manager{client: mockClient}
+
+	var stdout bytes.Buffer
+	result, err := m.ExecStream(context.Background(), "abc", ExecRequest{Command: []string{"cat"}, Stdin: "hello"}, ExecStreams{Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("ExecStream() error = %v", err)
+	}
+	if stdout.String() != "hello" || result.ExitCode != 0 {
+		t.Errorf("ExecStream() = %+v with stdout %q, want exit 0 echoing stdin", result, stdout.String())
+	}
+}
+
+func TestManager_ExecStream_Timeout(t *testing.T) {
+	var mu sync.Mutex
+	var killScript []string
+	mockClient := &MockDockerClient{
+		ContainerExecCreateFunc: func(ctx context.Context, id string, config container.ExecOptions) (types.IDResponse, error) {
+			if len(config.Cmd) > 2 && config.Cmd[2] == execKillScript {
+				mu.Lock()
+				killScript = config.Cmd
+				mu.Unlock()
+				return types.IDResponse{ID: "kill"}, nil
+			}
+			return types.IDResponse{ID: "sleep"}, nil
+		},
+		ContainerExecAttachFunc: func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+			client, server := net.Pipe()
+			if execID == "kill" {
+				server.Close()
+			}
+			// The command never ends on its own
+			return types.HijackedResponse{Conn: client, Reader: bufio.NewReader(client)}, nil
+		},
+		ContainerExecInspectFunc: func(ctx context.Context, execID string) (container.ExecInspect, error) {
+			return container.ExecInspect{ExecID: execID, ExitCode: 137}, nil
+		},
+	}
+	m := &Manager{client: mockClient}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err := m.ExecStream(ctx, "abc", ExecRequest{Command: []string{"sleep", "600"}}, ExecStreams{})
+	if err != nil {
+		t.Fatalf("ExecStream() error = %v", err)
+	}
+	if !result.TimedOut || result.ExitCode != 137 {
+		t.Errorf("ExecStream() = %+v, want a timeout with exit 137", result)
+	}
+
+	mu.Lock()
+	gotKill := killScript
+	mu.Unlock()
+	if len(gotKill) != 5 || len(gotKill[4]) != 16 {
+		t.Errorf("kill command = %q, want the kill script with the exec marker", gotKill)
+	}
+
+	// Cancelled callers get an error instead
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.ExecStream(ctx, "abc", ExecRequest{Command: []string{"sleep", "600"}}, ExecStreams{}); err == nil {
+		t.Error("ExecStream() with a cancelled context succeeded")
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 5}
+	for _, chunk := range []string{"abc", "defg", "h"} {
+		if n, err := b.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if b.buf.String() != "abcde" || !b.truncated {
+		t.Errorf("buffer = %q, truncated %v, want %q truncated", b.buf.String(), b.truncated, "abcde")
+	}
+}
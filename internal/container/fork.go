@@ -0,0 +1,81 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+)
+
+// ForkedFromLabel records the DB ID of the terminal a fork was made from
+const ForkedFromLabel = "rexec.forked_from"
+
+// forkImagePrefix marks fork images within the snapshot repository
+const forkImagePrefix = "fork-"
+
+// ForkImageTag returns the image tag a fork runs from. Fork images live in
+// the snapshot repository, so they are never pulled and can't be requested
+// as custom images.
+func ForkImageTag(forkID string) string {
+	return SnapshotImageTag(forkImagePrefix + forkID)
+}
+
+// IsForkImage reports whether imageName is a fork's image
+func IsForkImage(imageName string) bool {
+	return strings.HasPrefix(familiarImageName(imageName), SnapshotImageRepo+":"+forkImagePrefix)
+}
+
+// ForkContainer captures a terminal's root filesystem and home volume for a
+// new terminal owned by userID. The fork is created from the returned image
+// with the archive restored into its home volume; the archive can be
+// removed once that's done, while the image stays for as long as the fork.
+func (m *Manager) ForkContainer(ctx context.Context, dockerID, userID, forkID string) (*SnapshotInfo, error) {
+	return m.CreateSnapshot(ctx, dockerID, userID, forkImagePrefix+forkID)
+}
+
+// ForkImageStore defines the storage interface needed to remove fork images
+type ForkImageStore interface {
+	CountContainersByImage(ctx context.Context, image string) (int64, error)
+}
+
+// ReleaseForkImage removes a fork's image once no live terminal is created
+// from it. imageName may carry the "custom:" prefix terminal records use;
+// images that aren't fork images are left alone.
+func (m *Manager) ReleaseForkImage(ctx context.Context, store ForkImageStore, imageName string) error {
+	imageName = strings.TrimPrefix(imageName, "custom:")
+	if !IsForkImage(imageName) {
+		return nil
+	}
+	inUse, err := store.CountContainersByImage(ctx, "custom:"+imageName)
+	if err != nil || inUse > 0 {
+		return err
+	}
+	if err := m.DeleteSnapshot(ctx, imageName, ""); err != nil && !errors.Is(err, ErrSnapshotInUse) {
+		return err
+	}
+	return nil
+}
+
+// PruneForkImages releases the images of forks whose terminals are gone.
+// Terminals are deleted along many paths (the API, expiring schedules,
+// containers removed outside Rexec), so the reconciler runs this on every
+// resync to catch any image they left behind.
+func (m *Manager) PruneForkImages(ctx context.Context, store ForkImageStore) {
+	images, err := m.client.ImageList(ctx, image.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", SnapshotImageRepo+":"+forkImagePrefix+"*")),
+	})
+	if err != nil {
+		log.Printf("[Snapshot] Failed to list fork images: %v", err)
+		return
+	}
+	for _, img := range images {
+		for _, tag := range img.RepoTags {
+			if err := m.ReleaseForkImage(ctx, store, tag); err != nil {
+				log.Printf("[Snapshot] Failed to remove fork image %s: %v", tag, err)
+			}
+		}
+	}
+}
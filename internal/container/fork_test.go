@@ -0,0 +1,121 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/errdefs"
+)
+
+func TestIsForkImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+		want  bool
+	}{
+		{"Fork tag", ForkImageTag("abc"), true},
+		{"Snapshot tag", SnapshotImageTag("abc"), false},
+		{"Regular image", "fork-ubuntu:24.04", false},
+		{"Fully qualified", "docker.io/library/" + ForkImageTag("abc"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsForkImage(tt.image); got != tt.want {
+				t.Errorf("IsForkImage(%q) = %v, want %v", tt.image, got, tt.want)
+			}
+		})
+	}
+	if !IsSnapshotImage(ForkImageTag("abc")) {
+		t.Error("fork images should be treated as snapshot images")
+	}
+}
+
+func TestManager_ForkContainer(t *testing.T) {
+	t.Setenv("SNAPSHOT_DIR", t.TempDir())
+
+	mockClient := &MockDockerClient{}
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+	}
+
+	var committed container.CommitOptions
+	mockClient.ContainerCommitFunc = func(ctx context.Context, containerID string, options container.CommitOptions) (container.CommitResponse, error) {
+		committed = options
+		return container.CommitResponse{ID: "sha256:fork"}, nil
+	}
+	mockClient.CopyFromContainerFunc = func(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+		return io.NopCloser(strings.NewReader("home")), container.PathStat{}, nil
+	}
+	mockClient.ImageInspectWithRawFunc = func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+		return types.ImageInspect{}, nil, nil
+	}
+
+	// A collaborator forking someone else's terminal owns the fork image
+	info, err := manager.ForkContainer(context.Background(), "owner-container", "collaborator", "rec-1")
+	if err != nil {
+		t.Fatalf("ForkContainer() error = %v", err)
+	}
+	if info.ImageTag != ForkImageTag("rec-1") || committed.Reference != info.ImageTag {
+		t.Errorf("image tag = %q (committed %q), want %q", info.ImageTag, committed.Reference, ForkImageTag("rec-1"))
+	}
+	if got := committed.Config.Labels["rexec.user_id"]; got != "collaborator" {
+		t.Errorf("fork image owner = %q, want collaborator", got)
+	}
+	if info.ArchivePath == "" {
+		t.Error("ForkContainer() should archive the home volume")
+	}
+}
+
+func TestManager_PruneForkImages(t *testing.T) {
+	live := "custom:" + ForkImageTag("live")
+	mockClient := &MockDockerClient{}
+	var filter string
+	mockClient.ImageListFunc = func(ctx context.Context, options image.ListOptions) ([]image.Summary, error) {
+		filter = strings.Join(options.Filters.Get("reference"), ",")
+		return []image.Summary{
+			{RepoTags: []string{ForkImageTag("live")}},
+			{RepoTags: []string{ForkImageTag("gone")}},
+			{RepoTags: []string{ForkImageTag("busy")}},
+		}, nil
+	}
+	var removed []string
+	mockClient.ImageRemoveFunc = func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+		if imageID == ForkImageTag("busy") {
+			return nil, errdefs.Conflict(errors.New("image is being used by a stopped container"))
+		}
+		removed = append(removed, imageID)
+		return nil, nil
+	}
+	store := &MockContainerStore{
+		CountContainersByImageFunc: func(ctx context.Context, image string) (int64, error) {
+			if image == live {
+				return 1, nil
+			}
+			return 0, nil
+		},
+	}
+	manager := &Manager{client: mockClient}
+
+	manager.PruneForkImages(context.Background(), store)
+	if filter != SnapshotImageRepo+":fork-*" {
+		t.Errorf("reference filter = %q", filter)
+	}
+	if strings.Join(removed, ",") != ForkImageTag("gone") {
+		t.Errorf("removed = %q, want only the fork without a terminal", removed)
+	}
+
+	// Other images are never touched
+	removed = nil
+	if err := manager.ReleaseForkImage(context.Background(), store, "custom:"+SnapshotImageTag("snap")); err != nil || len(removed) != 0 {
+		t.Errorf("ReleaseForkImage() on a snapshot = %v, removed %q", err, removed)
+	}
+}
@@ -0,0 +1,565 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// BuildImageRepo is the local repository built images are tagged into, one
+// repository per user. Like snapshots, these images are never pulled and are
+// only reachable through the build's owner.
+const BuildImageRepo = "rexec-builds"
+
+// MaxBuildContextBytes caps the build context sent to the engine
+const MaxBuildContextBytes = 256 * 1024 * 1024
+
+// BuildImageTag returns the tag for a user's build
+func BuildImageTag(userID, name string) string {
+	return fmt.Sprintf("%s/%s:%s", BuildImageRepo, strings.ToLower(userID), name)
+}
+
+// IsBuildImage reports whether imageName refers to a built image
+func IsBuildImage(imageName string) bool {
+	return strings.HasPrefix(familiarImageName(imageName), BuildImageRepo+"/")
+}
+
+// BuildConfig describes an image build. The context is either ContextDir
+// (e.g. a git checkout) or just the Dockerfile.
+type BuildConfig struct {
+	BuildID        string
+	UserID         string
+	Tier           string // Picks the egress policy RUN steps run under
+	Tag            string
+	Dockerfile     string // Dockerfile contents; overrides DockerfilePath in ContextDir
+	ContextDir     string
+	DockerfilePath string // Relative to ContextDir (default: Dockerfile)
+	NoCache        bool
+	MemoryMB       int64 // Limits for RUN steps
+	CPUMillicores  int64
+	MaxSizeBytes   int64 // The image is removed if it ends up bigger (0 = no limit)
+}
+
+// BuildResult describes a finished build
+type BuildResult struct {
+	ImageID     string
+	SizeBytes   int64
+	Steps       int
+	CachedSteps int
+}
+
+// buildMessage is one line of the engine's build output
+type buildMessage struct {
+	Stream      string `json:"stream"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	ErrorDetail struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+	Aux json.RawMessage `json:"aux"`
+}
+
+var buildStepPattern = regexp.MustCompile(`^Step (\d+)/(\d+) :`)
+
+// BuildImage builds and tags an image, sending each line of build output to
+// progressCh as a "building" event
+func (m *Manager) BuildImage(ctx context.Context, cfg BuildConfig, progressCh chan<- ProgressEvent) (*BuildResult, error) {
+	dockerfile := cfg.DockerfilePath
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	var buildContext *bytes.Buffer
+	var err error
+	if cfg.ContextDir != "" {
+		buildContext, err = tarBuildContext(cfg.ContextDir, dockerfile, cfg.Dockerfile)
+	} else {
+		dockerfile = "Dockerfile"
+		buildContext, err = tarBuildContext("", dockerfile, cfg.Dockerfile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkBuildBases(ctx, cfg, dockerfile, progressCh); err != nil {
+		return nil, err
+	}
+
+	progressCh <- ProgressEvent{
+		Stage:    "building",
+		Message:  "Sending build context",
+		Progress: 0,
+		Detail:   formatBytes(int64(buildContext.Len())),
+	}
+
+	networkMode := m.buildNetworkMode(cfg.Tier)
+	if networkMode == "none" {
+		progressCh <- ProgressEvent{
+			Stage:   "building",
+			Message: "Building without network access",
+			Detail:  "RUN steps can't reach the network under this tier's egress policy",
+		}
+	}
+
+	options := types.ImageBuildOptions{
+		Tags:        []string{cfg.Tag},
+		NetworkMode: networkMode,
+		Dockerfile:  dockerfile,
+		NoCache:     cfg.NoCache,
+		Remove:      true,
+		ForceRemove: true,
+		Version:     types.BuilderV1, // Plain step output, no BuildKit session needed
+		Labels: map[string]string{
+			"rexec.user_id":  cfg.UserID,
+			"rexec.build_id": cfg.BuildID,
+		},
+	}
+	caps := m.Capabilities()
+	if cfg.MemoryMB > 0 && caps.MemoryLimit {
+		options.Memory = cfg.MemoryMB * 1024 * 1024
+		options.MemorySwap = options.Memory
+	}
+	if cfg.CPUMillicores > 0 && caps.CPULimit {
+		options.CPUPeriod = 100000
+		options.CPUQuota = cfg.CPUMillicores * 100
+	}
+
+	resp, err := m.client.ImageBuild(ctx, buildContext, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start build: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result := &BuildResult{}
+	var percent float64
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg buildMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.ErrorDetail.Message != "" || msg.Error != "" {
+			errMsg := msg.ErrorDetail.Message
+			if errMsg == "" {
+				errMsg = msg.Error
+			}
+			return nil, fmt.Errorf("build failed: %s", strings.TrimSpace(errMsg))
+		}
+		if len(msg.Aux) > 0 {
+			var aux struct {
+				ID string `json:"ID"`
+			}
+			if json.Unmarshal(msg.Aux, &aux) == nil && aux.ID != "" {
+				result.ImageID = aux.ID
+			}
+		}
+
+		line := strings.TrimRight(msg.Stream, "\n")
+		if line == "" {
+			line = msg.Status
+		}
+		if line == "" {
+			continue
+		}
+		if match := buildStepPattern.FindStringSubmatch(line); match != nil {
+			step, _ := strconv.Atoi(match[1])
+			total, _ := strconv.Atoi(match[2])
+			result.Steps = total
+			if total > 0 {
+				percent = float64(step-1) / float64(total) * 100
+			}
+		}
+		if strings.Contains(line, "Using cache") {
+			result.CachedSteps++
+		}
+		progressCh <- ProgressEvent{
+			Stage:    "building",
+			Message:  "Building image",
+			Progress: percent,
+			Detail:   line,
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading build output: %w", err)
+	}
+
+	inspect, _, err := m.client.ImageInspectWithRaw(ctx, cfg.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("build finished without an image: %w", err)
+	}
+	result.SizeBytes = inspect.Size
+	if result.ImageID == "" {
+		result.ImageID = inspect.ID
+	}
+	if cfg.MaxSizeBytes > 0 && inspect.Size > cfg.MaxSizeBytes {
+		_, _ = m.client.ImageRemove(ctx, cfg.Tag, image.RemoveOptions{PruneChildren: true})
+		return nil, fmt.Errorf("image is %s, over the %s limit", formatBytes(inspect.Size), formatBytes(cfg.MaxSizeBytes))
+	}
+
+	progressCh <- ProgressEvent{
+		Stage:    "building",
+		Message:  "Build complete",
+		Progress: 100,
+		Detail:   cfg.Tag,
+	}
+	return result, nil
+}
+
+// checkBuildBases makes sure the build's owner may use every image the
+// Dockerfile builds from. The engine would otherwise use whatever the host has
+// cached: other users' private pulls, builds and snapshots.
+func (m *Manager) checkBuildBases(ctx context.Context, cfg BuildConfig, dockerfilePath string, progressCh chan<- ProgressEvent) error {
+	dockerfile := cfg.Dockerfile
+	if dockerfile == "" {
+		data, err := readDockerfile(filepath.Join(cfg.ContextDir, filepath.FromSlash(dockerfilePath)))
+		if err != nil {
+			return err
+		}
+		dockerfile = data
+	}
+	bases, err := dockerfileBaseImages(dockerfile)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(bases); i++ {
+		ref := bases[i]
+		if !IsSnapshotImage(ref) && !IsBuildImage(ref) {
+			if err := m.pullBaseImage(ctx, cfg.UserID, ref, progressCh); err != nil {
+				return err
+			}
+		}
+		if err := m.checkImageOwner(ctx, cfg.UserID, ref); err != nil {
+			return fmt.Errorf("%s: %w", ref, err)
+		}
+
+		// A base's ONBUILD triggers run in this build, so their COPY --from
+		// images need the same checks
+		inspect, _, err := m.client.ImageInspectWithRaw(ctx, ref)
+		if err != nil || inspect.Config == nil || len(inspect.Config.OnBuild) == 0 {
+			continue
+		}
+		triggered, err := dockerfileBaseImages(strings.Join(inspect.Config.OnBuild, "\n"))
+		if err != nil {
+			return err
+		}
+		for _, t := range triggered {
+			if !slices.Contains(bases, t) {
+				bases = append(bases, t)
+			}
+		}
+	}
+	return nil
+}
+
+// checkImageOwner makes sure userID may use a local image. Snapshots and
+// builds must exist and carry userID's rexec.user_id label. Other images with
+// an owner label (one named by its ID, say) are held to it as well.
+func (m *Manager) checkImageOwner(ctx context.Context, userID, imageName string) error {
+	owned := IsSnapshotImage(imageName) || IsBuildImage(imageName)
+	inspect, _, err := m.client.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		if owned {
+			return fmt.Errorf("image not found: %w", err)
+		}
+		return nil
+	}
+	var owner string
+	if inspect.Config != nil {
+		owner = inspect.Config.Labels["rexec.user_id"]
+	}
+	if (owned || owner != "") && owner != userID {
+		return fmt.Errorf("image belongs to another user")
+	}
+	return nil
+}
+
+// pullBaseImage pulls a base image with userID's credentials even when it's
+// cached, so its registry decides whether they may build from it
+func (m *Manager) pullBaseImage(ctx context.Context, userID, ref string, progressCh chan<- ProgressEvent) error {
+	auth, err := m.registryAuth.EncodedAuth(ctx, userID, ref)
+	if err != nil {
+		return fmt.Errorf("failed to load registry credentials: %w", err)
+	}
+	progressCh <- ProgressEvent{
+		Stage:   "building",
+		Message: "Pulling base image",
+		Detail:  ref,
+	}
+	reader, err := m.client.ImagePull(ctx, ref, image.PullOptions{RegistryAuth: auth})
+	if err != nil {
+		return fmt.Errorf("failed to pull base image %s: %w", ref, err)
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg buildMessage
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		if msg.ErrorDetail.Message != "" || msg.Error != "" {
+			errMsg := msg.ErrorDetail.Message
+			if errMsg == "" {
+				errMsg = msg.Error
+			}
+			return fmt.Errorf("failed to pull base image %s: %s", ref, strings.TrimSpace(errMsg))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to pull base image %s: %w", ref, err)
+	}
+	return nil
+}
+
+// readDockerfile reads a Dockerfile from a build context
+func readDockerfile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Dockerfile: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, models.MaxDockerfileBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read Dockerfile: %w", err)
+	}
+	if len(data) > models.MaxDockerfileBytes {
+		return "", fmt.Errorf("dockerfile exceeds %d bytes", models.MaxDockerfileBytes)
+	}
+	return string(data), nil
+}
+
+// dockerfileBaseImages returns the images a Dockerfile builds from: every
+// FROM that isn't an earlier stage and every COPY --from naming an image.
+// Global ARG defaults are substituted; a reference that still depends on a
+// variable is an error, since it can't be checked before the build.
+func dockerfileBaseImages(dockerfile string) ([]string, error) {
+	args := map[string]string{}
+	stages := map[string]bool{}
+	seen := map[string]bool{}
+	var bases []string
+	add := func(ref string) error {
+		if strings.Contains(ref, "$") {
+			return fmt.Errorf("base image %q depends on a build argument", ref)
+		}
+		if ref == "" || strings.EqualFold(ref, "scratch") || stages[strings.ToLower(ref)] || seen[ref] {
+			return nil
+		}
+		seen[ref] = true
+		bases = append(bases, ref)
+		return nil
+	}
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string {
+			if key, def, ok := strings.Cut(name, ":-"); ok {
+				if v := args[key]; v != "" {
+					return v
+				}
+				return def
+			}
+			if v, ok := args[name]; ok {
+				return v
+			}
+			return "${" + name + "}"
+		})
+	}
+
+	inStage := false
+	for _, line := range dockerfileInstructions(dockerfile) {
+		fields := strings.Fields(line)
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			if inStage {
+				continue
+			}
+			for _, arg := range fields[1:] {
+				name, value, _ := strings.Cut(arg, "=")
+				args[name] = strings.Trim(value, `"'`)
+			}
+		case "FROM":
+			inStage = true
+			rest := fields[1:]
+			for len(rest) > 0 && strings.HasPrefix(rest[0], "--") {
+				rest = rest[1:]
+			}
+			if len(rest) == 0 {
+				continue
+			}
+			if err := add(expand(rest[0])); err != nil {
+				return nil, err
+			}
+			if len(rest) >= 3 && strings.EqualFold(rest[1], "AS") {
+				stages[strings.ToLower(rest[2])] = true
+			}
+		case "COPY":
+			for _, flag := range fields[1:] {
+				if !strings.HasPrefix(flag, "--") {
+					break
+				}
+				from, ok := strings.CutPrefix(flag, "--from=")
+				if !ok {
+					continue
+				}
+				if _, err := strconv.Atoi(from); err == nil {
+					continue // Stage index
+				}
+				if err := add(from); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return bases, nil
+}
+
+// dockerfileInstructions splits a Dockerfile into instructions, joining
+// continuation lines and dropping comments. It honours the escape directive.
+func dockerfileInstructions(dockerfile string) []string {
+	escape := `\`
+	lines := strings.Split(strings.ReplaceAll(dockerfile, "\r\n", "\n"), "\n")
+	for _, line := range lines {
+		directive, ok := strings.CutPrefix(strings.TrimSpace(line), "#")
+		if !ok {
+			break
+		}
+		key, value, ok := strings.Cut(directive, "=")
+		if !ok {
+			break
+		}
+		if strings.EqualFold(strings.TrimSpace(key), "escape") {
+			if v := strings.TrimSpace(value); v == "`" || v == `\` {
+				escape = v
+			}
+		}
+	}
+
+	var instructions []string
+	var current strings.Builder
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if cont, ok := strings.CutSuffix(trimmed, escape); ok {
+			current.WriteString(cont)
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(trimmed)
+		instructions = append(instructions, current.String())
+		current.Reset()
+	}
+	if current.Len() > 0 && strings.TrimSpace(current.String()) != "" {
+		instructions = append(instructions, current.String())
+	}
+	return instructions
+}
+
+// DeleteBuildImage removes a built image. Terminals still using it keep it
+// alive in the engine until they're removed.
+func (m *Manager) DeleteBuildImage(ctx context.Context, tag string) error {
+	if !IsBuildImage(tag) {
+		return fmt.Errorf("not a build image: %s", tag)
+	}
+	_, err := m.client.ImageRemove(ctx, tag, image.RemoveOptions{PruneChildren: true})
+	return err
+}
+
+// tarBuildContext archives dir (skipping .git) as a build context. A
+// non-empty dockerfile replaces the file at dockerfilePath. Symlinks are kept
+// as links; the engine resolves them inside the context.
+func tarBuildContext(dir, dockerfilePath, dockerfile string) (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	var total int64
+	now := time.Now()
+
+	if dir != "" {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || rel == "." {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if dockerfile != "" && rel == dockerfilePath {
+				return nil
+			}
+
+			link := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			} else if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil // sockets, devices and the like
+			}
+			hdr, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = rel
+			hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+			if total += hdr.Size; total > MaxBuildContextBytes {
+				return fmt.Errorf("build context is over the %s limit", formatBytes(MaxBuildContextBytes))
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if dockerfile != "" {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    dockerfilePath,
+			Mode:    0644,
+			Size:    int64(len(dockerfile)),
+			ModTime: now,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(dockerfile)); err != nil {
+			return nil, err
+		}
+	} else if dir == "" {
+		return nil, errors.New("a Dockerfile is required")
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
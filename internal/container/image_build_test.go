@@ -0,0 +1,326 @@
+package container
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// tarNames lists the entries of a build context
+func tarNames(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	entries := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("reading context: %v", err)
+		}
+		body, _ := io.ReadAll(tr)
+		entries[hdr.Name] = string(body)
+	}
+}
+
+func TestTarBuildContext(t *testing.T) {
+	dir := t.TempDir()
+	must := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(os.MkdirAll(filepath.Join(dir, ".git", "objects"), 0755))
+	must(os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref"), 0644))
+	must(os.MkdirAll(filepath.Join(dir, "src"), 0755))
+	must(os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0644))
+	must(os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine"), 0644))
+
+	buf, err := tarBuildContext(dir, "Dockerfile", "")
+	must(err)
+	entries := tarNames(t, buf)
+	if entries["Dockerfile"] != "FROM alpine" || entries["src/main.go"] != "package main" {
+		t.Errorf("entries = %v", entries)
+	}
+	for name := range entries {
+		if strings.HasPrefix(name, ".git") {
+			t.Errorf("context includes %s", name)
+		}
+	}
+
+	// An inline Dockerfile replaces the repo's
+	buf, err = tarBuildContext(dir, "Dockerfile", "FROM ubuntu")
+	must(err)
+	if got := tarNames(t, buf)["Dockerfile"]; got != "FROM ubuntu" {
+		t.Errorf("Dockerfile = %q, want the inline one", got)
+	}
+
+	buf, err = tarBuildContext("", "Dockerfile", "FROM debian")
+	must(err)
+	if entries := tarNames(t, buf); len(entries) != 1 || entries["Dockerfile"] != "FROM debian" {
+		t.Errorf("Dockerfile-only context = %v", entries)
+	}
+
+	if _, err := tarBuildContext("", "Dockerfile", ""); err == nil {
+		t.Error("expected an error for an empty context")
+	}
+}
+
+func TestBuildImage(t *testing.T) {
+	output := strings.Join([]string{
+		`{"stream":"Step 1/2 : FROM alpine\n"}`,
+		`{"stream":" ---> Using cache\n"}`,
+		`{"stream":"Step 2/2 : RUN apk add go\n"}`,
+		`{"aux":{"ID":"sha256:built"}}`,
+		`{"stream":"Successfully tagged rexec-builds/user-1:go\n"}`,
+	}, "\n")
+
+	tests := []struct {
+		name      string
+		output    string
+		size      int64
+		maxSize   int64
+		wantErr   string
+		wantCache int
+	}{
+		{"Success", output, 100, 1000, "", 1},
+		{"Build error", `{"stream":"Step 1/1 : RUN false\n"}` + "\n" + `{"errorDetail":{"message":"exit code 1"},"error":"exit code 1"}`, 0, 0, "exit code 1", 0},
+		{"Too large", output, 2000, 1000, "over the", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockDockerClient{}
+			var options types.ImageBuildOptions
+			mockClient.ImageBuildFunc = func(ctx context.Context, buildContext io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+				options = opts
+				return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(tt.output))}, nil
+			}
+			mockClient.ImageInspectWithRawFunc = func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+				return types.ImageInspect{ID: "sha256:built", Size: tt.size}, nil, nil
+			}
+			var removed string
+			mockClient.ImageRemoveFunc = func(ctx context.Context, imageID string, opts image.RemoveOptions) ([]image.DeleteResponse, error) {
+				removed = imageID
+				return nil, nil
+			}
+
+			manager := newPauseTestManager(mockClient)
+			progressCh := make(chan ProgressEvent, 100)
+			tag := BuildImageTag("user-1", "go")
+			result, err := manager.BuildImage(context.Background(), BuildConfig{
+				UserID: "user-1", BuildID: "b1", Tag: tag, Dockerfile: "FROM alpine", MemoryMB: 512, MaxSizeBytes: tt.maxSize,
+			}, progressCh)
+			close(progressCh)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BuildImage() error = %v, want %q", err, tt.wantErr)
+				}
+				if tt.size > tt.maxSize && removed != tag {
+					t.Errorf("oversized image wasn't removed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildImage() error = %v", err)
+			}
+			if result.ImageID != "sha256:built" || result.Steps != 2 || result.CachedSteps != tt.wantCache || result.SizeBytes != tt.size {
+				t.Errorf("result = %+v", result)
+			}
+			if len(options.Tags) != 1 || options.Tags[0] != tag || options.Labels["rexec.user_id"] != "user-1" || options.Memory != 512*1024*1024 || options.NetworkMode != IsolatedNetworkName {
+				t.Errorf("options = %+v", options)
+			}
+
+			var lines []string
+			for ev := range progressCh {
+				if ev.Stage != "building" {
+					t.Errorf("stage = %q, want building", ev.Stage)
+				}
+				lines = append(lines, ev.Detail)
+			}
+			if len(lines) < 4 || lines[0] != "alpine" || lines[2] != "Step 1/2 : FROM alpine" {
+				t.Errorf("progress details = %q", lines)
+			}
+		})
+	}
+}
+
+func TestIsBuildImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{BuildImageTag("user-1", "go"), true},
+		{"docker.io/" + BuildImageTag("user-1", "go"), true},
+		{"ghcr.io/" + BuildImageTag("user-1", "go"), false},
+		{"rexec-builds-other/x:1", false},
+		{"golang:1.22", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsBuildImage(tt.image); got != tt.want {
+			t.Errorf("IsBuildImage(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestDockerfileBaseImages(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []string
+		wantErr    bool
+	}{
+		{"Single", "FROM alpine:3.20\nRUN apk add go", []string{"alpine:3.20"}, false},
+		{"Stages", "FROM golang:1.22 AS build\nRUN go build\nFROM build AS test\nFROM scratch\nCOPY --from=build /app /app\nCOPY --from=0 /x /x", []string{"golang:1.22"}, false},
+		{"Platform and copy from image", "FROM --platform=linux/amd64 debian\nCOPY --chown=1000 --from=rexec-snapshots:abc /home /home", []string{"debian", "rexec-snapshots:abc"}, false},
+		{"Continuation", "FROM \\\n  # comment\n  ghcr.io/org/private:1 AS base", []string{"ghcr.io/org/private:1"}, false},
+		{"Escape directive", "# escape=`\nFROM alpine `\nAS base\nFROM rexec-builds/other:x", []string{"alpine", "rexec-builds/other:x"}, false},
+		{"Global arg", "ARG TAG=3.20\nARG IMG\nFROM alpine:${TAG}\nFROM ${REPO:-debian}:$TAG", []string{"alpine:3.20", "debian:3.20"}, false},
+		{"Unresolved arg", "FROM ${IMAGE}", nil, true},
+		{"Stage arg isn't global", "FROM alpine\nARG IMG=x\nFROM $IMG", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dockerfileBaseImages(tt.dockerfile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dockerfileBaseImages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("dockerfileBaseImages() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildImage_BaseImages(t *testing.T) {
+	owned := func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+		switch {
+		case strings.Contains(imageID, "mine"):
+			return types.ImageInspect{Config: &container.Config{Labels: map[string]string{"rexec.user_id": "user-1"}}}, nil, nil
+		case imageID == "onbuild":
+			return types.ImageInspect{Config: &container.Config{OnBuild: []string{"COPY --from=rexec-snapshots:theirs / /"}}}, nil, nil
+		case strings.Contains(imageID, "theirs"), strings.Contains(imageID, "user-2"), strings.HasPrefix(imageID, "sha256:"):
+			return types.ImageInspect{Config: &container.Config{Labels: map[string]string{"rexec.user_id": "user-2"}}}, nil, nil
+		}
+		return types.ImageInspect{Config: &container.Config{}}, nil, nil
+	}
+
+	tests := []struct {
+		name       string
+		dockerfile string
+		wantPulls  []string
+		wantErr    string
+	}{
+		{"Registry images are pulled", "FROM alpine\nCOPY --from=ghcr.io/org/tool /bin/tool /bin/", []string{"alpine", "ghcr.io/org/tool"}, ""},
+		{"Own snapshot", "FROM rexec-snapshots:mine", nil, ""},
+		{"Other user's snapshot", "FROM rexec-snapshots:theirs", nil, "belongs to another user"},
+		{"Other user's build", "FROM alpine\nCOPY --from=rexec-builds/user-2:x / /", []string{"alpine"}, "belongs to another user"},
+		{"ONBUILD trigger", "FROM onbuild", []string{"onbuild"}, "belongs to another user"},
+		{"Another user's image by ID", "FROM sha256:0123abcd", []string{"sha256:0123abcd"}, "belongs to another user"},
+		{"Normalized snapshot name", "FROM docker.io/library/rexec-snapshots:theirs", nil, "belongs to another user"},
+		{"Denied pull", "FROM ghcr.io/org/private", []string{"ghcr.io/org/private"}, "denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pulls []string
+			built := false
+			mockClient := &MockDockerClient{
+				ImageInspectWithRawFunc: owned,
+				ImagePullFunc: func(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+					pulls = append(pulls, ref)
+					if strings.Contains(ref, "private") {
+						return io.NopCloser(strings.NewReader(`{"errorDetail":{"message":"pull access denied"},"error":"pull access denied"}`)), nil
+					}
+					return io.NopCloser(strings.NewReader(`{"status":"Pulling from library/alpine"}`)), nil
+				},
+				ImageBuildFunc: func(ctx context.Context, buildContext io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+					built = true
+					return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+				},
+			}
+			manager := newPauseTestManager(mockClient)
+
+			_, err := manager.BuildImage(context.Background(), BuildConfig{UserID: "user-1", Tag: BuildImageTag("user-1", "x"), Dockerfile: tt.dockerfile}, make(chan ProgressEvent, 100))
+			if strings.Join(pulls, ",") != strings.Join(tt.wantPulls, ",") {
+				t.Errorf("pulled %q, want %q", pulls, tt.wantPulls)
+			}
+			if tt.wantErr == "" {
+				if err != nil || !built {
+					t.Errorf("BuildImage() error = %v, built = %v", err, built)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("BuildImage() error = %v, want %q", err, tt.wantErr)
+			}
+			if built {
+				t.Error("build ran despite a failed base image check")
+			}
+		})
+	}
+}
+
+func TestBuildImage_NetworkMode(t *testing.T) {
+	tests := []struct {
+		tier string
+		want string
+	}{
+		{"pro", IsolatedNetworkName},
+		{"guest", "none"},
+		{"free", "none"}, // Falls back to the default policy
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tier, func(t *testing.T) {
+			var networkMode string
+			mockClient := &MockDockerClient{
+				ImageBuildFunc: func(ctx context.Context, buildContext io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+					networkMode = string(opts.NetworkMode)
+					return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+				},
+			}
+			manager := newPauseTestManager(mockClient)
+			manager.SetEgressConfig(EgressConfig{TierPolicies: map[string]models.EgressPolicy{
+				"pro":     {},
+				"guest":   {Mode: models.EgressNone},
+				"default": {Deny: []string{"10.0.0.0/8"}},
+			}})
+
+			manager.BuildImage(context.Background(), BuildConfig{Tier: tt.tier, Tag: BuildImageTag("u", "x"), Dockerfile: "FROM alpine"}, make(chan ProgressEvent, 10))
+			if networkMode != tt.want {
+				t.Errorf("NetworkMode = %q, want %q", networkMode, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildImageStartError(t *testing.T) {
+	mockClient := &MockDockerClient{
+		ImageBuildFunc: func(ctx context.Context, buildContext io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+			return types.ImageBuildResponse{}, errors.New("daemon unavailable")
+		},
+	}
+	manager := newPauseTestManager(mockClient)
+	_, err := manager.BuildImage(context.Background(), BuildConfig{Tag: BuildImageTag("u", "x"), Dockerfile: "FROM alpine"}, make(chan ProgressEvent, 10))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if manager.DeleteBuildImage(context.Background(), "alpine:latest") == nil {
+		t.Error("DeleteBuildImage should refuse non-build images")
+	}
+}
@@ -0,0 +1,417 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/google/uuid"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// A terminal is restarted automatically at most maxIncidentRestarts times
+// within incidentRestartWindow, so a crash loop ends up stopped
+const (
+	maxIncidentRestarts   = 3
+	incidentRestartWindow = 15 * time.Minute
+)
+
+// How long after reporting an incident the same kind isn't reported again
+// for a terminal. Usage is checked on every metrics sample and an OOM can
+// kill many processes at once.
+const (
+	usageIncidentCooldown = 30 * time.Minute
+	oomIncidentCooldown   = time.Minute
+)
+
+// requestedStopWindow is how long after a kill event a container dying is
+// taken to be a stop someone asked for. Docker sends one for every stop,
+// restart and kill made through its API, but not when the kernel kills the
+// main process.
+const requestedStopWindow = time.Minute
+
+// IncidentStore defines the storage interface needed by the incident watcher
+type IncidentStore interface {
+	GetContainerByDockerID(ctx context.Context, dockerID string) (*storage.ContainerRecord, error)
+	GetContainerIncidentPolicy(ctx context.Context, id string) (*models.IncidentPolicy, error)
+	GetUserByID(ctx context.Context, id string) (*models.User, error)
+	UpdateContainerSettings(ctx context.Context, id, name string, memoryMB, cpuShares, diskMB int64) error
+	UpdateContainerStatus(ctx context.Context, id, status string) error
+	CreateContainerIncident(ctx context.Context, incident *models.ContainerIncident) error
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// IncidentWatcher turns OOM kills, unexpected exits and failing health
+// checks from Docker's event stream, and memory and disk use near their
+// limits from metrics samples, into incidents. Each is recorded, audited and
+// passed to the incident hook, and the terminal's incident policy may
+// restart it or grow its memory. Only the elected leader watches events.
+type IncidentWatcher struct {
+	manager       *Manager
+	store         IncidentStore
+	leader        LeaderElector
+	checkInterval time.Duration
+	stopChan      chan struct{}
+	onIncident    func(incident *models.ContainerIncident, status string)
+
+	mu         sync.Mutex
+	killedAt   map[string]time.Time   // dockerID -> last kill event
+	reportedAt map[string]time.Time   // dockerID + kind -> last incident
+	restarts   map[string][]time.Time // dockerID -> recent automatic restarts
+}
+
+// NewIncidentWatcher creates an incident watcher. checkInterval is how often
+// leadership is checked.
+func NewIncidentWatcher(manager *Manager, store IncidentStore, leader LeaderElector, checkInterval time.Duration) *IncidentWatcher {
+	return &IncidentWatcher{
+		manager:       manager,
+		store:         store,
+		leader:        leader,
+		checkInterval: checkInterval,
+		stopChan:      make(chan struct{}),
+		killedAt:      make(map[string]time.Time),
+		reportedAt:    make(map[string]time.Time),
+		restarts:      make(map[string][]time.Time),
+	}
+}
+
+// SetIncidentHook sets a callback run after an incident is recorded. status
+// is the terminal's new status if the incident or its action changed it
+// ("running" or "stopped"), or empty.
+func (w *IncidentWatcher) SetIncidentHook(fn func(incident *models.ContainerIncident, status string)) {
+	w.onIncident = fn
+}
+
+// Start begins watching for incidents
+func (w *IncidentWatcher) Start() {
+	go w.run()
+	log.Printf("🚨 Incident watcher started")
+}
+
+// Stop stops the incident watcher
+func (w *IncidentWatcher) Stop() {
+	close(w.stopChan)
+}
+
+// run watches Docker events while this instance is the leader
+func (w *IncidentWatcher) run() {
+	ticker := time.NewTicker(w.checkInterval)
+	defer ticker.Stop()
+
+	var cancel context.CancelFunc
+	defer func() {
+		if cancel != nil {
+			cancel()
+		}
+	}()
+
+	for {
+		leading := true
+		if w.leader != nil {
+			ctx, done := context.WithTimeout(context.Background(), w.checkInterval)
+			leading = w.leader.IsLeader(ctx)
+			done()
+		}
+		if leading && cancel == nil {
+			ctx, stop := context.WithCancel(context.Background())
+			cancel = stop
+			go w.manager.watchEvents(ctx, incidentEvents, func(msg events.Message) { w.handleEvent(ctx, msg) }, nil)
+		} else if !leading && cancel != nil {
+			cancel()
+			cancel = nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+// incidentEvents are the Docker events the incident watcher acts on
+var incidentEvents = []events.Action{
+	events.ActionKill,
+	events.ActionOOM,
+	events.ActionDie,
+	"health_status",
+}
+
+func (w *IncidentWatcher) handleEvent(ctx context.Context, msg events.Message) {
+	dockerID := msg.Actor.ID
+	switch msg.Action {
+	case events.ActionKill:
+		w.mu.Lock()
+		w.killedAt[dockerID] = time.Now()
+		w.mu.Unlock()
+	case events.ActionOOM:
+		w.oomKilled(ctx, dockerID)
+	case events.ActionDie:
+		w.died(ctx, dockerID, msg.Actor.Attributes["exitCode"])
+	case events.ActionHealthStatusUnhealthy:
+		w.unhealthy(ctx, dockerID)
+	}
+}
+
+// Observe checks a metrics sample of a terminal for memory or disk use near
+// its limit
+func (w *IncidentWatcher) Observe(dockerID string, sample models.MetricSample) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if sample.MemoryLimit > 0 && float64(sample.Memory) >= models.IncidentUsageThreshold*float64(sample.MemoryLimit) &&
+		w.due(dockerID, models.IncidentMemoryPressure, usageIncidentCooldown) {
+		record, policy := w.lookup(ctx, dockerID)
+		if record != nil {
+			incident := newIncident(record, dockerID, models.IncidentMemoryPressure,
+				fmt.Sprintf("Memory use reached %.0f%% of the %s limit", percent(sample.Memory, sample.MemoryLimit), formatMB(sample.MemoryLimit)),
+				map[string]interface{}{"memory_bytes": sample.Memory, "memory_limit_bytes": sample.MemoryLimit})
+			if policy.AutoGrowMemory {
+				w.growMemory(ctx, record, dockerID, incident)
+			}
+			w.raise(ctx, incident, "")
+		}
+	}
+
+	if sample.DiskLimit > 0 && float64(sample.DiskUsage) >= models.IncidentUsageThreshold*float64(sample.DiskLimit) &&
+		w.due(dockerID, models.IncidentDiskFull, usageIncidentCooldown) {
+		if record, _ := w.lookup(ctx, dockerID); record != nil {
+			w.raise(ctx, newIncident(record, dockerID, models.IncidentDiskFull,
+				fmt.Sprintf("Disk use reached %.0f%% of the %s quota", percent(sample.DiskUsage, sample.DiskLimit), formatMB(sample.DiskLimit)),
+				map[string]interface{}{"disk_bytes": sample.DiskUsage, "disk_limit_bytes": sample.DiskLimit}), "")
+		}
+	}
+}
+
+// oomKilled handles the kernel killing a process in the terminal for going
+// over its memory limit
+func (w *IncidentWatcher) oomKilled(ctx context.Context, dockerID string) {
+	if !w.due(dockerID, models.IncidentOOMKill, oomIncidentCooldown) {
+		return
+	}
+	record, policy := w.lookup(ctx, dockerID)
+	if record == nil {
+		return
+	}
+	incident := newIncident(record, dockerID, models.IncidentOOMKill,
+		fmt.Sprintf("A process was killed for using more than the %d MB memory limit", record.MemoryMB),
+		map[string]interface{}{"memory_limit_mb": record.MemoryMB})
+	if policy.AutoGrowMemory {
+		w.growMemory(ctx, record, dockerID, incident)
+	}
+	w.raise(ctx, incident, "")
+}
+
+// died handles a terminal's main process exiting. Stops made through
+// Docker's API are expected and ignored.
+func (w *IncidentWatcher) died(ctx context.Context, dockerID, exitCode string) {
+	w.mu.Lock()
+	requested := time.Since(w.killedAt[dockerID]) < requestedStopWindow
+	delete(w.killedAt, dockerID)
+	w.mu.Unlock()
+	if requested {
+		return
+	}
+	record, policy := w.lookup(ctx, dockerID)
+	if record == nil {
+		return
+	}
+
+	code, _ := strconv.Atoi(exitCode)
+	oomKilled, dockerRestarts, restartCount := false, false, 0
+	if inspect, err := w.manager.client.ContainerInspect(ctx, dockerID); err == nil && inspect.ContainerJSONBase != nil && inspect.State != nil {
+		oomKilled = inspect.State.OOMKilled
+		dockerRestarts = inspect.State.Restarting || inspect.State.Running
+		restartCount = inspect.RestartCount
+	}
+	message := fmt.Sprintf("The terminal stopped unexpectedly (exit code %d)", code)
+	if oomKilled {
+		message = fmt.Sprintf("The terminal stopped after running out of memory (exit code %d)", code)
+	}
+	incident := newIncident(record, dockerID, models.IncidentCrash, message,
+		map[string]interface{}{"exit_code": code, "oom_killed": oomKilled})
+
+	// Terminals run with an unless-stopped restart policy, so Docker usually
+	// brings them back itself; starting or marking them stopped would race it
+	if dockerRestarts {
+		incident.Action = models.IncidentActionRestarted
+		incident.Details["restarted_by"] = "docker"
+		incident.Details["restart_count"] = restartCount
+		w.raise(ctx, incident, "")
+		return
+	}
+
+	status := "stopped"
+	if policy.AutoRestart && w.restart(ctx, dockerID, incident, w.manager.StartContainer) {
+		status = "running"
+	} else {
+		w.manager.UpdateContainerStatus(dockerID, "stopped")
+		if err := w.store.UpdateContainerStatus(ctx, record.ID, "stopped"); err != nil {
+			log.Printf("🚨 Incidents: failed to mark %s stopped: %v", record.Name, err)
+		}
+	}
+	w.raise(ctx, incident, status)
+}
+
+// unhealthy handles the image's health check starting to fail
+func (w *IncidentWatcher) unhealthy(ctx context.Context, dockerID string) {
+	record, policy := w.lookup(ctx, dockerID)
+	if record == nil {
+		return
+	}
+	incident := newIncident(record, dockerID, models.IncidentUnhealthy, "The terminal's health check is failing", nil)
+	if policy.AutoRestart {
+		w.restart(ctx, dockerID, incident, w.manager.RestartContainer)
+	}
+	w.raise(ctx, incident, "")
+}
+
+// restart starts the terminal again unless it has used up its automatic
+// restarts, recording the outcome on the incident
+func (w *IncidentWatcher) restart(ctx context.Context, dockerID string, incident *models.ContainerIncident, start func(context.Context, string) error) bool {
+	now := time.Now()
+	w.mu.Lock()
+	var recent []time.Time
+	for _, t := range w.restarts[dockerID] {
+		if now.Sub(t) < incidentRestartWindow {
+			recent = append(recent, t)
+		}
+	}
+	allowed := len(recent) < maxIncidentRestarts
+	if allowed {
+		recent = append(recent, now)
+	}
+	w.restarts[dockerID] = recent
+	w.mu.Unlock()
+
+	if !allowed {
+		incident.ActionError = fmt.Sprintf("already restarted %d times in the last %v", maxIncidentRestarts, incidentRestartWindow)
+		return false
+	}
+	if err := start(ctx, dockerID); err != nil {
+		incident.ActionError = SanitizeError(err)
+		return false
+	}
+	incident.Action = models.IncidentActionRestarted
+	return true
+}
+
+// growMemory raises the terminal's memory limit by half, up to its owner's
+// tier maximum, recording the outcome on the incident
+func (w *IncidentWatcher) growMemory(ctx context.Context, record *storage.ContainerRecord, dockerID string, incident *models.ContainerIncident) {
+	user, err := w.store.GetUserByID(ctx, record.UserID)
+	if err != nil || user == nil {
+		incident.ActionError = "couldn't look up the owner's tier"
+		return
+	}
+	limits := models.GetUserResourceLimits(user.Tier, user.SubscriptionActive)
+	current := record.MemoryMB
+	if current <= 0 {
+		current = models.TierLimits(user.Tier).MemoryMB
+	}
+	next := min(current+current/2, limits.MemoryMB)
+	if next <= current {
+		incident.ActionError = fmt.Sprintf("already at the tier's %d MB maximum", limits.MemoryMB)
+		return
+	}
+
+	if err := w.manager.UpdateContainerResources(ctx, dockerID, next, 0); err != nil {
+		incident.ActionError = SanitizeError(err)
+		return
+	}
+	if err := w.store.UpdateContainerSettings(ctx, record.ID, record.Name, next, record.CPUShares, record.DiskMB); err != nil {
+		log.Printf("🚨 Incidents: grew %s to %d MB but failed to save it: %v", record.Name, next, err)
+	}
+	incident.Action = models.IncidentActionGrewMemory
+	incident.Details["memory_mb_before"] = current
+	incident.Details["memory_mb"] = next
+}
+
+// lookup finds the terminal's record and incident policy. It returns a nil
+// record for containers without one, such as warm pool members.
+func (w *IncidentWatcher) lookup(ctx context.Context, dockerID string) (*storage.ContainerRecord, models.IncidentPolicy) {
+	record, err := w.store.GetContainerByDockerID(ctx, dockerID)
+	if err != nil || record == nil {
+		return nil, models.IncidentPolicy{}
+	}
+	policy, err := w.store.GetContainerIncidentPolicy(ctx, record.ID)
+	if err != nil {
+		log.Printf("🚨 Incidents: failed to load the incident policy of %s: %v", record.Name, err)
+	}
+	if policy == nil {
+		return record, models.IncidentPolicy{}
+	}
+	return record, *policy
+}
+
+// due reports whether an incident of this kind can be raised for the
+// terminal, and if so starts its cooldown
+func (w *IncidentWatcher) due(dockerID, kind string, cooldown time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := dockerID + "/" + kind
+	if time.Since(w.reportedAt[key]) < cooldown {
+		return false
+	}
+	w.reportedAt[key] = time.Now()
+	return true
+}
+
+// raise records an incident and its audit log entry and runs the hook
+func (w *IncidentWatcher) raise(ctx context.Context, incident *models.ContainerIncident, status string) {
+	log.Printf("🚨 Incidents: %s on %s: %s (action: %s)", incident.Kind, incident.DockerID[:min(12, len(incident.DockerID))], incident.Message, incident.Action)
+	if err := w.store.CreateContainerIncident(ctx, incident); err != nil {
+		log.Printf("🚨 Incidents: failed to record incident: %v", err)
+	}
+	details := fmt.Sprintf("%s on container %s: %s (action: %s)", incident.Kind, incident.ContainerID, incident.Message, incident.Action)
+	if incident.ActionError != "" {
+		details += ", " + incident.ActionError
+	}
+	if err := w.store.CreateAuditLog(ctx, &models.AuditLog{
+		ID:        uuid.New().String(),
+		UserID:    &incident.UserID,
+		Action:    "container_incident",
+		Details:   details,
+		CreatedAt: incident.CreatedAt,
+	}); err != nil {
+		log.Printf("🚨 Incidents: failed to write audit log: %v", err)
+	}
+	if w.onIncident != nil {
+		w.onIncident(incident, status)
+	}
+}
+
+func newIncident(record *storage.ContainerRecord, dockerID, kind, message string, details map[string]interface{}) *models.ContainerIncident {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	return &models.ContainerIncident{
+		ID:          uuid.New().String(),
+		ContainerID: record.ID,
+		DockerID:    dockerID,
+		UserID:      record.UserID,
+		Kind:        kind,
+		Message:     message,
+		Details:     details,
+		Action:      models.IncidentActionNone,
+		CreatedAt:   time.Now(),
+	}
+}
+
+func percent(used, limit int64) float64 {
+	return float64(used) / float64(limit) * 100
+}
+
+// formatMB formats a byte count in MB, or GB from 1 GB up
+func formatMB(bytes int64) string {
+	mb := bytes / 1024 / 1024
+	if mb >= 1024 && mb%1024 == 0 {
+		return fmt.Sprintf("%d GB", mb/1024)
+	}
+	return fmt.Sprintf("%d MB", mb)
+}
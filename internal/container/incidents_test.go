@@ -0,0 +1,209 @@
+package container
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+type fakeIncidentStore struct {
+	record    *storage.ContainerRecord
+	policy    *models.IncidentPolicy
+	user      *models.User
+	status    string
+	incidents []*models.ContainerIncident
+	audits    []*models.AuditLog
+}
+
+func (s *fakeIncidentStore) GetContainerByDockerID(ctx context.Context, dockerID string) (*storage.ContainerRecord, error) {
+	if s.record == nil || s.record.DockerID != dockerID {
+		return nil, nil
+	}
+	return s.record, nil
+}
+
+func (s *fakeIncidentStore) GetContainerIncidentPolicy(ctx context.Context, id string) (*models.IncidentPolicy, error) {
+	return s.policy, nil
+}
+
+func (s *fakeIncidentStore) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	return s.user, nil
+}
+
+func (s *fakeIncidentStore) UpdateContainerSettings(ctx context.Context, id, name string, memoryMB, cpuShares, diskMB int64) error {
+	s.record.MemoryMB = memoryMB
+	return nil
+}
+
+func (s *fakeIncidentStore) UpdateContainerStatus(ctx context.Context, id, status string) error {
+	s.status = status
+	return nil
+}
+
+func (s *fakeIncidentStore) CreateContainerIncident(ctx context.Context, incident *models.ContainerIncident) error {
+	s.incidents = append(s.incidents, incident)
+	return nil
+}
+
+func (s *fakeIncidentStore) CreateAuditLog(ctx context.Context, log *models.AuditLog) error {
+	s.audits = append(s.audits, log)
+	return nil
+}
+
+func newIncidentTest(policy *models.IncidentPolicy) (*IncidentWatcher, *fakeIncidentStore, *MockDockerClient) {
+	mockClient := &MockDockerClient{}
+	manager := newPauseTestManager(mockClient)
+	dockerID := "incident-container-0001"
+	manager.containers[dockerID] = &ContainerInfo{ID: dockerID, Status: "running"}
+	store := &fakeIncidentStore{
+		record: &storage.ContainerRecord{ID: "c1", UserID: "u1", Name: "dev", DockerID: dockerID, MemoryMB: 2048},
+		policy: policy,
+		user:   &models.User{ID: "u1", Tier: "pro", SubscriptionActive: true},
+	}
+	return NewIncidentWatcher(manager, store, nil, time.Minute), store, mockClient
+}
+
+func die(dockerID, exitCode string) events.Message {
+	return events.Message{Action: events.ActionDie, Actor: events.Actor{ID: dockerID, Attributes: map[string]string{"exitCode": exitCode}}}
+}
+
+func TestIncidentWatcher_Died(t *testing.T) {
+	ctx := context.Background()
+	dockerID := "incident-container-0001"
+
+	t.Run("Requested stop is ignored", func(t *testing.T) {
+		w, store, _ := newIncidentTest(nil)
+		w.handleEvent(ctx, events.Message{Action: events.ActionKill, Actor: events.Actor{ID: dockerID}})
+		w.handleEvent(ctx, die(dockerID, "137"))
+		if len(store.incidents) != 0 {
+			t.Errorf("incidents = %d, want none after a requested stop", len(store.incidents))
+		}
+	})
+
+	t.Run("Crash stops the terminal", func(t *testing.T) {
+		w, store, _ := newIncidentTest(nil)
+		var hookStatus string
+		w.SetIncidentHook(func(incident *models.ContainerIncident, status string) { hookStatus = status })
+
+		w.handleEvent(ctx, die(dockerID, "139"))
+		if len(store.incidents) != 1 || len(store.audits) != 1 {
+			t.Fatalf("got %d incidents and %d audit entries, want 1 of each", len(store.incidents), len(store.audits))
+		}
+		incident := store.incidents[0]
+		if incident.Kind != models.IncidentCrash || incident.Action != models.IncidentActionNone || incident.Details["exit_code"] != 139 {
+			t.Errorf("incident = %+v", incident)
+		}
+		if store.status != "stopped" || hookStatus != "stopped" || w.manager.containers[dockerID].Status != "stopped" {
+			t.Errorf("status = %q, hook %q, manager %q; want stopped", store.status, hookStatus, w.manager.containers[dockerID].Status)
+		}
+	})
+
+	t.Run("Docker's own restart is left alone", func(t *testing.T) {
+		w, store, mockClient := newIncidentTest(&models.IncidentPolicy{AutoRestart: true})
+		mockClient.ContainerInspectFunc = func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+				ID:           containerID,
+				RestartCount: 2,
+				State:        &types.ContainerState{Status: "restarting", Restarting: true},
+			}}, nil
+		}
+		starts := 0
+		mockClient.ContainerStartFunc = func(ctx context.Context, containerID string, options container.StartOptions) error {
+			starts++
+			return nil
+		}
+
+		w.handleEvent(ctx, die(dockerID, "1"))
+		if starts != 0 || store.status != "" || w.manager.containers[dockerID].Status != "running" {
+			t.Errorf("starts = %d, status %q, manager %q; want Docker's restart left alone", starts, store.status, w.manager.containers[dockerID].Status)
+		}
+		if len(store.incidents) != 1 || store.incidents[0].Action != models.IncidentActionRestarted || store.incidents[0].Details["restart_count"] != 2 {
+			t.Errorf("incidents = %+v, want one crash restarted by Docker", store.incidents)
+		}
+	})
+
+	t.Run("Auto-restart is limited", func(t *testing.T) {
+		w, store, mockClient := newIncidentTest(&models.IncidentPolicy{AutoRestart: true})
+		starts := 0
+		mockClient.ContainerStartFunc = func(ctx context.Context, containerID string, options container.StartOptions) error {
+			starts++
+			return nil
+		}
+
+		for i := 0; i <= maxIncidentRestarts; i++ {
+			w.handleEvent(ctx, die(dockerID, "1"))
+		}
+		if starts != maxIncidentRestarts {
+			t.Errorf("starts = %d, want %d", starts, maxIncidentRestarts)
+		}
+		last := store.incidents[len(store.incidents)-1]
+		if store.incidents[0].Action != models.IncidentActionRestarted || last.Action != models.IncidentActionNone || last.ActionError == "" {
+			t.Errorf("first action %q, last action %q (%q); want restarted, then none with a reason",
+				store.incidents[0].Action, last.Action, last.ActionError)
+		}
+		if store.status != "stopped" {
+			t.Errorf("status = %q, want stopped once restarts run out", store.status)
+		}
+	})
+}
+
+func TestIncidentWatcher_GrowMemory(t *testing.T) {
+	ctx := context.Background()
+	w, store, mockClient := newIncidentTest(&models.IncidentPolicy{AutoGrowMemory: true})
+	dockerID := store.record.DockerID
+	var updates []container.UpdateConfig
+	mockClient.ContainerUpdateFunc = func(ctx context.Context, containerID string, cfg container.UpdateConfig) (container.UpdateResponse, error) {
+		updates = append(updates, cfg)
+		return container.UpdateResponse{}, nil
+	}
+
+	w.oomKilled(ctx, dockerID)
+	if len(updates) != 1 || updates[0].Memory != 3072*1024*1024 || updates[0].CPUQuota != 0 {
+		t.Fatalf("updates = %+v, want memory raised to 3072 MB and CPU left alone", updates)
+	}
+	if store.record.MemoryMB != 3072 || store.incidents[0].Action != models.IncidentActionGrewMemory {
+		t.Errorf("memory = %d, action %q; want 3072 and grew_memory", store.record.MemoryMB, store.incidents[0].Action)
+	}
+
+	// The next OOM within the cooldown isn't reported
+	w.oomKilled(ctx, dockerID)
+	if len(store.incidents) != 1 {
+		t.Fatalf("incidents = %d, want 1 within the cooldown", len(store.incidents))
+	}
+
+	// Growth stops at the tier maximum
+	store.record.MemoryMB = 4096
+	incident := newIncident(store.record, dockerID, models.IncidentOOMKill, "", nil)
+	w.growMemory(ctx, store.record, dockerID, incident)
+	if incident.Action != models.IncidentActionNone || incident.ActionError == "" || len(updates) != 1 {
+		t.Errorf("at the maximum: action %q (%q), %d updates; want none with a reason", incident.Action, incident.ActionError, len(updates))
+	}
+}
+
+func TestIncidentWatcher_Observe(t *testing.T) {
+	w, store, _ := newIncidentTest(nil)
+	dockerID := store.record.DockerID
+	const mb = 1024 * 1024
+
+	w.Observe(dockerID, models.MetricSample{Memory: 1000 * mb, MemoryLimit: 2048 * mb, DiskUsage: 9900 * mb, DiskLimit: 10240 * mb})
+	if len(store.incidents) != 1 || store.incidents[0].Kind != models.IncidentDiskFull {
+		t.Fatalf("incidents = %+v, want one disk_full", store.incidents)
+	}
+
+	w.Observe(dockerID, models.MetricSample{Memory: 2000 * mb, MemoryLimit: 2048 * mb, DiskUsage: 9900 * mb, DiskLimit: 10240 * mb})
+	if len(store.incidents) != 2 || store.incidents[1].Kind != models.IncidentMemoryPressure {
+		t.Fatalf("incidents = %+v, want memory_pressure added and disk_full held back by its cooldown", store.incidents)
+	}
+
+	// Containers without a record, such as warm pool members, are skipped
+	w.Observe("pool-member", models.MetricSample{Memory: 2000 * mb, MemoryLimit: 2048 * mb})
+	if len(store.incidents) != 2 {
+		t.Errorf("incidents = %d, want no incident for an unknown container", len(store.incidents))
+	}
+}
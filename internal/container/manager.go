@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
 	"runtime"
 	"strconv"
@@ -20,14 +21,16 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/go-connections/nat"
+	"github.com/rexec/rexec/internal/models"
 )
 
 const IsolatedNetworkName = "rexec-isolated"
 
 // ProgressEvent represents a progress update during container creation
 type ProgressEvent struct {
-	Stage       string                 `json:"stage"`                  // "validating", "pulling", "creating", "starting", "ready"
+	Stage       string                 `json:"stage"`                  // "validating", "pulling", "building", "creating", "starting", "ready"
 	Message     string                 `json:"message"`                // Human-readable message
 	Progress    float64                `json:"progress"`               // 0-100 percentage
 	Detail      string                 `json:"detail"`                 // Additional detail (e.g., layer being pulled)
@@ -356,7 +359,7 @@ func GetImageName(imageType string) string {
 
 // ImageExists checks if a Docker image exists locally
 func ImageExists(imageName string) bool {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := newEngineClient()
 	if err != nil {
 		return false
 	}
@@ -369,9 +372,10 @@ func ImageExists(imageName string) bool {
 	return err == nil
 }
 
-// ValidateCustomImage validates that a custom Docker image exists and is pullable
-func ValidateCustomImage(ctx context.Context, imageName string) error {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+// ValidateCustomImage validates that a custom Docker image exists and is pullable.
+// registryAuth is the encoded credential for its registry, if any (see RegistryAuth).
+func ValidateCustomImage(ctx context.Context, imageName, registryAuth string) error {
+	cli, err := newEngineClient()
 	if err != nil {
 		return fmt.Errorf("failed to create docker client: %w", err)
 	}
@@ -384,7 +388,7 @@ func ValidateCustomImage(ctx context.Context, imageName string) error {
 	}
 
 	// Try to pull the image
-	reader, err := cli.ImagePull(ctx, imageName, image.PullOptions{})
+	reader, err := cli.ImagePull(ctx, imageName, image.PullOptions{RegistryAuth: registryAuth})
 	if err != nil {
 		return fmt.Errorf("image not found locally and failed to pull: %w", err)
 	}
@@ -530,6 +534,17 @@ type ContainerConfig struct {
 	CPULimit      int64             // CPU quota, default 100000 (1 CPU)
 	DiskQuota     int64             // in bytes
 	Labels        map[string]string // Custom labels for the container
+	// SnapshotArchive is a home volume archive (see CreateSnapshot) restored
+	// into /home/user once the container has started.
+	SnapshotArchive string
+	Env             []string             // Extra KEY=value env vars, e.g. from an environment template
+	VolumeName      string               // Home volume to mount (default: the container's name)
+	NetworkMB       int64                // Bandwidth limit in MB/s (0 = unlimited)
+	Egress          *models.EgressPolicy // Terminal's own egress policy, on top of its tier's
+	Volumes         []VolumeMount        // Shared volumes to mount besides the home volume
+	// ResourceClass the terminal was sized with, if any. It sets the pids
+	// limit and burst allowance; the sizes above must already match it.
+	ResourceClass *models.ResourceClass
 }
 
 // ContainerInfo holds information about a running container
@@ -543,18 +558,26 @@ type ContainerInfo struct {
 	LastUsedAt    time.Time
 	IPAddress     string
 	Labels        map[string]string
+	VolumeName    string // Volume mounted at /home/user
 }
 
 // Manager handles Docker container lifecycle
 type Manager struct {
-	client           client.CommonAPIClient
-	containers       map[string]*ContainerInfo // dockerID -> container info
-	userIndex        map[string][]string       // userID -> list of dockerIDs
-	mu               sync.RWMutex
-	volumePath       string // base path for user volumes
-	diskQuotaEnabled bool   // whether disk quota is available
-	diskQuotaChecked bool   // whether we've checked for disk quota support
-	diskQuotaCheckMu sync.Once
+	client         client.CommonAPIClient
+	containers     map[string]*ContainerInfo // dockerID -> container info
+	userIndex      map[string][]string       // userID -> list of dockerIDs
+	mu             sync.RWMutex
+	volumePath     string                       // base path for user volumes
+	runtime        *RuntimeInfo                 // nil if not detected; see assumedCapabilities
+	runtimeMu      sync.RWMutex                 // guards runtime, which the disk quota probe updates
+	quotaProbed    chan struct{}                // closed once the disk quota probe finishes
+	poolClaims     map[string]map[string]string // dockerID -> labels of claimed warm pool members
+	egress         EgressConfig
+	egressPolicies map[string]*models.EgressPolicy // dockerID -> terminal's own egress policy
+	networkLocks   map[string]*sync.Mutex          // dockerID -> held while its network policy is applied
+	lookupIP       func(ctx context.Context, host string) ([]net.IP, error)
+	registryAuth   *RegistryAuth // nil: custom images are pulled anonymously
+	nodes          *NodePool     // wraps client; nil in tests using a bare client
 
 	// Stats broadcasting
 	activeStatsStreams map[string]*StatsBroadcaster
@@ -581,12 +604,14 @@ type StatsBroadcaster struct {
 // Note: Rexec uses non-standard ports (2377/2378) instead of 2376 for security.
 //
 // Works with both Docker and Podman (Podman implements Docker's API).
-// Set CONTAINER_RUNTIME=podman to enable Podman-specific features.
+// With CONTAINER_RUNTIME=podman and no DOCKER_HOST, the rootless Podman
+// socket is used. OCI_RUNTIME picks a sandboxed runtime such as runsc or kata.
+// What the engine supports is detected up front; see RuntimeCapabilities.
 func NewManager(volumePaths ...string) (*Manager, error) {
-	dockerHost := os.Getenv("DOCKER_HOST")
+	dockerHost := engineHost()
 	containerRuntime := os.Getenv("CONTAINER_RUNTIME") // "docker" or "podman"
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := newEngineClient()
 	if err != nil {
 		if dockerHost != "" {
 			return nil, fmt.Errorf("failed to create docker client for remote host %s: %w", dockerHost, err)
@@ -608,27 +633,30 @@ func NewManager(volumePaths ...string) (*Manager, error) {
 		if dockerHost != "" {
 			// Provide helpful error message for remote Docker/Podman host issues
 			runtimeName := "Docker"
-			if containerRuntime == "podman" {
+			if containerRuntime == EnginePodman {
 				runtimeName = "Podman"
 			}
-			errMsg := fmt.Sprintf("failed to connect to remote %s daemon at %s", runtimeName, dockerHost)
+			errMsg := fmt.Sprintf("failed to connect to %s daemon at %s", runtimeName, dockerHost)
 			// Check for TLS ports (standard 2376 or our custom 2377/2378)
 			if strings.Contains(dockerHost, ":2376") || strings.Contains(dockerHost, ":2377") || strings.Contains(dockerHost, ":2378") {
 				errMsg += " (TLS enabled - check DOCKER_TLS_VERIFY and DOCKER_CERT_PATH)"
 			} else if strings.Contains(dockerHost, "ssh://") {
 				errMsg += " (SSH connection - check SSH_PRIVATE_KEY and host accessibility)"
+			} else if strings.Contains(dockerHost, "podman.sock") {
+				errMsg += " (start it with: systemctl --user enable --now podman.socket)"
 			}
 			return nil, fmt.Errorf("%s: %w", errMsg, err)
 		}
 		return nil, fmt.Errorf("failed to connect to container daemon: %w", err)
 	}
 
-	// Log runtime info
-	if containerRuntime == "podman" {
-		log.Printf("[Container] Using Podman runtime at %s", dockerHost)
-	} else if dockerHost != "" {
-		log.Printf("[Container] Using Docker runtime at %s", dockerHost)
+	rt, err := detectRuntime(ctx, cli, os.Getenv("OCI_RUNTIME"))
+	if err != nil {
+		cli.Close()
+		return nil, err
 	}
+	rt.Host = dockerHost
+	logRuntime(rt)
 
 	// Default volume path
 	volumePath := "/var/lib/rexec/volumes"
@@ -636,18 +664,20 @@ func NewManager(volumePaths ...string) (*Manager, error) {
 		volumePath = volumePaths[0]
 	}
 
+	nodes := newNodePool(cli)
 	mgr := &Manager{
-		client:             cli,
+		client:             nodes,
+		nodes:              nodes,
 		containers:         make(map[string]*ContainerInfo),
 		userIndex:          make(map[string][]string),
 		volumePath:         volumePath,
-		diskQuotaEnabled:   false,
-		diskQuotaChecked:   false,
+		runtime:            rt,
+		quotaProbed:        make(chan struct{}),
 		activeStatsStreams: make(map[string]*StatsBroadcaster),
 	}
 
 	// Check disk quota availability asynchronously
-	go mgr.checkDiskQuotaSupport()
+	go mgr.probeDiskQuota()
 
 	// Ensure isolated network exists
 	if err := mgr.ensureIsolatedNetwork(); err != nil {
@@ -659,10 +689,16 @@ func NewManager(volumePaths ...string) (*Manager, error) {
 
 // ensureIsolatedNetwork ensures the isolated network exists with ICC disabled
 func (m *Manager) ensureIsolatedNetwork() error {
+	return createIsolatedNetwork(m.client)
+}
+
+// createIsolatedNetwork creates the isolated network on an engine unless it
+// already exists
+func createIsolatedNetwork(cli client.CommonAPIClient) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := m.client.NetworkInspect(ctx, IsolatedNetworkName, network.InspectOptions{})
+	_, err := cli.NetworkInspect(ctx, IsolatedNetworkName, network.InspectOptions{})
 	if err == nil {
 		return nil // Network exists
 	}
@@ -672,7 +708,7 @@ func (m *Manager) ensureIsolatedNetwork() error {
 	}
 
 	// Create network with Inter-Container Communication (ICC) disabled
-	_, err = m.client.NetworkCreate(ctx, IsolatedNetworkName, network.CreateOptions{
+	_, err = cli.NetworkCreate(ctx, IsolatedNetworkName, network.CreateOptions{
 		Driver: "bridge",
 		Options: map[string]string{
 			"com.docker.network.bridge.enable_icc": "false",
@@ -686,85 +722,17 @@ func (m *Manager) ensureIsolatedNetwork() error {
 	return nil
 }
 
-// checkDiskQuotaSupport checks if disk quotas are available on the Docker host
-func (m *Manager) checkDiskQuotaSupport() {
-	m.diskQuotaCheckMu.Do(func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		// Try to get Docker info to check storage driver
-		info, err := m.client.Info(ctx)
-		if err != nil {
-			log.Printf("[DiskQuota] Failed to get Docker info: %v", err)
-			m.diskQuotaChecked = true
-			return
-		}
-
-		// Check if storage driver is overlay2 (required for disk quotas)
-		if info.Driver != "overlay2" {
-			log.Printf("[DiskQuota] Storage driver is %s (not overlay2) - disk quotas disabled", info.Driver)
-			m.diskQuotaChecked = true
-			return
-		}
-
-		// Check driver status for backing filesystem info
-		for _, status := range info.DriverStatus {
-			if len(status) >= 2 {
-				if status[0] == "Backing Filesystem" {
-					if status[1] != "xfs" && status[1] != "ext4" {
-						log.Printf("[DiskQuota] Backing filesystem is %s (needs xfs or ext4) - disk quotas disabled", status[1])
-						m.diskQuotaChecked = true
-						return
-					}
-				}
-			}
-		}
-
-		// Try creating a test container with storage-opt to verify quota support
-		// This is the most reliable way to check if quotas work
-		testContainerName := "rexec-quota-test-" + fmt.Sprintf("%d", time.Now().UnixNano())
-		testConfig := &container.Config{
-			Image: "alpine:latest",
-			Cmd:   []string{"true"},
-		}
-		testHostConfig := &container.HostConfig{
-			StorageOpt: map[string]string{
-				"size": "100M",
-			},
-			AutoRemove: true,
-		}
-
-		// Try to create a test container
-		resp, err := m.client.ContainerCreate(ctx, testConfig, testHostConfig, nil, nil, testContainerName)
-		if err != nil {
-			if strings.Contains(err.Error(), "storage-opt") || strings.Contains(err.Error(), "pquota") || strings.Contains(err.Error(), "quota") {
-				log.Printf("[DiskQuota] Disk quotas not available: %v", err)
-				m.diskQuotaChecked = true
-				return
-			}
-			// Other error - assume quotas might work
-			log.Printf("[DiskQuota] Test container creation failed (non-quota error): %v", err)
-		} else {
-			// Clean up test container
-			m.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
-			log.Printf("[DiskQuota] Disk quotas are available and working")
-			m.diskQuotaEnabled = true
-		}
-
-		m.diskQuotaChecked = true
-	})
-}
-
 // IsDiskQuotaEnabled returns whether disk quotas are available
 func (m *Manager) IsDiskQuotaEnabled() bool {
-	// Wait for quota check to complete (with timeout)
-	for i := 0; i < 50; i++ { // 5 seconds max
-		if m.diskQuotaChecked {
-			return m.diskQuotaEnabled
+	// Wait for the quota probe to complete (with timeout)
+	if m.quotaProbed != nil {
+		select {
+		case <-m.quotaProbed:
+		case <-time.After(5 * time.Second):
+			return false
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
-	return false
+	return m.Capabilities().DiskQuota
 }
 
 // PullImage pulls the specified image if not present
@@ -799,16 +767,27 @@ func (m *Manager) PullImage(ctx context.Context, imageType string) error {
 	return err
 }
 
-// PullCustomImage pulls a custom Docker image
-func (m *Manager) PullCustomImage(ctx context.Context, imageName string) error {
+// SetRegistryAuth lets custom image pulls use the requesting user's registry credentials
+func (m *Manager) SetRegistryAuth(auth *RegistryAuth) {
+	m.registryAuth = auth
+}
+
+// PullCustomImage pulls a custom Docker image for userID, with their
+// credentials for its registry if they have any. System pulls pass no user.
+func (m *Manager) PullCustomImage(ctx context.Context, userID, imageName string) error {
+	auth, err := m.registryAuth.EncodedAuth(ctx, userID, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to load registry credentials: %w", err)
+	}
+
 	// Check if image exists
-	_, _, err := m.client.ImageInspectWithRaw(ctx, imageName)
+	local, _, err := m.client.ImageInspectWithRaw(ctx, imageName)
 	if err == nil {
-		return nil // Image already exists
+		return m.verifyImageAccess(ctx, userID, imageName, auth, local.RepoDigests)
 	}
 
 	// Pull the image
-	reader, err := m.client.ImagePull(ctx, imageName, image.PullOptions{})
+	reader, err := m.client.ImagePull(ctx, imageName, image.PullOptions{RegistryAuth: auth})
 	if err != nil {
 		return fmt.Errorf("failed to pull custom image %s: %w", imageName, err)
 	}
@@ -833,16 +812,50 @@ func (m *Manager) PullImageWithProgress(ctx context.Context, imageType string, p
 		return fmt.Errorf("unsupported image type: %s", imageType)
 	}
 
-	return m.pullImageWithProgressInternal(ctx, imageName, progressCh)
+	return m.pullImageWithProgressInternal(ctx, imageName, image.PullOptions{}, progressCh)
 }
 
-// PullCustomImageWithProgress pulls a custom image with progress updates
-func (m *Manager) PullCustomImageWithProgress(ctx context.Context, imageName string, progressCh chan<- ProgressEvent) error {
-	return m.pullImageWithProgressInternal(ctx, imageName, progressCh)
+// PullCustomImageWithProgress pulls a custom image for userID with progress updates
+func (m *Manager) PullCustomImageWithProgress(ctx context.Context, userID, imageName string, progressCh chan<- ProgressEvent) error {
+	auth, err := m.registryAuth.EncodedAuth(ctx, userID, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to load registry credentials: %w", err)
+	}
+	if local, _, err := m.client.ImageInspectWithRaw(ctx, imageName); err == nil {
+		if err := m.verifyImageAccess(ctx, userID, imageName, auth, local.RepoDigests); err != nil {
+			return err
+		}
+	}
+	return m.pullImageWithProgressInternal(ctx, imageName, image.PullOptions{RegistryAuth: auth}, progressCh)
+}
+
+// verifyImageAccess checks with the registry that userID may pull a custom
+// image that's already cached locally. Images pulled with one user's
+// credentials stay on the host, and would otherwise be open to everyone.
+// repoDigests are the local image's; an image that has none was never pulled
+// from a registry, so there are no credentials to check it against.
+func (m *Manager) verifyImageAccess(ctx context.Context, userID, imageName, auth string, repoDigests []string) error {
+	if userID == "" || IsSnapshotImage(imageName) || IsBuildImage(imageName) {
+		return nil
+	}
+	_, err := m.client.DistributionInspect(ctx, imageName, auth)
+	if err == nil {
+		return nil
+	}
+	if errdefs.IsUnauthorized(err) || errdefs.IsForbidden(err) {
+		return fmt.Errorf("access to %s was denied by its registry; add credentials for %s", imageName, models.RegistryHost(imageName))
+	}
+	if len(repoDigests) == 0 {
+		// Built or loaded on this host and never pushed: the local copy is all there is
+		return nil
+	}
+	// The copy came from a registry, possibly with someone else's credentials
+	log.Printf("[Container] Could not verify access to %s: %v", imageName, err)
+	return fmt.Errorf("could not verify access to %s with %s; try again later", imageName, models.RegistryHost(imageName))
 }
 
 // pullImageWithProgressInternal handles the actual image pull with progress tracking
-func (m *Manager) pullImageWithProgressInternal(ctx context.Context, imageName string, progressCh chan<- ProgressEvent) error {
+func (m *Manager) pullImageWithProgressInternal(ctx context.Context, imageName string, opts image.PullOptions, progressCh chan<- ProgressEvent) error {
 	// Check if image exists
 	_, _, err := m.client.ImageInspectWithRaw(ctx, imageName)
 	if err == nil {
@@ -865,7 +878,7 @@ func (m *Manager) pullImageWithProgressInternal(ctx context.Context, imageName s
 	}
 
 	// Pull the image
-	reader, err := m.client.ImagePull(ctx, imageName, image.PullOptions{})
+	reader, err := m.client.ImagePull(ctx, imageName, opts)
 	if err != nil {
 		return fmt.Errorf("failed to pull image %s: %w", imageName, err)
 	}
@@ -969,6 +982,11 @@ func (m *Manager) CreateContainer(ctx context.Context, cfg ContainerConfig) (*Co
 	if cfg.ImageType == "custom" && cfg.CustomImage != "" {
 		imageName = cfg.CustomImage
 		imageType = "custom:" + cfg.CustomImage
+
+		// Snapshot and built images are local and belong to the user who made them
+		if err := m.checkImageOwner(ctx, cfg.UserID, imageName); err != nil {
+			return nil, err
+		}
 	} else {
 		var ok bool
 		imageName, ok = SupportedImages[cfg.ImageType]
@@ -996,6 +1014,9 @@ func (m *Manager) CreateContainer(ctx context.Context, cfg ContainerConfig) (*Co
 	containerName := fmt.Sprintf("rexec-%s-%s", cfg.UserID, cfg.ContainerName)
 	// Consistent volume name for data persistence
 	volumeName := containerName
+	if cfg.VolumeName != "" {
+		volumeName = cfg.VolumeName
+	}
 
 	// Get the appropriate shell for this image - use /bin/sh as it's universally available
 	shell := ImageShells[cfg.ImageType]
@@ -1041,12 +1062,13 @@ func (m *Manager) CreateContainer(ctx context.Context, cfg ContainerConfig) (*Co
 			"rexec.memory_limit":   fmt.Sprintf("%d", cfg.MemoryLimit),
 			"rexec.cpu_limit":      fmt.Sprintf("%d", cfg.CPULimit),
 			"rexec.disk_quota":     fmt.Sprintf("%d", cfg.DiskQuota),
-		}, cfg.Labels),
+		}, mergeLabels(mergeLabels(networkLabels(cfg.NetworkMB), resourceClassLabels(cfg.ResourceClass)), cfg.Labels)),
 		// Expose SSH port
 		ExposedPorts: nat.PortSet{
 			"22/tcp": struct{}{},
 		},
 	}
+	containerConfig.Env = append(containerConfig.Env, cfg.Env...)
 
 	// Special resource handling for macOS (requires more resources)
 	if cfg.ImageType == "macos" {
@@ -1075,36 +1097,28 @@ func (m *Manager) CreateContainer(ctx context.Context, cfg ContainerConfig) (*Co
 	cpuPeriod := int64(100000)                    // 100ms in microseconds
 	cpuQuota := (cfg.CPULimit * cpuPeriod) / 1000 // Convert millicores to quota
 
-	// Use default Docker runtime (runc)
-	// OCI runtime can be configured via OCI_RUNTIME env var
-	// Valid runtimes: "runc" (default), "kata", "kata-fc", "runsc" (gVisor), "runsc-kvm"
-	ociRuntime := os.Getenv("OCI_RUNTIME")
-	if ociRuntime == "" {
-		ociRuntime = "runc" // Default to runc for maximum compatibility
-	}
+	// OCI runtime can be configured via OCI_RUNTIME env var; empty uses the engine's default
+	// Valid runtimes: "runc", "crun", "kata", "kata-fc", "runsc" (gVisor), "runsc-kvm"
+	caps := m.Capabilities()
 
 	// Build storage options conditionally based on quota support
-	// NOTE: gVisor (runsc) does NOT support overlay2 storage quotas - use runc for disk limits
+	// NOTE: gVisor (runsc) and rootless engines don't support overlay quotas
 	storageOpts := make(map[string]string)
 	if m.IsDiskQuotaEnabled() && cfg.DiskQuota > 0 {
 		storageOpts["size"] = formatBytes(cfg.DiskQuota)
-		if strings.HasPrefix(ociRuntime, "runsc") {
-			log.Printf("[Container] WARNING: Disk quota (%s) ignored - gVisor doesn't support overlay2 quotas. Use runc for disk limits.", formatBytes(cfg.DiskQuota))
-		} else {
-			log.Printf("[Container] Disk quota enabled: %s", formatBytes(cfg.DiskQuota))
-		}
+		log.Printf("[Container] Disk quota enabled: %s", formatBytes(cfg.DiskQuota))
 	} else if cfg.DiskQuota > 0 {
 		log.Printf("[Container] Disk quota requested (%s) but quotas not available on host", formatBytes(cfg.DiskQuota))
 	}
 
 	hostConfig := &container.HostConfig{
-		Runtime: ociRuntime, // "runc" (default), "kata", "kata-fc", "runsc" (gVisor), "runsc-kvm"
+		Runtime: m.ociRuntime(),
 		Resources: container.Resources{
 			Memory:     cfg.MemoryLimit,
 			MemorySwap: cfg.MemoryLimit, // Set equal to Memory to disable swap and enforce hard limit
 			CPUPeriod:  cpuPeriod,
 			CPUQuota:   cpuQuota,
-			PidsLimit:  &[]int64{512}[0], // Limit number of processes (512 allows AI tools like opencode)
+			PidsLimit:  &[]int64{pidsLimit(cfg.ResourceClass)}[0], // Limit number of processes (512 allows AI tools like opencode)
 		},
 		// Storage options for disk quota (requires overlay2 on XFS with pquota mount option)
 		StorageOpt: storageOpts,
@@ -1178,12 +1192,16 @@ func (m *Manager) CreateContainer(ctx context.Context, cfg ContainerConfig) (*Co
 		// Port bindings (optional, for future use)
 		PortBindings: nat.PortMap{},
 	}
+	caps.limitResources(&hostConfig.Resources)
 
 	// Special handling for macOS (CUA Lumier / docker-osx style VM images)
 	// Check for "macos" or "osx" in image type (case-insensitive)
 	isMacOS := strings.Contains(strings.ToLower(cfg.ImageType), "macos") || strings.Contains(strings.ToLower(cfg.ImageType), "osx")
 
 	if isMacOS {
+		if !caps.Privileged {
+			return nil, fmt.Errorf("macOS terminals need a rootful, unsandboxed container runtime")
+		}
 		// Do NOT override Entrypoint - let the VM boot script run
 		// Do NOT use /home/user working dir - use default
 		log.Printf("[Container] Configuring macOS container (privileged, kvm, headless)")
@@ -1233,6 +1251,7 @@ func (m *Manager) CreateContainer(ctx context.Context, cfg ContainerConfig) (*Co
 				Target: "/home/user",
 			},
 		}
+		hostConfig.Mounts = append(hostConfig.Mounts, volumeMounts(cfg.Volumes)...)
 
 		// Remove /home/user from tmpfs since we use a volume mount
 		delete(hostConfig.Tmpfs, "/home/user")
@@ -1312,7 +1331,7 @@ exec tail -f /dev/null`, shell, shell)
 	if err == nil && len(existingContainers) > 0 {
 		for _, existing := range existingContainers {
 			// Check if this container belongs to the same user
-			ownerUserID := existing.Labels["rexec.user_id"]
+			ownerUserID := m.claimedLabels(existing.ID, existing.Labels)["rexec.user_id"]
 			if ownerUserID == "" || ownerUserID == cfg.UserID {
 				log.Printf("[Container] Removing stale container with same name: %s (%s) owned by user %s", containerName, existing.ID[:12], ownerUserID)
 				_ = m.client.ContainerStop(ctx, existing.ID, container.StopOptions{})
@@ -1345,6 +1364,21 @@ exec tail -f /dev/null`, shell, shell)
 		return nil, fmt.Errorf("failed to start container: %w", err)
 	}
 
+	// Restore snapshot volume contents before anyone can attach
+	if cfg.SnapshotArchive != "" {
+		if err := m.RestoreSnapshotArchive(ctx, resp.ID, cfg.SnapshotArchive); err != nil {
+			_ = m.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return nil, err
+		}
+	}
+
+	m.trackEgressPolicy(resp.ID, cfg.Egress)
+	if err := m.applyNetworkPolicy(ctx, resp.ID, containerConfig.Labels, false); err != nil {
+		_ = m.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+		m.trackEgressPolicy(resp.ID, nil)
+		return nil, err
+	}
+
 	// Get container details
 	inspect, err := m.client.ContainerInspect(ctx, resp.ID)
 	if err != nil {
@@ -1385,6 +1419,7 @@ exec tail -f /dev/null`, shell, shell)
 		LastUsedAt:    now,
 		IPAddress:     ipAddress,
 		Labels:        allLabels,
+		VolumeName:    volumeName,
 	}
 
 	m.mu.Lock()
@@ -1471,6 +1506,13 @@ func (m *Manager) StopContainer(ctx context.Context, dockerID string) error {
 		return fmt.Errorf("container not found: %s", dockerID)
 	}
 
+	// Frozen processes can't handle SIGTERM
+	if info.Status == "paused" {
+		if err := m.UnpauseContainer(ctx, dockerID); err != nil {
+			return err
+		}
+	}
+
 	timeout := 10 // seconds
 	if err := m.client.ContainerStop(ctx, dockerID, container.StopOptions{Timeout: &timeout}); err != nil {
 		return fmt.Errorf("failed to stop container: %w", err)
@@ -1506,8 +1548,22 @@ func (m *Manager) StartContainer(ctx context.Context, dockerID string) error {
 		return fmt.Errorf("container not found: %s", dockerID)
 	}
 
-	if err := m.client.ContainerStart(ctx, dockerID, container.StartOptions{}); err != nil {
-		return fmt.Errorf("failed to start container: %w", err)
+	if info.Status == "paused" {
+		return m.UnpauseContainer(ctx, dockerID)
+	}
+
+	// Containers checkpointed by the idle policy resume their processes
+	if !m.startFromCheckpoint(ctx, dockerID) {
+		if err := m.client.ContainerStart(ctx, dockerID, container.StartOptions{}); err != nil {
+			return fmt.Errorf("failed to start container: %w", err)
+		}
+	}
+
+	// A fresh network namespace has no rules; don't let it run unrestricted
+	if err := m.applyNetworkPolicy(ctx, dockerID, info.Labels, false); err != nil {
+		timeout := 10
+		_ = m.client.ContainerStop(ctx, dockerID, container.StopOptions{Timeout: &timeout})
+		return err
 	}
 
 	m.mu.Lock()
@@ -1534,9 +1590,23 @@ func (m *Manager) StartContainerByUserID(ctx context.Context, userID string) err
 // RestartContainer restarts a container by docker ID
 func (m *Manager) RestartContainer(ctx context.Context, dockerID string) error {
 	timeout := 10 // seconds
-	return m.client.ContainerRestart(ctx, dockerID, container.StopOptions{
+	if err := m.client.ContainerRestart(ctx, dockerID, container.StopOptions{
 		Timeout: &timeout,
-	})
+	}); err != nil {
+		return err
+	}
+
+	var labels map[string]string
+	m.mu.RLock()
+	if info, ok := m.containers[dockerID]; ok {
+		labels = info.Labels
+	}
+	m.mu.RUnlock()
+	if err := m.applyNetworkPolicy(ctx, dockerID, labels, false); err != nil {
+		_ = m.client.ContainerStop(ctx, dockerID, container.StopOptions{Timeout: &timeout})
+		return err
+	}
+	return nil
 }
 
 // RemoveContainer removes a container by docker ID
@@ -1560,6 +1630,9 @@ func (m *Manager) RemoveContainer(ctx context.Context, dockerID string) error {
 			}
 		}
 	}
+	delete(m.poolClaims, dockerID)
+	delete(m.egressPolicies, dockerID)
+	delete(m.networkLocks, dockerID)
 	m.mu.Unlock()
 
 	// Remove from Docker
@@ -1610,6 +1683,11 @@ func (m *Manager) TouchContainer(dockerID string) {
 	}
 }
 
+// NodePool returns the engines terminals are placed on
+func (m *Manager) NodePool() *NodePool {
+	return m.nodes
+}
+
 // GetClient returns the underlying Docker client (for advanced operations)
 func (m *Manager) GetClient() client.CommonAPIClient {
 	return m.client
@@ -1644,6 +1722,29 @@ func (m *Manager) RemoveFromTracking(dockerID string) {
 	}
 }
 
+// moveTracking rekeys a terminal recreated on another node under its new
+// container ID
+func (m *Manager) moveTracking(oldID, newID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if info, ok := m.containers[oldID]; ok {
+		delete(m.containers, oldID)
+		info.ID = newID
+		m.containers[newID] = info
+		for i, id := range m.userIndex[info.UserID] {
+			if id == oldID {
+				m.userIndex[info.UserID][i] = newID
+			}
+		}
+	}
+	if policy, ok := m.egressPolicies[oldID]; ok {
+		delete(m.egressPolicies, oldID)
+		m.egressPolicies[newID] = policy
+	}
+	delete(m.poolClaims, oldID)
+}
+
 // UpdateContainerStatus updates the status of a container in memory
 func (m *Manager) UpdateContainerStatus(dockerID string, status string) {
 	m.mu.Lock()
@@ -1657,6 +1758,7 @@ func (m *Manager) UpdateContainerStatus(dockerID string, status string) {
 // UpdateContainerResources updates a running container's resource limits via Docker API
 // Note: This does NOT work with gVisor runtime - use RecreateContainer instead for gVisor
 // Note: Disk quota cannot be changed on a running container
+// A zero memoryMB or cpuMillicores leaves that limit as it is
 func (m *Manager) UpdateContainerResources(ctx context.Context, dockerID string, memoryMB int64, cpuMillicores int64) error {
 	log.Printf("[UpdateContainerResources] Updating container %s: memory=%dMB, cpu=%d millicores", dockerID, memoryMB, cpuMillicores)
 
@@ -1686,6 +1788,17 @@ func (m *Manager) UpdateContainerResources(ctx context.Context, dockerID string,
 			CPUQuota:   cpuQuota,
 		},
 	}
+	if memoryMB <= 0 {
+		updateConfig.Memory, updateConfig.MemorySwap = 0, 0
+	}
+	if cpuMillicores <= 0 {
+		updateConfig.CPUPeriod, updateConfig.CPUQuota = 0, 0
+	}
+	caps := m.Capabilities()
+	if !caps.CPULimit && !caps.MemoryLimit {
+		return fmt.Errorf("the container runtime can't enforce resource limits")
+	}
+	caps.limitResources(&updateConfig.Resources)
 
 	_, err := m.client.ContainerUpdate(ctx, dockerID, updateConfig)
 	if err != nil {
@@ -1730,7 +1843,8 @@ func (m *Manager) GetIdleContainers(threshold time.Duration) []*ContainerInfo {
 	result := make([]*ContainerInfo, 0)
 
 	for _, info := range m.containers {
-		if info.Status != "running" {
+		// Paused containers reach this stage too, see CleanupService
+		if (info.Status != "running" && info.Status != "paused") || isUnclaimedPoolMember(info.Labels) {
 			continue
 		}
 		if now.Sub(info.LastUsedAt) <= threshold {
@@ -1777,14 +1891,20 @@ func (m *Manager) LoadExistingContainers(ctx context.Context) error {
 	m.userIndex = make(map[string][]string)
 
 	for _, c := range containers {
+		// Claimed warm pool members carry their owner's labels outside Docker
+		labels := c.Labels
+		if claimed, ok := m.poolClaims[c.ID]; ok {
+			labels = mergeLabels(c.Labels, claimed)
+		}
+
 		// Check if this is a rexec-managed container
-		if c.Labels["rexec.managed"] != "true" {
+		if labels["rexec.managed"] != "true" || isUnclaimedPoolMember(labels) {
 			continue
 		}
 
-		userID := c.Labels["rexec.user_id"]
-		containerName := c.Labels["rexec.container_name"]
-		imageType := c.Labels["rexec.image_type"]
+		userID := labels["rexec.user_id"]
+		containerName := labels["rexec.container_name"]
+		imageType := labels["rexec.image_type"]
 
 		if userID == "" || containerName == "" {
 			continue
@@ -1814,7 +1934,7 @@ func (m *Manager) LoadExistingContainers(ctx context.Context) error {
 			CreatedAt:     time.Unix(c.Created, 0),
 			LastUsedAt:    time.Now(),
 			IPAddress:     ipAddress,
-			Labels:        c.Labels,
+			Labels:        labels,
 		}
 
 		m.containers[c.ID] = info
@@ -1872,6 +1992,16 @@ type RecreateContainerConfig struct {
 	DiskMB        int64 // Disk quota in MB (0 = use tier default)
 	// Shell options
 	UseTmux *bool // Whether to use tmux for session persistence (nil = inherit from old container)
+	// SnapshotArchive restores a snapshot's home volume into the new container (optional)
+	SnapshotArchive string
+	// VolumeName is the container's existing home volume (default: named after the container)
+	VolumeName string
+	// Volumes are the shared volumes attached to the container
+	Volumes []VolumeMount
+	// Class is the container's resource class, which sets its network, pids
+	// and burst limits. Sizes still come from the fields above so that a class
+	// edited since creation doesn't resize the terminal behind its record.
+	Class *models.ResourceClass
 }
 
 // RecreateContainer recreates a container that was removed from Docker
@@ -1886,9 +2016,13 @@ func (m *Manager) RecreateContainer(ctx context.Context, cfg RecreateContainerCo
 		imageType = cfg.Image
 	}
 
-	// Remove old entry from manager's tracking if exists
+	// Remove old entry from manager's tracking if exists, keeping its network settings
 	m.mu.Lock()
-	if _, exists := m.containers[cfg.OldDockerID]; exists {
+	egress := m.egressPolicies[cfg.OldDockerID]
+	delete(m.egressPolicies, cfg.OldDockerID)
+	var networkMB int64
+	if old, exists := m.containers[cfg.OldDockerID]; exists {
+		networkMB, _ = strconv.ParseInt(old.Labels[NetworkMBLabel], 10, 64)
 		delete(m.containers, cfg.OldDockerID)
 		// Remove from user index
 		if dockerIDs, ok := m.userIndex[cfg.UserID]; ok {
@@ -1926,16 +2060,25 @@ func (m *Manager) RecreateContainer(ctx context.Context, cfg RecreateContainerCo
 
 	// Create new container using existing method
 	containerCfg := ContainerConfig{
-		UserID:        cfg.UserID,
-		ContainerName: cfg.ContainerName,
-		ImageType:     imageType,
-		CustomImage:   customImage,
-		Role:          cfg.Role,
-		Labels:        labels,
+		UserID:          cfg.UserID,
+		ContainerName:   cfg.ContainerName,
+		ImageType:       imageType,
+		CustomImage:     customImage,
+		Role:            cfg.Role,
+		Labels:          labels,
+		SnapshotArchive: cfg.SnapshotArchive,
+		VolumeName:      cfg.VolumeName,
+		NetworkMB:       networkMB,
+		Egress:          egress,
+		Volumes:         cfg.Volumes,
+		ResourceClass:   cfg.Class,
 	}
 
 	// Apply tier-based resource limits (CPULimit in millicores: 1000 = 1 CPU)
 	// Use custom limits if provided, otherwise use tier defaults
+	if cfg.Class != nil {
+		containerCfg.NetworkMB = cfg.Class.NetworkMB
+	}
 	if cfg.MemoryMB > 0 && cfg.CPUMillicores > 0 {
 		containerCfg.MemoryLimit = cfg.MemoryMB * 1024 * 1024
 		containerCfg.CPULimit = cfg.CPUMillicores
@@ -1963,6 +2106,121 @@ func (m *Manager) RecreateContainer(ctx context.Context, cfg RecreateContainerCo
 	return m.CreateContainer(ctx, containerCfg)
 }
 
+// ReplaceContainer recreates a container that still exists, keeping the old
+// one until its replacement is running. The old container is stopped and
+// renamed out of the way first; if the replacement can't be created, it gets
+// its name back and is restarted if it was running, so a failed replacement
+// leaves the user with the container they had.
+func (m *Manager) ReplaceContainer(ctx context.Context, cfg RecreateContainerConfig) (*ContainerInfo, error) {
+	oldID := cfg.OldDockerID
+	if oldID == "" {
+		return m.RecreateContainer(ctx, cfg)
+	}
+	inspect, err := m.client.ContainerInspect(ctx, oldID)
+	if client.IsErrNotFound(err) {
+		return m.RecreateContainer(ctx, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	name := strings.TrimPrefix(inspect.Name, "/")
+	wasRunning := inspect.State != nil && (inspect.State.Running || inspect.State.Paused)
+
+	// RecreateContainer drops the old container's tracking; keep it to put back
+	m.mu.RLock()
+	oldInfo := m.containers[oldID]
+	oldEgress := m.egressPolicies[oldID]
+	m.mu.RUnlock()
+
+	if wasRunning {
+		if err := m.StopContainer(ctx, oldID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Restoring a snapshot clears the home volume the two containers share,
+	// so keep a copy to put back if the replacement fails
+	var backupPath string
+	if cfg.SnapshotArchive != "" {
+		backupPath, _, err = m.archiveHomeVolume(ctx, oldID, fmt.Sprintf("replace-%s-%d", oldID[:min(12, len(oldID))], time.Now().UnixNano()))
+		if err != nil {
+			if wasRunning {
+				_ = m.StartContainer(ctx, oldID)
+			}
+			return nil, fmt.Errorf("failed to back up home volume: %w", err)
+		}
+	}
+
+	asideName := fmt.Sprintf("%s-replaced-%d", name, time.Now().Unix())
+	if err := m.client.ContainerRename(ctx, oldID, asideName); err != nil {
+		if backupPath != "" {
+			os.Remove(backupPath)
+		}
+		if wasRunning {
+			_ = m.StartContainer(ctx, oldID)
+		}
+		return nil, fmt.Errorf("failed to move container aside: %w", err)
+	}
+
+	info, err := m.RecreateContainer(ctx, cfg)
+	if err != nil {
+		if renameErr := m.client.ContainerRename(ctx, oldID, name); renameErr != nil {
+			log.Printf("[Container] Failed to rename %s back to %s: %v", oldID[:min(12, len(oldID))], name, renameErr)
+		}
+		if oldInfo != nil {
+			m.mu.Lock()
+			m.containers[oldID] = oldInfo
+			m.userIndex[oldInfo.UserID] = append(m.userIndex[oldInfo.UserID], oldID)
+			m.mu.Unlock()
+		}
+		m.trackEgressPolicy(oldID, oldEgress)
+		if wasRunning {
+			if startErr := m.StartContainer(ctx, oldID); startErr != nil {
+				log.Printf("[Container] Failed to restart %s after a failed replacement: %v", oldID[:min(12, len(oldID))], startErr)
+			}
+		}
+		if backupPath != "" {
+			m.restoreHomeBackup(ctx, oldID, backupPath, wasRunning)
+		}
+		return nil, err
+	}
+	if backupPath != "" {
+		os.Remove(backupPath)
+	}
+
+	if err := m.client.ContainerRemove(ctx, oldID, container.RemoveOptions{Force: true}); err != nil {
+		log.Printf("[Container] Failed to remove replaced container %s: %v", oldID[:min(12, len(oldID))], err)
+	}
+	m.mu.Lock()
+	delete(m.poolClaims, oldID)
+	m.mu.Unlock()
+	return info, nil
+}
+
+// restoreHomeBackup puts a home volume backup taken by ReplaceContainer back
+// through the old container, starting it for the copy if it was stopped. A
+// backup that can't be restored is kept and logged so it can be recovered.
+func (m *Manager) restoreHomeBackup(ctx context.Context, dockerID, backupPath string, running bool) {
+	shortID := dockerID[:min(12, len(dockerID))]
+	if !running {
+		if err := m.client.ContainerStart(ctx, dockerID, container.StartOptions{}); err != nil {
+			log.Printf("[Container] Failed to start %s to restore its home volume, backup kept at %s: %v", shortID, backupPath, err)
+			return
+		}
+		defer func() {
+			timeout := 10
+			if err := m.client.ContainerStop(ctx, dockerID, container.StopOptions{Timeout: &timeout}); err != nil {
+				log.Printf("[Container] Failed to stop %s after restoring its home volume: %v", shortID, err)
+			}
+		}()
+	}
+	if err := m.RestoreSnapshotArchive(ctx, dockerID, backupPath); err != nil {
+		log.Printf("[Container] Failed to restore the home volume of %s, backup kept at %s: %v", shortID, backupPath, err)
+		return
+	}
+	os.Remove(backupPath)
+}
+
 // ContainerResourceStats represents simplified container resource usage
 type ContainerResourceStats struct {
 	CPUPercent  float64 `json:"cpu_percent"`
@@ -1978,6 +2236,10 @@ type ContainerResourceStats struct {
 
 // StreamContainerStats streams container stats to the provided channel
 func (m *Manager) StreamContainerStats(ctx context.Context, containerID string, statsCh chan<- ContainerResourceStats) error {
+	if !m.Capabilities().Stats {
+		return fmt.Errorf("container stats are not available with this runtime")
+	}
+
 	// Get or create a broadcaster for this container
 	broadcaster := m.getOrCreateStatsBroadcaster(containerID)
 
@@ -2074,10 +2336,7 @@ func (sb *StatsBroadcaster) start() {
 		}
 	}
 
-	// 1. Get configured limits (same logic as before)
-	var configuredMemoryLimit int64
-	var configuredDiskLimit int64
-
+	// 1. Get configured limits
 	inspectInfo, err := sb.manager.client.ContainerInspect(ctx, sb.containerID)
 	if err != nil {
 		// Log error and remove self
@@ -2086,43 +2345,7 @@ func (sb *StatsBroadcaster) start() {
 		sb.manager.statsMu.Unlock()
 		return
 	}
-
-	if inspectInfo.HostConfig != nil {
-		if inspectInfo.HostConfig.Memory > 0 {
-			configuredMemoryLimit = inspectInfo.HostConfig.Memory
-		}
-		if sizeStr, ok := inspectInfo.HostConfig.StorageOpt["size"]; ok {
-			configuredDiskLimit = parseSizeString(sizeStr)
-		}
-	}
-
-	if inspectInfo.Config != nil && inspectInfo.Config.Labels != nil {
-		if configuredMemoryLimit == 0 {
-			if memLimitStr, ok := inspectInfo.Config.Labels["rexec.memory_limit"]; ok {
-				if memLimit, err := strconv.ParseInt(memLimitStr, 10, 64); err == nil && memLimit > 0 {
-					configuredMemoryLimit = memLimit
-				}
-			}
-		}
-		if configuredDiskLimit == 0 {
-			if diskLimitStr, ok := inspectInfo.Config.Labels["rexec.disk_quota"]; ok {
-				if diskLimit, err := strconv.ParseInt(diskLimitStr, 10, 64); err == nil && diskLimit > 0 {
-					configuredDiskLimit = diskLimit
-				}
-			}
-		}
-		if configuredMemoryLimit == 0 {
-			tier := inspectInfo.Config.Labels["rexec.tier"]
-			switch tier {
-			case "pro":
-				configuredMemoryLimit = 2048 * 1024 * 1024
-			case "enterprise":
-				configuredMemoryLimit = 4096 * 1024 * 1024
-			default:
-				configuredMemoryLimit = 512 * 1024 * 1024
-			}
-		}
-	}
+	configuredMemoryLimit, configuredDiskLimit := configuredLimits(inspectInfo)
 
 	// 2. Start Docker stats stream
 	stats, err := sb.manager.client.ContainerStats(ctx, sb.containerID, true)
@@ -2196,14 +2419,7 @@ func (sb *StatsBroadcaster) start() {
 			previousSystem = v.CPUStats.SystemUsage
 
 			// Calculate Memory usage
-			memUsage := float64(v.MemoryStats.Usage)
-			if v.MemoryStats.Stats != nil {
-				if cache, ok := v.MemoryStats.Stats["cache"]; ok {
-					memUsage -= float64(cache)
-				} else if inactiveFile, ok := v.MemoryStats.Stats["inactive_file"]; ok {
-					memUsage -= float64(inactiveFile)
-				}
-			}
+			memUsage := memoryUsage(v)
 
 			// Calculate Disk I/O
 			var diskRead, diskWrite float64
@@ -2225,12 +2441,7 @@ func (sb *StatsBroadcaster) start() {
 			}
 
 			// Memory limit logic
-			memLimit := float64(v.MemoryStats.Limit)
-			if configuredMemoryLimit > 0 && (memLimit == 0 || memLimit > float64(configuredMemoryLimit)*2) {
-				memLimit = float64(configuredMemoryLimit)
-			} else if configuredMemoryLimit == 0 && memLimit > 2*1024*1024*1024 {
-				memLimit = 512 * 1024 * 1024
-			}
+			memLimit := memoryLimit(v, configuredMemoryLimit)
 
 			broadcast(ContainerResourceStats{
 				CPUPercent:  cpuPercent,
@@ -2247,40 +2458,84 @@ func (sb *StatsBroadcaster) start() {
 	}
 }
 
-// getContainerDiskUsage calculates disk usage of /home/user inside the container
-func (m *Manager) getContainerDiskUsage(ctx context.Context, containerID string) float64 {
-	execConfig := container.ExecOptions{
-		Cmd:          []string{"du", "-sk", "/home/user"},
-		AttachStdout: true,
-		AttachStderr: false,
+// configuredLimits returns the memory and disk limits a container was
+// created with, from its host config or rexec labels, falling back to the
+// tier's default memory
+func configuredLimits(info container.InspectResponse) (memory, disk int64) {
+	if info.ContainerJSONBase != nil && info.HostConfig != nil {
+		if info.HostConfig.Memory > 0 {
+			memory = info.HostConfig.Memory
+		}
+		if sizeStr, ok := info.HostConfig.StorageOpt["size"]; ok {
+			disk = parseSizeString(sizeStr)
+		}
 	}
 
-	execResp, err := m.client.ContainerExecCreate(ctx, containerID, execConfig)
-	if err != nil {
-		return 0
+	if info.Config != nil && info.Config.Labels != nil {
+		if memory == 0 {
+			if memLimitStr, ok := info.Config.Labels["rexec.memory_limit"]; ok {
+				if memLimit, err := strconv.ParseInt(memLimitStr, 10, 64); err == nil && memLimit > 0 {
+					memory = memLimit
+				}
+			}
+		}
+		if disk == 0 {
+			if diskLimitStr, ok := info.Config.Labels["rexec.disk_quota"]; ok {
+				if diskLimit, err := strconv.ParseInt(diskLimitStr, 10, 64); err == nil && diskLimit > 0 {
+					disk = diskLimit
+				}
+			}
+		}
+		if memory == 0 {
+			tier := info.Config.Labels["rexec.tier"]
+			switch tier {
+			case "pro":
+				memory = 2048 * 1024 * 1024
+			case "enterprise":
+				memory = 4096 * 1024 * 1024
+			default:
+				memory = 512 * 1024 * 1024
+			}
+		}
 	}
+	return memory, disk
+}
 
-	attachResp, err := m.client.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
-	if err != nil {
-		return 0
+// memoryUsage is the container's memory use without the page cache
+func memoryUsage(v *container.StatsResponse) float64 {
+	memUsage := float64(v.MemoryStats.Usage)
+	if v.MemoryStats.Stats != nil {
+		if cache, ok := v.MemoryStats.Stats["cache"]; ok {
+			memUsage -= float64(cache)
+		} else if inactiveFile, ok := v.MemoryStats.Stats["inactive_file"]; ok {
+			memUsage -= float64(inactiveFile)
+		}
 	}
-	defer attachResp.Close()
+	return memUsage
+}
 
-	// Read output
-	var output strings.Builder
-	buf := make([]byte, 1024)
-	for {
-		n, err := attachResp.Reader.Read(buf)
-		if n > 0 {
-			output.Write(buf[:n])
-		}
-		if err != nil {
-			break
-		}
+// memoryLimit is the limit to report for a container: the configured one
+// when the runtime reports the host's memory instead
+func memoryLimit(v *container.StatsResponse, configured int64) float64 {
+	memLimit := float64(v.MemoryStats.Limit)
+	if configured > 0 && (memLimit == 0 || memLimit > float64(configured)*2) {
+		memLimit = float64(configured)
+	} else if configured == 0 && memLimit > 2*1024*1024*1024 {
+		memLimit = 512 * 1024 * 1024
+	}
+	return memLimit
+}
+
+// getContainerDiskUsage calculates disk usage of /home/user inside the container
+func (m *Manager) getContainerDiskUsage(ctx context.Context, containerID string) float64 {
+	// du exits non-zero on unreadable files but still prints the total
+	output, err := m.ExecOutput(ctx, containerID, []string{"du", "-sk", "/home/user"})
+	if err != nil && output == "" {
+		return 0
 	}
 
 	// Parse output "12345   /home/user"
-	fields := strings.Fields(output.String())
+	fields := strings.Fields(output)
 	if len(fields) > 0 {
 		if sizeKB, err := strconv.ParseFloat(fields[0], 64); err == nil {
 			return sizeKB * 1024 // Convert KB to Bytes
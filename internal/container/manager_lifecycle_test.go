@@ -283,3 +283,84 @@ func TestManager_StartContainer(t *testing.T) {
 		t.Fatalf("StartContainer failed: %v", err)
 	}
 }
+
+func TestManager_ReplaceContainer(t *testing.T) {
+	for _, createFails := range []bool{true, false} {
+		t.Run(fmt.Sprintf("create fails %v", createFails), func(t *testing.T) {
+			mockClient := &MockDockerClient{}
+			manager := &Manager{
+				client:     mockClient,
+				containers: map[string]*ContainerInfo{"old-id": {ID: "old-id", UserID: "user123", Status: "running"}},
+				userIndex:  map[string][]string{"user123": {"old-id"}},
+			}
+
+			var calls []string
+			mockClient.ImageInspectWithRawFunc = func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+				return types.ImageInspect{Config: &container.Config{Labels: map[string]string{"rexec.user_id": "user123"}}}, nil, nil
+			}
+			mockClient.ContainerInspectFunc = func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+				return types.ContainerJSON{
+					ContainerJSONBase: &types.ContainerJSONBase{
+						ID:    containerID,
+						Name:  "/rexec-user123-dev",
+						State: &types.ContainerState{Running: true},
+					},
+					NetworkSettings: &types.NetworkSettings{},
+				}, nil
+			}
+			mockClient.ContainerStopFunc = func(ctx context.Context, id string, options container.StopOptions) error {
+				calls = append(calls, "stop "+id)
+				return nil
+			}
+			mockClient.ContainerRenameFunc = func(ctx context.Context, id, newName string) error {
+				calls = append(calls, "rename "+id+" "+strings.SplitN(newName, "-replaced-", 2)[0])
+				return nil
+			}
+			mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+				if createFails {
+					return container.CreateResponse{}, fmt.Errorf("no space left on device")
+				}
+				return container.CreateResponse{ID: "new-id"}, nil
+			}
+			mockClient.ContainerStartFunc = func(ctx context.Context, id string, options container.StartOptions) error {
+				calls = append(calls, "start "+id)
+				return nil
+			}
+			mockClient.ContainerRemoveFunc = func(ctx context.Context, id string, options container.RemoveOptions) error {
+				calls = append(calls, "remove "+id)
+				return nil
+			}
+
+			info, err := manager.ReplaceContainer(context.Background(), RecreateContainerConfig{
+				UserID:        "user123",
+				ContainerName: "dev",
+				Image:         "custom:rexec-snapshots:snap-1",
+				OldDockerID:   "old-id",
+			})
+
+			if createFails {
+				if err == nil {
+					t.Fatal("ReplaceContainer() succeeded with a failing create")
+				}
+				want := []string{"stop old-id", "rename old-id rexec-user123-dev", "rename old-id rexec-user123-dev", "start old-id"}
+				if strings.Join(calls, ", ") != strings.Join(want, ", ") {
+					t.Errorf("calls = %q, want %q", calls, want)
+				}
+				if manager.containers["old-id"] == nil || len(manager.userIndex["user123"]) != 1 {
+					t.Error("old container is no longer tracked after the rollback")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ReplaceContainer() error = %v", err)
+			}
+			if info.ID != "new-id" || calls[len(calls)-1] != "remove old-id" {
+				t.Errorf("ReplaceContainer() = %s with calls %q, want new-id and the old container removed last", info.ID, calls)
+			}
+			if manager.containers["old-id"] != nil {
+				t.Error("replaced container is still tracked")
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// metricsConcurrency is how many terminals are sampled at once
+const metricsConcurrency = 8
+
+// metricsDiskInterval is how often a terminal's disk usage is measured;
+// du walks the whole home directory, so it isn't run on every sample
+const metricsDiskInterval = 5 * time.Minute
+
+// metricsRollupLookback is how many completed buckets each rollup
+// recomputes, so buckets missed while no instance led are filled in
+const metricsRollupLookback = 3
+
+// MetricsStore defines the storage interface needed by the metrics collector
+type MetricsStore interface {
+	RecordContainerMetrics(ctx context.Context, samples map[string]models.MetricSample) error
+	RollupMetrics(ctx context.Context, from, to models.MetricsTier, start, end time.Time) error
+	PruneMetrics(ctx context.Context, tier models.MetricsTier, now time.Time) (int64, error)
+}
+
+// metricsSource is what the collector remembers about a terminal between samples
+type metricsSource struct {
+	memoryLimit int64 // configured, in bytes
+	diskLimit   int64
+
+	cpuUsage  uint64 // cumulative CPU time in nanoseconds
+	netRx     uint64 // cumulative bytes
+	netTx     uint64
+	sampledAt time.Time
+
+	diskUsage  int64
+	measuredAt time.Time // when diskUsage was measured
+}
+
+// MetricsCollector samples the resource usage of running terminals into the
+// metrics store, rolls raw samples up into coarser tiers and prunes each tier
+// past its retention. CPU and network are averaged over the time since the
+// previous sample, so a terminal's first sample is only used as a baseline.
+type MetricsCollector struct {
+	manager  *Manager
+	store    MetricsStore
+	leader   LeaderElector
+	interval time.Duration
+	stopChan chan struct{}
+	onSample func(dockerID string, sample models.MetricSample)
+
+	sources  map[string]*metricsSource   // dockerID -> source
+	rolledUp map[time.Duration]time.Time // tier resolution -> end of its last rollup
+	prunedAt time.Time
+}
+
+// NewMetricsCollector creates a metrics collector. With a leader elector,
+// only the instance holding the lock samples, rolls up and prunes.
+func NewMetricsCollector(manager *Manager, store MetricsStore, leader LeaderElector, interval time.Duration) *MetricsCollector {
+	return &MetricsCollector{
+		manager:  manager,
+		store:    store,
+		leader:   leader,
+		interval: interval,
+		stopChan: make(chan struct{}),
+		sources:  make(map[string]*metricsSource),
+		rolledUp: make(map[time.Duration]time.Time),
+	}
+}
+
+// Start begins sampling terminals. It does nothing if the runtime can't
+// report stats.
+func (c *MetricsCollector) Start() {
+	if !c.manager.Capabilities().Stats {
+		log.Printf("📈 Metrics history disabled: the container runtime can't report stats")
+		return
+	}
+	go c.run()
+	log.Printf("📈 Metrics collector started (sample interval: %v)", c.interval)
+}
+
+// SetSampleHook sets a callback run for each recorded sample
+func (c *MetricsCollector) SetSampleHook(fn func(dockerID string, sample models.MetricSample)) {
+	c.onSample = fn
+}
+
+// Stop stops the metrics collector
+func (c *MetricsCollector) Stop() {
+	close(c.stopChan)
+}
+
+func (c *MetricsCollector) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.tick(time.Now())
+		case <-c.stopChan:
+			return
+		}
+	}
+}
+
+func (c *MetricsCollector) tick(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+	defer cancel()
+
+	if c.leader != nil && !c.leader.IsLeader(ctx) {
+		// The leader's baselines would be stale by the time this instance takes over
+		c.sources = make(map[string]*metricsSource)
+		c.rolledUp = make(map[time.Duration]time.Time)
+		return
+	}
+
+	samples := c.sample(ctx)
+	if len(samples) > 0 {
+		if err := c.store.RecordContainerMetrics(ctx, samples); err != nil {
+			log.Printf("📈 Metrics: failed to record %d samples: %v", len(samples), err)
+		}
+	}
+	if c.onSample != nil {
+		for dockerID, sample := range samples {
+			c.onSample(dockerID, sample)
+		}
+	}
+	c.rollup(ctx, now)
+	c.prune(ctx, now)
+}
+
+// sample reads the stats of every running terminal and returns a sample for
+// each one that has a baseline
+func (c *MetricsCollector) sample(ctx context.Context) map[string]models.MetricSample {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	samples := make(map[string]models.MetricSample)
+	sem := make(chan struct{}, metricsConcurrency)
+
+	seen := make(map[string]bool)
+	for _, info := range c.manager.ListContainers() {
+		if info.Status != "running" {
+			// Paused and stopped time would drag the next average down
+			continue
+		}
+		seen[info.ID] = true
+		src, ok := c.sources[info.ID]
+		if !ok {
+			inspect, err := c.manager.client.ContainerInspect(ctx, info.ID)
+			if err != nil {
+				continue
+			}
+			src = &metricsSource{}
+			src.memoryLimit, src.diskLimit = configuredLimits(inspect)
+			c.sources[info.ID] = src
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(dockerID string, src *metricsSource) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if sample, ok := c.sampleOne(ctx, dockerID, src); ok {
+				mu.Lock()
+				samples[dockerID] = sample
+				mu.Unlock()
+			}
+		}(info.ID, src)
+	}
+	wg.Wait()
+
+	for id := range c.sources {
+		if !seen[id] {
+			delete(c.sources, id)
+		}
+	}
+	return samples
+}
+
+// sampleOne reads a terminal's stats and updates its baseline. It returns
+// false if there was no usable baseline to average against.
+func (c *MetricsCollector) sampleOne(ctx context.Context, dockerID string, src *metricsSource) (models.MetricSample, bool) {
+	resp, err := c.manager.client.ContainerStatsOneShot(ctx, dockerID)
+	if err != nil {
+		return models.MetricSample{}, false
+	}
+	var stats container.StatsResponse
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if err != nil {
+		return models.MetricSample{}, false
+	}
+
+	now := time.Now()
+	var netRx, netTx uint64
+	for _, n := range stats.Networks {
+		netRx += n.RxBytes
+		netTx += n.TxBytes
+	}
+	cpuUsage := stats.CPUStats.CPUUsage.TotalUsage
+
+	if now.Sub(src.measuredAt) >= metricsDiskInterval {
+		if usage := c.manager.getContainerDiskUsage(ctx, dockerID); usage > 0 {
+			src.diskUsage = int64(usage)
+		}
+		src.measuredAt = now
+	}
+
+	prev := *src
+	src.cpuUsage, src.netRx, src.netTx, src.sampledAt = cpuUsage, netRx, netTx, now
+	elapsed := now.Sub(prev.sampledAt).Seconds()
+	if prev.sampledAt.IsZero() || elapsed <= 0 || cpuUsage < prev.cpuUsage || netRx < prev.netRx || netTx < prev.netTx {
+		// First sample, or the counters were reset by a restart
+		return models.MetricSample{}, false
+	}
+
+	rxRate := float64(netRx-prev.netRx) / elapsed
+	txRate := float64(netTx-prev.netTx) / elapsed
+	return models.MetricSample{
+		Time:        now,
+		CPUPercent:  float64(cpuUsage-prev.cpuUsage) / 1e9 / elapsed * 100,
+		Memory:      int64(memoryUsage(&stats)),
+		MemoryLimit: int64(memoryLimit(&stats, src.memoryLimit)),
+		DiskUsage:   src.diskUsage,
+		DiskLimit:   src.diskLimit,
+		NetRxRate:   &rxRate,
+		NetTxRate:   &txRate,
+	}, true
+}
+
+// rollup aggregates each tier into the next coarser one once a bucket of it
+// completes
+func (c *MetricsCollector) rollup(ctx context.Context, now time.Time) {
+	for i := 1; i < len(models.MetricsTiers); i++ {
+		from, to := models.MetricsTiers[i-1], models.MetricsTiers[i]
+		end := now.Truncate(to.Resolution)
+		if !end.After(c.rolledUp[to.Resolution]) {
+			continue
+		}
+		start := end.Add(-metricsRollupLookback * to.Resolution)
+		if err := c.store.RollupMetrics(ctx, from, to, start, end); err != nil {
+			log.Printf("📈 Metrics: failed to roll up into %v buckets: %v", to.Resolution, err)
+			return
+		}
+		c.rolledUp[to.Resolution] = end
+	}
+}
+
+// prune deletes metrics past their tier's retention, at most once an hour
+func (c *MetricsCollector) prune(ctx context.Context, now time.Time) {
+	if now.Sub(c.prunedAt) < time.Hour {
+		return
+	}
+	c.prunedAt = now
+	for _, tier := range models.MetricsTiers {
+		deleted, err := c.store.PruneMetrics(ctx, tier, now)
+		if err != nil {
+			log.Printf("📈 Metrics: failed to prune: %v", err)
+			return
+		}
+		if deleted > 0 {
+			log.Printf("📈 Metrics: pruned %d rows older than %v", deleted, tier.Retention)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// fakeMetricsStore records what the collector writes
+type fakeMetricsStore struct {
+	samples []map[string]models.MetricSample
+	rollups []string
+	pruned  int
+}
+
+func (s *fakeMetricsStore) RecordContainerMetrics(ctx context.Context, samples map[string]models.MetricSample) error {
+	s.samples = append(s.samples, samples)
+	return nil
+}
+
+func (s *fakeMetricsStore) RollupMetrics(ctx context.Context, from, to models.MetricsTier, start, end time.Time) error {
+	s.rollups = append(s.rollups, to.Resolution.String()+" "+start.Format("15:04")+"-"+end.Format("15:04"))
+	return nil
+}
+
+func (s *fakeMetricsStore) PruneMetrics(ctx context.Context, tier models.MetricsTier, now time.Time) (int64, error) {
+	s.pruned++
+	return 0, nil
+}
+
+func TestMetricsCollector_Sample(t *testing.T) {
+	const gib = 1024 * 1024 * 1024
+	var usage, rx uint64
+	mockClient := &MockDockerClient{
+		ContainerInspectFunc: func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+				HostConfig: &container.HostConfig{Resources: container.Resources{Memory: gib}},
+			}}, nil
+		},
+		ContainerStatsOneShotFunc: func(ctx context.Context, containerID string) (container.StatsResponseReader, error) {
+			var stats container.StatsResponse
+			stats.CPUStats.CPUUsage.TotalUsage = usage
+			stats.MemoryStats.Usage = 300 * 1024 * 1024
+			stats.MemoryStats.Stats = map[string]uint64{"inactive_file": 100 * 1024 * 1024}
+			stats.MemoryStats.Limit = 64 * gib // the host's memory
+			stats.Networks = map[string]container.NetworkStats{"eth0": {RxBytes: rx}}
+			body, _ := json.Marshal(stats)
+			return container.StatsResponseReader{Body: io.NopCloser(strings.NewReader(string(body)))}, nil
+		},
+		ContainerExecCreateFunc: func(ctx context.Context, id string, config container.ExecOptions) (types.IDResponse, error) {
+			return types.IDResponse{ID: "du"}, nil
+		},
+		ContainerExecAttachFunc: func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+			return execStream("2048\t/home/user\n"), nil
+		},
+	}
+	manager := newPauseTestManager(mockClient)
+	manager.containers = map[string]*ContainerInfo{
+		"busy":    {ID: "busy", Status: "running"},
+		"stopped": {ID: "stopped", Status: "stopped"},
+	}
+	store := &fakeMetricsStore{}
+	c := NewMetricsCollector(manager, store, nil, time.Minute)
+
+	c.tick(time.Now())
+	if len(store.samples) != 0 {
+		t.Fatalf("first tick recorded %v, want only baselines", store.samples)
+	}
+	if _, ok := c.sources["stopped"]; ok {
+		t.Error("stopped terminal was sampled")
+	}
+
+	// 30s later, having used 15 CPU-seconds and received 3 MB
+	c.sources["busy"].sampledAt = c.sources["busy"].sampledAt.Add(-30 * time.Second)
+	usage += 15e9
+	rx += 3e6
+	c.tick(time.Now())
+	if len(store.samples) != 1 {
+		t.Fatalf("second tick recorded %d batches, want 1", len(store.samples))
+	}
+	s, ok := store.samples[0]["busy"]
+	if !ok {
+		t.Fatalf("samples = %v, want one for busy", store.samples[0])
+	}
+	if math.Abs(s.CPUPercent-50) > 1 || math.Abs(*s.NetRxRate-1e5) > 2e3 || *s.NetTxRate != 0 {
+		t.Errorf("sample = %v%% CPU, %v B/s in, %v B/s out; want 50%%, 100000, 0", s.CPUPercent, *s.NetRxRate, *s.NetTxRate)
+	}
+	if s.Memory != 200*1024*1024 || s.MemoryLimit != gib || s.DiskUsage != 2048*1024 {
+		t.Errorf("sample = %d memory of %d, %d disk", s.Memory, s.MemoryLimit, s.DiskUsage)
+	}
+
+	// A restart resets the counters, which only sets a new baseline
+	usage = 0
+	c.tick(time.Now())
+	if len(store.samples) != 1 {
+		t.Errorf("tick after a counter reset recorded %v", store.samples[1:])
+	}
+
+	delete(manager.containers, "busy")
+	c.tick(time.Now())
+	if len(c.sources) != 0 {
+		t.Errorf("sources = %v, want the removed terminal forgotten", c.sources)
+	}
+}
+
+func TestMetricsCollector_Rollup(t *testing.T) {
+	store := &fakeMetricsStore{}
+	c := NewMetricsCollector(newPauseTestManager(&MockDockerClient{}), store, nil, time.Minute)
+	at := func(hhmm string) time.Time {
+		ts, _ := time.Parse("2006-01-02 15:04", "2026-03-10 "+hhmm)
+		return ts
+	}
+
+	c.tick(at("10:07"))
+	want := []string{"5m0s 09:50-10:05", "1h0m0s 07:00-10:00"}
+	if strings.Join(store.rollups, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("rollups at 10:07 = %v, want %v", store.rollups, want)
+	}
+
+	c.tick(at("10:08"))
+	c.tick(at("10:10"))
+	want = append(want, "5m0s 09:55-10:10")
+	if strings.Join(store.rollups, ", ") != strings.Join(want, ", ") {
+		t.Errorf("rollups by 10:10 = %v, want %v", store.rollups, want)
+	}
+	if store.pruned != len(models.MetricsTiers) {
+		t.Errorf("pruned %d times, want once per tier within the hour", store.pruned)
+	}
+}
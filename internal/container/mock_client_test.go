@@ -1,35 +1,64 @@
 package container
 
 import (
+	"bufio"
 	"context"
+	"fmt"
 	"io"
 	"net"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // MockDockerClient implements client.CommonAPIClient for testing
 type MockDockerClient struct {
 	client.CommonAPIClient
-	ContainerCreateFunc     func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error)
-	ContainerStartFunc      func(ctx context.Context, containerID string, options container.StartOptions) error
-	ContainerStopFunc       func(ctx context.Context, containerID string, options container.StopOptions) error
-	ContainerRemoveFunc     func(ctx context.Context, containerID string, options container.RemoveOptions) error
-	ContainerListFunc       func(ctx context.Context, options container.ListOptions) ([]types.Container, error)
-	ContainerInspectFunc    func(ctx context.Context, containerID string) (types.ContainerJSON, error)
-	ImagePullFunc           func(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error)
-	ImageInspectWithRawFunc func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
-	NetworkListFunc         func(ctx context.Context, options network.ListOptions) ([]network.Inspect, error)
-	NetworkCreateFunc       func(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error)
-	NetworkInspectFunc      func(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error)
-	ContainerExecCreateFunc func(ctx context.Context, container string, config container.ExecOptions) (types.IDResponse, error)
-	ContainerExecAttachFunc func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error)
-	ContainerStatsFunc      func(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error)
+	ContainerCreateFunc       func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error)
+	ContainerStartFunc        func(ctx context.Context, containerID string, options container.StartOptions) error
+	ContainerStopFunc         func(ctx context.Context, containerID string, options container.StopOptions) error
+	ContainerRemoveFunc       func(ctx context.Context, containerID string, options container.RemoveOptions) error
+	ContainerListFunc         func(ctx context.Context, options container.ListOptions) ([]types.Container, error)
+	ContainerInspectFunc      func(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ImagePullFunc             func(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error)
+	ImageInspectWithRawFunc   func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	ImageListFunc             func(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ImageBuildFunc            func(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
+	DistributionInspectFunc   func(ctx context.Context, imageRef, encodedRegistryAuth string) (registry.DistributionInspect, error)
+	NetworkListFunc           func(ctx context.Context, options network.ListOptions) ([]network.Inspect, error)
+	NetworkCreateFunc         func(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error)
+	NetworkInspectFunc        func(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error)
+	ContainerExecCreateFunc   func(ctx context.Context, container string, config container.ExecOptions) (types.IDResponse, error)
+	ContainerExecAttachFunc   func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error)
+	ContainerStatsFunc        func(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error)
+	ContainerStatsOneShotFunc func(ctx context.Context, containerID string) (container.StatsResponseReader, error)
+	ContainerExecInspectFunc  func(ctx context.Context, execID string) (container.ExecInspect, error)
+	ContainerCommitFunc       func(ctx context.Context, containerID string, options container.CommitOptions) (container.CommitResponse, error)
+	CopyFromContainerFunc     func(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error)
+	CopyToContainerFunc       func(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error
+	ImageRemoveFunc           func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error)
+	ContainerPauseFunc        func(ctx context.Context, containerID string) error
+	ContainerUnpauseFunc      func(ctx context.Context, containerID string) error
+	ContainerRenameFunc       func(ctx context.Context, containerID, newName string) error
+	ContainerUpdateFunc       func(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.UpdateResponse, error)
+	VolumeRemoveFunc          func(ctx context.Context, volumeID string, force bool) error
+	ContainerWaitFunc         func(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	InfoFunc                  func(ctx context.Context) (system.Info, error)
+	ServerVersionFunc         func(ctx context.Context) (types.Version, error)
+	VolumeCreateFunc          func(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
+	VolumeInspectFunc         func(ctx context.Context, volumeID string) (volume.Volume, error)
+	DiskUsageFunc             func(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error)
+	EventsFunc                func(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
 }
 
 func (m *MockDockerClient) ContainerExecCreate(ctx context.Context, container string, config container.ExecOptions) (types.IDResponse, error) {
@@ -45,9 +74,12 @@ func (m *MockDockerClient) ContainerExecAttach(ctx context.Context, execID strin
 	}
 
 	// Return a valid HijackedResponse with a dummy connection to avoid panic on Close()
-	client, _ := net.Pipe()
+	// The server end is closed so readers see EOF immediately
+	client, server := net.Pipe()
+	server.Close()
 	return types.HijackedResponse{
-		Conn: client,
+		Conn:   client,
+		Reader: bufio.NewReader(client),
 	}, nil
 }
 
@@ -58,6 +90,13 @@ func (m *MockDockerClient) ContainerStats(ctx context.Context, containerID strin
 	return container.StatsResponseReader{}, nil
 }
 
+func (m *MockDockerClient) ContainerStatsOneShot(ctx context.Context, containerID string) (container.StatsResponseReader, error) {
+	if m.ContainerStatsOneShotFunc != nil {
+		return m.ContainerStatsOneShotFunc(ctx, containerID)
+	}
+	return container.StatsResponseReader{Body: io.NopCloser(strings.NewReader("{}"))}, nil
+}
+
 func (m *MockDockerClient) ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
 	if m.ContainerListFunc != nil {
 		return m.ContainerListFunc(ctx, options)
@@ -109,7 +148,7 @@ func (m *MockDockerClient) ImagePull(ctx context.Context, ref string, options im
 	if m.ImagePullFunc != nil {
 		return m.ImagePullFunc(ctx, ref, options)
 	}
-	return nil, nil
+	return io.NopCloser(strings.NewReader("")), nil
 }
 
 func (m *MockDockerClient) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
@@ -119,6 +158,20 @@ func (m *MockDockerClient) ImageInspectWithRaw(ctx context.Context, imageID stri
 	return types.ImageInspect{}, []byte{}, nil
 }
 
+func (m *MockDockerClient) ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+	if m.ImageBuildFunc != nil {
+		return m.ImageBuildFunc(ctx, buildContext, options)
+	}
+	return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func (m *MockDockerClient) DistributionInspect(ctx context.Context, imageRef, encodedRegistryAuth string) (registry.DistributionInspect, error) {
+	if m.DistributionInspectFunc != nil {
+		return m.DistributionInspectFunc(ctx, imageRef, encodedRegistryAuth)
+	}
+	return registry.DistributionInspect{}, nil
+}
+
 func (m *MockDockerClient) NetworkInspect(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error) {
 	if m.NetworkInspectFunc != nil {
 		return m.NetworkInspectFunc(ctx, networkID, options)
@@ -140,6 +193,134 @@ func (m *MockDockerClient) NetworkCreate(ctx context.Context, name string, optio
 	return network.CreateResponse{ID: "test-network-id"}, nil
 }
 
+func (m *MockDockerClient) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	if m.ContainerExecInspectFunc != nil {
+		return m.ContainerExecInspectFunc(ctx, execID)
+	}
+	return container.ExecInspect{ExecID: execID}, nil
+}
+
+func (m *MockDockerClient) ContainerCommit(ctx context.Context, containerID string, options container.CommitOptions) (container.CommitResponse, error) {
+	if m.ContainerCommitFunc != nil {
+		return m.ContainerCommitFunc(ctx, containerID, options)
+	}
+	return container.CommitResponse{ID: "sha256:test-image"}, nil
+}
+
+func (m *MockDockerClient) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+	if m.CopyFromContainerFunc != nil {
+		return m.CopyFromContainerFunc(ctx, containerID, srcPath)
+	}
+	return io.NopCloser(strings.NewReader("")), container.PathStat{}, nil
+}
+
+func (m *MockDockerClient) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error {
+	if m.CopyToContainerFunc != nil {
+		return m.CopyToContainerFunc(ctx, containerID, dstPath, content, options)
+	}
+	return nil
+}
+
+func (m *MockDockerClient) ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error) {
+	if m.ImageListFunc != nil {
+		return m.ImageListFunc(ctx, options)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerClient) ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+	if m.ImageRemoveFunc != nil {
+		return m.ImageRemoveFunc(ctx, imageID, options)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerClient) ContainerPause(ctx context.Context, containerID string) error {
+	if m.ContainerPauseFunc != nil {
+		return m.ContainerPauseFunc(ctx, containerID)
+	}
+	return nil
+}
+
+func (m *MockDockerClient) ContainerUnpause(ctx context.Context, containerID string) error {
+	if m.ContainerUnpauseFunc != nil {
+		return m.ContainerUnpauseFunc(ctx, containerID)
+	}
+	return nil
+}
+
+func (m *MockDockerClient) ContainerRename(ctx context.Context, containerID, newName string) error {
+	if m.ContainerRenameFunc != nil {
+		return m.ContainerRenameFunc(ctx, containerID, newName)
+	}
+	return nil
+}
+
+func (m *MockDockerClient) ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.UpdateResponse, error) {
+	if m.ContainerUpdateFunc != nil {
+		return m.ContainerUpdateFunc(ctx, containerID, updateConfig)
+	}
+	return container.UpdateResponse{}, nil
+}
+
+func (m *MockDockerClient) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	if m.VolumeRemoveFunc != nil {
+		return m.VolumeRemoveFunc(ctx, volumeID, force)
+	}
+	return nil
+}
+
+func (m *MockDockerClient) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	if m.ContainerWaitFunc != nil {
+		return m.ContainerWaitFunc(ctx, containerID, condition)
+	}
+	statusCh := make(chan container.WaitResponse, 1)
+	statusCh <- container.WaitResponse{StatusCode: 0}
+	return statusCh, make(chan error)
+}
+
+func (m *MockDockerClient) Info(ctx context.Context) (system.Info, error) {
+	if m.InfoFunc != nil {
+		return m.InfoFunc(ctx)
+	}
+	return system.Info{Driver: "overlay2", DefaultRuntime: "runc", CPUCfsQuota: true, MemoryLimit: true, PidsLimit: true}, nil
+}
+
+func (m *MockDockerClient) ServerVersion(ctx context.Context) (types.Version, error) {
+	if m.ServerVersionFunc != nil {
+		return m.ServerVersionFunc(ctx)
+	}
+	return types.Version{}, nil
+}
+
+func (m *MockDockerClient) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	if m.VolumeCreateFunc != nil {
+		return m.VolumeCreateFunc(ctx, options)
+	}
+	return volume.Volume{Name: options.Name, Labels: options.Labels, Driver: "local"}, nil
+}
+
+func (m *MockDockerClient) VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error) {
+	if m.VolumeInspectFunc != nil {
+		return m.VolumeInspectFunc(ctx, volumeID)
+	}
+	return volume.Volume{}, errdefs.NotFound(fmt.Errorf("volume %s not found", volumeID))
+}
+
+func (m *MockDockerClient) DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+	if m.DiskUsageFunc != nil {
+		return m.DiskUsageFunc(ctx, options)
+	}
+	return types.DiskUsage{}, nil
+}
+
+func (m *MockDockerClient) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	if m.EventsFunc != nil {
+		return m.EventsFunc(ctx, options)
+	}
+	return make(chan events.Message), make(chan error)
+}
+
 func (m *MockDockerClient) Close() error {
 	return nil
 }
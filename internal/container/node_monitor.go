@@ -0,0 +1,267 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// drainTimeout bounds a drain pass, which copies every moved terminal's
+// home directory between nodes
+const drainTimeout = 30 * time.Minute
+
+// NodeStore defines the storage interface needed by the node monitor
+type NodeStore interface {
+	GetNodes(ctx context.Context) ([]*models.Node, error)
+	EnsureDefaultNode(ctx context.Context) error
+	GetContainerByDockerID(ctx context.Context, dockerID string) (*storage.ContainerRecord, error)
+	UpdateContainerDockerID(ctx context.Context, id, dockerID string) error
+	DeletePoolClaim(ctx context.Context, dockerID string) error
+}
+
+// NodeMonitor keeps the node pool in line with the registered nodes and
+// checks their health. The elected leader also drains nodes: each stopped
+// terminal on a draining node is recreated on another node with its
+// volumes copied over. Running terminals are moved once they stop.
+type NodeMonitor struct {
+	manager       *Manager
+	pool          *NodePool
+	store         NodeStore
+	leader        LeaderElector
+	checkInterval time.Duration
+	stopChan      chan struct{}
+	onMigrate     func(record *storage.ContainerRecord, oldDockerID, nodeID string)
+	draining      sync.Mutex // held while a drain pass runs
+}
+
+// NewNodeMonitor creates a node monitor for the manager's node pool
+func NewNodeMonitor(manager *Manager, store NodeStore, leader LeaderElector, checkInterval time.Duration) *NodeMonitor {
+	return &NodeMonitor{
+		manager:       manager,
+		pool:          manager.nodes,
+		store:         store,
+		leader:        leader,
+		checkInterval: checkInterval,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// SetMigrateHook sets a callback run after a terminal is moved to another
+// node. record already holds the new container ID.
+func (s *NodeMonitor) SetMigrateHook(fn func(record *storage.ContainerRecord, oldDockerID, nodeID string)) {
+	s.onMigrate = fn
+}
+
+// Load registers the default node and connects to every node. Call it
+// before loading existing containers so terminals on every node are found.
+func (s *NodeMonitor) Load(ctx context.Context) error {
+	if err := s.store.EnsureDefaultNode(ctx); err != nil {
+		return err
+	}
+	return s.Refresh(ctx)
+}
+
+// Refresh reloads the registered nodes and checks each one
+func (s *NodeMonitor) Refresh(ctx context.Context) error {
+	nodes, err := s.store.GetNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load nodes: %w", err)
+	}
+	s.pool.refresh(ctx, nodes)
+	return nil
+}
+
+// Start begins checking and draining nodes
+func (s *NodeMonitor) Start() {
+	go s.run()
+	log.Printf("🖥️  Node monitor started (check interval: %v)", s.checkInterval)
+}
+
+// Stop stops the node monitor
+func (s *NodeMonitor) Stop() {
+	close(s.stopChan)
+	log.Println("🖥️  Node monitor stopped")
+}
+
+func (s *NodeMonitor) run() {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.check()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// check refreshes the pool and, on the leader, drains nodes
+func (s *NodeMonitor) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.checkInterval)
+	defer cancel()
+
+	if err := s.Refresh(ctx); err != nil {
+		log.Printf("[Nodes] %v", err)
+		return
+	}
+	if s.leader != nil && !s.leader.IsLeader(ctx) {
+		return
+	}
+	for _, status := range s.pool.Nodes() {
+		if status.Status == models.NodeDraining && status.Health.Healthy && s.draining.TryLock() {
+			go func(nodeID string) {
+				defer s.draining.Unlock()
+				ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+				defer cancel()
+				s.Drain(ctx, nodeID)
+			}(status.ID)
+		}
+	}
+}
+
+// Drain moves the stopped terminals off a draining node, returning how many
+// were moved
+func (s *NodeMonitor) Drain(ctx context.Context, nodeID string) int {
+	s.pool.mu.RLock()
+	source := s.pool.nodes[nodeID]
+	s.pool.mu.RUnlock()
+	if source == nil {
+		return 0
+	}
+
+	list, err := source.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", "rexec.managed=true")),
+	})
+	if err != nil {
+		log.Printf("[Nodes] Failed to list containers on draining node %s: %v", nodeID, err)
+		return 0
+	}
+	moved := 0
+	for _, c := range list {
+		if c.Labels["rexec.helper"] != "" || isUnclaimedPoolMember(c.Labels) {
+			continue
+		}
+		if c.State != "exited" && c.State != "created" {
+			continue
+		}
+		if err := s.migrate(ctx, source, c.ID); err != nil {
+			log.Printf("[Nodes] Failed to move container %s off node %s: %v", shortID(c.ID), nodeID, err)
+			continue
+		}
+		moved++
+	}
+	return moved
+}
+
+// migrate recreates a stopped terminal on another node, copies its home
+// volume there and removes it from the source node
+func (s *NodeMonitor) migrate(ctx context.Context, source *poolNode, dockerID string) error {
+	inspect, err := source.client.ContainerInspect(ctx, dockerID)
+	if err != nil {
+		return err
+	}
+	if inspect.State != nil && (inspect.State.Running || inspect.State.Paused) {
+		return fmt.Errorf("container is running")
+	}
+	var volumes []container.MountPoint
+	for _, m := range inspect.Mounts {
+		if m.Type != mount.TypeVolume {
+			continue
+		}
+		if strings.HasPrefix(m.Name, SharedVolumeName("")) {
+			return fmt.Errorf("mounts shared volume %s", m.Name)
+		}
+		volumes = append(volumes, m)
+	}
+
+	config := inspect.Config
+	config.Labels = s.manager.claimedLabels(dockerID, config.Labels)
+	target, err := s.pool.place(ctx, placementFor(config, inspect.HostConfig, source.node.ID))
+	if err != nil {
+		return err
+	}
+	if err := s.pool.ensureImage(ctx, target, config.Image); err != nil {
+		return fmt.Errorf("failed to copy image to node %s: %w", target.node.ID, err)
+	}
+
+	name := strings.TrimPrefix(inspect.Name, "/")
+	created, err := target.client.ContainerCreate(ctx, config, inspect.HostConfig, nil, nil, name)
+	if err != nil {
+		return fmt.Errorf("failed to create container on node %s: %w", target.node.ID, err)
+	}
+	discard := func() {
+		target.client.ContainerRemove(ctx, created.ID, container.RemoveOptions{RemoveVolumes: true})
+		for _, m := range volumes {
+			target.client.VolumeRemove(ctx, m.Name, false)
+		}
+	}
+	for _, m := range volumes {
+		if err := copyVolume(ctx, source, dockerID, target, created.ID, m.Destination); err != nil {
+			discard()
+			return fmt.Errorf("failed to copy %s: %w", m.Destination, err)
+		}
+	}
+
+	if err := source.client.ContainerRemove(ctx, dockerID, container.RemoveOptions{}); err != nil {
+		discard()
+		return fmt.Errorf("failed to remove the original: %w", err)
+	}
+	for _, m := range volumes {
+		if err := source.client.VolumeRemove(ctx, m.Name, false); err != nil {
+			log.Printf("[Nodes] Failed to remove volume %s from node %s: %v", m.Name, source.node.ID, err)
+		}
+	}
+
+	claimed := s.manager.isPoolClaimed(dockerID)
+	s.pool.moved(dockerID, created.ID, target, name)
+	s.manager.moveTracking(dockerID, created.ID)
+	if claimed {
+		if err := s.store.DeletePoolClaim(ctx, dockerID); err != nil {
+			log.Printf("[Nodes] Failed to delete claim of %s: %v", shortID(dockerID), err)
+		}
+	}
+	log.Printf("[Nodes] Moved container %s from node %s to %s as %s", shortID(dockerID), source.node.ID, target.node.ID, shortID(created.ID))
+
+	record, err := s.store.GetContainerByDockerID(ctx, dockerID)
+	if err != nil || record == nil {
+		return err
+	}
+	if err := s.store.UpdateContainerDockerID(ctx, record.ID, created.ID); err != nil {
+		return err
+	}
+	record.DockerID = created.ID
+	if s.onMigrate != nil {
+		s.onMigrate(record, dockerID, target.node.ID)
+	}
+	return nil
+}
+
+// copyVolume copies a directory between containers on different nodes
+func copyVolume(ctx context.Context, source *poolNode, sourceID string, target *poolNode, targetID, dir string) error {
+	archive, _, err := source.client.CopyFromContainer(ctx, sourceID, dir)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	return target.client.CopyToContainer(ctx, targetID, path.Dir(dir), archive, container.CopyToContainerOptions{CopyUIDGID: true})
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,141 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// NodeSelectorLabel records the node selector of a terminal's resource class
+const NodeSelectorLabel = "rexec.node_selector"
+
+// imageLocalityBonus is added to the score of nodes that already have a
+// terminal's image, worth about half an empty node
+const imageLocalityBonus = 0.5
+
+// ErrNoNodeAvailable is returned when no node can take a new terminal
+var ErrNoNodeAvailable = errors.New("no node has room for this terminal")
+
+// placement is what a new terminal needs from its node
+type placement struct {
+	cpuMillicores int64
+	memoryMB      int64
+	image         string
+	selector      map[string]string
+	volumes       []string // named volumes to mount
+	exclude       string   // node to avoid, when moving a terminal off it
+}
+
+// placementFor reads a terminal's needs from its container configuration
+func placementFor(config *container.Config, hostConfig *container.HostConfig, exclude string) placement {
+	req := placement{image: config.Image, exclude: exclude}
+	req.cpuMillicores, _ = strconv.ParseInt(config.Labels["rexec.cpu_limit"], 10, 64)
+	memory, _ := strconv.ParseInt(config.Labels["rexec.memory_limit"], 10, 64)
+	req.memoryMB = memory / (1024 * 1024)
+	req.selector = models.ParseNodeSelector(config.Labels[NodeSelectorLabel])
+	if hostConfig != nil {
+		for _, m := range hostConfig.Mounts {
+			if m.Type == mount.TypeVolume && m.Source != "" {
+				req.volumes = append(req.volumes, m.Source)
+			}
+		}
+		for _, bind := range hostConfig.Binds {
+			if source, _, ok := strings.Cut(bind, ":"); ok && !strings.HasPrefix(source, "/") {
+				req.volumes = append(req.volumes, source)
+			}
+		}
+	}
+	return req
+}
+
+// place picks the node for a new terminal and reserves its resources there.
+// A terminal whose volumes already exist goes back to the node holding most
+// of them, whatever its status, so recreating a terminal never splits it
+// from its home directory. Otherwise only active, healthy nodes matching the
+// selector with room for the terminal are considered, and the one with the
+// most free memory and CPU wins, with a bonus for already having the image.
+func (p *NodePool) place(ctx context.Context, req placement) (*poolNode, error) {
+	if home := p.volumeHome(ctx, req); home != nil {
+		p.reserve(home, req)
+		return home, nil
+	}
+
+	type candidate struct {
+		node  *poolNode
+		score float64
+	}
+	p.mu.RLock()
+	var candidates []*candidate
+	for _, n := range p.sortedNodes() {
+		if n.node.ID == req.exclude || !n.node.Schedulable() || !n.health.Healthy || !n.node.Matches(req.selector) {
+			continue
+		}
+		freeCPU := n.cpuCapacity() - n.health.AllocatedCPUMillicores
+		freeMemory := n.memoryCapacity() - n.health.AllocatedMemoryMB
+		if (n.cpuCapacity() > 0 && freeCPU < req.cpuMillicores) || (n.memoryCapacity() > 0 && freeMemory < req.memoryMB) {
+			continue
+		}
+		c := &candidate{node: n}
+		if n.cpuCapacity() > 0 {
+			c.score += float64(freeCPU) / float64(n.cpuCapacity())
+		}
+		if n.memoryCapacity() > 0 {
+			c.score += float64(freeMemory) / float64(n.memoryCapacity())
+		}
+		candidates = append(candidates, c)
+	}
+	p.mu.RUnlock()
+	if len(candidates) == 0 {
+		return nil, ErrNoNodeAvailable
+	}
+
+	if req.image != "" {
+		for _, c := range candidates {
+			if _, _, err := c.node.client.ImageInspectWithRaw(ctx, req.image); err == nil {
+				c.score += imageLocalityBonus
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	chosen := candidates[0].node
+	p.reserve(chosen, req)
+	return chosen, nil
+}
+
+// volumeHome returns the healthy node holding most of a terminal's volumes,
+// or nil if none of them exist yet
+func (p *NodePool) volumeHome(ctx context.Context, req placement) *poolNode {
+	var home *poolNode
+	most := 0
+	for _, n := range p.healthyNodes() {
+		if n.node.ID == req.exclude {
+			continue
+		}
+		found := 0
+		for _, v := range req.volumes {
+			if _, err := n.client.VolumeInspect(ctx, v); err == nil {
+				found++
+			}
+		}
+		if found > most {
+			home, most = n, found
+		}
+	}
+	return home
+}
+
+// reserve counts a new terminal against its node until the next check
+func (p *NodePool) reserve(n *poolNode, req placement) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n.health.AllocatedCPUMillicores += req.cpuMillicores
+	n.health.AllocatedMemoryMB += req.memoryMB
+}
@@ -0,0 +1,855 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// maxTrackedExecs bounds how many exec IDs the pool remembers the node of;
+// older ones are found again by asking each node
+const maxTrackedExecs = 4096
+
+// nodeCheckTimeout bounds each node health check
+const nodeCheckTimeout = 10 * time.Second
+
+// NodeHealth is what the last check of a node found
+type NodeHealth struct {
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Engine is what the engine reports, used when the node sets no capacity
+	EngineCPUMillicores int64 `json:"engine_cpu_millicores"`
+	EngineMemoryMB      int64 `json:"engine_memory_mb"`
+	// Allocated is the sum of the limits of running terminals
+	AllocatedCPUMillicores int64 `json:"allocated_cpu_millicores"`
+	AllocatedMemoryMB      int64 `json:"allocated_memory_mb"`
+	Containers             int   `json:"containers"`
+	Running                int   `json:"running"`
+}
+
+// NodeStatus is a registered node with its health and effective capacity
+type NodeStatus struct {
+	models.Node
+	CapacityCPUMillicores int64      `json:"capacity_cpu_millicores"`
+	CapacityMemoryMB      int64      `json:"capacity_memory_mb"`
+	Health                NodeHealth `json:"health"`
+}
+
+// poolNode is a node and its engine connection
+type poolNode struct {
+	node         models.Node
+	client       client.CommonAPIClient
+	health       NodeHealth
+	networkReady bool // the isolated network exists on the node
+}
+
+func (n *poolNode) cpuCapacity() int64 {
+	if n.node.CPUMillicores > 0 {
+		return n.node.CPUMillicores
+	}
+	return n.health.EngineCPUMillicores
+}
+
+func (n *poolNode) memoryCapacity() int64 {
+	if n.node.MemoryMB > 0 {
+		return n.node.MemoryMB
+	}
+	return n.health.EngineMemoryMB
+}
+
+func (n *poolNode) status() NodeStatus {
+	return NodeStatus{
+		Node:                  n.node,
+		CapacityCPUMillicores: n.cpuCapacity(),
+		CapacityMemoryMB:      n.memoryCapacity(),
+		Health:                n.health,
+	}
+}
+
+type nodeContextKey struct{}
+
+// WithNode pins Docker calls made with ctx that don't target an existing
+// container, such as creates and pulls, to a node
+func WithNode(ctx context.Context, nodeID string) context.Context {
+	return context.WithValue(ctx, nodeContextKey{}, nodeID)
+}
+
+func nodeFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(nodeContextKey{}).(string)
+	return id
+}
+
+// NodePool spreads terminals over several Docker hosts while looking like a
+// single engine to the rest of the package. Calls on an existing container
+// or exec go to the node that owns it; new terminals are placed by free
+// resources, image and volume locality and their class's node selector.
+// Anything not overridden here goes to the default node.
+type NodePool struct {
+	client.CommonAPIClient // the default node
+
+	mu      sync.RWMutex
+	nodes   map[string]*poolNode
+	owners  map[string]*poolNode // container ID or name -> node
+	execs   map[string]*poolNode // exec ID -> node
+	changed chan struct{}        // closed when nodes join or leave
+	connect func(node *models.Node) (client.CommonAPIClient, error)
+
+	refreshMu sync.Mutex // one refresh at a time, so no node is connected twice
+}
+
+// newNodePool creates a pool holding only the default node
+func newNodePool(defaultClient client.CommonAPIClient) *NodePool {
+	p := &NodePool{
+		CommonAPIClient: defaultClient,
+		nodes:           make(map[string]*poolNode),
+		owners:          make(map[string]*poolNode),
+		execs:           make(map[string]*poolNode),
+		changed:         make(chan struct{}),
+		connect:         connectNode,
+	}
+	p.nodes[models.DefaultNodeID] = &poolNode{
+		node:   models.Node{ID: models.DefaultNodeID, Labels: map[string]string{}, Status: models.NodeActive},
+		client: defaultClient,
+		health: NodeHealth{Healthy: true},
+	}
+	return p
+}
+
+// connectNode opens a client for a registered node's engine
+func connectNode(node *models.Node) (client.CommonAPIClient, error) {
+	opts := []client.Opt{client.WithHost(node.Host), client.WithAPIVersionNegotiation()}
+	if node.CertPath != "" {
+		opts = append(opts, client.WithTLSClientConfig(
+			filepath.Join(node.CertPath, "ca.pem"),
+			filepath.Join(node.CertPath, "cert.pem"),
+			filepath.Join(node.CertPath, "key.pem"),
+		))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// Nodes returns every node with its health, default first
+func (p *NodePool) Nodes() []NodeStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	statuses := make([]NodeStatus, 0, len(p.nodes))
+	for _, n := range p.sortedNodes() {
+		statuses = append(statuses, n.status())
+	}
+	return statuses
+}
+
+// Node returns a node with its health, or false if it isn't connected
+func (p *NodePool) Node(id string) (NodeStatus, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	n, ok := p.nodes[id]
+	if !ok {
+		return NodeStatus{}, false
+	}
+	return n.status(), true
+}
+
+// NodeOf returns the ID of the node a container runs on
+func (p *NodePool) NodeOf(ctx context.Context, containerID string) string {
+	return p.ownerOf(ctx, containerID).node.ID
+}
+
+// sortedNodes lists the nodes default first, then by ID. Callers hold p.mu.
+func (p *NodePool) sortedNodes() []*poolNode {
+	nodes := make([]*poolNode, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if (nodes[i].node.ID == models.DefaultNodeID) != (nodes[j].node.ID == models.DefaultNodeID) {
+			return nodes[i].node.ID == models.DefaultNodeID
+		}
+		return nodes[i].node.ID < nodes[j].node.ID
+	})
+	return nodes
+}
+
+// healthyNodes lists the reachable nodes, default first
+func (p *NodePool) healthyNodes() []*poolNode {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var nodes []*poolNode
+	for _, n := range p.sortedNodes() {
+		if n.health.Healthy {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+func (p *NodePool) defaultNode() *poolNode {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.nodes[models.DefaultNodeID]
+}
+
+func (p *NodePool) single() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.nodes) == 1
+}
+
+// pinned returns the node ctx is pinned to, or the default node
+func (p *NodePool) pinned(ctx context.Context) *poolNode {
+	if id := nodeFromContext(ctx); id != "" {
+		p.mu.RLock()
+		n, ok := p.nodes[id]
+		p.mu.RUnlock()
+		if ok {
+			return n
+		}
+	}
+	return p.defaultNode()
+}
+
+func (p *NodePool) setOwner(n *poolNode, keys ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, key := range keys {
+		if key != "" {
+			p.owners[key] = n
+		}
+	}
+}
+
+func (p *NodePool) forget(containerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.owners, containerID)
+}
+
+// ownerOf returns the node a container is on. Containers not seen before are
+// looked for on every node; if none has it, the default node is returned so
+// the caller gets the engine's own not found error.
+func (p *NodePool) ownerOf(ctx context.Context, containerID string) *poolNode {
+	p.mu.RLock()
+	n, ok := p.owners[containerID]
+	p.mu.RUnlock()
+	if ok {
+		return n
+	}
+	if p.single() {
+		return p.defaultNode()
+	}
+	for _, n := range p.healthyNodes() {
+		inspect, err := n.client.ContainerInspect(ctx, containerID)
+		if err == nil {
+			p.setOwner(n, containerID, inspect.ID)
+			return n
+		}
+	}
+	return p.defaultNode()
+}
+
+func (p *NodePool) on(ctx context.Context, containerID string) client.CommonAPIClient {
+	return p.ownerOf(ctx, containerID).client
+}
+
+// execNode returns the node an exec was created on
+func (p *NodePool) execNode(ctx context.Context, execID string) client.CommonAPIClient {
+	p.mu.RLock()
+	n, ok := p.execs[execID]
+	p.mu.RUnlock()
+	if ok {
+		return n.client
+	}
+	if p.single() {
+		return p.CommonAPIClient
+	}
+	for _, n := range p.healthyNodes() {
+		if _, err := n.client.ContainerExecInspect(ctx, execID); err == nil {
+			p.trackExec(execID, n)
+			return n.client
+		}
+	}
+	return p.CommonAPIClient
+}
+
+func (p *NodePool) trackExec(execID string, n *poolNode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id := range p.execs {
+		if len(p.execs) < maxTrackedExecs {
+			break
+		}
+		delete(p.execs, id)
+	}
+	p.execs[execID] = n
+}
+
+// Container-scoped calls go to the container's node
+
+func (p *NodePool) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	return p.on(ctx, containerID).ContainerInspect(ctx, containerID)
+}
+
+func (p *NodePool) ContainerInspectWithRaw(ctx context.Context, containerID string, getSize bool) (container.InspectResponse, []byte, error) {
+	return p.on(ctx, containerID).ContainerInspectWithRaw(ctx, containerID, getSize)
+}
+
+func (p *NodePool) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	err := p.on(ctx, containerID).ContainerRemove(ctx, containerID, options)
+	if err == nil || client.IsErrNotFound(err) {
+		p.forget(containerID)
+	}
+	return err
+}
+
+func (p *NodePool) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+	return p.on(ctx, containerID).ContainerStart(ctx, containerID, options)
+}
+
+func (p *NodePool) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	return p.on(ctx, containerID).ContainerStop(ctx, containerID, options)
+}
+
+func (p *NodePool) ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error {
+	return p.on(ctx, containerID).ContainerRestart(ctx, containerID, options)
+}
+
+func (p *NodePool) ContainerKill(ctx context.Context, containerID, signal string) error {
+	return p.on(ctx, containerID).ContainerKill(ctx, containerID, signal)
+}
+
+func (p *NodePool) ContainerPause(ctx context.Context, containerID string) error {
+	return p.on(ctx, containerID).ContainerPause(ctx, containerID)
+}
+
+func (p *NodePool) ContainerUnpause(ctx context.Context, containerID string) error {
+	return p.on(ctx, containerID).ContainerUnpause(ctx, containerID)
+}
+
+func (p *NodePool) ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.UpdateResponse, error) {
+	return p.on(ctx, containerID).ContainerUpdate(ctx, containerID, updateConfig)
+}
+
+func (p *NodePool) ContainerRename(ctx context.Context, containerID, newContainerName string) error {
+	return p.on(ctx, containerID).ContainerRename(ctx, containerID, newContainerName)
+}
+
+func (p *NodePool) ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error) {
+	return p.on(ctx, containerID).ContainerStats(ctx, containerID, stream)
+}
+
+func (p *NodePool) ContainerStatsOneShot(ctx context.Context, containerID string) (container.StatsResponseReader, error) {
+	return p.on(ctx, containerID).ContainerStatsOneShot(ctx, containerID)
+}
+
+func (p *NodePool) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	return p.on(ctx, containerID).ContainerWait(ctx, containerID, condition)
+}
+
+func (p *NodePool) ContainerTop(ctx context.Context, containerID string, arguments []string) (container.TopResponse, error) {
+	return p.on(ctx, containerID).ContainerTop(ctx, containerID, arguments)
+}
+
+func (p *NodePool) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error) {
+	return p.on(ctx, containerID).ContainerLogs(ctx, containerID, options)
+}
+
+func (p *NodePool) ContainerAttach(ctx context.Context, containerID string, options container.AttachOptions) (types.HijackedResponse, error) {
+	return p.on(ctx, containerID).ContainerAttach(ctx, containerID, options)
+}
+
+func (p *NodePool) ContainerResize(ctx context.Context, containerID string, options container.ResizeOptions) error {
+	return p.on(ctx, containerID).ContainerResize(ctx, containerID, options)
+}
+
+// ContainerCommit images a container on its own node; the image is copied
+// to other nodes when a terminal there needs it
+func (p *NodePool) ContainerCommit(ctx context.Context, containerID string, options container.CommitOptions) (container.CommitResponse, error) {
+	return p.on(ctx, containerID).ContainerCommit(ctx, containerID, options)
+}
+
+func (p *NodePool) ContainerStatPath(ctx context.Context, containerID, path string) (container.PathStat, error) {
+	return p.on(ctx, containerID).ContainerStatPath(ctx, containerID, path)
+}
+
+func (p *NodePool) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+	return p.on(ctx, containerID).CopyFromContainer(ctx, containerID, srcPath)
+}
+
+func (p *NodePool) CopyToContainer(ctx context.Context, containerID, path string, content io.Reader, options container.CopyToContainerOptions) error {
+	return p.on(ctx, containerID).CopyToContainer(ctx, containerID, path, content, options)
+}
+
+func (p *NodePool) ContainerExecCreate(ctx context.Context, containerID string, options container.ExecOptions) (container.ExecCreateResponse, error) {
+	n := p.ownerOf(ctx, containerID)
+	resp, err := n.client.ContainerExecCreate(ctx, containerID, options)
+	if err == nil && !p.single() {
+		p.trackExec(resp.ID, n)
+	}
+	return resp, err
+}
+
+// Exec-scoped calls go to the node the exec was created on
+
+func (p *NodePool) ContainerExecAttach(ctx context.Context, execID string, options container.ExecAttachOptions) (types.HijackedResponse, error) {
+	return p.execNode(ctx, execID).ContainerExecAttach(ctx, execID, options)
+}
+
+func (p *NodePool) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	return p.execNode(ctx, execID).ContainerExecInspect(ctx, execID)
+}
+
+func (p *NodePool) ContainerExecResize(ctx context.Context, execID string, options container.ResizeOptions) error {
+	return p.execNode(ctx, execID).ContainerExecResize(ctx, execID, options)
+}
+
+func (p *NodePool) ContainerExecStart(ctx context.Context, execID string, config container.ExecStartOptions) error {
+	return p.execNode(ctx, execID).ContainerExecStart(ctx, execID, config)
+}
+
+// ContainerCreate places the container on a node. Terminals are scheduled;
+// network helpers join their terminal's node and other containers, such as
+// runtime probes, go to the pinned or default node.
+func (p *NodePool) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	var n *poolNode
+	switch {
+	case nodeFromContext(ctx) != "" || p.single():
+		n = p.pinned(ctx)
+	case hostConfig != nil && hostConfig.NetworkMode.IsContainer():
+		n = p.ownerOf(ctx, hostConfig.NetworkMode.ConnectedContainer())
+	case config == nil || config.Labels["rexec.managed"] != "true":
+		n = p.defaultNode()
+	default:
+		var err error
+		if n, err = p.place(ctx, placementFor(config, hostConfig, "")); err != nil {
+			return container.CreateResponse{}, err
+		}
+	}
+
+	if config != nil && config.Image != "" && !p.single() {
+		if err := p.ensureImage(ctx, n, config.Image); err != nil {
+			log.Printf("[Nodes] Failed to copy image %s to node %s: %v", config.Image, n.node.ID, err)
+		}
+	}
+	resp, err := n.client.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
+	if err != nil {
+		return resp, err
+	}
+	if !p.single() {
+		p.setOwner(n, resp.ID, containerName)
+	}
+	return resp, nil
+}
+
+// ContainerList lists the containers of every reachable node
+func (p *NodePool) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	var all []container.Summary
+	for _, n := range p.healthyNodes() {
+		list, err := n.client.ContainerList(ctx, options)
+		if err != nil {
+			if n.node.ID == models.DefaultNodeID {
+				return nil, err
+			}
+			log.Printf("[Nodes] Failed to list containers on node %s: %v", n.node.ID, err)
+			continue
+		}
+		if !p.single() {
+			for _, c := range list {
+				p.setOwner(n, c.ID)
+			}
+		}
+		all = append(all, list...)
+	}
+	return all, nil
+}
+
+// Events merges the event streams of every reachable node. The merged
+// stream ends with an error when a node's stream does, or when nodes join
+// or leave, so that subscribers resubscribe to the new set.
+func (p *NodePool) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	p.mu.RLock()
+	changed := p.changed
+	p.mu.RUnlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	msgs := make(chan events.Message)
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+		cancel()
+	}
+	for _, n := range p.healthyNodes() {
+		n := n
+		nodeMsgs, nodeErrs := n.client.Events(ctx, options)
+		go func() {
+			for {
+				select {
+				case msg := <-nodeMsgs:
+					if msg.Type == events.ContainerEventType && !p.single() {
+						if msg.Action == events.ActionDestroy {
+							p.forget(msg.Actor.ID)
+						} else {
+							p.setOwner(n, msg.Actor.ID)
+						}
+					}
+					select {
+					case msgs <- msg:
+					case <-ctx.Done():
+						return
+					}
+				case err := <-nodeErrs:
+					fail(err)
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		select {
+		case <-changed:
+			fail(errNodesChanged)
+		case <-ctx.Done():
+		}
+	}()
+	return msgs, errs
+}
+
+// Images and volumes
+
+// ImagePull pulls onto the pinned or default node; other nodes get the
+// image copied when a terminal placed there needs it
+func (p *NodePool) ImagePull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+	return p.pinned(ctx).client.ImagePull(ctx, ref, options)
+}
+
+// ImageInspectWithRaw inspects the image on the pinned node, or else on the
+// first node that has it
+func (p *NodePool) ImageInspectWithRaw(ctx context.Context, imageID string) (image.InspectResponse, []byte, error) {
+	if nodeFromContext(ctx) != "" || p.single() {
+		return p.pinned(ctx).client.ImageInspectWithRaw(ctx, imageID)
+	}
+	var firstErr error
+	for _, n := range p.healthyNodes() {
+		inspect, raw, err := n.client.ImageInspectWithRaw(ctx, imageID)
+		if err == nil {
+			return inspect, raw, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		return p.CommonAPIClient.ImageInspectWithRaw(ctx, imageID)
+	}
+	return image.InspectResponse{}, nil, firstErr
+}
+
+// ImageRemove removes the image from every node that has it
+func (p *NodePool) ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+	if p.single() {
+		return p.CommonAPIClient.ImageRemove(ctx, imageID, options)
+	}
+	var deleted []image.DeleteResponse
+	var notFound error
+	removed := false
+	for _, n := range p.healthyNodes() {
+		resp, err := n.client.ImageRemove(ctx, imageID, options)
+		switch {
+		case err == nil:
+			deleted = append(deleted, resp...)
+			removed = true
+		case client.IsErrNotFound(err):
+			notFound = err
+		default:
+			return deleted, err
+		}
+	}
+	if !removed && notFound != nil {
+		return nil, notFound
+	}
+	return deleted, nil
+}
+
+// VolumeCreate creates the volume on the pinned or default node
+func (p *NodePool) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	return p.pinned(ctx).client.VolumeCreate(ctx, options)
+}
+
+// VolumeInspect inspects the volume on the first node that has it
+func (p *NodePool) VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error) {
+	n := p.volumeNode(ctx, volumeID)
+	return n.client.VolumeInspect(ctx, volumeID)
+}
+
+// VolumeRemove removes the volume from every node that has it
+func (p *NodePool) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	if p.single() {
+		return p.CommonAPIClient.VolumeRemove(ctx, volumeID, force)
+	}
+	var notFound error
+	removed := false
+	for _, n := range p.healthyNodes() {
+		err := n.client.VolumeRemove(ctx, volumeID, force)
+		switch {
+		case err == nil:
+			removed = true
+		case client.IsErrNotFound(err):
+			notFound = err
+		default:
+			return err
+		}
+	}
+	if !removed && notFound != nil {
+		return notFound
+	}
+	return nil
+}
+
+// volumeNode returns the first node that has a volume, or the default node
+func (p *NodePool) volumeNode(ctx context.Context, volumeID string) *poolNode {
+	if !p.single() {
+		for _, n := range p.healthyNodes() {
+			if _, err := n.client.VolumeInspect(ctx, volumeID); err == nil {
+				return n
+			}
+		}
+	}
+	return p.defaultNode()
+}
+
+// DiskUsage adds up the disk usage of every reachable node
+func (p *NodePool) DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+	if p.single() {
+		return p.CommonAPIClient.DiskUsage(ctx, options)
+	}
+	var total types.DiskUsage
+	for _, n := range p.healthyNodes() {
+		du, err := n.client.DiskUsage(ctx, options)
+		if err != nil {
+			if n.node.ID == models.DefaultNodeID {
+				return types.DiskUsage{}, err
+			}
+			log.Printf("[Nodes] Failed to get disk usage of node %s: %v", n.node.ID, err)
+			continue
+		}
+		total.LayersSize += du.LayersSize
+		total.Images = append(total.Images, du.Images...)
+		total.Containers = append(total.Containers, du.Containers...)
+		total.Volumes = append(total.Volumes, du.Volumes...)
+		total.BuildCache = append(total.BuildCache, du.BuildCache...)
+	}
+	return total, nil
+}
+
+// ensureImage copies an image to a node from one that has it. Images no
+// node has are left for the create to report.
+func (p *NodePool) ensureImage(ctx context.Context, target *poolNode, ref string) error {
+	if _, _, err := target.client.ImageInspectWithRaw(ctx, ref); err == nil {
+		return nil
+	}
+	for _, n := range p.healthyNodes() {
+		if n == target {
+			continue
+		}
+		if _, _, err := n.client.ImageInspectWithRaw(ctx, ref); err != nil {
+			continue
+		}
+		archive, err := n.client.ImageSave(ctx, []string{ref})
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		resp, err := target.client.ImageLoad(ctx, archive, client.ImageLoadWithQuiet(true))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, err = io.Copy(io.Discard, resp.Body)
+		log.Printf("[Nodes] Copied image %s from node %s to %s", ref, n.node.ID, target.node.ID)
+		return err
+	}
+	return nil
+}
+
+// refresh connects newly registered nodes, drops removed ones and checks
+// the health and allocation of each
+func (p *NodePool) refresh(ctx context.Context, registered []*models.Node) {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+
+	p.mu.Lock()
+	current := make(map[string]*poolNode, len(p.nodes))
+	for id, n := range p.nodes {
+		current[id] = n
+	}
+	p.mu.Unlock()
+
+	next := make(map[string]*poolNode, len(registered))
+	membership := false
+	for _, node := range registered {
+		n, ok := current[node.ID]
+		switch {
+		case node.ID == models.DefaultNodeID:
+			n = &poolNode{node: *node, client: p.CommonAPIClient, health: current[node.ID].health, networkReady: true}
+		case ok && n.node.Host == node.Host && n.node.CertPath == node.CertPath:
+			n = &poolNode{node: *node, client: n.client, health: n.health, networkReady: n.networkReady}
+		default:
+			if ok {
+				n.client.Close()
+			}
+			cli, err := p.connect(node)
+			if err != nil {
+				log.Printf("[Nodes] Failed to connect to node %s: %v", node.ID, err)
+				continue
+			}
+			n = &poolNode{node: *node, client: cli}
+			membership = true
+		}
+		next[node.ID] = n
+	}
+	if _, ok := next[models.DefaultNodeID]; !ok {
+		next[models.DefaultNodeID] = current[models.DefaultNodeID]
+	}
+	for id, n := range current {
+		if _, ok := next[id]; !ok {
+			n.client.Close()
+			membership = true
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, n := range next {
+		wg.Add(1)
+		go func(n *poolNode) {
+			defer wg.Done()
+			p.check(ctx, n)
+		}(n)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, n := range next {
+		if old, ok := p.nodes[id]; ok && old.health.Healthy != n.health.Healthy {
+			membership = true
+		}
+	}
+	p.nodes = next
+	for key, owner := range p.owners {
+		if cur, ok := next[owner.node.ID]; !ok {
+			delete(p.owners, key)
+		} else if cur != owner {
+			p.owners[key] = cur
+		}
+	}
+	for id, owner := range p.execs {
+		if cur, ok := next[owner.node.ID]; !ok {
+			delete(p.execs, id)
+		} else if cur != owner {
+			p.execs[id] = cur
+		}
+	}
+	if membership {
+		close(p.changed)
+		p.changed = make(chan struct{})
+	}
+}
+
+// check pings a node and tallies what its terminals are allocated
+func (p *NodePool) check(ctx context.Context, n *poolNode) {
+	ctx, cancel := context.WithTimeout(ctx, nodeCheckTimeout)
+	defer cancel()
+
+	health := NodeHealth{CheckedAt: time.Now()}
+	defer func() { n.health = health }()
+
+	info, err := n.client.Info(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return
+	}
+	health.EngineCPUMillicores = int64(info.NCPU) * 1000
+	health.EngineMemoryMB = info.MemTotal / (1024 * 1024)
+
+	list, err := n.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", "rexec.managed=true")),
+	})
+	if err != nil {
+		health.Error = err.Error()
+		return
+	}
+	for _, c := range list {
+		if c.Labels["rexec.helper"] != "" {
+			continue
+		}
+		health.Containers++
+		if c.State != "running" && c.State != "paused" {
+			continue
+		}
+		health.Running++
+		cpu, _ := strconv.ParseInt(c.Labels["rexec.cpu_limit"], 10, 64)
+		memory, _ := strconv.ParseInt(c.Labels["rexec.memory_limit"], 10, 64)
+		health.AllocatedCPUMillicores += cpu
+		health.AllocatedMemoryMB += memory / (1024 * 1024)
+	}
+
+	if !n.networkReady {
+		if err := createIsolatedNetwork(n.client); err != nil {
+			log.Printf("[Nodes] WARNING: Failed to create isolated network on node %s: %v", n.node.ID, err)
+		} else {
+			n.networkReady = true
+		}
+	}
+	health.Healthy = true
+	if !p.single() {
+		keys := make([]string, 0, len(list))
+		for _, c := range list {
+			keys = append(keys, c.ID)
+		}
+		p.setOwner(n, keys...)
+	}
+}
+
+// Close closes the connection to every node
+func (p *NodePool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, n := range p.nodes {
+		if id != models.DefaultNodeID {
+			n.client.Close()
+		}
+	}
+	return p.CommonAPIClient.Close()
+}
+
+// moved records that a container was recreated on another node
+func (p *NodePool) moved(oldID, newID string, n *poolNode, names ...string) {
+	p.forget(oldID)
+	p.setOwner(n, append(names, newID)...)
+}
+
+// errNodesChanged ends merged event streams when nodes join or leave
+var errNodesChanged = errors.New("nodes changed")
@@ -0,0 +1,321 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// newTestPool creates a pool of healthy nodes with 4 vCPUs and 8 GB each
+func newTestNodePool(ids ...string) (*NodePool, map[string]*MockDockerClient) {
+	mocks := map[string]*MockDockerClient{models.DefaultNodeID: {}}
+	pool := newNodePool(mocks[models.DefaultNodeID])
+	pool.nodes[models.DefaultNodeID].node.CPUMillicores = 4000
+	pool.nodes[models.DefaultNodeID].node.MemoryMB = 8192
+	for _, id := range ids {
+		mocks[id] = &MockDockerClient{}
+		pool.nodes[id] = &poolNode{
+			node:   models.Node{ID: id, Labels: map[string]string{}, Status: models.NodeActive, CPUMillicores: 4000, MemoryMB: 8192},
+			client: mocks[id],
+			health: NodeHealth{Healthy: true},
+		}
+	}
+	return pool, mocks
+}
+
+func notFound(what string) error {
+	return errdefs.NotFound(fmt.Errorf("%s not found", what))
+}
+
+func TestNodePool_Place(t *testing.T) {
+	ctx := context.Background()
+	req := placement{cpuMillicores: 1000, memoryMB: 2048, image: "ubuntu:24.04"}
+	noImage := func(m *MockDockerClient) {
+		m.ImageInspectWithRawFunc = func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+			return types.ImageInspect{}, nil, notFound("image")
+		}
+	}
+
+	tests := []struct {
+		name  string
+		setup func(p *NodePool, mocks map[string]*MockDockerClient)
+		req   placement
+		want  string
+		err   error
+	}{
+		{
+			name: "Most free resources",
+			setup: func(p *NodePool, mocks map[string]*MockDockerClient) {
+				for _, m := range mocks {
+					noImage(m)
+				}
+				p.nodes[models.DefaultNodeID].health.AllocatedMemoryMB = 4096
+				p.nodes["b"].health.AllocatedCPUMillicores = 3000
+			},
+			req:  req,
+			want: "a",
+		},
+		{
+			name: "Image locality breaks a near tie",
+			setup: func(p *NodePool, mocks map[string]*MockDockerClient) {
+				noImage(mocks[models.DefaultNodeID])
+				noImage(mocks["a"])
+				p.nodes["b"].health.AllocatedMemoryMB = 1024
+			},
+			req:  req,
+			want: "b",
+		},
+		{
+			name: "Node selector",
+			setup: func(p *NodePool, mocks map[string]*MockDockerClient) {
+				p.nodes["b"].node.Labels["gpu"] = "true"
+			},
+			req:  placement{cpuMillicores: 1000, memoryMB: 2048, selector: map[string]string{"gpu": "true"}},
+			want: "b",
+		},
+		{
+			name: "Cordoned, unhealthy and full nodes are skipped",
+			setup: func(p *NodePool, mocks map[string]*MockDockerClient) {
+				p.nodes[models.DefaultNodeID].node.Status = models.NodeCordoned
+				p.nodes["a"].health.Healthy = false
+				p.nodes["b"].health.AllocatedMemoryMB = 7000
+			},
+			req: req,
+			err: ErrNoNodeAvailable,
+		},
+		{
+			name: "Existing volume wins over status and room",
+			setup: func(p *NodePool, mocks map[string]*MockDockerClient) {
+				p.nodes["b"].node.Status = models.NodeCordoned
+				p.nodes["b"].health.AllocatedMemoryMB = 8192
+				mocks["b"].VolumeInspectFunc = func(ctx context.Context, volumeID string) (volume.Volume, error) {
+					return volume.Volume{Name: volumeID}, nil
+				}
+			},
+			req:  placement{cpuMillicores: 1000, memoryMB: 2048, volumes: []string{"rexec-u1-dev"}},
+			want: "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, mocks := newTestNodePool("a", "b")
+			tt.setup(pool, mocks)
+
+			got, err := pool.place(ctx, tt.req)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("place: %v", err)
+			}
+			if got.node.ID != tt.want {
+				t.Errorf("placed on %s, want %s", got.node.ID, tt.want)
+			}
+			if got.health.AllocatedCPUMillicores < tt.req.cpuMillicores {
+				t.Errorf("allocated CPU = %d, want the terminal reserved", got.health.AllocatedCPUMillicores)
+			}
+		})
+	}
+}
+
+func TestNodePool_Routing(t *testing.T) {
+	ctx := context.Background()
+	pool, mocks := newTestNodePool("a")
+	pool.nodes[models.DefaultNodeID].health.AllocatedMemoryMB = 8000
+
+	mocks["a"].ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+		return container.CreateResponse{ID: "on-a"}, nil
+	}
+	config := &container.Config{Image: "alpine", Labels: map[string]string{"rexec.managed": "true", "rexec.memory_limit": "536870912"}}
+	resp, err := pool.ContainerCreate(ctx, config, &container.HostConfig{}, nil, nil, "rexec-u1-dev")
+	if err != nil || resp.ID != "on-a" {
+		t.Fatalf("create = %q, %v; want on-a", resp.ID, err)
+	}
+
+	var started []string
+	for id, m := range mocks {
+		m.ContainerStartFunc = func(ctx context.Context, containerID string, options container.StartOptions) error {
+			started = append(started, id)
+			return nil
+		}
+	}
+	if err := pool.ContainerStart(ctx, "on-a", container.StartOptions{}); err != nil || len(started) != 1 || started[0] != "a" {
+		t.Errorf("start went to %v (%v), want node a", started, err)
+	}
+
+	// A network helper joins its terminal's node
+	helper, _ := pool.ContainerCreate(ctx, &container.Config{Image: "alpine"}, &container.HostConfig{NetworkMode: "container:on-a"}, nil, nil, "")
+	if helper.ID != "on-a" {
+		t.Errorf("helper created on the wrong node (id %q)", helper.ID)
+	}
+
+	// Containers the pool hasn't seen are looked up on every node
+	mocks[models.DefaultNodeID].ContainerInspectFunc = func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+		return types.ContainerJSON{}, notFound("container")
+	}
+	mocks["a"].ContainerInspectFunc = func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+		if containerID != "elsewhere" {
+			return types.ContainerJSON{}, notFound("container")
+		}
+		return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: "elsewhere"}}, nil
+	}
+	if got := pool.NodeOf(ctx, "elsewhere"); got != "a" {
+		t.Errorf("node of unseen container = %s, want a", got)
+	}
+	if got := pool.NodeOf(ctx, "missing"); got != models.DefaultNodeID {
+		t.Errorf("node of missing container = %s, want the default node", got)
+	}
+
+	// Execs go to the node they were created on
+	mocks["a"].ContainerExecCreateFunc = func(ctx context.Context, container string, config container.ExecOptions) (types.IDResponse, error) {
+		return types.IDResponse{ID: "exec-1"}, nil
+	}
+	var attached string
+	for id, m := range mocks {
+		m.ContainerExecAttachFunc = func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+			attached = id
+			return types.HijackedResponse{}, nil
+		}
+	}
+	if _, err := pool.ContainerExecCreate(ctx, "on-a", container.ExecOptions{}); err != nil {
+		t.Fatalf("exec create: %v", err)
+	}
+	pool.ContainerExecAttach(ctx, "exec-1", container.ExecAttachOptions{})
+	if attached != "a" {
+		t.Errorf("exec attach went to %q, want a", attached)
+	}
+}
+
+func TestNodePool_ImageRemove(t *testing.T) {
+	pool, mocks := newTestNodePool("a")
+	removed := map[string]bool{}
+	mocks[models.DefaultNodeID].ImageRemoveFunc = func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+		return nil, notFound("image")
+	}
+	mocks["a"].ImageRemoveFunc = func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+		removed["a"] = true
+		return []image.DeleteResponse{{Deleted: imageID}}, nil
+	}
+	if _, err := pool.ImageRemove(context.Background(), "snap", image.RemoveOptions{}); err != nil || !removed["a"] {
+		t.Errorf("remove = %v, removed %v; want it gone from node a", err, removed)
+	}
+}
+
+type fakeNodeStore struct {
+	record  *storage.ContainerRecord
+	claimed []string
+}
+
+func (s *fakeNodeStore) GetNodes(ctx context.Context) ([]*models.Node, error) { return nil, nil }
+func (s *fakeNodeStore) EnsureDefaultNode(ctx context.Context) error          { return nil }
+
+func (s *fakeNodeStore) GetContainerByDockerID(ctx context.Context, dockerID string) (*storage.ContainerRecord, error) {
+	if s.record.DockerID != dockerID {
+		return nil, nil
+	}
+	return s.record, nil
+}
+
+func (s *fakeNodeStore) UpdateContainerDockerID(ctx context.Context, id, dockerID string) error {
+	s.record.DockerID = dockerID
+	return nil
+}
+
+func (s *fakeNodeStore) DeletePoolClaim(ctx context.Context, dockerID string) error {
+	s.claimed = append(s.claimed, dockerID)
+	return nil
+}
+
+func TestNodeMonitor_Drain(t *testing.T) {
+	ctx := context.Background()
+	pool, mocks := newTestNodePool("a", "b")
+	pool.nodes["a"].node.Status = models.NodeDraining
+	pool.nodes[models.DefaultNodeID].health.Healthy = false
+	manager := &Manager{client: pool, nodes: pool, containers: make(map[string]*ContainerInfo), userIndex: make(map[string][]string)}
+	manager.containers["old-id"] = &ContainerInfo{ID: "old-id", UserID: "u1", Status: "stopped"}
+	manager.userIndex["u1"] = []string{"old-id"}
+	store := &fakeNodeStore{record: &storage.ContainerRecord{ID: "c1", UserID: "u1", DockerID: "old-id"}}
+	monitor := NewNodeMonitor(manager, store, nil, 0)
+	var hookOld, hookNode string
+	monitor.SetMigrateHook(func(record *storage.ContainerRecord, oldDockerID, nodeID string) {
+		hookOld, hookNode = oldDockerID, nodeID
+	})
+
+	source, target := mocks["a"], mocks["b"]
+	source.ContainerListFunc = func(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
+		return []types.Container{
+			{ID: "old-id", State: "exited", Labels: map[string]string{"rexec.managed": "true"}},
+			{ID: "busy", State: "running", Labels: map[string]string{"rexec.managed": "true"}},
+		}, nil
+	}
+	source.ContainerInspectFunc = func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID: containerID, Name: "/rexec-u1-dev",
+				State:      &types.ContainerState{Status: "exited"},
+				HostConfig: &container.HostConfig{Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: "rexec-u1-dev", Target: "/home/user"}}},
+			},
+			Mounts: []types.MountPoint{{Type: mount.TypeVolume, Name: "rexec-u1-dev", Destination: "/home/user"}},
+			Config: &container.Config{Image: "ubuntu", Labels: map[string]string{"rexec.managed": "true", "rexec.user_id": "u1"}},
+		}, nil
+	}
+	source.CopyFromContainerFunc = func(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+		return io.NopCloser(strings.NewReader("home archive")), container.PathStat{}, nil
+	}
+	var sourceRemoved, volumeRemoved string
+	source.ContainerRemoveFunc = func(ctx context.Context, containerID string, options container.RemoveOptions) error {
+		sourceRemoved = containerID
+		return nil
+	}
+	source.VolumeRemoveFunc = func(ctx context.Context, volumeID string, force bool) error {
+		volumeRemoved = volumeID
+		return nil
+	}
+	var createdName, copiedTo, copied string
+	target.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+		createdName = containerName
+		return container.CreateResponse{ID: "new-id"}, nil
+	}
+	target.CopyToContainerFunc = func(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error {
+		data, _ := io.ReadAll(content)
+		copiedTo, copied = containerID+":"+dstPath, string(data)
+		return nil
+	}
+
+	if moved := monitor.Drain(ctx, "a"); moved != 1 {
+		t.Fatalf("moved = %d, want only the stopped terminal", moved)
+	}
+	if createdName != "rexec-u1-dev" || copiedTo != "new-id:/home" || copied != "home archive" {
+		t.Errorf("created %q, copied %q to %q; want the home directory copied into the new container", createdName, copied, copiedTo)
+	}
+	if sourceRemoved != "old-id" || volumeRemoved != "rexec-u1-dev" {
+		t.Errorf("removed container %q and volume %q from the source", sourceRemoved, volumeRemoved)
+	}
+	if store.record.DockerID != "new-id" || hookOld != "old-id" || hookNode != "b" {
+		t.Errorf("record docker id %q, hook (%q, %q); want new-id moved to b", store.record.DockerID, hookOld, hookNode)
+	}
+	if _, ok := manager.containers["new-id"]; !ok || manager.userIndex["u1"][0] != "new-id" {
+		t.Errorf("manager still tracks the old container: %v", manager.userIndex)
+	}
+	if got := pool.NodeOf(ctx, "new-id"); got != "b" {
+		t.Errorf("new container routed to %s, want b", got)
+	}
+}
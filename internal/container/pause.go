@@ -0,0 +1,184 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types/checkpoint"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// What the cleanup service does with a guest container that reaches the idle timeout
+const (
+	IdleActionStop       = "stop"
+	IdleActionCheckpoint = "checkpoint" // CRIU checkpoint, restored on next start; falls back to stop
+)
+
+// idleCheckpointID names the checkpoint taken by CheckpointContainer
+const idleCheckpointID = "rexec-idle"
+
+// PauseContainer freezes a container's processes (cgroup freezer). Memory and
+// processes are kept, so UnpauseContainer resumes exactly where it left off.
+func (m *Manager) PauseContainer(ctx context.Context, dockerID string) error {
+	m.mu.RLock()
+	info, ok := m.containers[dockerID]
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("container not found: %s", dockerID)
+	}
+	if info.Status == "paused" {
+		return nil
+	}
+	if !m.Capabilities().Pause {
+		return fmt.Errorf("the container runtime does not support pausing")
+	}
+
+	if err := m.client.ContainerPause(ctx, dockerID); err != nil {
+		return fmt.Errorf("failed to pause container: %w", err)
+	}
+
+	m.mu.Lock()
+	info.Status = "paused"
+	m.mu.Unlock()
+
+	return nil
+}
+
+// UnpauseContainer resumes a paused container. It works for containers this
+// instance doesn't track, e.g. ones created on another replica.
+func (m *Manager) UnpauseContainer(ctx context.Context, dockerID string) error {
+	if err := m.client.ContainerUnpause(ctx, dockerID); err != nil {
+		return fmt.Errorf("failed to unpause container: %w", err)
+	}
+
+	m.mu.Lock()
+	if info, ok := m.containers[dockerID]; ok {
+		info.Status = "running"
+		info.LastUsedAt = time.Now()
+	}
+	m.mu.Unlock()
+
+	return nil
+}
+
+// ResumeIfPaused unpauses a container if Docker reports it paused, and
+// reports whether it did. Used wherever a user reconnects to a container.
+func (m *Manager) ResumeIfPaused(ctx context.Context, dockerID string) (bool, error) {
+	inspect, err := m.client.ContainerInspect(ctx, dockerID)
+	if err != nil {
+		return false, err
+	}
+	if inspect.State == nil || !inspect.State.Paused {
+		return false, nil
+	}
+	if err := m.UnpauseContainer(ctx, dockerID); err != nil {
+		return false, err
+	}
+	log.Printf("[Container] Resumed paused container %s", dockerID[:12])
+	return true, nil
+}
+
+// CheckpointContainer checkpoints a container's processes to disk and stops
+// it; StartContainer restores the checkpoint. This needs an experimental
+// Docker daemon with CRIU; without one, it returns an error and the caller
+// should stop the container instead.
+func (m *Manager) CheckpointContainer(ctx context.Context, dockerID string) error {
+	cp, ok := m.client.(client.CheckpointAPIClient)
+	if !ok || !m.Capabilities().Checkpoint {
+		return fmt.Errorf("the container runtime does not support checkpoints")
+	}
+
+	m.mu.RLock()
+	info, tracked := m.containers[dockerID]
+	m.mu.RUnlock()
+
+	// CRIU can't dump frozen processes
+	if tracked && info.Status == "paused" {
+		if err := m.UnpauseContainer(ctx, dockerID); err != nil {
+			return err
+		}
+	}
+
+	// Replace any older checkpoint so a restore never goes back in time
+	_ = cp.CheckpointDelete(ctx, dockerID, checkpoint.DeleteOptions{CheckpointID: idleCheckpointID})
+	if err := cp.CheckpointCreate(ctx, dockerID, checkpoint.CreateOptions{CheckpointID: idleCheckpointID, Exit: true}); err != nil {
+		return fmt.Errorf("failed to checkpoint container: %w", err)
+	}
+
+	if tracked {
+		m.mu.Lock()
+		info.Status = "stopped"
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// startFromCheckpoint restores the idle checkpoint if the container has one.
+// The checkpoint is deleted either way; if restoring fails, ok is false and
+// the caller starts the container normally.
+func (m *Manager) startFromCheckpoint(ctx context.Context, dockerID string) (ok bool) {
+	cp, supported := m.client.(client.CheckpointAPIClient)
+	if !supported || !m.Capabilities().Checkpoint {
+		return false
+	}
+	checkpoints, err := cp.CheckpointList(ctx, dockerID, checkpoint.ListOptions{})
+	if err != nil {
+		return false
+	}
+
+	found := false
+	for _, c := range checkpoints {
+		if c.Name == idleCheckpointID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	err = m.client.ContainerStart(ctx, dockerID, container.StartOptions{CheckpointID: idleCheckpointID})
+	if err != nil {
+		log.Printf("[Container] Failed to restore checkpoint for %s, starting fresh: %v", dockerID[:12], err)
+	} else {
+		log.Printf("[Container] Restored %s from idle checkpoint", dockerID[:12])
+	}
+	_ = cp.CheckpointDelete(ctx, dockerID, checkpoint.DeleteOptions{CheckpointID: idleCheckpointID})
+	return err == nil
+}
+
+// GetContainersToPause returns running guest containers idle for longer than threshold
+func (m *Manager) GetContainersToPause(threshold time.Duration) []*ContainerInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var result []*ContainerInfo
+	for _, info := range m.containers {
+		if info.Status != "running" || isUnclaimedPoolMember(info.Labels) {
+			continue
+		}
+		if now.Sub(info.LastUsedAt) <= threshold {
+			continue
+		}
+		if isGuestLabels(info.Labels) {
+			result = append(result, info)
+		}
+	}
+	return result
+}
+
+func isGuestLabels(labels map[string]string) bool {
+	if labels == nil {
+		return false
+	}
+	if labels["rexec.tier"] == "guest" {
+		return true
+	}
+	_, ok := labels["rexec.guest"]
+	return ok
+}
@@ -0,0 +1,170 @@
+package container
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func newPauseTestManager(mockClient *MockDockerClient) *Manager {
+	return &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+	}
+}
+
+func TestManager_GetContainersToPause(t *testing.T) {
+	manager := newPauseTestManager(&MockDockerClient{})
+	idle := time.Now().Add(-time.Hour)
+
+	manager.containers = map[string]*ContainerInfo{
+		"idle-guest":   {ID: "idle-guest", Status: "running", LastUsedAt: idle, Labels: map[string]string{"rexec.tier": "guest"}},
+		"active-guest": {ID: "active-guest", Status: "running", LastUsedAt: time.Now(), Labels: map[string]string{"rexec.tier": "guest"}},
+		"paused-guest": {ID: "paused-guest", Status: "paused", LastUsedAt: idle, Labels: map[string]string{"rexec.tier": "guest"}},
+		"idle-user":    {ID: "idle-user", Status: "running", LastUsedAt: idle, Labels: map[string]string{"rexec.tier": "free"}},
+		"pool-member":  {ID: "pool-member", Status: "running", LastUsedAt: idle, Labels: map[string]string{"rexec.user_id": poolUserID, PoolLabel: "ubuntu/", "rexec.tier": "guest"}},
+	}
+
+	got := manager.GetContainersToPause(30 * time.Minute)
+	if len(got) != 1 || got[0].ID != "idle-guest" {
+		ids := make([]string, 0, len(got))
+		for _, info := range got {
+			ids = append(ids, info.ID)
+		}
+		t.Errorf("GetContainersToPause() = %v, want [idle-guest]", ids)
+	}
+}
+
+func TestManager_PauseAndUnpause(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := newPauseTestManager(mockClient)
+	id := "pause-container-0001"
+	manager.containers[id] = &ContainerInfo{ID: id, Status: "running", LastUsedAt: time.Now().Add(-time.Hour)}
+
+	var paused, unpaused int
+	mockClient.ContainerPauseFunc = func(ctx context.Context, containerID string) error {
+		paused++
+		return nil
+	}
+	mockClient.ContainerUnpauseFunc = func(ctx context.Context, containerID string) error {
+		unpaused++
+		return nil
+	}
+
+	if err := manager.PauseContainer(context.Background(), id); err != nil {
+		t.Fatalf("PauseContainer() error = %v", err)
+	}
+	// Pausing twice is a no-op
+	if err := manager.PauseContainer(context.Background(), id); err != nil {
+		t.Fatalf("PauseContainer() error = %v", err)
+	}
+	if paused != 1 || manager.containers[id].Status != "paused" {
+		t.Errorf("paused %d times, status %q", paused, manager.containers[id].Status)
+	}
+
+	if err := manager.UnpauseContainer(context.Background(), id); err != nil {
+		t.Fatalf("UnpauseContainer() error = %v", err)
+	}
+	info := manager.containers[id]
+	if unpaused != 1 || info.Status != "running" || time.Since(info.LastUsedAt) > time.Minute {
+		t.Errorf("after unpause: calls %d, status %q, last used %v", unpaused, info.Status, info.LastUsedAt)
+	}
+
+	if err := manager.PauseContainer(context.Background(), "missing-container"); err == nil {
+		t.Error("PauseContainer() on untracked container should fail")
+	}
+}
+
+func TestManager_StopAndStartPausedContainer(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := newPauseTestManager(mockClient)
+	id := "pause-container-0002"
+
+	var calls []string
+	mockClient.ContainerUnpauseFunc = func(ctx context.Context, containerID string) error {
+		calls = append(calls, "unpause")
+		return nil
+	}
+	mockClient.ContainerStopFunc = func(ctx context.Context, containerID string, options container.StopOptions) error {
+		calls = append(calls, "stop")
+		return nil
+	}
+	mockClient.ContainerStartFunc = func(ctx context.Context, containerID string, options container.StartOptions) error {
+		calls = append(calls, "start")
+		return nil
+	}
+
+	manager.containers[id] = &ContainerInfo{ID: id, Status: "paused"}
+	if err := manager.StopContainer(context.Background(), id); err != nil {
+		t.Fatalf("StopContainer() error = %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "unpause" || calls[1] != "stop" {
+		t.Errorf("StopContainer() calls = %v, want [unpause stop]", calls)
+	}
+
+	calls = nil
+	manager.containers[id].Status = "paused"
+	if err := manager.StartContainer(context.Background(), id); err != nil {
+		t.Fatalf("StartContainer() error = %v", err)
+	}
+	if len(calls) != 1 || calls[0] != "unpause" || manager.containers[id].Status != "running" {
+		t.Errorf("StartContainer() calls = %v, status %q", calls, manager.containers[id].Status)
+	}
+}
+
+func TestCleanupService_PausesBeforeStopping(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := newPauseTestManager(mockClient)
+
+	manager.containers["idle-40m-guest"] = &ContainerInfo{
+		ID:         "idle-40m-guest",
+		CreatedAt:  time.Now(),
+		Status:     "running",
+		LastUsedAt: time.Now().Add(-40 * time.Minute),
+		Labels:     map[string]string{"rexec.tier": "guest"},
+	}
+	manager.containers["idle-2h-guest"] = &ContainerInfo{
+		ID:         "idle-2h-guest",
+		CreatedAt:  time.Now(),
+		Status:     "paused",
+		LastUsedAt: time.Now().Add(-2 * time.Hour),
+		Labels:     map[string]string{"rexec.tier": "guest"},
+	}
+
+	cleanupService := NewCleanupService(manager, time.Hour, 5*time.Minute)
+	cleanupService.SetIdlePolicy(30*time.Minute, IdleActionStop)
+
+	statuses := make(map[string]string)
+	cleanupService.SetStatusHook(func(info *ContainerInfo, status string) {
+		statuses[info.ID] = status
+	})
+
+	cleanupService.cleanupIdleContainers()
+
+	if statuses["idle-40m-guest"] != "paused" {
+		t.Errorf("idle-40m-guest status = %q, want paused", statuses["idle-40m-guest"])
+	}
+	if statuses["idle-2h-guest"] != "stopped" {
+		t.Errorf("idle-2h-guest status = %q, want stopped", statuses["idle-2h-guest"])
+	}
+}
+
+func TestCleanupConfigFromEnv(t *testing.T) {
+	t.Setenv("IDLE_PAUSE_AFTER", "5m")
+	t.Setenv("IDLE_ACTION", "checkpoint")
+
+	cfg := CleanupConfigFromEnv(DefaultCleanupConfig())
+	if cfg.PauseAfter != 5*time.Minute || cfg.IdleAction != IdleActionCheckpoint {
+		t.Errorf("cfg = %+v", cfg)
+	}
+
+	t.Setenv("IDLE_PAUSE_AFTER", "soon")
+	t.Setenv("IDLE_ACTION", "hibernate")
+	cfg = CleanupConfigFromEnv(DefaultCleanupConfig())
+	if cfg.PauseAfter != DefaultCleanupConfig().PauseAfter || cfg.IdleAction != IdleActionStop {
+		t.Errorf("invalid values should be ignored, cfg = %+v", cfg)
+	}
+}
@@ -0,0 +1,308 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// maxExecOutputBytes caps what ExecOutput reads from a command
+const maxExecOutputBytes = 4 * 1024 * 1024
+
+// Linux reports /proc times in USER_HZ ticks and sizes in pages, which are
+// 100 and 4096 on every architecture we run on
+const (
+	procClockTicks = 100
+	procPageSize   = 4096
+)
+
+// processListScript prints, in sections separated by "---": its own PID,
+// /proc/uptime and the memory limit; /etc/passwd; and one line per process
+// with its UID, command line and /proc stat fields. It only needs a POSIX
+// shell, so it works in images without ps.
+const processListScript = `echo "$$"
+cat /proc/uptime
+cat /sys/fs/cgroup/memory.max 2>/dev/null || cat /sys/fs/cgroup/memory/memory.limit_in_bytes 2>/dev/null || echo max
+grep '^MemTotal:' /proc/meminfo
+echo ---
+cat /etc/passwd 2>/dev/null
+echo ---
+for d in /proc/[0-9]*; do
+	s=$(cat "$d/stat" 2>/dev/null) || continue
+	u=$(grep '^Uid:' "$d/status" 2>/dev/null)
+	c=$(tr '\000\n' '  ' < "$d/cmdline" 2>/dev/null)
+	printf '%s\037%s\037%s\n' "$u" "$c" "$s"
+done`
+
+// Process is a process running inside a container
+type Process struct {
+	PID           int        `json:"pid"`
+	PPID          int        `json:"ppid"`
+	User          string     `json:"user"`
+	State         string     `json:"state"` // R, S, D, Z, T...
+	Name          string     `json:"name"`
+	Command       string     `json:"command"`
+	Threads       int        `json:"threads"`
+	CPUPercent    float64    `json:"cpu_percent"` // Average since the process started, like ps
+	MemoryBytes   int64      `json:"memory_bytes"`
+	MemoryPercent float64    `json:"memory_percent"` // Of the container's memory limit
+	UptimeSeconds float64    `json:"uptime_seconds"`
+	Service       string     `json:"service,omitempty"` // Set on the root process of a supervised service
+	Children      []*Process `json:"children,omitempty"`
+}
+
+// ListProcesses returns every process in a running container, sorted by PID.
+// The command that collects them is left out.
+func (m *Manager) ListProcesses(ctx context.Context, dockerID string) ([]*Process, error) {
+	output, err := m.ExecOutput(ctx, dockerID, []string{"/bin/sh", "-c", processListScript})
+	if err != nil {
+		return nil, err
+	}
+	return parseProcessList(output)
+}
+
+// SignalProcesses sends a signal to processes in a container. PID 1 keeps the
+// container alive and can't be signalled.
+func (m *Manager) SignalProcesses(ctx context.Context, dockerID string, pids []int, signal string) error {
+	sig, err := NormalizeSignal(signal)
+	if err != nil {
+		return err
+	}
+	if len(pids) == 0 {
+		return fmt.Errorf("no processes to signal")
+	}
+	cmd := []string{"kill", "-s", sig}
+	for _, pid := range pids {
+		if pid <= 1 {
+			return fmt.Errorf("process %d can't be signalled", pid)
+		}
+		cmd = append(cmd, strconv.Itoa(pid))
+	}
+	_, err = m.execAndWait(ctx, dockerID, cmd)
+	return err
+}
+
+// signalNames are the signals processes can be sent through the API
+var signalNames = map[string]bool{
+	"HUP": true, "INT": true, "QUIT": true, "KILL": true, "USR1": true,
+	"USR2": true, "TERM": true, "CONT": true, "STOP": true, "WINCH": true,
+}
+
+// NormalizeSignal turns "sigterm", "SIGTERM" or "TERM" into "TERM"
+func NormalizeSignal(signal string) (string, error) {
+	name := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(signal)), "SIG")
+	if name == "" {
+		return "TERM", nil
+	}
+	if !signalNames[name] {
+		return "", fmt.Errorf("unsupported signal %q", signal)
+	}
+	return name, nil
+}
+
+// ProcessTree nests processes under their parents; processes whose parent
+// isn't in the list become roots
+func ProcessTree(procs []*Process) []*Process {
+	byPID := make(map[int]*Process, len(procs))
+	for _, p := range procs {
+		p.Children = nil
+		byPID[p.PID] = p
+	}
+	var roots []*Process
+	for _, p := range procs {
+		if parent, ok := byPID[p.PPID]; ok && p.PPID != p.PID {
+			parent.Children = append(parent.Children, p)
+		} else {
+			roots = append(roots, p)
+		}
+	}
+	return roots
+}
+
+// DescendantPIDs returns pid and the PIDs of all its descendants, parents first
+func DescendantPIDs(procs []*Process, pid int) []int {
+	children := make(map[int][]int)
+	found := false
+	for _, p := range procs {
+		children[p.PPID] = append(children[p.PPID], p.PID)
+		if p.PID == pid {
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	pids := []int{pid}
+	seen := map[int]bool{pid: true}
+	for i := 0; i < len(pids); i++ {
+		for _, child := range children[pids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				pids = append(pids, child)
+			}
+		}
+	}
+	return pids
+}
+
+// parseProcessList parses the output of processListScript
+func parseProcessList(output string) ([]*Process, error) {
+	sections := strings.SplitN(output, "\n---\n", 3)
+	if len(sections) != 3 {
+		return nil, fmt.Errorf("unexpected process list output")
+	}
+
+	header := strings.Split(strings.TrimSpace(sections[0]), "\n")
+	if len(header) < 3 {
+		return nil, fmt.Errorf("unexpected process list output")
+	}
+	self, err := strconv.Atoi(strings.TrimSpace(header[0]))
+	if err != nil {
+		return nil, fmt.Errorf("unexpected process list output")
+	}
+	var uptime float64
+	if fields := strings.Fields(header[1]); len(fields) > 0 {
+		uptime, _ = strconv.ParseFloat(fields[0], 64)
+	}
+	// The smaller of the cgroup limit ("max" when unlimited) and the host's memory
+	var memLimit int64
+	if limit, err := strconv.ParseInt(strings.TrimSpace(header[2]), 10, 64); err == nil && limit > 0 {
+		memLimit = limit
+	}
+	if len(header) > 3 {
+		if fields := strings.Fields(header[3]); len(fields) >= 2 {
+			if kb, err := strconv.ParseInt(fields[1], 10, 64); err == nil && (memLimit == 0 || kb*1024 < memLimit) {
+				memLimit = kb * 1024
+			}
+		}
+	}
+
+	users := make(map[string]string)
+	for _, line := range strings.Split(sections[1], "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) >= 3 {
+			users[fields[2]] = fields[0]
+		}
+	}
+
+	var procs []*Process
+	scanner := bufio.NewScanner(strings.NewReader(sections[2]))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		p, ok := parseProcessLine(scanner.Text(), users, uptime, memLimit)
+		if !ok || p.PID == self || p.PPID == self {
+			continue
+		}
+		procs = append(procs, p)
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+	return procs, nil
+}
+
+// parseProcessLine parses "Uid:\t<uid>...\x1f<cmdline>\x1f<stat>"
+func parseProcessLine(line string, users map[string]string, uptime float64, memLimit int64) (*Process, bool) {
+	parts := strings.SplitN(line, "\x1f", 3)
+	if len(parts) != 3 {
+		return nil, false
+	}
+	stat := parts[2]
+
+	// The command name is in parentheses and may itself contain spaces or parentheses
+	open, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return nil, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(stat[:open]))
+	if err != nil {
+		return nil, false
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return nil, false
+	}
+
+	p := &Process{
+		PID:     pid,
+		Name:    stat[open+1 : end],
+		State:   fields[0],
+		Command: strings.TrimSpace(parts[1]),
+	}
+	p.PPID, _ = strconv.Atoi(fields[1])
+	p.Threads, _ = strconv.Atoi(fields[17])
+	if p.Command == "" {
+		p.Command = "[" + p.Name + "]"
+	}
+	if uid := strings.Fields(parts[0]); len(uid) >= 2 {
+		p.User = uid[1]
+		if name, ok := users[uid[1]]; ok {
+			p.User = name
+		}
+	}
+
+	utime, _ := strconv.ParseFloat(fields[11], 64)
+	stime, _ := strconv.ParseFloat(fields[12], 64)
+	starttime, _ := strconv.ParseFloat(fields[19], 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+
+	p.UptimeSeconds = uptime - starttime/procClockTicks
+	if p.UptimeSeconds > 0 {
+		p.CPUPercent = round1((utime + stime) / procClockTicks / p.UptimeSeconds * 100)
+	} else {
+		p.UptimeSeconds = 0
+	}
+	p.MemoryBytes = rss * procPageSize
+	if memLimit > 0 {
+		p.MemoryPercent = round1(float64(p.MemoryBytes) / float64(memLimit) * 100)
+	}
+	return p, true
+}
+
+func round1(v float64) float64 {
+	return float64(int64(v*10+0.5)) / 10
+}
+
+// ExecOutput runs cmd in the container and returns its stdout. A non-zero
+// exit code is returned as an error that includes stderr.
+func (m *Manager) ExecOutput(ctx context.Context, dockerID string, cmd []string) (string, error) {
+	execResp, err := m.client.ContainerExecCreate(ctx, dockerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	attachResp, err := m.client.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to attach/start exec: %w", err)
+	}
+	defer attachResp.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, io.LimitReader(attachResp.Reader, maxExecOutputBytes)); err != nil {
+		return "", fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	inspect, err := m.client.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = fmt.Sprintf("exit code %d", inspect.ExitCode)
+		}
+		return stdout.String(), fmt.Errorf("%s failed: %s", cmd[0], msg)
+	}
+	return stdout.String(), nil
+}
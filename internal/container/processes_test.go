@@ -0,0 +1,105 @@
+package container
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// procLine builds a line of processListScript output
+func procLine(uid, cmdline, stat string) string {
+	return "Uid:\t" + uid + "\t" + uid + "\t" + uid + "\t" + uid + "\x1f" + cmdline + "\x1f" + stat
+}
+
+func TestParseProcessList(t *testing.T) {
+	output := strings.Join([]string{
+		"42",
+		"12345.67 98765.43",
+		"1073741824",
+		"MemTotal:       16384000 kB",
+		"---",
+		"root:x:0:0:root:/root:/bin/bash",
+		"user:x:1000:1000::/home/user:/bin/bash",
+		"---",
+		procLine("0", "sleep infinity ", "1 (sleep) S 0 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 0 2000 100"),
+		procLine("1000", "npm run dev ", "50 (my (app)) S 1 50 50 0 -1 0 0 0 0 0 600 400 0 0 20 0 7 0 1224567 9000 25600"),
+		procLine("1000", "node server.js ", "51 (node) R 50 50 50 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1234000 9000 100"),
+		procLine("1000", "", "60 (defunct) Z 50 50 50 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1234000 0 0"),
+		procLine("0", "/bin/sh -c ...", "42 (sh) S 0 42 42 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1234500 100 10"),
+		procLine("0", "cat /proc/43/stat", "43 (cat) R 42 42 42 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1234500 100 10"),
+		"garbage",
+		"",
+	}, "\n")
+
+	procs, err := parseProcessList(output)
+	if err != nil {
+		t.Fatalf("parseProcessList() error = %v", err)
+	}
+	var pids []int
+	for _, p := range procs {
+		pids = append(pids, p.PID)
+	}
+	if !reflect.DeepEqual(pids, []int{1, 50, 51, 60}) {
+		t.Fatalf("pids = %v, want [1 50 51 60] without the lister", pids)
+	}
+
+	app := procs[1]
+	if app.Name != "my (app)" || app.User != "user" || app.PPID != 1 || app.Threads != 7 || app.Command != "npm run dev" {
+		t.Errorf("app = %+v", app)
+	}
+	// 10s of CPU over 100s; 100 MiB of a 1 GiB cgroup limit
+	if app.CPUPercent != 10 || app.MemoryBytes != 100*1024*1024 || app.MemoryPercent != 9.8 {
+		t.Errorf("app usage = %v%% CPU, %d bytes, %v%% memory", app.CPUPercent, app.MemoryBytes, app.MemoryPercent)
+	}
+	if zombie := procs[3]; zombie.State != "Z" || zombie.Command != "[defunct]" {
+		t.Errorf("zombie = %+v", zombie)
+	}
+
+	if _, err := parseProcessList("sh: not found"); err == nil {
+		t.Error("expected an error for unexpected output")
+	}
+}
+
+func TestProcessTree(t *testing.T) {
+	procs := []*Process{{PID: 1}, {PID: 50, PPID: 1}, {PID: 51, PPID: 50}, {PID: 52, PPID: 50}, {PID: 70, PPID: 0}, {PID: 80, PPID: 999}}
+
+	roots := ProcessTree(procs)
+	if len(roots) != 3 || roots[0].PID != 1 || roots[1].PID != 70 || roots[2].PID != 80 {
+		t.Fatalf("roots = %+v", roots)
+	}
+	if app := roots[0].Children[0]; app.PID != 50 || len(app.Children) != 2 {
+		t.Errorf("app = %+v", app)
+	}
+
+	if got := DescendantPIDs(procs, 50); !reflect.DeepEqual(got, []int{50, 51, 52}) {
+		t.Errorf("DescendantPIDs(50) = %v", got)
+	}
+	if got := DescendantPIDs(procs, 51); !reflect.DeepEqual(got, []int{51}) {
+		t.Errorf("DescendantPIDs(51) = %v", got)
+	}
+	if got := DescendantPIDs(procs, 404); got != nil {
+		t.Errorf("DescendantPIDs(404) = %v, want nil", got)
+	}
+}
+
+func TestNormalizeSignal(t *testing.T) {
+	tests := []struct {
+		signal  string
+		want    string
+		wantErr bool
+	}{
+		{"", "TERM", false},
+		{"SIGTERM", "TERM", false},
+		{"kill", "KILL", false},
+		{" sigusr1 ", "USR1", false},
+		{"9", "", true},
+		{"SIGSEGV", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeSignal(tt.signal)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeSignal(%q) = %q, %v", tt.signal, got, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package container
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Named PTY sessions are tmux sessions whose names start with this prefix,
+// so they never collide with the terminal's own "main", "split-..." and
+// "user-..." sessions
+const ptySessionPrefix = "tab-"
+
+// MaxPTYSessions caps the named sessions in one terminal
+const MaxPTYSessions = 16
+
+var (
+	// ErrTmuxUnavailable is returned when a terminal has no tmux to host
+	// named sessions
+	ErrTmuxUnavailable = errors.New("named sessions need tmux in the terminal")
+	// ErrPTYSessionNotFound is returned for a session ID that isn't running
+	ErrPTYSessionNotFound = errors.New("session not found")
+
+	envKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ptySessionFormat is the tmux list-sessions format ListPTYSessions parses
+const ptySessionFormat = "#{session_name}\t#{session_created}\t#{window_width}\t#{window_height}\t#{session_attached}\t#{pane_current_path}\t#{@rexec_shell}\t#{@rexec_name}"
+
+// PTYSession is a named shell running in a terminal. Clients attach to it
+// with ?session=<id> on the terminal WebSocket.
+type PTYSession struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Shell     string    `json:"shell"`
+	Cwd       string    `json:"cwd"` // Current directory of the shell
+	Cols      int       `json:"cols"`
+	Rows      int       `json:"rows"`
+	Clients   int       `json:"clients"` // Attached WebSocket clients
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PTYSessionConfig describes a named session to start
+type PTYSessionConfig struct {
+	Name  string
+	Shell string
+	Cwd   string
+	Env   map[string]string
+	Cols  int
+	Rows  int
+}
+
+// IsPTYSessionID reports whether id names a session made by CreatePTYSession
+func IsPTYSessionID(id string) bool {
+	rest, ok := strings.CutPrefix(id, ptySessionPrefix)
+	if !ok || len(rest) != 12 {
+		return false
+	}
+	_, err := hex.DecodeString(rest)
+	return err == nil
+}
+
+// Validate checks a session config and fills in its defaults
+func (cfg *PTYSessionConfig) Validate() error {
+	cfg.Name = strings.TrimSpace(cfg.Name)
+	if len(cfg.Name) > 64 {
+		return fmt.Errorf("name must be at most 64 characters")
+	}
+	if strings.ContainsAny(cfg.Name, "\t\n") {
+		return fmt.Errorf("name can't contain tabs or newlines")
+	}
+	if cfg.Shell == "" {
+		cfg.Shell = "/bin/sh"
+	}
+	if !path.IsAbs(cfg.Shell) || strings.ContainsAny(cfg.Shell, " \t\n") {
+		return fmt.Errorf("shell must be an absolute path")
+	}
+	if cfg.Cwd != "" && !path.IsAbs(cfg.Cwd) {
+		return fmt.Errorf("cwd must be an absolute path")
+	}
+	for key := range cfg.Env {
+		if !envKeyRe.MatchString(key) {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+	}
+	if cfg.Cols == 0 {
+		cfg.Cols = 80
+	}
+	if cfg.Rows == 0 {
+		cfg.Rows = 24
+	}
+	if cfg.Cols < 1 || cfg.Cols > 500 || cfg.Rows < 1 || cfg.Rows > 500 {
+		return fmt.Errorf("cols and rows must be between 1 and 500")
+	}
+	return nil
+}
+
+// ListPTYSessions returns a terminal's named sessions, oldest first
+func (m *Manager) ListPTYSessions(ctx context.Context, dockerID string) ([]*PTYSession, error) {
+	if !m.hasTmux(ctx, dockerID) {
+		return nil, ErrTmuxUnavailable
+	}
+	// tmux fails when no server is running, which just means no sessions
+	output, err := m.ExecOutput(ctx, dockerID, []string{"/bin/sh", "-c", `tmux list-sessions -F "$1" 2>/dev/null || true`, "sh", ptySessionFormat})
+	if err != nil {
+		return nil, err
+	}
+	return parsePTYSessions(output), nil
+}
+
+// GetPTYSession returns one named session
+func (m *Manager) GetPTYSession(ctx context.Context, dockerID, id string) (*PTYSession, error) {
+	sessions, err := m.ListPTYSessions(ctx, dockerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, ErrPTYSessionNotFound
+}
+
+// CreatePTYSession starts a detached named session. The shell keeps running
+// with no client attached until it exits or KillPTYSession is called.
+func (m *Manager) CreatePTYSession(ctx context.Context, dockerID string, cfg PTYSessionConfig) (*PTYSession, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if !m.hasTmux(ctx, dockerID) {
+		return nil, ErrTmuxUnavailable
+	}
+
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	id := ptySessionPrefix + hex.EncodeToString(idBytes)
+
+	cmd := []string{"tmux", "new-session", "-d", "-s", id,
+		"-x", strconv.Itoa(cfg.Cols), "-y", strconv.Itoa(cfg.Rows)}
+	if cfg.Cwd != "" {
+		cmd = append(cmd, "-c", tmuxArg(cfg.Cwd))
+	}
+	// Run the shell through env so variables apply to it alone, not to the
+	// tmux server other sessions share
+	cmd = append(cmd, "env", "TERM=xterm-256color")
+	keys := make([]string, 0, len(cfg.Env))
+	for key := range cfg.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cmd = append(cmd, tmuxArg(key+"="+cfg.Env[key]))
+	}
+	cmd = append(cmd, cfg.Shell)
+	// Session metadata lives in tmux user options, so any replica can list it
+	cmd = append(cmd,
+		";", "set-option", "-t", "="+id, "@rexec_shell", cfg.Shell,
+		";", "set-option", "-t", "="+id, "@rexec_name", tmuxArg(cfg.Name),
+	)
+
+	if _, err := m.ExecOutput(ctx, dockerID, cmd); err != nil {
+		return nil, err
+	}
+	return m.GetPTYSession(ctx, dockerID, id)
+}
+
+// KillPTYSession ends a named session and every process in it
+func (m *Manager) KillPTYSession(ctx context.Context, dockerID, id string) error {
+	if !IsPTYSessionID(id) {
+		return ErrPTYSessionNotFound
+	}
+	if _, err := m.ExecOutput(ctx, dockerID, []string{"tmux", "kill-session", "-t", "=" + id}); err != nil {
+		if strings.Contains(err.Error(), "can't find session") || strings.Contains(err.Error(), "no server running") {
+			return ErrPTYSessionNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// tmuxArg escapes a trailing semicolon, which tmux would otherwise take as
+// the end of a command
+func tmuxArg(arg string) string {
+	if strings.HasSuffix(arg, ";") {
+		return arg[:len(arg)-1] + `\;`
+	}
+	return arg
+}
+
+// hasTmux reports whether tmux is installed in the container
+func (m *Manager) hasTmux(ctx context.Context, dockerID string) bool {
+	_, err := m.ExecOutput(ctx, dockerID, []string{"/bin/sh", "-c", "command -v tmux"})
+	return err == nil
+}
+
+// parsePTYSessions parses ptySessionFormat lines, keeping only named sessions
+func parsePTYSessions(output string) []*PTYSession {
+	sessions := []*PTYSession{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 || !IsPTYSessionID(fields[0]) {
+			continue
+		}
+		s := &PTYSession{
+			ID:    fields[0],
+			Cwd:   fields[5],
+			Shell: fields[6],
+			Name:  fields[7],
+		}
+		if created, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			s.CreatedAt = time.Unix(created, 0).UTC()
+		}
+		s.Cols, _ = strconv.Atoi(fields[2])
+		s.Rows, _ = strconv.Atoi(fields[3])
+		s.Clients, _ = strconv.Atoi(fields[4])
+		sessions = append(sessions, s)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
@@ -0,0 +1,156 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestParsePTYSessions(t *testing.T) {
+	output := strings.Join([]string{
+		"main\t1700000000\t80\t24\t1\t/root\t\t",
+		"tab-0123456789ab\t1700000200\t120\t40\t0\t/srv/app\t/bin/bash\tbuild",
+		"tab-aaaaaaaaaaaa\t1700000100\t80\t24\t2\t/root\t/bin/zsh\t",
+		"split-1700000000\t1700000000\t80\t24\t1\t/root\t\t",
+		"",
+	}, "\n")
+
+	sessions := parsePTYSessions(output)
+	if len(sessions) != 2 {
+		t.Fatalf("parsePTYSessions() returned %d sessions, want 2", len(sessions))
+	}
+	if sessions[0].ID != "tab-aaaaaaaaaaaa" || sessions[1].ID != "tab-0123456789ab" {
+		t.Errorf("sessions not sorted by creation: %s, %s", sessions[0].ID, sessions[1].ID)
+	}
+	got := sessions[1]
+	want := PTYSession{
+		ID:        "tab-0123456789ab",
+		Name:      "build",
+		Shell:     "/bin/bash",
+		Cwd:       "/srv/app",
+		Cols:      120,
+		Rows:      40,
+		CreatedAt: time.Unix(1700000200, 0).UTC(),
+	}
+	if *got != want {
+		t.Errorf("parsePTYSessions() = %+v, want %+v", *got, want)
+	}
+	if sessions[0].Clients != 2 {
+		t.Errorf("Clients = %d, want 2", sessions[0].Clients)
+	}
+}
+
+func TestPTYSessionConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     PTYSessionConfig
+		wantErr bool
+	}{
+		{"Defaults", PTYSessionConfig{}, false},
+		{"Full", PTYSessionConfig{Name: "logs", Shell: "/bin/bash", Cwd: "/var/log", Env: map[string]string{"FOO": "bar"}, Cols: 200, Rows: 50}, false},
+		{"Relative shell", PTYSessionConfig{Shell: "bash"}, true},
+		{"Shell with arguments", PTYSessionConfig{Shell: "/bin/sh -c id"}, true},
+		{"Relative cwd", PTYSessionConfig{Cwd: "app"}, true},
+		{"Bad env name", PTYSessionConfig{Env: map[string]string{"FOO-BAR": "x"}}, true},
+		{"Name with tab", PTYSessionConfig{Name: "a\tb"}, true},
+		{"Too wide", PTYSessionConfig{Cols: 1000}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (cfg.Shell == "" || cfg.Cols == 0 || cfg.Rows == 0) {
+				t.Errorf("Validate() left defaults unset: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestManager_CreatePTYSession(t *testing.T) {
+	var mu sync.Mutex
+	var cmds [][]string
+	mockClient := &MockDockerClient{}
+	mockClient.ContainerExecCreateFunc = func(ctx context.Context, id string, config container.ExecOptions) (types.IDResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds = append(cmds, config.Cmd)
+		return types.IDResponse{ID: config.Cmd[0]}, nil
+	}
+	mockClient.ContainerExecAttachFunc = func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		last := cmds[len(cmds)-1]
+		if len(last) == 5 && last[4] == ptySessionFormat {
+			// Report the session that was just created
+			var id string
+			for _, cmd := range cmds {
+				if cmd[0] == "tmux" {
+					id = cmd[4]
+				}
+			}
+			return execStream(id + "\t1700000000\t100\t30\t0\t/srv\t/bin/bash\tbuild;\n"), nil
+		}
+		return execStream(""), nil
+	}
+	mockClient.ContainerExecInspectFunc = func(ctx context.Context, execID string) (container.ExecInspect, error) {
+		return container.ExecInspect{}, nil
+	}
+	manager := &Manager{client: mockClient}
+
+	session, err := manager.CreatePTYSession(context.Background(), "abc", PTYSessionConfig{
+		Name:  "build;",
+		Shell: "/bin/bash",
+		Cwd:   "/srv",
+		Env:   map[string]string{"B": "2", "A": "1"},
+		Cols:  100,
+		Rows:  30,
+	})
+	if err != nil {
+		t.Fatalf("CreatePTYSession() error = %v", err)
+	}
+	if !IsPTYSessionID(session.ID) || session.Name != "build;" || session.Cols != 100 {
+		t.Errorf("CreatePTYSession() = %+v", session)
+	}
+
+	var create []string
+	for _, cmd := range cmds {
+		if cmd[0] == "tmux" {
+			create = cmd
+		}
+	}
+	want := []string{"tmux", "new-session", "-d", "-s", session.ID, "-x", "100", "-y", "30", "-c", "/srv",
+		"env", "TERM=xterm-256color", "A=1", "B=2", "/bin/bash",
+		";", "set-option", "-t", "=" + session.ID, "@rexec_shell", "/bin/bash",
+		";", "set-option", "-t", "=" + session.ID, "@rexec_name", `build\;`}
+	if strings.Join(create, " ") != strings.Join(want, " ") {
+		t.Errorf("tmux command = %q\nwant %q", create, want)
+	}
+}
+
+func TestIsPTYSessionID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"tab-0123456789ab", true},
+		{"main", false},
+		{"split-1700000000", false},
+		{"tab-xyz", false},
+		{"tab-0123456789abcd", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPTYSessionID(tt.id); got != tt.want {
+			t.Errorf("IsPTYSessionID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/client"
 	"github.com/rexec/rexec/internal/storage"
 )
@@ -13,17 +14,41 @@ import (
 // ContainerStore defines the storage interface needed by the reconciler
 type ContainerStore interface {
 	GetAllContainers(ctx context.Context) ([]*storage.ContainerRecord, error)
+	GetContainerByDockerID(ctx context.Context, dockerID string) (*storage.ContainerRecord, error)
 	UpdateContainerStatus(ctx context.Context, id, status string) error
 	DeleteContainer(ctx context.Context, id string) error
+	CountContainersByImage(ctx context.Context, image string) (int64, error)
 }
 
-// ReconcilerService syncs database state with actual Docker container state
+// destroyGracePeriod is how long after a container is destroyed its terminal
+// is deleted if the record still points at it. Rexec destroys containers
+// itself when recreating them, and only records the new one afterwards.
+const destroyGracePeriod = 30 * time.Second
+
+// reconcilerEvents are the Docker events that change a terminal's status
+var reconcilerEvents = []events.Action{
+	events.ActionStart,
+	events.ActionStop,
+	events.ActionDie,
+	events.ActionDestroy,
+	events.ActionOOM,
+	events.ActionPause,
+	events.ActionUnPause,
+}
+
+// ReconcilerService syncs database state with actual Docker container state.
+// Container events are applied as they arrive; a full resync runs every
+// check interval and whenever the event stream reconnects, to catch anything
+// missed.
 type ReconcilerService struct {
 	manager       *Manager
 	store         ContainerStore
 	dockerClient  client.CommonAPIClient
 	checkInterval time.Duration
+	destroyGrace  time.Duration
 	stopChan      chan struct{}
+	resync        chan struct{}
+	onChange      func(record *storage.ContainerRecord, status string)
 }
 
 // NewReconcilerService creates a new reconciler service
@@ -33,17 +58,27 @@ func NewReconcilerService(manager *Manager, store ContainerStore, checkInterval
 		store:         store,
 		dockerClient:  manager.client,
 		checkInterval: checkInterval,
+		destroyGrace:  destroyGracePeriod,
 		stopChan:      make(chan struct{}),
+		resync:        make(chan struct{}, 1),
 	}
 }
 
+// SetChangeHook sets a callback run after the reconciler changes a
+// terminal's status to match Docker. status is "deleted" once the terminal's
+// record has been removed.
+func (r *ReconcilerService) SetChangeHook(fn func(record *storage.ContainerRecord, status string)) {
+	r.onChange = fn
+}
+
 // Start begins the reconciler service
 func (r *ReconcilerService) Start() {
 	// Run once immediately on startup
 	r.reconcile()
 
 	go r.run()
-	log.Printf("🔄 Reconciler service started (check interval: %v)", r.checkInterval)
+	go r.watch()
+	log.Printf("🔄 Reconciler service started (resync interval: %v)", r.checkInterval)
 }
 
 // Stop stops the reconciler service
@@ -61,12 +96,119 @@ func (r *ReconcilerService) run() {
 		select {
 		case <-ticker.C:
 			r.reconcile()
+		case <-r.resync:
+			r.reconcile()
 		case <-r.stopChan:
 			return
 		}
 	}
 }
 
+// watch applies container events until the reconciler is stopped
+func (r *ReconcilerService) watch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-r.stopChan
+		cancel()
+	}()
+
+	r.manager.watchEvents(ctx, reconcilerEvents, func(msg events.Message) {
+		r.handleEvent(ctx, msg)
+	}, func() {
+		select {
+		case r.resync <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// handleEvent brings a terminal's tracked and stored status in line with a
+// container event
+func (r *ReconcilerService) handleEvent(ctx context.Context, msg events.Message) {
+	dockerID := msg.Actor.ID
+	var status string
+	switch msg.Action {
+	case events.ActionStart, events.ActionUnPause:
+		status = "running"
+	case events.ActionStop, events.ActionDie:
+		status = "stopped"
+	case events.ActionPause:
+		status = "paused"
+	case events.ActionDestroy:
+		time.AfterFunc(r.destroyGrace, func() { r.destroyed(dockerID) })
+		return
+	case events.ActionOOM:
+		// The container only stops if its main process was killed
+		inspect, err := r.dockerClient.ContainerInspect(ctx, dockerID)
+		if err != nil || inspect.ContainerJSONBase == nil || inspect.State == nil {
+			return
+		}
+		status = mapDockerState(inspect.State.Status)
+	default:
+		return
+	}
+
+	// Unclaimed warm pool members and deleted terminals have no record
+	record, err := r.store.GetContainerByDockerID(ctx, dockerID)
+	if err != nil || record == nil {
+		return
+	}
+	// Terminals still being set up are left to the creation flow
+	if record.Status == "creating" || record.Status == "configuring" {
+		return
+	}
+
+	r.manager.UpdateContainerStatus(dockerID, status)
+	if msg.Action == events.ActionStart {
+		// Docker restarts crashed terminals itself, without their egress rules
+		go r.manager.reapplyNetworkPolicy(ctx, dockerID)
+	}
+	if record.Status == status {
+		return
+	}
+	if err := r.store.UpdateContainerStatus(ctx, record.ID, status); err != nil {
+		log.Printf("🔄 Reconciler: failed to update status for %s: %v", record.ID, err)
+		return
+	}
+	r.changed(record, status)
+}
+
+// destroyed deletes the terminal of a container that was removed outside
+// Rexec, once the grace period for recreated containers has passed
+func (r *ReconcilerService) destroyed(dockerID string) {
+	select {
+	case <-r.stopChan:
+		return
+	default:
+	}
+
+	ctx := context.Background()
+	record, err := r.store.GetContainerByDockerID(ctx, dockerID)
+	if err != nil || record == nil {
+		return
+	}
+	if _, err := r.dockerClient.ContainerInspect(ctx, dockerID); !client.IsErrNotFound(err) {
+		return
+	}
+	if err := r.store.DeleteContainer(ctx, record.ID); err != nil {
+		log.Printf("🔄 Reconciler: failed to soft-delete removed container %s: %v", record.ID, err)
+		return
+	}
+	r.manager.RemoveFromTracking(dockerID)
+	if err := r.manager.ReleaseForkImage(ctx, r.store, record.Image); err != nil {
+		log.Printf("🔄 Reconciler: failed to remove fork image of %s: %v", record.ID, err)
+	}
+	log.Printf("🔄 Reconciler: container %s was removed from Docker, deleted %s", dockerID[:min(12, len(dockerID))], record.ID)
+	r.changed(record, "deleted")
+}
+
+// changed runs the change hook
+func (r *ReconcilerService) changed(record *storage.ContainerRecord, status string) {
+	if r.onChange != nil {
+		r.onChange(record, status)
+	}
+}
+
 // reconcile checks all containers in the database and syncs their status with Docker
 func (r *ReconcilerService) reconcile() {
 	ctx := context.Background()
@@ -77,6 +219,8 @@ func (r *ReconcilerService) reconcile() {
 		log.Printf("🔄 Reconciler: failed to get containers from database: %v", err)
 		return
 	}
+	// Terminals deleted below or since the last resync may leave fork images
+	defer r.manager.PruneForkImages(ctx, r.store)
 
 	if len(dbContainers) == 0 {
 		return
@@ -91,9 +235,13 @@ func (r *ReconcilerService) reconcile() {
 		return
 	}
 
-	// Build a map of Docker container IDs to their state
+	// Build a map of Docker container IDs to their state. Unclaimed warm pool
+	// members are left to the pool.
 	dockerState := make(map[string]string)
 	for _, dc := range dockerContainers {
+		if isUnclaimedPoolMember(r.manager.claimedLabels(dc.ID, dc.Labels)) {
+			continue
+		}
 		dockerState[dc.ID] = dc.State
 	}
 
@@ -117,6 +265,7 @@ func (r *ReconcilerService) reconcile() {
 					} else {
 						log.Printf("🔄 Reconciler: auto-deleted error container %s (no Docker ID, age: %v)", dbContainer.ID, timeSinceUpdate.Round(time.Second))
 						removed++
+						r.changed(dbContainer, "deleted")
 					}
 				}
 			} else if dbContainer.Status != "deleted" {
@@ -129,6 +278,7 @@ func (r *ReconcilerService) reconcile() {
 					log.Printf("🔄 Reconciler: failed to soft-delete orphaned container %s: %v", dbContainer.ID, err)
 				} else {
 					removed++
+					r.changed(dbContainer, "deleted")
 				}
 			}
 			continue
@@ -143,6 +293,7 @@ func (r *ReconcilerService) reconcile() {
 				log.Printf("🔄 Reconciler: failed to soft-delete missing container %s: %v", dbContainer.ID, err)
 			} else {
 				removed++
+				r.changed(dbContainer, "deleted")
 			}
 			// Remove from manager's tracking
 			r.manager.RemoveFromTracking(dbContainer.DockerID)
@@ -166,6 +317,7 @@ func (r *ReconcilerService) reconcile() {
 						log.Printf("🔄 Reconciler: failed to update status for stuck container %s: %v", dbContainer.ID, err)
 					} else {
 						updated++
+						r.changed(dbContainer, "running")
 					}
 					r.manager.UpdateContainerStatus(dbContainer.DockerID, "running")
 					continue
@@ -189,6 +341,7 @@ func (r *ReconcilerService) reconcile() {
 					log.Printf("🔄 Reconciler: failed to update status for stuck container %s: %v", dbContainer.ID, err)
 				} else {
 					stuckStopped++
+					r.changed(dbContainer, newStatus)
 				}
 
 				// Update in-memory state
@@ -203,6 +356,7 @@ func (r *ReconcilerService) reconcile() {
 				log.Printf("🔄 Reconciler: failed to update status for %s: %v", dbContainer.ID, err)
 			} else {
 				updated++
+				r.changed(dbContainer, newStatus)
 			}
 
 			// Also update in-memory state
@@ -2,19 +2,27 @@ package container
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/rexec/rexec/internal/models"
 	"github.com/rexec/rexec/internal/storage"
 )
 
 // MockContainerStore implements ContainerStore for testing
 type MockContainerStore struct {
-	GetAllContainersFunc      func(ctx context.Context) ([]*storage.ContainerRecord, error)
-	UpdateContainerStatusFunc func(ctx context.Context, id, status string) error
-	DeleteContainerFunc       func(ctx context.Context, id string) error
+	GetAllContainersFunc       func(ctx context.Context) ([]*storage.ContainerRecord, error)
+	GetContainerByDockerIDFunc func(ctx context.Context, dockerID string) (*storage.ContainerRecord, error)
+	UpdateContainerStatusFunc  func(ctx context.Context, id, status string) error
+	DeleteContainerFunc        func(ctx context.Context, id string) error
+	CountContainersByImageFunc func(ctx context.Context, image string) (int64, error)
 }
 
 func (m *MockContainerStore) GetAllContainers(ctx context.Context) ([]*storage.ContainerRecord, error) {
@@ -24,6 +32,13 @@ func (m *MockContainerStore) GetAllContainers(ctx context.Context) ([]*storage.C
 	return []*storage.ContainerRecord{}, nil
 }
 
+func (m *MockContainerStore) GetContainerByDockerID(ctx context.Context, dockerID string) (*storage.ContainerRecord, error) {
+	if m.GetContainerByDockerIDFunc != nil {
+		return m.GetContainerByDockerIDFunc(ctx, dockerID)
+	}
+	return nil, nil
+}
+
 func (m *MockContainerStore) UpdateContainerStatus(ctx context.Context, id, status string) error {
 	if m.UpdateContainerStatusFunc != nil {
 		return m.UpdateContainerStatusFunc(ctx, id, status)
@@ -38,6 +53,13 @@ func (m *MockContainerStore) DeleteContainer(ctx context.Context, id string) err
 	return nil
 }
 
+func (m *MockContainerStore) CountContainersByImage(ctx context.Context, image string) (int64, error) {
+	if m.CountContainersByImageFunc != nil {
+		return m.CountContainersByImageFunc(ctx, image)
+	}
+	return 0, nil
+}
+
 func TestReconcilerService_Reconcile(t *testing.T) {
 	// Setup mock client
 	mockClient := &MockDockerClient{}
@@ -186,6 +208,132 @@ func TestReconcilerService_Reconcile(t *testing.T) {
 	})
 }
 
+func TestReconcilerService_HandleEvent(t *testing.T) {
+	ctx := context.Background()
+	dockerID := "docker-id-event-0001"
+
+	tests := []struct {
+		name       string
+		action     events.Action
+		dbStatus   string
+		wantStatus string // stored and notified; empty if nothing changes
+		wantInfo   string // tracked status afterwards
+	}{
+		{"Die stops a running terminal", events.ActionDie, "running", "stopped", "stopped"},
+		{"Start runs a stopped terminal", events.ActionStart, "stopped", "running", "running"},
+		{"Pause", events.ActionPause, "running", "paused", "paused"},
+		{"Unpause", events.ActionUnPause, "paused", "running", "running"},
+		{"Unchanged status isn't stored again", events.ActionStop, "stopped", "", "stopped"},
+		{"Terminals being set up are left alone", events.ActionStart, "configuring", "", "configuring"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockDockerClient{}
+			manager := newPauseTestManager(mockClient)
+			manager.containers[dockerID] = &ContainerInfo{ID: dockerID, Status: tt.dbStatus}
+			var stored, notified string
+			store := &MockContainerStore{
+				GetContainerByDockerIDFunc: func(ctx context.Context, id string) (*storage.ContainerRecord, error) {
+					return &storage.ContainerRecord{ID: "db-id", DockerID: id, Status: tt.dbStatus}, nil
+				},
+				UpdateContainerStatusFunc: func(ctx context.Context, id, status string) error {
+					stored = status
+					return nil
+				},
+			}
+			r := NewReconcilerService(manager, store, time.Hour)
+			r.SetChangeHook(func(record *storage.ContainerRecord, status string) { notified = status })
+
+			r.handleEvent(ctx, events.Message{Action: tt.action, Actor: events.Actor{ID: dockerID}})
+
+			if stored != tt.wantStatus || notified != tt.wantStatus {
+				t.Errorf("stored %q, notified %q; want %q", stored, notified, tt.wantStatus)
+			}
+			if got := manager.containers[dockerID].Status; got != tt.wantInfo {
+				t.Errorf("tracked status = %q, want %q", got, tt.wantInfo)
+			}
+		})
+	}
+}
+
+func TestReconcilerService_HandleEvent_ReappliesEgress(t *testing.T) {
+	dockerID := "docker-id-restarted-01"
+	mockClient := &MockDockerClient{}
+	manager := newPauseTestManager(mockClient)
+	manager.containers[dockerID] = &ContainerInfo{ID: dockerID, Status: "stopped", Labels: map[string]string{"rexec.tier": "free"}}
+	manager.trackEgressPolicy(dockerID, &models.EgressPolicy{Mode: models.EgressNone})
+
+	helper := make(chan string, 1)
+	mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+		helper <- string(hostConfig.NetworkMode)
+		return container.CreateResponse{ID: "helper"}, nil
+	}
+	store := &MockContainerStore{
+		GetContainerByDockerIDFunc: func(ctx context.Context, id string) (*storage.ContainerRecord, error) {
+			return &storage.ContainerRecord{ID: "db-id", DockerID: id, Status: "stopped"}, nil
+		},
+	}
+	r := NewReconcilerService(manager, store, time.Hour)
+
+	// A die followed by a start is Docker's restart policy at work
+	r.handleEvent(context.Background(), events.Message{Action: events.ActionDie, Actor: events.Actor{ID: dockerID}})
+	r.handleEvent(context.Background(), events.Message{Action: events.ActionStart, Actor: events.Actor{ID: dockerID}})
+
+	select {
+	case mode := <-helper:
+		if mode != "container:"+dockerID {
+			t.Errorf("network helper joined %q, want the restarted container", mode)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("egress policy wasn't reapplied after the restart")
+	}
+}
+
+func TestReconcilerService_Destroyed(t *testing.T) {
+	dockerID := "docker-id-destroyed-01"
+	mockClient := &MockDockerClient{}
+	manager := newPauseTestManager(mockClient)
+	manager.containers[dockerID] = &ContainerInfo{ID: dockerID, UserID: "user-1", Status: "running"}
+	manager.userIndex["user-1"] = []string{dockerID}
+
+	recordDockerID := dockerID
+	var deleted, notified string
+	store := &MockContainerStore{
+		GetContainerByDockerIDFunc: func(ctx context.Context, id string) (*storage.ContainerRecord, error) {
+			if id != recordDockerID {
+				return nil, nil
+			}
+			return &storage.ContainerRecord{ID: "db-id", DockerID: id, Status: "running"}, nil
+		},
+		DeleteContainerFunc: func(ctx context.Context, id string) error {
+			deleted = id
+			return nil
+		},
+	}
+	r := NewReconcilerService(manager, store, time.Hour)
+	r.SetChangeHook(func(record *storage.ContainerRecord, status string) { notified = status })
+	mockClient.ContainerInspectFunc = func(ctx context.Context, id string) (types.ContainerJSON, error) {
+		return types.ContainerJSON{}, errdefs.NotFound(fmt.Errorf("no such container: %s", id))
+	}
+
+	// A terminal recreated within the grace period points at its new container
+	recordDockerID = "docker-id-recreated-01"
+	r.destroyed(dockerID)
+	if deleted != "" {
+		t.Fatalf("deleted %s, want a recreated terminal kept", deleted)
+	}
+
+	recordDockerID = dockerID
+	r.destroyed(dockerID)
+	if deleted != "db-id" || notified != "deleted" {
+		t.Errorf("deleted %q, notified %q; want db-id deleted", deleted, notified)
+	}
+	if _, ok := manager.containers[dockerID]; ok {
+		t.Error("a destroyed container should no longer be tracked")
+	}
+}
+
 func TestMapDockerState(t *testing.T) {
 	tests := []struct {
 		dockerState string
@@ -0,0 +1,313 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// registryTokenTTL is assumed for exchanged tokens that don't say when they expire
+const registryTokenTTL = time.Hour
+
+// registryTokenMargin renews exchanged tokens this long before they expire,
+// so a token can't run out in the middle of a pull
+const registryTokenMargin = 5 * time.Minute
+
+// ecrGetAuthorizationToken is the X-Amz-Target of ECR's GetAuthorizationToken action
+const ecrGetAuthorizationToken = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+
+// RegistryCredentialStore looks up a user's credential for a registry host
+type RegistryCredentialStore interface {
+	GetRegistryCredentialForHost(ctx context.Context, userID, registry string) (*models.RegistryCredential, error)
+}
+
+// RegistryAuth resolves the registry auth Docker needs to pull a user's
+// custom images
+type RegistryAuth struct {
+	store  RegistryCredentialStore
+	client *http.Client
+
+	// ecrEndpoint returns the ECR API URL for a registry host
+	ecrEndpoint func(host string) string
+
+	mu     sync.Mutex
+	tokens map[string]registryToken // credential ID -> exchanged token
+}
+
+// registryToken is a short-lived password from a token endpoint
+type registryToken struct {
+	username  string
+	password  string
+	version   time.Time // UpdatedAt of the credential it was exchanged with
+	expiresAt time.Time
+}
+
+// NewRegistryAuth creates a RegistryAuth backed by store
+func NewRegistryAuth(store RegistryCredentialStore) *RegistryAuth {
+	return &RegistryAuth{
+		store:       store,
+		client:      newPublicHTTPClient(15 * time.Second),
+		ecrEndpoint: ecrAPIEndpoint,
+		tokens:      make(map[string]registryToken),
+	}
+}
+
+// ecrAPIEndpoint returns the regional ECR API URL for a private ECR registry host
+func ecrAPIEndpoint(host string) string {
+	region, _ := models.ECRRegion(host)
+	domain := "amazonaws.com"
+	if strings.HasSuffix(host, ".cn") {
+		domain = "amazonaws.com.cn"
+	}
+	if strings.Contains(host, ".dkr.ecr-fips.") {
+		return "https://ecr-fips." + region + "." + domain + "/"
+	}
+	return "https://api.ecr." + region + "." + domain + "/"
+}
+
+// newPublicHTTPClient returns a client that only connects to public
+// addresses, redirects included, for URLs supplied by users
+func newPublicHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would connect on our behalf, unchecked
+	transport.DialContext = dialPublic
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// dialPublic connects to addr after checking that its host resolves to
+// public addresses only, dialing those addresses so a second lookup can't
+// return different ones
+func dialPublic(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := models.ResolvePublicHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// EncodedAuth returns the X-Registry-Auth value for userID pulling imageRef,
+// or "" if they have no credential for its registry. It is nil-safe.
+func (r *RegistryAuth) EncodedAuth(ctx context.Context, userID, imageRef string) (string, error) {
+	if r == nil || userID == "" {
+		return "", nil
+	}
+
+	host := models.RegistryHost(imageRef)
+	cred, err := r.store.GetRegistryCredentialForHost(ctx, userID, host)
+	if err != nil {
+		return "", err
+	}
+	if cred == nil {
+		return "", nil
+	}
+
+	username, password := cred.Username, cred.Secret
+	if cred.Kind == models.RegistryKindToken || cred.Kind == models.RegistryKindECR {
+		token, err := r.token(ctx, cred)
+		if err != nil {
+			return "", err
+		}
+		username, password = token.username, token.password
+	}
+
+	server := host
+	if host == models.DockerHubRegistry {
+		server = "https://index.docker.io/v1/"
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: server,
+	})
+}
+
+// token returns a cached token for cred, exchanging a new one when it's
+// about to expire or the credential has changed
+func (r *RegistryAuth) token(ctx context.Context, cred *models.RegistryCredential) (registryToken, error) {
+	r.mu.Lock()
+	cached, ok := r.tokens[cred.ID]
+	r.mu.Unlock()
+	if ok && cached.version.Equal(cred.UpdatedAt) && time.Until(cached.expiresAt) > registryTokenMargin {
+		return cached, nil
+	}
+
+	exchange := r.exchange
+	if cred.Kind == models.RegistryKindECR {
+		exchange = r.exchangeECR
+	}
+	token, err := exchange(ctx, cred)
+	if err != nil {
+		return registryToken{}, err
+	}
+	token.version = cred.UpdatedAt
+
+	r.mu.Lock()
+	r.tokens[cred.ID] = token
+	r.mu.Unlock()
+	return token, nil
+}
+
+// tokenResponse accepts both ECR's GetAuthorizationToken output, which a token
+// service may pass on as is, and a plain {username, password|token, expires_in}
+// document
+type tokenResponse struct {
+	AuthorizationData []struct {
+		AuthorizationToken string          `json:"authorizationToken"` // base64 "user:password"
+		ExpiresAt          json.RawMessage `json:"expiresAt"`          // epoch seconds or RFC 3339
+	} `json:"authorizationData"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Token     string `json:"token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// exchange fetches a short-lived registry password from cred's token endpoint.
+// The endpoint gets the stored secret as basic auth with the stored username,
+// or as a bearer token without one.
+func (r *RegistryAuth) exchange(ctx context.Context, cred *models.RegistryCredential) (registryToken, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cred.TokenURL, nil)
+	if err != nil {
+		return registryToken{}, fmt.Errorf("invalid token URL: %w", err)
+	}
+	if cred.Username != "" {
+		req.SetBasicAuth(cred.Username, cred.Secret)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+cred.Secret)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return registryToken{}, fmt.Errorf("token endpoint for %s unreachable: %w", cred.Registry, err)
+	}
+	defer resp.Body.Close()
+	// The body isn't included in errors; the endpoint is user supplied
+	if resp.StatusCode != http.StatusOK {
+		return registryToken{}, fmt.Errorf("token endpoint for %s returned %d", cred.Registry, resp.StatusCode)
+	}
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body); err != nil {
+		return registryToken{}, fmt.Errorf("token endpoint for %s returned invalid JSON", cred.Registry)
+	}
+	return parseTokenResponse(&body, cred.Username, time.Now())
+}
+
+// exchangeECR calls ECR's GetAuthorizationToken, signed with cred's access key,
+// for a registry password that lasts 12 hours
+func (r *RegistryAuth) exchangeECR(ctx context.Context, cred *models.RegistryCredential) (registryToken, error) {
+	region, ok := models.ECRRegion(cred.Registry)
+	if !ok {
+		return registryToken{}, fmt.Errorf("%s is not an ECR registry", cred.Registry)
+	}
+	payload := []byte("{}")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.ecrEndpoint(cred.Registry), bytes.NewReader(payload))
+	if err != nil {
+		return registryToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecrGetAuthorizationToken)
+
+	hash := sha256.Sum256(payload)
+	creds := aws.Credentials{AccessKeyID: cred.Username, SecretAccessKey: cred.Secret}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "ecr", region, time.Now()); err != nil {
+		return registryToken{}, fmt.Errorf("failed to sign ECR request: %w", err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return registryToken{}, fmt.Errorf("ECR in %s unreachable: %w", region, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return registryToken{}, fmt.Errorf("ECR refused the access key for %s (%d)", cred.Registry, resp.StatusCode)
+	}
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body); err != nil || len(body.AuthorizationData) == 0 {
+		return registryToken{}, fmt.Errorf("ECR returned no authorization token for %s", cred.Registry)
+	}
+	return parseTokenResponse(&body, "", time.Now())
+}
+
+// parseTokenResponse extracts the registry login from a token endpoint's response
+func parseTokenResponse(body *tokenResponse, defaultUsername string, now time.Time) (registryToken, error) {
+	token := registryToken{expiresAt: now.Add(registryTokenTTL)}
+
+	if len(body.AuthorizationData) > 0 {
+		data := body.AuthorizationData[0]
+		decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+		if err != nil {
+			return registryToken{}, fmt.Errorf("invalid authorization token")
+		}
+		user, pass, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return registryToken{}, fmt.Errorf("invalid authorization token")
+		}
+		token.username, token.password = user, pass
+		if expiresAt, ok := parseExpiresAt(data.ExpiresAt); ok {
+			token.expiresAt = expiresAt
+		}
+	} else {
+		token.username, token.password = body.Username, body.Password
+		if token.password == "" {
+			token.password = body.Token
+		}
+		if token.username == "" {
+			token.username = defaultUsername
+		}
+		if body.ExpiresIn > 0 {
+			token.expiresAt = now.Add(time.Duration(body.ExpiresIn) * time.Second)
+		}
+	}
+
+	if token.username == "" || token.password == "" {
+		return registryToken{}, fmt.Errorf("token endpoint returned no username and password")
+	}
+	return token, nil
+}
+
+// parseExpiresAt reads ECR's expiresAt, which the API sends as epoch seconds
+// and the AWS CLI prints as a timestamp
+func parseExpiresAt(raw json.RawMessage) (time.Time, bool) {
+	if len(raw) == 0 {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.ParseFloat(string(raw), 64); err == nil {
+		return time.Unix(int64(seconds), 0), true
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
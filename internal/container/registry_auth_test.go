@@ -0,0 +1,271 @@
+package container
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/errdefs"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// fakeRegistryStore holds credentials by "userID/registry"
+type fakeRegistryStore map[string]*models.RegistryCredential
+
+func (s fakeRegistryStore) GetRegistryCredentialForHost(ctx context.Context, userID, registry string) (*models.RegistryCredential, error) {
+	return s[userID+"/"+registry], nil
+}
+
+func decodeAuth(t *testing.T, encoded string) registry.AuthConfig {
+	t.Helper()
+	cfg, err := registry.DecodeAuthConfig(encoded)
+	if err != nil {
+		t.Fatalf("DecodeAuthConfig() error = %v", err)
+	}
+	return *cfg
+}
+
+func TestRegistryAuth_EncodedAuth(t *testing.T) {
+	calls := 0
+	tokenServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ci" || pass != "endpoint-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authorizationData": []map[string]interface{}{{
+				"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:short-lived")),
+				"expiresAt":          time.Now().Add(12 * time.Hour).Unix(),
+			}},
+		})
+	}))
+	defer tokenServer.Close()
+
+	updated := time.Now()
+	store := fakeRegistryStore{
+		"u1/ghcr.io":           {ID: "c1", Registry: "ghcr.io", Kind: models.RegistryKindGHCR, Username: "octocat", Secret: "ghp_x"},
+		"u1/docker.io":         {ID: "c2", Registry: "docker.io", Kind: models.RegistryKindBasic, Username: "me", Secret: "pw"},
+		"u1/ecr.example.com":   {ID: "c3", Registry: "ecr.example.com", Kind: models.RegistryKindToken, Username: "ci", Secret: "endpoint-secret", TokenURL: tokenServer.URL, UpdatedAt: updated},
+		"u1/broken.example.io": {ID: "c4", Registry: "broken.example.io", Kind: models.RegistryKindToken, Username: "ci", Secret: "wrong", TokenURL: tokenServer.URL},
+	}
+	auth := NewRegistryAuth(store)
+	auth.client = tokenServer.Client()
+	ctx := context.Background()
+
+	encoded, err := auth.EncodedAuth(ctx, "u1", "ghcr.io/acme/base:latest")
+	if cfg := decodeAuth(t, encoded); err != nil || cfg.Username != "octocat" || cfg.Password != "ghp_x" || cfg.ServerAddress != "ghcr.io" {
+		t.Errorf("ghcr auth = %+v, %v", cfg, err)
+	}
+	encoded, _ = auth.EncodedAuth(ctx, "u1", "acme/private")
+	if cfg := decodeAuth(t, encoded); cfg.ServerAddress != "https://index.docker.io/v1/" {
+		t.Errorf("Docker Hub server address = %q", cfg.ServerAddress)
+	}
+
+	for i := 0; i < 2; i++ {
+		encoded, err = auth.EncodedAuth(ctx, "u1", "ecr.example.com/team/base:1")
+		if cfg := decodeAuth(t, encoded); err != nil || cfg.Username != "AWS" || cfg.Password != "short-lived" {
+			t.Errorf("token auth = %+v, %v", cfg, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("token endpoint called %d times, want 1 (cached)", calls)
+	}
+	// A changed credential exchanges a new token
+	store["u1/ecr.example.com"].UpdatedAt = updated.Add(time.Minute)
+	auth.EncodedAuth(ctx, "u1", "ecr.example.com/team/base:1")
+	if calls != 2 {
+		t.Errorf("token endpoint called %d times after an update, want 2", calls)
+	}
+
+	if _, err := auth.EncodedAuth(ctx, "u1", "broken.example.io/base"); err == nil {
+		t.Error("expected an error from a rejected token exchange")
+	}
+	if encoded, err := auth.EncodedAuth(ctx, "u2", "ghcr.io/acme/base"); encoded != "" || err != nil {
+		t.Errorf("user without credentials got %q, %v", encoded, err)
+	}
+	var nilAuth *RegistryAuth
+	if encoded, err := nilAuth.EncodedAuth(ctx, "u1", "ghcr.io/acme/base"); encoded != "" || err != nil {
+		t.Errorf("nil RegistryAuth got %q, %v", encoded, err)
+	}
+}
+
+func TestRegistryAuth_InternalTokenURL(t *testing.T) {
+	calls := 0
+	tokenServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer tokenServer.Close()
+
+	store := fakeRegistryStore{
+		"u1/ecr.example.com": {ID: "c1", Registry: "ecr.example.com", Kind: models.RegistryKindToken, Username: "ci", Secret: "s", TokenURL: tokenServer.URL},
+	}
+	if _, err := NewRegistryAuth(store).EncodedAuth(context.Background(), "u1", "ecr.example.com/app"); err == nil {
+		t.Error("EncodedAuth() exchanged a token with a loopback endpoint")
+	}
+	if calls != 0 {
+		t.Errorf("token endpoint was called %d times, want 0", calls)
+	}
+}
+
+func TestRegistryAuth_ECR(t *testing.T) {
+	const host = "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	ecrServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Amz-Target") != ecrGetAuthorizationToken {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIAEXAMPLE/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/ecr/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authorizationData": []map[string]interface{}{{
+				"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password")),
+				"expiresAt":          float64(time.Now().Add(12*time.Hour).Unix()) + 0.5,
+			}},
+		})
+	}))
+	defer ecrServer.Close()
+
+	store := fakeRegistryStore{
+		"u1/" + host: {ID: "c1", Registry: host, Kind: models.RegistryKindECR, Username: "AKIAEXAMPLE", Secret: "secret"},
+	}
+	auth := NewRegistryAuth(store)
+	auth.client = ecrServer.Client()
+	auth.ecrEndpoint = func(string) string { return ecrServer.URL }
+
+	encoded, err := auth.EncodedAuth(context.Background(), "u1", host+"/team/app:1")
+	if cfg := decodeAuth(t, encoded); err != nil || cfg.Username != "AWS" || cfg.Password != "ecr-password" || cfg.ServerAddress != host {
+		t.Errorf("ECR auth = %+v, %v", cfg, err)
+	}
+
+	for host, want := range map[string]string{
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com":          "https://api.ecr.us-east-1.amazonaws.com/",
+		"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com": "https://ecr-fips.us-gov-west-1.amazonaws.com/",
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn":      "https://api.ecr.cn-north-1.amazonaws.com.cn/",
+	} {
+		if got := ecrAPIEndpoint(host); got != want {
+			t.Errorf("ecrAPIEndpoint(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestParseTokenResponse(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ecrToken := base64.StdEncoding.EncodeToString([]byte("AWS:pw"))
+
+	tests := []struct {
+		name        string
+		body        string
+		wantUser    string
+		wantPass    string
+		wantExpires time.Time
+		wantErr     bool
+	}{
+		{"ECR epoch", `{"authorizationData":[{"authorizationToken":"` + ecrToken + `","expiresAt":1767268800}]}`, "AWS", "pw", time.Unix(1767268800, 0), false},
+		{"ECR timestamp", `{"authorizationData":[{"authorizationToken":"` + ecrToken + `","expiresAt":"2026-01-01T06:00:00Z"}]}`, "AWS", "pw", now.Add(6 * time.Hour), false},
+		{"Plain token", `{"token":"tok","expires_in":600}`, "ci", "tok", now.Add(10 * time.Minute), false},
+		{"Plain password", `{"username":"robot","password":"pw"}`, "robot", "pw", now.Add(registryTokenTTL), false},
+		{"Bad ECR token", `{"authorizationData":[{"authorizationToken":"not base64!"}]}`, "", "", time.Time{}, true},
+		{"Empty", `{}`, "", "", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body tokenResponse
+			if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseTokenResponse(&body, "ci", now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTokenResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.username != tt.wantUser || got.password != tt.wantPass || !got.expiresAt.Equal(tt.wantExpires)) {
+				t.Errorf("parseTokenResponse() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestPullCustomImage_RegistryAuth(t *testing.T) {
+	store := fakeRegistryStore{
+		"u1/ghcr.io": {ID: "c1", Registry: "ghcr.io", Kind: models.RegistryKindGHCR, Username: "octocat", Secret: "ghp_x"},
+	}
+	ctx := context.Background()
+
+	t.Run("Pull with credentials", func(t *testing.T) {
+		mockClient := &MockDockerClient{
+			ImageInspectWithRawFunc: func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+				return types.ImageInspect{}, nil, errdefs.NotFound(errors.New("no such image"))
+			},
+		}
+		var pulled image.PullOptions
+		mockClient.ImagePullFunc = func(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+			pulled = options
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		manager := newPauseTestManager(mockClient)
+		manager.SetRegistryAuth(NewRegistryAuth(store))
+
+		if err := manager.PullCustomImage(ctx, "u1", "ghcr.io/acme/base:latest"); err != nil {
+			t.Fatalf("PullCustomImage() error = %v", err)
+		}
+		if cfg := decodeAuth(t, pulled.RegistryAuth); cfg.Username != "octocat" {
+			t.Errorf("pulled with %+v, want octocat's credentials", cfg)
+		}
+	})
+
+	t.Run("Cached private image", func(t *testing.T) {
+		mockClient := &MockDockerClient{}
+		mockClient.DistributionInspectFunc = func(ctx context.Context, imageRef, encodedRegistryAuth string) (registry.DistributionInspect, error) {
+			if encodedRegistryAuth == "" {
+				return registry.DistributionInspect{}, errdefs.Unauthorized(errors.New("denied"))
+			}
+			return registry.DistributionInspect{}, nil
+		}
+		manager := newPauseTestManager(mockClient)
+		manager.SetRegistryAuth(NewRegistryAuth(store))
+
+		if err := manager.PullCustomImage(ctx, "u1", "ghcr.io/acme/base:latest"); err != nil {
+			t.Errorf("owner of the credentials was refused: %v", err)
+		}
+		if err := manager.PullCustomImage(ctx, "u2", "ghcr.io/acme/base:latest"); err == nil {
+			t.Error("user without credentials could use a cached private image")
+		}
+		if err := manager.PullCustomImage(ctx, "", "ghcr.io/acme/base:latest"); err != nil {
+			t.Errorf("system pulls shouldn't be checked: %v", err)
+		}
+	})
+
+	t.Run("Registry unreachable", func(t *testing.T) {
+		var digests []string
+		mockClient := &MockDockerClient{
+			ImageInspectWithRawFunc: func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+				return types.ImageInspect{RepoDigests: digests}, nil, nil
+			},
+			DistributionInspectFunc: func(ctx context.Context, imageRef, encodedRegistryAuth string) (registry.DistributionInspect, error) {
+				return registry.DistributionInspect{}, errors.New("dial tcp: i/o timeout")
+			},
+		}
+		manager := newPauseTestManager(mockClient)
+		if err := manager.PullCustomImage(ctx, "u2", "registry.internal:5000/base"); err != nil {
+			t.Errorf("an image that was never pulled shouldn't need its registry: %v", err)
+		}
+		digests = []string{"registry.internal:5000/base@sha256:abc"}
+		if err := manager.PullCustomImage(ctx, "u2", "registry.internal:5000/base"); err == nil {
+			t.Error("a pulled image was reused without checking access")
+		}
+	})
+}
@@ -10,7 +10,8 @@ type RoleInfo struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Icon        string   `json:"icon"`
-	Packages    []string `json:"packages"` // Generic package names
+	Packages    []string `json:"packages"`         // Generic package names
+	Custom      bool     `json:"custom,omitempty"` // User-defined; ID is the custom role's ID
 }
 
 // AvailableRoles returns the list of supported roles
@@ -553,6 +554,8 @@ autoload -Uz compinit && compinit
 unset PS1 # Ensure themes can set their own PS1
 source $ZSH/oh-my-zsh.sh
 
+%s
+
 alias ll='ls -alF --color=auto'
 alias ls='ls --color=auto'
 alias gs='git status'
@@ -1362,7 +1365,7 @@ if [ "%s" = "Vibe Coder" ]; then
 fi
 
 echo "[[REXEC_STATUS]]Setup complete."
-`, role.Name, packages, role.Name, role.Name, role.Name)
+`, role.Name, packages, zshIntegration, role.Name, role.Name, role.Name)
 
 	return script, nil
 }
@@ -0,0 +1,321 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/client"
+)
+
+// Container engines the manager can drive. Both are used through the Docker
+// API; Podman serves it on its own socket.
+const (
+	EngineDocker = "docker"
+	EnginePodman = "podman"
+)
+
+// RuntimeCapabilities is what the connected engine and OCI runtime can do.
+// Features that aren't supported are skipped or refused instead of failing
+// container creation.
+type RuntimeCapabilities struct {
+	DiskQuota    bool `json:"disk_quota"`    // storage-opt size on overlay
+	CPULimit     bool `json:"cpu_limit"`     // CFS quota
+	MemoryLimit  bool `json:"memory_limit"`  // hard memory limit
+	PidsLimit    bool `json:"pids_limit"`    // process count limit
+	Stats        bool `json:"stats"`         // per-container CPU and memory stats
+	Pause        bool `json:"pause"`         // cgroup freezer
+	Checkpoint   bool `json:"checkpoint"`    // CRIU checkpoint and restore
+	EgressPolicy bool `json:"egress_policy"` // iptables in the container's network namespace
+	Privileged   bool `json:"privileged"`    // privileged containers with /dev/kvm (macOS VMs)
+}
+
+// assumedCapabilities are used when the runtime wasn't detected, e.g. for a
+// Manager built in tests: a rootful Docker daemon with runc, no disk quotas
+var assumedCapabilities = RuntimeCapabilities{
+	CPULimit:     true,
+	MemoryLimit:  true,
+	PidsLimit:    true,
+	Stats:        true,
+	Pause:        true,
+	Checkpoint:   true,
+	EgressPolicy: true,
+	Privileged:   true,
+}
+
+// RuntimeInfo describes the engine the manager is connected to
+type RuntimeInfo struct {
+	Engine        string              `json:"engine"` // EngineDocker or EnginePodman
+	Version       string              `json:"version"`
+	Host          string              `json:"host,omitempty"`
+	OCIRuntime    string              `json:"oci_runtime"` // runtime containers run with
+	Rootless      bool                `json:"rootless"`
+	CgroupVersion string              `json:"cgroup_version,omitempty"`
+	StorageDriver string              `json:"storage_driver"`
+	Capabilities  RuntimeCapabilities `json:"capabilities"`
+
+	// requestedRuntime is OCI_RUNTIME; empty leaves the choice to the engine
+	requestedRuntime string
+}
+
+// Sandboxed reports whether containers run under gVisor or Kata, which have
+// their own kernel or network stack
+func (r RuntimeInfo) Sandboxed() bool {
+	return isSandboxedRuntime(r.OCIRuntime)
+}
+
+func isSandboxedRuntime(name string) bool {
+	return strings.HasPrefix(name, "runsc") || strings.HasPrefix(name, "kata")
+}
+
+// engineHost returns the API endpoint to connect to. DOCKER_HOST always wins.
+// With CONTAINER_RUNTIME=podman it falls back to a unix CONTAINER_HOST, then
+// the rootless Podman socket, then the rootful one.
+func engineHost() string {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return host
+	}
+	if os.Getenv("CONTAINER_RUNTIME") != EnginePodman {
+		return ""
+	}
+	if host := os.Getenv("CONTAINER_HOST"); strings.HasPrefix(host, "unix://") {
+		return host
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sock := filepath.Join(dir, "podman", "podman.sock")
+		if _, err := os.Stat(sock); err == nil {
+			return "unix://" + sock
+		}
+	}
+	return "unix:///run/podman/podman.sock"
+}
+
+// newEngineClient connects to the engine at engineHost
+func newEngineClient() (*client.Client, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if host := engineHost(); host != "" && os.Getenv("DOCKER_HOST") == "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// detectRuntime asks the engine what it is and what it supports. ociRuntime
+// is OCI_RUNTIME; it must be one of the engine's configured runtimes.
+func detectRuntime(ctx context.Context, cli client.CommonAPIClient, ociRuntime string) (*RuntimeInfo, error) {
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runtime info: %w", err)
+	}
+
+	rt := &RuntimeInfo{
+		Engine:           EngineDocker,
+		Version:          info.ServerVersion,
+		OCIRuntime:       ociRuntime,
+		CgroupVersion:    info.CgroupVersion,
+		StorageDriver:    info.Driver,
+		requestedRuntime: ociRuntime,
+	}
+	if os.Getenv("CONTAINER_RUNTIME") == EnginePodman {
+		rt.Engine = EnginePodman
+	}
+	if version, err := cli.ServerVersion(ctx); err == nil {
+		for _, component := range version.Components {
+			if strings.Contains(strings.ToLower(component.Name), "podman") {
+				rt.Engine = EnginePodman
+				rt.Version = component.Version
+			}
+		}
+	}
+	for _, opt := range info.SecurityOptions {
+		if opt == "name=rootless" {
+			rt.Rootless = true
+		}
+	}
+
+	if ociRuntime != "" && len(info.Runtimes) > 0 {
+		if _, ok := info.Runtimes[ociRuntime]; !ok {
+			available := make([]string, 0, len(info.Runtimes))
+			for name := range info.Runtimes {
+				available = append(available, name)
+			}
+			sort.Strings(available)
+			return nil, fmt.Errorf("OCI runtime %q is not configured on the %s engine (available: %s)",
+				ociRuntime, rt.Engine, strings.Join(available, ", "))
+		}
+	}
+	if rt.OCIRuntime == "" {
+		rt.OCIRuntime = info.DefaultRuntime
+	}
+	if rt.OCIRuntime == "" {
+		rt.OCIRuntime = "runc"
+	}
+
+	rt.Capabilities = runtimeCapabilities(info, rt)
+	return rt, nil
+}
+
+// runtimeCapabilities works out everything but disk quotas, which need a probe
+func runtimeCapabilities(info system.Info, rt *RuntimeInfo) RuntimeCapabilities {
+	// Rootless engines on cgroup v1 have no cgroups of their own to limit,
+	// freeze or read stats from
+	rootlessV1 := rt.Rootless && rt.CgroupVersion != "2"
+
+	return RuntimeCapabilities{
+		CPULimit:    info.CPUCfsQuota && !rootlessV1,
+		MemoryLimit: info.MemoryLimit && !rootlessV1,
+		PidsLimit:   info.PidsLimit && !rootlessV1,
+		Stats:       !rootlessV1,
+		Pause:       !rootlessV1,
+		// Podman only offers checkpoints through its own API, and Docker
+		// needs experimental mode and root for CRIU
+		Checkpoint: rt.Engine == EngineDocker && info.ExperimentalBuild && !rt.Rootless &&
+			!strings.HasPrefix(rt.OCIRuntime, "kata"),
+		// gVisor's netstack and Kata's VM both route packets around the
+		// namespace's iptables
+		EgressPolicy: !rt.Sandboxed(),
+		Privileged:   !rt.Rootless && !rt.Sandboxed(),
+	}
+}
+
+// diskQuotaCandidate reports whether disk quotas could work, and why not
+func diskQuotaCandidate(info system.Info, rt *RuntimeInfo) (bool, string) {
+	if rt.Rootless {
+		return false, "rootless engines can't set project quotas"
+	}
+	if strings.HasPrefix(rt.OCIRuntime, "runsc") {
+		return false, "gVisor doesn't support overlay quotas"
+	}
+	// Docker calls it overlay2, Podman overlay
+	if info.Driver != "overlay2" && info.Driver != "overlay" {
+		return false, fmt.Sprintf("storage driver is %s (not overlay2)", info.Driver)
+	}
+	for _, status := range info.DriverStatus {
+		if len(status) >= 2 && status[0] == "Backing Filesystem" && status[1] != "xfs" && status[1] != "ext4" {
+			return false, fmt.Sprintf("backing filesystem is %s (needs xfs or ext4)", status[1])
+		}
+	}
+	return true, ""
+}
+
+// RuntimeInfo returns the detected engine and its capabilities
+func (m *Manager) RuntimeInfo() RuntimeInfo {
+	m.runtimeMu.RLock()
+	defer m.runtimeMu.RUnlock()
+	if m.runtime == nil {
+		return RuntimeInfo{Engine: EngineDocker, OCIRuntime: "runc", Capabilities: assumedCapabilities}
+	}
+	return *m.runtime
+}
+
+// Capabilities returns what the connected runtime supports
+func (m *Manager) Capabilities() RuntimeCapabilities {
+	return m.RuntimeInfo().Capabilities
+}
+
+// ociRuntime is the runtime to request for new containers; empty uses the
+// engine's default, which for Podman is usually crun
+func (m *Manager) ociRuntime() string {
+	m.runtimeMu.RLock()
+	defer m.runtimeMu.RUnlock()
+	if m.runtime == nil {
+		return ""
+	}
+	return m.runtime.requestedRuntime
+}
+
+// probeDiskQuota checks whether disk quotas work by creating a test
+// container with a size limit, which is the only reliable check
+func (m *Manager) probeDiskQuota() {
+	defer close(m.quotaProbed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	info, err := m.client.Info(ctx)
+	if err != nil {
+		log.Printf("[DiskQuota] Failed to get runtime info: %v", err)
+		return
+	}
+	m.runtimeMu.RLock()
+	rt := *m.runtime
+	m.runtimeMu.RUnlock()
+
+	if ok, reason := diskQuotaCandidate(info, &rt); !ok {
+		log.Printf("[DiskQuota] %s - disk quotas disabled", reason)
+		return
+	}
+
+	testContainerName := fmt.Sprintf("rexec-quota-test-%d", time.Now().UnixNano())
+	resp, err := m.client.ContainerCreate(ctx,
+		&container.Config{Image: "alpine:latest", Cmd: []string{"true"}},
+		&container.HostConfig{
+			Runtime:    rt.requestedRuntime,
+			StorageOpt: map[string]string{"size": "100M"},
+			AutoRemove: true,
+		}, nil, nil, testContainerName)
+	if err != nil {
+		if strings.Contains(err.Error(), "storage-opt") || strings.Contains(err.Error(), "quota") {
+			log.Printf("[DiskQuota] Disk quotas not available: %v", err)
+		} else {
+			log.Printf("[DiskQuota] Test container creation failed (non-quota error): %v", err)
+		}
+		return
+	}
+	m.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+	log.Printf("[DiskQuota] Disk quotas are available and working")
+
+	m.runtimeMu.Lock()
+	m.runtime.Capabilities.DiskQuota = true
+	m.runtimeMu.Unlock()
+}
+
+// limitResources drops the limits the runtime can't enforce; the engine
+// would otherwise refuse to create or update the container
+func (c RuntimeCapabilities) limitResources(r *container.Resources) {
+	if !c.CPULimit {
+		r.CPUPeriod, r.CPUQuota, r.NanoCPUs = 0, 0, 0
+	}
+	if !c.MemoryLimit {
+		r.Memory, r.MemorySwap = 0, 0
+	}
+	if !c.PidsLimit {
+		r.PidsLimit = nil
+	}
+}
+
+// logRuntime reports the detected runtime and anything it can't do
+func logRuntime(rt *RuntimeInfo) {
+	mode := "rootful"
+	if rt.Rootless {
+		mode = "rootless"
+	}
+	log.Printf("[Container] Using %s %s (%s, OCI runtime: %s, storage: %s)", rt.Engine, rt.Version, mode, rt.OCIRuntime, rt.StorageDriver)
+
+	caps := rt.Capabilities
+	var missing []string
+	for name, ok := range map[string]bool{
+		"CPU limits":      caps.CPULimit,
+		"memory limits":   caps.MemoryLimit,
+		"process limits":  caps.PidsLimit,
+		"stats":           caps.Stats,
+		"pause":           caps.Pause,
+		"checkpoints":     caps.Checkpoint,
+		"egress policies": caps.EgressPolicy,
+		"macOS VMs":       caps.Privileged,
+	} {
+		if !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		log.Printf("[Container] WARNING: not supported by this runtime: %s", strings.Join(missing, ", "))
+	}
+}
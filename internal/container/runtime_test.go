@@ -0,0 +1,246 @@
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/system"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestDetectRuntime(t *testing.T) {
+	rootlessPodman := func(ctx context.Context) (system.Info, error) {
+		return system.Info{
+			ServerVersion:   "4.9.3",
+			Driver:          "overlay",
+			CgroupVersion:   "2",
+			DefaultRuntime:  "crun",
+			Runtimes:        map[string]system.RuntimeWithStatus{"crun": {}, "runsc": {}},
+			SecurityOptions: []string{"name=rootless", "name=seccomp,profile=default"},
+			CPUCfsQuota:     true,
+			MemoryLimit:     true,
+			PidsLimit:       true,
+		}, nil
+	}
+	podmanVersion := func(ctx context.Context) (types.Version, error) {
+		return types.Version{Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "4.9.3"}}}, nil
+	}
+
+	tests := []struct {
+		name       string
+		info       func(ctx context.Context) (system.Info, error)
+		version    func(ctx context.Context) (types.Version, error)
+		ociRuntime string
+		wantErr    bool
+		check      func(t *testing.T, rt *RuntimeInfo)
+	}{
+		{
+			name: "Rootful Docker",
+			check: func(t *testing.T, rt *RuntimeInfo) {
+				if rt.Engine != EngineDocker || rt.Rootless || rt.OCIRuntime != "runc" {
+					t.Errorf("rt = %+v", rt)
+				}
+				if !rt.Capabilities.Pause || !rt.Capabilities.EgressPolicy || !rt.Capabilities.Privileged {
+					t.Errorf("capabilities = %+v", rt.Capabilities)
+				}
+				if rt.Capabilities.Checkpoint {
+					t.Error("checkpoints need an experimental daemon")
+				}
+			},
+		},
+		{
+			name:    "Rootless Podman",
+			info:    rootlessPodman,
+			version: podmanVersion,
+			check: func(t *testing.T, rt *RuntimeInfo) {
+				if rt.Engine != EnginePodman || !rt.Rootless || rt.OCIRuntime != "crun" || rt.Version != "4.9.3" {
+					t.Errorf("rt = %+v", rt)
+				}
+				if rt.requestedRuntime != "" {
+					t.Errorf("requestedRuntime = %q, want engine default", rt.requestedRuntime)
+				}
+				caps := rt.Capabilities
+				if !caps.CPULimit || !caps.Pause || caps.Checkpoint || caps.Privileged {
+					t.Errorf("capabilities = %+v", caps)
+				}
+			},
+		},
+		{
+			name:       "Podman with gVisor",
+			info:       rootlessPodman,
+			version:    podmanVersion,
+			ociRuntime: "runsc",
+			check: func(t *testing.T, rt *RuntimeInfo) {
+				if rt.OCIRuntime != "runsc" || !rt.Sandboxed() || rt.Capabilities.EgressPolicy {
+					t.Errorf("rt = %+v", rt)
+				}
+			},
+		},
+		{
+			name:       "Unknown OCI runtime",
+			info:       rootlessPodman,
+			ociRuntime: "kata",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockDockerClient{InfoFunc: tt.info, ServerVersionFunc: tt.version}
+			rt, err := detectRuntime(context.Background(), mockClient, tt.ociRuntime)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectRuntime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, rt)
+			}
+		})
+	}
+}
+
+func TestRuntimeCapabilities_RootlessCgroupV1(t *testing.T) {
+	info := system.Info{CPUCfsQuota: true, MemoryLimit: true, PidsLimit: true}
+	caps := runtimeCapabilities(info, &RuntimeInfo{Engine: EngineDocker, Rootless: true, CgroupVersion: "1", OCIRuntime: "runc"})
+	if caps.CPULimit || caps.MemoryLimit || caps.PidsLimit || caps.Stats || caps.Pause {
+		t.Errorf("rootless cgroup v1 has no cgroups to use, got %+v", caps)
+	}
+	if !caps.EgressPolicy {
+		t.Error("egress policies only need a network namespace")
+	}
+}
+
+func TestDiskQuotaCandidate(t *testing.T) {
+	xfs := [][2]string{{"Backing Filesystem", "xfs"}}
+	tests := []struct {
+		name string
+		info system.Info
+		rt   RuntimeInfo
+		want bool
+	}{
+		{"Docker overlay2 on xfs", system.Info{Driver: "overlay2", DriverStatus: xfs}, RuntimeInfo{OCIRuntime: "runc"}, true},
+		{"Podman overlay on xfs", system.Info{Driver: "overlay", DriverStatus: xfs}, RuntimeInfo{OCIRuntime: "crun"}, true},
+		{"btrfs", system.Info{Driver: "btrfs"}, RuntimeInfo{OCIRuntime: "runc"}, false},
+		{"Backed by zfs", system.Info{Driver: "overlay2", DriverStatus: [][2]string{{"Backing Filesystem", "zfs"}}}, RuntimeInfo{OCIRuntime: "runc"}, false},
+		{"Rootless", system.Info{Driver: "overlay", DriverStatus: xfs}, RuntimeInfo{OCIRuntime: "crun", Rootless: true}, false},
+		{"gVisor", system.Info{Driver: "overlay2", DriverStatus: xfs}, RuntimeInfo{OCIRuntime: "runsc"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, reason := diskQuotaCandidate(tt.info, &tt.rt); got != tt.want {
+				t.Errorf("diskQuotaCandidate() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngineHost(t *testing.T) {
+	runtimeDir := t.TempDir()
+	sock := filepath.Join(runtimeDir, "podman", "podman.sock")
+	if err := os.MkdirAll(filepath.Dir(sock), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sock, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"Docker default", map[string]string{}, ""},
+		{"DOCKER_HOST wins", map[string]string{"CONTAINER_RUNTIME": "podman", "DOCKER_HOST": "tcp://host:2378"}, "tcp://host:2378"},
+		{"Rootless Podman socket", map[string]string{"CONTAINER_RUNTIME": "podman", "XDG_RUNTIME_DIR": runtimeDir}, "unix://" + sock},
+		{"CONTAINER_HOST", map[string]string{"CONTAINER_RUNTIME": "podman", "CONTAINER_HOST": "unix:///tmp/podman.sock"}, "unix:///tmp/podman.sock"},
+		{"Rootful Podman socket", map[string]string{"CONTAINER_RUNTIME": "podman", "XDG_RUNTIME_DIR": t.TempDir()}, "unix:///run/podman/podman.sock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"DOCKER_HOST", "CONTAINER_RUNTIME", "CONTAINER_HOST", "XDG_RUNTIME_DIR"} {
+				t.Setenv(key, tt.env[key])
+			}
+			if got := engineHost(); got != tt.want {
+				t.Errorf("engineHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_CreateContainer_RuntimeLimits(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+		runtime: &RuntimeInfo{
+			Engine:           EnginePodman,
+			OCIRuntime:       "runsc",
+			requestedRuntime: "runsc",
+			Rootless:         true,
+			Capabilities:     RuntimeCapabilities{MemoryLimit: true, Stats: true},
+		},
+	}
+
+	var hostConfig *container.HostConfig
+	mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hc *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+		hostConfig = hc
+		return container.CreateResponse{ID: "runtime-container-01"}, nil
+	}
+	mockClient.ContainerInspectFunc = func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: containerID, State: &types.ContainerState{Status: "running"}},
+			NetworkSettings:   &types.NetworkSettings{},
+		}, nil
+	}
+
+	_, err := manager.CreateContainer(context.Background(), ContainerConfig{
+		UserID:        "user-1",
+		ContainerName: "limits",
+		ImageType:     "ubuntu",
+		MemoryLimit:   256 * 1024 * 1024,
+		CPULimit:      500,
+	})
+	if err != nil {
+		t.Fatalf("CreateContainer() error = %v", err)
+	}
+	if hostConfig.Runtime != "runsc" {
+		t.Errorf("Runtime = %q, want runsc", hostConfig.Runtime)
+	}
+	if hostConfig.Memory != 256*1024*1024 {
+		t.Errorf("Memory = %d, want the requested limit", hostConfig.Memory)
+	}
+	if hostConfig.CPUQuota != 0 || hostConfig.PidsLimit != nil {
+		t.Errorf("unsupported limits should be dropped, got CPUQuota=%d PidsLimit=%v", hostConfig.CPUQuota, hostConfig.PidsLimit)
+	}
+
+	if _, err := manager.CreateContainer(context.Background(), ContainerConfig{UserID: "user-1", ContainerName: "mac", ImageType: "macos"}); err == nil {
+		t.Error("macOS terminals should be refused without privileged containers")
+	}
+}
+
+func TestManager_PauseContainer_Unsupported(t *testing.T) {
+	paused := false
+	mockClient := &MockDockerClient{
+		ContainerPauseFunc: func(ctx context.Context, containerID string) error {
+			paused = true
+			return nil
+		},
+	}
+	manager := newPauseTestManager(mockClient)
+	manager.runtime = &RuntimeInfo{Rootless: true, CgroupVersion: "1"}
+	manager.containers["pause-container-01"] = &ContainerInfo{ID: "pause-container-01", Status: "running"}
+
+	if err := manager.PauseContainer(context.Background(), "pause-container-01"); err == nil {
+		t.Error("PauseContainer() should fail without freezer support")
+	}
+	if paused {
+		t.Error("ContainerPause should not be called")
+	}
+}
@@ -0,0 +1,213 @@
+package container
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// ScheduleStore defines the storage interface needed by the scheduler
+type ScheduleStore interface {
+	GetScheduledContainers(ctx context.Context) ([]*storage.ScheduledContainer, error)
+	UpdateContainerStatus(ctx context.Context, id, status string) error
+	DeleteContainer(ctx context.Context, id string) error
+	CountContainersByImage(ctx context.Context, image string) (int64, error)
+}
+
+// LeaderElector decides which API instance runs singleton background work
+type LeaderElector interface {
+	IsLeader(ctx context.Context) bool
+}
+
+// SchedulerService enforces per-terminal schedules: cron start/stop windows
+// and expiry. Only the elected leader acts, so running several API instances
+// never starts or stops a terminal twice.
+type SchedulerService struct {
+	manager       *Manager
+	store         ScheduleStore
+	leader        LeaderElector
+	checkInterval time.Duration
+	stopChan      chan struct{}
+	onChange      func(record *storage.ContainerRecord, status string)
+
+	// lastRun is the end of the previous window checked for cron fires;
+	// zero until this instance first acts as leader
+	lastRun time.Time
+}
+
+// NewSchedulerService creates a new scheduler service
+func NewSchedulerService(manager *Manager, store ScheduleStore, leader LeaderElector, checkInterval time.Duration) *SchedulerService {
+	return &SchedulerService{
+		manager:       manager,
+		store:         store,
+		leader:        leader,
+		checkInterval: checkInterval,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// SetChangeHook sets a callback run after the scheduler starts, stops or
+// deletes a container ("running", "stopped" or "deleted")
+func (s *SchedulerService) SetChangeHook(fn func(record *storage.ContainerRecord, status string)) {
+	s.onChange = fn
+}
+
+// Start begins the scheduler service
+func (s *SchedulerService) Start() {
+	go s.run()
+	log.Printf("⏰ Scheduler service started (check interval: %v)", s.checkInterval)
+}
+
+// Stop stops the scheduler service
+func (s *SchedulerService) Stop() {
+	close(s.stopChan)
+	log.Println("⏰ Scheduler service stopped")
+}
+
+// run is the main loop for the scheduler service
+func (s *SchedulerService) run() {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.tick(time.Now())
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// tick applies every schedule whose start or stop fired since the last tick
+func (s *SchedulerService) tick(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if !s.leader.IsLeader(ctx) {
+		s.lastRun = time.Time{}
+		return
+	}
+
+	// A new leader only looks back one interval, so it doesn't replay
+	// fires the previous leader already handled
+	from := s.lastRun
+	if from.IsZero() {
+		from = now.Add(-s.checkInterval)
+	}
+	s.lastRun = now
+
+	scheduled, err := s.store.GetScheduledContainers(ctx)
+	if err != nil {
+		log.Printf("⏰ Scheduler: failed to get scheduled containers: %v", err)
+		return
+	}
+	for _, sc := range scheduled {
+		s.apply(ctx, sc, from, now)
+	}
+}
+
+func (s *SchedulerService) apply(ctx context.Context, sc *storage.ScheduledContainer, from, now time.Time) {
+	record := &sc.ContainerRecord
+	schedule := &sc.Schedule
+
+	if schedule.ExpiresAt != nil && !now.Before(*schedule.ExpiresAt) {
+		s.expire(ctx, record, schedule.ExpireAction())
+		return
+	}
+
+	action := scheduledAction(schedule, from, now)
+	if action == "" || record.DockerID == "" {
+		return
+	}
+
+	switch {
+	case action == "start" && record.Status == "stopped":
+		if err := s.manager.StartContainer(ctx, record.DockerID); err != nil {
+			log.Printf("⏰ Scheduler: failed to start %s: %v", record.Name, err)
+			return
+		}
+		log.Printf("⏰ Scheduler: started %s (user: %s)", record.Name, record.UserID)
+		s.setStatus(ctx, record, "running")
+	case action == "stop" && (record.Status == "running" || record.Status == "paused"):
+		if err := s.manager.StopContainer(ctx, record.DockerID); err != nil {
+			log.Printf("⏰ Scheduler: failed to stop %s: %v", record.Name, err)
+			return
+		}
+		log.Printf("⏰ Scheduler: stopped %s (user: %s)", record.Name, record.UserID)
+		s.setStatus(ctx, record, "stopped")
+	}
+}
+
+// scheduledAction returns "start" or "stop" for whichever cron fired last in
+// (from, now], or "" if neither did
+func scheduledAction(schedule *models.ContainerSchedule, from, now time.Time) string {
+	loc, err := schedule.Location()
+	if err != nil {
+		return ""
+	}
+
+	var lastStart, lastStop time.Time
+	if cron, err := models.ParseCron(schedule.Start); err == nil {
+		lastStart, _ = cron.LastFire(from, now, loc)
+	}
+	if cron, err := models.ParseCron(schedule.Stop); err == nil {
+		lastStop, _ = cron.LastFire(from, now, loc)
+	}
+
+	switch {
+	case lastStart.IsZero() && lastStop.IsZero():
+		return ""
+	case lastStart.After(lastStop):
+		return "start"
+	default:
+		return "stop"
+	}
+}
+
+func (s *SchedulerService) expire(ctx context.Context, record *storage.ContainerRecord, action string) {
+	if action == models.ExpireActionStop {
+		if record.Status != "running" && record.Status != "paused" {
+			return
+		}
+		if err := s.manager.StopContainer(ctx, record.DockerID); err != nil {
+			log.Printf("⏰ Scheduler: failed to stop expired %s: %v", record.Name, err)
+			return
+		}
+		log.Printf("⏰ Scheduler: stopped expired %s (user: %s)", record.Name, record.UserID)
+		s.setStatus(ctx, record, "stopped")
+		return
+	}
+
+	if record.DockerID != "" {
+		if err := s.manager.StopContainer(ctx, record.DockerID); err != nil {
+			log.Printf("⏰ Scheduler: failed to stop expired %s: %v", record.Name, err)
+		}
+		if err := s.manager.RemoveContainer(ctx, record.DockerID); err != nil {
+			log.Printf("⏰ Scheduler: failed to remove expired %s: %v", record.Name, err)
+		}
+	}
+	if err := s.store.DeleteContainer(ctx, record.ID); err != nil {
+		log.Printf("⏰ Scheduler: failed to delete expired %s: %v", record.Name, err)
+		return
+	}
+	log.Printf("⏰ Scheduler: deleted expired %s (user: %s)", record.Name, record.UserID)
+	if err := s.manager.ReleaseForkImage(ctx, s.store, record.Image); err != nil {
+		log.Printf("⏰ Scheduler: failed to remove fork image of %s: %v", record.Name, err)
+	}
+	if s.onChange != nil {
+		s.onChange(record, "deleted")
+	}
+}
+
+func (s *SchedulerService) setStatus(ctx context.Context, record *storage.ContainerRecord, status string) {
+	if err := s.store.UpdateContainerStatus(ctx, record.ID, status); err != nil {
+		log.Printf("⏰ Scheduler: failed to update status of %s: %v", record.Name, err)
+	}
+	if s.onChange != nil {
+		s.onChange(record, status)
+	}
+}
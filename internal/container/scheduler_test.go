@@ -0,0 +1,179 @@
+package container
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/rexec/rexec/internal/models"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+type fakeScheduleStore struct {
+	scheduled []*storage.ScheduledContainer
+	statuses  map[string]string
+	deleted   map[string]bool
+}
+
+func (s *fakeScheduleStore) GetScheduledContainers(ctx context.Context) ([]*storage.ScheduledContainer, error) {
+	return s.scheduled, nil
+}
+
+func (s *fakeScheduleStore) UpdateContainerStatus(ctx context.Context, id, status string) error {
+	s.statuses[id] = status
+	return nil
+}
+
+func (s *fakeScheduleStore) DeleteContainer(ctx context.Context, id string) error {
+	s.deleted[id] = true
+	return nil
+}
+
+func (s *fakeScheduleStore) CountContainersByImage(ctx context.Context, image string) (int64, error) {
+	var n int64
+	for _, sc := range s.scheduled {
+		if sc.Image == image && !s.deleted[sc.ID] {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type fakeLeader bool
+
+func (l fakeLeader) IsLeader(ctx context.Context) bool { return bool(l) }
+
+func scheduledContainer(id, dockerID, status string, schedule models.ContainerSchedule) *storage.ScheduledContainer {
+	return &storage.ScheduledContainer{
+		ContainerRecord: storage.ContainerRecord{ID: id, UserID: "user-1", Name: id, DockerID: dockerID, Status: status},
+		Schedule:        schedule,
+	}
+}
+
+func TestSchedulerService_Tick(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+	}
+
+	started := make(map[string]bool)
+	stopped := make(map[string]bool)
+	removed := make(map[string]bool)
+	mockClient.ContainerStartFunc = func(ctx context.Context, id string, options container.StartOptions) error {
+		started[id] = true
+		return nil
+	}
+	mockClient.ContainerStopFunc = func(ctx context.Context, id string, options container.StopOptions) error {
+		stopped[id] = true
+		return nil
+	}
+	mockClient.ContainerRemoveFunc = func(ctx context.Context, id string, options container.RemoveOptions) error {
+		removed[id] = true
+		return nil
+	}
+	var removedImages []string
+	mockClient.ImageRemoveFunc = func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+		removedImages = append(removedImages, imageID)
+		return nil, nil
+	}
+
+	// Monday 2026-03-02 09:00 UTC
+	now := time.Date(2026, 3, 2, 9, 0, 30, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	window := models.ContainerSchedule{Start: "0 9 * * 1-5", Stop: "0 18 * * 1-5"}
+
+	for _, id := range []string{"docker-start-0001", "docker-running-01", "docker-expire-001", "docker-expstop-01"} {
+		manager.containers[id] = &ContainerInfo{ID: id, Status: "stopped"}
+	}
+	manager.containers["docker-running-01"].Status = "running"
+	manager.containers["docker-expstop-01"].Status = "running"
+
+	store := &fakeScheduleStore{
+		scheduled: []*storage.ScheduledContainer{
+			scheduledContainer("start", "docker-start-0001", "stopped", window),
+			scheduledContainer("already-running", "docker-running-01", "running", window),
+			scheduledContainer("expired", "docker-expire-001", "stopped", models.ContainerSchedule{ExpiresAt: &past}),
+			scheduledContainer("expired-stop", "docker-expstop-01", "running", models.ContainerSchedule{ExpiresAt: &past, OnExpire: models.ExpireActionStop}),
+		},
+		statuses: make(map[string]string),
+		deleted:  make(map[string]bool),
+	}
+	store.scheduled[2].Image = "custom:" + ForkImageTag("expired")
+
+	changes := make(map[string]string)
+	scheduler := NewSchedulerService(manager, store, fakeLeader(true), time.Minute)
+	scheduler.SetChangeHook(func(record *storage.ContainerRecord, status string) {
+		changes[record.ID] = status
+	})
+	scheduler.tick(now)
+
+	if !started["docker-start-0001"] || store.statuses["start"] != "running" || changes["start"] != "running" {
+		t.Errorf("stopped container in its window should be started")
+	}
+	if started["docker-running-01"] || stopped["docker-running-01"] {
+		t.Errorf("running container in its window should be left alone")
+	}
+	if !removed["docker-expire-001"] || !store.deleted["expired"] || changes["expired"] != "deleted" {
+		t.Errorf("expired container should be deleted")
+	}
+	if len(removedImages) != 1 || removedImages[0] != ForkImageTag("expired") {
+		t.Errorf("removed images = %q, want the expired fork's image", removedImages)
+	}
+	if !stopped["docker-expstop-01"] || removed["docker-expstop-01"] || store.statuses["expired-stop"] != "stopped" {
+		t.Errorf("expired container with on_expire=stop should only be stopped")
+	}
+
+	// The start fire was already handled; the next tick must not act on it again
+	delete(started, "docker-start-0001")
+	store.scheduled[0].Status = "stopped"
+	scheduler.tick(now.Add(time.Minute))
+	if started["docker-start-0001"] {
+		t.Error("a cron fire should only be acted on once")
+	}
+}
+
+func TestSchedulerService_NotLeader(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	store := &fakeScheduleStore{
+		scheduled: []*storage.ScheduledContainer{
+			scheduledContainer("expired", "", "stopped", models.ContainerSchedule{ExpiresAt: &past}),
+		},
+		statuses: make(map[string]string),
+		deleted:  make(map[string]bool),
+	}
+	manager := &Manager{containers: make(map[string]*ContainerInfo), userIndex: make(map[string][]string)}
+
+	scheduler := NewSchedulerService(manager, store, fakeLeader(false), time.Minute)
+	scheduler.tick(time.Now())
+
+	if len(store.deleted) != 0 {
+		t.Error("a follower must not act on schedules")
+	}
+}
+
+func TestScheduledAction(t *testing.T) {
+	window := &models.ContainerSchedule{Start: "0 9 * * *", Stop: "0 18 * * *", Timezone: "UTC"}
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     string
+	}{
+		{"Start fired", day.Add(9*time.Hour - time.Minute), day.Add(9 * time.Hour), "start"},
+		{"Stop fired", day.Add(18*time.Hour - time.Minute), day.Add(18 * time.Hour), "stop"},
+		{"Nothing fired", day.Add(10 * time.Hour), day.Add(11 * time.Hour), ""},
+		{"Both fired, stop last", day.Add(8 * time.Hour), day.Add(19 * time.Hour), "stop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scheduledAction(window, tt.from, tt.to); got != tt.want {
+				t.Errorf("scheduledAction() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
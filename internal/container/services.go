@@ -0,0 +1,503 @@
+package container
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// ServiceDir holds each service's pidfile and log inside the terminal. It is
+// on the home volume, so logs survive the terminal being recreated.
+const ServiceDir = "/home/user/.rexec/services"
+
+const (
+	serviceMinBackoff    = time.Second
+	serviceMaxBackoff    = time.Minute
+	serviceStableAfter   = time.Minute // Running this long resets the backoff
+	serviceWatchInterval = 5 * time.Second
+	serviceTrimInterval  = 5 * time.Minute
+	serviceStopTimeout   = 10 * time.Second
+
+	// Logs are cut back to their last serviceLogKeepBytes once they pass serviceLogMaxBytes
+	serviceLogMaxBytes  = 10 * 1024 * 1024
+	serviceLogKeepBytes = 2 * 1024 * 1024
+)
+
+// serviceWrapperScript starts service $1 running command $2: it prints and
+// records its PID, then becomes a login shell running the command with
+// output appended to the service's log
+const serviceWrapperScript = `d=` + ServiceDir + `
+mkdir -p "$d" || exit 1
+echo "$$"
+echo "$$" > "$d/$1.pid"
+printf '\n--- %s started: %s ---\n' "$(date -u '+%Y-%m-%dT%H:%M:%SZ')" "$2" >> "$d/$1.log"
+exec /bin/sh -lc "$2" >> "$d/$1.log" 2>&1 < /dev/null`
+
+// servicePIDScript prints the PID of service $1 if it's still running. The
+// process must carry the service's ID in its environment, so a PID reused
+// after a restart isn't mistaken for the service.
+const servicePIDScript = `p=$(cat "` + ServiceDir + `/$1.pid" 2>/dev/null) || exit 0
+if tr '\000' '\n' < "/proc/$p/environ" 2>/dev/null | grep -qx "REXEC_SERVICE_ID=$2"; then echo "$p"; fi`
+
+// serviceTrimScript cuts the log of service $1 back to its tail. It rewrites
+// the file in place because the service keeps it open for appending.
+var serviceTrimScript = fmt.Sprintf(`f="%s/$1.log"
+[ -f "$f" ] && [ "$(wc -c < "$f")" -gt %d ] || exit 0
+tail -c %d "$f" > "$f.tmp" && cat "$f.tmp" > "$f"
+rm -f "$f.tmp"`, ServiceDir, serviceLogMaxBytes, serviceLogKeepBytes)
+
+// ServiceLogPath is where a service's output is written inside the terminal
+func ServiceLogPath(name string) string {
+	return ServiceDir + "/" + name + ".log"
+}
+
+// ServiceStore defines the storage interface needed by the service supervisor
+type ServiceStore interface {
+	GetSupervisedServices(ctx context.Context) ([]*models.ContainerService, error)
+	GetContainerServiceByID(ctx context.Context, id string) (*models.ContainerService, error)
+	UpdateContainerServiceState(ctx context.Context, id string, state models.ServiceState) error
+}
+
+// ServiceSupervisor keeps the services declared in running terminals alive,
+// restarting them by their restart policy. Services run as their own docker
+// exec, so they outlive the shell and tmux session they were declared from.
+// Only the elected leader supervises; a new leader adopts the processes the
+// previous one started instead of starting them again.
+type ServiceSupervisor struct {
+	manager       *Manager
+	store         ServiceStore
+	leader        LeaderElector
+	checkInterval time.Duration
+	minBackoff    time.Duration
+	stopChan      chan struct{}
+	kick          chan struct{}
+	onChange      func(svc *models.ContainerService)
+
+	ctx     context.Context // Cancelled by Stop; runners derive from it
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	runners map[string]*serviceRunner // service ID -> its runner
+}
+
+// serviceRunner is the goroutine supervising one service
+type serviceRunner struct {
+	cancel context.CancelFunc
+}
+
+// NewServiceSupervisor creates a new service supervisor
+func NewServiceSupervisor(manager *Manager, store ServiceStore, leader LeaderElector, checkInterval time.Duration) *ServiceSupervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ServiceSupervisor{
+		manager:       manager,
+		store:         store,
+		leader:        leader,
+		checkInterval: checkInterval,
+		minBackoff:    serviceMinBackoff,
+		stopChan:      make(chan struct{}),
+		kick:          make(chan struct{}, 1),
+		ctx:           ctx,
+		cancel:        cancel,
+		runners:       make(map[string]*serviceRunner),
+	}
+}
+
+// SetChangeHook sets a callback run whenever a service's state changes
+func (s *ServiceSupervisor) SetChangeHook(fn func(svc *models.ContainerService)) {
+	s.onChange = fn
+}
+
+// Start begins supervising services
+func (s *ServiceSupervisor) Start() {
+	go s.run()
+	log.Printf("🔁 Service supervisor started (check interval: %v)", s.checkInterval)
+}
+
+// Stop stops supervising. Services keep running and are adopted by
+// whichever instance supervises next.
+func (s *ServiceSupervisor) Stop() {
+	close(s.stopChan)
+	s.cancel()
+	log.Println("🔁 Service supervisor stopped")
+}
+
+// Kick asks for services to be reconciled now rather than at the next check,
+// e.g. after one was declared or restarted
+func (s *ServiceSupervisor) Kick() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (s *ServiceSupervisor) run() {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	s.reconcile()
+	for {
+		select {
+		case <-ticker.C:
+			s.reconcile()
+		case <-s.kick:
+			s.reconcile()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// reconcile starts a runner for every enabled service of a running terminal
+// that doesn't have one. Services that exited for good wait to be restarted.
+func (s *ServiceSupervisor) reconcile() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	if !s.leader.IsLeader(ctx) {
+		s.mu.Lock()
+		for id, runner := range s.runners {
+			runner.cancel()
+			delete(s.runners, id)
+		}
+		s.mu.Unlock()
+		return
+	}
+
+	services, err := s.store.GetSupervisedServices(ctx)
+	if err != nil {
+		log.Printf("[Services] Failed to get services: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, svc := range services {
+		if _, ok := s.runners[svc.ID]; ok {
+			continue
+		}
+		if svc.Status == models.ServiceStatusExited || svc.Status == models.ServiceStatusFailed {
+			continue
+		}
+		runCtx, cancel := context.WithCancel(s.ctx)
+		runner := &serviceRunner{cancel: cancel}
+		s.runners[svc.ID] = runner
+		go s.supervise(runCtx, runner, svc)
+	}
+}
+
+// supervise runs a service until it's disabled, deleted, its terminal stops
+// or its restart policy says it's done
+func (s *ServiceSupervisor) supervise(ctx context.Context, runner *serviceRunner, svc *models.ContainerService) {
+	id := svc.ID
+	defer func() {
+		runner.cancel()
+		s.mu.Lock()
+		if s.runners[id] == runner {
+			delete(s.runners, id)
+		}
+		s.mu.Unlock()
+	}()
+
+	backoff := s.minBackoff
+	for {
+		generation := svc.Generation
+		started := time.Now()
+		exitCode, runErr := s.runOnce(ctx, svc)
+		if ctx.Err() != nil {
+			// Supervision moved to another instance; the process carries on
+			return
+		}
+
+		current, err := s.store.GetContainerServiceByID(ctx, svc.ID)
+		if err != nil {
+			log.Printf("[Services] Failed to reload service %s: %v", svc.ID, err)
+			return
+		}
+		if current == nil {
+			return
+		}
+		current.ServiceState = svc.ServiceState
+		svc = current
+		svc.PID = 0
+		svc.ExitCode = exitCode
+		svc.LastError = ""
+		if runErr != nil {
+			svc.LastError = runErr.Error()
+		}
+
+		switch {
+		case !svc.Enabled:
+			svc.Status = models.ServiceStatusStopped
+			s.setState(svc)
+			return
+		case !s.manager.containerRunning(ctx, svc.DockerID):
+			svc.Status = models.ServiceStatusStopped
+			svc.LastError = "terminal is not running"
+			s.setState(svc)
+			return
+		case svc.Generation != generation:
+			// Edited or restarted through the API
+			backoff = s.minBackoff
+			continue
+		case !svc.ShouldRestart(exitCode):
+			svc.Status = models.ServiceStatusExited
+			if runErr != nil || (exitCode != nil && *exitCode != 0) {
+				svc.Status = models.ServiceStatusFailed
+			}
+			s.setState(svc)
+			return
+		}
+
+		if time.Since(started) >= serviceStableAfter {
+			backoff = s.minBackoff
+		}
+		svc.Restarts++
+		svc.Status = models.ServiceStatusBackoff
+		s.setState(svc)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, serviceMaxBackoff)
+	}
+}
+
+// runOnce adopts the service's process if it's already running, or starts
+// it, and waits for it to exit. The exit code is nil if it isn't known.
+func (s *ServiceSupervisor) runOnce(ctx context.Context, svc *models.ContainerService) (*int, error) {
+	pid, err := s.manager.ServicePID(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	trimCtx, stopTrim := context.WithCancel(ctx)
+	defer stopTrim()
+	go s.trimLogs(trimCtx, svc)
+
+	if pid > 0 {
+		svc.Status = models.ServiceStatusRunning
+		svc.PID = pid
+		if svc.StartedAt == nil {
+			now := time.Now()
+			svc.StartedAt = &now
+		}
+		s.setState(svc)
+		return nil, s.watch(ctx, svc, pid)
+	}
+
+	svc.Status = models.ServiceStatusStarting
+	s.setState(svc)
+	return s.start(ctx, svc)
+}
+
+// start runs the service as a new exec and waits for it to exit
+func (s *ServiceSupervisor) start(ctx context.Context, svc *models.ContainerService) (*int, error) {
+	client := s.manager.client
+	workDir := svc.WorkDir
+	if workDir == "" {
+		workDir = "/home/user"
+	}
+
+	execResp, err := client.ContainerExecCreate(ctx, svc.DockerID, container.ExecOptions{
+		Cmd:          []string{"/bin/sh", "-c", serviceWrapperScript, "rexec-service", svc.Name, svc.Command},
+		Env:          serviceEnv(svc),
+		WorkingDir:   workDir,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+	attachResp, err := client.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach/start exec: %w", err)
+	}
+	defer attachResp.Close()
+	// Closing the stream stops waiting without stopping the service
+	stopWaiting := context.AfterFunc(ctx, attachResp.Close)
+	defer stopWaiting()
+
+	// Only the wrapper writes here: its PID, or why it couldn't start
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, attachResp.Reader)
+		pw.CloseWithError(err)
+	}()
+	output := bufio.NewReader(pr)
+	line, _ := output.ReadString('\n')
+	pid, _ := strconv.Atoi(strings.TrimSpace(line))
+	if pid > 0 {
+		now := time.Now()
+		svc.Status = models.ServiceStatusRunning
+		svc.PID = pid
+		svc.StartedAt = &now
+		s.setState(svc)
+		line = ""
+	}
+	rest, _ := io.ReadAll(io.LimitReader(output, 4096))
+	io.Copy(io.Discard, output)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	inspect, err := client.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	exitCode := inspect.ExitCode
+	if pid == 0 {
+		msg := strings.TrimSpace(line + string(rest))
+		if msg == "" {
+			msg = fmt.Sprintf("exit code %d", exitCode)
+		}
+		return &exitCode, fmt.Errorf("service failed to start: %s", msg)
+	}
+	return &exitCode, nil
+}
+
+// watch polls an adopted process until it exits
+func (s *ServiceSupervisor) watch(ctx context.Context, svc *models.ContainerService, pid int) error {
+	ticker := time.NewTicker(serviceWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current, err := s.manager.ServicePID(ctx, svc)
+		if err != nil {
+			return err
+		}
+		if current != pid {
+			return nil
+		}
+	}
+}
+
+// trimLogs keeps a running service's log from growing without bound
+func (s *ServiceSupervisor) trimLogs(ctx context.Context, svc *models.ContainerService) {
+	ticker := time.NewTicker(serviceTrimInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.manager.ExecOutput(ctx, svc.DockerID, []string{"/bin/sh", "-c", serviceTrimScript, "rexec-service", svc.Name}); err != nil && ctx.Err() == nil {
+			log.Printf("[Services] Failed to trim log of %s: %v", svc.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setState saves the service's state and reports the change
+func (s *ServiceSupervisor) setState(svc *models.ContainerService) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.store.UpdateContainerServiceState(ctx, svc.ID, svc.ServiceState); err != nil {
+		log.Printf("[Services] Failed to save state of %s: %v", svc.Name, err)
+	}
+	if s.onChange != nil {
+		s.onChange(svc)
+	}
+}
+
+// serviceEnv is the environment a service runs with: the terminal's usual
+// one, the service's own variables and its ID, which ServicePID looks for
+func serviceEnv(svc *models.ContainerService) []string {
+	env := []string{
+		"HOME=/home/user",
+		"LANG=C.UTF-8",
+		"LC_ALL=C.UTF-8",
+		"PATH=/home/user/.local/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	}
+	for key, value := range svc.Env {
+		env = append(env, key+"="+value)
+	}
+	return append(env, "REXEC_SERVICE="+svc.Name, "REXEC_SERVICE_ID="+svc.ID)
+}
+
+// ServicePID returns the PID of a service's running process inside its
+// terminal, or 0 if it isn't running
+func (m *Manager) ServicePID(ctx context.Context, svc *models.ContainerService) (int, error) {
+	output, err := m.ExecOutput(ctx, svc.DockerID, []string{"/bin/sh", "-c", servicePIDScript, "rexec-service", svc.Name, svc.ID})
+	if err != nil {
+		return 0, err
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(output))
+	return pid, nil
+}
+
+// StopServiceProcess stops a service's process and everything it started,
+// with SIGTERM and then SIGKILL for whatever is left after a grace period.
+// It doesn't stop the supervisor from starting it again.
+func (m *Manager) StopServiceProcess(ctx context.Context, svc *models.ContainerService) error {
+	pid, err := m.ServicePID(ctx, svc)
+	if err != nil || pid == 0 {
+		return err
+	}
+	procs, err := m.ListProcesses(ctx, svc.DockerID)
+	if err != nil {
+		return err
+	}
+	// Children can outlive the service's own process, so the whole tree is waited for
+	tree := DescendantPIDs(procs, pid)
+	if len(tree) == 0 {
+		return nil
+	}
+	// Processes may exit before they're signalled, so kill's own errors don't matter
+	m.SignalProcesses(ctx, svc.DockerID, tree, "TERM")
+
+	deadline := time.Now().Add(serviceStopTimeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+		procs, err := m.ListProcesses(ctx, svc.DockerID)
+		if err != nil {
+			return err
+		}
+		alive := make(map[int]bool, len(procs))
+		for _, p := range procs {
+			alive[p.PID] = p.State != "Z"
+		}
+		var left []int
+		for _, p := range tree {
+			if alive[p] {
+				left = append(left, p)
+			}
+		}
+		if len(left) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			m.SignalProcesses(ctx, svc.DockerID, left, "KILL")
+			return nil
+		}
+	}
+}
+
+// containerRunning reports whether a container is running and not paused
+func (m *Manager) containerRunning(ctx context.Context, dockerID string) bool {
+	inspect, err := m.client.ContainerInspect(ctx, dockerID)
+	if err != nil || inspect.ContainerJSONBase == nil || inspect.State == nil {
+		return false
+	}
+	return inspect.State.Running && !inspect.State.Paused
+}
@@ -0,0 +1,150 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// fakeServiceStore keeps one service and the states saved for it
+type fakeServiceStore struct {
+	mu     sync.Mutex
+	svc    *models.ContainerService
+	states []models.ServiceState
+}
+
+func (s *fakeServiceStore) GetSupervisedServices(ctx context.Context) ([]*models.ContainerService, error) {
+	svc, _ := s.GetContainerServiceByID(ctx, "")
+	return []*models.ContainerService{svc}, nil
+}
+
+func (s *fakeServiceStore) GetContainerServiceByID(ctx context.Context, id string) (*models.ContainerService, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *s.svc
+	return &copied, nil
+}
+
+func (s *fakeServiceStore) UpdateContainerServiceState(ctx context.Context, id string, state models.ServiceState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states = append(s.states, state)
+	return nil
+}
+
+// execStream frames stdout the way Docker does for a non-TTY exec
+func execStream(stdout string) types.HijackedResponse {
+	var buf bytes.Buffer
+	stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(stdout))
+	client, server := net.Pipe()
+	server.Close()
+	return types.HijackedResponse{Conn: client, Reader: bufio.NewReader(&buf)}
+}
+
+// newServiceTestClient runs services that print PID 123 and exit with exitCode
+func newServiceTestClient(exitCode int) (*MockDockerClient, *int) {
+	var mu sync.Mutex
+	scripts := make(map[string]string) // exec ID -> script
+	starts := 0
+	mockClient := &MockDockerClient{
+		ContainerInspectFunc: func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{Running: true}}}, nil
+		},
+	}
+	mockClient.ContainerExecCreateFunc = func(ctx context.Context, id string, config container.ExecOptions) (types.IDResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		execID := string(rune('a' + len(scripts)))
+		scripts[execID] = config.Cmd[2]
+		if config.Cmd[2] == serviceWrapperScript {
+			starts++
+		}
+		return types.IDResponse{ID: execID}, nil
+	}
+	mockClient.ContainerExecAttachFunc = func(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if scripts[execID] == serviceWrapperScript {
+			return execStream("123\n"), nil
+		}
+		return execStream(""), nil
+	}
+	mockClient.ContainerExecInspectFunc = func(ctx context.Context, execID string) (container.ExecInspect, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if scripts[execID] == serviceWrapperScript {
+			return container.ExecInspect{ExitCode: exitCode}, nil
+		}
+		return container.ExecInspect{}, nil
+	}
+	return mockClient, &starts
+}
+
+func TestServiceSupervisor_Supervise(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		exitCode   int
+		wantStarts int
+		wantStatus string
+	}{
+		{"On failure, clean exit", models.ServiceRestartOnFailure, 0, 1, models.ServiceStatusExited},
+		{"Never, crash", models.ServiceRestartNever, 1, 1, models.ServiceStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient, starts := newServiceTestClient(tt.exitCode)
+			store := &fakeServiceStore{svc: &models.ContainerService{
+				ID: "svc-1", DockerID: "docker-1", Name: "web", Command: "npm run dev", RestartPolicy: tt.policy, Enabled: true,
+			}}
+			s := NewServiceSupervisor(newPauseTestManager(mockClient), store, nil, time.Minute)
+			runner := &serviceRunner{cancel: func() {}}
+			s.supervise(context.Background(), runner, store.svc)
+
+			if *starts != tt.wantStarts {
+				t.Errorf("started %d times, want %d", *starts, tt.wantStarts)
+			}
+			last := store.states[len(store.states)-1]
+			if last.Status != tt.wantStatus || last.ExitCode == nil || *last.ExitCode != tt.exitCode || last.PID != 0 {
+				t.Errorf("final state = %+v, want %s with exit code %d", last, tt.wantStatus, tt.exitCode)
+			}
+			if running := store.states[1]; running.Status != models.ServiceStatusRunning || running.PID != 123 {
+				t.Errorf("state after start = %+v, want running as PID 123", running)
+			}
+		})
+	}
+
+	t.Run("Always restarts until disabled", func(t *testing.T) {
+		mockClient, starts := newServiceTestClient(1)
+		store := &fakeServiceStore{svc: &models.ContainerService{
+			ID: "svc-1", DockerID: "docker-1", Name: "web", Command: "npm run dev", RestartPolicy: models.ServiceRestartAlways, Enabled: true,
+		}}
+		s := NewServiceSupervisor(newPauseTestManager(mockClient), store, nil, time.Minute)
+		s.minBackoff = time.Millisecond
+		s.SetChangeHook(func(svc *models.ContainerService) {
+			if svc.Restarts == 2 {
+				store.mu.Lock()
+				store.svc.Enabled = false
+				store.mu.Unlock()
+			}
+		})
+		s.supervise(context.Background(), &serviceRunner{cancel: func() {}}, store.svc)
+
+		if *starts != 3 {
+			t.Errorf("started %d times, want 3", *starts)
+		}
+		if last := store.states[len(store.states)-1]; last.Status != models.ServiceStatusStopped || last.Restarts != 2 {
+			t.Errorf("final state = %+v, want stopped after 2 restarts", last)
+		}
+	})
+}
@@ -31,6 +31,19 @@ type ShellSetupConfig struct {
 	SystemStats     bool   // Show system stats on login
 }
 
+// zshIntegration is the .zshrc snippet that marks each command with OSC 133
+// and reports the working directory with OSC 7, which the terminal handler
+// turns into command_start and command_end events. The precmd hook runs
+// first so it sees the command's exit status.
+const zshIntegration = `# Rexec shell integration
+__rexec_preexec() { printf '\033]133;C\007'; }
+__rexec_precmd() {
+    local code=$?
+    printf '\033]7;file://%s%s\007\033]133;D;%s\007' "$HOST" "$PWD" "$code"
+}
+preexec_functions+=(__rexec_preexec)
+precmd_functions=(__rexec_precmd $precmd_functions)`
+
 // DefaultShellSetupConfig returns the default (full) shell configuration
 func DefaultShellSetupConfig() ShellSetupConfig {
 	return ShellSetupConfig{
@@ -542,6 +555,7 @@ alias myip='curl -s ifconfig.me'
 unset PS1 # Ensure themes can set their own PS1
 source $ZSH/oh-my-zsh.sh
 
+%s
 ZSHRC
 }
 
@@ -615,7 +629,7 @@ main() {
 }
 
 main
-`, generatePluginInstallScript(cfg), theme, pluginsStr, gitAliases, systemStats)
+`, generatePluginInstallScript(cfg), theme, pluginsStr, gitAliases, systemStats, zshIntegration)
 }
 
 // generatePluginInstallScript generates the plugin installation part of the script
@@ -804,6 +818,13 @@ func SetupRole(ctx context.Context, cli client.CommonAPIClient, containerID stri
 		return nil, err
 	}
 
+	return runSetupScript(ctx, cli, containerID, "", script, "Role setup", roleID)
+}
+
+// runSetupScript runs a provisioning script as user (root when empty) once
+// the container is running, bounded by RoleSetupTimeout. what and subject
+// only shape the result message, e.g. "Role setup complete for node".
+func runSetupScript(ctx context.Context, cli client.CommonAPIClient, containerID, user, script, what, subject string) (*SetupShellResponse, error) {
 	// Wait for container to be fully running before executing
 	// This helps avoid race conditions with overlay filesystem
 	maxWait := 20 // Wait up to 10 seconds for container to start
@@ -824,6 +845,7 @@ func SetupRole(ctx context.Context, cli client.CommonAPIClient, containerID stri
 	// Create exec configuration
 	execConfig := container.ExecOptions{
 		Cmd:          []string{"/bin/sh", "-c", script},
+		User:         user,
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          false,
@@ -868,7 +890,7 @@ func SetupRole(ctx context.Context, cli client.CommonAPIClient, containerID stri
 	case <-ctx.Done():
 		return &SetupShellResponse{
 			Success: false,
-			Message: fmt.Sprintf("Role setup timed out for %s after %v", roleID, RoleSetupTimeout),
+			Message: fmt.Sprintf("%s timed out for %s after %v", what, subject, RoleSetupTimeout),
 			Output:  output.String(),
 		}, nil
 	}
@@ -879,7 +901,7 @@ func SetupRole(ctx context.Context, cli client.CommonAPIClient, containerID stri
 		// If we can't inspect, the script might still have run successfully
 		return &SetupShellResponse{
 			Success: true,
-			Message: fmt.Sprintf("Role setup completed for %s (exit status unknown)", roleID),
+			Message: fmt.Sprintf("%s completed for %s (exit status unknown)", what, subject),
 			Output:  output.String(),
 		}, nil
 	}
@@ -887,14 +909,14 @@ func SetupRole(ctx context.Context, cli client.CommonAPIClient, containerID stri
 	if inspect.ExitCode != 0 {
 		return &SetupShellResponse{
 			Success: false,
-			Message: fmt.Sprintf("Role setup failed for %s (exit code: %d)", roleID, inspect.ExitCode),
+			Message: fmt.Sprintf("%s failed for %s (exit code: %d)", what, subject, inspect.ExitCode),
 			Output:  output.String(),
 		}, nil
 	}
 
 	return &SetupShellResponse{
 		Success: true,
-		Message: fmt.Sprintf("Role setup complete for %s", roleID),
+		Message: fmt.Sprintf("%s complete for %s", what, subject),
 		Output:  output.String(),
 	}, nil
 }
@@ -0,0 +1,218 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// SnapshotImageRepo is the local repository committed snapshots are tagged into.
+// Images under it are never pulled and must not be accepted as user custom images.
+const SnapshotImageRepo = "rexec-snapshots"
+
+// ErrSnapshotInUse is returned when a snapshot's image still backs a container
+var ErrSnapshotInUse = errors.New("snapshot image is in use by a container")
+
+// snapshotHomeDir is the volume mount captured in the snapshot archive.
+const snapshotHomeDir = "/home/user"
+
+// SnapshotInfo describes the artifacts produced by CreateSnapshot.
+type SnapshotInfo struct {
+	ImageTag    string // Committed root filesystem
+	ArchivePath string // Tarball of the /home/user volume
+	SizeBytes   int64  // Image size plus archive size
+}
+
+// SnapshotImageTag returns the image tag used for a snapshot.
+func SnapshotImageTag(snapshotID string) string {
+	return SnapshotImageRepo + ":" + snapshotID
+}
+
+// IsSnapshotImage reports whether imageName refers to a snapshot image.
+func IsSnapshotImage(imageName string) bool {
+	name := familiarImageName(imageName)
+	return strings.HasPrefix(name, SnapshotImageRepo+":") || strings.HasPrefix(name, SnapshotImageRepo+"@")
+}
+
+// familiarImageName returns imageName the way Docker shortens it, so that
+// "docker.io/library/rexec-snapshots:x" compares equal to "rexec-snapshots:x".
+// Names that don't parse are only lowercased; the engine rejects them anyway.
+func familiarImageName(imageName string) string {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return strings.ToLower(imageName)
+	}
+	return reference.FamiliarString(named)
+}
+
+// snapshotDir returns where volume archives are stored.
+// SNAPSHOT_DIR overrides the default of a "snapshots" directory next to the volume path.
+func (m *Manager) snapshotDir() string {
+	if dir := os.Getenv("SNAPSHOT_DIR"); dir != "" {
+		return dir
+	}
+	base := m.volumePath
+	if base == "" {
+		base = "/var/lib/rexec/volumes"
+	}
+	return filepath.Join(filepath.Dir(base), "snapshots")
+}
+
+// CreateSnapshot commits the container's root filesystem to a tagged image and
+// archives its home volume, which docker commit does not capture.
+func (m *Manager) CreateSnapshot(ctx context.Context, dockerID, userID, snapshotID string) (*SnapshotInfo, error) {
+	tag := SnapshotImageTag(snapshotID)
+
+	_, err := m.client.ContainerCommit(ctx, dockerID, container.CommitOptions{
+		Reference: tag,
+		Comment:   "rexec snapshot " + snapshotID,
+		Pause:     true,
+		Config: &container.Config{
+			Labels: map[string]string{
+				"rexec.snapshot_id": snapshotID,
+				"rexec.user_id":     userID,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit container: %w", err)
+	}
+
+	archivePath, archiveSize, err := m.archiveHomeVolume(ctx, dockerID, snapshotID)
+	if err != nil {
+		_, _ = m.client.ImageRemove(ctx, tag, image.RemoveOptions{Force: true, PruneChildren: true})
+		return nil, err
+	}
+
+	info := &SnapshotInfo{
+		ImageTag:    tag,
+		ArchivePath: archivePath,
+		SizeBytes:   archiveSize,
+	}
+	if inspect, _, err := m.client.ImageInspectWithRaw(ctx, tag); err == nil {
+		info.SizeBytes += inspect.Size
+	}
+
+	log.Printf("[Snapshot] Created snapshot %s of %s (%s)", snapshotID, dockerID[:min(12, len(dockerID))], formatBytes(info.SizeBytes))
+	return info, nil
+}
+
+// archiveHomeVolume streams /home/user out of the container into a tar file.
+func (m *Manager) archiveHomeVolume(ctx context.Context, dockerID, snapshotID string) (string, int64, error) {
+	dir := m.snapshotDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	reader, _, err := m.client.CopyFromContainer(ctx, dockerID, snapshotHomeDir)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read home volume: %w", err)
+	}
+	defer reader.Close()
+
+	archivePath := filepath.Join(dir, snapshotID+".tar")
+	f, err := os.OpenFile(archivePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create snapshot archive: %w", err)
+	}
+
+	size, err := io.Copy(f, reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return "", 0, fmt.Errorf("failed to write snapshot archive: %w", err)
+	}
+
+	return archivePath, size, nil
+}
+
+// RestoreSnapshotArchive replaces the contents of /home/user in a running
+// container with the volume archive taken by CreateSnapshot.
+func (m *Manager) RestoreSnapshotArchive(ctx context.Context, dockerID, archivePath string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot archive: %w", err)
+	}
+	defer f.Close()
+
+	// Clear the volume first so files created after the snapshot don't survive
+	if _, err := m.execAndWait(ctx, dockerID, []string{"find", snapshotHomeDir, "-mindepth", "1", "-delete"}); err != nil {
+		return fmt.Errorf("failed to clear home volume: %w", err)
+	}
+
+	// The archive is rooted at "user/", so extract it into the parent directory
+	if err := m.client.CopyToContainer(ctx, dockerID, filepath.Dir(snapshotHomeDir), f, container.CopyToContainerOptions{
+		AllowOverwriteDirWithFile: true,
+	}); err != nil {
+		return fmt.Errorf("failed to restore home volume: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSnapshot removes a snapshot's image and volume archive.
+// Missing artifacts are not treated as errors. The image isn't forced out
+// from under containers still using it; that returns ErrSnapshotInUse and
+// leaves both artifacts in place.
+func (m *Manager) DeleteSnapshot(ctx context.Context, imageTag, archivePath string) error {
+	if imageTag != "" {
+		_, err := m.client.ImageRemove(ctx, imageTag, image.RemoveOptions{PruneChildren: true})
+		switch {
+		case err == nil, client.IsErrNotFound(err), strings.Contains(strings.ToLower(err.Error()), "no such image"):
+		case errdefs.IsConflict(err):
+			return ErrSnapshotInUse
+		default:
+			return fmt.Errorf("failed to remove snapshot image: %w", err)
+		}
+	}
+	if archivePath != "" {
+		if err := os.Remove(archivePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove snapshot archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// execAndWait runs cmd in the container, waits for it to finish and returns its exit code.
+// A non-zero exit code is returned as an error.
+func (m *Manager) execAndWait(ctx context.Context, dockerID string, cmd []string) (int, error) {
+	execResp, err := m.client.ContainerExecCreate(ctx, dockerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return -1, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	attachResp, err := m.client.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return -1, fmt.Errorf("failed to attach/start exec: %w", err)
+	}
+	defer attachResp.Close()
+
+	// Drain output until the command exits
+	_, _ = io.Copy(io.Discard, attachResp.Reader)
+
+	inspect, err := m.client.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return -1, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return inspect.ExitCode, fmt.Errorf("%s exited with code %d", cmd[0], inspect.ExitCode)
+	}
+	return 0, nil
+}
@@ -0,0 +1,277 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestIsSnapshotImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+		want  bool
+	}{
+		{"Snapshot tag", SnapshotImageTag("abc"), true},
+		{"Snapshot digest", SnapshotImageRepo + "@sha256:deadbeef", true},
+		{"Regular image", "ubuntu:24.04", false},
+		{"Similar prefix", SnapshotImageRepo + "-other:latest", false},
+		{"Fully qualified", "docker.io/library/" + SnapshotImageTag("abc"), true},
+		{"Legacy registry host", "index.docker.io/library/" + SnapshotImageTag("abc"), true},
+		{"Uppercase", "REXEC-SNAPSHOTS:abc", true},
+		{"Other registry", "ghcr.io/" + SnapshotImageTag("abc"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSnapshotImage(tt.image); got != tt.want {
+				t.Errorf("IsSnapshotImage(%q) = %v, want %v", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_CreateSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SNAPSHOT_DIR", dir)
+
+	mockClient := &MockDockerClient{}
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+	}
+
+	var committedRef string
+	mockClient.ContainerCommitFunc = func(ctx context.Context, containerID string, options container.CommitOptions) (container.CommitResponse, error) {
+		committedRef = options.Reference
+		if options.Config.Labels["rexec.user_id"] != "user-1" {
+			t.Errorf("commit labels = %v, want rexec.user_id=user-1", options.Config.Labels)
+		}
+		return container.CommitResponse{ID: "sha256:snap"}, nil
+	}
+	mockClient.CopyFromContainerFunc = func(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+		if srcPath != "/home/user" {
+			t.Errorf("CopyFromContainer path = %q, want /home/user", srcPath)
+		}
+		return io.NopCloser(strings.NewReader("volume-data")), container.PathStat{}, nil
+	}
+	mockClient.ImageInspectWithRawFunc = func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+		return types.ImageInspect{Size: 100}, nil, nil
+	}
+
+	info, err := manager.CreateSnapshot(context.Background(), "docker-id-123456", "user-1", "snap-1")
+	if err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+
+	if committedRef != SnapshotImageTag("snap-1") || info.ImageTag != committedRef {
+		t.Errorf("image tag = %q (committed %q), want %q", info.ImageTag, committedRef, SnapshotImageTag("snap-1"))
+	}
+	if info.ArchivePath != filepath.Join(dir, "snap-1.tar") {
+		t.Errorf("ArchivePath = %q, want file in %s", info.ArchivePath, dir)
+	}
+	data, err := os.ReadFile(info.ArchivePath)
+	if err != nil || string(data) != "volume-data" {
+		t.Errorf("archive contents = %q, %v", data, err)
+	}
+	if info.SizeBytes != 100+int64(len("volume-data")) {
+		t.Errorf("SizeBytes = %d, want %d", info.SizeBytes, 100+len("volume-data"))
+	}
+}
+
+func TestManager_CreateSnapshot_ArchiveFailureRemovesImage(t *testing.T) {
+	t.Setenv("SNAPSHOT_DIR", t.TempDir())
+
+	mockClient := &MockDockerClient{}
+	manager := &Manager{client: mockClient}
+
+	mockClient.CopyFromContainerFunc = func(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+		return nil, container.PathStat{}, fmt.Errorf("copy failed")
+	}
+	var removed string
+	mockClient.ImageRemoveFunc = func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+		removed = imageID
+		return nil, nil
+	}
+
+	if _, err := manager.CreateSnapshot(context.Background(), "docker-id", "user-1", "snap-2"); err == nil {
+		t.Fatal("CreateSnapshot() expected error, got nil")
+	}
+	if removed != SnapshotImageTag("snap-2") {
+		t.Errorf("removed image = %q, want %q", removed, SnapshotImageTag("snap-2"))
+	}
+}
+
+func TestManager_RestoreSnapshotArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "snap.tar")
+	if err := os.WriteFile(archive, []byte("tar-data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mockClient := &MockDockerClient{}
+	manager := &Manager{client: mockClient}
+
+	var execCmd []string
+	mockClient.ContainerExecCreateFunc = func(ctx context.Context, id string, config container.ExecOptions) (types.IDResponse, error) {
+		execCmd = config.Cmd
+		return types.IDResponse{ID: "exec-1"}, nil
+	}
+	var copiedTo, copied string
+	mockClient.CopyToContainerFunc = func(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error {
+		copiedTo = dstPath
+		b, _ := io.ReadAll(content)
+		copied = string(b)
+		return nil
+	}
+
+	if err := manager.RestoreSnapshotArchive(context.Background(), "docker-id", archive); err != nil {
+		t.Fatalf("RestoreSnapshotArchive() error = %v", err)
+	}
+	if len(execCmd) == 0 || execCmd[0] != "find" {
+		t.Errorf("expected home volume to be cleared first, exec = %v", execCmd)
+	}
+	if copiedTo != "/home" || copied != "tar-data" {
+		t.Errorf("CopyToContainer(%q, %q), want (/home, tar-data)", copiedTo, copied)
+	}
+
+	// A failing clear must stop the restore
+	mockClient.ContainerExecInspectFunc = func(ctx context.Context, execID string) (container.ExecInspect, error) {
+		return container.ExecInspect{ExitCode: 1}, nil
+	}
+	copiedTo = ""
+	if err := manager.RestoreSnapshotArchive(context.Background(), "docker-id", archive); err == nil {
+		t.Error("RestoreSnapshotArchive() expected error when clearing fails")
+	}
+	if copiedTo != "" {
+		t.Error("archive should not be copied when clearing fails")
+	}
+}
+
+func TestManager_ReplaceContainer_RestoresHomeBackup(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SNAPSHOT_DIR", dir)
+	archive := filepath.Join(t.TempDir(), "snap.tar")
+	if err := os.WriteFile(archive, []byte("snapshot-home"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mockClient := &MockDockerClient{}
+	manager := &Manager{
+		client:     mockClient,
+		containers: map[string]*ContainerInfo{"old-id": {ID: "old-id", UserID: "user123", Status: "running"}},
+		userIndex:  map[string][]string{"user123": {"old-id"}},
+	}
+	mockClient.ImageInspectWithRawFunc = func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+		return types.ImageInspect{Config: &container.Config{Labels: map[string]string{"rexec.user_id": "user123"}}}, nil, nil
+	}
+	mockClient.ContainerInspectFunc = func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: containerID, Name: "/rexec-user123-dev", State: &types.ContainerState{Running: true}},
+			NetworkSettings:   &types.NetworkSettings{},
+		}, nil
+	}
+	mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+		return container.CreateResponse{ID: "new-id"}, nil
+	}
+	mockClient.CopyFromContainerFunc = func(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+		return io.NopCloser(strings.NewReader("old-home")), container.PathStat{}, nil
+	}
+	restored := map[string]string{}
+	mockClient.CopyToContainerFunc = func(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error {
+		if containerID == "new-id" {
+			return errors.New("no space left on device")
+		}
+		b, _ := io.ReadAll(content)
+		restored[containerID] = string(b)
+		return nil
+	}
+
+	_, err := manager.ReplaceContainer(context.Background(), RecreateContainerConfig{
+		UserID:          "user123",
+		ContainerName:   "dev",
+		Image:           "custom:rexec-snapshots:snap-1",
+		OldDockerID:     "old-id",
+		SnapshotArchive: archive,
+	})
+	if err == nil {
+		t.Fatal("ReplaceContainer() succeeded with a failing restore")
+	}
+	if restored["old-id"] != "old-home" {
+		t.Errorf("old container's home volume = %q, want the backup put back", restored["old-id"])
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("backup left behind: %v", entries)
+	}
+}
+
+func TestManager_DeleteSnapshot(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "snap.tar")
+	if err := os.WriteFile(archive, []byte("tar-data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mockClient := &MockDockerClient{}
+	manager := &Manager{client: mockClient}
+
+	// An image still backing a container is kept, along with its archive
+	mockClient.ImageRemoveFunc = func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+		if options.Force {
+			t.Error("snapshot image was force-removed")
+		}
+		return nil, errdefs.Conflict(errors.New("image is being used by running container"))
+	}
+	if err := manager.DeleteSnapshot(context.Background(), SnapshotImageTag("snap-1"), archive); !errors.Is(err, ErrSnapshotInUse) {
+		t.Fatalf("DeleteSnapshot() error = %v, want ErrSnapshotInUse", err)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Errorf("archive of an in-use snapshot was removed: %v", err)
+	}
+
+	mockClient.ImageRemoveFunc = func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+		return nil, nil
+	}
+	if err := manager.DeleteSnapshot(context.Background(), SnapshotImageTag("snap-1"), archive); err != nil {
+		t.Fatalf("DeleteSnapshot() error = %v", err)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("archive wasn't removed: %v", err)
+	}
+}
+
+func TestManager_CreateContainer_RejectsForeignSnapshot(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+	}
+
+	mockClient.ImageInspectWithRawFunc = func(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+		return types.ImageInspect{
+			Config: &container.Config{Labels: map[string]string{"rexec.user_id": "owner"}},
+		}, nil, nil
+	}
+
+	_, err := manager.CreateContainer(context.Background(), ContainerConfig{
+		UserID:        "intruder",
+		ContainerName: "stolen",
+		ImageType:     "custom",
+		CustomImage:   SnapshotImageTag("snap-1"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "another user") {
+		t.Errorf("CreateContainer() error = %v, want ownership error", err)
+	}
+}
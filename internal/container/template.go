@@ -0,0 +1,107 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// ResolveTemplateImage maps a template's image to an image type and custom image.
+// Known image types (ubuntu, debian, ...) are used as-is; anything else is
+// treated as a full image reference.
+func ResolveTemplateImage(image string) (imageType, customImage string) {
+	image = strings.TrimSpace(image)
+	if _, ok := SupportedImages[image]; ok {
+		return image, ""
+	}
+	return "custom", image
+}
+
+// TemplateEnv returns a template's env vars in Docker's KEY=value form, sorted for stable output
+func TemplateEnv(tmpl *models.EnvTemplate) []string {
+	env := make([]string, 0, len(tmpl.Env))
+	for k, v := range tmpl.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// SetupTemplate applies the provisioning parts of a template: packages are
+// installed as root, then dotfiles and startup commands run as the terminal user.
+func SetupTemplate(ctx context.Context, cli client.CommonAPIClient, containerID string, tmpl *models.EnvTemplate) (*SetupShellResponse, error) {
+	if script := generateTemplatePackageScript(tmpl); script != "" {
+		result, err := runSetupScript(ctx, cli, containerID, "", script, "Template packages", tmpl.Name)
+		if err != nil || !result.Success {
+			return result, err
+		}
+	}
+
+	script := generateTemplateUserScript(tmpl)
+	if script == "" {
+		return &SetupShellResponse{
+			Success: true,
+			Message: fmt.Sprintf("Template setup complete for %s", tmpl.Name),
+		}, nil
+	}
+	return runSetupScript(ctx, cli, containerID, "user", script, "Template setup", tmpl.Name)
+}
+
+// generateTemplatePackageScript installs template packages with whichever
+// package manager the image has. git is added when dotfiles need cloning.
+func generateTemplatePackageScript(tmpl *models.EnvTemplate) string {
+	packages := append([]string{}, tmpl.Packages...)
+	if tmpl.Dotfiles != nil {
+		packages = append(packages, "git")
+	}
+	if len(packages) == 0 {
+		return ""
+	}
+
+	return installPackagesScript("Installing template packages...", func(string) []string {
+		return packages
+	})
+}
+
+// generateTemplateUserScript clones dotfiles and runs startup commands.
+// Each startup command runs from $HOME; a failure is reported but doesn't
+// stop the remaining commands.
+func generateTemplateUserScript(tmpl *models.EnvTemplate) string {
+	if tmpl.Dotfiles == nil && len(tmpl.Startup) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset +e\ncd \"$HOME\"\nfailed=0\n")
+
+	if d := tmpl.Dotfiles; d != nil {
+		b.WriteString("echo \"[[REXEC_STATUS]]Installing dotfiles...\"\n")
+		clone := "git clone --depth 1"
+		if d.Ref != "" {
+			clone += " --branch " + shellQuote(d.Ref)
+		}
+		clone += " -- " + shellQuote(d.Repo) + " \"$HOME/.dotfiles\""
+		fmt.Fprintf(&b, "if [ ! -d \"$HOME/.dotfiles\" ]; then\n    %s || failed=1\nfi\n", clone)
+		if d.Install != "" {
+			install := shellQuote("./" + d.Install)
+			fmt.Fprintf(&b, "if [ -f \"$HOME/.dotfiles/\"%s ]; then\n    (cd \"$HOME/.dotfiles\" && sh %s) || failed=1\nfi\n", shellQuote(d.Install), install)
+		}
+	}
+
+	for i, cmd := range tmpl.Startup {
+		fmt.Fprintf(&b, "echo \"[[REXEC_STATUS]]Running startup command %d/%d...\"\n", i+1, len(tmpl.Startup))
+		fmt.Fprintf(&b, "(cd \"$HOME\" && sh -c %s) || { echo \"startup command %d failed\"; failed=1; }\n", shellQuote(cmd), i+1)
+	}
+
+	b.WriteString("exit $failed\n")
+	return b.String()
+}
+
+// shellQuote wraps s in single quotes for safe use in a POSIX shell command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
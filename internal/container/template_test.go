@@ -0,0 +1,104 @@
+package container
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rexec/rexec/internal/models"
+)
+
+func TestResolveTemplateImage(t *testing.T) {
+	tests := []struct {
+		image      string
+		wantType   string
+		wantCustom string
+	}{
+		{"ubuntu", "ubuntu", ""},
+		{" debian ", "debian", ""},
+		{"ghcr.io/me/dev:latest", "custom", "ghcr.io/me/dev:latest"},
+	}
+
+	for _, tt := range tests {
+		gotType, gotCustom := ResolveTemplateImage(tt.image)
+		if gotType != tt.wantType || gotCustom != tt.wantCustom {
+			t.Errorf("ResolveTemplateImage(%q) = (%q, %q), want (%q, %q)", tt.image, gotType, gotCustom, tt.wantType, tt.wantCustom)
+		}
+	}
+}
+
+func TestTemplateEnv(t *testing.T) {
+	env := TemplateEnv(&models.EnvTemplate{Env: map[string]string{"B": "2", "A": "1 2"}})
+	if strings.Join(env, ",") != "A=1 2,B=2" {
+		t.Errorf("TemplateEnv() = %v", env)
+	}
+}
+
+func TestGenerateTemplateScripts(t *testing.T) {
+	tests := []struct {
+		name         string
+		tmpl         models.EnvTemplate
+		wantPackages []string
+		wantUser     []string
+		noPackages   bool
+		noUserScript bool
+	}{
+		{
+			name:         "Empty",
+			tmpl:         models.EnvTemplate{Name: "empty"},
+			noPackages:   true,
+			noUserScript: true,
+		},
+		{
+			name:         "Packages only",
+			tmpl:         models.EnvTemplate{Name: "pkgs", Packages: []string{"make", "jq"}},
+			wantPackages: []string{"apt-get install -y -qq 'make' 'jq'", "apk add --no-cache 'make' 'jq'"},
+			noUserScript: true,
+		},
+		{
+			name: "Dotfiles add git",
+			tmpl: models.EnvTemplate{
+				Name:     "dots",
+				Dotfiles: &models.TemplateDotfiles{Repo: "https://github.com/me/dotfiles", Ref: "main", Install: "install.sh"},
+			},
+			wantPackages: []string{"'git'"},
+			wantUser: []string{
+				"git clone --depth 1 --branch 'main' -- 'https://github.com/me/dotfiles' \"$HOME/.dotfiles\"",
+				"sh './install.sh'",
+			},
+		},
+		{
+			name:       "Startup commands are quoted",
+			tmpl:       models.EnvTemplate{Name: "start", Startup: []string{"echo 'hi' && touch ~/ok"}},
+			noPackages: true,
+			wantUser: []string{
+				"Running startup command 1/1",
+				`sh -c 'echo '\''hi'\'' && touch ~/ok'`,
+				"exit $failed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkgScript := generateTemplatePackageScript(&tt.tmpl)
+			if tt.noPackages != (pkgScript == "") {
+				t.Fatalf("package script empty = %v, want %v", pkgScript == "", tt.noPackages)
+			}
+			for _, want := range tt.wantPackages {
+				if !strings.Contains(pkgScript, want) {
+					t.Errorf("package script missing %q:\n%s", want, pkgScript)
+				}
+			}
+
+			userScript := generateTemplateUserScript(&tt.tmpl)
+			if tt.noUserScript != (userScript == "") {
+				t.Fatalf("user script empty = %v, want %v", userScript == "", tt.noUserScript)
+			}
+			for _, want := range tt.wantUser {
+				if !strings.Contains(userScript, want) {
+					t.Errorf("user script missing %q:\n%s", want, userScript)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package container
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/rexec/rexec/internal/storage"
+)
+
+// VolumeQuotaStore defines the storage interface needed to enforce shared volume sizes
+type VolumeQuotaStore interface {
+	GetWritableVolumeAttachments(ctx context.Context) ([]*storage.WritableVolumeAttachment, error)
+}
+
+// VolumeQuotaService holds shared volumes to their size. The local volume
+// driver can't limit a volume's size, and resizing only changes the record,
+// so usage is polled instead: once a volume has grown past its size, every
+// terminal still writing to it has it remounted read-only through the
+// over-limit hook. Only the elected leader checks.
+type VolumeQuotaService struct {
+	manager       *Manager
+	store         VolumeQuotaStore
+	leader        LeaderElector
+	checkInterval time.Duration
+	stopChan      chan struct{}
+	onOverLimit   func(att *storage.WritableVolumeAttachment)
+}
+
+// NewVolumeQuotaService creates a new volume quota service
+func NewVolumeQuotaService(manager *Manager, store VolumeQuotaStore, leader LeaderElector, checkInterval time.Duration) *VolumeQuotaService {
+	return &VolumeQuotaService{
+		manager:       manager,
+		store:         store,
+		leader:        leader,
+		checkInterval: checkInterval,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// SetOverLimitHook sets the callback that remounts a volume read-only in a
+// terminal once the volume is over its size
+func (s *VolumeQuotaService) SetOverLimitHook(fn func(att *storage.WritableVolumeAttachment)) {
+	s.onOverLimit = fn
+}
+
+// Start begins the volume quota service
+func (s *VolumeQuotaService) Start() {
+	go s.run()
+	log.Printf("💾 Volume quota service started (check interval: %v)", s.checkInterval)
+}
+
+// Stop stops the volume quota service
+func (s *VolumeQuotaService) Stop() {
+	close(s.stopChan)
+	log.Println("💾 Volume quota service stopped")
+}
+
+// run is the main loop for the volume quota service
+func (s *VolumeQuotaService) run() {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.check()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// check passes every read-write mount of an over-limit volume to the hook
+func (s *VolumeQuotaService) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if s.onOverLimit == nil || !s.leader.IsLeader(ctx) {
+		return
+	}
+
+	attachments, err := s.store.GetWritableVolumeAttachments(ctx)
+	if err != nil {
+		log.Printf("💾 Volume quota: failed to get volume attachments: %v", err)
+		return
+	}
+	if len(attachments) == 0 {
+		return
+	}
+	usage, err := s.manager.SharedVolumeUsage(ctx)
+	if err != nil {
+		log.Printf("💾 Volume quota: %v", err)
+		return
+	}
+
+	for _, att := range attachments {
+		used, ok := usage[att.DockerVolume]
+		if !ok || used <= att.SizeMB*1024*1024 {
+			continue
+		}
+		log.Printf("💾 Volume quota: %s (user: %s) is using %s of %d MB; making it read-only in terminal %s",
+			att.VolumeName, att.UserID, formatBytes(used), att.SizeMB, att.ContainerID)
+		s.onOverLimit(att)
+	}
+}
@@ -0,0 +1,52 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/rexec/rexec/internal/storage"
+)
+
+type fakeVolumeQuotaStore []*storage.WritableVolumeAttachment
+
+func (f fakeVolumeQuotaStore) GetWritableVolumeAttachments(ctx context.Context) ([]*storage.WritableVolumeAttachment, error) {
+	return f, nil
+}
+
+func TestVolumeQuotaService_Check(t *testing.T) {
+	mockClient := &MockDockerClient{
+		DiskUsageFunc: func(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+			return types.DiskUsage{Volumes: []*volume.Volume{
+				{Name: "rexec-vol-full", Labels: map[string]string{SharedVolumeLabel: "full"}, UsageData: &volume.UsageData{Size: 11 * 1024 * 1024}},
+				{Name: "rexec-vol-ok", Labels: map[string]string{SharedVolumeLabel: "ok"}, UsageData: &volume.UsageData{Size: 1024 * 1024}},
+			}}, nil
+		},
+	}
+	store := fakeVolumeQuotaStore{
+		{VolumeID: "full", VolumeName: "datasets", DockerVolume: "rexec-vol-full", SizeMB: 10, ContainerID: "c1"},
+		{VolumeID: "full", VolumeName: "datasets", DockerVolume: "rexec-vol-full", SizeMB: 10, ContainerID: "c2"},
+		{VolumeID: "ok", VolumeName: "cache", DockerVolume: "rexec-vol-ok", SizeMB: 10, ContainerID: "c1"},
+		{VolumeID: "new", VolumeName: "unknown", DockerVolume: "rexec-vol-new", SizeMB: 10, ContainerID: "c3"},
+	}
+
+	for _, leader := range []bool{true, false} {
+		s := NewVolumeQuotaService(&Manager{client: mockClient}, store, fakeLeader(leader), time.Minute)
+		var remounted []string
+		s.SetOverLimitHook(func(att *storage.WritableVolumeAttachment) {
+			remounted = append(remounted, att.VolumeID+"/"+att.ContainerID)
+		})
+		s.check()
+
+		want := "full/c1,full/c2"
+		if !leader {
+			want = ""
+		}
+		if got := strings.Join(remounted, ","); got != want {
+			t.Errorf("leader %v: remounted %q, want %q", leader, got, want)
+		}
+	}
+}
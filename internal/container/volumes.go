@@ -0,0 +1,87 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// SharedVolumeLabel marks user-owned volumes that outlive the terminals they're mounted into
+const SharedVolumeLabel = "rexec.shared_volume"
+
+// VolumeMount mounts a shared volume into a terminal
+type VolumeMount struct {
+	Name     string // Docker volume name
+	Target   string // Absolute path inside the terminal
+	ReadOnly bool
+}
+
+// SharedVolumeName returns the Docker volume name for a shared volume
+func SharedVolumeName(volumeID string) string {
+	return "rexec-vol-" + volumeID
+}
+
+// CreateSharedVolume creates the Docker volume backing a shared volume and
+// returns its name
+func (m *Manager) CreateSharedVolume(ctx context.Context, userID, volumeID string) (string, error) {
+	name := SharedVolumeName(volumeID)
+	_, err := m.client.VolumeCreate(ctx, volume.CreateOptions{
+		Name: name,
+		Labels: map[string]string{
+			"rexec.managed":   "true",
+			"rexec.user_id":   userID,
+			SharedVolumeLabel: volumeID,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create volume: %w", err)
+	}
+	return name, nil
+}
+
+// RemoveSharedVolume deletes a shared volume's data. It fails if a
+// container still uses the volume.
+func (m *Manager) RemoveSharedVolume(ctx context.Context, name string) error {
+	if err := m.client.VolumeRemove(ctx, name, false); err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove volume: %w", err)
+	}
+	return nil
+}
+
+// SharedVolumeUsage returns the bytes used by each shared volume, keyed by
+// Docker volume name. Volumes whose size isn't known are left out.
+func (m *Manager) SharedVolumeUsage(ctx context.Context) (map[string]int64, error) {
+	du, err := m.client.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume usage: %w", err)
+	}
+
+	usage := make(map[string]int64)
+	for _, v := range du.Volumes {
+		if v == nil || v.Labels[SharedVolumeLabel] == "" || v.UsageData == nil || v.UsageData.Size < 0 {
+			continue
+		}
+		usage[v.Name] = v.UsageData.Size
+	}
+	return usage, nil
+}
+
+// volumeMounts turns shared volume mounts into Docker mounts
+func volumeMounts(volumes []VolumeMount) []mount.Mount {
+	mounts := make([]mount.Mount, 0, len(volumes))
+	for _, v := range volumes {
+		log.Printf("[Container] Mounting shared volume %s at %s (read-only: %v)", v.Name, v.Target, v.ReadOnly)
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   v.Name,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		})
+	}
+	return mounts
+}
@@ -0,0 +1,106 @@
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestManager_CreateSharedVolume(t *testing.T) {
+	var created volume.CreateOptions
+	mockClient := &MockDockerClient{
+		VolumeCreateFunc: func(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+			created = options
+			return volume.Volume{Name: options.Name}, nil
+		},
+	}
+	manager := &Manager{client: mockClient}
+
+	name, err := manager.CreateSharedVolume(context.Background(), "user-1", "vol-1")
+	if err != nil {
+		t.Fatalf("CreateSharedVolume() error = %v", err)
+	}
+	if name != "rexec-vol-vol-1" || created.Name != name {
+		t.Errorf("volume name = %q (created %q), want rexec-vol-vol-1", name, created.Name)
+	}
+	if created.Labels[SharedVolumeLabel] != "vol-1" || created.Labels["rexec.user_id"] != "user-1" {
+		t.Errorf("labels = %v, want the volume and user IDs", created.Labels)
+	}
+}
+
+func TestManager_SharedVolumeUsage(t *testing.T) {
+	mockClient := &MockDockerClient{
+		DiskUsageFunc: func(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+			return types.DiskUsage{Volumes: []*volume.Volume{
+				{Name: "rexec-vol-a", Labels: map[string]string{SharedVolumeLabel: "a"}, UsageData: &volume.UsageData{Size: 2048}},
+				{Name: "rexec-vol-b", Labels: map[string]string{SharedVolumeLabel: "b"}, UsageData: &volume.UsageData{Size: -1}},
+				{Name: "rexec-user-home", Labels: map[string]string{"rexec.managed": "true"}, UsageData: &volume.UsageData{Size: 4096}},
+			}}, nil
+		},
+	}
+	manager := &Manager{client: mockClient}
+
+	usage, err := manager.SharedVolumeUsage(context.Background())
+	if err != nil {
+		t.Fatalf("SharedVolumeUsage() error = %v", err)
+	}
+	if len(usage) != 1 || usage["rexec-vol-a"] != 2048 {
+		t.Errorf("usage = %v, want only rexec-vol-a with 2048 bytes", usage)
+	}
+}
+
+func TestManager_CreateContainer_SharedVolumes(t *testing.T) {
+	var hostConfig *container.HostConfig
+	mockClient := &MockDockerClient{
+		ContainerCreateFunc: func(ctx context.Context, config *container.Config, hc *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+			hostConfig = hc
+			return container.CreateResponse{ID: "volume-container-01"}, nil
+		},
+		ContainerInspectFunc: func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{ID: containerID, State: &types.ContainerState{Status: "running"}},
+				NetworkSettings:   &types.NetworkSettings{},
+			}, nil
+		},
+	}
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+	}
+
+	_, err := manager.CreateContainer(context.Background(), ContainerConfig{
+		UserID:        "user-1",
+		ContainerName: "shared",
+		ImageType:     "ubuntu",
+		Volumes: []VolumeMount{
+			{Name: "rexec-vol-data", Target: "/data"},
+			{Name: "rexec-vol-assets", Target: "/home/user/assets", ReadOnly: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateContainer() error = %v", err)
+	}
+
+	want := map[string]mount.Mount{
+		"/data":             {Type: mount.TypeVolume, Source: "rexec-vol-data", Target: "/data"},
+		"/home/user/assets": {Type: mount.TypeVolume, Source: "rexec-vol-assets", Target: "/home/user/assets", ReadOnly: true},
+	}
+	for _, m := range hostConfig.Mounts {
+		if w, ok := want[m.Target]; ok {
+			if m.Type != w.Type || m.Source != w.Source || m.ReadOnly != w.ReadOnly {
+				t.Errorf("mount at %s = %+v, want %+v", m.Target, m, w)
+			}
+			delete(want, m.Target)
+		}
+	}
+	for target := range want {
+		t.Errorf("no mount at %s", target)
+	}
+}
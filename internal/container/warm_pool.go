@@ -0,0 +1,647 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/google/uuid"
+)
+
+const (
+	// PoolLabel marks warm pool members; its value is the member's pool key
+	PoolLabel = "rexec.pool"
+	// PoolClaimedLabel is set on terminals that were claimed from the pool
+	PoolClaimedLabel = "rexec.warm_pool"
+
+	// poolUserID owns unclaimed members until a user claims them
+	poolUserID = "warm-pool"
+
+	// PoolModePaused parks members paused: instant to resume, but they keep their memory
+	PoolModePaused = "paused"
+	// PoolModeStopped parks members stopped: no memory held, a second or two to start
+	PoolModeStopped = "stopped"
+
+	defaultPoolRefillInterval = 30 * time.Second
+	maxPoolEntrySize          = 50
+)
+
+// WarmPoolEntry is an image/role pair the pool keeps containers ready for
+type WarmPoolEntry struct {
+	ImageType string `json:"image"`
+	Role      string `json:"role"`
+	Size      int    `json:"size"`
+}
+
+func (e WarmPoolEntry) key() string {
+	return poolKey(e.ImageType, e.Role)
+}
+
+func poolKey(imageType, role string) string {
+	return imageType + "/" + role
+}
+
+// WarmPoolConfig configures the warm pool
+type WarmPoolConfig struct {
+	Entries        []WarmPoolEntry
+	Mode           string        // PoolModePaused (default) or PoolModeStopped
+	RefillInterval time.Duration // How often to top the pool up (default 30s)
+	DiskQuota      int64         // Members' disk quota in bytes; with quotas enforced only matching requests are served
+}
+
+// ParseWarmPoolSpec parses a pool spec such as "ubuntu:standard=3,alpine=2".
+// Each item is image[:role]=size; the role may be omitted for role-less terminals.
+func ParseWarmPoolSpec(spec string) ([]WarmPoolEntry, error) {
+	var entries []WarmPoolEntry
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		pair, sizeStr, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("warm pool entry %q: expected image[:role]=size", item)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(sizeStr))
+		if err != nil || size < 1 || size > maxPoolEntrySize {
+			return nil, fmt.Errorf("warm pool entry %q: size must be 1-%d", item, maxPoolEntrySize)
+		}
+
+		imageType, role, _ := strings.Cut(strings.TrimSpace(pair), ":")
+		if _, ok := SupportedImages[imageType]; !ok {
+			return nil, fmt.Errorf("warm pool entry %q: unsupported image %q", item, imageType)
+		}
+		if strings.HasPrefix(imageType, "macos") {
+			return nil, fmt.Errorf("warm pool entry %q: macOS VMs can't be pooled", item)
+		}
+		if role != "" && !IsBuiltinRole(role) {
+			return nil, fmt.Errorf("warm pool entry %q: unknown role %q", item, role)
+		}
+
+		entry := WarmPoolEntry{ImageType: imageType, Role: role, Size: size}
+		if seen[entry.key()] {
+			return nil, fmt.Errorf("warm pool entry %q: duplicate image/role pair", item)
+		}
+		seen[entry.key()] = true
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// WarmPoolConfigFromEnv reads WARM_POOL (see ParseWarmPoolSpec), WARM_POOL_MODE,
+// WARM_POOL_INTERVAL and WARM_POOL_DISK_MB. An empty WARM_POOL disables the pool.
+func WarmPoolConfigFromEnv() (WarmPoolConfig, error) {
+	cfg := WarmPoolConfig{
+		Mode:           PoolModePaused,
+		RefillInterval: defaultPoolRefillInterval,
+	}
+
+	entries, err := ParseWarmPoolSpec(os.Getenv("WARM_POOL"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Entries = entries
+
+	if mode := os.Getenv("WARM_POOL_MODE"); mode != "" {
+		if mode != PoolModePaused && mode != PoolModeStopped {
+			return cfg, fmt.Errorf("WARM_POOL_MODE must be %q or %q", PoolModePaused, PoolModeStopped)
+		}
+		cfg.Mode = mode
+	}
+	if interval := os.Getenv("WARM_POOL_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < time.Second {
+			return cfg, fmt.Errorf("WARM_POOL_INTERVAL must be a duration of at least 1s")
+		}
+		cfg.RefillInterval = d
+	}
+	if diskMB := os.Getenv("WARM_POOL_DISK_MB"); diskMB != "" {
+		mb, err := strconv.ParseInt(diskMB, 10, 64)
+		if err != nil || mb < 0 {
+			return cfg, fmt.Errorf("WARM_POOL_DISK_MB must be a non-negative number")
+		}
+		cfg.DiskQuota = mb * 1024 * 1024
+	}
+	return cfg, nil
+}
+
+// PoolClaimStore persists the labels of claimed pool members. Docker labels
+// can't be changed after creation, so a claimed member keeps its pool labels
+// in Docker and its owner's labels live here.
+type PoolClaimStore interface {
+	SavePoolClaim(ctx context.Context, dockerID string, labels map[string]string) error
+	GetPoolClaims(ctx context.Context) (map[string]map[string]string, error)
+	DeletePoolClaim(ctx context.Context, dockerID string) error
+}
+
+// poolMember is a parked container waiting to be claimed
+type poolMember struct {
+	ID        string
+	Key       string
+	CreatedAt time.Time
+}
+
+// WarmPool keeps containers created, set up and parked for popular image/role
+// pairs, so creating a terminal only has to claim one. Unclaimed members are
+// not tracked by the Manager, so cleanup and reconciliation never see them.
+type WarmPool struct {
+	manager *Manager
+	store   PoolClaimStore
+	cfg     WarmPoolConfig
+
+	mu         sync.Mutex
+	ready      map[string][]*poolMember // pool key -> parked members, oldest first
+	warming    map[string]int           // pool key -> members being set up
+	claims     int64
+	misses     int64
+	failures   int64
+	lastError  string
+	lastRefill time.Time
+
+	refillCh chan struct{}
+	stopChan chan struct{}
+}
+
+// WarmPoolHealth is reported on /api/admin/runtime
+type WarmPoolHealth struct {
+	Mode       string                `json:"mode"`
+	Entries    []WarmPoolEntryHealth `json:"entries"`
+	Claims     int64                 `json:"claims"`
+	Misses     int64                 `json:"misses"`
+	Failures   int64                 `json:"failures"`
+	LastError  string                `json:"last_error,omitempty"`
+	LastRefill *time.Time            `json:"last_refill,omitempty"`
+}
+
+// WarmPoolEntryHealth is the state of one image/role pair
+type WarmPoolEntryHealth struct {
+	ImageType string `json:"image"`
+	Role      string `json:"role"`
+	Size      int    `json:"size"`
+	Ready     int    `json:"ready"`
+	Warming   int    `json:"warming"`
+}
+
+// NewWarmPool creates a warm pool; call Start to fill it
+func NewWarmPool(manager *Manager, store PoolClaimStore, cfg WarmPoolConfig) *WarmPool {
+	if cfg.Mode == "" {
+		cfg.Mode = PoolModePaused
+	}
+	if cfg.Mode == PoolModePaused && !manager.Capabilities().Pause {
+		log.Printf("[WarmPool] Container runtime can't pause containers; parking members stopped")
+		cfg.Mode = PoolModeStopped
+	}
+	if cfg.RefillInterval <= 0 {
+		cfg.RefillInterval = defaultPoolRefillInterval
+	}
+	return &WarmPool{
+		manager:  manager,
+		store:    store,
+		cfg:      cfg,
+		ready:    make(map[string][]*poolMember),
+		warming:  make(map[string]int),
+		refillCh: make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start adopts members left parked by a previous run and starts refilling in
+// the background. With no entries configured it only removes leftover members.
+// Call Manager.LoadPoolClaims first so claimed members aren't mistaken for leftovers.
+func (p *WarmPool) Start() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := p.adoptMembers(ctx); err != nil {
+		log.Printf("[WarmPool] Failed to adopt existing members: %v", err)
+	}
+	if len(p.cfg.Entries) == 0 {
+		return
+	}
+	go p.run()
+	log.Printf("🔥 Warm pool started (%d image/role pairs, mode: %s)", len(p.cfg.Entries), p.cfg.Mode)
+}
+
+// Stop stops refilling. Parked members are left for the next run to adopt.
+func (p *WarmPool) Stop() {
+	close(p.stopChan)
+	log.Println("🔥 Warm pool stopped")
+}
+
+func (p *WarmPool) run() {
+	ticker := time.NewTicker(p.cfg.RefillInterval)
+	defer ticker.Stop()
+
+	p.refill()
+	for {
+		select {
+		case <-ticker.C:
+			p.refill()
+		case <-p.refillCh:
+			p.refill()
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+// adoptMembers takes over parked members from a previous run. Members that
+// were mid-setup, or whose pair is no longer configured, are removed.
+func (p *WarmPool) adoptMembers(ctx context.Context) error {
+	list, err := p.manager.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", PoolLabel)),
+	})
+	if err != nil {
+		return err
+	}
+
+	sizes := make(map[string]int, len(p.cfg.Entries))
+	for _, e := range p.cfg.Entries {
+		sizes[e.key()] = e.Size
+	}
+
+	parkedState := "paused"
+	if p.cfg.Mode == PoolModeStopped {
+		parkedState = "exited"
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range list {
+		if p.manager.isPoolClaimed(c.ID) {
+			continue
+		}
+		key := c.Labels[PoolLabel]
+		if c.State == parkedState && len(p.ready[key]) < sizes[key] {
+			p.ready[key] = append(p.ready[key], &poolMember{ID: c.ID, Key: key, CreatedAt: time.Unix(c.Created, 0)})
+			continue
+		}
+		log.Printf("[WarmPool] Removing leftover member %s (%s, %s)", c.ID[:12], key, c.State)
+		p.removeMember(ctx, c.ID)
+	}
+	return nil
+}
+
+// refill creates members until every pair has its configured size
+func (p *WarmPool) refill() {
+	for _, entry := range p.cfg.Entries {
+		for {
+			key := entry.key()
+			p.mu.Lock()
+			if len(p.ready[key])+p.warming[key] >= entry.Size {
+				p.mu.Unlock()
+				break
+			}
+			p.warming[key]++
+			p.mu.Unlock()
+
+			ctx, cancel := context.WithTimeout(context.Background(), ShellSetupTimeout+RoleSetupTimeout+2*time.Minute)
+			member, err := p.createMember(ctx, entry)
+			cancel()
+
+			p.mu.Lock()
+			p.warming[key]--
+			if err != nil {
+				p.failures++
+				p.lastError = fmt.Sprintf("%s: %v", key, err)
+				p.mu.Unlock()
+				log.Printf("[WarmPool] Failed to warm %s: %v", key, err)
+				break // Try again next round
+			}
+			p.ready[key] = append(p.ready[key], member)
+			p.lastRefill = time.Now()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// createMember creates a container for entry, runs shell and role setup and parks it
+func (p *WarmPool) createMember(ctx context.Context, entry WarmPoolEntry) (*poolMember, error) {
+	m := p.manager
+	if err := m.PullImage(ctx, entry.ImageType); err != nil {
+		return nil, err
+	}
+
+	info, err := m.CreateContainer(ctx, ContainerConfig{
+		UserID:        poolUserID,
+		ContainerName: "pool-" + uuid.New().String()[:8],
+		ImageType:     entry.ImageType,
+		Role:          entry.Role,
+		DiskQuota:     p.cfg.DiskQuota,
+		Labels:        map[string]string{PoolLabel: entry.key()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.RemoveFromTracking(info.ID)
+
+	discard := func(err error) (*poolMember, error) {
+		p.removeMember(context.Background(), info.ID)
+		return nil, err
+	}
+
+	// Same setup a new terminal gets with default shell settings; barebone skips it all
+	if entry.Role != "barebone" {
+		if result, err := SetupShellWithConfig(ctx, m.client, info.ID, DefaultShellSetupConfig()); err != nil || !result.Success {
+			return discard(setupError("shell setup", result, err))
+		}
+		if entry.Role != "" {
+			if result, err := SetupRole(ctx, m.client, info.ID, entry.Role); err != nil || !result.Success {
+				return discard(setupError("role setup", result, err))
+			}
+		}
+	}
+
+	if p.cfg.Mode == PoolModeStopped {
+		err = m.client.ContainerStop(ctx, info.ID, container.StopOptions{})
+	} else {
+		err = m.client.ContainerPause(ctx, info.ID)
+	}
+	if err != nil {
+		return discard(fmt.Errorf("failed to park container: %w", err))
+	}
+
+	log.Printf("[WarmPool] Warmed %s for %s", info.ID[:12], entry.key())
+	return &poolMember{ID: info.ID, Key: entry.key(), CreatedAt: info.CreatedAt}, nil
+}
+
+// removeMember removes an unclaimed member along with its home volume
+func (p *WarmPool) removeMember(ctx context.Context, dockerID string) {
+	cli := p.manager.client
+	volumeName := ""
+	if inspect, err := cli.ContainerInspect(ctx, dockerID); err == nil {
+		volumeName = homeVolume(inspect.Mounts)
+	}
+	if err := cli.ContainerRemove(ctx, dockerID, container.RemoveOptions{Force: true}); err != nil {
+		log.Printf("[WarmPool] Failed to remove member %s: %v", dockerID[:12], err)
+		return
+	}
+	if volumeName != "" {
+		_ = cli.VolumeRemove(ctx, volumeName, true)
+	}
+}
+
+func homeVolume(mounts []container.MountPoint) string {
+	for _, mnt := range mounts {
+		if mnt.Destination == "/home/user" {
+			return mnt.Name
+		}
+	}
+	return ""
+}
+
+func setupError(what string, result *SetupShellResponse, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	return fmt.Errorf("%s: %s", what, result.Message)
+}
+
+// Eligible reports whether a create request can be served from the pool.
+// Custom images, snapshots and extra env vars all need a fresh container.
+func (p *WarmPool) Eligible(cfg ContainerConfig) bool {
+	if cfg.ImageType == "custom" || cfg.CustomImage != "" || cfg.SnapshotArchive != "" || len(cfg.Env) > 0 || cfg.VolumeName != "" {
+		return false
+	}
+	if p.manager.IsDiskQuotaEnabled() && cfg.DiskQuota != p.cfg.DiskQuota {
+		return false
+	}
+	for _, e := range p.cfg.Entries {
+		if e.ImageType == cfg.ImageType && e.Role == cfg.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// Claim hands a parked member to cfg's user: it is resumed, resized, renamed
+// and relabelled. It returns false when the pool can't serve the request, in
+// which case the caller creates a container as usual. The claimed container
+// keeps its pool volume, hostname and env; its volume is returned in
+// ContainerInfo.VolumeName.
+func (p *WarmPool) Claim(ctx context.Context, cfg ContainerConfig) (*ContainerInfo, bool) {
+	if !p.Eligible(cfg) {
+		return nil, false
+	}
+
+	key := poolKey(cfg.ImageType, cfg.Role)
+	p.mu.Lock()
+	members := p.ready[key]
+	if len(members) == 0 {
+		p.misses++
+		p.mu.Unlock()
+		p.triggerRefill()
+		return nil, false
+	}
+	member := members[0]
+	p.ready[key] = members[1:]
+	p.mu.Unlock()
+	p.triggerRefill()
+
+	info, err := p.activate(ctx, member, cfg)
+	if err != nil {
+		log.Printf("[WarmPool] Failed to claim %s for %s: %v", member.ID[:12], cfg.UserID, err)
+		p.removeMember(context.Background(), member.ID)
+		p.mu.Lock()
+		p.failures++
+		p.lastError = fmt.Sprintf("claim %s: %v", key, err)
+		p.mu.Unlock()
+		return nil, false
+	}
+
+	p.mu.Lock()
+	p.claims++
+	p.mu.Unlock()
+	log.Printf("[WarmPool] Claimed %s (%s) for user %s", member.ID[:12], key, cfg.UserID)
+	return info, true
+}
+
+func (p *WarmPool) activate(ctx context.Context, member *poolMember, cfg ContainerConfig) (*ContainerInfo, error) {
+	m := p.manager
+	cli := m.client
+
+	// Remember the volume before renaming; it's named after the pool member
+	inspect, err := cli.ContainerInspect(ctx, member.ID)
+	if err != nil {
+		return nil, err
+	}
+	volumeName := homeVolume(inspect.Mounts)
+
+	if p.cfg.Mode == PoolModeStopped {
+		err = cli.ContainerStart(ctx, member.ID, container.StartOptions{})
+	} else {
+		err = cli.ContainerUnpause(ctx, member.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resume: %w", err)
+	}
+
+	if cfg.MemoryLimit > 0 && cfg.CPULimit > 0 {
+		if err := m.UpdateContainerResources(ctx, member.ID, cfg.MemoryLimit/1024/1024, cfg.CPULimit); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ResourceClass != nil && m.Capabilities().PidsLimit {
+		// Pool members are created with the default process limit
+		limit := pidsLimit(cfg.ResourceClass)
+		if _, err := cli.ContainerUpdate(ctx, member.ID, container.UpdateConfig{
+			Resources: container.Resources{PidsLimit: &limit},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to set process limit: %w", err)
+		}
+	}
+
+	if err := cli.ContainerRename(ctx, member.ID, fmt.Sprintf("rexec-%s-%s", cfg.UserID, cfg.ContainerName)); err != nil {
+		return nil, fmt.Errorf("failed to rename: %w", err)
+	}
+
+	labels := mergeLabels(inspect.Config.Labels, mergeLabels(map[string]string{
+		"rexec.user_id":        cfg.UserID,
+		"rexec.container_name": cfg.ContainerName,
+		"rexec.image_type":     cfg.ImageType,
+		"rexec.role":           cfg.Role,
+		"rexec.managed":        "true",
+		"rexec.memory_limit":   fmt.Sprintf("%d", cfg.MemoryLimit),
+		"rexec.cpu_limit":      fmt.Sprintf("%d", cfg.CPULimit),
+		"rexec.disk_quota":     fmt.Sprintf("%d", cfg.DiskQuota),
+		PoolClaimedLabel:       "true",
+	}, mergeLabels(mergeLabels(networkLabels(cfg.NetworkMB), resourceClassLabels(cfg.ResourceClass)), cfg.Labels)))
+
+	m.trackEgressPolicy(member.ID, cfg.Egress)
+	if err := m.applyNetworkPolicy(ctx, member.ID, labels, false); err != nil {
+		m.trackEgressPolicy(member.ID, nil)
+		return nil, err
+	}
+
+	if err := p.store.SavePoolClaim(ctx, member.ID, labels); err != nil {
+		return nil, fmt.Errorf("failed to save claim: %w", err)
+	}
+
+	ipAddress := ""
+	if inspect.NetworkSettings != nil {
+		for _, n := range inspect.NetworkSettings.Networks {
+			ipAddress = n.IPAddress
+			break
+		}
+	}
+
+	now := time.Now()
+	info := &ContainerInfo{
+		ID:            member.ID,
+		UserID:        cfg.UserID,
+		ContainerName: cfg.ContainerName,
+		ImageType:     cfg.ImageType,
+		Status:        "configuring",
+		CreatedAt:     now,
+		LastUsedAt:    now,
+		IPAddress:     ipAddress,
+		Labels:        labels,
+		VolumeName:    volumeName,
+	}
+	m.trackClaimed(info)
+	return info, nil
+}
+
+func (p *WarmPool) triggerRefill() {
+	select {
+	case p.refillCh <- struct{}{}:
+	default:
+	}
+}
+
+// Health reports the pool's fill level and claim statistics
+func (p *WarmPool) Health() WarmPoolHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := WarmPoolHealth{
+		Mode:      p.cfg.Mode,
+		Entries:   make([]WarmPoolEntryHealth, 0, len(p.cfg.Entries)),
+		Claims:    p.claims,
+		Misses:    p.misses,
+		Failures:  p.failures,
+		LastError: p.lastError,
+	}
+	if !p.lastRefill.IsZero() {
+		t := p.lastRefill
+		health.LastRefill = &t
+	}
+	for _, e := range p.cfg.Entries {
+		health.Entries = append(health.Entries, WarmPoolEntryHealth{
+			ImageType: e.ImageType,
+			Role:      e.Role,
+			Size:      e.Size,
+			Ready:     len(p.ready[e.key()]),
+			Warming:   p.warming[e.key()],
+		})
+	}
+	return health
+}
+
+// isUnclaimedPoolMember reports whether labels belong to a member still in the pool
+func isUnclaimedPoolMember(labels map[string]string) bool {
+	return labels[PoolLabel] != "" && labels["rexec.user_id"] == poolUserID
+}
+
+// LoadPoolClaims loads the labels of claimed warm pool members, dropping
+// claims whose container is gone. Call it before LoadExistingContainers, even
+// with the pool disabled, or claimed terminals won't be found.
+func (m *Manager) LoadPoolClaims(ctx context.Context, store PoolClaimStore) error {
+	claims, err := store.GetPoolClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	for dockerID := range claims {
+		if !m.DockerContainerExists(ctx, dockerID) {
+			delete(claims, dockerID)
+			if err := store.DeletePoolClaim(ctx, dockerID); err != nil {
+				log.Printf("[WarmPool] Failed to delete stale claim %s: %v", dockerID, err)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	m.poolClaims = claims
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Manager) isPoolClaimed(dockerID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.poolClaims[dockerID]
+	return ok
+}
+
+// claimedLabels returns a container's Docker labels with its claim applied
+func (m *Manager) claimedLabels(dockerID string, labels map[string]string) map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if claimed, ok := m.poolClaims[dockerID]; ok {
+		return mergeLabels(labels, claimed)
+	}
+	return labels
+}
+
+// trackClaimed starts tracking a claimed pool member under its new owner
+func (m *Manager) trackClaimed(info *ContainerInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.poolClaims == nil {
+		m.poolClaims = make(map[string]map[string]string)
+	}
+	m.poolClaims[info.ID] = info.Labels
+	m.containers[info.ID] = info
+	m.userIndex[info.UserID] = append(m.userIndex[info.UserID], info.ID)
+}
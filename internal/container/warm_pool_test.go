@@ -0,0 +1,293 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestParseWarmPoolSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []WarmPoolEntry
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: nil},
+		{
+			name: "image and role",
+			spec: "ubuntu:standard=3, alpine=2",
+			want: []WarmPoolEntry{
+				{ImageType: "ubuntu", Role: "standard", Size: 3},
+				{ImageType: "alpine", Size: 2},
+			},
+		},
+		{name: "missing size", spec: "ubuntu:standard", wantErr: true},
+		{name: "zero size", spec: "ubuntu=0", wantErr: true},
+		{name: "too large", spec: "ubuntu=1000", wantErr: true},
+		{name: "unknown image", spec: "nope=1", wantErr: true},
+		{name: "macos", spec: "macos=1", wantErr: true},
+		{name: "unknown role", spec: "ubuntu:wizard=1", wantErr: true},
+		{name: "duplicate", spec: "ubuntu=1,ubuntu=2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWarmPoolSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWarmPoolSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseWarmPoolSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWarmPoolConfigFromEnv(t *testing.T) {
+	t.Setenv("WARM_POOL", "debian:node=2")
+	t.Setenv("WARM_POOL_MODE", "stopped")
+	t.Setenv("WARM_POOL_INTERVAL", "10s")
+	t.Setenv("WARM_POOL_DISK_MB", "2048")
+
+	cfg, err := WarmPoolConfigFromEnv()
+	if err != nil {
+		t.Fatalf("WarmPoolConfigFromEnv() error = %v", err)
+	}
+	if len(cfg.Entries) != 1 || cfg.Entries[0].Role != "node" {
+		t.Errorf("Entries = %+v", cfg.Entries)
+	}
+	if cfg.Mode != PoolModeStopped || cfg.RefillInterval != 10*time.Second || cfg.DiskQuota != 2048*1024*1024 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+
+	t.Setenv("WARM_POOL_MODE", "frozen")
+	if _, err := WarmPoolConfigFromEnv(); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
+
+type fakePoolClaimStore struct {
+	claims map[string]map[string]string
+	err    error
+}
+
+func (s *fakePoolClaimStore) SavePoolClaim(ctx context.Context, dockerID string, labels map[string]string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.claims[dockerID] = labels
+	return nil
+}
+
+func (s *fakePoolClaimStore) GetPoolClaims(ctx context.Context) (map[string]map[string]string, error) {
+	return s.claims, nil
+}
+
+func (s *fakePoolClaimStore) DeletePoolClaim(ctx context.Context, dockerID string) error {
+	delete(s.claims, dockerID)
+	return nil
+}
+
+func newTestPool(mockClient *MockDockerClient, store *fakePoolClaimStore) *WarmPool {
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+	}
+	return NewWarmPool(manager, store, WarmPoolConfig{
+		Entries: []WarmPoolEntry{{ImageType: "ubuntu", Role: "standard", Size: 2}},
+	})
+}
+
+func TestWarmPool_Eligible(t *testing.T) {
+	pool := newTestPool(&MockDockerClient{}, &fakePoolClaimStore{claims: map[string]map[string]string{}})
+
+	tests := []struct {
+		name string
+		cfg  ContainerConfig
+		want bool
+	}{
+		{name: "matching pair", cfg: ContainerConfig{ImageType: "ubuntu", Role: "standard"}, want: true},
+		{name: "other role", cfg: ContainerConfig{ImageType: "ubuntu", Role: "node"}, want: false},
+		{name: "no role", cfg: ContainerConfig{ImageType: "ubuntu"}, want: false},
+		{name: "custom image", cfg: ContainerConfig{ImageType: "custom", CustomImage: "ubuntu:24.04", Role: "standard"}, want: false},
+		{name: "snapshot", cfg: ContainerConfig{ImageType: "ubuntu", Role: "standard", SnapshotArchive: "/tmp/s.tar"}, want: false},
+		{name: "env", cfg: ContainerConfig{ImageType: "ubuntu", Role: "standard", Env: []string{"A=b"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pool.Eligible(tt.cfg); got != tt.want {
+				t.Errorf("Eligible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarmPool_Claim(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	store := &fakePoolClaimStore{claims: map[string]map[string]string{}}
+	pool := newTestPool(mockClient, store)
+
+	mockClient.ContainerInspectFunc = func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{HostConfig: &container.HostConfig{}},
+			Config: &container.Config{Labels: map[string]string{
+				"rexec.user_id": poolUserID,
+				"rexec.managed": "true",
+				PoolLabel:       "ubuntu/standard",
+			}},
+			Mounts: []types.MountPoint{{Name: "rexec-warm-pool-pool-1", Destination: "/home/user"}},
+		}, nil
+	}
+	var unpaused, renamedTo string
+	mockClient.ContainerUnpauseFunc = func(ctx context.Context, containerID string) error {
+		unpaused = containerID
+		return nil
+	}
+	mockClient.ContainerRenameFunc = func(ctx context.Context, containerID, newName string) error {
+		renamedTo = newName
+		return nil
+	}
+
+	cfg := ContainerConfig{
+		UserID:        "user-1",
+		ContainerName: "dev",
+		ImageType:     "ubuntu",
+		Role:          "standard",
+		MemoryLimit:   1024 * 1024 * 1024,
+		CPULimit:      1000,
+		Labels:        map[string]string{"rexec.tier": "guest"},
+	}
+
+	// Empty pool is a miss
+	if _, ok := pool.Claim(context.Background(), cfg); ok {
+		t.Fatal("Claim() on empty pool should miss")
+	}
+
+	pool.ready["ubuntu/standard"] = []*poolMember{{ID: "warm-member-0001", Key: "ubuntu/standard"}}
+	info, ok := pool.Claim(context.Background(), cfg)
+	if !ok {
+		t.Fatal("Claim() should succeed")
+	}
+
+	if unpaused != "warm-member-0001" || renamedTo != "rexec-user-1-dev" {
+		t.Errorf("unpaused = %q, renamed to %q", unpaused, renamedTo)
+	}
+	if info.UserID != "user-1" || info.VolumeName != "rexec-warm-pool-pool-1" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.Labels["rexec.user_id"] != "user-1" || info.Labels["rexec.tier"] != "guest" || info.Labels[PoolClaimedLabel] != "true" {
+		t.Errorf("labels = %v", info.Labels)
+	}
+	if store.claims["warm-member-0001"]["rexec.container_name"] != "dev" {
+		t.Errorf("claim not persisted: %v", store.claims)
+	}
+	if got, ok := pool.manager.GetContainer("warm-member-0001"); !ok || got.UserID != "user-1" {
+		t.Errorf("claimed container not tracked for its owner")
+	}
+
+	health := pool.Health()
+	if health.Claims != 1 || health.Misses != 1 || health.Entries[0].Ready != 0 {
+		t.Errorf("health = %+v", health)
+	}
+}
+
+func TestWarmPool_ClaimFailureFallsBack(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	store := &fakePoolClaimStore{claims: map[string]map[string]string{}, err: errors.New("db down")}
+	pool := newTestPool(mockClient, store)
+
+	var removed string
+	mockClient.ContainerRemoveFunc = func(ctx context.Context, containerID string, options container.RemoveOptions) error {
+		removed = containerID
+		return nil
+	}
+
+	pool.ready["ubuntu/standard"] = []*poolMember{{ID: "warm-member-0001", Key: "ubuntu/standard"}}
+	if _, ok := pool.Claim(context.Background(), ContainerConfig{UserID: "user-1", ContainerName: "dev", ImageType: "ubuntu", Role: "standard"}); ok {
+		t.Fatal("Claim() should fail when the claim can't be saved")
+	}
+	if removed != "warm-member-0001" {
+		t.Errorf("failed member should be removed, removed = %q", removed)
+	}
+	if _, ok := pool.manager.GetContainer("warm-member-0001"); ok {
+		t.Error("failed member should not be tracked")
+	}
+	if pool.Health().Failures != 1 {
+		t.Errorf("failures = %d, want 1", pool.Health().Failures)
+	}
+}
+
+func TestManager_LoadExistingContainers_PoolMembers(t *testing.T) {
+	mockClient := &MockDockerClient{}
+	manager := &Manager{
+		client:     mockClient,
+		containers: make(map[string]*ContainerInfo),
+		userIndex:  make(map[string][]string),
+		poolClaims: map[string]map[string]string{
+			"claimed": {"rexec.user_id": "user-1", "rexec.container_name": "dev", "rexec.tier": "guest"},
+		},
+	}
+
+	poolLabels := map[string]string{
+		"rexec.managed":        "true",
+		"rexec.user_id":        poolUserID,
+		"rexec.container_name": "pool-abc",
+		PoolLabel:              "ubuntu/standard",
+	}
+	mockClient.ContainerListFunc = func(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
+		return []types.Container{
+			{ID: "claimed", State: "running", Labels: poolLabels},
+			{ID: "unclaimed", State: "paused", Labels: poolLabels},
+		}, nil
+	}
+
+	if err := manager.LoadExistingContainers(context.Background()); err != nil {
+		t.Fatalf("LoadExistingContainers() error = %v", err)
+	}
+
+	if _, ok := manager.GetContainer("unclaimed"); ok {
+		t.Error("unclaimed pool member should not be tracked")
+	}
+	info, ok := manager.GetContainer("claimed")
+	if !ok || info.UserID != "user-1" || info.ContainerName != "dev" {
+		t.Fatalf("claimed member = %+v", info)
+	}
+	if !manager.IsGuestContainer("claimed") {
+		t.Error("claim labels should apply to the claimed member")
+	}
+}
+
+func TestGetIdleContainers_SkipsPoolMembers(t *testing.T) {
+	manager := &Manager{
+		containers: map[string]*ContainerInfo{
+			"member": {
+				ID:         "member",
+				Status:     "running",
+				LastUsedAt: time.Now().Add(-2 * time.Hour),
+				Labels:     map[string]string{"rexec.user_id": poolUserID, PoolLabel: "ubuntu/", "rexec.tier": "guest"},
+			},
+		},
+		userIndex: make(map[string][]string),
+	}
+
+	if idle := manager.GetIdleContainers(time.Hour); len(idle) != 0 {
+		t.Errorf("GetIdleContainers() returned pool member")
+	}
+	if expired := manager.GetExpiredGuestContainers(); len(expired) != 0 {
+		t.Errorf("GetExpiredGuestContainers() returned pool member")
+	}
+}
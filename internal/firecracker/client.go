@@ -42,6 +42,41 @@ func NewFirecrackerClient(socketPath string) *FirecrackerClient {
 
 // StartFirecrackerProcess starts the Firecracker process
 func StartFirecrackerProcess(ctx context.Context, socketPath, kernelPath, rootfsPath string, config *VMConfig) (*FirecrackerClient, error) {
+	client, err := launchFirecracker(ctx, socketPath, config.VMName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure the VM
+	if err := client.ConfigureVM(ctx, kernelPath, rootfsPath, config); err != nil {
+		client.process.Process.Kill()
+		return nil, fmt.Errorf("failed to configure VM: %w", err)
+	}
+
+	return client, nil
+}
+
+// RestoreFirecrackerProcess starts a Firecracker process from a saved
+// VM state and memory file and resumes the guest where it was paused.
+// The snapshot references the original rootfs and tap device, which must
+// still exist at the same paths.
+func RestoreFirecrackerProcess(ctx context.Context, socketPath, vmName, statePath, memPath string) (*FirecrackerClient, error) {
+	client, err := launchFirecracker(ctx, socketPath, vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.LoadSnapshot(ctx, statePath, memPath, true); err != nil {
+		client.process.Process.Kill()
+		client.process.Wait()
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	return client, nil
+}
+
+// launchFirecracker starts an unconfigured Firecracker process and waits for its API socket
+func launchFirecracker(ctx context.Context, socketPath, vmName string) (*FirecrackerClient, error) {
 	// Find Firecracker binary
 	firecrackerPath := os.Getenv("FIRECRACKER_BINARY_PATH")
 	if firecrackerPath == "" {
@@ -68,7 +103,7 @@ func StartFirecrackerProcess(ctx context.Context, socketPath, kernelPath, rootfs
 	// Start Firecracker process
 	cmd := exec.CommandContext(ctx, firecrackerPath,
 		"--api-sock", socketPath,
-		"--id", config.VMName,
+		"--id", vmName,
 	)
 
 	// Set up logging
@@ -103,12 +138,6 @@ func StartFirecrackerProcess(ctx context.Context, socketPath, kernelPath, rootfs
 	client := NewFirecrackerClient(socketPath)
 	client.process = cmd
 
-	// Configure the VM
-	if err := client.ConfigureVM(ctx, kernelPath, rootfsPath, config); err != nil {
-		cmd.Process.Kill()
-		return nil, fmt.Errorf("failed to configure VM: %w", err)
-	}
-
 	return client, nil
 }
 
@@ -233,6 +262,45 @@ func (c *FirecrackerClient) StopVM(ctx context.Context) error {
 	})
 }
 
+// PauseVM freezes the guest's vCPUs
+func (c *FirecrackerClient) PauseVM(ctx context.Context) error {
+	return c.patch(ctx, "/vm", map[string]interface{}{
+		"state": "Paused",
+	})
+}
+
+// ResumeVM resumes a paused guest
+func (c *FirecrackerClient) ResumeVM(ctx context.Context) error {
+	return c.patch(ctx, "/vm", map[string]interface{}{
+		"state": "Resumed",
+	})
+}
+
+// CreateSnapshot writes the paused VM's device state and guest memory to disk.
+// The disk contents are not included; the rootfs must be kept alongside.
+func (c *FirecrackerClient) CreateSnapshot(ctx context.Context, statePath, memPath string) error {
+	return c.put(ctx, "/snapshot/create", map[string]interface{}{
+		"snapshot_type": "Full",
+		"snapshot_path": statePath,
+		"mem_file_path": memPath,
+	})
+}
+
+// LoadSnapshot restores a VM from files written by CreateSnapshot. It must be
+// called on a fresh Firecracker process before any other configuration.
+// Guest memory is mapped from the file and paged in lazily, which is what
+// makes restores near-instant compared to a cold boot.
+func (c *FirecrackerClient) LoadSnapshot(ctx context.Context, statePath, memPath string, resume bool) error {
+	return c.put(ctx, "/snapshot/load", map[string]interface{}{
+		"snapshot_path": statePath,
+		"mem_backend": map[string]interface{}{
+			"backend_type": "File",
+			"backend_path": memPath,
+		},
+		"resume_vm": resume,
+	})
+}
+
 // GetVMInfo retrieves VM information
 func (c *FirecrackerClient) GetVMInfo(ctx context.Context) (map[string]interface{}, error) {
 	return c.get(ctx, "/vm")
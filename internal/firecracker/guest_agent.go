@@ -42,9 +42,12 @@ type GuestAgentError struct {
 
 // ExecParams holds parameters for exec command
 type ExecParams struct {
-	Command []string `json:"command"`
-	Timeout int      `json:"timeout,omitempty"` // seconds
+	Command []string          `json:"command"`
+	Timeout int               `json:"timeout,omitempty"` // seconds
 	Env     map[string]string `json:"env,omitempty"`
+	Cwd     string            `json:"cwd,omitempty"`
+	Stdin   string            `json:"stdin,omitempty"`
+	User    string            `json:"user,omitempty"` // user, uid or user:group
 }
 
 // ExecResult holds the result of exec command
@@ -53,8 +56,12 @@ type ExecResult struct {
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
 	Duration int64  `json:"duration_ms"`
+	TimedOut bool   `json:"timed_out,omitempty"`
 }
 
+// execResultGrace is how long past its timeout an exec's result may take
+const execResultGrace = 10 * time.Second
+
 // CopyParams holds parameters for copy operations
 type CopyParams struct {
 	Source      string `json:"source"`
@@ -199,8 +206,12 @@ func (c *GuestAgentClient) Call(ctx context.Context, method string, params inter
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	// Set read deadline
-	if err := c.conn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
+	// Set read deadline, extended to the context's for long-running calls
+	readDeadline := time.Now().Add(30 * time.Second)
+	if deadline, ok := ctx.Deadline(); ok && deadline.After(readDeadline) {
+		readDeadline = deadline
+	}
+	if err := c.conn.SetReadDeadline(readDeadline); err != nil {
 		return nil, fmt.Errorf("failed to set read deadline: %w", err)
 	}
 
@@ -225,10 +236,11 @@ func (c *GuestAgentClient) Call(ctx context.Context, method string, params inter
 }
 
 // Exec executes a command in the guest
-func (c *GuestAgentClient) Exec(ctx context.Context, cmd []string, timeout int) (*ExecResult, error) {
-	params := ExecParams{
-		Command: cmd,
-		Timeout: timeout,
+func (c *GuestAgentClient) Exec(ctx context.Context, params ExecParams) (*ExecResult, error) {
+	if params.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(params.Timeout)*time.Second+execResultGrace)
+		defer cancel()
 	}
 
 	resp, err := c.Call(ctx, "exec", params)
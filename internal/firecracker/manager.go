@@ -31,6 +31,8 @@ type Manager struct {
 	vms           map[string]*VMInfo
 	clients       map[string]*FirecrackerClient // vmID -> client
 	mu            sync.RWMutex
+	vmLocks       map[string]*sync.Mutex // vmID -> lock held while the VM starts, stops or is deleted
+	suspendOnStop bool                   // Snapshot memory on stop so Start can resume instead of boot
 	networkMgr    *NetworkManager
 	storageMgr    *StorageManager
 }
@@ -79,6 +81,15 @@ func NewManager() (*Manager, error) {
 		bridgeName = DefaultBridgeName
 	}
 
+	suspendOnStop := true
+	if v := os.Getenv("FIRECRACKER_SUSPEND_ON_STOP"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FIRECRACKER_SUSPEND_ON_STOP %q: %w", v, err)
+		}
+		suspendOnStop = parsed
+	}
+
 	// Ensure directories exist
 	if err := os.MkdirAll(socketBaseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create socket directory: %w", err)
@@ -107,6 +118,8 @@ func NewManager() (*Manager, error) {
 		bridgeName:    bridgeName,
 		vms:           make(map[string]*VMInfo),
 		clients:       make(map[string]*FirecrackerClient),
+		vmLocks:       make(map[string]*sync.Mutex),
+		suspendOnStop: suspendOnStop,
 		networkMgr:    networkMgr,
 		storageMgr:    storageMgr,
 	}
@@ -163,15 +176,16 @@ func (m *Manager) Create(ctx context.Context, cfg providers.CreateConfig) (*prov
 	}
 	m.mu.RUnlock()
 
-	// Get rootfs path for this image type
-	rootfsImage, err := m.storageMgr.GetRootfsPath(ctx, cfg.Image)
+	// Give the VM its own copy-on-write clone of the base image
+	rootfsImage, err := m.storageMgr.PrepareRootfs(ctx, cfg.Image, vmID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get rootfs path: %w", err)
+		return nil, fmt.Errorf("failed to prepare rootfs: %w", err)
 	}
 
 	// Create tap device
 	tapDevice, err := m.networkMgr.CreateTapDevice(ctx, vmID)
 	if err != nil {
+		m.storageMgr.RemoveVMStorage(vmID)
 		return nil, fmt.Errorf("failed to create tap device: %w", err)
 	}
 
@@ -220,6 +234,7 @@ func (m *Manager) Create(ctx context.Context, cfg providers.CreateConfig) (*prov
 	if err != nil {
 		// Cleanup on failure
 		m.networkMgr.DeleteTapDevice(ctx, tapDevice)
+		m.storageMgr.RemoveVMStorage(vmID)
 		return nil, fmt.Errorf("failed to start firecracker: %w", err)
 	}
 
@@ -227,6 +242,7 @@ func (m *Manager) Create(ctx context.Context, cfg providers.CreateConfig) (*prov
 	if err := client.StartVM(ctx); err != nil {
 		client.Close()
 		m.networkMgr.DeleteTapDevice(ctx, tapDevice)
+		m.storageMgr.RemoveVMStorage(vmID)
 		return nil, fmt.Errorf("failed to start VM: %w", err)
 	}
 
@@ -251,8 +267,25 @@ func (m *Manager) Create(ctx context.Context, cfg providers.CreateConfig) (*prov
 	return m.toTerminalInfo(vmInfo), nil
 }
 
+// vmLock returns the lock that serializes lifecycle operations on one VM,
+// so a slow snapshot doesn't hold m.mu and block every other VM
+func (m *Manager) vmLock(id string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock, ok := m.vmLocks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.vmLocks[id] = lock
+	}
+	return lock
+}
+
 // Start starts a stopped VM
 func (m *Manager) Start(ctx context.Context, id string) error {
+	lock := m.vmLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -267,12 +300,25 @@ func (m *Manager) Start(ctx context.Context, id string) error {
 
 	// Get or create client
 	client, ok := m.clients[id]
+	if !ok && m.storageMgr.HasVMState(id) {
+		// Resume from the memory snapshot taken on stop instead of booting
+		statePath, memPath := m.storageMgr.VMStatePaths(id)
+		restored, err := RestoreFirecrackerProcess(ctx, vm.SocketPath, id, statePath, memPath)
+		if err == nil {
+			m.clients[id] = restored
+			vm.Status = "running"
+			vm.LastUsedAt = time.Now()
+			return nil
+		}
+		log.Printf("[Firecracker] Failed to restore VM %s from snapshot, cold booting: %v", id, err)
+		m.storageMgr.RemoveVMState(id)
+	}
 	if !ok {
 		// VM was stopped, need to recreate Firecracker process
 		// Get rootfs path
-		rootfsImage, err := m.storageMgr.GetRootfsPath(ctx, vm.ImageType)
+		rootfsImage, err := m.storageMgr.PrepareRootfs(ctx, vm.ImageType, id)
 		if err != nil {
-			return fmt.Errorf("failed to get rootfs path: %w", err)
+			return fmt.Errorf("failed to prepare rootfs: %w", err)
 		}
 
 		// Recreate VM config
@@ -333,41 +379,68 @@ func (m *Manager) Start(ctx context.Context, id string) error {
 	return nil
 }
 
-// Stop stops a running VM
+// Stop stops a running VM. The snapshot is written under the VM's own lock,
+// not m.mu, since it can take as long as writing out the VM's memory.
 func (m *Manager) Stop(ctx context.Context, id string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	lock := m.vmLock(id)
+	lock.Lock()
+	defer lock.Unlock()
 
+	m.mu.RLock()
 	vm, ok := m.vms[id]
 	if !ok {
+		m.mu.RUnlock()
 		return fmt.Errorf("VM %s not found", id)
 	}
-
 	if vm.Status == "stopped" {
+		m.mu.RUnlock()
 		return nil // Already stopped
 	}
+	client, hasClient := m.clients[id]
+	m.mu.RUnlock()
 
 	// Stop via Firecracker API
-	client, ok := m.clients[id]
-	if ok {
-		if err := client.StopVM(ctx); err != nil {
-			log.Printf("[Firecracker] Failed to stop VM %s: %v", id, err)
+	if hasClient {
+		if m.suspendOnStop {
+			// Save memory and device state so Start can resume without a boot
+			if err := m.suspendVM(ctx, id, client); err != nil {
+				log.Printf("[Firecracker] Failed to snapshot VM %s, shutting down: %v", id, err)
+				m.shutdownVM(ctx, id, client)
+			}
+		} else {
+			m.shutdownVM(ctx, id, client)
 		}
 		// Close client (stops process)
 		client.Close()
-		delete(m.clients, id)
 	}
 
+	m.mu.Lock()
+	delete(m.clients, id)
 	vm.Status = "stopped"
+	m.mu.Unlock()
 
 	return nil
 }
 
+// shutdownVM stops the guest without a snapshot, dropping any earlier one so
+// the next Start boots from the rootfs
+func (m *Manager) shutdownVM(ctx context.Context, id string, client *FirecrackerClient) {
+	m.storageMgr.RemoveVMState(id)
+	if err := client.StopVM(ctx); err != nil {
+		log.Printf("[Firecracker] Failed to stop VM %s: %v", id, err)
+	}
+}
+
 // Delete removes a VM
 func (m *Manager) Delete(ctx context.Context, id string) error {
+	lock := m.vmLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
 	m.mu.Lock()
 	vm, ok := m.vms[id]
 	if !ok {
+		delete(m.vmLocks, id)
 		m.mu.Unlock()
 		return fmt.Errorf("VM %s not found", id)
 	}
@@ -376,6 +449,7 @@ func (m *Manager) Delete(ctx context.Context, id string) error {
 	client, hasClient := m.clients[id]
 	delete(m.vms, id)
 	delete(m.clients, id)
+	delete(m.vmLocks, id)
 	m.mu.Unlock()
 
 	// Stop VM if running
@@ -400,9 +474,38 @@ func (m *Manager) Delete(ctx context.Context, id string) error {
 		}
 	}
 
+	// Clean up rootfs clone and saved state
+	if err := m.storageMgr.RemoveVMStorage(id); err != nil {
+		log.Printf("[Firecracker] Warning: failed to remove storage for VM %s: %v", id, err)
+	}
+
 	return nil
 }
 
+// suspendVM pauses the guest and writes a full snapshot next to its rootfs.
+// Files are written under temporary names first: a restored VM maps its
+// memory file privately, so the old file must not be truncated under it.
+func (m *Manager) suspendVM(ctx context.Context, id string, client *FirecrackerClient) error {
+	if err := client.PauseVM(ctx); err != nil {
+		return fmt.Errorf("failed to pause: %w", err)
+	}
+
+	statePath, memPath := m.storageMgr.VMStatePaths(id)
+	if err := client.CreateSnapshot(ctx, statePath+".tmp", memPath+".tmp"); err != nil {
+		os.Remove(statePath + ".tmp")
+		os.Remove(memPath + ".tmp")
+		client.ResumeVM(ctx)
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	// Drop the old state file first so a half-finished swap is never loaded
+	os.Remove(statePath)
+	if err := os.Rename(memPath+".tmp", memPath); err != nil {
+		return err
+	}
+	return os.Rename(statePath+".tmp", statePath)
+}
+
 // Get retrieves VM information
 func (m *Manager) Get(ctx context.Context, id string) (*providers.TerminalInfo, error) {
 	m.mu.RLock()
@@ -502,7 +605,7 @@ func (m *Manager) Exec(ctx context.Context, id string, cmd []string) ([]byte, er
 	defer agent.Close()
 
 	// Execute command
-	result, err := agent.Exec(ctx, cmd, 30)
+	result, err := agent.Exec(ctx, ExecParams{Command: cmd, Timeout: 30})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package firecracker
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is only available through FICLONE on Linux
+func reflink(dst, src *os.File) error {
+	return errors.New("reflink not supported on this platform")
+}
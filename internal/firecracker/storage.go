@@ -3,10 +3,15 @@ package firecracker
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// copyBlockSize is the granularity used to detect holes during a sparse copy
+const copyBlockSize = 64 * 1024
+
 // StorageManager handles storage operations for Firecracker VMs
 type StorageManager struct {
 	rootfsBasePath string
@@ -41,14 +46,220 @@ func (sm *StorageManager) GetRootfsPath(ctx context.Context, imageType string) (
 	return rootfsPath, nil
 }
 
-// CreateSnapshot creates a snapshot of a VM's rootfs
+// VMRootfsPath returns the path of a VM's private, writable rootfs
+func (sm *StorageManager) VMRootfsPath(vmID string) string {
+	return filepath.Join(sm.rootfsBasePath, "vms", vmID, "rootfs.ext4")
+}
+
+// VMStatePaths returns where a VM's saved device state and guest memory are kept
+func (sm *StorageManager) VMStatePaths(vmID string) (statePath, memPath string) {
+	dir := filepath.Join(sm.rootfsBasePath, "vms", vmID)
+	return filepath.Join(dir, "vmstate.snap"), filepath.Join(dir, "memory.snap")
+}
+
+// HasVMState reports whether a complete memory snapshot exists for the VM
+func (sm *StorageManager) HasVMState(vmID string) bool {
+	statePath, memPath := sm.VMStatePaths(vmID)
+	if _, err := os.Stat(statePath); err != nil {
+		return false
+	}
+	_, err := os.Stat(memPath)
+	return err == nil
+}
+
+// RemoveVMState discards a VM's memory snapshot so the next start cold boots
+func (sm *StorageManager) RemoveVMState(vmID string) {
+	statePath, memPath := sm.VMStatePaths(vmID)
+	os.Remove(statePath)
+	os.Remove(memPath)
+}
+
+// PrepareRootfs gives a VM its own copy-on-write clone of the base image.
+// An existing per-VM rootfs is reused so restarts keep the guest's changes.
+func (sm *StorageManager) PrepareRootfs(ctx context.Context, imageType, vmID string) (string, error) {
+	if err := validateStorageName(vmID); err != nil {
+		return "", err
+	}
+
+	dst := sm.VMRootfsPath(vmID)
+	if _, err := os.Stat(dst); err == nil {
+		return dst, nil
+	}
+
+	base, err := sm.GetRootfsPath(ctx, imageType)
+	if err != nil {
+		return "", err
+	}
+
+	if err := cloneFile(base, dst); err != nil {
+		return "", fmt.Errorf("failed to clone rootfs for %s: %w", vmID, err)
+	}
+	return dst, nil
+}
+
+// RemoveVMStorage deletes a VM's rootfs clone and any saved state
+func (sm *StorageManager) RemoveVMStorage(vmID string) error {
+	if err := validateStorageName(vmID); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(sm.rootfsBasePath, "vms", vmID))
+}
+
+// CreateSnapshot creates a snapshot of a VM's rootfs.
+// The VM should be paused or stopped so the filesystem is consistent.
 func (sm *StorageManager) CreateSnapshot(ctx context.Context, vmID, snapshotName string) (string, error) {
-	// TODO: Implement ZFS snapshot or copy-based snapshot
-	return "", fmt.Errorf("snapshots not yet implemented")
+	if err := validateStorageName(vmID); err != nil {
+		return "", err
+	}
+	if err := validateStorageName(snapshotName); err != nil {
+		return "", err
+	}
+
+	src := sm.VMRootfsPath(vmID)
+	if _, err := os.Stat(src); err != nil {
+		return "", fmt.Errorf("rootfs for VM %s not found: %w", vmID, err)
+	}
+
+	dst := sm.snapshotPath(snapshotName)
+	if _, err := os.Stat(dst); err == nil {
+		return "", fmt.Errorf("snapshot %s already exists", snapshotName)
+	}
+
+	if err := cloneFile(src, dst); err != nil {
+		return "", fmt.Errorf("failed to snapshot VM %s: %w", vmID, err)
+	}
+	return dst, nil
 }
 
 // CloneFromSnapshot creates a new rootfs from a snapshot
 func (sm *StorageManager) CloneFromSnapshot(ctx context.Context, snapshotName string, newVMID string) (string, error) {
-	// TODO: Implement ZFS clone or copy-based clone
-	return "", fmt.Errorf("cloning not yet implemented")
+	if err := validateStorageName(snapshotName); err != nil {
+		return "", err
+	}
+	if err := validateStorageName(newVMID); err != nil {
+		return "", err
+	}
+
+	src := sm.snapshotPath(snapshotName)
+	if _, err := os.Stat(src); err != nil {
+		return "", fmt.Errorf("snapshot %s not found: %w", snapshotName, err)
+	}
+
+	dst := sm.VMRootfsPath(newVMID)
+	if _, err := os.Stat(dst); err == nil {
+		return "", fmt.Errorf("rootfs for VM %s already exists", newVMID)
+	}
+
+	if err := cloneFile(src, dst); err != nil {
+		return "", fmt.Errorf("failed to clone snapshot %s: %w", snapshotName, err)
+	}
+	return dst, nil
+}
+
+// DeleteSnapshot removes a rootfs snapshot
+func (sm *StorageManager) DeleteSnapshot(ctx context.Context, snapshotName string) error {
+	if err := validateStorageName(snapshotName); err != nil {
+		return err
+	}
+	if err := os.Remove(sm.snapshotPath(snapshotName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (sm *StorageManager) snapshotPath(snapshotName string) string {
+	return filepath.Join(sm.rootfsBasePath, "snapshots", snapshotName+".ext4")
+}
+
+// validateStorageName keeps VM and snapshot names from escaping the storage tree
+func validateStorageName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid storage name %q", name)
+	}
+	return nil
+}
+
+// cloneFile copies src to dst, sharing extents with a reflink when the
+// filesystem supports it (btrfs, xfs) and falling back to a sparse copy.
+// The result is written to a temporary file and renamed into place so a
+// failed copy never leaves a truncated image behind.
+func cloneFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if err := reflink(tmp, in); err != nil {
+		if err := sparseCopy(tmp, in); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+// sparseCopy copies src into dst without writing blocks that are all zero,
+// leaving holes in dst so unused space in the image is not allocated.
+func sparseCopy(dst, src *os.File) error {
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := dst.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	buf := make([]byte, copyBlockSize)
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if isZero(buf[:n]) {
+				if _, err := dst.Seek(int64(n), io.SeekCurrent); err != nil {
+					return err
+				}
+			} else if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Trailing holes are only materialised by setting the final size
+	return dst.Truncate(info.Size())
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
 }
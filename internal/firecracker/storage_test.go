@@ -0,0 +1,96 @@
+package firecracker
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSparseCopy(t *testing.T) {
+	dir := t.TempDir()
+
+	// Data, a hole spanning several blocks, more data, then a trailing hole
+	size := int64(copyBlockSize*8 + 123)
+	src, err := os.Create(filepath.Join(dir, "src.ext4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.WriteAt([]byte("head"), 0)
+	src.WriteAt([]byte("middle"), copyBlockSize*5+7)
+	if err := src.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filepath.Join(dir, "dst.ext4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if err := sparseCopy(dst, src); err != nil {
+		t.Fatalf("sparseCopy() error = %v", err)
+	}
+
+	want, _ := os.ReadFile(src.Name())
+	got, _ := os.ReadFile(dst.Name())
+	if int64(len(got)) != size {
+		t.Fatalf("copy size = %d, want %d", len(got), size)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("copy contents differ from source")
+	}
+}
+
+func TestStorageManager_SnapshotAndClone(t *testing.T) {
+	sm, err := NewStorageManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	base := filepath.Join(sm.rootfsBasePath, "images", MapImageTypeToFileName("ubuntu"))
+	os.MkdirAll(filepath.Dir(base), 0755)
+	if err := os.WriteFile(base, []byte("base-image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rootfs, err := sm.PrepareRootfs(ctx, "ubuntu", "vm-1")
+	if err != nil {
+		t.Fatalf("PrepareRootfs() error = %v", err)
+	}
+
+	// Writes to the VM's rootfs must not leak into the base image
+	os.WriteFile(rootfs, []byte("vm-1-changes"), 0644)
+	if data, _ := os.ReadFile(base); string(data) != "base-image" {
+		t.Errorf("base image modified: %q", data)
+	}
+
+	if _, err := sm.CreateSnapshot(ctx, "vm-1", "snap"); err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+	if _, err := sm.CreateSnapshot(ctx, "vm-1", "snap"); err == nil {
+		t.Error("CreateSnapshot() should refuse to overwrite an existing snapshot")
+	}
+
+	clone, err := sm.CloneFromSnapshot(ctx, "snap", "vm-2")
+	if err != nil {
+		t.Fatalf("CloneFromSnapshot() error = %v", err)
+	}
+	if data, _ := os.ReadFile(clone); string(data) != "vm-1-changes" {
+		t.Errorf("clone contents = %q, want vm-1-changes", data)
+	}
+
+	if _, err := sm.CloneFromSnapshot(ctx, "../snap", "vm-3"); err == nil {
+		t.Error("CloneFromSnapshot() should reject path traversal")
+	}
+
+	if err := sm.RemoveVMStorage("vm-2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(clone); !os.IsNotExist(err) {
+		t.Error("RemoveVMStorage() left the rootfs behind")
+	}
+}
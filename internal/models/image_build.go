@@ -0,0 +1,68 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// MaxDockerfileBytes caps an inline Dockerfile
+const MaxDockerfileBytes = 64 * 1024
+
+// BuildImagePrefix selects a built image in a create request, e.g. "build:go-toolchain"
+const BuildImagePrefix = "build:"
+
+var imageBuildNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// ImageBuildRequest builds a custom image from an inline Dockerfile or from
+// a public git repository containing one
+type ImageBuildRequest struct {
+	Name           string `json:"name" binding:"required"` // Image tag, e.g. "go-toolchain"
+	Dockerfile     string `json:"dockerfile,omitempty"`    // Inline Dockerfile; replaces the repo's when both are set
+	RepoURL        string `json:"repo_url,omitempty"`
+	Ref            string `json:"ref,omitempty"`
+	Path           string `json:"path,omitempty"`            // Build context directory inside the repo
+	DockerfilePath string `json:"dockerfile_path,omitempty"` // Relative to path (default: Dockerfile)
+	NoCache        bool   `json:"no_cache,omitempty"`
+}
+
+// Validate checks the request before anything is cloned or built
+func (r *ImageBuildRequest) Validate() error {
+	if !imageBuildNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("name must be 1-64 characters: lowercase letters, digits, '.', '_' or '-'")
+	}
+	if r.Dockerfile == "" && r.RepoURL == "" {
+		return fmt.Errorf("dockerfile or repo_url is required")
+	}
+	if len(r.Dockerfile) > MaxDockerfileBytes {
+		return fmt.Errorf("dockerfile exceeds %d bytes", MaxDockerfileBytes)
+	}
+	if r.RepoURL == "" {
+		if r.Ref != "" || r.Path != "" || r.DockerfilePath != "" {
+			return fmt.Errorf("ref, path and dockerfile_path need a repo_url")
+		}
+		return nil
+	}
+
+	if err := ValidateGitURL(r.RepoURL); err != nil {
+		return fmt.Errorf("repo_url %v", err)
+	}
+	if r.Ref != "" && !templateRefPattern.MatchString(r.Ref) {
+		return fmt.Errorf("invalid ref %q", r.Ref)
+	}
+	for _, p := range []string{r.Path, r.DockerfilePath} {
+		if p != "" && (path.IsAbs(p) || strings.HasPrefix(path.Clean(p), "..")) {
+			return fmt.Errorf("paths must be relative to the repository")
+		}
+	}
+	return nil
+}
+
+// BuildImageName returns the build name of a "build:<name>" image reference
+func BuildImageName(imageType string) (string, bool) {
+	if !strings.HasPrefix(imageType, BuildImagePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(imageType, BuildImagePrefix), true
+}
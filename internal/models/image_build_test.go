@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImageBuildRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ImageBuildRequest
+		wantErr bool
+	}{
+		{"Inline Dockerfile", ImageBuildRequest{Name: "go-toolchain", Dockerfile: "FROM golang"}, false},
+		{"Repo", ImageBuildRequest{Name: "api", RepoURL: "https://github.com/me/api", Ref: "main", Path: "docker", DockerfilePath: "Dockerfile.dev"}, false},
+		{"Repo with inline Dockerfile", ImageBuildRequest{Name: "api", RepoURL: "https://github.com/me/api", Dockerfile: "FROM alpine"}, false},
+		{"Uppercase name", ImageBuildRequest{Name: "Go", Dockerfile: "FROM golang"}, true},
+		{"Name with colon", ImageBuildRequest{Name: "go:1.22", Dockerfile: "FROM golang"}, true},
+		{"Nothing to build", ImageBuildRequest{Name: "go"}, true},
+		{"Dockerfile too large", ImageBuildRequest{Name: "go", Dockerfile: strings.Repeat("x", MaxDockerfileBytes+1)}, true},
+		{"Path without repo", ImageBuildRequest{Name: "go", Dockerfile: "FROM golang", Path: "docker"}, true},
+		{"SSH repo", ImageBuildRequest{Name: "api", RepoURL: "git@github.com:me/api.git"}, true},
+		{"Option-like ref", ImageBuildRequest{Name: "api", RepoURL: "https://github.com/me/api", Ref: "--upload-pack=x"}, true},
+		{"Path escapes repo", ImageBuildRequest{Name: "api", RepoURL: "https://github.com/me/api", Path: "../../etc"}, true},
+		{"Absolute Dockerfile", ImageBuildRequest{Name: "api", RepoURL: "https://github.com/me/api", DockerfilePath: "/etc/passwd"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildImageName(t *testing.T) {
+	if name, ok := BuildImageName("build:go-toolchain"); !ok || name != "go-toolchain" {
+		t.Errorf("BuildImageName() = %q, %v", name, ok)
+	}
+	if _, ok := BuildImageName("ubuntu"); ok {
+		t.Error("ubuntu is not a build image")
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Kinds of container incidents
+const (
+	IncidentOOMKill        = "oom_kill"        // The kernel killed a process for going over the memory limit
+	IncidentCrash          = "crash"           // The terminal stopped without being asked to
+	IncidentUnhealthy      = "unhealthy"       // The image's health check started failing
+	IncidentMemoryPressure = "memory_pressure" // Memory use reached IncidentUsageThreshold of the limit
+	IncidentDiskFull       = "disk_full"       // Disk use reached IncidentUsageThreshold of the quota
+)
+
+// Actions taken in response to an incident
+const (
+	IncidentActionNone       = "none"
+	IncidentActionRestarted  = "restarted"
+	IncidentActionGrewMemory = "grew_memory"
+)
+
+// IncidentUsageThreshold is the share of a limit at which usage becomes an incident
+const IncidentUsageThreshold = 0.95
+
+// IncidentPolicy is what Rexec does on its own when a terminal has an incident
+type IncidentPolicy struct {
+	// AutoRestart starts a terminal again after it crashes or turns unhealthy
+	AutoRestart bool `json:"auto_restart"`
+	// AutoGrowMemory raises the memory limit by half, up to the tier's
+	// maximum, on an OOM kill or memory pressure
+	AutoGrowMemory bool `json:"auto_grow_memory"`
+}
+
+// IsEmpty reports whether the policy takes no action
+func (p *IncidentPolicy) IsEmpty() bool {
+	return p == nil || (!p.AutoRestart && !p.AutoGrowMemory)
+}
+
+// ContainerIncident is a terminal running out of a resource, crashing or
+// failing its health check, and what was done about it
+type ContainerIncident struct {
+	ID          string                 `json:"id"`
+	ContainerID string                 `json:"container_id"`
+	DockerID    string                 `json:"docker_id"`
+	UserID      string                 `json:"user_id"`
+	Kind        string                 `json:"kind"`
+	Message     string                 `json:"message"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	Action      string                 `json:"action"`
+	ActionError string                 `json:"action_error,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+}
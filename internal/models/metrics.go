@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Sources resource metrics are recorded for
+const (
+	MetricsSourceContainer = "container"
+	MetricsSourceAgent     = "agent"
+)
+
+// MetricsSampleInterval is how often running terminals and agents are sampled
+const MetricsSampleInterval = 30 * time.Second
+
+// Bounds on the number of points a metrics query returns
+const (
+	DefaultMetricsPoints = 300
+	MaxMetricsPoints     = 1500
+)
+
+// MetricsTier is a resolution metrics are kept at and for how long
+type MetricsTier struct {
+	Resolution time.Duration // 0 for raw samples
+	Retention  time.Duration
+}
+
+// MetricsTiers are finest first. Raw samples are rolled up into each coarser
+// tier as its buckets complete.
+var MetricsTiers = []MetricsTier{
+	{Resolution: 0, Retention: 48 * time.Hour},
+	{Resolution: 5 * time.Minute, Retention: 30 * 24 * time.Hour},
+	{Resolution: time.Hour, Retention: 400 * 24 * time.Hour},
+}
+
+// Step is the width of the tier's buckets
+func (t MetricsTier) Step() time.Duration {
+	if t.Resolution == 0 {
+		return MetricsSampleInterval
+	}
+	return t.Resolution
+}
+
+// MetricSample is one reading of a terminal's or agent's resource usage
+type MetricSample struct {
+	Time        time.Time
+	CPUPercent  float64 // Of one core, so a busy 2-CPU terminal reads 200
+	Memory      int64
+	MemoryLimit int64
+	DiskUsage   int64
+	DiskLimit   int64
+	NetRxRate   *float64 // Bytes per second; nil when the source doesn't report it
+	NetTxRate   *float64
+}
+
+// MetricPoint is resource usage over one step of a metrics query
+type MetricPoint struct {
+	Time        time.Time `json:"t"` // Start of the step
+	Samples     int       `json:"samples"`
+	CPUPercent  float64   `json:"cpu_percent"` // Average
+	CPUMax      float64   `json:"cpu_max"`
+	Memory      int64     `json:"memory"` // Average, in bytes
+	MemoryMax   int64     `json:"memory_max"`
+	MemoryLimit int64     `json:"memory_limit"`
+	DiskUsage   int64     `json:"disk_usage"` // Peak, in bytes
+	DiskLimit   int64     `json:"disk_limit"`
+	NetRxRate   *float64  `json:"net_rx_rate,omitempty"` // Average bytes per second
+	NetTxRate   *float64  `json:"net_tx_rate,omitempty"`
+}
+
+// PlanMetricsQuery picks the tier to read [from, to) from and the step to
+// bucket it by. A zero step asks for about DefaultMetricsPoints points; any
+// step is widened to keep within MaxMetricsPoints and rounded up to a
+// multiple of the tier's resolution. The coarsest tier that still has data
+// back to from and is no coarser than the step wins.
+func PlanMetricsQuery(from, to time.Time, step time.Duration, now time.Time) (MetricsTier, time.Duration, error) {
+	if !to.After(from) {
+		return MetricsTier{}, 0, fmt.Errorf("to must be after from")
+	}
+	if step < 0 {
+		return MetricsTier{}, 0, fmt.Errorf("step must be positive")
+	}
+	span := to.Sub(from)
+	if step == 0 {
+		step = span / DefaultMetricsPoints
+	}
+	if minStep := (span + MaxMetricsPoints - 1) / MaxMetricsPoints; step < minStep {
+		step = minStep
+	}
+
+	age := now.Sub(from)
+	tier, found := MetricsTier{}, false
+	for i := len(MetricsTiers) - 1; i >= 0; i-- {
+		if t := MetricsTiers[i]; t.Step() <= step && age <= t.Retention {
+			tier, found = t, true
+			break
+		}
+	}
+	if !found {
+		// The step is finer than anything kept that far back
+		tier = MetricsTiers[len(MetricsTiers)-1]
+		for _, t := range MetricsTiers {
+			if age <= t.Retention {
+				tier = t
+				break
+			}
+		}
+	}
+
+	res := tier.Step()
+	step = (step + res - 1) / res * res
+	return tier, step, nil
+}
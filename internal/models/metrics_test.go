@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanMetricsQuery(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name           string
+		from, to       time.Time
+		step           time.Duration
+		wantResolution time.Duration
+		wantStep       time.Duration
+		wantErr        bool
+	}{
+		{"Last hour, default step", ago(time.Hour), now, 0, 0, 30 * time.Second, false},
+		{"Last hour, 1m step", ago(time.Hour), now, time.Minute, 0, time.Minute, false},
+		{"Step rounded up to the sample interval", ago(time.Hour), now, 45 * time.Second, 0, time.Minute, false},
+		{"Last day, 10m step", ago(24 * time.Hour), now, 10 * time.Minute, 5 * time.Minute, 10 * time.Minute, false},
+		{"Three days back, 1m step", ago(72 * time.Hour), now, time.Minute, 5 * time.Minute, 5 * time.Minute, false},
+		{"Last week, default step", ago(7 * 24 * time.Hour), now, 0, 5 * time.Minute, 35 * time.Minute, false},
+		{"Last quarter, 1h step widened", ago(90 * 24 * time.Hour), now, time.Hour, time.Hour, 2 * time.Hour, false},
+		{"Too many points", ago(48 * time.Hour), now, time.Second, 0, 2 * time.Minute, false},
+		{"Older than any tier", ago(500 * 24 * time.Hour), ago(499 * 24 * time.Hour), time.Minute, time.Hour, time.Hour, false},
+		{"Empty range", now, now, 0, 0, 0, true},
+		{"Negative step", ago(time.Hour), now, -time.Minute, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier, step, err := PlanMetricsQuery(tt.from, tt.to, tt.step, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PlanMetricsQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tier.Resolution != tt.wantResolution || step != tt.wantStep {
+				t.Errorf("PlanMetricsQuery() = %v tier, %v step; want %v, %v", tier.Resolution, step, tt.wantResolution, tt.wantStep)
+			}
+		})
+	}
+}
@@ -124,7 +124,7 @@ type APIToken struct {
 	Name        string     `json:"name"`                   // User-friendly name for the token
 	TokenHash   string     `json:"-"`                      // Hashed token (never exposed)
 	TokenPrefix string     `json:"token_prefix"`           // First 8 chars for identification
-	Scopes      []string   `json:"scopes"`                 // Permissions: read, write, admin
+	Scopes      []string   `json:"scopes"`                 // See scopes.go, e.g. containers:read, agents:*
 	LastUsedAt  *time.Time `json:"last_used_at,omitempty"` // Last time token was used
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`   // Optional expiration
 	CreatedAt   time.Time  `json:"created_at"`
@@ -162,13 +162,18 @@ const (
 
 // ResourceLimits defines resource constraints for a container
 type ResourceLimits struct {
-	CPUShares       int64         `json:"cpu_shares"`       // CPU shares (relative weight)
-	MemoryMB        int64         `json:"memory_mb"`        // Memory limit in MB
-	DiskMB          int64         `json:"disk_mb"`          // Disk quota in MB
-	NetworkMB       int64         `json:"network_mb"`       // Network bandwidth limit in MB/s
-	SessionDuration time.Duration `json:"session_duration"` // 0 = unlimited
-	MaxContainers   int64         `json:"max_containers"`   // Maximum number of containers allowed
-	MaxAgents       int64         `json:"max_agents"`       // Maximum number of BYOS agents allowed
+	CPUShares       int64         `json:"cpu_shares"`        // CPU shares (relative weight)
+	MemoryMB        int64         `json:"memory_mb"`         // Memory limit in MB
+	DiskMB          int64         `json:"disk_mb"`           // Disk quota in MB
+	NetworkMB       int64         `json:"network_mb"`        // Network bandwidth limit in MB/s
+	SessionDuration time.Duration `json:"session_duration"`  // 0 = unlimited
+	MaxContainers   int64         `json:"max_containers"`    // Maximum number of containers allowed
+	MaxAgents       int64         `json:"max_agents"`        // Maximum number of BYOS agents allowed
+	MaxSnapshots    int64         `json:"max_snapshots"`     // Maximum number of workspace snapshots kept
+	MaxVolumes      int64         `json:"max_volumes"`       // Maximum number of shared volumes
+	VolumeStorageMB int64         `json:"volume_storage_mb"` // Total size of all shared volumes in MB
+	MaxImages       int64         `json:"max_images"`        // Maximum number of built images
+	ImageSizeMB     int64         `json:"image_size_mb"`     // Size limit of each built image in MB
 }
 
 // GuestResourceLimits defines the very restricted limits for anonymous guest users
@@ -180,6 +185,11 @@ var GuestResourceLimits = ResourceLimits{
 	SessionDuration: 1 * time.Hour,
 	MaxContainers:   1,
 	MaxAgents:       0,
+	MaxSnapshots:    0,
+	MaxVolumes:      0,
+	VolumeStorageMB: 0,
+	MaxImages:       0,
+	ImageSizeMB:     0,
 }
 
 // Session represents an active terminal session
@@ -214,6 +224,11 @@ func GetUserResourceLimits(tier string, subscriptionActive bool) ResourceLimits
 			SessionDuration: 0, // Unlimited
 			MaxContainers:   10,
 			MaxAgents:       10,
+			MaxSnapshots:    10,
+			MaxVolumes:      10,
+			VolumeStorageMB: 51200,
+			MaxImages:       10,
+			ImageSizeMB:     10240,
 		}
 	}
 
@@ -230,6 +245,11 @@ func GetUserResourceLimits(tier string, subscriptionActive bool) ResourceLimits
 			SessionDuration: AuthenticatedSessionDuration,
 			MaxContainers:   5,
 			MaxAgents:       5,
+			MaxSnapshots:    3,
+			MaxVolumes:      3,
+			VolumeStorageMB: 5120,
+			MaxImages:       3,
+			ImageSizeMB:     4096,
 		}
 	case "pro":
 		// Legacy pro tier (if not covered by subscriptionActive check)
@@ -241,6 +261,11 @@ func GetUserResourceLimits(tier string, subscriptionActive bool) ResourceLimits
 			SessionDuration: 0,
 			MaxContainers:   10,
 			MaxAgents:       10,
+			MaxSnapshots:    10,
+			MaxVolumes:      10,
+			VolumeStorageMB: 51200,
+			MaxImages:       10,
+			ImageSizeMB:     10240,
 		}
 	case "enterprise":
 		return ResourceLimits{
@@ -251,6 +276,11 @@ func GetUserResourceLimits(tier string, subscriptionActive bool) ResourceLimits
 			SessionDuration: 0,
 			MaxContainers:   25,
 			MaxAgents:       25,
+			MaxSnapshots:    50,
+			MaxVolumes:      50,
+			VolumeStorageMB: 512000,
+			MaxImages:       50,
+			ImageSizeMB:     20480,
 		}
 	default: // Default to free limits
 		return ResourceLimits{
@@ -261,6 +291,11 @@ func GetUserResourceLimits(tier string, subscriptionActive bool) ResourceLimits
 			SessionDuration: AuthenticatedSessionDuration,
 			MaxContainers:   3,
 			MaxAgents:       0,
+			MaxSnapshots:    2,
+			MaxVolumes:      2,
+			VolumeStorageMB: 2048,
+			MaxImages:       2,
+			ImageSizeMB:     4096,
 		}
 	}
 }
@@ -311,16 +346,22 @@ func MinimalShellConfig() ShellConfig {
 
 // CreateContainerRequest represents a request to create a new container
 type CreateContainerRequest struct {
-	Name        string `json:"name"`                     // Optional - auto-generated if empty
-	Image       string `json:"image" binding:"required"` // Image type (ubuntu, debian, etc.) or "custom"
-	CustomImage string `json:"custom_image,omitempty"`   // Required when Image is "custom"
-	Role        string `json:"role,omitempty"`           // Optional role (node, python, etc.)
+	Name        string `json:"name"`                                                     // Optional - auto-generated if empty
+	Image       string `json:"image" binding:"required_without_all=SnapshotID Template"` // Image type (ubuntu, debian, etc.) or "custom"
+	CustomImage string `json:"custom_image,omitempty"`                                   // Required when Image is "custom"
+	Role        string `json:"role,omitempty"`                                           // Optional role (node, python, etc.)
+	SnapshotID  string `json:"snapshot_id,omitempty"`                                    // Optional: restore a workspace snapshot instead of a fresh image
+	Template    string `json:"template,omitempty"`                                       // Optional: environment template ID or name; explicit fields override it
 	// Shell customization
 	Shell *ShellConfig `json:"shell,omitempty"` // Optional shell config (defaults to enhanced)
 	// Trial resource customization (within limits)
 	MemoryMB  int64 `json:"memory_mb,omitempty"`  // Optional: custom memory (256-1024 MB for trial)
 	CPUShares int64 `json:"cpu_shares,omitempty"` // Optional: custom CPU shares (256-1024 for trial)
 	DiskMB    int64 `json:"disk_mb,omitempty"`    // Optional: custom disk (1024-4096 MB for trial)
+	// Resource class (small, medium, ...); replaces the custom values above
+	ResourceClass string `json:"resource_class,omitempty"`
+	// Shared volumes to mount
+	Volumes []VolumeMountRequest `json:"volumes,omitempty"`
 }
 
 // TrialResourceLimits defines the min/max resource limits for trial users
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Egress modes, from least to most restrictive
+const (
+	EgressOpen      = "open"      // everything except Deny
+	EgressAllowlist = "allowlist" // only Allow, minus Deny
+	EgressNone      = "none"      // no outbound connections at all
+)
+
+// MaxEgressRules bounds the allow and deny lists
+const MaxEgressRules = 100
+
+var egressDomainPattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,63}$`)
+
+// EgressPolicy controls which outbound connections a terminal can make.
+// Allow and Deny entries are IPs, CIDRs or domain names; domains are
+// resolved when the policy is applied (on create and start).
+type EgressPolicy struct {
+	Mode  string   `json:"mode,omitempty"` // "open" (default), "allowlist" or "none"
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Validate checks the mode and every allow/deny entry
+func (p *EgressPolicy) Validate() error {
+	switch p.Mode {
+	case "", EgressOpen, EgressAllowlist, EgressNone:
+	default:
+		return fmt.Errorf("mode must be %q, %q or %q", EgressOpen, EgressAllowlist, EgressNone)
+	}
+	if len(p.Allow) > MaxEgressRules || len(p.Deny) > MaxEgressRules {
+		return fmt.Errorf("too many egress rules (max %d each)", MaxEgressRules)
+	}
+	for _, entry := range append(append([]string{}, p.Allow...), p.Deny...) {
+		if !IsEgressTarget(entry) {
+			return fmt.Errorf("invalid egress rule %q: must be an IP, CIDR or domain", entry)
+		}
+	}
+	return nil
+}
+
+// EffectiveMode returns the policy's mode, defaulting to open
+func (p *EgressPolicy) EffectiveMode() string {
+	if p == nil || p.Mode == "" {
+		return EgressOpen
+	}
+	return p.Mode
+}
+
+// IsOpen reports whether the policy restricts nothing
+func (p *EgressPolicy) IsOpen() bool {
+	return p.EffectiveMode() == EgressOpen && len(p.Deny) == 0
+}
+
+// Restrict combines the policy with a stricter one. The result is never more
+// permissive than p, so a terminal's own policy can only tighten its tier's.
+func (p EgressPolicy) Restrict(q *EgressPolicy) EgressPolicy {
+	if q == nil {
+		return p
+	}
+
+	result := EgressPolicy{Mode: p.EffectiveMode()}
+	if egressRank(q.EffectiveMode()) > egressRank(result.Mode) {
+		result.Mode = q.EffectiveMode()
+	}
+	result.Deny = unionStrings(p.Deny, q.Deny)
+
+	if result.Mode == EgressAllowlist {
+		switch {
+		case p.EffectiveMode() == EgressAllowlist && q.EffectiveMode() == EgressAllowlist:
+			result.Allow = intersectStrings(p.Allow, q.Allow)
+		case p.EffectiveMode() == EgressAllowlist:
+			result.Allow = p.Allow
+		default:
+			result.Allow = q.Allow
+		}
+	}
+	return result
+}
+
+// IsEgressTarget reports whether s is an IP, CIDR or domain name
+func IsEgressTarget(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	return egressDomainPattern.MatchString(s)
+}
+
+func egressRank(mode string) int {
+	switch mode {
+	case EgressNone:
+		return 2
+	case EgressAllowlist:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var out []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		key := strings.ToLower(s)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func intersectStrings(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[strings.ToLower(s)] = true
+	}
+	var out []string
+	for _, s := range a {
+		if inB[strings.ToLower(s)] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// sharedAddressSpace is carrier-grade NAT space, which some clouds use for
+// metadata and other internal services
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP reports whether ip is a globally routable unicast address, so
+// not loopback, private, link-local, shared, unspecified or multicast
+func IsPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// ResolvePublicHost resolves a host the server is asked to fetch from on a
+// user's behalf and fails unless every address is public. Connect to the
+// returned addresses rather than resolving host again, so it can't be
+// rebound to an internal one in between.
+func ResolvePublicHost(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublicIP(ip) {
+			return nil, fmt.Errorf("%s is not a public address", host)
+		}
+		return []net.IP{ip}, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return nil, fmt.Errorf("could not resolve %s", host)
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return nil, fmt.Errorf("%s resolves to a non-public address", host)
+		}
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestEgressPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  EgressPolicy
+		wantErr bool
+	}{
+		{"Empty", EgressPolicy{}, false},
+		{"Allowlist", EgressPolicy{Mode: EgressAllowlist, Allow: []string{"github.com", "140.82.112.0/20", "1.1.1.1"}}, false},
+		{"Deny IPv6", EgressPolicy{Deny: []string{"fd00::/8"}}, false},
+		{"Unknown mode", EgressPolicy{Mode: "closed"}, true},
+		{"Bad entry", EgressPolicy{Deny: []string{"not a host"}}, true},
+		{"Shell in entry", EgressPolicy{Allow: []string{"github.com;reboot"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEgressPolicy_Restrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		tier     EgressPolicy
+		terminal *EgressPolicy
+		want     EgressPolicy
+	}{
+		{
+			name: "No terminal policy",
+			tier: EgressPolicy{Deny: []string{"10.0.0.0/8"}},
+			want: EgressPolicy{Deny: []string{"10.0.0.0/8"}},
+		},
+		{
+			name:     "Terminal tightens",
+			tier:     EgressPolicy{Deny: []string{"10.0.0.0/8"}},
+			terminal: &EgressPolicy{Mode: EgressAllowlist, Allow: []string{"github.com"}, Deny: []string{"192.168.0.0/16"}},
+			want:     EgressPolicy{Mode: EgressAllowlist, Allow: []string{"github.com"}, Deny: []string{"10.0.0.0/8", "192.168.0.0/16"}},
+		},
+		{
+			name:     "Terminal can't loosen",
+			tier:     EgressPolicy{Mode: EgressNone},
+			terminal: &EgressPolicy{Mode: EgressOpen},
+			want:     EgressPolicy{Mode: EgressNone},
+		},
+		{
+			name:     "Allowlists intersect",
+			tier:     EgressPolicy{Mode: EgressAllowlist, Allow: []string{"github.com", "pypi.org"}},
+			terminal: &EgressPolicy{Mode: EgressAllowlist, Allow: []string{"pypi.org", "example.com"}},
+			want:     EgressPolicy{Mode: EgressAllowlist, Allow: []string{"pypi.org"}},
+		},
+		{
+			name:     "Tier allowlist kept",
+			tier:     EgressPolicy{Mode: EgressAllowlist, Allow: []string{"github.com"}},
+			terminal: &EgressPolicy{Deny: []string{"1.1.1.1"}},
+			want:     EgressPolicy{Mode: EgressAllowlist, Allow: []string{"github.com"}, Deny: []string{"1.1.1.1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.tier.Restrict(tt.terminal)
+			if got.EffectiveMode() != tt.want.EffectiveMode() ||
+				!reflect.DeepEqual(got.Allow, tt.want.Allow) || !reflect.DeepEqual(got.Deny, tt.want.Deny) {
+				t.Errorf("Restrict() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"140.82.112.3", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestResolvePublicHost(t *testing.T) {
+	if ips, err := ResolvePublicHost(context.Background(), "1.1.1.1"); err != nil || len(ips) != 1 {
+		t.Errorf("ResolvePublicHost(1.1.1.1) = %v, %v", ips, err)
+	}
+	for _, host := range []string{"127.0.0.1", "169.254.169.254", "localhost"} {
+		if _, err := ResolvePublicHost(context.Background(), host); err == nil {
+			t.Errorf("ResolvePublicHost(%s) accepted an internal host", host)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultNodeID is the node for the engine at DOCKER_HOST (or the local
+// socket). It is registered on startup and can't be removed.
+const DefaultNodeID = "default"
+
+// Node statuses
+const (
+	NodeActive   = "active"   // Takes new terminals
+	NodeCordoned = "cordoned" // Keeps its terminals but takes no new ones
+	NodeDraining = "draining" // Takes no new terminals; stopped ones are moved off it
+)
+
+var nodeIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+var nodeLabelPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]{0,62}$`)
+
+// Node is a Docker or Podman host terminals can be placed on
+type Node struct {
+	ID string `json:"id"`
+	// Host is the engine's endpoint, such as tcp://10.0.0.5:2377; empty for
+	// the default node
+	Host string `json:"host,omitempty"`
+	// CertPath is a directory holding ca.pem, cert.pem and key.pem for TLS
+	CertPath string            `json:"cert_path,omitempty"`
+	Labels   map[string]string `json:"labels"`
+	// Capacity offered to terminals; 0 uses what the engine reports
+	CPUMillicores int64     `json:"cpu_millicores"`
+	MemoryMB      int64     `json:"memory_mb"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Validate checks a node's ID, endpoint, labels, capacity and status
+func (n *Node) Validate() error {
+	if !nodeIDPattern.MatchString(n.ID) {
+		return fmt.Errorf("id must be 1-32 characters: lowercase letters, digits or '-'")
+	}
+	if n.ID != DefaultNodeID {
+		if !strings.HasPrefix(n.Host, "tcp://") && !strings.HasPrefix(n.Host, "unix://") {
+			return fmt.Errorf("host must be a tcp:// or unix:// endpoint")
+		}
+	} else if n.Host != "" {
+		return fmt.Errorf("the default node's host is set with DOCKER_HOST")
+	}
+	if err := ValidateNodeLabels(n.Labels); err != nil {
+		return err
+	}
+	if n.CPUMillicores < 0 || n.MemoryMB < 0 {
+		return fmt.Errorf("capacity cannot be negative")
+	}
+	switch n.Status {
+	case NodeActive, NodeCordoned, NodeDraining:
+	default:
+		return fmt.Errorf("status must be %s, %s or %s", NodeActive, NodeCordoned, NodeDraining)
+	}
+	return nil
+}
+
+// ValidateNodeLabels checks node labels or a node selector
+func ValidateNodeLabels(labels map[string]string) error {
+	if len(labels) > 32 {
+		return fmt.Errorf("at most 32 labels are allowed")
+	}
+	for k, v := range labels {
+		if !nodeLabelPattern.MatchString(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if v != "" && !nodeLabelPattern.MatchString(v) {
+			return fmt.Errorf("invalid value %q for label %s", v, k)
+		}
+	}
+	return nil
+}
+
+// Schedulable reports whether new terminals can be placed on the node
+func (n *Node) Schedulable() bool {
+	return n.Status == NodeActive
+}
+
+// Matches reports whether the node has every label in selector
+func (n *Node) Matches(selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := n.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatNodeSelector encodes a node selector as "key=value,..." sorted by key
+func FormatNodeSelector(selector map[string]string) string {
+	pairs := make([]string, 0, len(selector))
+	for k, v := range selector {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ParseNodeSelector decodes a selector written by FormatNodeSelector
+func ParseNodeSelector(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	selector := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(pair, "=")
+		selector[k] = v
+	}
+	return selector
+}
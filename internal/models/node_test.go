@@ -0,0 +1,58 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNode_Validate(t *testing.T) {
+	valid := func() *Node {
+		return &Node{ID: "worker-1", Host: "tcp://10.0.0.5:2377", Labels: map[string]string{"zone": "eu-1"}, Status: NodeActive}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(n *Node)
+		wantErr bool
+	}{
+		{"Valid", func(n *Node) {}, false},
+		{"Unix socket", func(n *Node) { n.Host = "unix:///var/run/docker.sock" }, false},
+		{"Default node", func(n *Node) { n.ID, n.Host = DefaultNodeID, "" }, false},
+		{"Default node with host", func(n *Node) { n.ID = DefaultNodeID }, true},
+		{"Uppercase ID", func(n *Node) { n.ID = "Worker" }, true},
+		{"No host", func(n *Node) { n.Host = "" }, true},
+		{"HTTP host", func(n *Node) { n.Host = "http://10.0.0.5" }, true},
+		{"Bad label", func(n *Node) { n.Labels = map[string]string{"a b": "c"} }, true},
+		{"Negative capacity", func(n *Node) { n.MemoryMB = -1 }, true},
+		{"Unknown status", func(n *Node) { n.Status = "offline" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := valid()
+			tt.modify(n)
+			if err := n.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodeSelector(t *testing.T) {
+	selector := map[string]string{"zone": "eu-1", "gpu": "true"}
+	encoded := FormatNodeSelector(selector)
+	if encoded != "gpu=true,zone=eu-1" {
+		t.Errorf("FormatNodeSelector() = %q", encoded)
+	}
+	if got := ParseNodeSelector(encoded); !reflect.DeepEqual(got, selector) {
+		t.Errorf("ParseNodeSelector() = %v, want %v", got, selector)
+	}
+
+	n := &Node{Labels: map[string]string{"zone": "eu-1", "gpu": "true", "disk": "ssd"}}
+	if !n.Matches(selector) || !n.Matches(nil) {
+		t.Error("node should match a subset of its labels")
+	}
+	if n.Matches(map[string]string{"zone": "us-1"}) {
+		t.Error("node shouldn't match a different value")
+	}
+}
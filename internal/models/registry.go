@@ -0,0 +1,126 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Registry credential kinds
+const (
+	RegistryKindBasic = "basic" // Username and password sent to the registry as-is
+	RegistryKindGHCR  = "ghcr"  // GitHub username and personal access token for ghcr.io
+	RegistryKindECR   = "ecr"   // AWS access key, exchanged with ECR for a short-lived password
+	RegistryKindToken = "token" // Exchanged at TokenURL, a token service the user runs, for a short-lived password
+)
+
+// DockerHubRegistry is the host of image references without one
+const DockerHubRegistry = "docker.io"
+
+// GHCRRegistry is GitHub's container registry
+const GHCRRegistry = "ghcr.io"
+
+// ecrHostPattern matches private ECR registries: <account>.dkr.ecr[-fips].<region>.amazonaws.com[.cn]
+var ecrHostPattern = regexp.MustCompile(`^[0-9]{12}\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+var registryHostPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]{0,251}[a-z0-9])?(:[0-9]{1,5})?$`)
+
+// RegistryCredential authenticates a user's pulls from one registry host
+type RegistryCredential struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Registry  string    `json:"registry"` // Host, e.g. "ghcr.io" or "registry.example.com:5000"
+	Kind      string    `json:"kind"`
+	Username  string    `json:"username"`            // Access key ID for ECR
+	Secret    string    `json:"-"`                   // Password, access token, secret access key or token endpoint secret
+	TokenURL  string    `json:"token_url,omitempty"` // Token kind only
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate normalizes the registry host and checks the credential is usable
+func (c *RegistryCredential) Validate() error {
+	if c.Kind == RegistryKindGHCR && c.Registry == "" {
+		c.Registry = GHCRRegistry
+	}
+	c.Registry = NormalizeRegistryHost(c.Registry)
+	if !registryHostPattern.MatchString(c.Registry) {
+		return fmt.Errorf("registry must be a host name, optionally with a port")
+	}
+	if c.Secret == "" {
+		return fmt.Errorf("secret is required")
+	}
+
+	switch c.Kind {
+	case RegistryKindBasic:
+		if c.Username == "" {
+			return fmt.Errorf("username is required")
+		}
+	case RegistryKindGHCR:
+		if c.Registry != GHCRRegistry {
+			return fmt.Errorf("ghcr credentials are for %s", GHCRRegistry)
+		}
+		if c.Username == "" {
+			return fmt.Errorf("username is required")
+		}
+	case RegistryKindECR:
+		if _, ok := ECRRegion(c.Registry); !ok {
+			return fmt.Errorf("ecr credentials are for a private ECR registry, <account>.dkr.ecr.<region>.amazonaws.com")
+		}
+		if c.Username == "" {
+			return fmt.Errorf("username must be the access key ID")
+		}
+	case RegistryKindToken:
+		u, err := url.Parse(c.TokenURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+			return fmt.Errorf("token_url must be an https URL without credentials")
+		}
+		// Hosts given by name are checked when the token is fetched
+		if ip := net.ParseIP(u.Hostname()); ip != nil && !IsPublicIP(ip) {
+			return fmt.Errorf("token_url must not point at an internal address")
+		}
+	default:
+		return fmt.Errorf("kind must be %s, %s, %s or %s", RegistryKindBasic, RegistryKindGHCR, RegistryKindECR, RegistryKindToken)
+	}
+	if c.Kind != RegistryKindToken && c.TokenURL != "" {
+		return fmt.Errorf("token_url is only used by %s credentials", RegistryKindToken)
+	}
+	return nil
+}
+
+// NormalizeRegistryHost lowercases a registry host and folds Docker Hub's aliases
+func NormalizeRegistryHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host = strings.TrimSuffix(host, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return DockerHubRegistry
+	}
+	return host
+}
+
+// ECRRegion returns the AWS region of a private ECR registry host
+func ECRRegion(host string) (string, bool) {
+	m := ecrHostPattern.FindStringSubmatch(host)
+	if m == nil {
+		return "", false
+	}
+	return m[2], true
+}
+
+// RegistryHost returns the registry an image reference is pulled from
+func RegistryHost(imageRef string) string {
+	first, _, found := strings.Cut(imageRef, "/")
+	if !found {
+		return DockerHubRegistry
+	}
+	// Like Docker, a first component is only a host if it looks like one
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return NormalizeRegistryHost(first)
+	}
+	return DockerHubRegistry
+}
@@ -0,0 +1,58 @@
+package models
+
+import "testing"
+
+func TestRegistryCredential_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cred    RegistryCredential
+		wantErr bool
+	}{
+		{"Basic", RegistryCredential{Registry: "registry.example.com:5000", Kind: RegistryKindBasic, Username: "ci", Secret: "pw"}, false},
+		{"GHCR default host", RegistryCredential{Kind: RegistryKindGHCR, Username: "octocat", Secret: "ghp_x"}, false},
+		{"Token", RegistryCredential{Registry: "123.dkr.ecr.us-east-1.amazonaws.com", Kind: RegistryKindToken, Secret: "s", TokenURL: "https://auth.example.com/ecr"}, false},
+		{"ECR", RegistryCredential{Registry: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", Kind: RegistryKindECR, Username: "AKIAEXAMPLE", Secret: "s"}, false},
+		{"ECR other host", RegistryCredential{Registry: "r.example.com", Kind: RegistryKindECR, Username: "AKIAEXAMPLE", Secret: "s"}, true},
+		{"ECR no access key", RegistryCredential{Registry: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", Kind: RegistryKindECR, Secret: "s"}, true},
+		{"Docker Hub URL", RegistryCredential{Registry: "https://index.docker.io/", Kind: RegistryKindBasic, Username: "me", Secret: "pw"}, false},
+		{"Unknown kind", RegistryCredential{Registry: "r.example.com", Kind: "oauth", Username: "me", Secret: "pw"}, true},
+		{"No secret", RegistryCredential{Registry: "r.example.com", Kind: RegistryKindBasic, Username: "me"}, true},
+		{"No username", RegistryCredential{Registry: "r.example.com", Kind: RegistryKindBasic, Secret: "pw"}, true},
+		{"GHCR other host", RegistryCredential{Registry: "r.example.com", Kind: RegistryKindGHCR, Username: "me", Secret: "pw"}, true},
+		{"Invalid host", RegistryCredential{Registry: "r.example.com/path", Kind: RegistryKindBasic, Username: "me", Secret: "pw"}, true},
+		{"Plain http token URL", RegistryCredential{Registry: "r.example.com", Kind: RegistryKindToken, Secret: "s", TokenURL: "http://auth.example.com"}, true},
+		{"Loopback token URL", RegistryCredential{Registry: "r.example.com", Kind: RegistryKindToken, Secret: "s", TokenURL: "https://127.0.0.1:8443/token"}, true},
+		{"Metadata token URL", RegistryCredential{Registry: "r.example.com", Kind: RegistryKindToken, Secret: "s", TokenURL: "https://169.254.169.254/latest"}, true},
+		{"Token URL on basic", RegistryCredential{Registry: "r.example.com", Kind: RegistryKindBasic, Username: "me", Secret: "pw", TokenURL: "https://auth.example.com"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cred.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"ubuntu:22.04", "docker.io"},
+		{"library/ubuntu", "docker.io"},
+		{"acme/tools:1.0", "docker.io"},
+		{"ghcr.io/acme/base:latest", "ghcr.io"},
+		{"GHCR.IO/acme/base", "ghcr.io"},
+		{"registry.example.com:5000/base", "registry.example.com:5000"},
+		{"localhost/base", "localhost"},
+		{"index.docker.io/library/ubuntu", "docker.io"},
+	}
+
+	for _, tt := range tests {
+		if got := RegistryHost(tt.ref); got != tt.want {
+			t.Errorf("RegistryHost(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
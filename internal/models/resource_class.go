@@ -0,0 +1,162 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ClassTiers are the tiers a resource class can be offered to. Trial users
+// pick from the free tier's classes and subscribers from pro's (see ClassTier).
+var ClassTiers = []string{"guest", "free", "pro", "enterprise"}
+
+// DefaultPidsLimit is the process limit of terminals without a resource class
+const DefaultPidsLimit = 512
+
+var resourceClassNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ResourceClass is a named size a terminal can be created with, such as
+// "small" or "large". Burst settings let a terminal run above its baseline
+// CPU while it has credits, which it earns by running below it.
+type ResourceClass struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	CPUMillicores int64  `json:"cpu_millicores"` // Baseline CPU (1000 = 1 vCPU)
+	MemoryMB      int64  `json:"memory_mb"`
+	DiskMB        int64  `json:"disk_mb"`
+	PidsLimit     int64  `json:"pids_limit"`
+	NetworkMB     int64  `json:"network_mb"` // Bandwidth cap in MB/s (0 = unlimited)
+	// BurstCPUMillicores is the CPU ceiling while spending credits; 0 disables bursting
+	BurstCPUMillicores int64 `json:"burst_cpu_millicores,omitempty"`
+	// BurstCredits is the most credit a terminal can bank, in CPU-seconds above baseline
+	BurstCredits int64    `json:"burst_credits,omitempty"`
+	Tiers        []string `json:"tiers"` // Tiers allowed to use the class
+	// NodeSelector limits the class to nodes with all of these labels
+	NodeSelector map[string]string `json:"node_selector,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// DefaultResourceClasses is the catalog a new installation starts with
+func DefaultResourceClasses() []*ResourceClass {
+	return []*ResourceClass{
+		{
+			Name: "small", Description: "Shells, scripting and light editing",
+			CPUMillicores: 500, MemoryMB: 512, DiskMB: 2048, PidsLimit: 256, NetworkMB: 5,
+			BurstCPUMillicores: 1000, BurstCredits: 1800,
+			Tiers: []string{"guest", "free", "pro", "enterprise"},
+		},
+		{
+			Name: "medium", Description: "Everyday development",
+			CPUMillicores: 1000, MemoryMB: 2048, DiskMB: 10240, PidsLimit: 512, NetworkMB: 10,
+			BurstCPUMillicores: 2000, BurstCredits: 3600,
+			Tiers: []string{"free", "pro", "enterprise"},
+		},
+		{
+			Name: "large", Description: "Builds, test suites and language servers",
+			CPUMillicores: 2000, MemoryMB: 4096, DiskMB: 20480, PidsLimit: 1024, NetworkMB: 100,
+			BurstCPUMillicores: 4000, BurstCredits: 7200,
+			Tiers: []string{"pro", "enterprise"},
+		},
+		{
+			Name: "xlarge", Description: "Heavy compilation and data processing",
+			CPUMillicores: 4000, MemoryMB: 8192, DiskMB: 51200, PidsLimit: 2048, NetworkMB: 500,
+			BurstCPUMillicores: 8000, BurstCredits: 14400,
+			Tiers: []string{"enterprise"},
+		},
+	}
+}
+
+// Validate checks a resource class's name, sizes and tiers
+func (rc *ResourceClass) Validate() error {
+	if !resourceClassNamePattern.MatchString(rc.Name) {
+		return fmt.Errorf("name must be 1-32 characters: lowercase letters, digits or '-'")
+	}
+	if len(rc.Description) > 200 {
+		return fmt.Errorf("description must be at most 200 characters")
+	}
+	if rc.CPUMillicores < 100 {
+		return fmt.Errorf("cpu_millicores must be at least 100")
+	}
+	if rc.MemoryMB < 128 {
+		return fmt.Errorf("memory_mb must be at least 128")
+	}
+	if rc.DiskMB < 512 {
+		return fmt.Errorf("disk_mb must be at least 512")
+	}
+	if rc.PidsLimit < 32 {
+		return fmt.Errorf("pids_limit must be at least 32")
+	}
+	if rc.NetworkMB < 0 {
+		return fmt.Errorf("network_mb cannot be negative")
+	}
+	if rc.BurstCPUMillicores != 0 {
+		if rc.BurstCPUMillicores <= rc.CPUMillicores {
+			return fmt.Errorf("burst_cpu_millicores must be above cpu_millicores")
+		}
+		if rc.BurstCredits <= 0 {
+			return fmt.Errorf("burst_credits must be positive when bursting is enabled")
+		}
+	} else if rc.BurstCredits != 0 {
+		return fmt.Errorf("burst_credits needs burst_cpu_millicores")
+	}
+	if len(rc.Tiers) == 0 {
+		return fmt.Errorf("at least one tier is required")
+	}
+	for _, tier := range rc.Tiers {
+		if !isClassTier(tier) {
+			return fmt.Errorf("unknown tier %q", tier)
+		}
+	}
+	if err := ValidateNodeLabels(rc.NodeSelector); err != nil {
+		return fmt.Errorf("node_selector: %w", err)
+	}
+	return nil
+}
+
+// CanBurst reports whether the class allows running above its baseline CPU
+func (rc *ResourceClass) CanBurst() bool {
+	return rc.BurstCPUMillicores > rc.CPUMillicores && rc.BurstCredits > 0
+}
+
+// AllowsTier reports whether a tier (as returned by ClassTier) may use the class
+func (rc *ResourceClass) AllowsTier(tier string) bool {
+	for _, t := range rc.Tiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits returns the class's sizes as resource limits
+func (rc *ResourceClass) Limits() ResourceLimits {
+	return ResourceLimits{
+		CPUShares: rc.CPUMillicores,
+		MemoryMB:  rc.MemoryMB,
+		DiskMB:    rc.DiskMB,
+		NetworkMB: rc.NetworkMB,
+	}
+}
+
+// ClassTier maps a user's tier to the one resource classes are offered to.
+// As in GetUserResourceLimits, an active subscription counts as pro.
+func ClassTier(tier string, subscriptionActive bool) string {
+	switch {
+	case tier == "enterprise" || tier == "guest":
+		return tier
+	case subscriptionActive || tier == "pro":
+		return "pro"
+	default:
+		return "free"
+	}
+}
+
+func isClassTier(tier string) bool {
+	for _, t := range ClassTiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package models
+
+import "testing"
+
+func TestResourceClass_Validate(t *testing.T) {
+	valid := func() *ResourceClass {
+		return &ResourceClass{
+			Name: "medium", CPUMillicores: 1000, MemoryMB: 2048, DiskMB: 10240, PidsLimit: 512,
+			BurstCPUMillicores: 2000, BurstCredits: 3600, Tiers: []string{"free", "pro"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(rc *ResourceClass)
+		wantErr bool
+	}{
+		{"Valid", func(rc *ResourceClass) {}, false},
+		{"No bursting", func(rc *ResourceClass) { rc.BurstCPUMillicores, rc.BurstCredits = 0, 0 }, false},
+		{"Uppercase name", func(rc *ResourceClass) { rc.Name = "Medium" }, true},
+		{"Name too long", func(rc *ResourceClass) { rc.Name = "a-really-long-resource-class-name-x" }, true},
+		{"Too little CPU", func(rc *ResourceClass) { rc.CPUMillicores = 50 }, true},
+		{"Too little memory", func(rc *ResourceClass) { rc.MemoryMB = 64 }, true},
+		{"Too few processes", func(rc *ResourceClass) { rc.PidsLimit = 8 }, true},
+		{"Negative network", func(rc *ResourceClass) { rc.NetworkMB = -1 }, true},
+		{"Burst below baseline", func(rc *ResourceClass) { rc.BurstCPUMillicores = 1000 }, true},
+		{"Burst without credits", func(rc *ResourceClass) { rc.BurstCredits = 0 }, true},
+		{"Credits without burst", func(rc *ResourceClass) { rc.BurstCPUMillicores = 0 }, true},
+		{"No tiers", func(rc *ResourceClass) { rc.Tiers = nil }, true},
+		{"Unknown tier", func(rc *ResourceClass) { rc.Tiers = []string{"platinum"} }, true},
+		{"Node selector", func(rc *ResourceClass) { rc.NodeSelector = map[string]string{"gpu": "true"} }, false},
+		{"Bad node selector", func(rc *ResourceClass) { rc.NodeSelector = map[string]string{"gpu=": "true"} }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := valid()
+			tt.modify(rc)
+			if err := rc.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultResourceClasses(t *testing.T) {
+	for _, rc := range DefaultResourceClasses() {
+		if err := rc.Validate(); err != nil {
+			t.Errorf("default class %s: %v", rc.Name, err)
+		}
+	}
+}
+
+func TestClassTier(t *testing.T) {
+	tests := []struct {
+		tier               string
+		subscriptionActive bool
+		want               string
+	}{
+		{"guest", false, "guest"},
+		{"free", false, "free"},
+		{"trial", false, "free"},
+		{"free", true, "pro"},
+		{"pro", false, "pro"},
+		{"enterprise", false, "enterprise"},
+		{"", false, "free"},
+	}
+
+	for _, tt := range tests {
+		if got := ClassTier(tt.tier, tt.subscriptionActive); got != tt.want {
+			t.Errorf("ClassTier(%q, %v) = %q, want %q", tt.tier, tt.subscriptionActive, got, tt.want)
+		}
+	}
+}
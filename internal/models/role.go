@@ -0,0 +1,111 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Distro families a custom role can list packages for. Packages under
+// RoleFamilyAll are installed everywhere, in addition to the family's own list.
+const (
+	RoleFamilyAll    = "all"
+	RoleFamilyDebian = "debian" // apt-get
+	RoleFamilyAlpine = "alpine" // apk
+	RoleFamilyFedora = "fedora" // dnf / yum
+	RoleFamilyArch   = "arch"   // pacman
+	RoleFamilySuse   = "suse"   // zypper
+)
+
+// RoleFamilies lists the valid keys of CustomRole.Packages
+var RoleFamilies = []string{RoleFamilyAll, RoleFamilyDebian, RoleFamilyAlpine, RoleFamilyFedora, RoleFamilyArch, RoleFamilySuse}
+
+// Custom role size limits
+const (
+	MaxRolePackages    = 100 // Per family
+	MaxRoleScripts     = 20
+	MaxRoleScriptBytes = 16 * 1024
+	MaxRoleVerify      = 20
+)
+
+// CustomRole is a user- or admin-defined role, set up like the built-in ones.
+// Global roles are created by admins and offered to every user.
+type CustomRole struct {
+	ID          string              `json:"id"`
+	UserID      string              `json:"user_id"`
+	Global      bool                `json:"global"`
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Icon        string              `json:"icon,omitempty"`
+	BaseRole    string              `json:"base_role,omitempty"`    // Built-in role installed first, e.g. "standard"
+	Packages    map[string][]string `json:"packages,omitempty"`     // Keyed by distro family
+	PostInstall []string            `json:"post_install,omitempty"` // Shell scripts run as root after packages
+	Verify      []string            `json:"verify,omitempty"`       // Commands that must all exit 0
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// Validate checks a custom role's fields. Base roles are checked by the
+// caller, which knows the built-in catalog.
+func (r *CustomRole) Validate() error {
+	if !templateNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("name must be 1-64 characters: letters, digits, '.', '_' or '-'")
+	}
+	if len(r.Description) > 500 {
+		return fmt.Errorf("description must be at most 500 characters")
+	}
+	if len(r.Icon) > 16 {
+		return fmt.Errorf("icon must be at most 16 bytes")
+	}
+
+	for family, pkgs := range r.Packages {
+		if !isRoleFamily(family) {
+			return fmt.Errorf("unknown distro family %q (expected one of %s)", family, strings.Join(RoleFamilies, ", "))
+		}
+		if len(pkgs) > MaxRolePackages {
+			return fmt.Errorf("too many %s packages (max %d)", family, MaxRolePackages)
+		}
+		for _, p := range pkgs {
+			if !templatePackagePattern.MatchString(p) {
+				return fmt.Errorf("invalid package name: %q", p)
+			}
+		}
+	}
+
+	if len(r.PostInstall) > MaxRoleScripts {
+		return fmt.Errorf("too many post-install scripts (max %d)", MaxRoleScripts)
+	}
+	for _, s := range r.PostInstall {
+		if strings.TrimSpace(s) == "" || strings.Contains(s, "\x00") {
+			return fmt.Errorf("post-install scripts must be non-empty")
+		}
+		if len(s) > MaxRoleScriptBytes {
+			return fmt.Errorf("post-install scripts must be at most %d bytes", MaxRoleScriptBytes)
+		}
+	}
+
+	if len(r.Verify) > MaxRoleVerify {
+		return fmt.Errorf("too many verification commands (max %d)", MaxRoleVerify)
+	}
+	for _, v := range r.Verify {
+		if strings.TrimSpace(v) == "" || strings.ContainsAny(v, "\x00\n") {
+			return fmt.Errorf("verification commands must be a single non-empty line")
+		}
+	}
+	return nil
+}
+
+// PackagesFor returns the packages to install on a distro family
+func (r *CustomRole) PackagesFor(family string) []string {
+	pkgs := append([]string{}, r.Packages[RoleFamilyAll]...)
+	return append(pkgs, r.Packages[family]...)
+}
+
+func isRoleFamily(family string) bool {
+	for _, f := range RoleFamilies {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
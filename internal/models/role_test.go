@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCustomRoleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    CustomRole
+		wantErr string
+	}{
+		{"Minimal", CustomRole{Name: "company-standard"}, ""},
+		{"Full", CustomRole{
+			Name:        "company-standard",
+			BaseRole:    "standard",
+			Packages:    map[string][]string{RoleFamilyAll: {"jq"}, RoleFamilyDebian: {"build-essential"}},
+			PostInstall: []string{"curl -fsSL https://example.com/install.sh | sh"},
+			Verify:      []string{"acme --version"},
+		}, ""},
+		{"Bad name", CustomRole{Name: "my role"}, "name must be"},
+		{"Unknown family", CustomRole{Name: "r", Packages: map[string][]string{"gentoo": {"vim"}}}, "unknown distro family"},
+		{"Bad package", CustomRole{Name: "r", Packages: map[string][]string{RoleFamilyAll: {"vim;id"}}}, "invalid package name"},
+		{"Empty post-install", CustomRole{Name: "r", PostInstall: []string{"  "}}, "post-install"},
+		{"Multiline verify", CustomRole{Name: "r", Verify: []string{"a\nb"}}, "verification commands"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.role.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCustomRolePackagesFor(t *testing.T) {
+	role := CustomRole{Packages: map[string][]string{
+		RoleFamilyAll:    {"jq"},
+		RoleFamilyAlpine: {"build-base"},
+	}}
+
+	if got := strings.Join(role.PackagesFor(RoleFamilyAlpine), " "); got != "jq build-base" {
+		t.Errorf("PackagesFor(alpine) = %q", got)
+	}
+	if got := strings.Join(role.PackagesFor(RoleFamilyDebian), " "); got != "jq" {
+		t.Errorf("PackagesFor(debian) = %q", got)
+	}
+}
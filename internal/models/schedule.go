@@ -0,0 +1,178 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What happens to a terminal when its schedule expires
+const (
+	ExpireActionDelete = "delete"
+	ExpireActionStop   = "stop"
+)
+
+// ContainerSchedule is a terminal's own lifetime policy, on top of the global
+// idle cleanup. Start and Stop are 5-field cron expressions evaluated in
+// Timezone, e.g. start "0 9 * * 1-5" and stop "0 18 * * 1-5" for weekdays 9–18.
+type ContainerSchedule struct {
+	Start     string     `json:"start,omitempty"`
+	Stop      string     `json:"stop,omitempty"`
+	Timezone  string     `json:"timezone,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	OnExpire  string     `json:"on_expire,omitempty"` // "delete" (default) or "stop"
+}
+
+// IsEmpty reports whether the schedule sets nothing at all
+func (s *ContainerSchedule) IsEmpty() bool {
+	return s == nil || (s.Start == "" && s.Stop == "" && s.ExpiresAt == nil)
+}
+
+// Validate checks the cron expressions, timezone and expiry action
+func (s *ContainerSchedule) Validate() error {
+	if s.Start != "" {
+		if _, err := ParseCron(s.Start); err != nil {
+			return fmt.Errorf("start: %w", err)
+		}
+	}
+	if s.Stop != "" {
+		if _, err := ParseCron(s.Stop); err != nil {
+			return fmt.Errorf("stop: %w", err)
+		}
+	}
+	if _, err := s.Location(); err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	switch s.OnExpire {
+	case "", ExpireActionDelete, ExpireActionStop:
+	default:
+		return fmt.Errorf("on_expire must be %q or %q", ExpireActionDelete, ExpireActionStop)
+	}
+	return nil
+}
+
+// Location returns the schedule's timezone, UTC if unset
+func (s *ContainerSchedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+// ExpireAction returns what to do on expiry, defaulting to delete
+func (s *ContainerSchedule) ExpireAction() string {
+	if s.OnExpire == "" {
+		return ExpireActionDelete
+	}
+	return s.OnExpire
+}
+
+// CronSchedule is a parsed 5-field cron expression: minute hour day-of-month
+// month day-of-week. Fields accept *, lists, ranges and steps (*/15, 1-5/2).
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronFieldBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// ParseCron parses a 5-field cron expression
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFieldBounds[i][0], cronFieldBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("field %d (%q): %w", i+1, field, err)
+		}
+		bits[i] = b
+	}
+
+	// 7 is Sunday, same as 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &CronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step")
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			var err error
+			if i := strings.Index(rangePart, "-"); i >= 0 {
+				lo, err = strconv.Atoi(rangePart[:i])
+				if err == nil {
+					hi, err = strconv.Atoi(rangePart[i+1:])
+				}
+			} else {
+				lo, err = strconv.Atoi(rangePart)
+				hi = lo
+				if step > 1 {
+					hi = max
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("invalid value")
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("out of range %d-%d", min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Matches reports whether the schedule fires in t's minute
+func (c *CronSchedule) Matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	// As in cron, a restricted day-of-month and day-of-week match if either does
+	if !c.domAny && !c.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// LastFire returns the latest minute in (after, until] at which the schedule
+// fires, evaluated in loc
+func (c *CronSchedule) LastFire(after, until time.Time, loc *time.Location) (time.Time, bool) {
+	t := until.In(loc).Truncate(time.Minute)
+	for ; t.After(after); t = t.Add(-time.Minute) {
+		if c.Matches(t) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{"Weekdays at nine", "0 9 * * 1-5", false},
+		{"Every 15 minutes", "*/15 * * * *", false},
+		{"Lists and steps", "0,30 8-18/2 1,15 * 0", false},
+		{"Sunday as 7", "0 0 * * 7", false},
+		{"Too few fields", "0 9 * *", true},
+		{"Minute out of range", "60 * * * *", true},
+		{"Reversed range", "0 18-9 * * *", true},
+		{"Zero step", "*/0 * * * *", true},
+		{"Not a number", "0 nine * * *", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_Matches(t *testing.T) {
+	// 2026-03-02 is a Monday
+	monday9 := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	sunday9 := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"Weekday match", "0 9 * * 1-5", monday9, true},
+		{"Weekend miss", "0 9 * * 1-5", sunday9, false},
+		{"Wrong minute", "0 9 * * 1-5", monday9.Add(time.Minute), false},
+		{"Sunday as 7", "0 9 * * 7", sunday9, true},
+		{"Step", "*/15 * * * *", monday9.Add(45 * time.Minute), true},
+		{"Day of month or weekday", "0 9 2 * 5", monday9, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			}
+			if got := c.Matches(tt.t); got != tt.want {
+				t.Errorf("Matches(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_LastFire(t *testing.T) {
+	c, _ := ParseCron("0 18 * * *")
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+
+	// 18:00 in Berlin is 17:00 UTC in winter
+	now := time.Date(2026, 1, 5, 17, 2, 0, 0, time.UTC)
+	fire, ok := c.LastFire(now.Add(-5*time.Minute), now, berlin)
+	if !ok || !fire.Equal(time.Date(2026, 1, 5, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("LastFire() = %v, %v", fire, ok)
+	}
+
+	if _, ok := c.LastFire(now.Add(-time.Minute), now, berlin); ok {
+		t.Error("LastFire() should not find a fire outside the window")
+	}
+}
+
+func TestContainerSchedule_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule ContainerSchedule
+		wantErr  bool
+	}{
+		{"Window", ContainerSchedule{Start: "0 9 * * 1-5", Stop: "0 18 * * 1-5", Timezone: "UTC"}, false},
+		{"Stop only", ContainerSchedule{Stop: "0 0 * * *", OnExpire: ExpireActionStop}, false},
+		{"Bad cron", ContainerSchedule{Start: "9am"}, true},
+		{"Bad timezone", ContainerSchedule{Stop: "0 0 * * *", Timezone: "Mars/Olympus"}, true},
+		{"Bad expire action", ContainerSchedule{OnExpire: "archive"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package models
+
+import "strings"
+
+// API token scopes. Scopes are "<resource>:<action>" pairs; "<resource>:*"
+// grants every action on a resource, and "*" or ScopeAdmin grant everything.
+const (
+	ScopeContainersRead  = "containers:read"
+	ScopeContainersWrite = "containers:write"
+	ScopeFilesRead       = "files:read"
+	ScopeFilesWrite      = "files:write"
+	ScopeTerminalConnect = "terminal:connect"
+	ScopeAgentsRead      = "agents:read"
+	ScopeAgentsWrite     = "agents:write"
+	ScopeAccountRead     = "account:read"
+	ScopeAccountWrite    = "account:write"
+	ScopeAdmin           = "admin"
+	ScopeAll             = "*"
+
+	// Legacy scopes issued before fine-grained scopes existed.
+	ScopeLegacyRead  = "read"
+	ScopeLegacyWrite = "write"
+)
+
+// AllScopes lists every concrete scope a token can be granted.
+var AllScopes = []string{
+	ScopeContainersRead,
+	ScopeContainersWrite,
+	ScopeFilesRead,
+	ScopeFilesWrite,
+	ScopeTerminalConnect,
+	ScopeAgentsRead,
+	ScopeAgentsWrite,
+	ScopeAccountRead,
+	ScopeAccountWrite,
+	ScopeAdmin,
+}
+
+// DefaultTokenScopes are granted to tokens created without explicit scopes.
+var DefaultTokenScopes = []string{ScopeLegacyRead, ScopeLegacyWrite}
+
+// expandScope returns the concrete scopes a granted scope stands for, or nil
+// if the scope is not recognised.
+func expandScope(scope string) []string {
+	switch scope {
+	case ScopeAll, ScopeAdmin:
+		return AllScopes
+	case ScopeLegacyRead:
+		return scopesWithAction("read")
+	case ScopeLegacyWrite:
+		// "write" tokens could always open terminals, so keep that working.
+		return append(scopesWithAction("write"), ScopeTerminalConnect)
+	}
+
+	if resource, ok := strings.CutSuffix(scope, ":*"); ok {
+		var out []string
+		for _, s := range AllScopes {
+			if strings.HasPrefix(s, resource+":") {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	for _, s := range AllScopes {
+		if s == scope {
+			return []string{s}
+		}
+	}
+	return nil
+}
+
+func scopesWithAction(action string) []string {
+	var out []string
+	for _, s := range AllScopes {
+		if strings.HasSuffix(s, ":"+action) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// IsValidScope reports whether scope can be assigned to an API token.
+func IsValidScope(scope string) bool {
+	return len(expandScope(scope)) > 0
+}
+
+// HasScope reports whether the granted scopes cover the required one.
+// required may itself be a wildcard or legacy scope, in which case every
+// concrete scope it expands to must be granted.
+func HasScope(granted []string, required string) bool {
+	needed := expandScope(required)
+	if len(needed) == 0 {
+		return false
+	}
+
+	have := make(map[string]bool)
+	for _, g := range granted {
+		for _, s := range expandScope(g) {
+			have[s] = true
+		}
+	}
+	for _, s := range needed {
+		if !have[s] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package models
+
+import "testing"
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required string
+		want     bool
+	}{
+		{"Exact match", []string{"containers:read"}, ScopeContainersRead, true},
+		{"Missing scope", []string{"containers:read"}, ScopeContainersWrite, false},
+		{"Resource wildcard", []string{"agents:*"}, ScopeAgentsWrite, true},
+		{"Resource wildcard other resource", []string{"agents:*"}, ScopeFilesWrite, false},
+		{"Legacy read", []string{"read"}, ScopeFilesRead, true},
+		{"Legacy read cannot write", []string{"read"}, ScopeContainersWrite, false},
+		{"Legacy read cannot connect", []string{"read"}, ScopeTerminalConnect, false},
+		{"Legacy write connects", []string{"write"}, ScopeTerminalConnect, true},
+		{"Legacy write is not admin", []string{"read", "write"}, ScopeAdmin, false},
+		{"Admin grants everything", []string{"admin"}, ScopeTerminalConnect, true},
+		{"Star grants everything", []string{"*"}, ScopeAdmin, true},
+		{"Required wildcard needs all", []string{"agents:read"}, "agents:*", false},
+		{"Required wildcard satisfied", []string{"agents:read", "agents:write"}, "agents:*", true},
+		{"Required legacy read", []string{"containers:read"}, ScopeLegacyRead, false},
+		{"Unknown required scope", []string{"*"}, "bogus:read", false},
+		{"No scopes", nil, ScopeContainersRead, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasScope(tt.granted, tt.required); got != tt.want {
+				t.Errorf("HasScope(%v, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidScope(t *testing.T) {
+	valid := []string{"containers:read", "agents:*", "admin", "*", "read", "write"}
+	for _, s := range valid {
+		if !IsValidScope(s) {
+			t.Errorf("IsValidScope(%q) = false, want true", s)
+		}
+	}
+
+	invalid := []string{"", "containers", "bogus:*", "containers:delete"}
+	for _, s := range invalid {
+		if IsValidScope(s) {
+			t.Errorf("IsValidScope(%q) = true, want false", s)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxServicesPerContainer caps the services declared in one terminal
+const MaxServicesPerContainer = 10
+
+// MaxServiceCommandBytes caps a service's shell command
+const MaxServiceCommandBytes = 4096
+
+// Restart policies for supervised services
+const (
+	ServiceRestartAlways    = "always"
+	ServiceRestartOnFailure = "on-failure"
+	ServiceRestartNever     = "never"
+)
+
+// Service statuses
+const (
+	ServiceStatusStarting = "starting"
+	ServiceStatusRunning  = "running"
+	ServiceStatusBackoff  = "backoff" // Waiting to be restarted after exiting
+	ServiceStatusExited   = "exited"  // Exited with code 0 and won't be restarted
+	ServiceStatusFailed   = "failed"  // Exited with an error and won't be restarted
+	ServiceStatusStopped  = "stopped" // Stopped by the user, or the terminal isn't running
+)
+
+var (
+	serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+	envKeyPattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ServiceState is what the supervisor last saw of a service's process
+type ServiceState struct {
+	Status    string     `json:"status"`
+	PID       int        `json:"pid,omitempty"` // Inside the terminal
+	Restarts  int        `json:"restarts"`
+	ExitCode  *int       `json:"exit_code,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// ContainerService is a long-running command, such as a dev server, that
+// Rexec keeps running inside a terminal independently of any shell
+type ContainerService struct {
+	ID            string            `json:"id"`
+	ContainerID   string            `json:"container_id"` // Database ID of the terminal
+	DockerID      string            `json:"-"`
+	UserID        string            `json:"user_id"`
+	Name          string            `json:"name"`
+	Command       string            `json:"command"` // Run with a login shell
+	WorkDir       string            `json:"workdir,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+	RestartPolicy string            `json:"restart_policy"`
+	Enabled       bool              `json:"enabled"`
+	// Generation changes whenever the service is edited or restarted, so
+	// the supervisor knows an exit was requested rather than a crash
+	Generation int       `json:"generation"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	ServiceState
+}
+
+// Validate checks a service definition and fills in the default restart policy
+func (s *ContainerService) Validate() error {
+	if !serviceNamePattern.MatchString(s.Name) {
+		return fmt.Errorf("name must be 1-32 characters: lowercase letters, digits, '_' or '-'")
+	}
+	if strings.TrimSpace(s.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	if len(s.Command) > MaxServiceCommandBytes {
+		return fmt.Errorf("command exceeds %d bytes", MaxServiceCommandBytes)
+	}
+	if strings.ContainsRune(s.Command, 0) {
+		return fmt.Errorf("command contains a NUL byte")
+	}
+	if s.WorkDir != "" && (!path.IsAbs(s.WorkDir) || strings.ContainsRune(s.WorkDir, 0)) {
+		return fmt.Errorf("workdir must be an absolute path")
+	}
+	for key, value := range s.Env {
+		if !envKeyPattern.MatchString(key) || strings.HasPrefix(key, "REXEC_") {
+			return fmt.Errorf("invalid environment variable %q", key)
+		}
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("environment variable %s contains a NUL byte", key)
+		}
+	}
+
+	switch s.RestartPolicy {
+	case "":
+		s.RestartPolicy = ServiceRestartAlways
+	case ServiceRestartAlways, ServiceRestartOnFailure, ServiceRestartNever:
+	default:
+		return fmt.Errorf("restart_policy must be always, on-failure or never")
+	}
+	return nil
+}
+
+// ShouldRestart reports whether the restart policy restarts a process that
+// exited with exitCode; nil means the exit code is unknown
+func (s *ContainerService) ShouldRestart(exitCode *int) bool {
+	switch s.RestartPolicy {
+	case ServiceRestartNever:
+		return false
+	case ServiceRestartOnFailure:
+		return exitCode == nil || *exitCode != 0
+	default:
+		return true
+	}
+}
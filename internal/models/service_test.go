@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestContainerService_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		svc     ContainerService
+		wantErr bool
+	}{
+		{"Minimal", ContainerService{Name: "web", Command: "npm run dev"}, false},
+		{"Full", ContainerService{Name: "api_2", Command: "go run .", WorkDir: "/home/user/api", Env: map[string]string{"PORT": "8080"}, RestartPolicy: ServiceRestartOnFailure}, false},
+		{"Uppercase name", ContainerService{Name: "Web", Command: "x"}, true},
+		{"Name with slash", ContainerService{Name: "../web", Command: "x"}, true},
+		{"No command", ContainerService{Name: "web", Command: "  "}, true},
+		{"Relative workdir", ContainerService{Name: "web", Command: "x", WorkDir: "api"}, true},
+		{"Invalid env key", ContainerService{Name: "web", Command: "x", Env: map[string]string{"A-B": "1"}}, true},
+		{"Reserved env key", ContainerService{Name: "web", Command: "x", Env: map[string]string{"REXEC_SERVICE_ID": "1"}}, true},
+		{"Unknown policy", ContainerService{Name: "web", Command: "x", RestartPolicy: "sometimes"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.svc.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.svc.RestartPolicy == "" {
+				t.Error("Validate() didn't default the restart policy")
+			}
+		})
+	}
+}
+
+func TestContainerService_ShouldRestart(t *testing.T) {
+	zero, one := 0, 1
+	tests := []struct {
+		policy   string
+		exitCode *int
+		want     bool
+	}{
+		{ServiceRestartAlways, &zero, true},
+		{ServiceRestartAlways, &one, true},
+		{ServiceRestartOnFailure, &zero, false},
+		{ServiceRestartOnFailure, &one, true},
+		{ServiceRestartOnFailure, nil, true},
+		{ServiceRestartNever, &one, false},
+	}
+
+	for _, tt := range tests {
+		svc := ContainerService{RestartPolicy: tt.policy}
+		if got := svc.ShouldRestart(tt.exitCode); got != tt.want {
+			t.Errorf("%s.ShouldRestart(%v) = %v, want %v", tt.policy, tt.exitCode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateSpecVersion is the current rexec.yaml format version
+const TemplateSpecVersion = 1
+
+// TemplateFileName is the file looked up when importing a template from a git repo
+const TemplateFileName = "rexec.yaml"
+
+// Template size limits keep setup scripts and stored specs bounded
+const (
+	MaxTemplateBytes    = 64 * 1024
+	MaxTemplatePackages = 100
+	MaxTemplateStartup  = 20
+	MaxTemplatePorts    = 10
+	MaxTemplateEnvVars  = 100
+)
+
+var (
+	templateNamePattern    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+	templatePackagePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.+_:@=/-]{0,127}$`)
+	templateEnvKeyPattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+	templateRefPattern     = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]{0,127}$`)
+)
+
+// reservedTemplateEnv are set by rexec on every terminal and can't be overridden
+var reservedTemplateEnv = map[string]bool{
+	"HOME":           true,
+	"SHELL":          true,
+	"HOSTNAME":       true,
+	"USER_ID":        true,
+	"CONTAINER_NAME": true,
+}
+
+// EnvTemplate is a declarative terminal environment, usually stored as rexec.yaml:
+//
+//	version: 1
+//	name: go-api
+//	image: ubuntu-24
+//	role: go
+//	packages: [make, postgresql-client]
+//	env:
+//	  GOFLAGS: -mod=mod
+//	dotfiles:
+//	  repo: https://github.com/me/dotfiles
+//	  install: install.sh
+//	startup:
+//	  - git clone https://github.com/me/api ~/api
+//	ports:
+//	  - 8080
+//	  - {port: 5173, name: vite}
+//	resources:
+//	  memory_mb: 2048
+//	  cpu_shares: 1000
+//	  disk_mb: 8192
+type EnvTemplate struct {
+	Version     int               `yaml:"version" json:"version"`
+	Name        string            `yaml:"name" json:"name"`
+	Description string            `yaml:"description,omitempty" json:"description,omitempty"`
+	Image       string            `yaml:"image" json:"image"` // Image type (ubuntu, debian, ...) or a full image reference
+	Role        string            `yaml:"role,omitempty" json:"role,omitempty"`
+	Packages    []string          `yaml:"packages,omitempty" json:"packages,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Dotfiles    *TemplateDotfiles `yaml:"dotfiles,omitempty" json:"dotfiles,omitempty"`
+	Startup     []string          `yaml:"startup,omitempty" json:"startup,omitempty"` // Run once as the terminal user after setup
+	Ports       []TemplatePort    `yaml:"ports,omitempty" json:"ports,omitempty"`     // Opened as port forwards once ready
+	Resources   TemplateResources `yaml:"resources,omitempty" json:"resources,omitempty"`
+}
+
+// TemplateDotfiles points at a dotfiles repository cloned into ~/.dotfiles
+type TemplateDotfiles struct {
+	Repo    string `yaml:"repo" json:"repo"`
+	Ref     string `yaml:"ref,omitempty" json:"ref,omitempty"`
+	Install string `yaml:"install,omitempty" json:"install,omitempty"` // Script inside the repo, e.g. install.sh
+}
+
+// TemplatePort is a container port to forward automatically.
+// In YAML it may be written as a bare number or as {port, name}.
+type TemplatePort struct {
+	Port int    `yaml:"port" json:"port"`
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+}
+
+// UnmarshalYAML accepts both "8080" and "{port: 8080, name: web}"
+func (p *TemplatePort) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&p.Port)
+	}
+	type plain TemplatePort
+	return value.Decode((*plain)(p))
+}
+
+// TemplateResources are requested limits; they are clamped to the user's tier like any request
+type TemplateResources struct {
+	MemoryMB  int64 `yaml:"memory_mb,omitempty" json:"memory_mb,omitempty"`
+	CPUShares int64 `yaml:"cpu_shares,omitempty" json:"cpu_shares,omitempty"`
+	DiskMB    int64 `yaml:"disk_mb,omitempty" json:"disk_mb,omitempty"`
+}
+
+// ParseEnvTemplate decodes and validates a rexec.yaml document.
+// Unknown keys are rejected so typos don't silently drop settings.
+func ParseEnvTemplate(data []byte) (*EnvTemplate, error) {
+	if len(data) > MaxTemplateBytes {
+		return nil, fmt.Errorf("template exceeds %d bytes", MaxTemplateBytes)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var tmpl EnvTemplate
+	if err := dec.Decode(&tmpl); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if err := tmpl.Validate(); err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// Validate checks a template for values that are unsafe to put in a setup script
+func (t *EnvTemplate) Validate() error {
+	if t.Version == 0 {
+		return fmt.Errorf("version is required (current version is %d)", TemplateSpecVersion)
+	}
+	if t.Version > TemplateSpecVersion {
+		return fmt.Errorf("unsupported template version %d (max %d)", t.Version, TemplateSpecVersion)
+	}
+	if !templateNamePattern.MatchString(t.Name) {
+		return fmt.Errorf("name must be 1-64 characters: letters, digits, '.', '_' or '-'")
+	}
+	if strings.TrimSpace(t.Image) == "" {
+		return fmt.Errorf("image is required")
+	}
+
+	if len(t.Packages) > MaxTemplatePackages {
+		return fmt.Errorf("too many packages (max %d)", MaxTemplatePackages)
+	}
+	for _, p := range t.Packages {
+		if !templatePackagePattern.MatchString(p) {
+			return fmt.Errorf("invalid package name: %q", p)
+		}
+	}
+
+	if len(t.Env) > MaxTemplateEnvVars {
+		return fmt.Errorf("too many env vars (max %d)", MaxTemplateEnvVars)
+	}
+	for k, v := range t.Env {
+		if !templateEnvKeyPattern.MatchString(k) {
+			return fmt.Errorf("invalid env var name: %q", k)
+		}
+		if reservedTemplateEnv[k] || strings.HasPrefix(k, "REXEC_") {
+			return fmt.Errorf("env var %s is reserved", k)
+		}
+		if strings.ContainsAny(v, "\x00\n") {
+			return fmt.Errorf("env var %s must be a single line", k)
+		}
+	}
+
+	if t.Dotfiles != nil {
+		if err := ValidateGitURL(t.Dotfiles.Repo); err != nil {
+			return fmt.Errorf("dotfiles.repo: %w", err)
+		}
+		if t.Dotfiles.Ref != "" && !templateRefPattern.MatchString(t.Dotfiles.Ref) {
+			return fmt.Errorf("dotfiles.ref: invalid ref %q", t.Dotfiles.Ref)
+		}
+		if t.Dotfiles.Install != "" && (!templateRefPattern.MatchString(t.Dotfiles.Install) || strings.Contains(t.Dotfiles.Install, "..")) {
+			return fmt.Errorf("dotfiles.install: must be a relative path inside the repo")
+		}
+	}
+
+	if len(t.Startup) > MaxTemplateStartup {
+		return fmt.Errorf("too many startup commands (max %d)", MaxTemplateStartup)
+	}
+	for _, cmd := range t.Startup {
+		if strings.TrimSpace(cmd) == "" || strings.Contains(cmd, "\x00") {
+			return fmt.Errorf("startup commands must be non-empty")
+		}
+	}
+
+	if len(t.Ports) > MaxTemplatePorts {
+		return fmt.Errorf("too many ports (max %d)", MaxTemplatePorts)
+	}
+	seen := make(map[int]bool, len(t.Ports))
+	for _, p := range t.Ports {
+		if p.Port <= 0 || p.Port > 65535 {
+			return fmt.Errorf("invalid port: %d", p.Port)
+		}
+		if seen[p.Port] {
+			return fmt.Errorf("duplicate port: %d", p.Port)
+		}
+		seen[p.Port] = true
+	}
+
+	if t.Resources.MemoryMB < 0 || t.Resources.CPUShares < 0 || t.Resources.DiskMB < 0 {
+		return fmt.Errorf("resources must not be negative")
+	}
+	return nil
+}
+
+// ValidateGitURL only allows https remotes, so user input can't reach local
+// paths or git's ext:: transports on the server. Hosts given as internal IPs
+// are rejected here; names are checked with ResolvePublicHost when cloning.
+func ValidateGitURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return fmt.Errorf("must be an https git URL without credentials")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !IsPublicIP(ip) {
+		return fmt.Errorf("must not point at an internal address")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Shared volume limits
+const (
+	DefaultVolumeSizeMB = 1024
+	MinVolumeSizeMB     = 64
+	MaxVolumeMounts     = 8 // shared volumes per terminal
+)
+
+// HomeMountPath is where a terminal's own home volume is mounted
+const HomeMountPath = "/home/user"
+
+// reservedMountPaths hold the OS, or are tmpfs mounts set up for every terminal
+var reservedMountPaths = []string{
+	"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/proc",
+	"/run", "/sbin", "/sys", "/tmp", "/usr", "/var",
+}
+
+// VolumeMountRequest attaches a shared volume to a terminal
+type VolumeMountRequest struct {
+	VolumeID string `json:"volume_id" binding:"required"` // Volume ID or name
+	Path     string `json:"path" binding:"required"`      // Absolute path inside the terminal
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// CleanMountPath validates where a shared volume is mounted and returns the
+// cleaned path. Volumes can go anywhere outside the system directories,
+// including below the home directory (e.g. /home/user/projects).
+func CleanMountPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("mount path must be absolute")
+	}
+	if len(p) > 255 || strings.ContainsAny(p, ":,\x00") {
+		return "", fmt.Errorf("invalid mount path")
+	}
+
+	clean := path.Clean(p)
+	if clean == "/" || clean == HomeMountPath {
+		return "", fmt.Errorf("cannot mount a volume over %s", clean)
+	}
+	for _, reserved := range reservedMountPaths {
+		if clean == reserved || strings.HasPrefix(clean, reserved+"/") {
+			return "", fmt.Errorf("cannot mount a volume under %s", reserved)
+		}
+	}
+	return clean, nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import "testing"
+
+func TestCleanMountPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"Top-level directory", "/data", "/data", false},
+		{"Below home", "/home/user/projects", "/home/user/projects", false},
+		{"Cleaned", "/data//cache/../shared/", "/data/shared", false},
+		{"Relative", "data", "", true},
+		{"Root", "/", "", true},
+		{"Home itself", "/home/user/", "", true},
+		{"System directory", "/etc", "", true},
+		{"Under system directory", "/usr/local/lib", "", true},
+		{"Escapes into system directory", "/data/../var/lib", "", true},
+		{"Similar to system directory", "/etcetera", "/etcetera", false},
+		{"Mount option separator", "/data:ro", "", true},
+		{"Comma", "/a,b", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CleanMountPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CleanMountPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CleanMountPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 type PostgresStore struct {
 	db        *sqlx.DB
 	encryptor *crypto.Encryptor
+	leaders   *leaderSession
 }
 
 // NewPostgresStore creates a new PostgreSQL store
@@ -35,6 +36,7 @@ func NewPostgresStore(databaseURL string, encryptor *crypto.Encryptor) (*Postgre
 	store := &PostgresStore{
 		db:        db,
 		encryptor: encryptor,
+		leaders:   &leaderSession{db: db, held: make(map[int64]string)},
 	}
 
 	// Run migrations
@@ -576,6 +578,213 @@ func (s *PostgresStore) migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_tutorials_category ON tutorials(category);
 	CREATE INDEX IF NOT EXISTS idx_tutorials_published ON tutorials(is_published);
 
+	-- Workspace snapshots (committed image + home volume archive)
+	CREATE TABLE IF NOT EXISTS container_snapshots (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		container_id VARCHAR(64) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		source_image VARCHAR(255) NOT NULL,
+		role VARCHAR(50),
+		image_tag VARCHAR(255),
+		archive_path TEXT,
+		size_bytes BIGINT DEFAULT 0,
+		status VARCHAR(20) DEFAULT 'creating',
+		error TEXT,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_container_snapshots_user_id ON container_snapshots(user_id);
+	CREATE INDEX IF NOT EXISTS idx_container_snapshots_container_id ON container_snapshots(container_id);
+
+	-- Images built from a user's Dockerfile; rebuilding a name replaces the image
+	CREATE TABLE IF NOT EXISTS image_builds (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(64) NOT NULL,
+		image_tag VARCHAR(255) NOT NULL,
+		dockerfile TEXT,
+		source_repo TEXT,
+		source_ref VARCHAR(128),
+		source_path TEXT,
+		dockerfile_path TEXT,
+		status VARCHAR(20) DEFAULT 'building',
+		error TEXT,
+		size_bytes BIGINT DEFAULT 0,
+		cached_steps INT DEFAULT 0,
+		log TEXT,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		finished_at TIMESTAMP WITH TIME ZONE,
+		UNIQUE (user_id, name)
+	);
+
+	-- Private registry credentials; username and secret are encrypted
+	CREATE TABLE IF NOT EXISTS registry_credentials (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		registry VARCHAR(255) NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		username TEXT,
+		secret TEXT NOT NULL,
+		token_url TEXT,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, registry)
+	);
+
+	-- Long-running commands supervised inside a terminal, with the supervisor's last view of them
+	CREATE TABLE IF NOT EXISTS container_services (
+		id VARCHAR(36) PRIMARY KEY,
+		container_id VARCHAR(64) NOT NULL REFERENCES containers(id) ON DELETE CASCADE,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(32) NOT NULL,
+		command TEXT NOT NULL,
+		workdir TEXT,
+		env JSONB,
+		restart_policy VARCHAR(20) DEFAULT 'always',
+		enabled BOOLEAN DEFAULT true,
+		generation INT DEFAULT 0,
+		status VARCHAR(20) DEFAULT 'stopped',
+		pid INT DEFAULT 0,
+		restarts INT DEFAULT 0,
+		exit_code INT,
+		last_error TEXT,
+		started_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (container_id, name)
+	);
+
+	-- Resource usage history of terminals (by container id) and agents. Resolution 0 holds
+	-- raw samples; coarser rows are rollups of the tier below
+	CREATE TABLE IF NOT EXISTS resource_metrics (
+		source_type VARCHAR(16) NOT NULL,
+		source_id VARCHAR(64) NOT NULL,
+		resolution INT NOT NULL,
+		bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+		samples INT NOT NULL DEFAULT 1,
+		cpu_avg REAL NOT NULL DEFAULT 0,
+		cpu_max REAL NOT NULL DEFAULT 0,
+		memory_avg BIGINT NOT NULL DEFAULT 0,
+		memory_max BIGINT NOT NULL DEFAULT 0,
+		memory_limit BIGINT NOT NULL DEFAULT 0,
+		disk_usage BIGINT NOT NULL DEFAULT 0,
+		disk_limit BIGINT NOT NULL DEFAULT 0,
+		net_rx_rate REAL,
+		net_tx_rate REAL,
+		PRIMARY KEY (source_type, source_id, resolution, bucket)
+	);
+	CREATE INDEX IF NOT EXISTS idx_resource_metrics_resolution ON resource_metrics(resolution, bucket);
+
+	-- Resource limit breaches, crashes and failed health checks of terminals
+	CREATE TABLE IF NOT EXISTS container_incidents (
+		id VARCHAR(36) PRIMARY KEY,
+		container_id VARCHAR(64) NOT NULL REFERENCES containers(id) ON DELETE CASCADE,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		kind VARCHAR(32) NOT NULL,
+		message TEXT NOT NULL,
+		details JSONB,
+		action VARCHAR(32) NOT NULL DEFAULT 'none',
+		action_error TEXT,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_container_incidents_container ON container_incidents(container_id, created_at DESC);
+
+	-- Environment templates (rexec.yaml), owned by a user and optionally shared with their org
+	CREATE TABLE IF NOT EXISTS environment_templates (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		org_id VARCHAR(64),
+		name VARCHAR(64) NOT NULL,
+		description TEXT,
+		content TEXT NOT NULL,
+		source_repo TEXT,
+		source_ref VARCHAR(128),
+		source_path TEXT,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, name)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_environment_templates_org_id ON environment_templates(org_id);
+
+	-- Custom roles; global roles are created by admins and offered to every user
+	CREATE TABLE IF NOT EXISTS custom_roles (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		is_global BOOLEAN DEFAULT false,
+		name VARCHAR(64) NOT NULL,
+		description TEXT,
+		icon VARCHAR(16),
+		base_role VARCHAR(64),
+		packages JSONB,
+		post_install JSONB,
+		verify JSONB,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, name)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_custom_roles_global ON custom_roles(is_global) WHERE is_global;
+
+	-- Labels of claimed warm pool containers (Docker labels are fixed at creation)
+	CREATE TABLE IF NOT EXISTS warm_pool_claims (
+		docker_id VARCHAR(64) PRIMARY KEY,
+		labels JSONB NOT NULL,
+		claimed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Shared volumes live independently of terminals and can be mounted into several
+	CREATE TABLE IF NOT EXISTS shared_volumes (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(64) NOT NULL,
+		docker_volume VARCHAR(255) NOT NULL,
+		size_mb BIGINT NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, name)
+	);
+
+	CREATE TABLE IF NOT EXISTS volume_attachments (
+		volume_id VARCHAR(36) NOT NULL REFERENCES shared_volumes(id) ON DELETE CASCADE,
+		container_id VARCHAR(64) NOT NULL REFERENCES containers(id) ON DELETE CASCADE,
+		path VARCHAR(255) NOT NULL,
+		read_only BOOLEAN DEFAULT false,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (volume_id, container_id),
+		UNIQUE (container_id, path)
+	);
+
+	-- Named terminal sizes; seeded with the built-in catalog on first run
+	CREATE TABLE IF NOT EXISTS resource_classes (
+		name VARCHAR(32) PRIMARY KEY,
+		description TEXT,
+		cpu_millicores BIGINT NOT NULL,
+		memory_mb BIGINT NOT NULL,
+		disk_mb BIGINT NOT NULL,
+		pids_limit BIGINT NOT NULL,
+		network_mb BIGINT NOT NULL DEFAULT 0,
+		burst_cpu_millicores BIGINT NOT NULL DEFAULT 0,
+		burst_credits BIGINT NOT NULL DEFAULT 0,
+		tiers TEXT[] NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Docker hosts terminals are placed on; the default node is DOCKER_HOST
+	CREATE TABLE IF NOT EXISTS nodes (
+		id VARCHAR(32) PRIMARY KEY,
+		host TEXT NOT NULL DEFAULT '',
+		cert_path TEXT NOT NULL DEFAULT '',
+		labels JSONB,
+		cpu_millicores BIGINT NOT NULL DEFAULT 0,
+		memory_mb BIGINT NOT NULL DEFAULT 0,
+		status VARCHAR(16) NOT NULL DEFAULT 'active',
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
 	-- Add new columns if missing (for existing installations)
 	DO $$ BEGIN
 		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='agents' AND column_name='last_heartbeat') THEN
@@ -605,6 +814,24 @@ func (s *PostgresStore) migrate() error {
 		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='containers' AND column_name='provider_config') THEN
 			ALTER TABLE containers ADD COLUMN provider_config JSONB;
 		END IF;
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='containers' AND column_name='schedule') THEN
+			ALTER TABLE containers ADD COLUMN schedule JSONB;
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='containers' AND column_name='egress_policy') THEN
+			ALTER TABLE containers ADD COLUMN egress_policy JSONB;
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='containers' AND column_name='resource_class') THEN
+			ALTER TABLE containers ADD COLUMN resource_class VARCHAR(32);
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='containers' AND column_name='incident_policy') THEN
+			ALTER TABLE containers ADD COLUMN incident_policy JSONB;
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='resource_classes' AND column_name='node_selector') THEN
+			ALTER TABLE resource_classes ADD COLUMN node_selector JSONB;
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='users' AND column_name='org_id') THEN
+			ALTER TABLE users ADD COLUMN org_id VARCHAR(64);
+		END IF;
 		ALTER TABLE tutorials ALTER COLUMN video_url DROP NOT NULL;
 	END $$;
 	`
@@ -614,6 +841,10 @@ func (s *PostgresStore) migrate() error {
 		return err
 	}
 
+	if err := s.seedResourceClasses(); err != nil {
+		return err
+	}
+
 	// Seed example snippets for marketplace
 	return s.seedExampleSnippets()
 }
@@ -1498,6 +1729,13 @@ func (s *PostgresStore) UpdateContainerDockerID(ctx context.Context, id, dockerI
 	return err
 }
 
+// UpdateContainerVolumeName updates the volume mounted as a container's home directory
+func (s *PostgresStore) UpdateContainerVolumeName(ctx context.Context, id, volumeName string) error {
+	query := `UPDATE containers SET volume_name = $2 WHERE id = $1 AND deleted_at IS NULL`
+	_, err := s.db.ExecContext(ctx, query, id, volumeName)
+	return err
+}
+
 // UpdateContainerError updates a container's error message (stored in status field with error: prefix)
 func (s *PostgresStore) UpdateContainerError(ctx context.Context, id, errorMsg string) error {
 	// Store error in a way that can be retrieved - we'll use status field with error prefix
@@ -1512,11 +1750,29 @@ func (s *PostgresStore) UpdateContainerError(ctx context.Context, id, errorMsg s
 	return nil
 }
 
+// UpdateContainerImage updates the image a container is (re)created from
+func (s *PostgresStore) UpdateContainerImage(ctx context.Context, id, image string) error {
+	query := `UPDATE containers SET image = $2 WHERE id = $1 AND deleted_at IS NULL`
+	_, err := s.db.ExecContext(ctx, query, id, image)
+	return err
+}
+
+// CountContainersByImage returns how many live containers are (re)created from image
+func (s *PostgresStore) CountContainersByImage(ctx context.Context, image string) (int64, error) {
+	var count int64
+	query := `SELECT COUNT(*) FROM containers WHERE image = $1 AND deleted_at IS NULL`
+	err := s.db.QueryRowContext(ctx, query, image).Scan(&count)
+	return count, err
+}
+
 // DeleteContainer soft deletes a container record by setting deleted_at
 func (s *PostgresStore) DeleteContainer(ctx context.Context, id string) error {
 	query := `UPDATE containers SET deleted_at = CURRENT_TIMESTAMP, status = 'deleted' WHERE id = $1`
-	_, err := s.db.ExecContext(ctx, query, id)
-	return err
+	if _, err := s.db.ExecContext(ctx, query, id); err != nil {
+		return err
+	}
+	// Deleted terminals no longer hold on to shared volumes
+	return s.DetachContainerVolumes(ctx, id)
 }
 
 // UpdateContainerSettings updates a container's name and resource settings
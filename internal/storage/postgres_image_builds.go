@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ImageBuildRecord represents a custom image built from a user's Dockerfile
+type ImageBuildRecord struct {
+	ID             string     `json:"id"`
+	UserID         string     `json:"user_id"`
+	Name           string     `json:"name"`
+	ImageTag       string     `json:"-"`
+	Dockerfile     string     `json:"dockerfile,omitempty"` // Inline Dockerfile, if one was sent
+	SourceRepo     string     `json:"source_repo,omitempty"`
+	SourceRef      string     `json:"source_ref,omitempty"`
+	SourcePath     string     `json:"source_path,omitempty"`
+	DockerfilePath string     `json:"dockerfile_path,omitempty"`
+	Status         string     `json:"status"` // building, ready, error
+	Error          string     `json:"error,omitempty"`
+	SizeBytes      int64      `json:"size_bytes"`
+	CachedSteps    int        `json:"cached_steps"`
+	Log            string     `json:"-"` // Tail of the build output
+	CreatedAt      time.Time  `json:"created_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+const imageBuildColumns = `id, user_id, name, image_tag, COALESCE(dockerfile, ''), COALESCE(source_repo, ''),
+	COALESCE(source_ref, ''), COALESCE(source_path, ''), COALESCE(dockerfile_path, ''), COALESCE(status, 'building'),
+	COALESCE(error, ''), COALESCE(size_bytes, 0), COALESCE(cached_steps, 0), COALESCE(log, ''), created_at, finished_at`
+
+func scanImageBuild(row interface{ Scan(...interface{}) error }) (*ImageBuildRecord, error) {
+	var b ImageBuildRecord
+	var finishedAt sql.NullTime
+	err := row.Scan(
+		&b.ID,
+		&b.UserID,
+		&b.Name,
+		&b.ImageTag,
+		&b.Dockerfile,
+		&b.SourceRepo,
+		&b.SourceRef,
+		&b.SourcePath,
+		&b.DockerfilePath,
+		&b.Status,
+		&b.Error,
+		&b.SizeBytes,
+		&b.CachedSteps,
+		&b.Log,
+		&b.CreatedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		b.FinishedAt = &finishedAt.Time
+	}
+	return &b, nil
+}
+
+// SaveImageBuild starts a build record. Rebuilding an existing name resets
+// that record, keeping its ID.
+func (s *PostgresStore) SaveImageBuild(ctx context.Context, b *ImageBuildRecord) error {
+	query := `
+		INSERT INTO image_builds (id, user_id, name, image_tag, dockerfile, source_repo, source_ref, source_path,
+			dockerfile_path, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (user_id, name) DO UPDATE SET
+			image_tag = EXCLUDED.image_tag,
+			dockerfile = EXCLUDED.dockerfile,
+			source_repo = EXCLUDED.source_repo,
+			source_ref = EXCLUDED.source_ref,
+			source_path = EXCLUDED.source_path,
+			dockerfile_path = EXCLUDED.dockerfile_path,
+			status = EXCLUDED.status,
+			error = NULL,
+			log = NULL,
+			created_at = EXCLUDED.created_at,
+			finished_at = NULL
+		RETURNING id
+	`
+	return s.db.QueryRowContext(ctx, query,
+		b.ID, b.UserID, b.Name, b.ImageTag, b.Dockerfile, b.SourceRepo, b.SourceRef, b.SourcePath,
+		b.DockerfilePath, b.Status, b.CreatedAt,
+	).Scan(&b.ID)
+}
+
+// MarkImageBuildReady records a successful build
+func (s *PostgresStore) MarkImageBuildReady(ctx context.Context, id string, sizeBytes int64, cachedSteps int, log string) error {
+	query := `UPDATE image_builds SET status = 'ready', size_bytes = $2, cached_steps = $3, log = $4, error = NULL,
+		finished_at = $5 WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id, sizeBytes, cachedSteps, log, time.Now())
+	return err
+}
+
+// MarkImageBuildFailed records why a build failed
+func (s *PostgresStore) MarkImageBuildFailed(ctx context.Context, id, errorMsg, log string) error {
+	query := `UPDATE image_builds SET status = 'error', error = $2, log = $3, finished_at = $4 WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id, errorMsg, log, time.Now())
+	return err
+}
+
+// GetImageBuildByID retrieves a build by ID, returning nil if it doesn't exist
+func (s *PostgresStore) GetImageBuildByID(ctx context.Context, id string) (*ImageBuildRecord, error) {
+	query := `SELECT ` + imageBuildColumns + ` FROM image_builds WHERE id = $1`
+	b, err := scanImageBuild(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return b, err
+}
+
+// GetImageBuildByName retrieves a user's build by name, returning nil if it doesn't exist
+func (s *PostgresStore) GetImageBuildByName(ctx context.Context, userID, name string) (*ImageBuildRecord, error) {
+	query := `SELECT ` + imageBuildColumns + ` FROM image_builds WHERE user_id = $1 AND name = $2`
+	b, err := scanImageBuild(s.db.QueryRowContext(ctx, query, userID, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return b, err
+}
+
+// GetImageBuildsByUserID lists a user's builds, newest first
+func (s *PostgresStore) GetImageBuildsByUserID(ctx context.Context, userID string) ([]*ImageBuildRecord, error) {
+	query := `SELECT ` + imageBuildColumns + ` FROM image_builds WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var builds []*ImageBuildRecord
+	for rows.Next() {
+		b, err := scanImageBuild(rows)
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, b)
+	}
+	return builds, rows.Err()
+}
+
+// CountImageBuildsByUserID returns how many builds count against the user's quota
+func (s *PostgresStore) CountImageBuildsByUserID(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	query := `SELECT COUNT(*) FROM image_builds WHERE user_id = $1 AND status != 'error'`
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// DeleteImageBuild permanently deletes a build record
+func (s *PostgresStore) DeleteImageBuild(ctx context.Context, id string) error {
+	query := `DELETE FROM image_builds WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
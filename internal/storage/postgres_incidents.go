@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/rexec/rexec/internal/models"
+)
+
+// UpdateContainerIncidentPolicy sets a container's incident policy; an empty policy clears it
+func (s *PostgresStore) UpdateContainerIncidentPolicy(ctx context.Context, id string, policy *models.IncidentPolicy) error {
+	var policyJSON []byte
+	if !policy.IsEmpty() {
+		var err error
+		if policyJSON, err = json.Marshal(policy); err != nil {
+			return err
+		}
+	}
+	query := `UPDATE containers SET incident_policy = $2 WHERE id = $1 AND deleted_at IS NULL`
+	_, err := s.db.ExecContext(ctx, query, id, policyJSON)
+	return err
+}
+
+// GetContainerIncidentPolicy returns a container's incident policy, or nil if it has none
+func (s *PostgresStore) GetContainerIncidentPolicy(ctx context.Context, id string) (*models.IncidentPolicy, error) {
+	var policyJSON []byte
+	err := s.db.QueryRowContext(ctx, `SELECT incident_policy FROM containers WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&policyJSON)
+	if err == sql.ErrNoRows || (err == nil && len(policyJSON) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var policy models.IncidentPolicy
+	if err := json.Unmarshal(policyJSON, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// CreateContainerIncident records an incident
+func (s *PostgresStore) CreateContainerIncident(ctx context.Context, incident *models.ContainerIncident) error {
+	var detailsJSON []byte
+	if len(incident.Details) > 0 {
+		var err error
+		if detailsJSON, err = json.Marshal(incident.Details); err != nil {
+			return err
+		}
+	}
+	query := `
+		INSERT INTO container_incidents (id, container_id, user_id, kind, message, details, action, action_error, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
+	`
+	_, err := s.db.ExecContext(ctx, query, incident.ID, incident.ContainerID, incident.UserID, incident.Kind,
+		incident.Message, detailsJSON, incident.Action, incident.ActionError, incident.CreatedAt)
+	return err
+}
+
+// GetContainerIncidents returns a container's most recent incidents, newest first
+func (s *PostgresStore) GetContainerIncidents(ctx context.Context, containerID string, limit int) ([]*models.ContainerIncident, error) {
+	query := `
+		SELECT i.id, i.container_id, COALESCE(c.docker_id, ''), i.user_id, i.kind, i.message, i.details,
+			i.action, COALESCE(i.action_error, ''), i.created_at
+		FROM container_incidents i JOIN containers c ON c.id = i.container_id
+		WHERE i.container_id = $1
+		ORDER BY i.created_at DESC
+		LIMIT $2
+	`
+	rows, err := s.db.QueryContext(ctx, query, containerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []*models.ContainerIncident{}
+	for rows.Next() {
+		var incident models.ContainerIncident
+		var detailsJSON []byte
+		if err := rows.Scan(&incident.ID, &incident.ContainerID, &incident.DockerID, &incident.UserID, &incident.Kind,
+			&incident.Message, &detailsJSON, &incident.Action, &incident.ActionError, &incident.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(detailsJSON) > 0 {
+			if err := json.Unmarshal(detailsJSON, &incident.Details); err != nil {
+				return nil, err
+			}
+		}
+		incidents = append(incidents, &incident)
+	}
+	return incidents, rows.Err()
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rexec/rexec/internal/models"
+)
+
+// metricsInsertBatch keeps a batch of container samples well under
+// Postgres's limit on query parameters
+const metricsInsertBatch = 500
+
+// metricsAggregates are the columns of rows aggregated from finer ones
+const metricsAggregates = `SUM(samples), AVG(cpu_avg), MAX(cpu_max), AVG(memory_avg)::BIGINT, MAX(memory_max),
+	MAX(memory_limit), MAX(disk_usage), MAX(disk_limit), AVG(net_rx_rate), AVG(net_tx_rate)`
+
+// RecordContainerMetrics stores raw samples of running containers, keyed by
+// Docker ID. Samples of containers without a live record are dropped.
+func (s *PostgresStore) RecordContainerMetrics(ctx context.Context, samples map[string]models.MetricSample) error {
+	var values []string
+	var args []interface{}
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		query := `
+			INSERT INTO resource_metrics (source_type, source_id, resolution, bucket, cpu_avg, cpu_max,
+				memory_avg, memory_max, memory_limit, disk_usage, disk_limit, net_rx_rate, net_tx_rate)
+			SELECT 'container', c.id, 0, v.bucket, v.cpu, v.cpu, v.memory, v.memory, v.memory_limit,
+				v.disk_usage, v.disk_limit, v.net_rx, v.net_tx
+			FROM (VALUES ` + strings.Join(values, ", ") + `)
+				AS v(docker_id, bucket, cpu, memory, memory_limit, disk_usage, disk_limit, net_rx, net_tx)
+			JOIN containers c ON c.docker_id = v.docker_id AND c.deleted_at IS NULL
+			ON CONFLICT DO NOTHING
+		`
+		_, err := s.db.ExecContext(ctx, query, args...)
+		values, args = values[:0], args[:0]
+		return err
+	}
+
+	for dockerID, sample := range samples {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d::TEXT, $%d::TIMESTAMPTZ, $%d::REAL, $%d::BIGINT, $%d::BIGINT, $%d::BIGINT, $%d::BIGINT, $%d::REAL, $%d::REAL)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9))
+		args = append(args, dockerID, sample.Time, sample.CPUPercent, sample.Memory, sample.MemoryLimit,
+			sample.DiskUsage, sample.DiskLimit, sample.NetRxRate, sample.NetTxRate)
+		if len(values) == metricsInsertBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// RecordAgentMetrics stores a raw sample of an agent's host
+func (s *PostgresStore) RecordAgentMetrics(ctx context.Context, agentID string, sample models.MetricSample) error {
+	query := `
+		INSERT INTO resource_metrics (source_type, source_id, resolution, bucket, cpu_avg, cpu_max,
+			memory_avg, memory_max, memory_limit, disk_usage, disk_limit, net_rx_rate, net_tx_rate)
+		VALUES ($1, $2, 0, $3, $4, $4, $5, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := s.db.ExecContext(ctx, query, models.MetricsSourceAgent, agentID, sample.Time, sample.CPUPercent,
+		sample.Memory, sample.MemoryLimit, sample.DiskUsage, sample.DiskLimit, sample.NetRxRate, sample.NetTxRate)
+	return err
+}
+
+// RollupMetrics aggregates the rows of tier from into tier to for every
+// bucket of to that starts in [start, end). Buckets already rolled up are
+// replaced, so a range can safely be rolled up again.
+func (s *PostgresStore) RollupMetrics(ctx context.Context, from, to models.MetricsTier, start, end time.Time) error {
+	res := int(to.Resolution.Seconds())
+	query := `
+		INSERT INTO resource_metrics (source_type, source_id, resolution, bucket, samples, cpu_avg, cpu_max,
+			memory_avg, memory_max, memory_limit, disk_usage, disk_limit, net_rx_rate, net_tx_rate)
+		SELECT source_type, source_id, $2::INT, to_timestamp(floor(extract(epoch FROM bucket) / $2::INT) * $2::INT),
+			` + metricsAggregates + `
+		FROM resource_metrics
+		WHERE resolution = $1::INT AND bucket >= $3 AND bucket < $4
+		GROUP BY source_type, source_id, 4
+		ON CONFLICT (source_type, source_id, resolution, bucket) DO UPDATE SET
+			samples = EXCLUDED.samples, cpu_avg = EXCLUDED.cpu_avg, cpu_max = EXCLUDED.cpu_max,
+			memory_avg = EXCLUDED.memory_avg, memory_max = EXCLUDED.memory_max, memory_limit = EXCLUDED.memory_limit,
+			disk_usage = EXCLUDED.disk_usage, disk_limit = EXCLUDED.disk_limit,
+			net_rx_rate = EXCLUDED.net_rx_rate, net_tx_rate = EXCLUDED.net_tx_rate
+	`
+	_, err := s.db.ExecContext(ctx, query, int(from.Resolution.Seconds()), res, start, end)
+	return err
+}
+
+// PruneMetrics deletes the tier's rows older than its retention and returns
+// how many were deleted
+func (s *PostgresStore) PruneMetrics(ctx context.Context, tier models.MetricsTier, now time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM resource_metrics WHERE resolution = $1 AND bucket < $2`,
+		int(tier.Resolution.Seconds()), now.Add(-tier.Retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetMetrics returns a source's usage in [from, to) from the given tier,
+// aggregated into steps
+func (s *PostgresStore) GetMetrics(ctx context.Context, sourceType, sourceID string, tier models.MetricsTier, from, to time.Time, step time.Duration) ([]models.MetricPoint, error) {
+	query := `
+		SELECT to_timestamp(floor(extract(epoch FROM bucket) / $4::BIGINT) * $4::BIGINT) AS t, ` + metricsAggregates + `
+		FROM resource_metrics
+		WHERE source_type = $1 AND source_id = $2 AND resolution = $3 AND bucket >= $5 AND bucket < $6
+		GROUP BY t
+		ORDER BY t
+	`
+	rows, err := s.db.QueryContext(ctx, query, sourceType, sourceID, int(tier.Resolution.Seconds()),
+		int64(step.Seconds()), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []models.MetricPoint{}
+	for rows.Next() {
+		var p models.MetricPoint
+		var rx, tx sql.NullFloat64
+		if err := rows.Scan(&p.Time, &p.Samples, &p.CPUPercent, &p.CPUMax, &p.Memory, &p.MemoryMax,
+			&p.MemoryLimit, &p.DiskUsage, &p.DiskLimit, &rx, &tx); err != nil {
+			return nil, err
+		}
+		if rx.Valid {
+			p.NetRxRate = &rx.Float64
+		}
+		if tx.Valid {
+			p.NetTxRate = &tx.Float64
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/rexec/rexec/internal/models"
+)
+
+// UpdateContainerEgressPolicy sets a container's own egress policy; nil clears it
+func (s *PostgresStore) UpdateContainerEgressPolicy(ctx context.Context, id string, policy *models.EgressPolicy) error {
+	var policyJSON []byte
+	if policy != nil {
+		var err error
+		if policyJSON, err = json.Marshal(policy); err != nil {
+			return err
+		}
+	}
+	query := `UPDATE containers SET egress_policy = $2 WHERE id = $1 AND deleted_at IS NULL`
+	_, err := s.db.ExecContext(ctx, query, id, policyJSON)
+	return err
+}
+
+// GetEgressPolicies returns the egress policies of live containers, keyed by Docker ID
+func (s *PostgresStore) GetEgressPolicies(ctx context.Context) (map[string]*models.EgressPolicy, error) {
+	query := `
+		SELECT docker_id, egress_policy FROM containers
+		WHERE deleted_at IS NULL AND egress_policy IS NOT NULL AND docker_id IS NOT NULL AND docker_id != ''
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make(map[string]*models.EgressPolicy)
+	for rows.Next() {
+		var dockerID string
+		var policyJSON []byte
+		if err := rows.Scan(&dockerID, &policyJSON); err != nil {
+			return nil, err
+		}
+		var policy models.EgressPolicy
+		if err := json.Unmarshal(policyJSON, &policy); err != nil {
+			log.Printf("[Network] Ignoring malformed egress policy on container %s: %v", dockerID, err)
+			continue
+		}
+		policies[dockerID] = &policy
+	}
+	return policies, rows.Err()
+}
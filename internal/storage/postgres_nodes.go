@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/rexec/rexec/internal/models"
+)
+
+const nodeColumns = `id, host, cert_path, labels, cpu_millicores, memory_mb, status, created_at, updated_at`
+
+func scanNode(row interface{ Scan(...interface{}) error }) (*models.Node, error) {
+	var node models.Node
+	var labelsJSON []byte
+	err := row.Scan(
+		&node.ID,
+		&node.Host,
+		&node.CertPath,
+		&labelsJSON,
+		&node.CPUMillicores,
+		&node.MemoryMB,
+		&node.Status,
+		&node.CreatedAt,
+		&node.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	node.Labels = map[string]string{}
+	if len(labelsJSON) > 0 {
+		if err := json.Unmarshal(labelsJSON, &node.Labels); err != nil {
+			return nil, err
+		}
+	}
+	return &node, nil
+}
+
+// GetNodes lists the registered nodes, default first
+func (s *PostgresStore) GetNodes(ctx context.Context) ([]*models.Node, error) {
+	query := `SELECT ` + nodeColumns + ` FROM nodes ORDER BY id <> 'default', id`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := []*models.Node{}
+	for rows.Next() {
+		node, err := scanNode(rows)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
+// GetNode retrieves a node by ID, returning nil if it doesn't exist
+func (s *PostgresStore) GetNode(ctx context.Context, id string) (*models.Node, error) {
+	query := `SELECT ` + nodeColumns + ` FROM nodes WHERE id = $1`
+	node, err := scanNode(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return node, err
+}
+
+// SaveNode registers a node or replaces the one with the same ID
+func (s *PostgresStore) SaveNode(ctx context.Context, node *models.Node) error {
+	labelsJSON, err := json.Marshal(node.Labels)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO nodes (id, host, cert_path, labels, cpu_millicores, memory_mb, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			host = EXCLUDED.host,
+			cert_path = EXCLUDED.cert_path,
+			labels = EXCLUDED.labels,
+			cpu_millicores = EXCLUDED.cpu_millicores,
+			memory_mb = EXCLUDED.memory_mb,
+			status = EXCLUDED.status,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err = s.db.ExecContext(ctx, query, node.ID, node.Host, node.CertPath, labelsJSON,
+		node.CPUMillicores, node.MemoryMB, node.Status, node.CreatedAt, node.UpdatedAt)
+	return err
+}
+
+// EnsureDefaultNode registers the default node if it isn't yet, leaving an
+// existing row's labels, capacity and status alone
+func (s *PostgresStore) EnsureDefaultNode(ctx context.Context) error {
+	query := `
+		INSERT INTO nodes (id, labels, status)
+		VALUES ($1, '{}', $2)
+		ON CONFLICT (id) DO NOTHING
+	`
+	_, err := s.db.ExecContext(ctx, query, models.DefaultNodeID, models.NodeActive)
+	return err
+}
+
+// DeleteNode unregisters a node
+func (s *PostgresStore) DeleteNode(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM nodes WHERE id = $1`, id)
+	return err
+}
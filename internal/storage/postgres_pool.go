@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SavePoolClaim stores the labels of a claimed warm pool container
+func (s *PostgresStore) SavePoolClaim(ctx context.Context, dockerID string, labels map[string]string) error {
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO warm_pool_claims (docker_id, labels, claimed_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (docker_id) DO UPDATE SET labels = EXCLUDED.labels, claimed_at = NOW()
+	`
+	_, err = s.db.ExecContext(ctx, query, dockerID, labelsJSON)
+	return err
+}
+
+// GetPoolClaims returns the labels of every claimed warm pool container, keyed by Docker ID
+func (s *PostgresStore) GetPoolClaims(ctx context.Context) (map[string]map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT docker_id, labels FROM warm_pool_claims`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := make(map[string]map[string]string)
+	for rows.Next() {
+		var dockerID string
+		var labelsJSON []byte
+		if err := rows.Scan(&dockerID, &labelsJSON); err != nil {
+			return nil, err
+		}
+		var labels map[string]string
+		if err := json.Unmarshal(labelsJSON, &labels); err != nil {
+			continue
+		}
+		claims[dockerID] = labels
+	}
+	return claims, rows.Err()
+}
+
+// DeletePoolClaim removes a claim once its container is gone
+func (s *PostgresStore) DeletePoolClaim(ctx context.Context, dockerID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM warm_pool_claims WHERE docker_id = $1`, dockerID)
+	return err
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rexec/rexec/internal/models"
+)
+
+const registryCredentialColumns = `id, user_id, registry, kind, COALESCE(username, ''), secret, COALESCE(token_url, ''),
+	created_at, updated_at`
+
+// scanRegistryCredential reads a credential and decrypts its username and secret
+func (s *PostgresStore) scanRegistryCredential(row interface{ Scan(...interface{}) error }) (*models.RegistryCredential, error) {
+	var c models.RegistryCredential
+	err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.Registry,
+		&c.Kind,
+		&c.Username,
+		&c.Secret,
+		&c.TokenURL,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Username != "" {
+		if c.Username, err = s.encryptor.Decrypt(c.Username); err != nil {
+			return nil, fmt.Errorf("failed to decrypt registry username: %w", err)
+		}
+	}
+	if c.Secret, err = s.encryptor.Decrypt(c.Secret); err != nil {
+		return nil, fmt.Errorf("failed to decrypt registry secret: %w", err)
+	}
+	return &c, nil
+}
+
+// SaveRegistryCredential stores a credential, replacing the user's existing
+// one for the same registry
+func (s *PostgresStore) SaveRegistryCredential(ctx context.Context, c *models.RegistryCredential) error {
+	username := ""
+	if c.Username != "" {
+		var err error
+		if username, err = s.encryptor.Encrypt(c.Username); err != nil {
+			return fmt.Errorf("failed to encrypt registry username: %w", err)
+		}
+	}
+	secret, err := s.encryptor.Encrypt(c.Secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt registry secret: %w", err)
+	}
+
+	query := `
+		INSERT INTO registry_credentials (id, user_id, registry, kind, username, secret, token_url, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id, registry) DO UPDATE SET
+			kind = EXCLUDED.kind,
+			username = EXCLUDED.username,
+			secret = EXCLUDED.secret,
+			token_url = EXCLUDED.token_url,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at
+	`
+	return s.db.QueryRowContext(ctx, query,
+		c.ID, c.UserID, c.Registry, c.Kind, username, secret, c.TokenURL, c.CreatedAt, c.UpdatedAt,
+	).Scan(&c.ID, &c.CreatedAt)
+}
+
+// GetRegistryCredentialsByUserID lists a user's credentials by registry
+func (s *PostgresStore) GetRegistryCredentialsByUserID(ctx context.Context, userID string) ([]*models.RegistryCredential, error) {
+	query := `SELECT ` + registryCredentialColumns + ` FROM registry_credentials WHERE user_id = $1 ORDER BY registry`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []*models.RegistryCredential
+	for rows.Next() {
+		c, err := s.scanRegistryCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+// GetRegistryCredentialByID retrieves a credential by ID, returning nil if it doesn't exist
+func (s *PostgresStore) GetRegistryCredentialByID(ctx context.Context, id string) (*models.RegistryCredential, error) {
+	query := `SELECT ` + registryCredentialColumns + ` FROM registry_credentials WHERE id = $1`
+	c, err := s.scanRegistryCredential(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+// GetRegistryCredentialForHost retrieves a user's credential for a registry
+// host, returning nil if they have none
+func (s *PostgresStore) GetRegistryCredentialForHost(ctx context.Context, userID, registry string) (*models.RegistryCredential, error) {
+	query := `SELECT ` + registryCredentialColumns + ` FROM registry_credentials WHERE user_id = $1 AND registry = $2`
+	c, err := s.scanRegistryCredential(s.db.QueryRowContext(ctx, query, userID, registry))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+// DeleteRegistryCredential permanently deletes a credential
+func (s *PostgresStore) DeleteRegistryCredential(ctx context.Context, id string) error {
+	query := `DELETE FROM registry_credentials WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
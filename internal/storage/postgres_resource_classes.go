@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rexec/rexec/internal/models"
+)
+
+const resourceClassColumns = `name, COALESCE(description, ''), cpu_millicores, memory_mb, disk_mb, pids_limit,
+	network_mb, burst_cpu_millicores, burst_credits, tiers, node_selector, created_at, updated_at`
+
+func scanResourceClass(row interface{ Scan(...interface{}) error }) (*models.ResourceClass, error) {
+	var rc models.ResourceClass
+	var selectorJSON []byte
+	err := row.Scan(
+		&rc.Name,
+		&rc.Description,
+		&rc.CPUMillicores,
+		&rc.MemoryMB,
+		&rc.DiskMB,
+		&rc.PidsLimit,
+		&rc.NetworkMB,
+		&rc.BurstCPUMillicores,
+		&rc.BurstCredits,
+		pq.Array(&rc.Tiers),
+		&selectorJSON,
+		&rc.CreatedAt,
+		&rc.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(selectorJSON) > 0 {
+		if err := json.Unmarshal(selectorJSON, &rc.NodeSelector); err != nil {
+			return nil, err
+		}
+	}
+	return &rc, nil
+}
+
+// seedResourceClasses fills an empty catalog with the built-in classes.
+// Admins can edit or delete them afterwards; they aren't re-added.
+func (s *PostgresStore) seedResourceClasses() error {
+	ctx := context.Background()
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM resource_classes`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	for _, rc := range models.DefaultResourceClasses() {
+		rc.CreatedAt = time.Now()
+		rc.UpdatedAt = rc.CreatedAt
+		if err := s.SaveResourceClass(ctx, rc); err != nil {
+			return err
+		}
+	}
+	log.Printf("✅ Seeded %d resource classes", len(models.DefaultResourceClasses()))
+	return nil
+}
+
+// GetResourceClasses lists the catalog, smallest first
+func (s *PostgresStore) GetResourceClasses(ctx context.Context) ([]*models.ResourceClass, error) {
+	query := `SELECT ` + resourceClassColumns + ` FROM resource_classes ORDER BY cpu_millicores, memory_mb, name`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	classes := []*models.ResourceClass{}
+	for rows.Next() {
+		rc, err := scanResourceClass(rows)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, rc)
+	}
+	return classes, rows.Err()
+}
+
+// GetResourceClass retrieves a class by name, returning nil if it doesn't exist
+func (s *PostgresStore) GetResourceClass(ctx context.Context, name string) (*models.ResourceClass, error) {
+	query := `SELECT ` + resourceClassColumns + ` FROM resource_classes WHERE name = $1`
+	rc, err := scanResourceClass(s.db.QueryRowContext(ctx, query, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rc, err
+}
+
+// SaveResourceClass creates a class or replaces the one with the same name
+func (s *PostgresStore) SaveResourceClass(ctx context.Context, rc *models.ResourceClass) error {
+	query := `
+		INSERT INTO resource_classes (name, description, cpu_millicores, memory_mb, disk_mb, pids_limit,
+			network_mb, burst_cpu_millicores, burst_credits, tiers, node_selector, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			cpu_millicores = EXCLUDED.cpu_millicores,
+			memory_mb = EXCLUDED.memory_mb,
+			disk_mb = EXCLUDED.disk_mb,
+			pids_limit = EXCLUDED.pids_limit,
+			network_mb = EXCLUDED.network_mb,
+			burst_cpu_millicores = EXCLUDED.burst_cpu_millicores,
+			burst_credits = EXCLUDED.burst_credits,
+			tiers = EXCLUDED.tiers,
+			node_selector = EXCLUDED.node_selector,
+			updated_at = EXCLUDED.updated_at
+	`
+	var selectorJSON []byte
+	if len(rc.NodeSelector) > 0 {
+		var err error
+		if selectorJSON, err = json.Marshal(rc.NodeSelector); err != nil {
+			return err
+		}
+	}
+	_, err := s.db.ExecContext(ctx, query,
+		rc.Name, rc.Description, rc.CPUMillicores, rc.MemoryMB, rc.DiskMB, rc.PidsLimit,
+		rc.NetworkMB, rc.BurstCPUMillicores, rc.BurstCredits, pq.Array(rc.Tiers), selectorJSON, rc.CreatedAt, rc.UpdatedAt,
+	)
+	return err
+}
+
+// DeleteResourceClass removes a class from the catalog. Terminals created
+// with it keep their sizes.
+func (s *PostgresStore) DeleteResourceClass(ctx context.Context, name string) error {
+	query := `DELETE FROM resource_classes WHERE name = $1`
+	_, err := s.db.ExecContext(ctx, query, name)
+	return err
+}
+
+// UpdateContainerResourceClass records the class a container was sized with;
+// an empty name means custom sizes
+func (s *PostgresStore) UpdateContainerResourceClass(ctx context.Context, id, class string) error {
+	query := `UPDATE containers SET resource_class = NULLIF($2, '') WHERE id = $1 AND deleted_at IS NULL`
+	_, err := s.db.ExecContext(ctx, query, id, class)
+	return err
+}
+
+// GetContainerResourceClass returns the class a container was sized with, or ""
+func (s *PostgresStore) GetContainerResourceClass(ctx context.Context, id string) (string, error) {
+	var class sql.NullString
+	query := `SELECT resource_class FROM containers WHERE id = $1`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&class)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return class.String, err
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/rexec/rexec/internal/models"
+)
+
+const customRoleColumns = `id, user_id, COALESCE(is_global, false), name, COALESCE(description, ''), COALESCE(icon, ''),
+	COALESCE(base_role, ''), packages, post_install, verify, created_at, updated_at`
+
+func scanCustomRole(row interface{ Scan(...interface{}) error }) (*models.CustomRole, error) {
+	var r models.CustomRole
+	var packagesJSON, postInstallJSON, verifyJSON []byte
+	err := row.Scan(
+		&r.ID,
+		&r.UserID,
+		&r.Global,
+		&r.Name,
+		&r.Description,
+		&r.Icon,
+		&r.BaseRole,
+		&packagesJSON,
+		&postInstallJSON,
+		&verifyJSON,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(packagesJSON) > 0 {
+		json.Unmarshal(packagesJSON, &r.Packages)
+	}
+	if len(postInstallJSON) > 0 {
+		json.Unmarshal(postInstallJSON, &r.PostInstall)
+	}
+	if len(verifyJSON) > 0 {
+		json.Unmarshal(verifyJSON, &r.Verify)
+	}
+	return &r, nil
+}
+
+func marshalCustomRoleSpec(r *models.CustomRole) (packages, postInstall, verify []byte, err error) {
+	if packages, err = json.Marshal(r.Packages); err != nil {
+		return nil, nil, nil, err
+	}
+	if postInstall, err = json.Marshal(r.PostInstall); err != nil {
+		return nil, nil, nil, err
+	}
+	if verify, err = json.Marshal(r.Verify); err != nil {
+		return nil, nil, nil, err
+	}
+	return packages, postInstall, verify, nil
+}
+
+// CreateCustomRole inserts a new custom role
+func (s *PostgresStore) CreateCustomRole(ctx context.Context, r *models.CustomRole) error {
+	packages, postInstall, verify, err := marshalCustomRoleSpec(r)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO custom_roles (id, user_id, is_global, name, description, icon, base_role, packages, post_install, verify, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10, $11, $12)
+	`
+	_, err = s.db.ExecContext(ctx, query,
+		r.ID, r.UserID, r.Global, r.Name, r.Description, r.Icon, r.BaseRole, packages, postInstall, verify, r.CreatedAt, r.UpdatedAt,
+	)
+	return err
+}
+
+// UpdateCustomRole replaces a custom role's definition
+func (s *PostgresStore) UpdateCustomRole(ctx context.Context, r *models.CustomRole) error {
+	packages, postInstall, verify, err := marshalCustomRoleSpec(r)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE custom_roles
+		SET is_global = $2, name = $3, description = $4, icon = $5, base_role = NULLIF($6, ''),
+			packages = $7, post_install = $8, verify = $9, updated_at = $10
+		WHERE id = $1
+	`
+	_, err = s.db.ExecContext(ctx, query,
+		r.ID, r.Global, r.Name, r.Description, r.Icon, r.BaseRole, packages, postInstall, verify, r.UpdatedAt,
+	)
+	return err
+}
+
+// GetCustomRoleByID retrieves a custom role by ID, returning nil if it doesn't exist
+func (s *PostgresStore) GetCustomRoleByID(ctx context.Context, id string) (*models.CustomRole, error) {
+	query := `SELECT ` + customRoleColumns + ` FROM custom_roles WHERE id = $1`
+	r, err := scanCustomRole(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// GetCustomRoleByName finds a role visible to the user by name.
+// The user's own role wins over a global role of the same name.
+func (s *PostgresStore) GetCustomRoleByName(ctx context.Context, userID, name string) (*models.CustomRole, error) {
+	query := `SELECT ` + customRoleColumns + ` FROM custom_roles
+		WHERE name = $2 AND (user_id = $1 OR is_global)
+		ORDER BY (user_id = $1) DESC, updated_at DESC
+		LIMIT 1`
+	r, err := scanCustomRole(s.db.QueryRowContext(ctx, query, userID, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// GetCustomRolesForUser lists the user's own roles plus all global roles
+func (s *PostgresStore) GetCustomRolesForUser(ctx context.Context, userID string) ([]*models.CustomRole, error) {
+	query := `SELECT ` + customRoleColumns + ` FROM custom_roles
+		WHERE user_id = $1 OR is_global
+		ORDER BY is_global DESC, name ASC`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*models.CustomRole
+	for rows.Next() {
+		r, err := scanCustomRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// DeleteCustomRole permanently deletes a custom role
+func (s *PostgresStore) DeleteCustomRole(ctx context.Context, id string) error {
+	query := `DELETE FROM custom_roles WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rexec/rexec/internal/models"
+)
+
+// ScheduledContainer is a container record with its schedule
+type ScheduledContainer struct {
+	ContainerRecord
+	Schedule models.ContainerSchedule
+}
+
+// UpdateContainerSchedule sets a container's schedule; an empty schedule clears it
+func (s *PostgresStore) UpdateContainerSchedule(ctx context.Context, id string, schedule *models.ContainerSchedule) error {
+	var scheduleJSON []byte
+	if !schedule.IsEmpty() {
+		var err error
+		if scheduleJSON, err = json.Marshal(schedule); err != nil {
+			return err
+		}
+	}
+	query := `UPDATE containers SET schedule = $2 WHERE id = $1 AND deleted_at IS NULL`
+	_, err := s.db.ExecContext(ctx, query, id, scheduleJSON)
+	return err
+}
+
+// GetContainerSchedule returns a container's schedule, or nil if it has none
+func (s *PostgresStore) GetContainerSchedule(ctx context.Context, id string) (*models.ContainerSchedule, error) {
+	var scheduleJSON []byte
+	err := s.db.QueryRowContext(ctx, `SELECT schedule FROM containers WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&scheduleJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(scheduleJSON) == 0 {
+		return nil, nil
+	}
+	var schedule models.ContainerSchedule
+	if err := json.Unmarshal(scheduleJSON, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// GetScheduledContainers returns every live container that has a schedule
+func (s *PostgresStore) GetScheduledContainers(ctx context.Context) ([]*ScheduledContainer, error) {
+	query := `
+		SELECT id, user_id, name, image, COALESCE(role, 'standard') as role, status, docker_id, volume_name,
+		       COALESCE(memory_mb, 512) as memory_mb, COALESCE(cpu_shares, 512) as cpu_shares, COALESCE(disk_mb, 2048) as disk_mb,
+		       COALESCE(mfa_locked, false) as mfa_locked, created_at, last_used_at, schedule
+		FROM containers WHERE deleted_at IS NULL AND schedule IS NOT NULL
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var containers []*ScheduledContainer
+	for rows.Next() {
+		var c ScheduledContainer
+		var scheduleJSON []byte
+		err := rows.Scan(
+			&c.ID,
+			&c.UserID,
+			&c.Name,
+			&c.Image,
+			&c.Role,
+			&c.Status,
+			&c.DockerID,
+			&c.VolumeName,
+			&c.MemoryMB,
+			&c.CPUShares,
+			&c.DiskMB,
+			&c.MFALocked,
+			&c.CreatedAt,
+			&c.LastUsedAt,
+			&scheduleJSON,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(scheduleJSON, &c.Schedule); err != nil {
+			log.Printf("[Schedule] Ignoring malformed schedule on container %s: %v", c.ID, err)
+			continue
+		}
+		containers = append(containers, &c)
+	}
+	return containers, rows.Err()
+}
+
+// LeaderLock elects one API instance for singleton background work. It holds
+// a session-level Postgres advisory lock, so the lock is released as soon as
+// the leader's connection goes away.
+type LeaderLock struct {
+	session *leaderSession
+	name    string
+	key     int64
+}
+
+// leaderSession is the one connection all of a store's leader locks are held
+// on. Advisory locks belong to a session, so a connection per lock would pin
+// a pooled connection for every kind of background work; sharing one keeps
+// that to a single connection however many locks there are.
+type leaderSession struct {
+	db   *sqlx.DB
+	mu   sync.Mutex
+	conn *sql.Conn
+	held map[int64]string // advisory lock key -> lock name
+}
+
+// NewLeaderLock creates a leader lock; instances using the same name compete for it
+func (s *PostgresStore) NewLeaderLock(name string) *LeaderLock {
+	h := fnv.New64a()
+	h.Write([]byte("rexec:" + name))
+	return &LeaderLock{session: s.leaders, name: name, key: int64(h.Sum64())}
+}
+
+// IsLeader reports whether this instance holds the lock, trying to take it if not
+func (l *LeaderLock) IsLeader(ctx context.Context) bool {
+	s := l.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		if err := s.conn.PingContext(ctx); err != nil {
+			// Every lock on the session went with it
+			for _, name := range s.held {
+				log.Printf("[Leader] Lost %s leadership: connection closed", name)
+			}
+			s.conn.Close()
+			s.conn = nil
+			s.held = make(map[int64]string)
+		} else if _, ok := s.held[l.key]; ok {
+			return true
+		}
+	}
+
+	if s.conn == nil {
+		conn, err := s.db.Conn(ctx)
+		if err != nil {
+			return false
+		}
+		s.conn = conn
+	}
+	var acquired bool
+	if err := s.conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&acquired); err != nil || !acquired {
+		s.closeIfIdle()
+		return false
+	}
+	s.held[l.key] = l.name
+	log.Printf("[Leader] Acquired %s leadership", l.name)
+	return true
+}
+
+// Release gives up the lock so another instance can take over
+func (l *LeaderLock) Release() {
+	s := l.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.held[l.key]; !ok {
+		return
+	}
+	_, _ = s.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, l.key)
+	delete(s.held, l.key)
+	s.closeIfIdle()
+}
+
+// closeIfIdle returns the connection to the pool once no lock is held on it
+func (s *leaderSession) closeIfIdle() {
+	if s.conn != nil && len(s.held) == 0 {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/rexec/rexec/internal/models"
+)
+
+// containerServiceColumns selects from container_services s joined with its container c
+const containerServiceColumns = `s.id, s.container_id, COALESCE(c.docker_id, ''), s.user_id, s.name, s.command,
+	COALESCE(s.workdir, ''), s.env, s.restart_policy, s.enabled, s.generation, s.status, s.pid, s.restarts,
+	s.exit_code, COALESCE(s.last_error, ''), s.started_at, s.created_at, s.updated_at`
+
+const containerServiceFrom = ` FROM container_services s JOIN containers c ON c.id = s.container_id`
+
+func scanContainerService(row interface{ Scan(...interface{}) error }) (*models.ContainerService, error) {
+	var svc models.ContainerService
+	var envJSON []byte
+	var exitCode sql.NullInt64
+	var startedAt sql.NullTime
+	err := row.Scan(
+		&svc.ID,
+		&svc.ContainerID,
+		&svc.DockerID,
+		&svc.UserID,
+		&svc.Name,
+		&svc.Command,
+		&svc.WorkDir,
+		&envJSON,
+		&svc.RestartPolicy,
+		&svc.Enabled,
+		&svc.Generation,
+		&svc.Status,
+		&svc.PID,
+		&svc.Restarts,
+		&exitCode,
+		&svc.LastError,
+		&startedAt,
+		&svc.CreatedAt,
+		&svc.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(envJSON) > 0 {
+		if err := json.Unmarshal(envJSON, &svc.Env); err != nil {
+			return nil, err
+		}
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		svc.ExitCode = &code
+	}
+	if startedAt.Valid {
+		svc.StartedAt = &startedAt.Time
+	}
+	return &svc, nil
+}
+
+// CreateContainerService declares a new service in a container
+func (s *PostgresStore) CreateContainerService(ctx context.Context, svc *models.ContainerService) error {
+	envJSON, err := json.Marshal(svc.Env)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO container_services (id, container_id, user_id, name, command, workdir, env, restart_policy,
+			enabled, generation, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	_, err = s.db.ExecContext(ctx, query,
+		svc.ID, svc.ContainerID, svc.UserID, svc.Name, svc.Command, svc.WorkDir, envJSON, svc.RestartPolicy,
+		svc.Enabled, svc.Generation, svc.Status, svc.CreatedAt, svc.UpdatedAt,
+	)
+	return err
+}
+
+// UpdateContainerService saves a service's definition, leaving the
+// supervisor's state alone
+func (s *PostgresStore) UpdateContainerService(ctx context.Context, svc *models.ContainerService) error {
+	envJSON, err := json.Marshal(svc.Env)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE container_services
+		SET command = $2, workdir = $3, env = $4, restart_policy = $5, enabled = $6, generation = $7, updated_at = $8
+		WHERE id = $1
+	`
+	_, err = s.db.ExecContext(ctx, query,
+		svc.ID, svc.Command, svc.WorkDir, envJSON, svc.RestartPolicy, svc.Enabled, svc.Generation, svc.UpdatedAt,
+	)
+	return err
+}
+
+// UpdateContainerServiceState records what the supervisor saw of a service's process
+func (s *PostgresStore) UpdateContainerServiceState(ctx context.Context, id string, state models.ServiceState) error {
+	query := `
+		UPDATE container_services
+		SET status = $2, pid = $3, restarts = $4, exit_code = $5, last_error = $6, started_at = $7
+		WHERE id = $1
+	`
+	var exitCode sql.NullInt64
+	if state.ExitCode != nil {
+		exitCode = sql.NullInt64{Int64: int64(*state.ExitCode), Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, query, id, state.Status, state.PID, state.Restarts, exitCode, state.LastError, state.StartedAt)
+	return err
+}
+
+// GetContainerServiceByID retrieves a service, returning nil if it doesn't exist
+func (s *PostgresStore) GetContainerServiceByID(ctx context.Context, id string) (*models.ContainerService, error) {
+	query := `SELECT ` + containerServiceColumns + containerServiceFrom + ` WHERE s.id = $1 AND c.deleted_at IS NULL`
+	svc, err := scanContainerService(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return svc, err
+}
+
+// GetContainerServices lists a container's services by name
+func (s *PostgresStore) GetContainerServices(ctx context.Context, containerID string) ([]*models.ContainerService, error) {
+	query := `SELECT ` + containerServiceColumns + containerServiceFrom + ` WHERE s.container_id = $1 ORDER BY s.name`
+	return s.queryContainerServices(ctx, query, containerID)
+}
+
+// GetSupervisedServices lists the enabled services of running containers
+func (s *PostgresStore) GetSupervisedServices(ctx context.Context) ([]*models.ContainerService, error) {
+	query := `SELECT ` + containerServiceColumns + containerServiceFrom + `
+		WHERE s.enabled = true AND c.deleted_at IS NULL AND c.status = 'running'
+			AND c.docker_id IS NOT NULL AND c.docker_id != ''
+		ORDER BY s.created_at`
+	return s.queryContainerServices(ctx, query)
+}
+
+func (s *PostgresStore) queryContainerServices(ctx context.Context, query string, args ...interface{}) ([]*models.ContainerService, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var services []*models.ContainerService
+	for rows.Next() {
+		svc, err := scanContainerService(rows)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, svc)
+	}
+	return services, rows.Err()
+}
+
+// DeleteContainerService permanently deletes a service
+func (s *PostgresStore) DeleteContainerService(ctx context.Context, id string) error {
+	query := `DELETE FROM container_services WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SnapshotRecord represents a saved workspace snapshot of a container
+type SnapshotRecord struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	ContainerID string    `json:"container_id"` // DB ID of the source container
+	Name        string    `json:"name"`
+	SourceImage string    `json:"source_image"` // Image of the source container, e.g. "ubuntu-24"
+	Role        string    `json:"role"`
+	ImageTag    string    `json:"-"`
+	ArchivePath string    `json:"-"`
+	SizeBytes   int64     `json:"size_bytes"`
+	Status      string    `json:"status"` // creating, ready, error
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const snapshotColumns = `id, user_id, container_id, name, source_image, COALESCE(role, ''), COALESCE(image_tag, ''),
+	COALESCE(archive_path, ''), COALESCE(size_bytes, 0), COALESCE(status, 'creating'), COALESCE(error, ''), created_at`
+
+func scanSnapshot(row interface{ Scan(...interface{}) error }) (*SnapshotRecord, error) {
+	var snap SnapshotRecord
+	err := row.Scan(
+		&snap.ID,
+		&snap.UserID,
+		&snap.ContainerID,
+		&snap.Name,
+		&snap.SourceImage,
+		&snap.Role,
+		&snap.ImageTag,
+		&snap.ArchivePath,
+		&snap.SizeBytes,
+		&snap.Status,
+		&snap.Error,
+		&snap.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// CreateSnapshot inserts a new snapshot record
+func (s *PostgresStore) CreateSnapshot(ctx context.Context, snap *SnapshotRecord) error {
+	query := `
+		INSERT INTO container_snapshots (id, user_id, container_id, name, source_image, role, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		snap.ID, snap.UserID, snap.ContainerID, snap.Name, snap.SourceImage, snap.Role, snap.Status, snap.CreatedAt,
+	)
+	return err
+}
+
+// MarkSnapshotReady records the artifacts of a completed snapshot
+func (s *PostgresStore) MarkSnapshotReady(ctx context.Context, id, imageTag, archivePath string, sizeBytes int64) error {
+	query := `UPDATE container_snapshots SET status = 'ready', image_tag = $2, archive_path = $3, size_bytes = $4, error = NULL WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id, imageTag, archivePath, sizeBytes)
+	return err
+}
+
+// MarkSnapshotFailed records why a snapshot could not be taken
+func (s *PostgresStore) MarkSnapshotFailed(ctx context.Context, id, errorMsg string) error {
+	query := `UPDATE container_snapshots SET status = 'error', error = $2 WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id, errorMsg)
+	return err
+}
+
+// GetSnapshotByID retrieves a snapshot by ID, returning nil if it doesn't exist
+func (s *PostgresStore) GetSnapshotByID(ctx context.Context, id string) (*SnapshotRecord, error) {
+	query := `SELECT ` + snapshotColumns + ` FROM container_snapshots WHERE id = $1`
+	snap, err := scanSnapshot(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return snap, err
+}
+
+// GetSnapshotsByUserID lists a user's snapshots, newest first
+func (s *PostgresStore) GetSnapshotsByUserID(ctx context.Context, userID string) ([]*SnapshotRecord, error) {
+	query := `SELECT ` + snapshotColumns + ` FROM container_snapshots WHERE user_id = $1 ORDER BY created_at DESC`
+	return s.querySnapshots(ctx, query, userID)
+}
+
+// GetSnapshotsByContainerID lists the snapshots taken from one container, newest first
+func (s *PostgresStore) GetSnapshotsByContainerID(ctx context.Context, userID, containerID string) ([]*SnapshotRecord, error) {
+	query := `SELECT ` + snapshotColumns + ` FROM container_snapshots WHERE user_id = $1 AND container_id = $2 ORDER BY created_at DESC`
+	return s.querySnapshots(ctx, query, userID, containerID)
+}
+
+func (s *PostgresStore) querySnapshots(ctx context.Context, query string, args ...interface{}) ([]*SnapshotRecord, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []*SnapshotRecord
+	for rows.Next() {
+		snap, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, rows.Err()
+}
+
+// CountSnapshotsByUserID returns how many snapshots count against the user's quota
+func (s *PostgresStore) CountSnapshotsByUserID(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	query := `SELECT COUNT(*) FROM container_snapshots WHERE user_id = $1 AND status != 'error'`
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// DeleteSnapshot permanently deletes a snapshot record
+func (s *PostgresStore) DeleteSnapshot(ctx context.Context, id string) error {
+	query := `DELETE FROM container_snapshots WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
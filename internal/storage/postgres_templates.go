@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TemplateRecord is a stored rexec.yaml environment template.
+// Templates with an OrgID are visible to every member of that org;
+// only the owner can change or delete them.
+type TemplateRecord struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	OrgID       string    `json:"org_id,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Content     string    `json:"content"` // Raw rexec.yaml
+	SourceRepo  string    `json:"source_repo,omitempty"`
+	SourceRef   string    `json:"source_ref,omitempty"`
+	SourcePath  string    `json:"source_path,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const templateColumns = `id, user_id, COALESCE(org_id, ''), name, COALESCE(description, ''), content,
+	COALESCE(source_repo, ''), COALESCE(source_ref, ''), COALESCE(source_path, ''), created_at, updated_at`
+
+func scanTemplate(row interface{ Scan(...interface{}) error }) (*TemplateRecord, error) {
+	var t TemplateRecord
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.OrgID,
+		&t.Name,
+		&t.Description,
+		&t.Content,
+		&t.SourceRepo,
+		&t.SourceRef,
+		&t.SourcePath,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateTemplate inserts a new environment template
+func (s *PostgresStore) CreateTemplate(ctx context.Context, t *TemplateRecord) error {
+	query := `
+		INSERT INTO environment_templates (id, user_id, org_id, name, description, content, source_repo, source_ref, source_path, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, $11)
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		t.ID, t.UserID, t.OrgID, t.Name, t.Description, t.Content, t.SourceRepo, t.SourceRef, t.SourcePath, t.CreatedAt, t.UpdatedAt,
+	)
+	return err
+}
+
+// UpdateTemplate replaces a template's content and sharing
+func (s *PostgresStore) UpdateTemplate(ctx context.Context, t *TemplateRecord) error {
+	query := `
+		UPDATE environment_templates
+		SET org_id = NULLIF($2, ''), name = $3, description = $4, content = $5,
+			source_repo = NULLIF($6, ''), source_ref = NULLIF($7, ''), source_path = NULLIF($8, ''), updated_at = $9
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		t.ID, t.OrgID, t.Name, t.Description, t.Content, t.SourceRepo, t.SourceRef, t.SourcePath, t.UpdatedAt,
+	)
+	return err
+}
+
+// GetTemplateByID retrieves a template by ID, returning nil if it doesn't exist
+func (s *PostgresStore) GetTemplateByID(ctx context.Context, id string) (*TemplateRecord, error) {
+	query := `SELECT ` + templateColumns + ` FROM environment_templates WHERE id = $1`
+	t, err := scanTemplate(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// GetTemplateByName finds a template visible to the user by name.
+// The user's own template wins over an org template of the same name.
+func (s *PostgresStore) GetTemplateByName(ctx context.Context, userID, orgID, name string) (*TemplateRecord, error) {
+	query := `SELECT ` + templateColumns + ` FROM environment_templates
+		WHERE name = $3 AND (user_id = $1 OR ($2 <> '' AND org_id = $2))
+		ORDER BY (user_id = $1) DESC, updated_at DESC
+		LIMIT 1`
+	t, err := scanTemplate(s.db.QueryRowContext(ctx, query, userID, orgID, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// GetTemplatesForUser lists the user's own templates plus those shared with their org
+func (s *PostgresStore) GetTemplatesForUser(ctx context.Context, userID, orgID string) ([]*TemplateRecord, error) {
+	query := `SELECT ` + templateColumns + ` FROM environment_templates
+		WHERE user_id = $1 OR ($2 <> '' AND org_id = $2)
+		ORDER BY name ASC`
+	rows, err := s.db.QueryContext(ctx, query, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*TemplateRecord
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// DeleteTemplate permanently deletes a template
+func (s *PostgresStore) DeleteTemplate(ctx context.Context, id string) error {
+	query := `DELETE FROM environment_templates WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// GetUserOrgID returns the org a user belongs to, or "" if none
+func (s *PostgresStore) GetUserOrgID(ctx context.Context, userID string) (string, error) {
+	var orgID string
+	query := `SELECT COALESCE(org_id, '') FROM users WHERE id = $1`
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return orgID, err
+}
+
+// SetUserOrgID assigns a user to an org; an empty orgID removes them from it
+func (s *PostgresStore) SetUserOrgID(ctx context.Context, userID, orgID string) error {
+	query := `UPDATE users SET org_id = NULLIF($2, ''), updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, userID, orgID)
+	return err
+}
@@ -34,7 +34,7 @@ func (s *PostgresStore) GenerateAPIToken(ctx context.Context, userID, name strin
 
 	// Default scopes if none provided
 	if len(scopes) == 0 {
-		scopes = []string{"read", "write"}
+		scopes = models.DefaultTokenScopes
 	}
 
 	token := &models.APIToken{
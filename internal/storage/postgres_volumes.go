@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// VolumeRecord is a user-owned volume that lives independently of any terminal
+type VolumeRecord struct {
+	ID           string              `json:"id"`
+	UserID       string              `json:"user_id"`
+	Name         string              `json:"name"`
+	DockerVolume string              `json:"-"`
+	SizeMB       int64               `json:"size_mb"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	Attachments  []*VolumeAttachment `json:"attachments"`
+	UsedBytes    *int64              `json:"used_bytes,omitempty"` // Filled in from Docker when known
+}
+
+// VolumeAttachment mounts a shared volume into a terminal
+type VolumeAttachment struct {
+	VolumeID      string    `json:"volume_id"`
+	ContainerID   string    `json:"container_id"` // DB ID of the terminal
+	ContainerName string    `json:"container_name,omitempty"`
+	Path          string    `json:"path"`
+	ReadOnly      bool      `json:"read_only"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// VolumeMountRecord is an attachment with what's needed to mount it
+type VolumeMountRecord struct {
+	VolumeID     string `json:"volume_id"`
+	VolumeName   string `json:"volume_name"`
+	DockerVolume string `json:"-"`
+	Path         string `json:"path"`
+	ReadOnly     bool   `json:"read_only"`
+}
+
+// WritableVolumeAttachment is a read-write mount of a shared volume, with the
+// volume's size to hold it to
+type WritableVolumeAttachment struct {
+	VolumeID     string
+	VolumeName   string
+	DockerVolume string
+	SizeMB       int64
+	UserID       string
+	ContainerID  string // DB ID of the terminal
+}
+
+const volumeColumns = `id, user_id, name, docker_volume, size_mb, created_at, updated_at`
+
+func scanVolume(row interface{ Scan(...interface{}) error }) (*VolumeRecord, error) {
+	var vol VolumeRecord
+	err := row.Scan(&vol.ID, &vol.UserID, &vol.Name, &vol.DockerVolume, &vol.SizeMB, &vol.CreatedAt, &vol.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	vol.Attachments = []*VolumeAttachment{}
+	return &vol, nil
+}
+
+// CreateVolume inserts a new shared volume
+func (s *PostgresStore) CreateVolume(ctx context.Context, vol *VolumeRecord) error {
+	query := `
+		INSERT INTO shared_volumes (id, user_id, name, docker_volume, size_mb, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		vol.ID, vol.UserID, vol.Name, vol.DockerVolume, vol.SizeMB, vol.CreatedAt, vol.UpdatedAt,
+	)
+	return err
+}
+
+// GetVolume finds a user's volume by ID or name, with its attachments.
+// It returns nil if there is no such volume.
+func (s *PostgresStore) GetVolume(ctx context.Context, userID, idOrName string) (*VolumeRecord, error) {
+	query := `SELECT ` + volumeColumns + ` FROM shared_volumes WHERE user_id = $1 AND (id = $2 OR name = $2)`
+	vol, err := scanVolume(s.db.QueryRowContext(ctx, query, userID, idOrName))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadVolumeAttachments(ctx, userID, map[string]*VolumeRecord{vol.ID: vol}); err != nil {
+		return nil, err
+	}
+	return vol, nil
+}
+
+// GetVolumesByUserID lists a user's volumes with their attachments, by name
+func (s *PostgresStore) GetVolumesByUserID(ctx context.Context, userID string) ([]*VolumeRecord, error) {
+	query := `SELECT ` + volumeColumns + ` FROM shared_volumes WHERE user_id = $1 ORDER BY name`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	volumes := []*VolumeRecord{}
+	byID := make(map[string]*VolumeRecord)
+	for rows.Next() {
+		vol, err := scanVolume(rows)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, vol)
+		byID[vol.ID] = vol
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(volumes) > 0 {
+		if err := s.loadVolumeAttachments(ctx, userID, byID); err != nil {
+			return nil, err
+		}
+	}
+	return volumes, nil
+}
+
+// loadVolumeAttachments fills in the attachments of the given volumes,
+// skipping deleted terminals
+func (s *PostgresStore) loadVolumeAttachments(ctx context.Context, userID string, volumes map[string]*VolumeRecord) error {
+	query := `
+		SELECT a.volume_id, a.container_id, c.name, a.path, a.read_only, a.created_at
+		FROM volume_attachments a
+		JOIN shared_volumes v ON v.id = a.volume_id
+		JOIN containers c ON c.id = a.container_id
+		WHERE v.user_id = $1 AND c.deleted_at IS NULL
+		ORDER BY a.created_at
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var att VolumeAttachment
+		if err := rows.Scan(&att.VolumeID, &att.ContainerID, &att.ContainerName, &att.Path, &att.ReadOnly, &att.CreatedAt); err != nil {
+			return err
+		}
+		if vol, ok := volumes[att.VolumeID]; ok {
+			vol.Attachments = append(vol.Attachments, &att)
+		}
+	}
+	return rows.Err()
+}
+
+// UpdateVolume renames or resizes a volume
+func (s *PostgresStore) UpdateVolume(ctx context.Context, id, name string, sizeMB int64) error {
+	query := `UPDATE shared_volumes SET name = $2, size_mb = $3, updated_at = $4 WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id, name, sizeMB, time.Now())
+	return err
+}
+
+// DeleteVolume permanently deletes a volume record and its attachments
+func (s *PostgresStore) DeleteVolume(ctx context.Context, id string) error {
+	query := `DELETE FROM shared_volumes WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// AttachVolume records that a volume is mounted into a terminal
+func (s *PostgresStore) AttachVolume(ctx context.Context, att *VolumeAttachment) error {
+	query := `
+		INSERT INTO volume_attachments (volume_id, container_id, path, read_only, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := s.db.ExecContext(ctx, query, att.VolumeID, att.ContainerID, att.Path, att.ReadOnly, att.CreatedAt)
+	return err
+}
+
+// DetachVolume removes a volume from a terminal
+func (s *PostgresStore) DetachVolume(ctx context.Context, volumeID, containerID string) error {
+	query := `DELETE FROM volume_attachments WHERE volume_id = $1 AND container_id = $2`
+	_, err := s.db.ExecContext(ctx, query, volumeID, containerID)
+	return err
+}
+
+// DetachContainerVolumes removes every volume from a terminal; DeleteContainer calls it
+func (s *PostgresStore) DetachContainerVolumes(ctx context.Context, containerID string) error {
+	query := `DELETE FROM volume_attachments WHERE container_id = $1`
+	_, err := s.db.ExecContext(ctx, query, containerID)
+	return err
+}
+
+// GetContainerVolumeMounts lists the shared volumes mounted into a terminal
+func (s *PostgresStore) GetContainerVolumeMounts(ctx context.Context, containerID string) ([]*VolumeMountRecord, error) {
+	query := `
+		SELECT v.id, v.name, v.docker_volume, a.path, a.read_only
+		FROM volume_attachments a
+		JOIN shared_volumes v ON v.id = a.volume_id
+		WHERE a.container_id = $1
+		ORDER BY a.path
+	`
+	rows, err := s.db.QueryContext(ctx, query, containerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mounts []*VolumeMountRecord
+	for rows.Next() {
+		var m VolumeMountRecord
+		if err := rows.Scan(&m.VolumeID, &m.VolumeName, &m.DockerVolume, &m.Path, &m.ReadOnly); err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, &m)
+	}
+	return mounts, rows.Err()
+}
+
+// GetWritableVolumeAttachments lists every read-write mount of a shared
+// volume into a terminal that hasn't been deleted
+func (s *PostgresStore) GetWritableVolumeAttachments(ctx context.Context) ([]*WritableVolumeAttachment, error) {
+	query := `
+		SELECT v.id, v.name, v.docker_volume, v.size_mb, v.user_id, a.container_id
+		FROM volume_attachments a
+		JOIN shared_volumes v ON v.id = a.volume_id
+		JOIN containers c ON c.id = a.container_id
+		WHERE a.read_only IS NOT TRUE AND c.deleted_at IS NULL
+		ORDER BY v.id, a.container_id
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*WritableVolumeAttachment
+	for rows.Next() {
+		var att WritableVolumeAttachment
+		if err := rows.Scan(&att.VolumeID, &att.VolumeName, &att.DockerVolume, &att.SizeMB, &att.UserID, &att.ContainerID); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &att)
+	}
+	return attachments, rows.Err()
+}
+
+// SetVolumeAttachmentReadOnly makes a terminal's mount of a volume read-only
+func (s *PostgresStore) SetVolumeAttachmentReadOnly(ctx context.Context, volumeID, containerID string) error {
+	query := `UPDATE volume_attachments SET read_only = true WHERE volume_id = $1 AND container_id = $2`
+	_, err := s.db.ExecContext(ctx, query, volumeID, containerID)
+	return err
+}
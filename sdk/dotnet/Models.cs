@@ -85,6 +85,11 @@ public class CreateContainerRequest
     /// </summary>
     public Dictionary<string, string>? Labels { get; set; }
 
+    /// <summary>
+    /// Environment template ID or name (rexec.yaml). Image may be empty when set.
+    /// </summary>
+    public string? Template { get; set; }
+
     /// <summary>
     /// Create a request with the specified image.
     /// </summary>
@@ -103,6 +108,15 @@ public class CreateContainerRequest
         return this;
     }
 
+    /// <summary>
+    /// Set environment template.
+    /// </summary>
+    public CreateContainerRequest WithTemplate(string template)
+    {
+        Template = template;
+        return this;
+    }
+
     /// <summary>
     /// Set label.
     /// </summary>
@@ -183,6 +197,49 @@ public class FileInfo
     public bool IsFile => !IsDir;
 }
 
+/// <summary>
+/// Shell lifecycle event on a terminal stream. Command events need a shell
+/// with integration (the zsh set up in Rexec terminals has it).
+/// </summary>
+public class TerminalEvent
+{
+    /// <summary>
+    /// Event type: exit, restart, command_start or command_end.
+    /// </summary>
+    [JsonPropertyName("type")]
+    public string Type { get; set; } = "";
+
+    /// <summary>
+    /// Exit code of the shell (exit) or command (command_end).
+    /// </summary>
+    [JsonPropertyName("exit_code")]
+    public int? ExitCode { get; set; }
+
+    /// <summary>
+    /// Signal that killed the shell, e.g. "KILL".
+    /// </summary>
+    [JsonPropertyName("signal")]
+    public string? Signal { get; set; }
+
+    /// <summary>
+    /// Working directory the command ran in (command_start) or left (command_end).
+    /// </summary>
+    [JsonPropertyName("cwd")]
+    public string? Cwd { get; set; }
+
+    /// <summary>
+    /// How long the command ran in milliseconds (command_end).
+    /// </summary>
+    [JsonPropertyName("duration_ms")]
+    public long? DurationMs { get; set; }
+
+    /// <summary>
+    /// Restarts so far (restart).
+    /// </summary>
+    [JsonPropertyName("restarts")]
+    public int? Restarts { get; set; }
+}
+
 internal class ContainerListResponse
 {
     public List<Container>? Containers { get; set; }
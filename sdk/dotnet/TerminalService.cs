@@ -57,6 +57,12 @@ public class Terminal : IAsyncDisposable
     /// </summary>
     public event Action<byte[]>? OnBinaryData;
 
+    /// <summary>
+    /// Event raised for shell lifecycle events (exit, restart, command_start,
+    /// command_end). Their messages are still passed to OnData too.
+    /// </summary>
+    public event Action<TerminalEvent>? OnEvent;
+
     /// <summary>
     /// Event raised when the connection closes.
     /// </summary>
@@ -173,7 +179,12 @@ public class Terminal : IAsyncDisposable
 
                 if (result.MessageType == WebSocketMessageType.Text)
                 {
-                    OnData?.Invoke(Encoding.UTF8.GetString(data));
+                    var text = Encoding.UTF8.GetString(data);
+                    OnData?.Invoke(text);
+                    if (OnEvent != null)
+                    {
+                        DispatchEvent(text);
+                    }
                 }
                 else
                 {
@@ -192,6 +203,27 @@ public class Terminal : IAsyncDisposable
         }
     }
 
+    private void DispatchEvent(string text)
+    {
+        if (!text.StartsWith('{')) return;
+
+        TerminalEvent? terminalEvent;
+        try
+        {
+            terminalEvent = JsonSerializer.Deserialize<TerminalEvent>(text);
+        }
+        catch (JsonException)
+        {
+            return;
+        }
+        if (terminalEvent != null && TerminalEvents.Contains(terminalEvent.Type))
+        {
+            OnEvent?.Invoke(terminalEvent);
+        }
+    }
+
+    private static readonly HashSet<string> TerminalEvents = new() { "exit", "restart", "command_start", "command_end" };
+
     public async ValueTask DisposeAsync()
     {
         await CloseAsync();
@@ -19,6 +19,7 @@
 package rexec
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -42,6 +43,7 @@ type Client struct {
 	Containers *ContainerService
 	Files      *FileService
 	Terminal   *TerminalService
+	Templates  *TemplateService
 }
 
 // NewClient creates a new Rexec client.
@@ -59,6 +61,7 @@ func NewClient(baseURL, token string) *Client {
 	c.Containers = &ContainerService{client: c}
 	c.Files = &FileService{client: c}
 	c.Terminal = &TerminalService{client: c}
+	c.Templates = &TemplateService{client: c}
 
 	return c
 }
@@ -152,9 +155,12 @@ type Container struct {
 }
 
 // CreateContainerRequest represents a request to create a container.
+// Image is required unless Template is set.
 type CreateContainerRequest struct {
 	Name        string            `json:"name,omitempty"`
-	Image       string            `json:"image"`
+	Image       string            `json:"image,omitempty"`
+	Role        string            `json:"role,omitempty"`
+	Template    string            `json:"template,omitempty"` // Environment template ID or name
 	Environment map[string]string `json:"environment,omitempty"`
 	Labels      map[string]string `json:"labels,omitempty"`
 }
@@ -200,6 +206,191 @@ func (s *ContainerService) Stop(ctx context.Context, id string) error {
 	return s.client.doRequest(ctx, http.MethodPost, "/api/containers/"+id+"/stop", nil, nil)
 }
 
+// ExecRequest runs a one-shot command in a container without a PTY. Set
+// Command to run a program with arguments as is, or Script to run a command
+// line with /bin/sh -c (the agent's shell on agent terminals).
+type ExecRequest struct {
+	Command []string          `json:"command,omitempty"`
+	Script  string            `json:"script,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Cwd     string            `json:"cwd,omitempty"`
+	Stdin   string            `json:"stdin,omitempty"`
+	Timeout int               `json:"timeout,omitempty"` // Seconds, default 60, at most 3600
+	User    string            `json:"user,omitempty"`    // user, uid or user:group
+}
+
+// ExecResult is how a one-shot command ended. A command killed by a signal
+// exits with 128 plus the signal number, like in a shell.
+type ExecResult struct {
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMs int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out"`
+	Truncated  bool   `json:"truncated"` // Output past 4MB per stream was dropped
+}
+
+// Exec runs a command and waits for it to finish. A non-zero exit code is
+// not an error.
+func (s *ContainerService) Exec(ctx context.Context, id string, req *ExecRequest) (*ExecResult, error) {
+	resp, err := s.exec(ctx, id, req, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result ExecResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// ExecStream runs a command, copying its stdout and stderr to the given
+// writers as it produces them. The returned result has no output.
+func (s *ContainerService) ExecStream(ctx context.Context, id string, req *ExecRequest, stdout, stderr io.Writer) (*ExecResult, error) {
+	resp, err := s.exec(ctx, id, req, "text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type       string `json:"type"`
+			Data       string `json:"data"`
+			ExitCode   int    `json:"exit_code"`
+			DurationMs int64  `json:"duration_ms"`
+			TimedOut   bool   `json:"timed_out"`
+			Error      string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case "stdout":
+			if stdout != nil {
+				io.WriteString(stdout, event.Data)
+			}
+		case "stderr":
+			if stderr != nil {
+				io.WriteString(stderr, event.Data)
+			}
+		case "exit":
+			return &ExecResult{ExitCode: event.ExitCode, DurationMs: event.DurationMs, TimedOut: event.TimedOut}, nil
+		case "error":
+			return nil, fmt.Errorf("exec failed: %s", event.Error)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read exec stream: %w", err)
+	}
+	return nil, fmt.Errorf("exec stream ended before the command finished")
+}
+
+// exec starts a command. Commands can outlast the client's timeout, so
+// only ctx bounds the request.
+func (s *ContainerService) exec(ctx context.Context, id string, req *ExecRequest, accept string) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.client.baseURL+"/api/containers/"+id+"/exec", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.client.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", accept)
+
+	httpClient := *s.client.httpClient
+	httpClient.Timeout = 0
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			return nil, fmt.Errorf("request failed with status %d", resp.StatusCode)
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: errResp.Error}
+	}
+	return resp, nil
+}
+
+// Template is a stored rexec.yaml environment template.
+type Template struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	OrgID       string    `json:"org_id,omitempty"`
+	Content     string    `json:"content"`
+	SourceRepo  string    `json:"source_repo,omitempty"`
+	SourceRef   string    `json:"source_ref,omitempty"`
+	SourcePath  string    `json:"source_path,omitempty"`
+	IsOwner     bool      `json:"is_owner"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SaveTemplateRequest creates or replaces a template from inline YAML
+// (Content) or from a rexec.yaml in a git repository (RepoURL).
+type SaveTemplateRequest struct {
+	Content      string `json:"content,omitempty"`
+	RepoURL      string `json:"repo_url,omitempty"`
+	Ref          string `json:"ref,omitempty"`
+	Path         string `json:"path,omitempty"`
+	ShareWithOrg *bool  `json:"share_with_org,omitempty"`
+}
+
+// TemplateService handles environment template operations.
+type TemplateService struct {
+	client *Client
+}
+
+// List returns the user's templates and those shared with their org.
+func (s *TemplateService) List(ctx context.Context) ([]Template, error) {
+	var result struct {
+		Templates []Template `json:"templates"`
+	}
+	err := s.client.doRequest(ctx, http.MethodGet, "/api/templates", nil, &result)
+	return result.Templates, err
+}
+
+// Get returns a template by ID.
+func (s *TemplateService) Get(ctx context.Context, id string) (*Template, error) {
+	var template Template
+	err := s.client.doRequest(ctx, http.MethodGet, "/api/templates/"+id, nil, &template)
+	return &template, err
+}
+
+// Create stores a new template.
+func (s *TemplateService) Create(ctx context.Context, req *SaveTemplateRequest) (*Template, error) {
+	var template Template
+	err := s.client.doRequest(ctx, http.MethodPost, "/api/templates", req, &template)
+	return &template, err
+}
+
+// Update replaces a template's content.
+func (s *TemplateService) Update(ctx context.Context, id string, req *SaveTemplateRequest) (*Template, error) {
+	var template Template
+	err := s.client.doRequest(ctx, http.MethodPut, "/api/templates/"+id, req, &template)
+	return &template, err
+}
+
+// Delete deletes a template.
+func (s *TemplateService) Delete(ctx context.Context, id string) error {
+	return s.client.doRequest(ctx, http.MethodDelete, "/api/templates/"+id, nil, nil)
+}
+
 // FileInfo represents file metadata.
 type FileInfo struct {
 	Name    string    `json:"name"`
@@ -261,9 +452,67 @@ type TerminalService struct {
 	client *Client
 }
 
+// Session is a named shell (tab) running in a container. Each session has
+// its own shell, working directory and size, independent of the others.
+type Session struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Shell     string    `json:"shell"`
+	Cwd       string    `json:"cwd"`
+	Cols      int       `json:"cols"`
+	Rows      int       `json:"rows"`
+	Clients   int       `json:"clients"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateSessionRequest represents a request to start a named session.
+// Shell defaults to the container's shell and Cwd to its home directory.
+type CreateSessionRequest struct {
+	Name  string            `json:"name,omitempty"`
+	Shell string            `json:"shell,omitempty"`
+	Cwd   string            `json:"cwd,omitempty"`
+	Env   map[string]string `json:"env,omitempty"`
+	Cols  int               `json:"cols,omitempty"`
+	Rows  int               `json:"rows,omitempty"`
+}
+
+// ListSessions returns the named sessions running in a container.
+func (s *TerminalService) ListSessions(ctx context.Context, containerID string) ([]Session, error) {
+	var result struct {
+		Sessions []Session `json:"sessions"`
+	}
+	err := s.client.doRequest(ctx, http.MethodGet, "/api/containers/"+containerID+"/sessions", nil, &result)
+	return result.Sessions, err
+}
+
+// CreateSession starts a named session. Attach to it with ConnectSession.
+func (s *TerminalService) CreateSession(ctx context.Context, containerID string, req *CreateSessionRequest) (*Session, error) {
+	if req == nil {
+		req = &CreateSessionRequest{}
+	}
+	var session Session
+	err := s.client.doRequest(ctx, http.MethodPost, "/api/containers/"+containerID+"/sessions", req, &session)
+	return &session, err
+}
+
+// DeleteSession ends a named session and everything running in it.
+func (s *TerminalService) DeleteSession(ctx context.Context, containerID, sessionID string) error {
+	return s.client.doRequest(ctx, http.MethodDelete, "/api/containers/"+containerID+"/sessions/"+url.PathEscape(sessionID), nil, nil)
+}
+
 // Connect establishes a WebSocket terminal connection to a container.
 func (s *TerminalService) Connect(ctx context.Context, containerID string) (*Terminal, error) {
-	wsURL := s.client.websocketURL("/ws/terminal/" + containerID)
+	return s.dial(ctx, s.client.websocketURL("/ws/terminal/"+containerID))
+}
+
+// ConnectSession establishes a WebSocket terminal connection to a named
+// session, leaving the container's main shell to other connections.
+func (s *TerminalService) ConnectSession(ctx context.Context, containerID, sessionID string) (*Terminal, error) {
+	wsURL := s.client.websocketURL("/ws/terminal/"+containerID) + "?session=" + url.QueryEscape(sessionID)
+	return s.dial(ctx, wsURL)
+}
+
+func (s *TerminalService) dial(ctx context.Context, wsURL string) (*Terminal, error) {
 
 	header := http.Header{}
 	header.Set("Authorization", "Bearer "+s.client.token)
@@ -287,6 +536,40 @@ func (t *Terminal) Read() ([]byte, error) {
 	return data, err
 }
 
+// Event is a message on the terminal stream. Besides "output", the shell's
+// lifecycle is reported as:
+//
+//   - "exit": the shell exited with ExitCode, or was killed by Signal
+//   - "restart": the shell was started again after exiting (Restarts so far)
+//   - "command_start": a command began running in Cwd
+//   - "command_end": a command finished with ExitCode after DurationMs,
+//     leaving the shell in Cwd
+//
+// Command events need a shell with integration (the zsh set up in Rexec
+// terminals has it).
+type Event struct {
+	Type       string `json:"type"`
+	Data       string `json:"data,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Signal     string `json:"signal,omitempty"`
+	Cwd        string `json:"cwd,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Restarts   int    `json:"restarts,omitempty"`
+}
+
+// ReadEvent reads the next message from the terminal.
+func (t *Terminal) ReadEvent() (*Event, error) {
+	messageType, data, err := t.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var event Event
+	if messageType != websocket.TextMessage || json.Unmarshal(data, &event) != nil || event.Type == "" {
+		return &Event{Type: "output", Data: string(data)}, nil
+	}
+	return &event, nil
+}
+
 // Resize resizes the terminal.
 func (t *Terminal) Resize(cols, rows int) error {
 	msg := map[string]interface{}{
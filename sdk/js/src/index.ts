@@ -28,14 +28,46 @@ export interface Container {
 export interface CreateContainerRequest {
   /** Container name (optional) */
   name?: string;
-  /** Docker image to use */
-  image: string;
+  /** Docker image to use (required unless `template` is set) */
+  image?: string;
+  /** Role to set up (optional) */
+  role?: string;
+  /** Environment template ID or name; explicit fields override it */
+  template?: string;
   /** Environment variables */
   environment?: Record<string, string>;
   /** Labels */
   labels?: Record<string, string>;
 }
 
+export interface Template {
+  id: string;
+  name: string;
+  description?: string;
+  org_id?: string;
+  /** Raw rexec.yaml */
+  content: string;
+  source_repo?: string;
+  source_ref?: string;
+  source_path?: string;
+  is_owner: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface SaveTemplateRequest {
+  /** Inline rexec.yaml */
+  content?: string;
+  /** https git URL to import rexec.yaml from instead of content */
+  repo_url?: string;
+  /** Branch or tag (optional) */
+  ref?: string;
+  /** Path to the template in the repo (default rexec.yaml) */
+  path?: string;
+  /** Share with your org */
+  share_with_org?: boolean;
+}
+
 export interface FileInfo {
   name: string;
   path: string;
@@ -50,6 +82,89 @@ export interface TerminalOptions {
   cols?: number;
   /** Terminal rows */
   rows?: number;
+  /** Named session to attach to instead of the container's main shell */
+  session?: string;
+}
+
+export interface Session {
+  id: string;
+  name: string;
+  shell: string;
+  cwd: string;
+  cols: number;
+  rows: number;
+  clients: number;
+  created_at: string;
+}
+
+export interface CreateSessionRequest {
+  /** Display name for the session */
+  name?: string;
+  /** Absolute path of the shell (default: the container's shell) */
+  shell?: string;
+  /** Starting directory */
+  cwd?: string;
+  /** Extra environment variables for the shell */
+  env?: Record<string, string>;
+  cols?: number;
+  rows?: number;
+}
+
+/**
+ * Shell lifecycle event on the terminal stream. Command events need a shell
+ * with integration (the zsh set up in Rexec terminals has it).
+ */
+export interface TerminalEvent {
+  type: 'exit' | 'restart' | 'command_start' | 'command_end';
+  /** Exit code of the shell (exit) or command (command_end) */
+  exit_code?: number;
+  /** Signal that killed the shell, e.g. "KILL" */
+  signal?: string;
+  /** Working directory the command ran in (command_start) or left (command_end) */
+  cwd?: string;
+  /** How long the command ran (command_end) */
+  duration_ms?: number;
+  /** Restarts so far (restart) */
+  restarts?: number;
+}
+
+const TERMINAL_EVENTS = ['exit', 'restart', 'command_start', 'command_end'];
+
+/**
+ * One-shot command run without a PTY. Set `command` to run a program with
+ * arguments as is, or `script` to run a command line with /bin/sh -c (the
+ * agent's shell on agent terminals).
+ */
+export interface ExecRequest {
+  command?: string[];
+  script?: string;
+  env?: Record<string, string>;
+  /** Absolute working directory */
+  cwd?: string;
+  stdin?: string;
+  /** Seconds, default 60, at most 3600 */
+  timeout?: number;
+  /** user, uid or user:group */
+  user?: string;
+}
+
+/**
+ * How a one-shot command ended. A command killed by a signal exits with 128
+ * plus the signal number, like in a shell.
+ */
+export interface ExecResult {
+  exit_code: number;
+  stdout: string;
+  stderr: string;
+  duration_ms: number;
+  timed_out?: boolean;
+  /** Output past 4MB per stream was dropped */
+  truncated?: boolean;
+}
+
+export interface ExecStreamHandlers {
+  onStdout?: (data: string) => void;
+  onStderr?: (data: string) => void;
 }
 
 export class RexecError extends Error {
@@ -70,12 +185,16 @@ export class Terminal {
   private messageHandlers: ((data: string | ArrayBuffer) => void)[] = [];
   private closeHandlers: (() => void)[] = [];
   private errorHandlers: ((error: Error) => void)[] = [];
+  private eventHandlers: ((event: TerminalEvent) => void)[] = [];
 
   constructor(ws: WebSocket) {
     this.ws = ws;
     
     this.ws.onmessage = (event) => {
       this.messageHandlers.forEach(handler => handler(event.data));
+      if (this.eventHandlers.length > 0 && typeof event.data === 'string') {
+        this.dispatchEvent(event.data);
+      }
     };
     
     this.ws.onclose = () => {
@@ -103,6 +222,26 @@ export class Terminal {
     this.messageHandlers.push(handler);
   }
 
+  /**
+   * Register a handler for shell lifecycle events (exit, restart,
+   * command_start, command_end)
+   */
+  onEvent(handler: (event: TerminalEvent) => void): void {
+    this.eventHandlers.push(handler);
+  }
+
+  private dispatchEvent(data: string): void {
+    let message: TerminalEvent;
+    try {
+      message = JSON.parse(data);
+    } catch {
+      return;
+    }
+    if (message && TERMINAL_EVENTS.includes(message.type)) {
+      this.eventHandlers.forEach(handler => handler(message));
+    }
+  }
+
   /**
    * Register a handler for connection close
    */
@@ -186,6 +325,110 @@ export class ContainerService {
   async stop(id: string): Promise<void> {
     await this.client.request('POST', `/api/containers/${id}/stop`);
   }
+
+  /**
+   * Run a command and wait for it to finish. A non-zero exit code doesn't
+   * reject.
+   */
+  async exec(id: string, options: ExecRequest): Promise<ExecResult> {
+    return this.client.request<ExecResult>('POST', `/api/containers/${id}/exec`, options);
+  }
+
+  /**
+   * Run a command, passing its stdout and stderr to the handlers as it
+   * produces them. The result resolves without output.
+   */
+  async execStream(id: string, options: ExecRequest, handlers: ExecStreamHandlers = {}): Promise<ExecResult> {
+    const response = await this.client.rawRequest('POST', `/api/containers/${id}/exec?stream=sse`, options);
+    if (!response.ok || !response.body) {
+      const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+      throw new RexecError(response.status, error.error || error.message || 'Request failed');
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffered = '';
+    for (;;) {
+      const { done, value } = await reader.read();
+      if (done) {
+        break;
+      }
+      buffered += decoder.decode(value, { stream: true });
+      let end: number;
+      while ((end = buffered.indexOf('\n\n')) >= 0) {
+        const chunk = buffered.slice(0, end);
+        buffered = buffered.slice(end + 2);
+        if (!chunk.startsWith('data: ')) {
+          continue;
+        }
+        const event = JSON.parse(chunk.slice('data: '.length));
+        switch (event.type) {
+          case 'stdout':
+            handlers.onStdout?.(event.data);
+            break;
+          case 'stderr':
+            handlers.onStderr?.(event.data);
+            break;
+          case 'exit':
+            reader.cancel();
+            return {
+              exit_code: event.exit_code,
+              stdout: '',
+              stderr: '',
+              duration_ms: event.duration_ms || 0,
+              timed_out: event.timed_out,
+            };
+          case 'error':
+            reader.cancel();
+            throw new RexecError(500, event.error);
+        }
+      }
+    }
+    throw new Error('Exec stream ended before the command finished');
+  }
+}
+
+/**
+ * Template service for managing rexec.yaml environment templates
+ */
+export class TemplateService {
+  constructor(private client: RexecClient) {}
+
+  /**
+   * List your templates and those shared with your org
+   */
+  async list(): Promise<Template[]> {
+    const result = await this.client.request<{ templates: Template[] }>('GET', '/api/templates');
+    return result.templates;
+  }
+
+  /**
+   * Get a template by ID
+   */
+  async get(id: string): Promise<Template> {
+    return this.client.request<Template>('GET', `/api/templates/${id}`);
+  }
+
+  /**
+   * Create a template from YAML or a git repository
+   */
+  async create(options: SaveTemplateRequest): Promise<Template> {
+    return this.client.request<Template>('POST', '/api/templates', options);
+  }
+
+  /**
+   * Replace a template's content
+   */
+  async update(id: string, options: SaveTemplateRequest): Promise<Template> {
+    return this.client.request<Template>('PUT', `/api/templates/${id}`, options);
+  }
+
+  /**
+   * Delete a template
+   */
+  async delete(id: string): Promise<void> {
+    await this.client.request('DELETE', `/api/templates/${id}`);
+  }
 }
 
 /**
@@ -230,7 +473,10 @@ export class TerminalService {
    */
   connect(containerId: string, options?: TerminalOptions): Promise<Terminal> {
     return new Promise((resolve, reject) => {
-      const wsURL = this.client.getWebSocketURL(`/ws/terminal/${containerId}`);
+      let wsURL = this.client.getWebSocketURL(`/ws/terminal/${containerId}`);
+      if (options?.session) {
+        wsURL += `?session=${encodeURIComponent(options.session)}`;
+      }
       
       // Use native WebSocket or ws package
       const WebSocketImpl = typeof WebSocket !== 'undefined' 
@@ -256,6 +502,28 @@ export class TerminalService {
       };
     });
   }
+
+  /**
+   * List the named sessions (tabs) running in a container
+   */
+  async listSessions(containerId: string): Promise<Session[]> {
+    const response = await this.client.request<{ sessions: Session[] }>('GET', `/api/containers/${containerId}/sessions`);
+    return response.sessions || [];
+  }
+
+  /**
+   * Start a named session; attach to it with connect(id, { session })
+   */
+  async createSession(containerId: string, options: CreateSessionRequest = {}): Promise<Session> {
+    return this.client.request<Session>('POST', `/api/containers/${containerId}/sessions`, options);
+  }
+
+  /**
+   * End a named session and everything running in it
+   */
+  async deleteSession(containerId: string, sessionId: string): Promise<void> {
+    await this.client.request('DELETE', `/api/containers/${containerId}/sessions/${encodeURIComponent(sessionId)}`);
+  }
 }
 
 /**
@@ -291,6 +559,8 @@ export class RexecClient {
   public files: FileService;
   /** Terminal connections */
   public terminal: TerminalService;
+  /** Environment templates */
+  public templates: TemplateService;
 
   constructor(config: RexecConfig) {
     this.baseURL = config.baseURL.replace(/\/$/, '');
@@ -300,6 +570,7 @@ export class RexecClient {
     this.containers = new ContainerService(this);
     this.files = new FileService(this);
     this.terminal = new TerminalService(this);
+    this.templates = new TemplateService(this);
   }
 
   /**
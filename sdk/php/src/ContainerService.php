@@ -45,7 +45,7 @@ class ContainerService
      * Create a new container.
      *
      * @param string $image Docker image to use
-     * @param array $options Optional: name, environment, labels
+     * @param array $options Optional: name, environment, labels, template (rexec.yaml template ID or name)
      * @throws RexecException
      */
     public function create(string $image, array $options = []): Container
@@ -90,3 +90,35 @@ class ExecResult
         return $this->exitCode === 0;
     }
 }
+
+/**
+ * Shell lifecycle event on a terminal stream: exit, restart, command_start
+ * or command_end. Command events need a shell with integration (the zsh set
+ * up in Rexec terminals has it).
+ */
+class TerminalEvent
+{
+    public const TYPES = ['exit', 'restart', 'command_start', 'command_end'];
+
+    public string $type;
+    /** Exit code of the shell (exit) or command (command_end) */
+    public ?int $exitCode;
+    /** Signal that killed the shell, e.g. "KILL" */
+    public ?string $signal;
+    /** Working directory the command ran in (command_start) or left (command_end) */
+    public ?string $cwd;
+    /** How long the command ran (command_end) */
+    public ?int $durationMs;
+    /** Restarts so far (restart) */
+    public ?int $restarts;
+
+    public function __construct(array $data)
+    {
+        $this->type = $data['type'] ?? '';
+        $this->exitCode = $data['exit_code'] ?? null;
+        $this->signal = $data['signal'] ?? null;
+        $this->cwd = $data['cwd'] ?? null;
+        $this->durationMs = $data['duration_ms'] ?? null;
+        $this->restarts = $data['restarts'] ?? null;
+    }
+}
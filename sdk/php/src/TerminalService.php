@@ -47,6 +47,8 @@ class Terminal
     /** @var callable|null */
     private $onData = null;
     /** @var callable|null */
+    private $onEvent = null;
+    /** @var callable|null */
     private $onClose = null;
     /** @var callable|null */
     private $onError = null;
@@ -78,6 +80,9 @@ class Terminal
                     if ($this->onData) {
                         ($this->onData)((string)$msg);
                     }
+                    if ($this->onEvent && !$msg->isBinary()) {
+                        $this->dispatchEvent((string)$msg);
+                    }
                 });
 
                 $conn->on('close', function () {
@@ -127,6 +132,18 @@ class Terminal
         return $this;
     }
 
+    /**
+     * Set handler for shell lifecycle events (exit, restart, command_start,
+     * command_end). Their messages are still passed to the data handler too.
+     *
+     * @param callable(TerminalEvent): void $handler
+     */
+    public function onEvent(callable $handler): self
+    {
+        $this->onEvent = $handler;
+        return $this;
+    }
+
     /**
      * Set handler for close event.
      */
@@ -145,6 +162,14 @@ class Terminal
         return $this;
     }
 
+    private function dispatchEvent(string $data): void
+    {
+        $message = json_decode($data, true);
+        if (is_array($message) && in_array($message['type'] ?? null, TerminalEvent::TYPES, true)) {
+            ($this->onEvent)(new TerminalEvent($message));
+        }
+    }
+
     /**
      * Check if the terminal is connected.
      */
@@ -47,5 +47,5 @@ pub use client::RexecClient;
 pub use containers::ContainerService;
 pub use error::Error;
 pub use files::FileService;
-pub use terminal::{Terminal, TerminalService};
+pub use terminal::{Terminal, TerminalMessage, TerminalService};
 pub use types::*;
@@ -7,12 +7,21 @@ use tokio_tungstenite::{connect_async, tungstenite::Message};
 
 use crate::client::ClientInner;
 use crate::error::{Error, Result};
-use crate::types::ResizeMessage;
+use crate::types::{ResizeMessage, TerminalEvent};
 
 type WsStream = tokio_tungstenite::WebSocketStream<
     tokio_tungstenite::MaybeTlsStream<tokio::net::TcpStream>,
 >;
 
+/// A message read from a terminal.
+#[derive(Debug, Clone)]
+pub enum TerminalMessage {
+    /// Output from the shell.
+    Output(Vec<u8>),
+    /// A shell lifecycle event (exit, restart, command_start, command_end).
+    Event(TerminalEvent),
+}
+
 /// WebSocket terminal connection to a container.
 pub struct Terminal {
     ws: Arc<Mutex<WsStream>>,
@@ -53,37 +62,43 @@ impl Terminal {
     ///
     /// Bytes received from the terminal, or `None` if connection closed.
     pub async fn read(&mut self) -> Result<Option<Vec<u8>>> {
+        Ok(self.next_message().await?.map(|msg| msg.into_data()))
+    }
+
+    /// Read the next message from the terminal, telling shell lifecycle
+    /// events apart from output.
+    ///
+    /// # Returns
+    ///
+    /// The next message, or `None` if connection closed.
+    pub async fn read_message(&mut self) -> Result<Option<TerminalMessage>> {
+        let msg = match self.next_message().await? {
+            Some(msg) => msg,
+            None => return Ok(None),
+        };
+        if let Message::Text(text) = &msg {
+            if let Ok(event) = serde_json::from_str::<TerminalEvent>(text) {
+                if TerminalEvent::TYPES.contains(&event.event_type.as_str()) {
+                    return Ok(Some(TerminalMessage::Event(event)));
+                }
+            }
+        }
+        Ok(Some(TerminalMessage::Output(msg.into_data())))
+    }
+
+    async fn next_message(&mut self) -> Result<Option<Message>> {
         if self.closed {
             return Err(Error::TerminalClosed);
         }
 
         let mut ws = self.ws.lock().await;
-        
-        match ws.next().await {
-            Some(Ok(Message::Binary(data))) => Ok(Some(data)),
-            Some(Ok(Message::Text(text))) => Ok(Some(text.into_bytes())),
-            Some(Ok(Message::Close(_))) => {
-                self.closed = true;
-                Ok(None)
-            }
-            Some(Ok(_)) => self.read_inner(&mut ws).await,
-            Some(Err(e)) => {
-                self.closed = true;
-                Err(e.into())
-            }
-            None => {
-                self.closed = true;
-                Ok(None)
-            }
-        }
-    }
 
-    async fn read_inner(&mut self, ws: &mut WsStream) -> Result<Option<Vec<u8>>> {
         // Skip ping/pong messages
         loop {
             match ws.next().await {
-                Some(Ok(Message::Binary(data))) => return Ok(Some(data)),
-                Some(Ok(Message::Text(text))) => return Ok(Some(text.into_bytes())),
+                Some(Ok(msg @ Message::Binary(_))) | Some(Ok(msg @ Message::Text(_))) => {
+                    return Ok(Some(msg))
+                }
                 Some(Ok(Message::Close(_))) => {
                     self.closed = true;
                     return Ok(None);
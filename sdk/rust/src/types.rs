@@ -41,11 +41,15 @@ pub struct Container {
 /// Request to create a new container.
 #[derive(Debug, Clone, Serialize, Default)]
 pub struct CreateContainerRequest {
-    /// Docker image to use.
+    /// Docker image to use (may be empty when a template is set).
+    #[serde(skip_serializing_if = "String::is_empty")]
     pub image: String,
     /// Optional container name.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub name: Option<String>,
+    /// Environment template ID or name; explicit fields override it.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub template: Option<String>,
     /// Environment variables.
     #[serde(skip_serializing_if = "HashMap::is_empty", default)]
     pub environment: HashMap<String, String>,
@@ -63,6 +67,14 @@ impl CreateContainerRequest {
         }
     }
 
+    /// Create a new request from an environment template (rexec.yaml).
+    pub fn from_template(template: impl Into<String>) -> Self {
+        Self {
+            template: Some(template.into()),
+            ..Default::default()
+        }
+    }
+
     /// Set the container name.
     pub fn name(mut self, name: impl Into<String>) -> Self {
         self.name = Some(name.into());
@@ -99,6 +111,35 @@ pub struct FileInfo {
     pub is_dir: bool,
 }
 
+/// Shell lifecycle event on a terminal stream. Command events need a shell
+/// with integration (the zsh set up in Rexec terminals has it).
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct TerminalEvent {
+    /// Event type: `exit`, `restart`, `command_start` or `command_end`.
+    #[serde(rename = "type")]
+    pub event_type: String,
+    /// Exit code of the shell (`exit`) or command (`command_end`).
+    #[serde(default)]
+    pub exit_code: Option<i32>,
+    /// Signal that killed the shell, e.g. `KILL`.
+    #[serde(default)]
+    pub signal: Option<String>,
+    /// Working directory the command ran in (`command_start`) or left (`command_end`).
+    #[serde(default)]
+    pub cwd: Option<String>,
+    /// How long the command ran in milliseconds (`command_end`).
+    #[serde(default)]
+    pub duration_ms: Option<u64>,
+    /// Restarts so far (`restart`).
+    #[serde(default)]
+    pub restarts: Option<u32>,
+}
+
+impl TerminalEvent {
+    /// Event types sent on terminal streams.
+    pub const TYPES: [&'static str; 4] = ["exit", "restart", "command_start", "command_end"];
+}
+
 /// Terminal resize message.
 #[derive(Debug, Clone, Serialize)]
 pub struct ResizeMessage {